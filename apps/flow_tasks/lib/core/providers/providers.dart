@@ -1379,8 +1379,8 @@ class AIDraftActions {
 
   TasksService get _service => _ref.read(tasksServiceProvider);
 
-  /// Approve a draft
-  Future<void> approve(String draftId, {bool send = false}) async {
+  /// Approve and send a draft
+  Future<void> approve(String draftId, {bool send = true}) async {
     await _service.approveDraft(draftId, send: send);
     _ref.invalidate(aiDraftsProvider);
   }
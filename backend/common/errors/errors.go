@@ -106,6 +106,9 @@ var (
 
 	// ErrAIFeatureNotAvailable is returned when AI feature is not in user's plan
 	ErrAIFeatureNotAvailable = errors.New("AI feature not available in your plan")
+
+	// ErrAIContentBlocked is returned when a provider's safety filters refuse the content
+	ErrAIContentBlocked = errors.New("AI provider declined the content")
 )
 
 // AppError represents an application error with additional context
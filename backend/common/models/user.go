@@ -64,9 +64,10 @@ type AIPreferences struct {
 type AISetting string
 
 const (
-	AISettingAuto AISetting = "auto" // AI runs automatically
-	AISettingAsk  AISetting = "ask"  // AI suggests, user approves
-	AISettingOff  AISetting = "off"  // Feature disabled
+	AISettingAuto   AISetting = "auto"   // AI runs automatically
+	AISettingReview AISetting = "review" // AI runs automatically, changes wait for approval
+	AISettingAsk    AISetting = "ask"    // AI suggests, user approves
+	AISettingOff    AISetting = "off"    // Feature disabled
 )
 
 // DefaultAIPreferences returns the default AI preferences for new users
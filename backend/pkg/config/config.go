@@ -27,6 +27,14 @@ type EmailConfig struct {
 	ResendAPIKey string `mapstructure:"RESEND_API_KEY"`
 	From         string `mapstructure:"EMAIL_FROM"`
 	AppURL       string `mapstructure:"APP_URL"` // For generating reset links
+
+	// Delivery events (bounces) for sent AI drafts, signed by Resend (Svix)
+	ResendWebhookSecret string `mapstructure:"RESEND_WEBHOOK_SECRET"`
+
+	// Inbound email-to-task gateway
+	InboundDomain   string `mapstructure:"INBOUND_EMAIL_DOMAIN"` // Users get <token>@<domain>
+	InboundSecret   string `mapstructure:"INBOUND_EMAIL_SECRET"` // Shared secret for the inbound-parse webhook
+	InboundSMTPAddr string `mapstructure:"INBOUND_SMTP_ADDR"`    // e.g. ":2525"; empty disables the SMTP listener
 }
 
 // ServerConfig holds server-related configuration
@@ -122,6 +130,50 @@ type LLMConfig struct {
 	OpenAIProjectID  string `mapstructure:"OPENAI_PROJECT_ID"`
 	OllamaHost       string `mapstructure:"OLLAMA_HOST"`
 	OllamaModel      string `mapstructure:"OLLAMA_MODEL"`
+
+	// Embeddings for semantic search. Vectors from different models can't
+	// be compared, so one provider serves them all: this one, else the
+	// default provider if it has embeddings, else the first configured of
+	// openai, google, ollama. The model only applies with the provider set;
+	// otherwise the provider's default model is used.
+	EmbeddingProvider string `mapstructure:"LLM_EMBEDDING_PROVIDER"`
+	EmbeddingModel    string `mapstructure:"LLM_EMBEDDING_MODEL"`
+
+	// Fake provider for tests and CI (LLM_DEFAULT_PROVIDER=fake): replay
+	// answers from recorded cassettes only, record fills in missing ones
+	// from FakeUpstream (or the first configured provider)
+	FakeMode     string `mapstructure:"LLM_FAKE_MODE"`
+	CassetteDir  string `mapstructure:"LLM_CASSETTE_DIR"`
+	FakeUpstream string `mapstructure:"LLM_FAKE_UPSTREAM"`
+
+	// Response cache in Redis; cache hits can be left out of AI quotas
+	CacheEnabled  bool `mapstructure:"LLM_CACHE_ENABLED"`
+	CacheFreeHits bool `mapstructure:"LLM_CACHE_FREE_HITS"`
+
+	// Routing between providers. Fallbacks lists the chain tried after each
+	// provider, e.g. "anthropic:openai,google;openai:anthropic"; providers
+	// left out keep the built-in chain. Zero values use the llm defaults.
+	Fallbacks       string        `mapstructure:"LLM_FALLBACKS"`
+	RetryAttempts   int           `mapstructure:"LLM_RETRY_ATTEMPTS"`
+	BreakerFailures int           `mapstructure:"LLM_BREAKER_FAILURES"`
+	BreakerCoolDown time.Duration `mapstructure:"LLM_BREAKER_COOLDOWN"`
+
+	// Named OpenAI-compatible endpoints (vLLM, LM Studio, OpenRouter) as
+	// JSON, e.g. {"vllm": {"base_url": "http://vllm:8000/v1", "model": "..."}}.
+	// Each becomes a provider under its name for fallbacks and the routing table.
+	Endpoints string `mapstructure:"LLM_OPENAI_COMPATIBLE"`
+
+	// Usage records and daily spend caps in USD (0 = no cap). Past a cap,
+	// calls go to Ollama when it is running and are refused otherwise.
+	// Prices is a JSON table of USD per million tokens by model, over the
+	// built-in one.
+	Prices              string  `mapstructure:"LLM_PRICES"`
+	UserDailySpendCap   float64 `mapstructure:"LLM_USER_DAILY_SPEND_CAP"`
+	GlobalDailySpendCap float64 `mapstructure:"LLM_GLOBAL_DAILY_SPEND_CAP"`
+
+	// AI job queue workers run by the tasks API process; 0 leaves the queue
+	// to a separate ai-worker process
+	QueueWorkers int `mapstructure:"AI_QUEUE_WORKERS"`
 }
 
 // Load loads configuration from environment variables and config files
@@ -262,6 +314,63 @@ func overrideFromEnv(config *Config) {
 	if val := os.Getenv("GOOGLE_AI_API_KEY"); val != "" {
 		config.LLM.GoogleAPIKey = val
 	}
+	if val := os.Getenv("LLM_EMBEDDING_PROVIDER"); val != "" {
+		config.LLM.EmbeddingProvider = val
+	}
+	if val := os.Getenv("LLM_EMBEDDING_MODEL"); val != "" {
+		config.LLM.EmbeddingModel = val
+	}
+	if val := os.Getenv("LLM_FAKE_MODE"); val != "" {
+		config.LLM.FakeMode = val
+	}
+	if val := os.Getenv("LLM_CASSETTE_DIR"); val != "" {
+		config.LLM.CassetteDir = val
+	}
+	if val := os.Getenv("LLM_FAKE_UPSTREAM"); val != "" {
+		config.LLM.FakeUpstream = val
+	}
+	config.LLM.CacheEnabled = os.Getenv("LLM_CACHE_ENABLED") != "false"
+	config.LLM.CacheFreeHits = os.Getenv("LLM_CACHE_FREE_HITS") == "true"
+	if val := os.Getenv("LLM_FALLBACKS"); val != "" {
+		config.LLM.Fallbacks = val
+	}
+	if val := os.Getenv("LLM_OPENAI_COMPATIBLE"); val != "" {
+		config.LLM.Endpoints = val
+	}
+	if val := os.Getenv("LLM_RETRY_ATTEMPTS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			config.LLM.RetryAttempts = n
+		}
+	}
+	if val := os.Getenv("LLM_BREAKER_FAILURES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			config.LLM.BreakerFailures = n
+		}
+	}
+	if val := os.Getenv("LLM_BREAKER_COOLDOWN"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			config.LLM.BreakerCoolDown = d
+		}
+	}
+	if val := os.Getenv("LLM_PRICES"); val != "" {
+		config.LLM.Prices = val
+	}
+	if val := os.Getenv("LLM_USER_DAILY_SPEND_CAP"); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil && f >= 0 {
+			config.LLM.UserDailySpendCap = f
+		}
+	}
+	if val := os.Getenv("LLM_GLOBAL_DAILY_SPEND_CAP"); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil && f >= 0 {
+			config.LLM.GlobalDailySpendCap = f
+		}
+	}
+	config.LLM.QueueWorkers = 4
+	if val := os.Getenv("AI_QUEUE_WORKERS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			config.LLM.QueueWorkers = n
+		}
+	}
 
 	// Email settings
 	if val := os.Getenv("RESEND_API_KEY"); val != "" {
@@ -273,6 +382,18 @@ func overrideFromEnv(config *Config) {
 	if val := os.Getenv("APP_URL"); val != "" {
 		config.Email.AppURL = val
 	}
+	if val := os.Getenv("RESEND_WEBHOOK_SECRET"); val != "" {
+		config.Email.ResendWebhookSecret = val
+	}
+	if val := os.Getenv("INBOUND_EMAIL_DOMAIN"); val != "" {
+		config.Email.InboundDomain = val
+	}
+	if val := os.Getenv("INBOUND_EMAIL_SECRET"); val != "" {
+		config.Email.InboundSecret = val
+	}
+	if val := os.Getenv("INBOUND_SMTP_ADDR"); val != "" {
+		config.Email.InboundSMTPAddr = val
+	}
 
 	// Default email from if not set
 	if config.Email.From == "" {
@@ -282,6 +403,10 @@ func overrideFromEnv(config *Config) {
 	if config.Email.AppURL == "" {
 		config.Email.AppURL = "https://flowtasks.ai"
 	}
+	// Default inbound domain
+	if config.Email.InboundDomain == "" {
+		config.Email.InboundDomain = "in.flowtasks.ai"
+	}
 }
 
 // LoadForService loads configuration for a specific service
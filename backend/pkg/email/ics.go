@@ -0,0 +1,113 @@
+package email
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICSContentType is the MIME type of a calendar invitation attachment
+const ICSContentType = "text/calendar; method=REQUEST; charset=UTF-8"
+
+// Invite is a calendar event sent to attendees as an RFC 5545 request
+type Invite struct {
+	UID            string // Stable per event, so a resend updates instead of duplicating
+	Sequence       int
+	Summary        string
+	Description    string
+	Location       string
+	Start          time.Time
+	End            time.Time
+	Floating       bool // Start/End have no time zone (local time wherever the attendee is)
+	OrganizerName  string
+	OrganizerEmail string
+	Attendees      []string // Email addresses
+}
+
+// ICS renders the invite as a VCALENDAR with METHOD:REQUEST
+func (i Invite) ICS() []byte {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICSLine(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("PRODID:-//Flow//Tasks//EN")
+	line("VERSION:2.0")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:REQUEST")
+	line("BEGIN:VEVENT")
+	line("UID:" + i.UID)
+	line("SEQUENCE:" + fmt.Sprint(i.Sequence))
+	line("DTSTAMP:" + time.Now().UTC().Format("20060102T150405Z"))
+	line("DTSTART:" + i.icsTime(i.Start))
+	line("DTEND:" + i.icsTime(i.End))
+	line("SUMMARY:" + escapeICSText(i.Summary))
+	if i.Description != "" {
+		line("DESCRIPTION:" + escapeICSText(i.Description))
+	}
+	if i.Location != "" {
+		line("LOCATION:" + escapeICSText(i.Location))
+	}
+	if i.OrganizerEmail != "" {
+		organizer := "ORGANIZER"
+		if i.OrganizerName != "" {
+			organizer += ";CN=" + quoteICSParam(i.OrganizerName)
+		}
+		line(organizer + ":mailto:" + i.OrganizerEmail)
+	}
+	for _, attendee := range i.Attendees {
+		line("ATTENDEE;CUTYPE=INDIVIDUAL;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + attendee)
+	}
+	line("STATUS:CONFIRMED")
+	line("TRANSP:OPAQUE")
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+func (i Invite) icsTime(t time.Time) string {
+	if i.Floating {
+		return t.Format("20060102T150405")
+	}
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeICSText escapes a TEXT value (RFC 5545 section 3.3.11)
+func escapeICSText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`)
+	return replacer.Replace(s)
+}
+
+// quoteICSParam quotes a parameter value; DQUOTE can't appear inside one
+func quoteICSParam(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "'") + `"`
+}
+
+// foldICSLine splits lines longer than 75 octets, continuing with a space,
+// without breaking UTF-8 sequences
+func foldICSLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+
+	var b strings.Builder
+	width := limit
+	for len(s) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		width = limit - 1 // the leading space counts
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package email
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscapeICSText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Plain text", "Plain text"},
+		{"Milk; eggs, bread", `Milk\; eggs\, bread`},
+		{`C:\temp`, `C:\\temp`},
+		{"Line one\nLine two", `Line one\nLine two`},
+		{"Windows\r\nbreak", `Windows\nbreak`},
+		{"Old Mac\rbreak", `Old Mac\nbreak`},
+		{`Already \n escaped`, `Already \\n escaped`},
+	}
+	for _, tt := range tests {
+		if got := escapeICSText(tt.in); got != tt.want {
+			t.Errorf("escapeICSText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteICSParam(t *testing.T) {
+	if got := quoteICSParam(`Nam "Bo" Tran`); got != `"Nam 'Bo' Tran"` {
+		t.Errorf("quoteICSParam = %s", got)
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string // Physical lines
+	}{
+		{"short", "SUMMARY:Standup", []string{"SUMMARY:Standup"}},
+		{"exactly 75", strings.Repeat("a", 75), []string{strings.Repeat("a", 75)}},
+		{"76", strings.Repeat("a", 76), []string{strings.Repeat("a", 75), " a"}},
+		{"continuations hold 74", strings.Repeat("a", 75+74+1), []string{
+			strings.Repeat("a", 75), " " + strings.Repeat("a", 74), " a",
+		}},
+		// "é" is two octets starting at octet 74; it moves whole to the next line
+		{"rune on the boundary", strings.Repeat("a", 74) + "éb", []string{strings.Repeat("a", 74), " éb"}},
+		// "中" is three octets starting at octet 73
+		{"three-octet rune", strings.Repeat("a", 73) + "中文", []string{strings.Repeat("a", 73), " 中文"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Split(foldICSLine(tt.in), "\r\n")
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFoldICSLineMultiByte(t *testing.T) {
+	in := "DESCRIPTION:" + strings.Repeat("Họp với khách hàng về dự án mới – 会議 🗓️ ", 12)
+	folded := foldICSLine(in)
+
+	for i, line := range strings.Split(folded, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets", i, len(line))
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d doesn't start with a space", i)
+		}
+	}
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != in {
+		t.Errorf("unfolded text differs from the input")
+	}
+}
+
+func TestInviteICS(t *testing.T) {
+	hanoi := time.FixedZone("ICT", 7*3600)
+	invite := Invite{
+		UID:            "task-1@flow",
+		Sequence:       2,
+		Summary:        "Review, then ship; v2",
+		Description:    "Agenda:\nDemo",
+		Location:       "Room 4",
+		Start:          time.Date(2026, 3, 10, 9, 0, 0, 0, hanoi),
+		End:            time.Date(2026, 3, 10, 9, 30, 0, 0, hanoi),
+		OrganizerName:  `Nam "Bo" Tran`,
+		OrganizerEmail: "nam@example.com",
+		Attendees:      []string{"lan@example.com"},
+	}
+
+	tests := []struct {
+		name     string
+		floating bool
+		want     []string
+	}{
+		{"utc", false, []string{"DTSTART:20260310T020000Z", "DTEND:20260310T023000Z"}},
+		{"floating", true, []string{"DTSTART:20260310T090000", "DTEND:20260310T093000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invite.Floating = tt.floating
+			ics := string(invite.ICS())
+
+			if !strings.HasSuffix(ics, "END:VCALENDAR\r\n") || strings.Contains(strings.ReplaceAll(ics, "\r\n", ""), "\n") {
+				t.Error("lines must end with CRLF")
+			}
+			lines := strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n")
+			want := append([]string{
+				"METHOD:REQUEST",
+				"UID:task-1@flow",
+				"SEQUENCE:2",
+				`SUMMARY:Review\, then ship\; v2`,
+				`DESCRIPTION:Agenda:\nDemo`,
+				"LOCATION:Room 4",
+				`ORGANIZER;CN="Nam 'Bo' Tran":mailto:nam@example.com`,
+			}, tt.want...)
+			for _, w := range want {
+				if !slices.Contains(lines, w) {
+					t.Errorf("missing line %q in\n%s", w, ics)
+				}
+			}
+		})
+	}
+}
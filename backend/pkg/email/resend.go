@@ -3,6 +3,7 @@ package email
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,19 +31,37 @@ func NewClient(apiKey, from string) *Client {
 
 // Email represents an email to send
 type Email struct {
-	To      []string `json:"to"`
-	Subject string   `json:"subject"`
-	HTML    string   `json:"html,omitempty"`
-	Text    string   `json:"text,omitempty"`
+	To          []string     `json:"to"`
+	Subject     string       `json:"subject"`
+	HTML        string       `json:"html,omitempty"`
+	Text        string       `json:"text,omitempty"`
+	ReplyTo     string       `json:"reply_to,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
 }
 
 // resendRequest is the request body for Resend API
 type resendRequest struct {
-	From    string   `json:"from"`
-	To      []string `json:"to"`
-	Subject string   `json:"subject"`
-	HTML    string   `json:"html,omitempty"`
-	Text    string   `json:"text,omitempty"`
+	From        string             `json:"from"`
+	To          []string           `json:"to"`
+	Subject     string             `json:"subject"`
+	HTML        string             `json:"html,omitempty"`
+	Text        string             `json:"text,omitempty"`
+	ReplyTo     string             `json:"reply_to,omitempty"`
+	Attachments []resendAttachment `json:"attachments,omitempty"`
+}
+
+// resendAttachment is an attachment in the Resend API (content is base64)
+type resendAttachment struct {
+	Filename    string `json:"filename"`
+	Content     string `json:"content"`
+	ContentType string `json:"content_type,omitempty"`
 }
 
 // resendResponse is the response from Resend API
@@ -69,6 +88,14 @@ func (c *Client) Send(ctx context.Context, email Email) (string, error) {
 		Subject: email.Subject,
 		HTML:    email.HTML,
 		Text:    email.Text,
+		ReplyTo: email.ReplyTo,
+	}
+	for _, a := range email.Attachments {
+		reqBody.Attachments = append(reqBody.Attachments, resendAttachment{
+			Filename:    a.Filename,
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			ContentType: a.ContentType,
+		})
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -150,6 +150,10 @@ func errorCode(status int) string {
 		return "NOT_FOUND"
 	case fiber.StatusConflict:
 		return "CONFLICT"
+	case fiber.StatusPaymentRequired:
+		return "PAYMENT_REQUIRED"
+	case fiber.StatusUnprocessableEntity:
+		return "UNPROCESSABLE_ENTITY"
 	case fiber.StatusTooManyRequests:
 		return "RATE_LIMIT_EXCEEDED"
 	case fiber.StatusServiceUnavailable:
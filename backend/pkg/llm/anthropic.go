@@ -40,11 +40,12 @@ type anthropicRequest struct {
 	System      string            `json:"system,omitempty"`
 	Temperature float64           `json:"temperature,omitempty"`
 	Tools       []anthropicTool   `json:"tools,omitempty"`
+	Stream      bool              `json:"stream,omitempty"`
 }
 
 type anthropicMsg struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // string, or []anthropicContent for tool use
 }
 
 type anthropicTool struct {
@@ -70,6 +71,8 @@ type anthropicContent struct {
 	ID        string          `json:"id,omitempty"`
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"` // tool_result
+	Content   string          `json:"content,omitempty"`     // tool_result
 }
 
 type anthropicUsage struct {
@@ -79,6 +82,63 @@ type anthropicUsage struct {
 
 // Complete implements the Client interface
 func (c *AnthropicClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	httpReq, err := c.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(ProviderAnthropic, ctx, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(ProviderAnthropic, resp, respBody)
+	}
+
+	var anthropicResp anthropicResponse
+	if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	// Convert response
+	result := &CompletionResponse{
+		Model: anthropicResp.Model,
+		Usage: Usage{
+			PromptTokens:     anthropicResp.Usage.InputTokens,
+			CompletionTokens: anthropicResp.Usage.OutputTokens,
+			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
+		},
+	}
+
+	for _, content := range anthropicResp.Content {
+		switch content.Type {
+		case "text":
+			result.Content = content.Text
+		case "tool_use":
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:         content.ID,
+				Name:       content.Name,
+				Parameters: toolArgs(content.Input),
+			})
+		}
+	}
+
+	if anthropicResp.StopReason == "refusal" && result.Content == "" && len(result.ToolCalls) == 0 {
+		return nil, safetyError(ProviderAnthropic, "model refused the request")
+	}
+
+	return result, nil
+}
+
+// newRequest builds the HTTP request for a completion, streamed or not
+func (c *AnthropicClient) newRequest(ctx context.Context, req CompletionRequest, stream bool) (*http.Request, error) {
 	model := req.Model
 	if model == "" {
 		model = defaultAnthropicModel
@@ -93,20 +153,56 @@ func (c *AnthropicClient) Complete(ctx context.Context, req CompletionRequest) (
 	msgs := make([]anthropicMsg, 0, len(req.Messages))
 	var systemMsg string
 	for _, m := range req.Messages {
-		if m.Role == "system" {
+		switch {
+		case m.Role == "system":
 			systemMsg = m.Content
-			continue
+		case m.Role == "tool":
+			// Tool results are user content blocks; results for one turn's
+			// calls must go back together in a single message
+			block := anthropicContent{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			if n := len(msgs); n > 0 && msgs[n-1].Role == "user" {
+				if blocks, ok := msgs[n-1].Content.([]anthropicContent); ok {
+					msgs[n-1].Content = append(blocks, block)
+					continue
+				}
+			}
+			msgs = append(msgs, anthropicMsg{Role: "user", Content: []anthropicContent{block}})
+		case len(m.ToolCalls) > 0:
+			var blocks []anthropicContent
+			if m.Content != "" {
+				blocks = append(blocks, anthropicContent{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				blocks = append(blocks, anthropicContent{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Name,
+					Input: toolArgs(call.Parameters),
+				})
+			}
+			msgs = append(msgs, anthropicMsg{Role: "assistant", Content: blocks})
+		default:
+			// A user message right after tool results joins them, as roles
+			// must alternate
+			if n := len(msgs); n > 0 && m.Role == "user" && msgs[n-1].Role == "user" {
+				if blocks, ok := msgs[n-1].Content.([]anthropicContent); ok {
+					msgs[n-1].Content = append(blocks, anthropicContent{Type: "text", Text: m.Content})
+					continue
+				}
+			}
+			msgs = append(msgs, anthropicMsg{
+				Role:    m.Role,
+				Content: m.Content,
+			})
 		}
-		msgs = append(msgs, anthropicMsg{
-			Role:    m.Role,
-			Content: m.Content,
-		})
 	}
 
 	// Use explicit system message if provided
 	if req.SystemMsg != "" {
 		systemMsg = req.SystemMsg
 	}
+	// Anthropic has no JSON mode; the schema goes in the system prompt
+	systemMsg = schemaInstruction(systemMsg, req.Schema)
 
 	// Convert tools
 	var tools []anthropicTool
@@ -125,6 +221,7 @@ func (c *AnthropicClient) Complete(ctx context.Context, req CompletionRequest) (
 		System:      systemMsg,
 		Temperature: req.Temperature,
 		Tools:       tools,
+		Stream:      stream,
 	}
 
 	body, err := json.Marshal(anthropicReq)
@@ -141,71 +238,71 @@ func (c *AnthropicClient) Complete(ctx context.Context, req CompletionRequest) (
 	httpReq.Header.Set("x-api-key", c.apiKey)
 	httpReq.Header.Set("anthropic-version", anthropicVersion)
 
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
+	return httpReq, nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+// Stream implements streaming for Anthropic (Messages API server-sent events)
+func (c *AnthropicClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	httpReq, err := c.newRequest(ctx, req, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
-	var anthropicResp anthropicResponse
-	if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, err
 	}
-
-	// Convert response
-	result := &CompletionResponse{
-		Model: anthropicResp.Model,
-		Usage: Usage{
-			PromptTokens:     anthropicResp.Usage.InputTokens,
-			CompletionTokens: anthropicResp.Usage.OutputTokens,
-			TotalTokens:      anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens,
-		},
-	}
-
-	for _, content := range anthropicResp.Content {
-		switch content.Type {
-		case "text":
-			result.Content = content.Text
-		case "tool_use":
-			result.ToolCalls = append(result.ToolCalls, ToolCall{
-				ID:         content.ID,
-				Name:       content.Name,
-				Parameters: content.Input,
-			})
-		}
+	body, err := startStream(ProviderAnthropic, c.httpClient, httpReq)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
-}
-
-// Stream implements streaming for Anthropic
-func (c *AnthropicClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
-	// For now, implement as a simple wrapper around Complete
-	// Full streaming implementation would use SSE
 	ch := make(chan StreamChunk)
-
 	go func() {
 		defer close(ch)
+		defer body.Close()
+		out := streamWriter{ctx: ctx, ch: ch}
 
-		resp, err := c.Complete(ctx, req)
-		if err != nil {
-			ch <- StreamChunk{Done: true}
-			return
-		}
+		var model string
+		var usage Usage
+		var apiErr error
+		err := readSSE(body, func(_, data string) bool {
+			var event struct {
+				Type    string `json:"type"`
+				Message struct {
+					Model string         `json:"model"`
+					Usage anthropicUsage `json:"usage"`
+				} `json:"message"`
+				Delta struct {
+					Type string `json:"type"`
+					Text string `json:"text"`
+				} `json:"delta"`
+				Usage anthropicUsage `json:"usage"`
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &event) != nil {
+				return true
+			}
 
-		ch <- StreamChunk{
-			Content: resp.Content,
-			Done:    true,
+			switch event.Type {
+			case "message_start":
+				model = event.Message.Model
+				usage.PromptTokens = event.Message.Usage.InputTokens
+			case "content_block_delta":
+				if event.Delta.Type == "text_delta" {
+					return out.text(event.Delta.Text)
+				}
+			case "message_delta":
+				usage.CompletionTokens = event.Usage.OutputTokens
+			case "message_stop":
+				return false
+			case "error":
+				apiErr = streamError(ProviderAnthropic, event.Error.Message)
+				return false
+			}
+			return true
+		})
+		if apiErr != nil {
+			err = apiErr
 		}
+		out.done(model, usage, err)
 	}()
 
 	return ch, nil
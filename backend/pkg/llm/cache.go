@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CacheStore keeps cached responses; the services use Redis
+type CacheStore interface {
+	// Get returns nil, nil on a miss
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CacheRule is how responses for one feature are cached
+type CacheRule struct {
+	TTL time.Duration // 0 disables caching
+	// AnyTemperature also caches requests with temperature > 0, where the
+	// same prompt could otherwise get a different answer
+	AnyTemperature bool
+}
+
+// CacheConfig selects which completions are cached. Requests are matched by
+// CompletionRequest.Feature; streams are never cached.
+type CacheConfig struct {
+	Default  CacheRule
+	Features map[string]CacheRule
+	// FreeHits tells callers that meter usage not to charge for responses
+	// served from the cache
+	FreeHits bool
+}
+
+// CacheStats counts cache lookups for one feature
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Bypassed int64 `json:"bypassed"` // Not cacheable under the rules
+	Errors   int64 `json:"errors"`   // Store failures, served uncached
+}
+
+// responseCache caches completions by a hash of everything that shapes the answer
+type responseCache struct {
+	store CacheStore
+	cfg   CacheConfig
+
+	mu    sync.Mutex
+	stats map[string]*CacheStats
+}
+
+func (rc *responseCache) rule(req CompletionRequest) CacheRule {
+	if rule, ok := rc.cfg.Features[req.Feature]; ok {
+		return rule
+	}
+	return rc.cfg.Default
+}
+
+func (rc *responseCache) count(feature string, fn func(s *CacheStats)) {
+	if feature == "" {
+		feature = "other"
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	s, ok := rc.stats[feature]
+	if !ok {
+		s = &CacheStats{}
+		rc.stats[feature] = s
+	}
+	fn(s)
+}
+
+// cacheKey hashes the provider, model, prompt, sampling, tools and schema of a request
+func cacheKey(provider Provider, req CompletionRequest) string {
+	data, _ := json.Marshal(struct {
+		Provider    Provider  `json:"p"`
+		Model       string    `json:"m"`
+		System      string    `json:"s"`
+		Messages    []Message `json:"msgs"`
+		Temperature float64   `json:"t"`
+		MaxTokens   int       `json:"max"`
+		Tools       []Tool    `json:"tools"`
+		Schema      *Schema   `json:"schema,omitempty"`
+	}{provider, req.Model, req.SystemMsg, req.Messages, req.Temperature, req.MaxTokens, req.Tools, req.Schema})
+	sum := sha256.Sum256(data)
+	return "llm:cache:" + hex.EncodeToString(sum[:])
+}
+
+// EnableCache caches Complete responses in store according to cfg
+func (mc *MultiClient) EnableCache(store CacheStore, cfg CacheConfig) {
+	mc.cache = &responseCache{store: store, cfg: cfg, stats: make(map[string]*CacheStats)}
+}
+
+// CacheEnabled reports whether EnableCache was called
+func (mc *MultiClient) CacheEnabled() bool {
+	return mc.cache != nil
+}
+
+// FreeCacheHits reports whether responses served from the cache should be
+// left out of usage quotas
+func (mc *MultiClient) FreeCacheHits() bool {
+	return mc.cache != nil && mc.cache.cfg.FreeHits
+}
+
+// CacheStats returns lookup counts by feature since the process started
+func (mc *MultiClient) CacheStats() map[string]CacheStats {
+	out := make(map[string]CacheStats)
+	if mc.cache == nil {
+		return out
+	}
+	mc.cache.mu.Lock()
+	defer mc.cache.mu.Unlock()
+	for feature, s := range mc.cache.stats {
+		out[feature] = *s
+	}
+	return out
+}
+
+// cachedComplete serves a completion from the cache when the rules allow,
+// storing new answers. Store failures only cost the cache, never the call.
+func (mc *MultiClient) cachedComplete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	// Decide and key on what the first step sends, since a route may set its
+	// own temperature and max tokens
+	sent := mc.plan(req)[0].apply(req)
+
+	rc := mc.cache
+	rule := rc.rule(req)
+	if rule.TTL <= 0 || (sent.Temperature > 0 && !rule.AnyTemperature) {
+		rc.count(req.Feature, func(s *CacheStats) { s.Bypassed++ })
+		return mc.complete(ctx, req)
+	}
+
+	key := cacheKey(sent.Provider, sent)
+	data, err := rc.store.Get(ctx, key)
+	if err != nil {
+		rc.count(req.Feature, func(s *CacheStats) { s.Errors++ })
+	} else if data != nil {
+		var resp CompletionResponse
+		if json.Unmarshal(data, &resp) == nil {
+			rc.count(req.Feature, func(s *CacheStats) { s.Hits++ })
+			resp.Cached = true
+			return &resp, nil
+		}
+	}
+	if err == nil {
+		rc.count(req.Feature, func(s *CacheStats) { s.Misses++ })
+	}
+
+	resp, err := mc.complete(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Content != "" || len(resp.ToolCalls) > 0 {
+		if data, err := json.Marshal(resp); err == nil {
+			if err := rc.store.Set(ctx, key, data, rule.TTL); err != nil {
+				rc.count(req.Feature, func(s *CacheStats) { s.Errors++ })
+			}
+		}
+	}
+	return resp, nil
+}
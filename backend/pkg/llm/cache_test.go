@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memoryCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key], nil
+}
+
+func (m *memoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+type staticRoutes []Route
+
+func (r staticRoutes) Routes(ctx context.Context, feature string, userID uuid.UUID) ([]Route, error) {
+	return r, nil
+}
+
+func TestCacheUsesRouteSettings(t *testing.T) {
+	ctx := context.Background()
+	warm := 0.7
+
+	tests := []struct {
+		name       string
+		route      Route
+		wantCached bool
+	}{
+		{"route keeps temperature 0", Route{Provider: ProviderFake, MaxTokens: 300}, true},
+		{"route sets a temperature", Route{Provider: ProviderFake, Temperature: &warm}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, err := NewFakeClient(FakeReplay, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake.Script(CompletionResponse{Content: "first"}, CompletionResponse{Content: "second"})
+
+			mc := NewFakeMultiClient(fake)
+			mc.EnableRouting(staticRoutes{tt.route})
+			mc.EnableCache(&memoryCache{data: make(map[string][]byte)}, CacheConfig{
+				Default: CacheRule{TTL: time.Hour},
+			})
+
+			req := CompletionRequest{Feature: "clean", Messages: []Message{{Role: "user", Content: "buy milk"}}, MaxTokens: 100}
+			if _, err := mc.Complete(ctx, req); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := mc.Complete(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Cached != tt.wantCached {
+				t.Errorf("second call cached = %v, want %v", resp.Cached, tt.wantCached)
+			}
+			stats := mc.CacheStats()["clean"]
+			if tt.wantCached && stats.Hits != 1 {
+				t.Errorf("stats = %+v, want one hit", stats)
+			}
+			if !tt.wantCached && stats.Bypassed != 2 {
+				t.Errorf("stats = %+v, want two bypassed", stats)
+			}
+			if sent := fake.Requests()[0]; sent.MaxTokens != max(tt.route.MaxTokens, 100) {
+				t.Errorf("sent max tokens = %d", sent.MaxTokens)
+			}
+		})
+	}
+}
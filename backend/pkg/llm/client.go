@@ -4,6 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 // Provider represents an LLM provider
@@ -14,12 +18,18 @@ const (
 	ProviderGoogle    Provider = "google"
 	ProviderOpenAI    Provider = "openai"
 	ProviderOllama    Provider = "ollama"
+	ProviderFake      Provider = "fake" // Scripted and recorded responses, see FakeClient
 )
 
-// Message represents a chat message
+// Message represents a chat message. An assistant message that called tools
+// carries the calls; each result goes back as a "tool" message naming the
+// call it answers. Providers translate this to their own format.
 type Message struct {
-	Role    string `json:"role"`    // system, user, assistant
-	Content string `json:"content"`
+	Role       string     `json:"role"`    // system, user, assistant, tool
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // assistant: tools the model called
+	ToolCallID string     `json:"tool_call_id,omitempty"` // tool: the call this result answers
+	Name       string     `json:"name,omitempty"`         // tool: the tool's name
 }
 
 // Tool represents a function/tool that can be called by the LLM
@@ -29,7 +39,8 @@ type Tool struct {
 	Parameters  json.RawMessage `json:"parameters"` // JSON Schema
 }
 
-// ToolCall represents a tool invocation by the LLM
+// ToolCall represents a tool invocation by the LLM. Parameters is always a
+// JSON object; ID is generated for providers that don't assign one.
 type ToolCall struct {
 	ID         string          `json:"id"`
 	Name       string          `json:"name"`
@@ -45,6 +56,20 @@ type CompletionRequest struct {
 	Temperature float64
 	Tools       []Tool
 	SystemMsg   string // Optional system message
+	Feature     string    // Names the caller for cache rules and metrics
+	UserID      uuid.UUID // Whose usage this is; Nil for system calls
+	// PromptVersion is the prompt version the messages were built from,
+	// recorded so outcomes can be compared across versions
+	PromptVersion uuid.UUID
+	// Schema, when set, is the shape the answer must have. Providers use
+	// their JSON mode where they have one, and MultiClient validates the
+	// answer, asking the model once to repair one that doesn't match.
+	Schema *Schema
+
+	localOnly bool // Set by a spend cap or privacy mode: no fallback to paid providers
+	private   bool // Kept on the local model by the user's privacy mode
+
+	routes []Route // From the routing table, see EnableRouting
 }
 
 // CompletionResponse represents the LLM response
@@ -53,6 +78,11 @@ type CompletionResponse struct {
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 	Usage     Usage      `json:"usage"`
 	Model     string     `json:"model"`
+	Provider  Provider   `json:"provider,omitempty"` // Set by MultiClient
+	Cached    bool       `json:"cached,omitempty"`   // Served from the response cache
+
+	schemaStatus string // Schema outcome of an uncached call, see SchemaValid
+	redactions   int    // Values replaced by placeholders in the request
 }
 
 // Usage represents token usage information
@@ -62,11 +92,21 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-// StreamChunk represents a streaming response chunk
+// StreamChunk represents a streaming response chunk. A stream ends with one
+// chunk that has Done set, carrying the usage or the error that ended it.
 type StreamChunk struct {
-	Content  string `json:"content"`
-	Done     bool   `json:"done"`
+	Content  string    `json:"content"`
+	Done     bool      `json:"done"`
 	ToolCall *ToolCall `json:"tool_call,omitempty"`
+	Usage    *Usage    `json:"usage,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Err      error     `json:"-"`
+	// Replace, on the final chunk, is the answer to use instead of the
+	// streamed text when that failed the request's schema and was repaired
+	Replace string `json:"replace,omitempty"`
+
+	schemaStatus string
+	redactions   int
 }
 
 // Client is the interface for LLM clients
@@ -77,19 +117,36 @@ type Client interface {
 	Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error)
 }
 
-// MultiClient manages multiple LLM providers
+// MultiClient manages multiple LLM providers. Each provider is retried on
+// transient errors and skipped while its circuit breaker is open; failures
+// move on through the provider's fallback chain.
 type MultiClient struct {
 	providers map[Provider]Client
 	fallbacks map[Provider][]Provider
 	defaultProvider Provider
+	cache *responseCache // Set by EnableCache
+	usage *usageTracker  // Set by EnableUsage
+
+	redaction *redactor   // Set by EnableRedaction
+	routes    RouteSource // Set by EnableRouting
+
+	retry         RetryPolicy
+	breakerPolicy BreakerPolicy
+	breakers      map[Provider]*breaker // None for the fake provider
+
+	embedProvider Provider // Empty if no configured provider has embeddings
+	embedModel    string
 }
 
 // NewMultiClient creates a new multi-provider client
 func NewMultiClient(config Config) (*MultiClient, error) {
 	mc := &MultiClient{
-		providers: make(map[Provider]Client),
-		fallbacks: make(map[Provider][]Provider),
+		providers:       make(map[Provider]Client),
+		fallbacks:       defaultFallbacks(),
 		defaultProvider: config.DefaultProvider,
+		retry:           config.Retry.withDefaults(),
+		breakerPolicy:   config.Breaker.withDefaults(),
+		breakers:        make(map[Provider]*breaker),
 	}
 
 	// Initialize Anthropic client if configured
@@ -119,70 +176,186 @@ func NewMultiClient(config Config) (*MultiClient, error) {
 		mc.providers[ProviderOpenAI] = client
 	}
 
-	// Initialize Ollama client (always available for local)
+	// Named OpenAI-compatible endpoints (vLLM, LM Studio, OpenRouter)
+	var endpoints []Provider
+	if config.Endpoints != "" {
+		parsed, err := ParseEndpoints(config.Endpoints)
+		if err != nil {
+			log.Warn().Err(err).Msg("Ignoring OpenAI-compatible endpoints")
+		}
+		for name, e := range parsed {
+			client, err := NewOpenAICompatibleClient(e.APIKey, e.BaseURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create %s client: %w", name, err)
+			}
+			client.provider = name
+			if e.Model != "" {
+				client.model = e.Model
+			}
+			mc.providers[name] = client
+			endpoints = append(endpoints, name)
+		}
+	}
+
+	// Initialize Ollama client only if the server is up with the model
+	// pulled; otherwise it is left out of routing entirely
 	if config.OllamaHost != "" {
 		client, err := NewOllamaClient(config.OllamaHost, config.OllamaModel)
 		if err != nil {
-			// Don't fail if Ollama is not available
-			fmt.Printf("Warning: Ollama client initialization failed: %v\n", err)
+			log.Info().Err(err).Msg("Ollama provider disabled")
 		} else {
 			mc.providers[ProviderOllama] = client
 		}
 	}
 
-	// Set up fallback chains
-	mc.fallbacks[ProviderAnthropic] = []Provider{ProviderOpenAI, ProviderGoogle}
-	mc.fallbacks[ProviderGoogle] = []Provider{ProviderAnthropic, ProviderOpenAI}
-	mc.fallbacks[ProviderOpenAI] = []Provider{ProviderAnthropic, ProviderGoogle}
-	mc.fallbacks[ProviderOllama] = []Provider{ProviderAnthropic, ProviderGoogle}
+	// The fake provider never falls back, so tests can't reach the network
+	// by accident; when recording it forwards to a real provider
+	if config.DefaultProvider == ProviderFake {
+		var upstream Client
+		if config.FakeMode == FakeRecord {
+			upstream = mc.providers[config.FakeUpstream]
+			if config.FakeUpstream == "" {
+				for _, p := range []Provider{ProviderAnthropic, ProviderOpenAI, ProviderGoogle, ProviderOllama} {
+					if client, ok := mc.providers[p]; ok {
+						upstream = client
+						break
+					}
+				}
+			}
+		}
+		client, err := NewFakeClient(config.FakeMode, config.CassetteDir, upstream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fake client: %w", err)
+		}
+		mc.providers[ProviderFake] = client
+	}
+
+	// Fallback chains: the built-in ones, overridden per provider
+	if config.Fallbacks != "" {
+		chains, err := ParseFallbacks(config.Fallbacks, endpoints...)
+		if err != nil {
+			log.Warn().Err(err).Msg("Ignoring LLM fallback chains")
+		}
+		for p, chain := range chains {
+			mc.fallbacks[p] = chain
+		}
+	}
+
+	for p := range mc.providers {
+		if p != ProviderFake {
+			mc.breakers[p] = newBreaker(mc.breakerPolicy)
+		}
+	}
+
+	mc.embedProvider, mc.embedModel = mc.embeddingProviderFor(config)
 
 	return mc, nil
 }
 
 // Complete sends a completion request, using fallbacks if needed
 func (mc *MultiClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
-	provider := req.Provider
-	if provider == "" {
-		provider = mc.defaultProvider
+	start := time.Now()
+	req = mc.applyRoutes(ctx, req)
+	req, err := mc.privacyMode(ctx, req)
+	if err != nil {
+		mc.record(req, CallRecord{Err: err})
+		return nil, err
+	}
+	req, degraded, err := mc.admit(ctx, req)
+	if err != nil {
+		mc.record(req, CallRecord{Err: err})
+		return nil, err
 	}
 
-	// Try primary provider
-	if client, ok := mc.providers[provider]; ok {
-		resp, err := client.Complete(ctx, req)
-		if err == nil {
-			return resp, nil
-		}
-		// Log error and try fallbacks
-		fmt.Printf("Provider %s failed: %v, trying fallbacks\n", provider, err)
+	var resp *CompletionResponse
+	if mc.cache != nil {
+		resp, err = mc.cachedComplete(ctx, req)
+	} else {
+		resp, err = mc.complete(ctx, req)
 	}
 
-	// Try fallback providers
-	for _, fallback := range mc.fallbacks[provider] {
-		if client, ok := mc.providers[fallback]; ok {
-			req.Provider = fallback
-			resp, err := client.Complete(ctx, req)
-			if err == nil {
-				return resp, nil
-			}
-			fmt.Printf("Fallback provider %s failed: %v\n", fallback, err)
-		}
+	rec := CallRecord{Latency: time.Since(start), Degraded: degraded, Err: err}
+	if resp != nil {
+		rec.Provider, rec.Model, rec.Usage, rec.Cached = resp.Provider, resp.Model, resp.Usage, resp.Cached
+		rec.Schema, rec.Redactions = resp.schemaStatus, resp.redactions
+	}
+	mc.record(req, rec)
+	if err != nil {
+		return nil, err
 	}
+	return resp, nil
+}
 
-	return nil, fmt.Errorf("all LLM providers failed")
+func (mc *MultiClient) complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	var resp *CompletionResponse
+	served := req
+	err := mc.route(ctx, mc.plan(req), func(step Route, client Client) error {
+		sent := step.apply(req)
+		var err error
+		if resp, err = client.Complete(ctx, sent); err == nil {
+			resp.Provider = step.Provider
+			served = sent
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req.Schema != nil {
+		return mc.conform(ctx, served, resp)
+	}
+	return resp, nil
 }
 
-// Stream sends a streaming completion request
+// Stream sends a streaming completion request. Providers are retried and
+// replaced only until the first chunk arrives; after that the stream reports
+// its own error.
 func (mc *MultiClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
-	provider := req.Provider
-	if provider == "" {
-		provider = mc.defaultProvider
+	start := time.Now()
+	req = mc.applyRoutes(ctx, req)
+	req, err := mc.privacyMode(ctx, req)
+	if err != nil {
+		mc.record(req, CallRecord{Streamed: true, Err: err})
+		return nil, err
+	}
+	req, degraded, err := mc.admit(ctx, req)
+	if err != nil {
+		mc.record(req, CallRecord{Streamed: true, Err: err})
+		return nil, err
 	}
 
-	if client, ok := mc.providers[provider]; ok {
-		return client.Stream(ctx, req)
+	var ch <-chan StreamChunk
+	served := req
+	err = mc.route(ctx, mc.plan(req), func(step Route, client Client) error {
+		sent := step.apply(req)
+		var err error
+		ch, err = openStream(ctx, step.Provider, client, sent)
+		served = sent
+		return err
+	})
+	if err != nil {
+		mc.record(req, CallRecord{Streamed: true, Degraded: degraded, Latency: time.Since(start), Err: err})
+		return nil, err
+	}
+	if req.Schema != nil {
+		ch = mc.conformStream(ctx, served, served.Provider, ch)
 	}
+	return mc.observeStream(ctx, served, CallRecord{Provider: served.Provider, Streamed: true, Degraded: degraded}, start, ch), nil
+}
 
-	return nil, fmt.Errorf("provider %s not available", provider)
+// NewFakeMultiClient wraps a fake client so code that takes a MultiClient
+// can run against scripted responses
+func NewFakeMultiClient(fake *FakeClient) *MultiClient {
+	return &MultiClient{
+		providers:       map[Provider]Client{ProviderFake: fake},
+		fallbacks:       make(map[Provider][]Provider),
+		defaultProvider: ProviderFake,
+		retry:           RetryPolicy{}.withDefaults(),
+		breakerPolicy:   BreakerPolicy{}.withDefaults(),
+		breakers:        make(map[Provider]*breaker),
+		embedProvider:   ProviderFake,
+		embedModel:      defaultEmbeddingModels[ProviderFake],
+	}
 }
 
 // GetProvider returns the client for a specific provider
@@ -191,10 +364,11 @@ func (mc *MultiClient) GetProvider(provider Provider) (Client, bool) {
 	return client, ok
 }
 
-// IsProviderAvailable checks if a provider is configured and available
+// IsProviderAvailable checks if a provider is configured and its circuit
+// breaker is closed
 func (mc *MultiClient) IsProviderAvailable(provider Provider) bool {
 	_, ok := mc.providers[provider]
-	return ok
+	return ok && !mc.breakers[provider].open()
 }
 
 // Config holds LLM client configuration
@@ -207,6 +381,23 @@ type Config struct {
 	OpenAIProjectID string
 	OllamaHost      string
 	OllamaModel     string
+
+	// Embeddings; see embeddingProviderFor for the default
+	EmbeddingProvider Provider
+	EmbeddingModel    string
+
+	// Fake provider (DefaultProvider "fake")
+	FakeMode     FakeMode // replay (default) or record
+	CassetteDir  string
+	FakeUpstream Provider // Provider to record from; the first configured one if empty
+
+	// Named OpenAI-compatible endpoints, see ParseEndpoints
+	Endpoints string
+
+	// Routing; zero values use the defaults
+	Fallbacks string // Chains replacing the built-in ones, see ParseFallbacks
+	Retry     RetryPolicy
+	Breaker   BreakerPolicy
 }
 
 // NewConfigFromEnv creates config from package config
@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// EmbeddingRequest asks for one vector per input text
+type EmbeddingRequest struct {
+	Provider Provider // The client's embedding provider if empty
+	Model    string   // The provider's embedding model if empty
+	Input    []string
+	Feature  string    // Names the caller for metrics
+	UserID   uuid.UUID // Whose usage this is; Nil for system calls
+}
+
+// EmbeddingResponse holds the vectors in the order of the inputs
+type EmbeddingResponse struct {
+	Vectors  [][]float32
+	Model    string
+	Provider Provider
+	Usage    Usage
+}
+
+// Embedder is implemented by the clients of providers with an embeddings API
+type Embedder interface {
+	Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+// defaultEmbeddingModels are the models used when none is configured. Only
+// providers listed here can embed.
+var defaultEmbeddingModels = map[Provider]string{
+	ProviderOpenAI: "text-embedding-3-small",
+	ProviderGoogle: "text-embedding-004",
+	ProviderOllama: "nomic-embed-text",
+	ProviderFake:   "fake-embed",
+}
+
+// embeddingProviderFor picks the provider that serves every embedding: the
+// configured one, else the default provider if it embeds, else the first
+// configured of OpenAI, Google and Ollama
+func (mc *MultiClient) embeddingProviderFor(config Config) (Provider, string) {
+	candidates := []Provider{config.DefaultProvider, ProviderOpenAI, ProviderGoogle, ProviderOllama}
+	if config.EmbeddingProvider != "" {
+		candidates = []Provider{config.EmbeddingProvider}
+	}
+	for _, p := range candidates {
+		if _, ok := mc.providers[p].(Embedder); !ok {
+			continue
+		}
+		model := config.EmbeddingModel
+		if model == "" || p != config.EmbeddingProvider {
+			model = defaultEmbeddingModels[p]
+		}
+		return p, model
+	}
+	if config.EmbeddingProvider != "" {
+		log.Warn().Str("provider", string(config.EmbeddingProvider)).Msg("Embedding provider is not configured, embeddings disabled")
+	}
+	return "", ""
+}
+
+// EmbeddingModel names the provider and model that embeddings come from, as
+// "provider/model", or "" if there is none. Vectors are only comparable
+// with others from the same model.
+func (mc *MultiClient) EmbeddingModel() string {
+	if mc == nil || mc.embedProvider == "" {
+		return ""
+	}
+	return string(mc.embedProvider) + "/" + mc.embedModel
+}
+
+// Embed returns a vector per input. Unlike completions there is no fallback
+// to another provider, since its vectors couldn't be compared with the
+// stored ones; the call is retried and counted against the spend caps.
+func (mc *MultiClient) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	start := time.Now()
+	if req.Provider == "" {
+		req.Provider, req.Model = mc.embedProvider, mc.embedModel
+	}
+	if req.Model == "" {
+		req.Model = defaultEmbeddingModels[req.Provider]
+	}
+	rec := CompletionRequest{Provider: req.Provider, Model: req.Model, Feature: req.Feature, UserID: req.UserID}
+
+	client, ok := mc.providers[req.Provider].(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("no embedding provider available: %w", ErrUnavailable)
+	}
+	if len(req.Input) == 0 {
+		return &EmbeddingResponse{Model: req.Model, Provider: req.Provider}, nil
+	}
+
+	// Privacy mode can't move embeddings to the local model either
+	if mc.redaction.private(ctx, req.UserID, req.Feature) {
+		if req.Provider != ProviderOllama {
+			mc.redaction.count(req.Feature, func(s *RedactionStats) { s.Refused++ })
+			err := fmt.Errorf("embeddings come from %s: %w", req.Provider, ErrPrivacyMode)
+			mc.record(rec, CallRecord{Err: err})
+			return nil, err
+		}
+		mc.redaction.count(req.Feature, func(s *RedactionStats) { s.LocalOnly++ })
+		rec.private = true
+	}
+	if mc.redaction != nil && req.Provider != ProviderOllama {
+		req.Input = mc.redaction.redactInput(ctx, req.Feature, req.Input)
+	}
+
+	// Past a cap, completions move to the local model; embeddings can only
+	// do that if they come from it already
+	if _, degraded, err := mc.admit(ctx, rec); err != nil || (degraded && req.Provider != ProviderOllama) {
+		if err == nil {
+			err = fmt.Errorf("daily spend cap reached: %w", ErrSpendCap)
+		}
+		mc.record(rec, CallRecord{Err: err})
+		return nil, err
+	}
+	if !mc.breakers[req.Provider].allow() {
+		err := fmt.Errorf("%s embeddings skipped while its circuit is open: %w", req.Provider, ErrUnavailable)
+		mc.record(rec, CallRecord{Err: err})
+		return nil, err
+	}
+
+	var resp *EmbeddingResponse
+	err := mc.call(ctx, req.Provider, func() error {
+		var err error
+		resp, err = client.Embed(ctx, req)
+		return err
+	})
+	if err == nil && len(resp.Vectors) != len(req.Input) {
+		err = &ProviderError{Provider: req.Provider, Kind: ErrUnavailable,
+			Message: fmt.Sprintf("got %d embeddings for %d inputs", len(resp.Vectors), len(req.Input))}
+	}
+
+	out := CallRecord{Latency: time.Since(start), Err: err}
+	if err == nil {
+		resp.Provider = req.Provider
+		out.Model, out.Usage = resp.Model, resp.Usage
+	}
+	mc.record(rec, out)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Normalize scales a vector to unit length in place, so cosine similarity
+// is a dot product
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// Cosine returns the cosine similarity of two vectors, 0 if their lengths
+// differ
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
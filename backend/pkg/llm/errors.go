@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error kinds. Provider failures wrap one of these, so callers can tell them
+// apart with errors.Is whichever provider answered.
+var (
+	ErrRateLimited    = errors.New("rate limited")
+	ErrQuota          = errors.New("quota or credit exhausted")
+	ErrAuth           = errors.New("authentication failed")
+	ErrSafety         = errors.New("blocked by safety filters")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrUnavailable    = errors.New("provider unavailable")
+
+	// ErrSpendCap is returned, before any provider is called, when a daily
+	// spend cap is reached and no local model can take the call
+	ErrSpendCap = errors.New("daily AI spend cap reached")
+
+	// ErrInvalidOutput is returned when an answer doesn't match the
+	// request's schema even after a repair round-trip
+	ErrInvalidOutput = errors.New("answer did not match the response schema")
+
+	// ErrPrivacyMode is returned, before any provider is called, when the
+	// user's privacy mode keeps calls on the local model and none is set up
+	ErrPrivacyMode = errors.New("privacy mode needs the local AI model")
+)
+
+// ProviderError is a failed call to one provider
+type ProviderError struct {
+	Provider   Provider
+	Kind       error // One of the Err* kinds
+	StatusCode int   // 0 when the request never got an HTTP response
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: %v (status %d): %s", e.Provider, e.Kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Provider, e.Kind, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Kind
+}
+
+// Retryable reports whether the same call may succeed if repeated
+func Retryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+}
+
+// canFallBack reports whether another provider could answer where this one
+// failed. Safety blocks and bad requests would fail the same way elsewhere.
+func canFallBack(err error) bool {
+	return !errors.Is(err, ErrSafety) && !errors.Is(err, ErrInvalidRequest) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// apiError classifies a non-200 response
+func apiError(provider Provider, resp *http.Response, body []byte) error {
+	msg := errorMessage(body)
+	lower := strings.ToLower(msg)
+	kind := ErrInvalidRequest
+
+	switch status := resp.StatusCode; {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		kind = ErrAuth
+	case status == http.StatusPaymentRequired:
+		kind = ErrQuota
+	case status == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+		if containsAny(lower, "insufficient_quota", "billing", "credit") {
+			kind = ErrQuota
+		}
+	case status == http.StatusRequestTimeout || status >= 500: // Includes Anthropic's 529 overloaded
+		kind = ErrUnavailable
+	case containsAny(lower, "api key not valid", "api_key_invalid", "invalid x-api-key"):
+		kind = ErrAuth // Google answers a bad key with 400
+	case containsAny(lower, "credit balance", "billing"):
+		kind = ErrQuota // Anthropic answers an empty balance with 400
+	case containsAny(lower, "content_policy", "content_filter", "safety"):
+		kind = ErrSafety
+	}
+
+	return &ProviderError{
+		Provider:   provider,
+		Kind:       kind,
+		StatusCode: resp.StatusCode,
+		Message:    msg,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// requestError classifies a request that got no response. Cancellation by
+// the caller is returned as is.
+func requestError(provider Provider, ctx context.Context, err error) error {
+	if ctx.Err() == context.Canceled {
+		return ctx.Err()
+	}
+	return &ProviderError{Provider: provider, Kind: ErrUnavailable, Message: err.Error()}
+}
+
+// streamError classifies an error event received mid-stream
+func streamError(provider Provider, msg string) error {
+	lower := strings.ToLower(msg)
+	kind := ErrUnavailable
+	switch {
+	case containsAny(lower, "rate limit", "rate_limit"):
+		kind = ErrRateLimited
+	case containsAny(lower, "content_policy", "content_filter", "safety"):
+		kind = ErrSafety
+	}
+	return &ProviderError{Provider: provider, Kind: kind, Message: msg}
+}
+
+// safetyError reports a response the provider withheld
+func safetyError(provider Provider, reason string) error {
+	return &ProviderError{Provider: provider, Kind: ErrSafety, Message: reason}
+}
+
+// errorMessage pulls the message out of the error bodies the providers send,
+// falling back to the raw body
+func errorMessage(body []byte) string {
+	var parsed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && len(parsed.Error) > 0 {
+		var nested struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    any    `json:"code"`
+			Status  string `json:"status"`
+		}
+		if json.Unmarshal(parsed.Error, &nested) == nil && nested.Message != "" {
+			// Keep the type or code: it often says more than the message
+			for _, tag := range []string{nested.Type, nested.Status, fmt.Sprint(nested.Code)} {
+				if tag != "" && tag != "<nil>" && !strings.Contains(nested.Message, tag) {
+					return tag + ": " + nested.Message
+				}
+			}
+			return nested.Message
+		}
+		var flat string
+		if json.Unmarshal(parsed.Error, &flat) == nil && flat != "" {
+			return flat // Ollama
+		}
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 500 {
+		msg = msg[:500] + "..."
+	}
+	return msg
+}
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
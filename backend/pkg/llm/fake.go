@@ -0,0 +1,400 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FakeMode selects where a FakeClient gets responses that aren't scripted
+type FakeMode string
+
+const (
+	// FakeReplay answers from cassettes only and fails on a missing one, so
+	// nothing reaches the network
+	FakeReplay FakeMode = "replay"
+	// FakeRecord answers from cassettes when present and otherwise calls the
+	// upstream provider and saves the exchange
+	FakeRecord FakeMode = "record"
+)
+
+// FakeClient is a deterministic Client for tests and offline runs. Requests
+// are answered, in order of preference, by queued responses, by rules
+// matching the last user message, and by cassettes: recorded exchanges
+// stored as JSON files under a directory, keyed by a hash of the normalized
+// request.
+type FakeClient struct {
+	mode     FakeMode
+	dir      string
+	upstream Client // Only used to record
+
+	mu       sync.Mutex
+	queue    []fakeAnswer
+	rules    []fakeRule
+	requests []CompletionRequest
+}
+
+// fakeAnswer is a queued response or, when err is set, a queued failure
+type fakeAnswer struct {
+	resp CompletionResponse
+	err  error
+}
+
+type fakeRule struct {
+	contains string
+	resp     CompletionResponse
+}
+
+// cassette is one recorded exchange as stored on disk
+type cassette struct {
+	Key      string             `json:"key"`
+	Request  fakeKey            `json:"request"` // Normalized, for reading diffs
+	Response CompletionResponse `json:"response"`
+}
+
+// NewFakeClient creates a fake client. dir may be empty when only scripted
+// responses are used; upstream is required to record.
+func NewFakeClient(mode FakeMode, dir string, upstream Client) (*FakeClient, error) {
+	switch mode {
+	case "":
+		mode = FakeReplay
+	case FakeReplay, FakeRecord:
+	default:
+		return nil, fmt.Errorf("unknown fake LLM mode %q", mode)
+	}
+	if mode == FakeRecord {
+		if upstream == nil {
+			return nil, fmt.Errorf("recording cassettes needs an upstream provider")
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("recording cassettes needs a cassette directory")
+		}
+	}
+
+	return &FakeClient{
+		mode:     mode,
+		dir:      dir,
+		upstream: upstream,
+	}, nil
+}
+
+// Script queues responses returned to the next requests, in order
+func (f *FakeClient) Script(responses ...CompletionResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, resp := range responses {
+		f.queue = append(f.queue, fakeAnswer{resp: resp})
+	}
+}
+
+// Fail queues an error returned to the next request, in turn with the
+// responses queued by Script, such as a ProviderError for a 429
+func (f *FakeClient) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queue = append(f.queue, fakeAnswer{err: err})
+}
+
+// On answers every request whose last user message contains substr with resp.
+// Rules are tried in the order they were added.
+func (f *FakeClient) On(substr string, resp CompletionResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{contains: substr, resp: resp})
+}
+
+// Requests returns the requests received so far
+func (f *FakeClient) Requests() []CompletionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CompletionRequest(nil), f.requests...)
+}
+
+// Complete implements the Client interface
+func (f *FakeClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	if resp, ok, err := f.scripted(req); ok {
+		return resp, err
+	}
+
+	key, norm := cassetteKey(req)
+	if resp, err := f.load(key); err != nil || resp != nil {
+		return resp, err
+	}
+	if f.mode != FakeRecord {
+		return nil, fmt.Errorf("no cassette %s for request (record it with LLM_FAKE_MODE=record)", key)
+	}
+
+	resp, err := f.upstream.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.save(key, norm, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Stream implements the Client interface. Replayed content is sent a word at
+// a time; recording collects the upstream stream before saving it.
+func (f *FakeClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	resp, ok, err := f.scripted(req)
+	if err != nil {
+		return nil, err
+	}
+	key, norm := cassetteKey(req)
+	if !ok {
+		if resp, err = f.load(key); err != nil {
+			return nil, err
+		}
+	}
+	if resp != nil {
+		return replayStream(ctx, resp), nil
+	}
+	if f.mode != FakeRecord {
+		return nil, fmt.Errorf("no cassette %s for request (record it with LLM_FAKE_MODE=record)", key)
+	}
+
+	upstream, err := f.upstream.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		out := streamWriter{ctx: ctx, ch: ch}
+		var recorded CompletionResponse
+		var content strings.Builder
+		for chunk := range upstream {
+			content.WriteString(chunk.Content)
+			if chunk.ToolCall != nil {
+				recorded.ToolCalls = append(recorded.ToolCalls, *chunk.ToolCall)
+			}
+			if chunk.Done && chunk.Err == nil {
+				recorded.Content = content.String()
+				recorded.Model = chunk.Model
+				if chunk.Usage != nil {
+					recorded.Usage = *chunk.Usage
+				}
+				if err := f.save(key, norm, &recorded); err != nil {
+					chunk.Err = err
+				}
+			}
+			if !out.send(chunk) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// fakeEmbeddingDims is the length of fake embeddings
+const fakeEmbeddingDims = 256
+
+// Embed implements the Embedder interface with a hashed bag of words and
+// character trigrams: deterministic, offline, and close enough to real
+// embeddings that texts sharing words come out similar
+func (f *FakeClient) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	resp := &EmbeddingResponse{Model: defaultEmbeddingModels[ProviderFake]}
+	for _, text := range req.Input {
+		vec := make([]float32, fakeEmbeddingDims)
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			vec[fakeBucket(word)] += 2
+			padded := " " + word + " "
+			for i := 0; i+3 <= len(padded); i++ {
+				vec[fakeBucket(padded[i:i+3])]++
+			}
+		}
+		resp.Vectors = append(resp.Vectors, Normalize(vec))
+		resp.Usage.PromptTokens += len(strings.Fields(text))
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	return resp, nil
+}
+
+func fakeBucket(s string) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32() % fakeEmbeddingDims)
+}
+
+// scripted returns the queued or rule-matched answer for a request
+func (f *FakeClient) scripted(req CompletionRequest) (*CompletionResponse, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+
+	if len(f.queue) > 0 {
+		answer := f.queue[0]
+		f.queue = f.queue[1:]
+		if answer.err != nil {
+			return nil, true, answer.err
+		}
+		return &answer.resp, true, nil
+	}
+
+	var last string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			last = req.Messages[i].Content
+			break
+		}
+	}
+	for _, rule := range f.rules {
+		if strings.Contains(last, rule.contains) {
+			resp := rule.resp
+			return &resp, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (f *FakeClient) path(key string) string {
+	return filepath.Join(f.dir, key+".json")
+}
+
+// load reads a cassette, returning nil if there is none
+func (f *FakeClient) load(key string) (*CompletionResponse, error) {
+	if f.dir == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", key, err)
+	}
+	return &c.Response, nil
+}
+
+// save writes a cassette, replacing the file atomically
+func (f *FakeClient) save(key string, norm fakeKey, resp *CompletionResponse) error {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false) // Keep masks like <uuid> readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cassette{Key: key, Request: norm, Response: *resp}); err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(f.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// replayStream sends a response as a stream
+func replayStream(ctx context.Context, resp *CompletionResponse) <-chan StreamChunk {
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		out := streamWriter{ctx: ctx, ch: ch}
+		for _, word := range strings.SplitAfter(resp.Content, " ") {
+			if !out.text(word) {
+				return
+			}
+		}
+		for i := range resp.ToolCalls {
+			if !out.send(StreamChunk{ToolCall: &resp.ToolCalls[i]}) {
+				return
+			}
+		}
+		out.done(resp.Model, resp.Usage, nil)
+	}()
+	return ch
+}
+
+// fakeKey is the part of a request that selects its cassette
+type fakeKey struct {
+	Model       string    `json:"model,omitempty"`
+	SystemMsg   string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	Tools       []string  `json:"tools,omitempty"`
+}
+
+// volatileValues match values that change between otherwise identical runs:
+// UUIDs and dates or times
+var volatileValues = []struct {
+	re   *regexp.Regexp
+	mask string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?)?`), "<time>"},
+}
+
+// normalizeText masks volatile values and collapses whitespace
+func normalizeText(s string) string {
+	for _, v := range volatileValues {
+		s = v.re.ReplaceAllString(s, v.mask)
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// cassetteKey hashes the normalized request. The provider is left out so a
+// recording matches whichever provider served it; tool call IDs, which some
+// providers generate randomly, are renumbered in order of appearance.
+func cassetteKey(req CompletionRequest) (string, fakeKey) {
+	norm := fakeKey{
+		Model:       req.Model,
+		SystemMsg:   normalizeText(req.SystemMsg),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+	for _, t := range req.Tools {
+		norm.Tools = append(norm.Tools, t.Name)
+	}
+
+	ids := map[string]string{}
+	callID := func(id string) string {
+		if id == "" {
+			return ""
+		}
+		if _, ok := ids[id]; !ok {
+			ids[id] = fmt.Sprintf("call_%d", len(ids)+1)
+		}
+		return ids[id]
+	}
+	for _, m := range req.Messages {
+		msg := Message{Role: m.Role, Content: normalizeText(m.Content), Name: m.Name, ToolCallID: callID(m.ToolCallID)}
+		for _, call := range m.ToolCalls {
+			args := json.RawMessage(normalizeText(string(toolArgs(call.Parameters))))
+			if !json.Valid(args) {
+				args, _ = json.Marshal(string(args))
+			}
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: callID(call.ID), Name: call.Name, Parameters: args})
+		}
+		norm.Messages = append(norm.Messages, msg)
+	}
+
+	data, _ := json.Marshal(norm)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), norm
+}
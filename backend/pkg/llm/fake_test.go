@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFakeRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	upstream, err := NewFakeClient(FakeReplay, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream.Script(CompletionResponse{Content: "Buy milk", Model: "upstream-model", Usage: Usage{TotalTokens: 7}})
+
+	recorder, err := NewFakeClient(FakeRecord, dir, upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := CompletionRequest{
+		Provider:  ProviderAnthropic,
+		SystemMsg: "Today is 2026-03-10T09:30:00Z.",
+		Messages: []Message{
+			{Role: "user", Content: "Clean up task 7b0c2a6e-3f1d-4c1e-9a51-2f6f1d3c9e01:   buy  milk"},
+		},
+		MaxTokens: 100,
+	}
+	resp, err := recorder.Complete(ctx, recorded)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if resp.Content != "Buy milk" {
+		t.Fatalf("recorded content = %q", resp.Content)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("cassettes = %v, want one", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("cassette is not JSON: %v", err)
+	}
+	if got := c.Request.Messages[0].Content; got != "Clean up task <uuid>: buy milk" {
+		t.Errorf("normalized message = %q", got)
+	}
+	if c.Request.SystemMsg != "Today is <time>." {
+		t.Errorf("normalized system message = %q", c.Request.SystemMsg)
+	}
+
+	replayer, err := NewFakeClient(FakeReplay, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another provider, another UUID, another date and other spacing still
+	// select the recording
+	replayed := recorded
+	replayed.Provider = ProviderOpenAI
+	replayed.SystemMsg = "Today is 2026-11-02T18:05:00+07:00."
+	replayed.Messages = []Message{
+		{Role: "user", Content: "Clean up task 0d9e8f7a-1b2c-4d3e-8f4a-5b6c7d8e9f00: buy milk "},
+	}
+	resp, err = replayer.Complete(ctx, replayed)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if resp.Content != "Buy milk" || resp.Model != "upstream-model" || resp.Usage.TotalTokens != 7 {
+		t.Errorf("replayed response = %+v", resp)
+	}
+
+	stream, err := replayer.Stream(ctx, replayed)
+	if err != nil {
+		t.Fatalf("replay stream: %v", err)
+	}
+	var text strings.Builder
+	var done bool
+	for chunk := range stream {
+		text.WriteString(chunk.Content)
+		done = done || chunk.Done
+	}
+	if text.String() != "Buy milk" || !done {
+		t.Errorf("replayed stream = %q, done %v", text.String(), done)
+	}
+
+	// Anything that changes the prompt misses
+	changed := recorded
+	changed.Messages = []Message{{Role: "user", Content: "Clean up task: buy bread"}}
+	if _, err := replayer.Complete(ctx, changed); err == nil || !strings.Contains(err.Error(), "no cassette") {
+		t.Errorf("changed request err = %v, want a missing cassette", err)
+	}
+	if len(upstream.Requests()) != 1 {
+		t.Errorf("upstream called %d times, want 1", len(upstream.Requests()))
+	}
+}
+
+func TestCassetteKey(t *testing.T) {
+	base := CompletionRequest{
+		Model:     "m",
+		SystemMsg: "You help.",
+		Messages: []Message{
+			{Role: "user", Content: "Add a task"},
+			{Role: "assistant", ToolCalls: []ToolCall{{ID: "toolu_abc", Name: "create_task", Parameters: json.RawMessage(`{"due":"2026-03-10"}`)}}},
+			{Role: "tool", ToolCallID: "toolu_abc", Content: `{"id":"7b0c2a6e-3f1d-4c1e-9a51-2f6f1d3c9e01"}`},
+		},
+		Tools: []Tool{{Name: "create_task"}},
+	}
+	key, _ := cassetteKey(base)
+
+	tests := []struct {
+		name   string
+		change func(r *CompletionRequest)
+		same   bool
+	}{
+		{"provider", func(r *CompletionRequest) { r.Provider = ProviderGoogle }, true},
+		{"feature", func(r *CompletionRequest) { r.Feature = "other" }, true},
+		{"tool call IDs", func(r *CompletionRequest) {
+			r.Messages = cloneMessages(r.Messages)
+			r.Messages[1].ToolCalls = []ToolCall{{ID: "call_xyz", Name: "create_task", Parameters: json.RawMessage(`{"due":"2026-04-01"}`)}}
+			r.Messages[2].ToolCallID = "call_xyz"
+		}, true},
+		{"model", func(r *CompletionRequest) { r.Model = "other" }, false},
+		{"temperature", func(r *CompletionRequest) { r.Temperature = 0.5 }, false},
+		{"max tokens", func(r *CompletionRequest) { r.MaxTokens = 10 }, false},
+		{"system message", func(r *CompletionRequest) { r.SystemMsg = "You help a lot." }, false},
+		{"tools", func(r *CompletionRequest) { r.Tools = nil }, false},
+		{"message text", func(r *CompletionRequest) {
+			r.Messages = cloneMessages(r.Messages)
+			r.Messages[0].Content = "Add two tasks"
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base
+			tt.change(&req)
+			got, _ := cassetteKey(req)
+			if (got == key) != tt.same {
+				t.Errorf("key changed = %v, want %v", got != key, !tt.same)
+			}
+		})
+	}
+}
+
+func cloneMessages(messages []Message) []Message {
+	return append([]Message(nil), messages...)
+}
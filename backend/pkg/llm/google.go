@@ -11,6 +11,8 @@ import (
 
 const (
 	googleAPIURL       = "https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s"
+	googleStreamURL    = "https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s"
+	googleEmbedURL     = "https://generativelanguage.googleapis.com/v1beta/models/%s:batchEmbedContents?key=%s"
 	defaultGoogleModel = "gemini-2.0-flash"
 )
 
@@ -45,14 +47,27 @@ type googleContent struct {
 }
 
 type googlePart struct {
-	Text string `json:"text,omitempty"`
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *googleFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *googleFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type googleFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type googleFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"` // Must be an object
 }
 
 type googleGenerationConfig struct {
-	Temperature     float64 `json:"temperature,omitempty"`
-	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
-	TopP            float64 `json:"topP,omitempty"`
-	TopK            int     `json:"topK,omitempty"`
+	Temperature      float64 `json:"temperature,omitempty"`
+	MaxOutputTokens  int     `json:"maxOutputTokens,omitempty"`
+	TopP             float64 `json:"topP,omitempty"`
+	TopK             int     `json:"topK,omitempty"`
+	ResponseMimeType string  `json:"responseMimeType,omitempty"`
 }
 
 type googleToolConfig struct {
@@ -67,8 +82,11 @@ type googleFunctionDecl struct {
 
 // googleResponse is the response format from Google AI API
 type googleResponse struct {
-	Candidates    []googleCandidate   `json:"candidates"`
-	UsageMetadata googleUsageMetadata `json:"usageMetadata"`
+	Candidates     []googleCandidate   `json:"candidates"`
+	UsageMetadata  googleUsageMetadata `json:"usageMetadata"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
 }
 
 type googleCandidate struct {
@@ -84,10 +102,86 @@ type googleUsageMetadata struct {
 
 // Complete implements the Client interface
 func (c *GoogleClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
-	model := req.Model
-	if model == "" {
-		model = defaultGoogleModel
+	httpReq, err := c.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(ProviderGoogle, ctx, err)
 	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(ProviderGoogle, resp, respBody)
+	}
+
+	var googleResp googleResponse
+	if err := json.Unmarshal(respBody, &googleResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	// Convert response
+	result := &CompletionResponse{
+		Model: googleModel(req),
+		Usage: Usage{
+			PromptTokens:     googleResp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: googleResp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      googleResp.UsageMetadata.TotalTokenCount,
+		},
+	}
+
+	if len(googleResp.Candidates) > 0 {
+		// Gemini has no call IDs; results are matched by name and order
+		for _, part := range googleResp.Candidates[0].Content.Parts {
+			result.Content += part.Text
+			if part.FunctionCall != nil {
+				result.ToolCalls = append(result.ToolCalls, ToolCall{
+					ID:         newToolCallID(),
+					Name:       part.FunctionCall.Name,
+					Parameters: toolArgs(part.FunctionCall.Args),
+				})
+			}
+		}
+	}
+
+	if reason := googleBlockReason(googleResp); reason != "" && result.Content == "" && len(result.ToolCalls) == 0 {
+		return nil, safetyError(ProviderGoogle, reason)
+	}
+
+	return result, nil
+}
+
+// googleBlockReason is why Gemini withheld a response, if it did
+func googleBlockReason(resp googleResponse) string {
+	if resp.PromptFeedback.BlockReason != "" {
+		return "prompt blocked: " + resp.PromptFeedback.BlockReason
+	}
+	if len(resp.Candidates) > 0 {
+		switch reason := resp.Candidates[0].FinishReason; reason {
+		case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+			return "response blocked: " + reason
+		}
+	}
+	return ""
+}
+
+func googleModel(req CompletionRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return defaultGoogleModel
+}
+
+// newRequest builds the HTTP request for a completion, streamed or not
+func (c *GoogleClient) newRequest(ctx context.Context, req CompletionRequest, stream bool) (*http.Request, error) {
+	model := googleModel(req)
 
 	maxTokens := req.MaxTokens
 	if maxTokens == 0 {
@@ -106,14 +200,43 @@ func (c *GoogleClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 			continue
 		}
 
+		if m.Role == "tool" {
+			part := googlePart{FunctionResponse: &googleFunctionResponse{
+				Name:     m.Name,
+				Response: toolResultObject(m.Content),
+			}}
+			// All results for one turn's calls go back in one content
+			if n := len(contents); n > 0 && len(contents[n-1].Parts) > 0 && contents[n-1].Parts[0].FunctionResponse != nil {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+				continue
+			}
+			contents = append(contents, googleContent{Role: "user", Parts: []googlePart{part}})
+			continue
+		}
+
 		role := m.Role
 		if role == "assistant" {
 			role = "model"
 		}
 
+		var parts []googlePart
+		if m.Content != "" || len(m.ToolCalls) == 0 {
+			parts = append(parts, googlePart{Text: m.Content})
+		}
+		for _, call := range m.ToolCalls {
+			parts = append(parts, googlePart{FunctionCall: &googleFunctionCall{
+				Name: call.Name,
+				Args: toolArgs(call.Parameters),
+			}})
+		}
+		// A user message right after tool results joins them
+		if n := len(contents); n > 0 && role == "user" && contents[n-1].Role == "user" {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
 		contents = append(contents, googleContent{
 			Role:  role,
-			Parts: []googlePart{{Text: m.Content}},
+			Parts: parts,
 		})
 	}
 
@@ -123,6 +246,19 @@ func (c *GoogleClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 			Parts: []googlePart{{Text: req.SystemMsg}},
 		}
 	}
+	// JSON mode guarantees valid JSON; Gemini's responseSchema only takes an
+	// OpenAPI subset, so the schema itself goes in the system prompt
+	if req.Schema != nil {
+		system := ""
+		if systemContent != nil {
+			for _, p := range systemContent.Parts {
+				system += p.Text
+			}
+		}
+		systemContent = &googleContent{
+			Parts: []googlePart{{Text: schemaInstruction(system, req.Schema)}},
+		}
+	}
 
 	// Convert tools
 	var tools []googleToolConfig
@@ -149,6 +285,9 @@ func (c *GoogleClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 		},
 		Tools: tools,
 	}
+	if req.Schema != nil {
+		googleReq.GenerationConfig.ResponseMimeType = "application/json"
+	}
 
 	body, err := json.Marshal(googleReq)
 	if err != nil {
@@ -156,6 +295,9 @@ func (c *GoogleClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	}
 
 	url := fmt.Sprintf(googleAPIURL, model, c.apiKey)
+	if stream {
+		url = fmt.Sprintf(googleStreamURL, model, c.apiKey)
+	}
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -163,61 +305,117 @@ func (c *GoogleClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	return httpReq, nil
+}
+
+// Stream implements streaming for Google AI (streamGenerateContent as SSE)
+func (c *GoogleClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	httpReq, err := c.newRequest(ctx, req, true)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	body, err := startStream(ProviderGoogle, c.httpClient, httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		defer body.Close()
+		out := streamWriter{ctx: ctx, ch: ch}
+
+		var usage Usage
+		err := readSSE(body, func(_, data string) bool {
+			var chunk googleResponse
+			if json.Unmarshal([]byte(data), &chunk) != nil {
+				return true
+			}
 
-	var googleResp googleResponse
-	if err := json.Unmarshal(respBody, &googleResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
+			// Usage is cumulative; the last chunk has the totals
+			if chunk.UsageMetadata.TotalTokenCount > 0 {
+				usage.PromptTokens = chunk.UsageMetadata.PromptTokenCount
+				usage.CompletionTokens = chunk.UsageMetadata.CandidatesTokenCount
+			}
+			if len(chunk.Candidates) > 0 {
+				for _, part := range chunk.Candidates[0].Content.Parts {
+					if !out.text(part.Text) {
+						return false
+					}
+				}
+			}
+			return true
+		})
+		out.done(googleModel(req), usage, err)
+	}()
 
-	// Convert response
-	result := &CompletionResponse{
-		Model: model,
-		Usage: Usage{
-			PromptTokens:     googleResp.UsageMetadata.PromptTokenCount,
-			CompletionTokens: googleResp.UsageMetadata.CandidatesTokenCount,
-			TotalTokens:      googleResp.UsageMetadata.TotalTokenCount,
-		},
-	}
+	return ch, nil
+}
 
-	if len(googleResp.Candidates) > 0 && len(googleResp.Candidates[0].Content.Parts) > 0 {
-		result.Content = googleResp.Candidates[0].Content.Parts[0].Text
-	}
+type googleEmbedRequest struct {
+	Requests []googleEmbedContentRequest `json:"requests"`
+}
 
-	return result, nil
+type googleEmbedContentRequest struct {
+	Model   string        `json:"model"` // "models/<name>", repeated per text
+	Content googleContent `json:"content"`
 }
 
-// Stream implements streaming for Google AI
-func (c *GoogleClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
-	ch := make(chan StreamChunk)
+type googleEmbedResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+}
 
-	go func() {
-		defer close(ch)
+// Embed implements the Embedder interface. The API reports no token
+// counts, so usage is left at zero.
+func (c *GoogleClient) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = defaultEmbeddingModels[ProviderGoogle]
+	}
 
-		resp, err := c.Complete(ctx, req)
-		if err != nil {
-			ch <- StreamChunk{Done: true}
-			return
+	embedReq := googleEmbedRequest{Requests: make([]googleEmbedContentRequest, len(req.Input))}
+	for i, text := range req.Input {
+		embedReq.Requests[i] = googleEmbedContentRequest{
+			Model:   "models/" + model,
+			Content: googleContent{Parts: []googlePart{{Text: text}}},
 		}
+	}
+	body, err := json.Marshal(embedReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
 
-		ch <- StreamChunk{
-			Content: resp.Content,
-			Done:    true,
-		}
-	}()
+	url := fmt.Sprintf(googleEmbedURL, model, c.apiKey)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
 
-	return ch, nil
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(ProviderGoogle, ctx, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(ProviderGoogle, resp, respBody)
+	}
+
+	var embedResp googleEmbedResponse
+	if err := json.Unmarshal(respBody, &embedResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	vectors := make([][]float32, len(embedResp.Embeddings))
+	for i, e := range embedResp.Embeddings {
+		vectors[i] = e.Values
+	}
+	return &EmbeddingResponse{Vectors: vectors, Model: model}, nil
 }
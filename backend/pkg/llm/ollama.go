@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // OllamaClient is a client for the Ollama local LLM API
@@ -31,16 +33,27 @@ func NewOllamaClient(host, model string) (*OllamaClient, error) {
 		httpClient: &http.Client{},
 	}
 
-	// Test connection
-	if err := client.ping(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Ollama: %w", err)
+	// A local server may be down or lack the model; neither should be
+	// discovered on the first real request
+	ctx, cancel := context.WithTimeout(context.Background(), ollamaPingTimeout)
+	defer cancel()
+	if err := client.ping(ctx); err != nil {
+		return nil, fmt.Errorf("Ollama at %s is not usable: %w", host, err)
 	}
 
 	return client, nil
 }
 
-func (c *OllamaClient) ping() error {
-	resp, err := c.httpClient.Get(c.host + "/api/tags")
+// ollamaPingTimeout bounds the startup check of a local server
+const ollamaPingTimeout = 2 * time.Second
+
+// ping checks that the server answers and has the model pulled
+func (c *OllamaClient) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.host+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -49,7 +62,21 @@ func (c *OllamaClient) ping() error {
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("Ollama returned status %d", resp.StatusCode)
 	}
-	return nil
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return fmt.Errorf("failed to read model list: %w", err)
+	}
+	for _, m := range tags.Models {
+		if m.Name == c.model || strings.TrimSuffix(m.Name, ":latest") == c.model {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %s is not pulled", c.model)
 }
 
 // ollamaRequest is the request format for Ollama API
@@ -58,11 +85,22 @@ type ollamaRequest struct {
 	Messages []ollamaMessage `json:"messages"`
 	Stream   bool            `json:"stream"`
 	Options  ollamaOptions   `json:"options,omitempty"`
+	Tools    []openAITool    `json:"tools,omitempty"` // Same shape as OpenAI's
+	Format   *Schema         `json:"format,omitempty"` // Constrains the answer to a JSON schema
 }
 
 type ollamaMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // tool results
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // An object, unlike OpenAI
+	} `json:"function"`
 }
 
 type ollamaOptions struct {
@@ -83,6 +121,55 @@ type ollamaResponse struct {
 
 // Complete implements the Client interface
 func (c *OllamaClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	httpReq, err := c.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(ProviderOllama, ctx, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(ProviderOllama, resp, respBody)
+	}
+
+	var ollamaResp ollamaResponse
+	if err := json.Unmarshal(respBody, &ollamaResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	result := &CompletionResponse{
+		Content: ollamaResp.Message.Content,
+		Model:   ollamaResp.Model,
+		Usage: Usage{
+			PromptTokens:     ollamaResp.PromptEvalCount,
+			CompletionTokens: ollamaResp.EvalCount,
+			TotalTokens:      ollamaResp.PromptEvalCount + ollamaResp.EvalCount,
+		},
+	}
+
+	// Ollama has no call IDs; results are matched by name and order
+	for _, call := range ollamaResp.Message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:         newToolCallID(),
+			Name:       call.Function.Name,
+			Parameters: toolArgs(call.Function.Arguments),
+		})
+	}
+
+	return result, nil
+}
+
+// newRequest builds the HTTP request for a completion, streamed or not
+func (c *OllamaClient) newRequest(ctx context.Context, req CompletionRequest, stream bool) (*http.Request, error) {
 	model := req.Model
 	if model == "" {
 		model = c.model
@@ -96,10 +183,18 @@ func (c *OllamaClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	// Convert messages
 	var msgs []ollamaMessage
 	for _, m := range req.Messages {
-		msgs = append(msgs, ollamaMessage{
-			Role:    m.Role,
-			Content: m.Content,
-		})
+		msg := ollamaMessage{
+			Role:     m.Role,
+			Content:  m.Content,
+			ToolName: m.Name,
+		}
+		for _, call := range m.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = toolArgs(call.Parameters)
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		msgs = append(msgs, msg)
 	}
 
 	// Add system message if provided
@@ -113,11 +208,22 @@ func (c *OllamaClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	ollamaReq := ollamaRequest{
 		Model:    model,
 		Messages: msgs,
-		Stream:   false,
+		Stream:   stream,
 		Options: ollamaOptions{
 			Temperature: req.Temperature,
 			NumPredict:  maxTokens,
 		},
+		Format: req.Schema,
+	}
+	for _, t := range req.Tools {
+		ollamaReq.Tools = append(ollamaReq.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
 	}
 
 	body, err := json.Marshal(ollamaReq)
@@ -133,9 +239,94 @@ func (c *OllamaClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 
 	httpReq.Header.Set("Content-Type", "application/json")
 
+	return httpReq, nil
+}
+
+// Stream implements streaming for Ollama (newline-delimited JSON)
+func (c *OllamaClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	httpReq, err := c.newRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	body, err := startStream(ProviderOllama, c.httpClient, httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		defer body.Close()
+		out := streamWriter{ctx: ctx, ch: ch}
+
+		var model string
+		var usage Usage
+		var apiErr error
+		err := readLines(body, func(line string) bool {
+			var chunk struct {
+				ollamaResponse
+				Error string `json:"error"`
+			}
+			if json.Unmarshal([]byte(line), &chunk) != nil {
+				return true
+			}
+			if chunk.Error != "" {
+				apiErr = streamError(ProviderOllama, chunk.Error)
+				return false
+			}
+
+			model = chunk.Model
+			if !out.text(chunk.Message.Content) {
+				return false
+			}
+			if chunk.Done {
+				usage.PromptTokens = chunk.PromptEvalCount
+				usage.CompletionTokens = chunk.EvalCount
+				return false
+			}
+			return true
+		})
+		if apiErr != nil {
+			err = apiErr
+		}
+		out.done(model, usage, err)
+	}()
+
+	return ch, nil
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+// Embed implements the Embedder interface. The embedding model is separate
+// from the chat model and has to be pulled too.
+func (c *OllamaClient) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = defaultEmbeddingModels[ProviderOllama]
+	}
+	body, err := json.Marshal(ollamaEmbedRequest{Model: model, Input: req.Input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.host+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, requestError(ProviderOllama, ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -143,45 +334,17 @@ func (c *OllamaClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, apiError(ProviderOllama, resp, respBody)
 	}
 
-	var ollamaResp ollamaResponse
-	if err := json.Unmarshal(respBody, &ollamaResp); err != nil {
+	var embedResp ollamaEmbedResponse
+	if err := json.Unmarshal(respBody, &embedResp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
-
-	return &CompletionResponse{
-		Content: ollamaResp.Message.Content,
-		Model:   ollamaResp.Model,
-		Usage: Usage{
-			PromptTokens:     ollamaResp.PromptEvalCount,
-			CompletionTokens: ollamaResp.EvalCount,
-			TotalTokens:      ollamaResp.PromptEvalCount + ollamaResp.EvalCount,
-		},
+	return &EmbeddingResponse{
+		Vectors: embedResp.Embeddings,
+		Model:   embedResp.Model,
+		Usage:   Usage{PromptTokens: embedResp.PromptEvalCount, TotalTokens: embedResp.PromptEvalCount},
 	}, nil
 }
-
-// Stream implements streaming for Ollama
-func (c *OllamaClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
-	ch := make(chan StreamChunk)
-
-	go func() {
-		defer close(ch)
-
-		resp, err := c.Complete(ctx, req)
-		if err != nil {
-			ch <- StreamChunk{Done: true}
-			return
-		}
-
-		ch <- StreamChunk{
-			Content: resp.Content,
-			Done:    true,
-		}
-	}()
-
-	return ch, nil
-}
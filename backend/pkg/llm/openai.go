@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 const (
-	openAIAPIURL       = "https://api.openai.com/v1/chat/completions"
-	defaultOpenAIModel = "gpt-4o-mini"
+	openAIAPIURL        = "https://api.openai.com/v1/chat/completions"
+	openAIEmbeddingsURL = "https://api.openai.com/v1/embeddings"
+	defaultOpenAIModel  = "gpt-4o-mini"
 )
 
 // OpenAIClient is a client for the OpenAI API
@@ -20,6 +22,9 @@ type OpenAIClient struct {
 	projectID  string
 	baseURL    string
 	httpClient *http.Client
+
+	provider Provider // Named in errors; an endpoint's name for compatible APIs
+	model    string   // Used when the request names none
 }
 
 // NewOpenAIClient creates a new OpenAI client
@@ -37,18 +42,27 @@ func NewOpenAIClientWithProject(apiKey, projectID string) (*OpenAIClient, error)
 		projectID:  projectID,
 		baseURL:    openAIAPIURL,
 		httpClient: &http.Client{},
+		provider:   ProviderOpenAI,
+		model:      defaultOpenAIModel,
 	}, nil
 }
 
-// NewOpenAICompatibleClient creates a client for OpenAI-compatible APIs
+// NewOpenAICompatibleClient creates a client for OpenAI-compatible APIs.
+// baseURL is the chat completions URL or the API root it hangs off, such as
+// "http://localhost:8000/v1".
 func NewOpenAICompatibleClient(apiKey, baseURL string) (*OpenAIClient, error) {
 	if baseURL == "" {
 		baseURL = openAIAPIURL
 	}
+	if !strings.HasSuffix(baseURL, "/chat/completions") {
+		baseURL = strings.TrimSuffix(baseURL, "/") + "/chat/completions"
+	}
 	return &OpenAIClient{
 		apiKey:     apiKey,
 		baseURL:    baseURL,
 		httpClient: &http.Client{},
+		provider:   ProviderOpenAI,
+		model:      defaultOpenAIModel,
 	}, nil
 }
 
@@ -59,11 +73,66 @@ type openAIRequest struct {
 	MaxTokens   int             `json:"max_tokens,omitempty"`
 	Temperature float64         `json:"temperature,omitempty"`
 	Tools       []openAITool    `json:"tools,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	// Asks for a final chunk with token usage when streaming
+	StreamOptions  *openAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// openAIResponseFormat asks for structured output matching a JSON schema
+type openAIResponseFormat struct {
+	Type       string           `json:"type"` // json_schema
+	JSONSchema openAIJSONSchema `json:"json_schema"`
+}
+
+type openAIJSONSchema struct {
+	Name   string  `json:"name"`
+	Schema *Schema `json:"schema"`
+	// Strict mode needs every property required, which optional fields
+	// can't satisfy; the answer is validated afterwards anyway
+	Strict bool `json:"strict"`
+}
+
+// openAIResponseFormatFor returns the structured output format for a
+// schema. OpenAI only takes object schemas; other shapes are described in
+// the system prompt instead.
+func openAIResponseFormatFor(req CompletionRequest) *openAIResponseFormat {
+	if req.Schema == nil || req.Schema.Type != "object" {
+		return nil
+	}
+	name := "response"
+	if req.Feature != "" {
+		name = strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+				return r
+			}
+			return '_'
+		}, req.Feature)
+	}
+	return &openAIResponseFormat{
+		Type:       "json_schema",
+		JSONSchema: openAIJSONSchema{Name: name, Schema: req.Schema},
+	}
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON-encoded object
+	} `json:"function"`
 }
 
 type openAITool struct {
@@ -98,9 +167,65 @@ type openAIUsage struct {
 
 // Complete implements the Client interface
 func (c *OpenAIClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	httpReq, err := c.newRequest(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, requestError(c.provider, ctx, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(c.provider, resp, respBody)
+	}
+
+	var openAIResp openAIResponse
+	if err := json.Unmarshal(respBody, &openAIResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	result := &CompletionResponse{
+		Model: openAIResp.Model,
+		Usage: Usage{
+			PromptTokens:     openAIResp.Usage.PromptTokens,
+			CompletionTokens: openAIResp.Usage.CompletionTokens,
+			TotalTokens:      openAIResp.Usage.TotalTokens,
+		},
+	}
+
+	if len(openAIResp.Choices) > 0 {
+		msg := openAIResp.Choices[0].Message
+		result.Content = msg.Content
+		for _, call := range msg.ToolCalls {
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:         call.ID,
+				Name:       call.Function.Name,
+				Parameters: parseToolArgs(call.Function.Arguments),
+			})
+		}
+	}
+
+	if len(openAIResp.Choices) > 0 && openAIResp.Choices[0].FinishReason == "content_filter" &&
+		result.Content == "" && len(result.ToolCalls) == 0 {
+		return nil, safetyError(c.provider, "response blocked by content filter")
+	}
+
+	return result, nil
+}
+
+// newRequest builds the HTTP request for a completion, streamed or not
+func (c *OpenAIClient) newRequest(ctx context.Context, req CompletionRequest, stream bool) (*http.Request, error) {
 	model := req.Model
 	if model == "" {
-		model = defaultOpenAIModel
+		model = c.model
 	}
 
 	maxTokens := req.MaxTokens
@@ -111,17 +236,30 @@ func (c *OpenAIClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	// Convert messages
 	var msgs []openAIMessage
 	for _, m := range req.Messages {
-		msgs = append(msgs, openAIMessage{
-			Role:    m.Role,
-			Content: m.Content,
-		})
+		msg := openAIMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCallID: m.ToolCallID,
+		}
+		for _, call := range m.ToolCalls {
+			tc := openAIToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = string(toolArgs(call.Parameters))
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		msgs = append(msgs, msg)
 	}
 
 	// Add system message if provided
-	if req.SystemMsg != "" {
+	responseFormat := openAIResponseFormatFor(req)
+	systemMsg := req.SystemMsg
+	if req.Schema != nil && responseFormat == nil {
+		systemMsg = schemaInstruction(systemMsg, req.Schema)
+	}
+	if systemMsg != "" {
 		msgs = append([]openAIMessage{{
 			Role:    "system",
-			Content: req.SystemMsg,
+			Content: systemMsg,
 		}}, msgs...)
 	}
 
@@ -144,6 +282,12 @@ func (c *OpenAIClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 		MaxTokens:   maxTokens,
 		Temperature: req.Temperature,
 		Tools:       tools,
+
+		ResponseFormat: responseFormat,
+	}
+	if stream {
+		openAIReq.Stream = true
+		openAIReq.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
 	}
 
 	body, err := json.Marshal(openAIReq)
@@ -157,14 +301,130 @@ func (c *OpenAIClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.projectID != "" {
+		httpReq.Header.Set("OpenAI-Project", c.projectID)
+	}
+
+	return httpReq, nil
+}
+
+// Stream implements streaming for OpenAI (chat completion chunks)
+func (c *OpenAIClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	httpReq, err := c.newRequest(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	body, err := startStream(c.provider, c.httpClient, httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		defer body.Close()
+		out := streamWriter{ctx: ctx, ch: ch}
+
+		var model string
+		var usage Usage
+		var apiErr error
+		err := readSSE(body, func(_, data string) bool {
+			if data == "[DONE]" {
+				return false
+			}
+			var chunk struct {
+				Model   string `json:"model"`
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+				Usage *openAIUsage `json:"usage"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &chunk) != nil {
+				return true
+			}
+			if chunk.Error != nil {
+				apiErr = streamError(c.provider, chunk.Error.Message)
+				return false
+			}
+
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				usage.PromptTokens = chunk.Usage.PromptTokens
+				usage.CompletionTokens = chunk.Usage.CompletionTokens
+			}
+			if len(chunk.Choices) > 0 {
+				return out.text(chunk.Choices[0].Delta.Content)
+			}
+			return true
+		})
+		if apiErr != nil {
+			err = apiErr
+		}
+		out.done(model, usage, err)
+	}()
+
+	return ch, nil
+}
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage openAIUsage `json:"usage"`
+}
+
+// embeddingsURL is the embeddings endpoint next to the client's chat
+// completions one, so compatible APIs work too
+func (c *OpenAIClient) embeddingsURL() string {
+	if base, ok := strings.CutSuffix(c.baseURL, "/chat/completions"); ok {
+		return base + "/embeddings"
+	}
+	return openAIEmbeddingsURL
+}
+
+// Embed implements the Embedder interface
+func (c *OpenAIClient) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = defaultEmbeddingModels[ProviderOpenAI]
+	}
+	body, err := json.Marshal(openAIEmbeddingRequest{Model: model, Input: req.Input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.embeddingsURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
 	if c.projectID != "" {
 		httpReq.Header.Set("OpenAI-Project", c.projectID)
 	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, requestError(c.provider, ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -172,50 +432,27 @@ func (c *OpenAIClient) Complete(ctx context.Context, req CompletionRequest) (*Co
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, apiError(c.provider, resp, respBody)
 	}
 
-	var openAIResp openAIResponse
-	if err := json.Unmarshal(respBody, &openAIResp); err != nil {
+	var embResp openAIEmbeddingResponse
+	if err := json.Unmarshal(respBody, &embResp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	result := &CompletionResponse{
-		Model: openAIResp.Model,
+	vectors := make([][]float32, len(req.Input))
+	for _, d := range embResp.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	return &EmbeddingResponse{
+		Vectors: vectors,
+		Model:   embResp.Model,
 		Usage: Usage{
-			PromptTokens:     openAIResp.Usage.PromptTokens,
-			CompletionTokens: openAIResp.Usage.CompletionTokens,
-			TotalTokens:      openAIResp.Usage.TotalTokens,
+			PromptTokens: embResp.Usage.PromptTokens,
+			TotalTokens:  embResp.Usage.TotalTokens,
 		},
-	}
-
-	if len(openAIResp.Choices) > 0 {
-		result.Content = openAIResp.Choices[0].Message.Content
-	}
-
-	return result, nil
-}
-
-// Stream implements streaming for OpenAI
-func (c *OpenAIClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
-	ch := make(chan StreamChunk)
-
-	go func() {
-		defer close(ch)
-
-		resp, err := c.Complete(ctx, req)
-		if err != nil {
-			ch <- StreamChunk{Done: true}
-			return
-		}
-
-		ch <- StreamChunk{
-			Content: resp.Content,
-			Done:    true,
-		}
-	}()
-
-	return ch, nil
+	}, nil
 }
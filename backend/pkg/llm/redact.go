@@ -0,0 +1,496 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// PrivateName is a name from a user's data that shouldn't reach an external
+// provider
+type PrivateName struct {
+	Value string
+	Type  string // person, location or organization
+}
+
+// PrivacyPolicy tells MultiClient what a user's calls may send out
+type PrivacyPolicy interface {
+	// PrivacyMode reports whether the user's calls must stay on the local model
+	PrivacyMode(ctx context.Context, userID uuid.UUID) (bool, error)
+	// KnownNames returns the people, places and organizations the user's
+	// data mentions
+	KnownNames(ctx context.Context, userID uuid.UUID) ([]PrivateName, error)
+}
+
+// RedactionConfig selects what is redacted
+type RedactionConfig struct {
+	// KeepNames lists features whose prompts are about the names themselves,
+	// such as entity matching; only patterns are redacted there. Embedding
+	// inputs always keep names, since a vector of placeholders would match
+	// every other task that mentions someone.
+	KeepNames map[string]bool
+}
+
+// RedactionStats counts redaction for one feature. Requests are counted per
+// attempt, so a retried call counts each time it was sent.
+type RedactionStats struct {
+	Checked   int64 `json:"checked"`  // Requests to external providers
+	Redacted  int64 `json:"redacted"` // Requests that had anything replaced
+	Emails    int64 `json:"emails"`
+	Phones    int64 `json:"phones"`
+	Cards     int64 `json:"cards"`
+	Addresses int64 `json:"addresses"`
+	Names     int64 `json:"names"`
+	Restored  int64 `json:"restored"`   // Placeholders put back into answers
+	LocalOnly int64 `json:"local_only"` // Privacy mode calls sent to the local model
+	Refused   int64 `json:"refused"`    // Privacy mode calls with no local model to take them
+	Errors    int64 `json:"errors"`     // Failed policy lookups
+}
+
+// Placeholder kinds; names use their entity type in upper case
+const (
+	redactEmail   = "EMAIL"
+	redactPhone   = "PHONE"
+	redactCard    = "CARD"
+	redactAddress = "ADDRESS"
+)
+
+// maxPlaceholder is the longest placeholder a stream may split, such as
+// "[ORGANIZATION_123]"
+const maxPlaceholder = 24
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}(?:[ .-]?\d{2,4}){1,4}`)
+	// Dates and times look like phone numbers to phonePattern
+	datePattern    = regexp.MustCompile(`^\d{4}-\d{1,2}-\d{1,2}|^\d{1,2}[.-]\d{1,2}[.-]\d{2,4}`)
+	addressPattern = regexp.MustCompile(`\b\d{1,5}[A-Za-z]?,? (?:[A-Z][\p{L}'.-]*,? ){1,4}` +
+		`(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Way|Place|Pl|Square|Sq|Terrace|Parkway|Pkwy|Highway|Hwy)\b`)
+	placeholderPattern = regexp.MustCompile(`\[[A-Z]+_\d+\]`)
+)
+
+// redactor applies a policy to the calls of a MultiClient
+type redactor struct {
+	policy PrivacyPolicy
+	cfg    RedactionConfig
+
+	mu    sync.Mutex
+	stats map[string]*RedactionStats
+}
+
+// EnableRedaction replaces personal data in requests to external providers
+// with placeholders, restoring them in the answers, and keeps the calls of
+// users in privacy mode on the local model
+func (mc *MultiClient) EnableRedaction(policy PrivacyPolicy, cfg RedactionConfig) {
+	mc.redaction = &redactor{policy: policy, cfg: cfg, stats: make(map[string]*RedactionStats)}
+}
+
+// RedactionEnabled reports whether EnableRedaction was called
+func (mc *MultiClient) RedactionEnabled() bool {
+	return mc.redaction != nil
+}
+
+// RedactionStats returns redaction counts by feature since the process started
+func (mc *MultiClient) RedactionStats() map[string]RedactionStats {
+	out := make(map[string]RedactionStats)
+	if mc.redaction == nil {
+		return out
+	}
+	mc.redaction.mu.Lock()
+	defer mc.redaction.mu.Unlock()
+	for feature, s := range mc.redaction.stats {
+		out[feature] = *s
+	}
+	return out
+}
+
+func (r *redactor) count(feature string, fn func(s *RedactionStats)) {
+	if feature == "" {
+		feature = "other"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stats[feature]
+	if !ok {
+		s = &RedactionStats{}
+		r.stats[feature] = s
+	}
+	fn(s)
+}
+
+// private looks up a user's privacy mode. A failed lookup counts as privacy
+// mode rather than risk sending the data out.
+func (r *redactor) private(ctx context.Context, userID uuid.UUID, feature string) bool {
+	if r == nil || userID == uuid.Nil {
+		return false
+	}
+	private, err := r.policy.PrivacyMode(ctx, userID)
+	if err != nil {
+		r.count(feature, func(s *RedactionStats) { s.Errors++ })
+		log.Warn().Err(err).Str("user_id", userID.String()).Msg("Failed to read AI privacy mode, keeping the call local")
+		return true
+	}
+	return private
+}
+
+// privacyMode sends the calls of a user in privacy mode to the local model,
+// refusing them when there is none
+func (mc *MultiClient) privacyMode(ctx context.Context, req CompletionRequest) (CompletionRequest, error) {
+	if !mc.redaction.private(ctx, req.UserID, req.Feature) {
+		return req, nil
+	}
+	if mc.IsProviderAvailable(ProviderOllama) {
+		mc.redaction.count(req.Feature, func(s *RedactionStats) { s.LocalOnly++ })
+		req.Provider = ProviderOllama
+		req.Model = ""
+		req.localOnly = true
+		req.private = true
+		return req, nil
+	}
+	mc.redaction.count(req.Feature, func(s *RedactionStats) { s.Refused++ })
+	return req, fmt.Errorf("no local model to take the call: %w", ErrPrivacyMode)
+}
+
+// guard wraps a provider's client so requests to it are redacted. The
+// local model sees everything.
+func (r *redactor) guard(provider Provider, client Client) Client {
+	if r == nil || provider == ProviderOllama || provider == ProviderFake {
+		return client
+	}
+	return &redactingClient{Client: client, r: r}
+}
+
+// redactingClient redacts requests and restores the placeholders in answers
+type redactingClient struct {
+	Client
+	r *redactor
+}
+
+func (c *redactingClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	red := c.r.begin(ctx, req.UserID, req.Feature, !c.r.cfg.KeepNames[req.Feature])
+	resp, err := c.Client.Complete(ctx, red.request(req))
+	defer c.r.finish(req.Feature, red)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	resp.Content = red.restore(resp.Content, req.Schema != nil)
+	for i := range resp.ToolCalls {
+		resp.ToolCalls[i].Parameters = json.RawMessage(red.restore(string(resp.ToolCalls[i].Parameters), true))
+	}
+	resp.redactions = red.total
+	return resp, nil
+}
+
+// Stream restores placeholders as the text arrives, holding back a trailing
+// "[..." that may be the start of one split across chunks
+func (c *redactingClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	red := c.r.begin(ctx, req.UserID, req.Feature, !c.r.cfg.KeepNames[req.Feature])
+	upstream, err := c.Client.Stream(ctx, red.request(req))
+	if err != nil {
+		c.r.finish(req.Feature, red)
+		return nil, err
+	}
+
+	escape := req.Schema != nil
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		defer c.r.finish(req.Feature, red)
+		out := streamWriter{ctx: ctx, ch: ch}
+		var pending string
+		for chunk := range upstream {
+			text := pending + chunk.Content
+			cut := len(text)
+			if !chunk.Done {
+				cut = heldBack(text)
+			}
+			chunk.Content, pending = red.restore(text[:cut], escape), text[cut:]
+			if chunk.ToolCall != nil {
+				chunk.ToolCall.Parameters = json.RawMessage(red.restore(string(chunk.ToolCall.Parameters), true))
+			}
+
+			if chunk.Done {
+				chunk.redactions = red.total
+				if chunk.Content != "" {
+					if !out.text(chunk.Content) {
+						return
+					}
+					chunk.Content = ""
+				}
+			} else if chunk.Content == "" && chunk.ToolCall == nil {
+				continue
+			}
+			if !out.send(chunk) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// heldBack returns where text may end mid-placeholder
+func heldBack(text string) int {
+	i := strings.LastIndexByte(text, '[')
+	if i < 0 || len(text)-i >= maxPlaceholder || strings.IndexByte(text[i:], ']') >= 0 {
+		return len(text)
+	}
+	return i
+}
+
+// redaction is the placeholders of one request
+type redaction struct {
+	names    *regexp.Regexp    // Nil when names are kept
+	kinds    map[string]string // Lower-cased name to placeholder kind
+	byValue  map[string]string // Original to placeholder
+	values   map[string]string // Placeholder to original
+	next     map[string]int
+	counts   map[string]int64 // By kind
+	total    int
+	restored int64
+}
+
+// begin prepares the redaction of one request. A failed name lookup only
+// costs the names; patterns are still redacted.
+func (r *redactor) begin(ctx context.Context, userID uuid.UUID, feature string, withNames bool) *redaction {
+	red := &redaction{
+		kinds:   make(map[string]string),
+		byValue: make(map[string]string),
+		values:  make(map[string]string),
+		next:    make(map[string]int),
+		counts:  make(map[string]int64),
+	}
+	if !withNames || userID == uuid.Nil {
+		return red
+	}
+	names, err := r.policy.KnownNames(ctx, userID)
+	if err != nil {
+		r.count(feature, func(s *RedactionStats) { s.Errors++ })
+		log.Warn().Err(err).Str("user_id", userID.String()).Msg("Failed to load names to redact")
+		return red
+	}
+	red.compileNames(names)
+	return red
+}
+
+// compileNames builds one pattern over the names, longest first so "Anna
+// Lee" wins over "Anna"
+func (red *redaction) compileNames(names []PrivateName) {
+	var alternatives []string
+	for _, n := range names {
+		value := strings.TrimSpace(n.Value)
+		key := strings.ToLower(value)
+		if len([]rune(value)) < 3 || red.kinds[key] != "" {
+			continue // Too short to tell from ordinary words
+		}
+		red.kinds[key] = strings.ToUpper(n.Type)
+		alternatives = append(alternatives, regexp.QuoteMeta(value))
+	}
+	if len(alternatives) == 0 {
+		return
+	}
+	sort.Slice(alternatives, func(i, j int) bool { return len(alternatives[i]) > len(alternatives[j]) })
+	red.names = regexp.MustCompile(`(?i)(?:` + strings.Join(alternatives, "|") + `)`)
+}
+
+// request returns a copy of req with its text redacted
+func (red *redaction) request(req CompletionRequest) CompletionRequest {
+	req.SystemMsg = red.text(req.SystemMsg)
+	messages := make([]Message, len(req.Messages))
+	for i, m := range req.Messages {
+		m.Content = red.text(m.Content)
+		if len(m.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(m.ToolCalls))
+			for j, call := range m.ToolCalls {
+				call.Parameters = json.RawMessage(red.text(string(call.Parameters)))
+				calls[j] = call
+			}
+			m.ToolCalls = calls
+		}
+		messages[i] = m
+	}
+	req.Messages = messages
+	return req
+}
+
+// text replaces personal data in s. Cards go first, since phonePattern
+// would take their digits, and names last, so a name inside an email
+// address leaves the address whole.
+func (red *redaction) text(s string) string {
+	if s == "" {
+		return s
+	}
+	s = cardPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if !luhn(m) {
+			return m
+		}
+		return red.placeholder(redactCard, m)
+	})
+	s = emailPattern.ReplaceAllStringFunc(s, func(m string) string { return red.placeholder(redactEmail, m) })
+	s = addressPattern.ReplaceAllStringFunc(s, func(m string) string { return red.placeholder(redactAddress, m) })
+	s = replaceMatches(s, phonePattern, func(m string) (string, bool) {
+		digits := countDigits(m)
+		if datePattern.MatchString(m) || digits < 9 && !strings.HasPrefix(m, "+") || digits < 7 || digits > 15 {
+			return m, false
+		}
+		return red.placeholder(redactPhone, m), true
+	})
+	if red.names != nil {
+		s = red.replaceNames(s)
+	}
+	return s
+}
+
+// replaceNames replaces whole-word matches of the known names
+func (red *redaction) replaceNames(s string) string {
+	return replaceMatches(s, red.names, func(m string) (string, bool) {
+		return red.placeholder(red.kinds[strings.ToLower(m)], m), true
+	})
+}
+
+// replaceMatches replaces the matches of re that aren't part of a longer
+// word or number and that fn accepts
+func replaceMatches(s string, re *regexp.Regexp, fn func(m string) (string, bool)) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if !wordBoundary(s, loc[0], loc[1]) {
+			continue
+		}
+		replacement, ok := fn(s[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(replacement)
+		last = loc[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// placeholder returns the placeholder for a value, the same one each time
+// it appears in the request
+func (red *redaction) placeholder(kind, value string) string {
+	if kind == "" {
+		kind = "NAME"
+	}
+	if p, ok := red.byValue[value]; ok {
+		red.counts[kind]++
+		red.total++
+		return p
+	}
+	red.next[kind]++
+	p := "[" + kind + "_" + strconv.Itoa(red.next[kind]) + "]"
+	red.byValue[value] = p
+	red.values[p] = value
+	red.counts[kind]++
+	red.total++
+	return p
+}
+
+// restore puts the original values back. escape writes them as the inside
+// of a JSON string, for answers that are JSON.
+func (red *redaction) restore(s string, escape bool) string {
+	if len(red.values) == 0 || !strings.Contains(s, "[") {
+		return s
+	}
+	return placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+		value, ok := red.values[p]
+		if !ok {
+			return p
+		}
+		red.restored++
+		if escape {
+			data, _ := json.Marshal(value)
+			return string(data[1 : len(data)-1])
+		}
+		return value
+	})
+}
+
+// finish adds a request's counts to the feature's stats
+func (r *redactor) finish(feature string, red *redaction) {
+	r.count(feature, func(s *RedactionStats) {
+		s.Checked++
+		if red.total > 0 {
+			s.Redacted++
+		}
+		s.Emails += red.counts[redactEmail]
+		s.Phones += red.counts[redactPhone]
+		s.Cards += red.counts[redactCard]
+		s.Addresses += red.counts[redactAddress]
+		for kind, n := range red.counts {
+			switch kind {
+			case redactEmail, redactPhone, redactCard, redactAddress:
+			default:
+				s.Names += n
+			}
+		}
+		s.Restored += red.restored
+	})
+}
+
+// redactInput redacts embedding inputs, which have no answer to restore
+func (r *redactor) redactInput(ctx context.Context, feature string, input []string) []string {
+	red := r.begin(ctx, uuid.Nil, feature, false)
+	out := make([]string, len(input))
+	for i, text := range input {
+		out[i] = red.text(text)
+	}
+	r.finish(feature, red)
+	return out
+}
+
+// wordBoundary reports whether s[start:end] isn't part of a longer word
+func wordBoundary(s string, start, end int) bool {
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+	before, _ := utf8.DecodeLastRuneInString(s[:start])
+	after, _ := utf8.DecodeRuneInString(s[end:])
+	return (start == 0 || !isWord(before)) && (end == len(s) || !isWord(after))
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// luhn reports whether the digits of s pass the card number checksum
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
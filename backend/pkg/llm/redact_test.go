@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// namesPolicy is a PrivacyPolicy with a fixed list of names and privacy mode off
+type namesPolicy []PrivateName
+
+func (p namesPolicy) PrivacyMode(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (p namesPolicy) KnownNames(ctx context.Context, userID uuid.UUID) ([]PrivateName, error) {
+	return p, nil
+}
+
+var testNames = namesPolicy{
+	{Value: "Anna", Type: "person"},
+	{Value: "Anna Lee", Type: "person"},
+	{Value: "Acme Corp", Type: "organization"},
+	{Value: `Dwayne "The Rock" Johnson`, Type: "person"},
+	{Value: "Al", Type: "person"}, // Too short, never redacted
+}
+
+func newTestRedaction(withNames bool) *redaction {
+	r := &redactor{policy: testNames, stats: make(map[string]*RedactionStats)}
+	return r.begin(context.Background(), uuid.New(), "test", withNames)
+}
+
+func TestRedactText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// Cards
+		{"card", "Pay with 4111 1111 1111 1111 today", "Pay with [CARD_1] today"},
+		{"card without spaces", "card 4111111111111111", "card [CARD_1]"},
+		{"card failing luhn", "ref 4111 1111 1111 1112", "ref 4111 1111 1111 1112"},
+
+		// Phones, and dates that look like them
+		{"international phone", "Call +1 415 555 0132 now", "Call [PHONE_1] now"},
+		{"local phone", "Call 0412 345 678", "Call [PHONE_1]"},
+		{"iso date", "Due 2026-03-10", "Due 2026-03-10"},
+		{"dotted date", "Due 10.03.2026", "Due 10.03.2026"},
+		{"short number", "Order 12345 shipped", "Order 12345 shipped"},
+		{"number inside a word", "code ABC4155550132", "code ABC4155550132"},
+
+		// Emails and addresses
+		{"email", "Mail anna@example.com", "Mail [EMAIL_1]"},
+		{"address", "Meet at 221B Baker Street tomorrow", "Meet at [ADDRESS_1] tomorrow"},
+		{"address with comma", "Ship to 12, Elm Tree Rd please", "Ship to [ADDRESS_1] please"},
+		{"not an address", "Buy 3 Green apples", "Buy 3 Green apples"},
+
+		// Names
+		{"longest name first", "Ask Anna Lee, then Anna", "Ask [PERSON_1], then [PERSON_2]"},
+		{"case insensitive", "ask anna lee", "ask [PERSON_1]"},
+		{"whole words only", "Annabel and Hanna", "Annabel and Hanna"},
+		{"repeated name", "Anna said Anna", "[PERSON_1] said [PERSON_1]"},
+		{"organization", "Invoice Acme Corp", "Invoice [ORGANIZATION_1]"},
+		{"too short", "Ask Al", "Ask Al"},
+		{"name inside email", "anna.lee@example.com", "[EMAIL_1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTestRedaction(true).text(tt.in); got != tt.want {
+				t.Errorf("text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactKeepNames(t *testing.T) {
+	got := newTestRedaction(false).text("Ask Anna Lee at anna@example.com")
+	if want := "Ask Anna Lee at [EMAIL_1]"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"5500-0000-0000-0004", true},
+		{"4111111111111112", false},
+		{"411111111111", false}, // Too short
+	}
+	for _, tt := range tests {
+		if got := luhn(tt.in); got != tt.want {
+			t.Errorf("luhn(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactRestore(t *testing.T) {
+	red := newTestRedaction(true)
+	red.text(`Ask Anna Lee and Dwayne "The Rock" Johnson`)
+
+	tests := []struct {
+		name   string
+		in     string
+		escape bool
+		want   string
+	}{
+		{"plain", "Reminded [PERSON_1]", false, "Reminded Anna Lee"},
+		{"plain keeps quotes", "Call [PERSON_2]", false, `Call Dwayne "The Rock" Johnson`},
+		{"json escapes quotes", `{"who":"[PERSON_2]"}`, true, `{"who":"Dwayne \"The Rock\" Johnson"}`},
+		{"unknown placeholder", "Ask [PERSON_9]", false, "Ask [PERSON_9]"},
+		{"no placeholder", "Nothing here", false, "Nothing here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := red.restore(tt.in, tt.escape); got != tt.want {
+				t.Errorf("restore(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// stubClient answers Complete with a fixed response and Stream with fixed chunks,
+// keeping the requests it was sent
+type stubClient struct {
+	resp     CompletionResponse
+	chunks   []string
+	requests []CompletionRequest
+}
+
+func (c *stubClient) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	c.requests = append(c.requests, req)
+	resp := c.resp
+	return &resp, nil
+}
+
+func (c *stubClient) Stream(ctx context.Context, req CompletionRequest) (<-chan StreamChunk, error) {
+	c.requests = append(c.requests, req)
+	ch := make(chan StreamChunk, len(c.chunks)+1)
+	for _, s := range c.chunks {
+		ch <- StreamChunk{Content: s}
+	}
+	ch <- StreamChunk{Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func TestRedactingClientSchemaAnswer(t *testing.T) {
+	stub := &stubClient{resp: CompletionResponse{Content: `{"title":"Call [PERSON_1]"}`}}
+	r := &redactor{policy: testNames, stats: make(map[string]*RedactionStats)}
+	client := r.guard(ProviderAnthropic, stub)
+
+	resp, err := client.Complete(context.Background(), CompletionRequest{
+		UserID:   uuid.New(),
+		Feature:  "clean",
+		Messages: []Message{{Role: "user", Content: `Call Dwayne "The Rock" Johnson`}},
+		Schema:   &Schema{Type: "object"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := stub.requests[0].Messages[0].Content; sent != "Call [PERSON_1]" {
+		t.Errorf("sent %q", sent)
+	}
+	if !json.Valid([]byte(resp.Content)) {
+		t.Fatalf("restored answer is not JSON: %s", resp.Content)
+	}
+	var answer struct{ Title string }
+	_ = json.Unmarshal([]byte(resp.Content), &answer)
+	if answer.Title != `Call Dwayne "The Rock" Johnson` {
+		t.Errorf("title = %q", answer.Title)
+	}
+	if s := r.stats["clean"]; s.Names != 1 || s.Restored != 1 || s.Redacted != 1 {
+		t.Errorf("stats = %+v", *s)
+	}
+}
+
+func TestHeldBack(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"no bracket", "Ask her", 7},
+		{"open placeholder", "Ask [PER", 4},
+		{"bare bracket", "Ask [", 4},
+		{"closed placeholder", "Ask [PERSON_1] now", 18},
+		{"too long for a placeholder", "Ask [" + strings.Repeat("x", maxPlaceholder), 5 + maxPlaceholder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heldBack(tt.text); got != tt.want {
+				t.Errorf("heldBack(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactingClientStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{"whole placeholder", []string{"Ask [PERSON_1] now"}, []string{"Ask Anna Lee now"}},
+		{"split placeholder", []string{"Ask [PER", "SON_1] now"}, []string{"Ask ", "Anna Lee now"}},
+		{"split three ways", []string{"Ask [", "PERSON", "_1]"}, []string{"Ask ", "Anna Lee"}},
+		{"bracket at the end", []string{"Costs [", "5] total"}, []string{"Costs ", "[5] total"}},
+		{"unfinished bracket flushed", []string{"Done ["}, []string{"Done ", "["}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubClient{chunks: tt.chunks}
+			r := &redactor{policy: testNames, stats: make(map[string]*RedactionStats)}
+			client := r.guard(ProviderAnthropic, stub)
+
+			ch, err := client.Stream(context.Background(), CompletionRequest{
+				UserID:   uuid.New(),
+				Messages: []Message{{Role: "user", Content: "Ask Anna Lee"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			done := false
+			for chunk := range ch {
+				if chunk.Done {
+					done = true
+					continue
+				}
+				got = append(got, chunk.Content)
+			}
+			if !done {
+				t.Error("no final chunk")
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
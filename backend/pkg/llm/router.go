@@ -0,0 +1,295 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetryPolicy controls how often one provider is retried on rate limits,
+// server errors and timeouts before the next provider is tried
+type RetryPolicy struct {
+	MaxAttempts int           // Including the first; default 3
+	BaseDelay   time.Duration // Doubled on each retry; default 250ms
+	MaxDelay    time.Duration // Default 4s; a longer Retry-After falls back instead
+}
+
+// BreakerPolicy controls when a failing provider is skipped
+type BreakerPolicy struct {
+	Failures int           // Consecutive failed calls that open the breaker; default 5
+	CoolDown time.Duration // How long it stays open before a trial call; default 30s
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 250 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 4 * time.Second
+	}
+	return p
+}
+
+func (p BreakerPolicy) withDefaults() BreakerPolicy {
+	if p.Failures <= 0 {
+		p.Failures = 5
+	}
+	if p.CoolDown <= 0 {
+		p.CoolDown = 30 * time.Second
+	}
+	return p
+}
+
+// delay returns the wait before retry n (1-based), or false when the provider
+// asked for a longer wait than is worth spending on it. The backoff is
+// jittered so callers that failed together don't retry together.
+func (p RetryPolicy) delay(n int, err error) (time.Duration, bool) {
+	backoff := min(p.BaseDelay<<(n-1), p.MaxDelay)
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	var perr *ProviderError
+	if errors.As(err, &perr) && perr.RetryAfter > 0 {
+		if perr.RetryAfter > p.MaxDelay {
+			return 0, false
+		}
+		backoff = max(backoff, perr.RetryAfter)
+	}
+	return backoff, true
+}
+
+// defaultFallbacks are the chains used for providers LLM_FALLBACKS leaves out
+func defaultFallbacks() map[Provider][]Provider {
+	return map[Provider][]Provider{
+		ProviderAnthropic: {ProviderOpenAI, ProviderGoogle},
+		ProviderGoogle:    {ProviderAnthropic, ProviderOpenAI},
+		ProviderOpenAI:    {ProviderAnthropic, ProviderGoogle},
+		ProviderOllama:    {ProviderAnthropic, ProviderGoogle},
+	}
+}
+
+// ParseFallbacks parses chains written as "anthropic:openai,google;google:openai".
+// An empty chain ("ollama:") disables fallback for that provider. extra
+// names providers beyond the built-in ones, such as named endpoints.
+func ParseFallbacks(spec string, extra ...Provider) (map[Provider][]Provider, error) {
+	known := map[Provider]bool{ProviderAnthropic: true, ProviderGoogle: true, ProviderOpenAI: true, ProviderOllama: true}
+	for _, p := range extra {
+		known[p] = true
+	}
+	chains := make(map[Provider][]Provider)
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(entry, ":")
+		primary := Provider(strings.TrimSpace(from))
+		if !ok || !known[primary] {
+			return nil, fmt.Errorf("invalid fallback chain %q", entry)
+		}
+
+		chain := []Provider{}
+		for _, name := range strings.Split(to, ",") {
+			p := Provider(strings.TrimSpace(name))
+			if p == "" {
+				continue
+			}
+			if !known[p] {
+				return nil, fmt.Errorf("unknown provider %q in fallback chain %q", p, entry)
+			}
+			chain = append(chain, p)
+		}
+		chains[primary] = chain
+	}
+	return chains, nil
+}
+
+// breaker stops calls to a provider that keeps failing. After the cool-down
+// one trial call is let through: success closes the breaker, failure opens
+// it again.
+type breaker struct {
+	policy BreakerPolicy
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	return &breaker{policy: policy}
+}
+
+// allow reports whether a call may go ahead. A nil breaker always allows.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.policy.Failures {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of a call and reports whether it opened the
+// breaker. Safety and invalid-request errors show the provider is up.
+func (b *breaker) record(err error) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasProbing := b.probing
+	b.probing = false
+
+	switch {
+	case err == nil, errors.Is(err, ErrSafety), errors.Is(err, ErrInvalidRequest):
+		b.failures = 0
+	case errors.Is(err, context.Canceled):
+	default:
+		b.failures++
+		if b.failures >= b.policy.Failures {
+			b.openUntil = time.Now().Add(b.policy.CoolDown)
+			return b.failures == b.policy.Failures || wasProbing
+		}
+	}
+	return false
+}
+
+// open reports whether calls are currently being refused
+func (b *breaker) open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.policy.Failures && (b.probing || time.Now().Before(b.openUntil))
+}
+
+// chain returns the providers to try for a request, in order
+func (mc *MultiClient) chain(primary Provider, localOnly bool) []Provider {
+	chain := []Provider{primary}
+	if localOnly {
+		return chain
+	}
+	for _, p := range mc.fallbacks[primary] {
+		if p != primary {
+			chain = append(chain, p)
+		}
+	}
+	return chain
+}
+
+// call runs fn against one provider with retries, then records the outcome
+// on the provider's breaker
+func (mc *MultiClient) call(ctx context.Context, provider Provider, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= mc.retry.MaxAttempts || !Retryable(err) {
+			break
+		}
+		wait, ok := mc.retry.delay(attempt, err)
+		if !ok {
+			break
+		}
+		log.Debug().Err(err).Str("provider", string(provider)).Int("attempt", attempt).
+			Dur("wait", wait).Msg("Retrying LLM provider")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+
+	if mc.breakers[provider].record(err) {
+		log.Warn().Err(err).Str("provider", string(provider)).Dur("cool_down", mc.breakerPolicy.CoolDown).
+			Msg("LLM provider circuit opened")
+	}
+	return err
+}
+
+// route tries fn on each step until one succeeds. Errors that another
+// provider would repeat, such as safety blocks, end the chain.
+func (mc *MultiClient) route(ctx context.Context, steps []Route, fn func(step Route, client Client) error) error {
+	var lastErr error
+	for _, step := range steps {
+		p := step.Provider
+		client, ok := mc.providers[p]
+		if !ok {
+			continue
+		}
+		if !mc.breakers[p].allow() {
+			log.Debug().Str("provider", string(p)).Msg("Skipping LLM provider with open circuit")
+			continue
+		}
+
+		client = mc.redaction.guard(p, client)
+		err := mc.call(ctx, p, func() error { return fn(step, client) })
+		if err == nil {
+			return nil
+		}
+		if !canFallBack(err) || ctx.Err() != nil {
+			return err
+		}
+		lastErr = err
+		log.Warn().Err(err).Str("provider", string(p)).Str("model", step.Model).Msg("LLM provider failed, trying next")
+	}
+
+	if lastErr == nil {
+		return fmt.Errorf("no LLM provider available for %s: %w", steps[0].Provider, ErrUnavailable)
+	}
+	return fmt.Errorf("all LLM providers failed: %w", lastErr)
+}
+
+// openStream starts a stream and waits for its first chunk, so a provider
+// that fails before sending anything can still be replaced
+func openStream(ctx context.Context, provider Provider, client Client, req CompletionRequest) (<-chan StreamChunk, error) {
+	upstream, err := client.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	first, ok := <-upstream
+	if !ok {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &ProviderError{Provider: provider, Kind: ErrUnavailable, Message: "stream closed without a response"}
+	}
+	if first.Done && first.Err != nil {
+		return nil, first.Err
+	}
+
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		out := streamWriter{ctx: ctx, ch: ch}
+		if !out.send(first) {
+			return
+		}
+		for chunk := range upstream {
+			if !out.send(chunk) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
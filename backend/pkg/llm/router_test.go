@@ -0,0 +1,316 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// httpFailure is the error a provider's client returns for an HTTP status
+func httpFailure(p Provider, status int, body, retryAfter string) error {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return apiError(p, resp, []byte(body))
+}
+
+// newRouterClient routes requests to the first provider, falling back to the
+// others in order. Every provider is a fake with nothing scripted.
+func newRouterClient(t *testing.T, retry RetryPolicy, policy BreakerPolicy, providers ...Provider) (*MultiClient, map[Provider]*FakeClient) {
+	t.Helper()
+	mc := &MultiClient{
+		providers:       make(map[Provider]Client),
+		fallbacks:       map[Provider][]Provider{providers[0]: providers[1:]},
+		defaultProvider: providers[0],
+		retry:           retry.withDefaults(),
+		breakerPolicy:   policy.withDefaults(),
+		breakers:        make(map[Provider]*breaker),
+	}
+	fakes := make(map[Provider]*FakeClient)
+	for _, p := range providers {
+		fake, err := NewFakeClient(FakeReplay, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fakes[p] = fake
+		mc.providers[p] = fake
+		mc.breakers[p] = newBreaker(mc.breakerPolicy)
+	}
+	return mc, fakes
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func testRequest() CompletionRequest {
+	return CompletionRequest{Messages: []Message{{Role: "user", Content: "Plan my day"}}}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		retryable   bool
+		canFallBack bool
+	}{
+		{"rate limited", httpFailure(ProviderOpenAI, 429, `{"error":{"message":"slow down"}}`, ""), true, true},
+		{"out of quota", httpFailure(ProviderOpenAI, 429, `{"error":{"message":"insufficient_quota"}}`, ""), false, true},
+		{"server error", httpFailure(ProviderOpenAI, 500, "", ""), true, true},
+		{"overloaded", httpFailure(ProviderAnthropic, 529, "", ""), true, true},
+		{"timeout", httpFailure(ProviderGoogle, 408, "", ""), true, true},
+		{"bad key", httpFailure(ProviderOpenAI, 401, "", ""), false, true},
+		{"bad request", httpFailure(ProviderOpenAI, 400, `{"error":{"message":"max_tokens too large"}}`, ""), false, false},
+		{"safety block", httpFailure(ProviderOpenAI, 400, `{"error":{"message":"content_policy violation"}}`, ""), false, false},
+		{"no response", requestError(ProviderOpenAI, context.Background(), errors.New("connection reset")), true, true},
+		{"canceled", context.Canceled, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.retryable {
+				t.Errorf("Retryable = %v, want %v", got, tt.retryable)
+			}
+			if got := canFallBack(tt.err); got != tt.canFallBack {
+				t.Errorf("canFallBack = %v, want %v", got, tt.canFallBack)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}.withDefaults()
+	plain := httpFailure(ProviderOpenAI, 503, "", "")
+
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 10: time.Second} {
+		wait, ok := p.delay(n, plain)
+		if !ok || wait < want/2 || wait > want {
+			t.Errorf("delay(%d) = %v, %v; want %v-%v", n, wait, ok, want/2, want)
+		}
+	}
+
+	if wait, ok := p.delay(1, httpFailure(ProviderOpenAI, 429, "", "1")); !ok || wait != time.Second {
+		t.Errorf("Retry-After 1s: delay = %v, %v", wait, ok)
+	}
+	if _, ok := p.delay(1, httpFailure(ProviderOpenAI, 429, "", "60")); ok {
+		t.Error("Retry-After over MaxDelay should fall back instead of waiting")
+	}
+}
+
+func TestRouterRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		primary      []error // Failures before the primary answers
+		wantProvider Provider
+		wantPrimary  int // Requests the primary received
+		wantKind     error
+	}{
+		{"answers first time", nil, ProviderAnthropic, 1, nil},
+		{"rate limited then answers", []error{
+			httpFailure(ProviderAnthropic, 429, "", ""),
+			httpFailure(ProviderAnthropic, 429, "", ""),
+		}, ProviderAnthropic, 3, nil},
+		{"server errors exhaust retries", []error{
+			httpFailure(ProviderAnthropic, 500, "", ""),
+			httpFailure(ProviderAnthropic, 502, "", ""),
+			httpFailure(ProviderAnthropic, 503, "", ""),
+		}, ProviderOpenAI, 3, nil},
+		{"long Retry-After falls back at once", []error{
+			httpFailure(ProviderAnthropic, 429, "", "3600"),
+		}, ProviderOpenAI, 1, nil},
+		{"auth error falls back without retry", []error{
+			httpFailure(ProviderAnthropic, 401, "", ""),
+		}, ProviderOpenAI, 1, nil},
+		{"bad request ends the chain", []error{
+			httpFailure(ProviderAnthropic, 400, "", ""),
+		}, "", 1, ErrInvalidRequest},
+		{"safety block ends the chain", []error{
+			httpFailure(ProviderAnthropic, 400, `{"error":{"message":"blocked by safety filter"}}`, ""),
+		}, "", 1, ErrSafety},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc, fakes := newRouterClient(t, fastRetry, BreakerPolicy{}, ProviderAnthropic, ProviderOpenAI)
+			for _, err := range tt.primary {
+				fakes[ProviderAnthropic].Fail(err)
+			}
+			fakes[ProviderAnthropic].Script(CompletionResponse{Content: "from anthropic"})
+			fakes[ProviderOpenAI].Script(CompletionResponse{Content: "from openai"})
+
+			resp, err := mc.Complete(context.Background(), testRequest())
+
+			if got := len(fakes[ProviderAnthropic].Requests()); got != tt.wantPrimary {
+				t.Errorf("primary requests = %d, want %d", got, tt.wantPrimary)
+			}
+			if tt.wantKind != nil {
+				if !errors.Is(err, tt.wantKind) {
+					t.Fatalf("err = %v, want %v", err, tt.wantKind)
+				}
+				if n := len(fakes[ProviderOpenAI].Requests()); n != 0 {
+					t.Errorf("fallback got %d requests", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Provider != tt.wantProvider {
+				t.Errorf("answered by %s, want %s", resp.Provider, tt.wantProvider)
+			}
+		})
+	}
+}
+
+func TestRouterFallbackOrder(t *testing.T) {
+	once := RetryPolicy{MaxAttempts: 1}
+	mc, fakes := newRouterClient(t, once, BreakerPolicy{}, ProviderAnthropic, ProviderOpenAI, ProviderGoogle)
+	fakes[ProviderAnthropic].Fail(httpFailure(ProviderAnthropic, 529, "", ""))
+	fakes[ProviderOpenAI].Fail(httpFailure(ProviderOpenAI, 429, "", ""))
+	fakes[ProviderGoogle].Script(CompletionResponse{Content: "from google"})
+
+	resp, err := mc.Complete(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Provider != ProviderGoogle || resp.Content != "from google" {
+		t.Errorf("answer = %s %q", resp.Provider, resp.Content)
+	}
+	for _, p := range []Provider{ProviderAnthropic, ProviderOpenAI, ProviderGoogle} {
+		if n := len(fakes[p].Requests()); n != 1 {
+			t.Errorf("%s requests = %d, want 1", p, n)
+		}
+	}
+
+	// Every provider failing reports the last error
+	for _, p := range []Provider{ProviderAnthropic, ProviderOpenAI, ProviderGoogle} {
+		fakes[p].Fail(httpFailure(p, 503, "", ""))
+	}
+	_, err = mc.Complete(context.Background(), testRequest())
+	if !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "all LLM providers failed") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	failure := httpFailure(ProviderOpenAI, 503, "", "")
+	b := newBreaker(BreakerPolicy{Failures: 3, CoolDown: 20 * time.Millisecond})
+
+	// Failures below the threshold keep it closed
+	for i := 0; i < 2; i++ {
+		if b.record(failure) {
+			t.Fatalf("opened after %d failures", i+1)
+		}
+	}
+	if !b.allow() || b.open() {
+		t.Fatal("closed breaker refused a call")
+	}
+
+	// Errors showing the provider is up reset the count; cancellations don't count
+	b.record(httpFailure(ProviderOpenAI, 400, "", ""))
+	b.record(context.Canceled)
+	b.record(failure)
+	b.record(failure)
+	if b.open() {
+		t.Fatal("opened without 3 consecutive failures")
+	}
+
+	if !b.record(failure) {
+		t.Fatal("third consecutive failure didn't open the breaker")
+	}
+	if !b.open() || b.allow() {
+		t.Fatal("open breaker let a call through")
+	}
+	if b.record(failure) {
+		t.Error("a further failure reported opening again")
+	}
+
+	// After the cool-down one probe goes through at a time
+	time.Sleep(25 * time.Millisecond)
+	if b.open() {
+		t.Fatal("still open after the cool-down")
+	}
+	if !b.allow() {
+		t.Fatal("no probe after the cool-down")
+	}
+	if b.allow() || !b.open() {
+		t.Fatal("second call allowed while probing")
+	}
+
+	// A failed probe opens it again
+	if !b.record(failure) {
+		t.Fatal("failed probe didn't reopen the breaker")
+	}
+	if b.allow() {
+		t.Fatal("reopened breaker let a call through")
+	}
+
+	// A successful probe closes it
+	time.Sleep(25 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("no probe after the second cool-down")
+	}
+	if b.record(nil) {
+		t.Error("success reported opening")
+	}
+	if b.open() || !b.allow() || !b.allow() {
+		t.Error("breaker didn't close after a successful probe")
+	}
+
+	var none *breaker
+	if !none.allow() || none.open() || none.record(failure) {
+		t.Error("nil breaker should always allow")
+	}
+}
+
+func TestRouterSkipsOpenCircuit(t *testing.T) {
+	once := RetryPolicy{MaxAttempts: 1}
+	mc, fakes := newRouterClient(t, once, BreakerPolicy{Failures: 1, CoolDown: time.Hour}, ProviderAnthropic, ProviderOpenAI)
+	fakes[ProviderAnthropic].Fail(httpFailure(ProviderAnthropic, 500, "", ""))
+	fakes[ProviderOpenAI].Script(CompletionResponse{Content: "one"}, CompletionResponse{Content: "two"})
+
+	if _, err := mc.Complete(context.Background(), testRequest()); err != nil {
+		t.Fatal(err)
+	}
+	if mc.IsProviderAvailable(ProviderAnthropic) {
+		t.Fatal("failed provider still available")
+	}
+
+	resp, err := mc.Complete(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Provider != ProviderOpenAI || resp.Content != "two" {
+		t.Errorf("answer = %s %q", resp.Provider, resp.Content)
+	}
+	if n := len(fakes[ProviderAnthropic].Requests()); n != 1 {
+		t.Errorf("open provider got %d requests, want 1", n)
+	}
+
+	// With every circuit open there is no one to ask
+	fakes[ProviderOpenAI].Fail(httpFailure(ProviderOpenAI, 500, "", ""))
+	if _, err := mc.Complete(context.Background(), testRequest()); err == nil {
+		t.Fatal("expected the fallback to fail")
+	}
+	_, err = mc.Complete(context.Background(), testRequest())
+	if !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "no LLM provider available") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestFakeFail(t *testing.T) {
+	fake, err := NewFakeClient(FakeReplay, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Fail(httpFailure(ProviderFake, 429, "", ""))
+	fake.Script(CompletionResponse{Content: "ok"})
+
+	if _, err := fake.Stream(context.Background(), testRequest()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("first answer = %v, want rate limited", err)
+	}
+	resp, err := fake.Complete(context.Background(), testRequest())
+	if err != nil || resp.Content != "ok" {
+		t.Errorf("second answer = %v, %v", resp, err)
+	}
+}
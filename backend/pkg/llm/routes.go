@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Endpoint is an OpenAI-compatible API served under its own provider name
+type Endpoint struct {
+	BaseURL string `json:"base_url"`
+	APIKey  string `json:"api_key,omitempty"`
+	Model   string `json:"model,omitempty"` // Used when a request names none
+}
+
+var endpointName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// ParseEndpoints reads named endpoints as JSON, such as
+// {"vllm": {"base_url": "http://vllm:8000/v1", "model": "qwen2.5-7b-instruct"}}.
+// Names can't shadow a built-in provider.
+func ParseEndpoints(spec string) (map[Provider]Endpoint, error) {
+	endpoints := make(map[Provider]Endpoint)
+	if strings.TrimSpace(spec) == "" {
+		return endpoints, nil
+	}
+	var parsed map[string]Endpoint
+	if err := json.Unmarshal([]byte(spec), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid endpoints: %w", err)
+	}
+	for name, e := range parsed {
+		switch p := Provider(name); {
+		case !endpointName.MatchString(name):
+			return nil, fmt.Errorf("invalid endpoint name %q", name)
+		case p == ProviderAnthropic || p == ProviderGoogle || p == ProviderOpenAI || p == ProviderOllama || p == ProviderFake:
+			return nil, fmt.Errorf("endpoint %q has the name of a built-in provider", name)
+		case e.BaseURL == "":
+			return nil, fmt.Errorf("endpoint %q has no base_url", name)
+		default:
+			endpoints[p] = e
+		}
+	}
+	return endpoints, nil
+}
+
+// Route is one step of a routing table entry: a provider and model to try,
+// with the settings to send them
+type Route struct {
+	Provider    Provider `json:"provider"`
+	Model       string   `json:"model,omitempty"`       // The provider's default if empty
+	MaxTokens   int      `json:"max_tokens,omitempty"`  // The request's if 0
+	Temperature *float64 `json:"temperature,omitempty"` // The request's if nil
+}
+
+// apply sends a request to the step's provider and model
+func (r Route) apply(req CompletionRequest) CompletionRequest {
+	req.Provider, req.Model = r.Provider, r.Model
+	if r.MaxTokens > 0 {
+		req.MaxTokens = r.MaxTokens
+	}
+	if r.Temperature != nil {
+		req.Temperature = *r.Temperature
+	}
+	return req
+}
+
+// RouteSource looks up the routing table
+type RouteSource interface {
+	// Routes returns the steps for a feature and user in the order they are
+	// tried, or none to leave the request to the default routing
+	Routes(ctx context.Context, feature string, userID uuid.UUID) ([]Route, error)
+}
+
+// EnableRouting sends requests that don't name a provider along the routes
+// source returns, in place of the default provider and its fallback chain
+func (mc *MultiClient) EnableRouting(source RouteSource) {
+	mc.routes = source
+}
+
+// Providers returns the configured providers, named endpoints included
+func (mc *MultiClient) Providers() []Provider {
+	providers := make([]Provider, 0, len(mc.providers))
+	for p := range mc.providers {
+		providers = append(providers, p)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
+
+// applyRoutes looks up the routes of a request that doesn't name a
+// provider. The first step's provider and model are set on the request, so
+// caps, the cache and records see where it is going. A failed lookup leaves
+// the default routing.
+func (mc *MultiClient) applyRoutes(ctx context.Context, req CompletionRequest) CompletionRequest {
+	if mc.routes == nil || req.Provider != "" {
+		return req
+	}
+	routes, err := mc.routes.Routes(ctx, req.Feature, req.UserID)
+	if err != nil {
+		log.Warn().Err(err).Str("feature", req.Feature).Msg("Failed to look up LLM routes, using the default")
+		return req
+	}
+	if len(routes) == 0 {
+		return req
+	}
+	req.routes = routes
+	req.Provider, req.Model = routes[0].Provider, routes[0].Model
+	return req
+}
+
+// plan returns the steps to try for a request: its routes, or its provider
+// followed by that provider's fallback chain. Calls kept on the local model
+// ignore their routes.
+func (mc *MultiClient) plan(req CompletionRequest) []Route {
+	if len(req.routes) > 0 && !req.localOnly {
+		return req.routes
+	}
+	primary := req.Provider
+	if primary == "" {
+		primary = mc.defaultProvider
+	}
+	chain := mc.chain(primary, req.localOnly)
+	steps := make([]Route, len(chain))
+	for i, p := range chain {
+		steps[i] = Route{Provider: p}
+	}
+	steps[0].Model = req.Model // Fallbacks use their own default model
+	return steps
+}
+
+// RoutePlan is how a request would be routed, for dry runs
+type RoutePlan struct {
+	Source   string      `json:"source"`          // table, request (provider named by the caller) or default
+	Private  bool        `json:"private"`         // Kept on the local model by privacy mode
+	Degraded bool        `json:"degraded"`        // Sent to the local model by a spend cap
+	Error    string      `json:"error,omitempty"` // Why the call would be refused
+	Steps    []RouteStep `json:"steps"`
+	Selected *RouteStep  `json:"selected,omitempty"` // The step that would be tried first
+}
+
+// RouteStep is one step of a plan with the settings it would send
+type RouteStep struct {
+	Route
+	Configured  bool `json:"configured"`
+	CircuitOpen bool `json:"circuit_open"`
+}
+
+// Explain works out where a request would go without sending it: the
+// routing table, privacy mode and spend caps are applied as for a call
+func (mc *MultiClient) Explain(ctx context.Context, req CompletionRequest) RoutePlan {
+	plan := RoutePlan{Source: "default", Steps: []RouteStep{}}
+	if req.Provider != "" {
+		plan.Source = "request"
+	}
+	req = mc.applyRoutes(ctx, req)
+	if len(req.routes) > 0 {
+		plan.Source = "table"
+	}
+
+	if mc.redaction.private(ctx, req.UserID, req.Feature) {
+		plan.Private = true
+		if !mc.IsProviderAvailable(ProviderOllama) {
+			plan.Error = ErrPrivacyMode.Error()
+			return plan
+		}
+		req.Provider, req.Model, req.localOnly = ProviderOllama, "", true
+	} else {
+		admitted, degraded, err := mc.admit(ctx, req)
+		if err != nil {
+			plan.Error = err.Error()
+			return plan
+		}
+		req, plan.Degraded = admitted, degraded
+	}
+
+	for _, step := range mc.plan(req) {
+		sent := step.apply(req)
+		temperature := sent.Temperature
+		s := RouteStep{
+			Route:       Route{Provider: step.Provider, Model: sent.Model, MaxTokens: sent.MaxTokens, Temperature: &temperature},
+			CircuitOpen: mc.breakers[step.Provider].open(),
+		}
+		_, s.Configured = mc.providers[step.Provider]
+		plan.Steps = append(plan.Steps, s)
+	}
+	for i := range plan.Steps {
+		if plan.Steps[i].Configured && !plan.Steps[i].CircuitOpen {
+			plan.Selected = &plan.Steps[i]
+			break
+		}
+	}
+	if plan.Selected == nil {
+		plan.Error = "no provider of the route is available"
+	}
+	return plan
+}
@@ -0,0 +1,369 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Schema is the subset of JSON Schema used to describe structured answers.
+// It marshals to standard JSON Schema, so providers with a native JSON mode
+// can be handed it as is.
+type Schema struct {
+	Type        string             `json:"type"` // object, array, string, integer, number, boolean
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Format      string             `json:"format,omitempty"` // date, date-time, email, or date-or-time for either date form
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+}
+
+// Bound returns a pointer for the Minimum, Maximum, MinItems, MaxItems and
+// MaxLength fields
+func Bound[T int | float64](v T) *T {
+	return &v
+}
+
+// Schema outcomes recorded for requests that carry a schema
+const (
+	SchemaValid    = "valid"    // The first answer matched
+	SchemaRepaired = "repaired" // The answer matched after one repair round-trip
+	SchemaInvalid  = "invalid"  // The repaired answer still didn't match
+)
+
+// Validate checks a JSON document against the schema and returns one
+// message per problem, each prefixed with the path to the offending value.
+// Properties that aren't required may be null.
+func (s *Schema) Validate(data []byte) []string {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []string{fmt.Sprintf("not valid JSON: %v", err)}
+	}
+	if dec.More() {
+		return []string{"unexpected text after the JSON value"}
+	}
+	var problems []string
+	s.validate("$", v, &problems)
+	return problems
+}
+
+func (s *Schema) validate(path string, v interface{}, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			fail("expected an object, got %s", jsonType(v))
+			return
+		}
+		for _, name := range s.Required {
+			if val, ok := obj[name]; !ok || val == nil {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok || obj[name] == nil {
+				continue
+			}
+			prop.validate(path+"."+name, obj[name], problems)
+		}
+
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			fail("expected an array, got %s", jsonType(v))
+			return
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			fail("has %d items, at least %d required", len(arr), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			fail("has %d items, at most %d allowed", len(arr), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("expected a string, got %s", jsonType(v))
+			return
+		}
+		if len(s.Enum) > 0 && !containsString(s.Enum, str) {
+			fail("%q is not one of %s", str, strings.Join(s.Enum, ", "))
+		}
+		if s.MaxLength != nil && len([]rune(str)) > *s.MaxLength {
+			fail("is %d characters, at most %d allowed", len([]rune(str)), *s.MaxLength)
+		}
+		if str != "" && !validFormat(s.Format, str) {
+			fail("%q is not a valid %s", str, s.Format)
+		}
+
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			fail("expected %s, got %s", article(s.Type), jsonType(v))
+			return
+		}
+		f, err := num.Float64()
+		if err != nil {
+			fail("%s is not a number", num)
+			return
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				fail("expected an integer, got %s", num)
+				return
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("%s is below the minimum %g", num, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("%s is above the maximum %g", num, *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("expected a boolean, got %s", jsonType(v))
+		}
+	}
+}
+
+// dateTimeLayouts are accepted for "date-time"; models often leave out the zone
+var dateTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+func validFormat(format, s string) bool {
+	switch format {
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "date-time":
+		_, err := ParseDateTime(s)
+		return err == nil
+	case "date-or-time":
+		return validFormat("date", s) || validFormat("date-time", s)
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	}
+	return true
+}
+
+// ParseDateTime parses a value that passed the "date-time" format
+func ParseDateTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func article(typ string) string {
+	if typ == "integer" {
+		return "an integer"
+	}
+	return "a " + typ
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractJSON returns the JSON value in a model's answer, dropping a
+// markdown code fence or any text around the outermost brackets
+func ExtractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		if nl := strings.IndexByte(content, '\n'); nl >= 0 {
+			content = content[nl+1:]
+		}
+		if end := strings.LastIndex(content, "```"); end >= 0 {
+			content = content[:end]
+		}
+		content = strings.TrimSpace(content)
+	}
+	if json.Valid([]byte(content)) {
+		return content
+	}
+
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return content
+	}
+	closer := "}"
+	if content[start] == '[' {
+		closer = "]"
+	}
+	if end := strings.LastIndex(content, closer); end > start {
+		return content[start : end+1]
+	}
+	return content
+}
+
+// schemaInstruction is appended to the system prompt for providers without
+// a native schema mode
+func schemaInstruction(system string, schema *Schema) string {
+	if schema == nil {
+		return system
+	}
+	data, _ := json.Marshal(schema)
+	instruction := "Respond with only a JSON value, no prose or code fences, that matches this JSON Schema:\n" + string(data)
+	if system == "" {
+		return instruction
+	}
+	return system + "\n\n" + instruction
+}
+
+// conform checks a completed answer against the request's schema. An answer
+// that doesn't match goes back to the model once with the problems listed;
+// if the repaired answer still doesn't match the call fails with
+// ErrInvalidOutput. On success resp.Content holds just the JSON.
+func (mc *MultiClient) conform(ctx context.Context, req CompletionRequest, resp *CompletionResponse) (*CompletionResponse, error) {
+	content := ExtractJSON(resp.Content)
+	problems := req.Schema.Validate([]byte(content))
+	if len(problems) == 0 {
+		resp.Content = content
+		resp.schemaStatus = SchemaValid
+		return resp, nil
+	}
+	log.Debug().Str("feature", req.Feature).Strs("problems", problems).Msg("LLM answer failed its schema, repairing")
+
+	repair := req
+	repair.Provider = resp.Provider
+	repair.Temperature = 0
+	repair.Messages = repairMessages(req.Messages, resp.Content, problems)
+	repair.routes = nil // The provider that answered repairs it
+
+	var fixed *CompletionResponse
+	err := mc.route(ctx, mc.plan(repair), func(step Route, client Client) error {
+		sent := step.apply(repair)
+		sent.Temperature = 0
+		var err error
+		if fixed, err = client.Complete(ctx, sent); err == nil {
+			fixed.Provider = step.Provider
+		}
+		return err
+	})
+	usage := resp.Usage
+	if fixed != nil {
+		usage.PromptTokens += fixed.Usage.PromptTokens
+		usage.CompletionTokens += fixed.Usage.CompletionTokens
+		usage.TotalTokens += fixed.Usage.TotalTokens
+	}
+	if err != nil {
+		resp.Usage, resp.schemaStatus = usage, SchemaInvalid
+		return resp, fmt.Errorf("schema repair failed: %w", err)
+	}
+
+	content = ExtractJSON(fixed.Content)
+	fixed.Usage = usage
+	if problems = req.Schema.Validate([]byte(content)); len(problems) > 0 {
+		fixed.schemaStatus = SchemaInvalid
+		return fixed, &ProviderError{
+			Provider: fixed.Provider,
+			Kind:     ErrInvalidOutput,
+			Message:  strings.Join(problems, "; "),
+		}
+	}
+	fixed.Content = content
+	fixed.schemaStatus = SchemaRepaired
+	return fixed, nil
+}
+
+// repairMessages continues a conversation with the rejected answer and what
+// was wrong with it
+func repairMessages(messages []Message, answer string, problems []string) []Message {
+	out := make([]Message, 0, len(messages)+2)
+	out = append(out, messages...)
+	return append(out,
+		Message{Role: "assistant", Content: answer},
+		Message{Role: "user", Content: "That answer doesn't match the required JSON schema:\n- " +
+			strings.Join(problems, "\n- ") +
+			"\n\nReply with only the corrected JSON."},
+	)
+}
+
+// conformStream checks a streamed answer against the request's schema once
+// it ends. A repaired answer replaces the streamed text through the final
+// chunk's Replace field.
+func (mc *MultiClient) conformStream(ctx context.Context, req CompletionRequest, provider Provider, upstream <-chan StreamChunk) <-chan StreamChunk {
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		out := streamWriter{ctx: ctx, ch: ch}
+		var text strings.Builder
+		for chunk := range upstream {
+			text.WriteString(chunk.Content)
+			if chunk.Done && chunk.Err == nil {
+				resp := &CompletionResponse{Content: text.String(), Provider: provider}
+				if chunk.Usage != nil {
+					resp.Usage = *chunk.Usage
+				}
+				resp, err := mc.conform(ctx, req, resp)
+				chunk.Usage = &resp.Usage
+				chunk.Err = err
+				chunk.schemaStatus = resp.schemaStatus
+				if err == nil && resp.schemaStatus == SchemaRepaired {
+					chunk.Replace = resp.Content
+				}
+			}
+			if !out.send(chunk) {
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var taskSchema = &Schema{
+	Type:     "object",
+	Required: []string{"title", "priority"},
+	Properties: map[string]*Schema{
+		"title":      {Type: "string", MaxLength: Bound(10)},
+		"priority":   {Type: "string", Enum: []string{"low", "medium", "high"}},
+		"complexity": {Type: "integer", Minimum: Bound(1.0), Maximum: Bound(10.0)},
+		"score":      {Type: "number", Minimum: Bound(0.0), Maximum: Bound(1.0)},
+		"due":        {Type: "string", Format: "date"},
+		"start":      {Type: "string", Format: "date-time"},
+		"when":       {Type: "string", Format: "date-or-time"},
+		"email":      {Type: "string", Format: "email"},
+		"urgent":     {Type: "boolean"},
+		"tags": {
+			Type:     "array",
+			MinItems: Bound(1),
+			MaxItems: Bound(2),
+			Items:    &Schema{Type: "string", Enum: []string{"home", "work"}},
+		},
+	},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		{"valid", `{"title":"Call mom","priority":"high"}`, nil},
+		{"optional null", `{"title":"Call mom","priority":"low","due":null,"tags":null}`, nil},
+		{"unknown property ignored", `{"title":"Call mom","priority":"low","extra":1}`, nil},
+		{"missing required", `{"title":"Call mom"}`, []string{`$: missing required property "priority"`}},
+		{"null required", `{"title":null,"priority":"low"}`, []string{`$: missing required property "title"`}},
+		{"not an object", `["title"]`, []string{"$: expected an object, got an array"}},
+		{"enum", `{"title":"a","priority":"urgent"}`, []string{`$.priority: "urgent" is not one of low, medium, high`}},
+		{"enum is case sensitive", `{"title":"a","priority":"High"}`, []string{`$.priority: "High" is not one of low, medium, high`}},
+		{"max length counts runes", `{"title":"Gọi mẹ nhé","priority":"low"}`, nil},
+		{"too long", `{"title":"Call mom now!","priority":"low"}`, []string{"$.title: is 13 characters, at most 10 allowed"}},
+		{"integer in range", `{"title":"a","priority":"low","complexity":10}`, nil},
+		{"integer below minimum", `{"title":"a","priority":"low","complexity":0}`, []string{"$.complexity: 0 is below the minimum 1"}},
+		{"integer above maximum", `{"title":"a","priority":"low","complexity":11}`, []string{"$.complexity: 11 is above the maximum 10"}},
+		{"fraction for integer", `{"title":"a","priority":"low","complexity":2.5}`, []string{"$.complexity: expected an integer, got 2.5"}},
+		{"string for integer", `{"title":"a","priority":"low","complexity":"3"}`, []string{"$.complexity: expected an integer, got a string"}},
+		{"number range", `{"title":"a","priority":"low","score":1.5}`, []string{"$.score: 1.5 is above the maximum 1"}},
+		{"iso date", `{"title":"a","priority":"low","due":"2026-03-10"}`, nil},
+		{"empty date", `{"title":"a","priority":"low","due":""}`, nil},
+		{"us date", `{"title":"a","priority":"low","due":"03/10/2026"}`, []string{`$.due: "03/10/2026" is not a valid date`}},
+		{"impossible date", `{"title":"a","priority":"low","due":"2026-02-30"}`, []string{`$.due: "2026-02-30" is not a valid date`}},
+		{"date-time with zone", `{"title":"a","priority":"low","start":"2026-03-10T09:30:00+07:00"}`, nil},
+		{"date-time without zone", `{"title":"a","priority":"low","start":"2026-03-10T09:30"}`, nil},
+		{"date for date-time", `{"title":"a","priority":"low","start":"2026-03-10"}`, []string{`$.start: "2026-03-10" is not a valid date-time`}},
+		{"date-or-time", `{"title":"a","priority":"low","when":"2026-03-10"}`, nil},
+		{"email", `{"title":"a","priority":"low","email":"an@example.com"}`, nil},
+		{"email with name", `{"title":"a","priority":"low","email":"An <an@example.com>"}`, []string{`$.email: "An <an@example.com>" is not a valid email`}},
+		{"boolean", `{"title":"a","priority":"low","urgent":"yes"}`, []string{"$.urgent: expected a boolean, got a string"}},
+		{"array items", `{"title":"a","priority":"low","tags":["home","play"]}`, []string{`$.tags[1]: "play" is not one of home, work`}},
+		{"too few items", `{"title":"a","priority":"low","tags":[]}`, []string{"$.tags: has 0 items, at least 1 required"}},
+		{"too many items", `{"title":"a","priority":"low","tags":["home","work","home"]}`, []string{"$.tags: has 3 items, at most 2 allowed"}},
+		{
+			"problems in path order",
+			`{"urgent":1,"priority":"none","complexity":-1}`,
+			[]string{
+				`$: missing required property "title"`,
+				"$.complexity: -1 is below the minimum 1",
+				`$.priority: "none" is not one of low, medium, high`,
+				"$.urgent: expected a boolean, got a number",
+			},
+		},
+		{"invalid json", `{"title":`, []string{"not valid JSON: unexpected EOF"}},
+		{"trailing text", `{"title":"a","priority":"low"} thanks!`, []string{"unexpected text after the JSON value"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := taskSchema.Validate([]byte(tt.data))
+			if fmt.Sprint(problems) != fmt.Sprint(tt.problems) {
+				t.Errorf("problems = %q, want %q", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain", `{"a":1}`, `{"a":1}`},
+		{"code fence", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"prose around object", `Here you go: {"a":{"b":2}} Hope that helps.`, `{"a":{"b":2}}`},
+		{"array", `Result: ["x","y"]`, `["x","y"]`},
+		{"no json", `no idea`, `no idea`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractJSON(tt.content); got != tt.want {
+				t.Errorf("ExtractJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaRepair(t *testing.T) {
+	valid := `{"title":"Call mom","priority":"high"}`
+	invalid := `{"title":"Call mom","priority":"urgent"}`
+	usage := Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+
+	tests := []struct {
+		name      string
+		answers   []string
+		status    string
+		content   string
+		calls     int
+		wantError bool
+	}{
+		{"valid first time", []string{"```json\n" + valid + "\n```"}, SchemaValid, valid, 1, false},
+		{"repaired", []string{"Sure! " + invalid, valid}, SchemaRepaired, valid, 2, false},
+		{"repair is attempted once", []string{invalid, invalid, valid}, SchemaInvalid, "", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, err := NewFakeClient(FakeReplay, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, answer := range tt.answers {
+				fake.Script(CompletionResponse{Content: answer, Usage: usage})
+			}
+			mc := NewFakeMultiClient(fake)
+
+			req := CompletionRequest{
+				Messages:    []Message{{Role: "user", Content: "Clean up: call mom"}},
+				Temperature: 0.7,
+				Schema:      taskSchema,
+			}
+			resp, err := mc.complete(context.Background(), req)
+
+			requests := fake.Requests()
+			if len(requests) != tt.calls {
+				t.Fatalf("provider called %d times, want %d", len(requests), tt.calls)
+			}
+			if tt.wantError {
+				if !errors.Is(err, ErrInvalidOutput) {
+					t.Fatalf("err = %v, want ErrInvalidOutput", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.schemaStatus != tt.status {
+				t.Errorf("schema status = %q, want %q", resp.schemaStatus, tt.status)
+			}
+			if !tt.wantError && resp.Content != tt.content {
+				t.Errorf("content = %q, want %q", resp.Content, tt.content)
+			}
+			if want := tt.calls * usage.TotalTokens; resp.Usage.TotalTokens != want {
+				t.Errorf("total tokens = %d, want %d", resp.Usage.TotalTokens, want)
+			}
+
+			if tt.calls > 1 {
+				repair := requests[1]
+				if repair.Temperature != 0 {
+					t.Errorf("repair temperature = %v, want 0", repair.Temperature)
+				}
+				if len(repair.Messages) != 3 || repair.Messages[1].Role != "assistant" {
+					t.Fatalf("repair messages = %+v", repair.Messages)
+				}
+				if !strings.Contains(repair.Messages[2].Content, `$.priority: "urgent" is not one of low, medium, high`) {
+					t.Errorf("repair prompt doesn't list the problem: %q", repair.Messages[2].Content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxStreamLine bounds one line of a streamed response
+const maxStreamLine = 1 << 20
+
+// startStream sends a streaming request and returns the body once the provider
+// has accepted it. Failures before the first token are returned here, so
+// MultiClient can still fall back to another provider.
+func startStream(provider Provider, client *http.Client, httpReq *http.Request) (io.ReadCloser, error) {
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, requestError(provider, httpReq.Context(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, apiError(provider, resp, body)
+	}
+	return resp.Body, nil
+}
+
+// streamWriter delivers chunks until the consumer's context is cancelled
+type streamWriter struct {
+	ctx context.Context
+	ch  chan<- StreamChunk
+}
+
+func (w streamWriter) send(chunk StreamChunk) bool {
+	select {
+	case w.ch <- chunk:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// text sends a token delta; false once nobody is listening
+func (w streamWriter) text(s string) bool {
+	if s == "" {
+		return true
+	}
+	return w.send(StreamChunk{Content: s})
+}
+
+// done sends the final chunk
+func (w streamWriter) done(model string, usage Usage, err error) {
+	if err == nil && w.ctx.Err() != nil {
+		err = w.ctx.Err()
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	w.send(StreamChunk{Done: true, Model: model, Usage: &usage, Err: err})
+}
+
+// readLines calls fn for each line of body until fn returns false
+func readLines(body io.Reader, fn func(line string) bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// readSSE calls fn with the event name and data of each Server-Sent Event
+// until fn returns false
+func readSSE(body io.Reader, fn func(event, data string) bool) error {
+	var event string
+	var data []string
+	stopped := false
+	dispatch := func() bool {
+		if len(data) == 0 {
+			event = ""
+			return true
+		}
+		ok := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return ok
+	}
+
+	err := readLines(body, func(line string) bool {
+		switch {
+		case line == "":
+			stopped = !dispatch()
+			return !stopped
+		case strings.HasPrefix(line, ":"): // Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		return true
+	})
+	if err == nil && !stopped {
+		dispatch() // Last event without a trailing blank line
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// toolArgs returns the arguments of a tool call as a JSON object, so a call
+// without parameters still round-trips as {}
+func toolArgs(raw json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return json.RawMessage("{}")
+	}
+	return trimmed
+}
+
+// parseToolArgs reads arguments sent as a JSON-encoded string (OpenAI), keeping
+// them as a string value if the model produced invalid JSON
+func parseToolArgs(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("{}")
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	quoted, _ := json.Marshal(s)
+	return quoted
+}
+
+// toolResultObject wraps a tool result for providers that need a JSON object
+func toolResultObject(content string) json.RawMessage {
+	trimmed := bytes.TrimSpace([]byte(content))
+	if len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed) {
+		return trimmed
+	}
+	wrapped, _ := json.Marshal(map[string]string{"content": content})
+	return wrapped
+}
+
+// newToolCallID names a call for providers that don't assign IDs
+func newToolCallID() string {
+	return "call_" + uuid.NewString()[:8]
+}
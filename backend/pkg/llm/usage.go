@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// usageWriteTimeout bounds saving one call record, which runs after the
+// caller already has its answer
+const usageWriteTimeout = 5 * time.Second
+
+// Price is what a model costs in USD per million tokens
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// PriceTable prices calls by model name. The longest key the model starts
+// with wins, so "gpt-4o-mini" covers dated snapshots; a provider name prices
+// that provider's unlisted models.
+type PriceTable map[string]Price
+
+// DefaultPrices are list prices for the models the providers default to and
+// their usual alternatives
+func DefaultPrices() PriceTable {
+	return PriceTable{
+		"claude-opus-4":     {Input: 15, Output: 75},
+		"claude-sonnet-4":   {Input: 3, Output: 15},
+		"claude-3-7-sonnet": {Input: 3, Output: 15},
+		"claude-3-5-sonnet": {Input: 3, Output: 15},
+		"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+		"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+		"gpt-4o":            {Input: 2.5, Output: 10},
+		"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+		"gpt-4.1":           {Input: 2, Output: 8},
+		"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+		"gpt-4.1-nano":      {Input: 0.1, Output: 0.4},
+		"gemini-2.5-pro":    {Input: 1.25, Output: 10},
+		"gemini-2.5-flash":  {Input: 0.3, Output: 2.5},
+		"gemini-2.0-flash":  {Input: 0.1, Output: 0.4},
+		"gemini-1.5-pro":    {Input: 1.25, Output: 5},
+		"gemini-1.5-flash":  {Input: 0.075, Output: 0.3},
+
+		"text-embedding-3-small": {Input: 0.02},
+		"text-embedding-3-large": {Input: 0.13},
+		"text-embedding-004":     {},
+
+		string(ProviderAnthropic): {Input: 3, Output: 15},
+		string(ProviderOpenAI):    {Input: 2.5, Output: 10},
+		string(ProviderGoogle):    {Input: 1.25, Output: 10},
+		string(ProviderOllama):    {},
+		string(ProviderFake):      {},
+	}
+}
+
+// ParsePrices reads a JSON price table such as
+// {"gpt-4o-mini": {"input": 0.15, "output": 0.6}} over the defaults
+func ParsePrices(spec string) (PriceTable, error) {
+	prices := DefaultPrices()
+	if strings.TrimSpace(spec) == "" {
+		return prices, nil
+	}
+	var custom PriceTable
+	if err := json.Unmarshal([]byte(spec), &custom); err != nil {
+		return prices, fmt.Errorf("invalid price table: %w", err)
+	}
+	for model, price := range custom {
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// Cost prices a call in USD
+func (t PriceTable) Cost(provider Provider, model string, usage Usage) float64 {
+	price, ok := t[string(provider)]
+	// Local and fake models cost what their provider does, whatever they are called
+	if provider != ProviderOllama && provider != ProviderFake {
+		matched := 0
+		for key, p := range t {
+			if len(key) > matched && strings.HasPrefix(model, key) {
+				price, ok, matched = p, true, len(key)
+			}
+		}
+	}
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6
+}
+
+// CallRecord is one LLM call as stored for usage reports
+type CallRecord struct {
+	UserID        uuid.UUID // Nil for system calls
+	Feature       string
+	Provider      Provider
+	Model         string
+	Usage         Usage
+	CostUSD       float64
+	Latency       time.Duration
+	Cached        bool
+	Streamed      bool
+	Degraded      bool      // Sent to a local model because a spend cap was reached
+	Schema        string    // SchemaValid, SchemaRepaired or SchemaInvalid; empty without a schema
+	PromptVersion uuid.UUID // Nil if the request didn't name one
+	Redactions    int       // Values replaced by placeholders before the call
+	Private       bool      // Kept on the local model by privacy mode
+	Err           error     // The call's error, if it failed
+}
+
+// UsageStore persists call records and sums what they cost
+type UsageStore interface {
+	RecordCall(ctx context.Context, rec CallRecord) error
+	// DailySpend returns today's spend in USD for a user and for everyone
+	DailySpend(ctx context.Context, userID uuid.UUID) (user, global float64, err error)
+}
+
+// SpendCaps limit daily spend in USD; zero means no cap
+type SpendCaps struct {
+	PerUser float64
+	Global  float64
+}
+
+// UsageConfig prices calls and caps spend
+type UsageConfig struct {
+	Prices PriceTable // DefaultPrices if nil
+	Caps   SpendCaps
+}
+
+type usageTracker struct {
+	store UsageStore
+	cfg   UsageConfig
+}
+
+// EnableUsage records every call in store and enforces the spend caps
+func (mc *MultiClient) EnableUsage(store UsageStore, cfg UsageConfig) {
+	if cfg.Prices == nil {
+		cfg.Prices = DefaultPrices()
+	}
+	mc.usage = &usageTracker{store: store, cfg: cfg}
+}
+
+// admit applies the spend caps to a request. Past a cap the call goes to
+// the local model if there is one, and fails with ErrSpendCap otherwise. If
+// spend can't be read the call goes ahead.
+func (mc *MultiClient) admit(ctx context.Context, req CompletionRequest) (CompletionRequest, bool, error) {
+	t := mc.usage
+	if t == nil || (t.cfg.Caps.PerUser <= 0 && t.cfg.Caps.Global <= 0) {
+		return req, false, nil
+	}
+
+	userSpend, globalSpend, err := t.store.DailySpend(ctx, req.UserID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read LLM spend, skipping caps")
+		return req, false, nil
+	}
+
+	var capErr error
+	switch {
+	case t.cfg.Caps.Global > 0 && globalSpend >= t.cfg.Caps.Global:
+		capErr = fmt.Errorf("global daily spend of $%.2f reached the $%.2f cap: %w", globalSpend, t.cfg.Caps.Global, ErrSpendCap)
+	case t.cfg.Caps.PerUser > 0 && req.UserID != uuid.Nil && userSpend >= t.cfg.Caps.PerUser:
+		capErr = fmt.Errorf("daily spend of $%.2f reached the $%.2f cap: %w", userSpend, t.cfg.Caps.PerUser, ErrSpendCap)
+	default:
+		return req, false, nil
+	}
+
+	if mc.IsProviderAvailable(ProviderOllama) {
+		req.Provider = ProviderOllama
+		req.Model = ""
+		req.localOnly = true
+		return req, true, nil
+	}
+	return req, false, capErr
+}
+
+// record saves a finished call in the background
+func (mc *MultiClient) record(req CompletionRequest, rec CallRecord) {
+	t := mc.usage
+	if t == nil {
+		return
+	}
+
+	rec.UserID = req.UserID
+	rec.Feature = req.Feature
+	rec.PromptVersion = req.PromptVersion
+	rec.Private = req.private
+	if rec.Provider == "" {
+		rec.Provider = req.Provider
+		if rec.Provider == "" {
+			rec.Provider = mc.defaultProvider
+		}
+	}
+	if rec.Model == "" {
+		rec.Model = req.Model
+	}
+	if !rec.Cached {
+		rec.CostUSD = t.cfg.Prices.Cost(rec.Provider, rec.Model, rec.Usage)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), usageWriteTimeout)
+		defer cancel()
+		if err := t.store.RecordCall(ctx, rec); err != nil {
+			log.Warn().Err(err).Str("feature", rec.Feature).Msg("Failed to record LLM call")
+		}
+	}()
+}
+
+// observeStream forwards a stream and records the call once it ends
+func (mc *MultiClient) observeStream(ctx context.Context, req CompletionRequest, rec CallRecord, start time.Time, upstream <-chan StreamChunk) <-chan StreamChunk {
+	if mc.usage == nil {
+		return upstream
+	}
+
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		out := streamWriter{ctx: ctx, ch: ch}
+		for chunk := range upstream {
+			if chunk.Done {
+				rec.Model = chunk.Model
+				if chunk.Usage != nil {
+					rec.Usage = *chunk.Usage
+				}
+				rec.Err = chunk.Err
+				rec.Schema, rec.Redactions = chunk.schemaStatus, chunk.redactions
+			}
+			if !out.send(chunk) {
+				break
+			}
+		}
+		rec.Latency = time.Since(start)
+		if rec.Err == nil && ctx.Err() != nil {
+			rec.Err = ctx.Err()
+		}
+		mc.record(req, rec)
+	}()
+	return ch
+}
+
+// ErrorKind names the kind of a call error for storage: one of the Err*
+// kinds, "canceled", "timeout" or "other"
+func ErrorKind(err error) string {
+	kinds := []struct {
+		err  error
+		name string
+	}{
+		{ErrRateLimited, "rate_limited"},
+		{ErrQuota, "quota"},
+		{ErrAuth, "auth"},
+		{ErrSafety, "safety"},
+		{ErrInvalidRequest, "invalid_request"},
+		{ErrUnavailable, "unavailable"},
+		{ErrSpendCap, "spend_cap"},
+		{ErrInvalidOutput, "invalid_output"},
+		{ErrPrivacyMode, "privacy_mode"},
+		{context.Canceled, "canceled"},
+		{context.DeadlineExceeded, "timeout"},
+	}
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			return k.name
+		}
+	}
+	return "other"
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -21,14 +22,30 @@ type TokenClaims struct {
 	TokenType string    `json:"type"` // "access" or "refresh"
 }
 
+// PersonalTokenPrefix marks a personal access token in the Authorization header
+const PersonalTokenPrefix = "flow_pat_"
+
+// TokenIdentity is what a personal access token resolves to
+type TokenIdentity struct {
+	TokenID uuid.UUID
+	UserID  uuid.UUID
+	Scopes  []string
+}
+
+// TokenValidator resolves a personal access token to its owner and scopes.
+// It should return errors.ErrInvalidToken for unknown, revoked or expired tokens.
+type TokenValidator func(ctx context.Context, token string) (*TokenIdentity, error)
+
 // AuthConfig holds configuration for the auth middleware
 type AuthConfig struct {
-	JWTSecret     string
-	SkipPaths     []string
-	PublicPaths   []string // Paths that allow optional auth
+	JWTSecret      string
+	SkipPaths      []string
+	PublicPaths    []string       // Paths that allow optional auth
+	TokenValidator TokenValidator // Optional: enables personal access tokens
 }
 
-// Auth creates a JWT authentication middleware
+// Auth creates an authentication middleware that accepts JWT access tokens
+// and, when a TokenValidator is configured, personal access tokens.
 func Auth(config AuthConfig) fiber.Handler {
 	// Debug: log secret length on first request
 	log.Debug().Int("jwt_secret_len", len(config.JWTSecret)).Msg("Auth middleware initialized")
@@ -69,6 +86,23 @@ func Auth(config AuthConfig) fiber.Handler {
 
 		tokenString := parts[1]
 
+		// Personal access token: same userID local as a JWT, plus its granted scopes
+		if strings.HasPrefix(tokenString, PersonalTokenPrefix) && config.TokenValidator != nil {
+			identity, err := config.TokenValidator(c.Context(), tokenString)
+			if err != nil {
+				if isPublic {
+					return c.Next()
+				}
+				return httputil.Error(c, err)
+			}
+
+			c.Locals("userID", identity.UserID)
+			c.Locals("tokenID", identity.TokenID)
+			c.Locals("scopes", identity.Scopes)
+
+			return c.Next()
+		}
+
 		// Parse and validate token
 		claims, err := validateToken(tokenString, config.JWTSecret)
 		if err != nil {
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/httputil"
+)
+
+// Scopes that can be granted to personal access tokens.
+// Requests authenticated with a JWT session carry every scope.
+const (
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeAI            = "ai:use"
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+	ScopeAccountRead   = "account:read"
+	ScopeAccountWrite  = "account:write"
+)
+
+// AllScopes lists every grantable scope in a stable order
+var AllScopes = []string{
+	ScopeTasksRead,
+	ScopeTasksWrite,
+	ScopeProjectsRead,
+	ScopeProjectsWrite,
+	ScopeAI,
+	ScopeWebhooksRead,
+	ScopeWebhooksWrite,
+	ScopeAccountRead,
+	ScopeAccountWrite,
+}
+
+// IsValidScope reports whether a scope can be granted to a token
+func IsValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTokenAuth reports whether the request was authenticated with a personal access token
+func IsTokenAuth(c *fiber.Ctx) bool {
+	_, ok := c.Locals("tokenID").(uuid.UUID)
+	return ok
+}
+
+// GetScopes returns the scopes granted to the request's token,
+// or nil for JWT sessions (which are not scope-limited)
+func GetScopes(c *fiber.Ctx) []string {
+	scopes, _ := c.Locals("scopes").([]string)
+	return scopes
+}
+
+// HasScope reports whether the request may act with the given scope
+func HasScope(c *fiber.Ctx, scope string) bool {
+	if !IsTokenAuth(c) {
+		return true
+	}
+	for _, s := range GetScopes(c) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects token requests that lack any of the given scopes
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, scope := range scopes {
+			if !HasScope(c, scope) {
+				return httputil.Forbidden(c, "token is missing scope "+scope)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// ScopeByMethod requires the read scope for GET/HEAD requests and the
+// write scope for everything else
+func ScopeByMethod(read, write string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scope := write
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			scope = read
+		}
+		if !HasScope(c, scope) {
+			return httputil.Forbidden(c, "token is missing scope "+scope)
+		}
+		return c.Next()
+	}
+}
+
+// RequireSession rejects personal access tokens. Used for admin routes and
+// token management, which must never be reachable with a token.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if IsTokenAuth(c) {
+			return httputil.Forbidden(c, "not available to personal access tokens")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package projects
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
+)
+
+// publishProjectEvent queues an outgoing webhook event for every active member
+// of the project. Runs in the background so it never delays the response.
+func publishProjectEvent(db *pgxpool.Pool, projectID uuid.UUID, eventType string, data interface{}) {
+	go func() {
+		ctx := context.Background()
+
+		memberIDs, err := repository.ProjectMemberIDs(ctx, db, projectID)
+		if err != nil {
+			fmt.Printf("[Webhook] Failed to load members of project %s for %s: %v\n", projectID, eventType, err)
+			return
+		}
+
+		webhook.PublishAll(ctx, memberIDs, eventType, data)
+	}()
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/csaptu/flow/pkg/middleware"
 	"github.com/csaptu/flow/projects/models"
 	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
 )
 
 // ProjectHandler handles project endpoints
@@ -452,6 +453,15 @@ func (h *ProjectHandler) AddMember(c *fiber.Ctx) error {
 		return httputil.InternalError(c, "failed to add member")
 	}
 
+	publishProjectEvent(h.db, projectID, webhook.EventProjectMemberAdded, map[string]string{
+		"id":         id.String(),
+		"project_id": projectID.String(),
+		"user_id":    newMemberID.String(),
+		"role":       string(role),
+		"added_by":   userID.String(),
+		"joined_at":  now.Format(time.RFC3339),
+	})
+
 	return httputil.Created(c, map[string]string{
 		"id":      id.String(),
 		"message": "member added",
@@ -15,6 +15,7 @@ import (
 	"github.com/csaptu/flow/common/dto"
 	"github.com/csaptu/flow/pkg/config"
 	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/accesstoken"
 	"github.com/csaptu/flow/shared/repository"
 )
 
@@ -111,12 +112,13 @@ func (s *Server) registerRoutes() {
 
 	// All routes require authentication
 	v1.Use(middleware.Auth(middleware.AuthConfig{
-		JWTSecret: s.config.Auth.JWTSecret,
+		JWTSecret:      s.config.Auth.JWTSecret,
+		TokenValidator: accesstoken.Validate,
 	}))
 
 	// Project routes
 	projectHandler := NewProjectHandler(s.db)
-	projects := v1.Group("/projects")
+	projects := v1.Group("/projects", middleware.ScopeByMethod(middleware.ScopeProjectsRead, middleware.ScopeProjectsWrite))
 	projects.Post("", projectHandler.Create)
 	projects.Get("", projectHandler.List)
 	projects.Get("/:id", projectHandler.GetByID)
@@ -151,7 +153,7 @@ func (s *Server) registerRoutes() {
 	projects.Get("/:id/gantt", wbsHandler.GetGantt)
 
 	// "Assigned to Me" endpoint for Tasks app integration
-	v1.Get("/assigned-to-me", wbsHandler.AssignedToMe)
+	v1.Get("/assigned-to-me", middleware.RequireScope(middleware.ScopeProjectsRead), wbsHandler.AssignedToMe)
 }
 
 func (s *Server) healthCheck(c *fiber.Ctx) error {
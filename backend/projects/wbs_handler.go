@@ -12,6 +12,8 @@ import (
 	"github.com/csaptu/flow/pkg/httputil"
 	"github.com/csaptu/flow/pkg/middleware"
 	"github.com/csaptu/flow/projects/models"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
 )
 
 // WBSHandler handles WBS endpoints
@@ -91,44 +93,27 @@ func (h *WBSHandler) Create(c *fiber.Ctx) error {
 	}
 
 	// Handle parent
+	var parentID *uuid.UUID
 	if req.ParentID != nil {
-		parentID, err := uuid.Parse(*req.ParentID)
+		id, err := uuid.Parse(*req.ParentID)
 		if err != nil {
 			return httputil.BadRequest(c, "invalid parent_id")
 		}
+		parentID = &id
+	}
 
-		var parentPath string
-		var parentDepth, maxPosition int
-		err = h.db.QueryRow(c.Context(),
-			"SELECT path, depth FROM wbs_nodes WHERE id = $1 AND project_id = $2 AND deleted_at IS NULL",
-			parentID, projectID,
-		).Scan(&parentPath, &parentDepth)
-		if err == pgx.ErrNoRows {
-			return httputil.NotFound(c, "parent node")
-		}
-		if err != nil {
-			return httputil.InternalError(c, "database error")
-		}
-
-		// Get max position under parent
-		_ = h.db.QueryRow(c.Context(),
-			"SELECT COALESCE(MAX(position), 0) FROM wbs_nodes WHERE parent_id = $1 AND deleted_at IS NULL",
-			parentID,
-		).Scan(&maxPosition)
-
-		node.SetParent(parentID, parentPath, parentDepth)
-		node.Position = maxPosition + 1
-		node.Path = parentPath + "." + formatPosition(node.Position)
-	} else {
-		// Root node - get max position at root
-		var maxPosition int
-		_ = h.db.QueryRow(c.Context(),
-			"SELECT COALESCE(MAX(position), 0) FROM wbs_nodes WHERE project_id = $1 AND parent_id IS NULL AND deleted_at IS NULL",
-			projectID,
-		).Scan(&maxPosition)
-		node.Position = maxPosition + 1
-		node.Path = formatPosition(node.Position)
+	// Last position under the parent (or at the root)
+	place, err := repository.PlaceWBSNode(c.Context(), h.db, projectID, parentID)
+	if err == pgx.ErrNoRows {
+		return httputil.NotFound(c, "parent node")
 	}
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	node.ParentID = parentID
+	node.Depth = place.Depth
+	node.Path = place.Path
+	node.Position = place.Position
 
 	if req.AssigneeID != nil {
 		assigneeID, err := uuid.Parse(*req.AssigneeID)
@@ -361,7 +346,10 @@ func (h *WBSHandler) Update(c *fiber.Ctx) error {
 	}
 
 	node, hasChildren, _ := h.getNode(c.Context(), nodeID, projectID)
-	return httputil.Success(c, toWBSNodeResponse(node, hasChildren))
+	resp := toWBSNodeResponse(node, hasChildren)
+	publishProjectEvent(h.db, projectID, webhook.EventWBSNodeUpdated, resp)
+
+	return httputil.Success(c, resp)
 }
 
 // Delete deletes a WBS node
@@ -500,7 +488,10 @@ func (h *WBSHandler) UpdateProgress(c *fiber.Ctx) error {
 	}
 
 	node, hasChildren, _ := h.getNode(c.Context(), nodeID, projectID)
-	return httputil.Success(c, toWBSNodeResponse(node, hasChildren))
+	resp := toWBSNodeResponse(node, hasChildren)
+	publishProjectEvent(h.db, projectID, webhook.EventWBSNodeUpdated, resp)
+
+	return httputil.Success(c, resp)
 }
 
 // Dependencies
@@ -885,7 +876,3 @@ func toWBSNodeResponse(n *models.WBSNode, hasChildren bool) WBSNodeResponse {
 
 	return resp
 }
-
-func formatPosition(pos int) string {
-	return string(rune('0' + pos))
-}
@@ -0,0 +1,178 @@
+package accesstoken
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// maxExpiryDays caps how long a token may live when an expiry is given
+const maxExpiryDays = 365
+
+// Handler handles personal access token management.
+// These routes are session-only: a token can never mint or revoke tokens.
+type Handler struct{}
+
+// NewHandler creates a new access token handler
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// CreateRequest is the body for creating a token
+type CreateRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days,omitempty"` // omit for a non-expiring token
+}
+
+// TokenResponse represents a token in API responses.
+// Token holds the plaintext and is only set in the create response.
+type TokenResponse struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Token       string   `json:"token,omitempty"`
+	TokenPrefix string   `json:"token_prefix"`
+	Scopes      []string `json:"scopes"`
+	ExpiresAt   *string  `json:"expires_at,omitempty"`
+	LastUsedAt  *string  `json:"last_used_at,omitempty"`
+	RevokedAt   *string  `json:"revoked_at,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// ListScopes returns the scopes that can be granted
+// GET /auth/tokens/scopes
+func (h *Handler) ListScopes(c *fiber.Ctx) error {
+	return httputil.Success(c, middleware.AllScopes)
+}
+
+// Create issues a new personal access token
+// POST /auth/tokens
+func (h *Handler) Create(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req CreateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	errs := make(map[string]string)
+	if req.Name == "" || len(req.Name) > 100 {
+		errs["name"] = "required, max 100 characters"
+	}
+	if len(req.Scopes) == 0 {
+		errs["scopes"] = "at least one scope is required"
+	}
+	for _, scope := range req.Scopes {
+		if !middleware.IsValidScope(scope) {
+			errs["scopes"] = "unknown scope: " + scope
+			break
+		}
+	}
+	if req.ExpiresInDays != nil && (*req.ExpiresInDays < 1 || *req.ExpiresInDays > maxExpiryDays) {
+		errs["expires_in_days"] = "must be between 1 and 365"
+	}
+	if len(errs) > 0 {
+		return httputil.ValidationError(c, "validation failed", errs)
+	}
+
+	token, hash, err := Generate()
+	if err != nil {
+		return httputil.InternalError(c, "failed to generate token")
+	}
+
+	t := &repository.PersonalAccessToken{
+		UserID:      userID,
+		Name:        req.Name,
+		TokenPrefix: token[:displayPrefixLen],
+		Scopes:      req.Scopes,
+	}
+	if req.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		t.ExpiresAt = &expiresAt
+	}
+
+	if err := repository.CreatePersonalAccessToken(c.Context(), t, hash); err != nil {
+		return httputil.InternalError(c, "failed to create token")
+	}
+
+	resp := toTokenResponse(t)
+	resp.Token = token
+	return httputil.Created(c, resp)
+}
+
+// List returns the user's tokens (without plaintext)
+// GET /auth/tokens
+func (h *Handler) List(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tokens, err := repository.ListPersonalAccessTokens(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list tokens")
+	}
+
+	items := make([]TokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		items = append(items, toTokenResponse(t))
+	}
+
+	return httputil.Success(c, items)
+}
+
+// Revoke revokes a token immediately
+// DELETE /auth/tokens/:id
+func (h *Handler) Revoke(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tokenID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid token ID")
+	}
+
+	affected, err := repository.RevokePersonalAccessToken(c.Context(), tokenID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to revoke token")
+	}
+	if affected == 0 {
+		return httputil.NotFound(c, "token")
+	}
+
+	return httputil.NoContent(c)
+}
+
+func toTokenResponse(t *repository.PersonalAccessToken) TokenResponse {
+	resp := TokenResponse{
+		ID:          t.ID.String(),
+		Name:        t.Name,
+		TokenPrefix: t.TokenPrefix,
+		Scopes:      t.Scopes,
+		ExpiresAt:   formatTime(t.ExpiresAt),
+		LastUsedAt:  formatTime(t.LastUsedAt),
+		RevokedAt:   formatTime(t.RevokedAt),
+		CreatedAt:   t.CreatedAt.Format(time.RFC3339),
+	}
+	if resp.Scopes == nil {
+		resp.Scopes = []string{}
+	}
+	return resp
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
@@ -0,0 +1,58 @@
+// Package accesstoken manages personal access tokens: long-lived, scoped
+// credentials for scripts, CLIs and integrations that cannot run the JWT
+// refresh flow. All services accept them through middleware.Auth by setting
+// AuthConfig.TokenValidator to Validate.
+package accesstoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/csaptu/flow/common/errors"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// displayPrefixLen is how much of a token is kept in plaintext for display
+const displayPrefixLen = 16
+
+// Generate creates a new random token and returns it with its hash
+func Generate() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = middleware.PersonalTokenPrefix + hex.EncodeToString(b)
+	return token, Hash(token), nil
+}
+
+// Hash returns the SHA-256 hex digest under which a token is stored
+func Hash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Validate resolves a token to its owner and scopes and records its use.
+// It satisfies middleware.TokenValidator.
+func Validate(ctx context.Context, token string) (*middleware.TokenIdentity, error) {
+	t, err := repository.GetActivePersonalAccessToken(ctx, Hash(token))
+	if err != nil {
+		return nil, errors.ErrServiceUnavailable
+	}
+	if t == nil {
+		return nil, errors.ErrInvalidToken
+	}
+
+	if err := repository.TouchPersonalAccessToken(ctx, t.ID); err != nil {
+		fmt.Printf("[AccessToken] Failed to record usage of token %s: %v\n", t.ID, err)
+	}
+
+	return &middleware.TokenIdentity{
+		TokenID: t.ID,
+		UserID:  t.UserID,
+		Scopes:  t.Scopes,
+	}, nil
+}
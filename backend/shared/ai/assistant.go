@@ -0,0 +1,514 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+const (
+	// maxAssistantSteps bounds the model calls for one user message
+	maxAssistantSteps = 5
+	// assistantHistory is how many stored messages are sent back as context
+	assistantHistory = 40
+	assistantTimeout = 90 * time.Second
+)
+
+// pendingCall is a tool call waiting for the user's confirmation
+type pendingCall struct {
+	ID        string          `json:"id"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Summary   string          `json:"summary"`
+}
+
+// PendingAction is what the assistant wants to do once the user confirms
+type PendingAction struct {
+	Calls []pendingCall `json:"calls"`
+}
+
+// AssistantAction is a tool call the assistant made during a reply
+type AssistantAction struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Result    interface{}     `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// AssistantReply is the outcome of one assistant turn
+type AssistantReply struct {
+	ConversationID string            `json:"conversation_id"`
+	Reply          string            `json:"reply"`
+	Actions        []AssistantAction `json:"actions"`
+	PendingAction  *PendingAction    `json:"pending_action,omitempty"`
+	Truncated      bool              `json:"truncated"` // Stopped at the step limit
+}
+
+const assistantSystemPrompt = `You are the assistant inside Flow, a task manager. You help the user by searching, creating and changing their tasks and projects with the tools provided.
+
+Current time: %s (%s).
+
+Rules:
+- Use search_tasks to find task IDs; never invent IDs.
+- Changing or completing a task needs the user's confirmation, which the app asks for. Call the tool and say what you are about to do; don't ask for confirmation in text first.
+- Pass dates as YYYY-MM-DD, or as ISO 8601 with offset when a time is given.
+- Keep replies short and plain.`
+
+// toolResult is a tool call's outcome as stored and sent to the model
+func toolResult(result interface{}, err error) (string, AssistantAction) {
+	var action AssistantAction
+	if err != nil {
+		msg := "the action failed"
+		if te, ok := err.(toolError); ok {
+			msg = string(te)
+		} else {
+			fmt.Printf("[Assistant] Tool failed: %v\n", err)
+		}
+		action.Error = msg
+		b, _ := json.Marshal(map[string]string{"error": msg})
+		return string(b), action
+	}
+	action.Result = result
+	b, _ := json.Marshal(result)
+	return string(b), action
+}
+
+// saveToolResult stores a tool result for a call
+func saveToolResult(ctx context.Context, convID uuid.UUID, callID, tool, content string) error {
+	return repository.AddAssistantMessage(ctx, &repository.AssistantMessage{
+		ConversationID: convID,
+		Role:           "tool",
+		Content:        content,
+		ToolCallID:     &callID,
+		ToolName:       &tool,
+	})
+}
+
+// assistantEnv loads what tools need to know about the user
+func assistantEnv(ctx context.Context, userID uuid.UUID) toolEnv {
+	env := toolEnv{userID: userID, loc: time.UTC}
+	if tz, _ := repository.GetUserTimezone(ctx, userID); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			env.loc = loc
+		}
+	}
+	return env
+}
+
+// assistantMessages converts stored history to LLM messages, starting at a
+// user message so tool results are never cut off from their calls
+func assistantMessages(stored []repository.AssistantMessage) []llm.Message {
+	start := len(stored)
+	for i, m := range stored {
+		if m.Role == "user" {
+			start = i
+			break
+		}
+	}
+
+	msgs := make([]llm.Message, 0, len(stored)-start)
+	for _, m := range stored[start:] {
+		msg := llm.Message{Role: m.Role, Content: m.Content}
+		if len(m.ToolCalls) > 0 {
+			_ = json.Unmarshal(m.ToolCalls, &msg.ToolCalls)
+		}
+		if m.ToolCallID != nil {
+			msg.ToolCallID = *m.ToolCallID
+		}
+		if m.ToolName != nil {
+			msg.Name = *m.ToolName
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// runAssistant calls the model until it replies without calling tools,
+// asks for confirmation or runs out of steps
+func (h *Handler) runAssistant(ctx context.Context, env toolEnv, convID uuid.UUID, reply *AssistantReply) error {
+	stored, err := repository.GetAssistantMessages(ctx, convID, assistantHistory)
+	if err != nil {
+		return err
+	}
+	msgs := assistantMessages(stored)
+	now := time.Now().In(env.loc)
+	system := fmt.Sprintf(assistantSystemPrompt, now.Format("Monday, 2006-01-02 15:04 -07:00"), env.loc.String())
+
+	for step := 0; step < maxAssistantSteps; step++ {
+		resp, err := h.service.LLM().Complete(ctx, llm.CompletionRequest{
+			Messages:    msgs,
+			SystemMsg:   system,
+			Tools:       assistantToolDefs,
+			MaxTokens:   1000,
+			Temperature: 0.2,
+			Feature:     string(FeatureAssistant),
+			UserID:      env.userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		content := strings.TrimSpace(resp.Content)
+		assistantMsg := repository.AssistantMessage{ConversationID: convID, Role: "assistant", Content: content}
+		if len(resp.ToolCalls) > 0 {
+			assistantMsg.ToolCalls, _ = json.Marshal(resp.ToolCalls)
+		} else if content == "" {
+			content = "Done."
+			assistantMsg.Content = content
+		}
+		if err := repository.AddAssistantMessage(ctx, &assistantMsg); err != nil {
+			return err
+		}
+		msgs = append(msgs, llm.Message{Role: "assistant", Content: content, ToolCalls: resp.ToolCalls})
+		reply.Reply = content
+
+		if len(resp.ToolCalls) == 0 {
+			return nil
+		}
+
+		// Safe calls run now; calls that change existing data wait for the user
+		var pending PendingAction
+		for _, call := range resp.ToolCalls {
+			var result string
+			var action AssistantAction
+			tool := assistantTools[call.Name]
+			switch {
+			case tool == nil:
+				result, action = toolResult(nil, toolError("unknown tool "+call.Name))
+			case tool.confirm:
+				summary, err := tool.check(ctx, env, call.Parameters)
+				if err == nil {
+					pending.Calls = append(pending.Calls, pendingCall{
+						ID: call.ID, Tool: call.Name, Arguments: call.Parameters, Summary: summary,
+					})
+					continue
+				}
+				result, action = toolResult(nil, err)
+			default:
+				result, action = toolResult(tool.run(ctx, env, call.Parameters))
+			}
+
+			action.Tool, action.Arguments = call.Name, call.Parameters
+			reply.Actions = append(reply.Actions, action)
+			if err := saveToolResult(ctx, convID, call.ID, call.Name, result); err != nil {
+				return err
+			}
+			msgs = append(msgs, llm.Message{Role: "tool", Content: result, ToolCallID: call.ID, Name: call.Name})
+		}
+
+		if len(pending.Calls) > 0 {
+			raw, _ := json.Marshal(pending)
+			if err := repository.SetAssistantPendingAction(ctx, convID, raw); err != nil {
+				return err
+			}
+			reply.PendingAction = &pending
+			return nil
+		}
+	}
+
+	reply.Truncated = true
+	return nil
+}
+
+// resolvePending runs or declines the calls of a pending action and records
+// their results, so the model sees what happened
+func resolvePending(ctx context.Context, env toolEnv, convID uuid.UUID, raw []byte, approve bool, reply *AssistantReply) error {
+	var pending PendingAction
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		return err
+	}
+
+	for _, call := range pending.Calls {
+		var result string
+		var action AssistantAction
+		tool := assistantTools[call.Tool]
+		switch {
+		case tool == nil:
+			result, action = toolResult(nil, toolError("unknown tool "+call.Tool))
+		case approve:
+			result, action = toolResult(tool.run(ctx, env, call.Arguments))
+		default:
+			result, action = toolResult(nil, toolError("the user declined this action"))
+		}
+
+		action.Tool, action.Arguments = call.Tool, call.Arguments
+		reply.Actions = append(reply.Actions, action)
+		if err := saveToolResult(ctx, convID, call.ID, call.Tool, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendAssistantMessage sends a message to the assistant, starting a new
+// conversation unless conversation_id is given. A message sent while an
+// action awaits confirmation declines it.
+func (h *Handler) SendAssistantMessage(c *fiber.Ctx) error {
+	if !h.service.IsAvailable() {
+		return httputil.ServiceUnavailable(c, "AI service not available")
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req struct {
+		ConversationID string `json:"conversation_id"`
+		Message        string `json:"message"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		return httputil.ValidationError(c, "validation failed", map[string]string{"message": "required"})
+	}
+
+	var conv *repository.AssistantConversation
+	if req.ConversationID != "" {
+		convID, err := uuid.Parse(req.ConversationID)
+		if err != nil {
+			return httputil.BadRequest(c, "invalid conversation ID")
+		}
+		conv, err = repository.GetAssistantConversation(c.Context(), convID, userID)
+		if err != nil {
+			return httputil.InternalError(c, "failed to load conversation")
+		}
+		if conv == nil {
+			return httputil.NotFound(c, "conversation")
+		}
+	}
+
+	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureAssistant)
+	if !canUse {
+		return httputil.PaymentRequired(c, "Upgrade to Light tier for the AI assistant")
+	}
+
+	// The model call outlives a client disconnect so the history stays whole
+	ctx, cancel := context.WithTimeout(context.Background(), assistantTimeout)
+	defer cancel()
+	env := assistantEnv(ctx, userID)
+
+	if conv == nil {
+		title := req.Message
+		if r := []rune(title); len(r) > 80 {
+			title = string(r[:80])
+		}
+		if conv, err = repository.CreateAssistantConversation(ctx, userID, title); err != nil {
+			return httputil.InternalError(c, "failed to start conversation")
+		}
+	}
+
+	reply := &AssistantReply{ConversationID: conv.ID.String(), Actions: []AssistantAction{}}
+	raw, err := repository.TakeAssistantPendingAction(ctx, conv.ID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load conversation")
+	}
+	if raw != nil {
+		if err := resolvePending(ctx, env, conv.ID, raw, false, reply); err != nil {
+			return httputil.InternalError(c, "failed to decline pending action")
+		}
+	}
+
+	err = repository.AddAssistantMessage(ctx, &repository.AssistantMessage{
+		ConversationID: conv.ID,
+		Role:           "user",
+		Content:        req.Message,
+	})
+	if err != nil {
+		return httputil.InternalError(c, "failed to save message")
+	}
+
+	if err := h.runAssistant(ctx, env, conv.ID, reply); err != nil {
+		fmt.Printf("[Assistant] Conversation %s failed: %v\n", conv.ID, err)
+		return httputil.Error(c, llmFailure(err))
+	}
+	return httputil.Success(c, reply)
+}
+
+// ConfirmAssistantAction approves or declines the pending action with
+// {"approve": bool}, then lets the assistant continue
+func (h *Handler) ConfirmAssistantAction(c *fiber.Ctx) error {
+	if !h.service.IsAvailable() {
+		return httputil.ServiceUnavailable(c, "AI service not available")
+	}
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	convID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid conversation ID")
+	}
+
+	var req struct {
+		Approve bool `json:"approve"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	conv, err := repository.GetAssistantConversation(c.Context(), convID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load conversation")
+	}
+	if conv == nil {
+		return httputil.NotFound(c, "conversation")
+	}
+	if conv.PendingAction == nil {
+		return httputil.Conflict(c, "no action is waiting for confirmation")
+	}
+
+	// The assistant continues after the action, so a confirmation is a
+	// metered turn like a message
+	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureAssistant)
+	if !canUse {
+		return httputil.PaymentRequired(c, "Upgrade to Light tier for the AI assistant")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), assistantTimeout)
+	defer cancel()
+
+	raw, err := repository.TakeAssistantPendingAction(ctx, convID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load conversation")
+	}
+	if raw == nil {
+		return httputil.Conflict(c, "no action is waiting for confirmation")
+	}
+
+	env := assistantEnv(ctx, userID)
+	reply := &AssistantReply{ConversationID: convID.String(), Actions: []AssistantAction{}}
+	if err := resolvePending(ctx, env, convID, raw, req.Approve, reply); err != nil {
+		return httputil.InternalError(c, "failed to run action")
+	}
+
+	if err := h.runAssistant(ctx, env, convID, reply); err != nil {
+		fmt.Printf("[Assistant] Conversation %s failed: %v\n", convID, err)
+		return httputil.Error(c, llmFailure(err))
+	}
+	return httputil.Success(c, reply)
+}
+
+// ListAssistantConversations returns the user's conversations
+func (h *Handler) ListAssistantConversations(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	pagination := httputil.ParsePagination(c)
+	convs, total, err := repository.ListAssistantConversations(c.Context(), userID, pagination.PageSize, pagination.Offset())
+	if err != nil {
+		return httputil.InternalError(c, "failed to list conversations")
+	}
+
+	out := make([]map[string]interface{}, 0, len(convs))
+	for _, conv := range convs {
+		out = append(out, map[string]interface{}{
+			"id":                    conv.ID,
+			"title":                 conv.Title,
+			"awaiting_confirmation": conv.PendingAction != nil,
+			"created_at":            conv.CreatedAt,
+			"updated_at":            conv.UpdatedAt,
+		})
+	}
+	return httputil.SuccessWithMeta(c, out, httputil.BuildMeta(pagination.Page, pagination.PageSize, total))
+}
+
+// GetAssistantConversation returns a conversation's messages and any action
+// awaiting confirmation
+func (h *Handler) GetAssistantConversation(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	convID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid conversation ID")
+	}
+
+	conv, err := repository.GetAssistantConversation(c.Context(), convID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load conversation")
+	}
+	if conv == nil {
+		return httputil.NotFound(c, "conversation")
+	}
+
+	stored, err := repository.GetAssistantMessages(c.Context(), convID, 0)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load messages")
+	}
+
+	messages := make([]map[string]interface{}, 0, len(stored))
+	for _, m := range stored {
+		msg := map[string]interface{}{
+			"id":         m.ID,
+			"role":       m.Role,
+			"content":    m.Content,
+			"created_at": m.CreatedAt,
+		}
+		if len(m.ToolCalls) > 0 {
+			msg["tool_calls"] = json.RawMessage(m.ToolCalls)
+		}
+		if m.ToolCallID != nil {
+			msg["tool_call_id"] = *m.ToolCallID
+		}
+		if m.ToolName != nil {
+			msg["tool_name"] = *m.ToolName
+		}
+		messages = append(messages, msg)
+	}
+
+	var pending *PendingAction
+	if conv.PendingAction != nil {
+		pending = &PendingAction{}
+		_ = json.Unmarshal(conv.PendingAction, pending)
+	}
+
+	return httputil.Success(c, map[string]interface{}{
+		"id":             conv.ID,
+		"title":          conv.Title,
+		"messages":       messages,
+		"pending_action": pending,
+		"created_at":     conv.CreatedAt,
+		"updated_at":     conv.UpdatedAt,
+	})
+}
+
+// DeleteAssistantConversation deletes a conversation and its history
+func (h *Handler) DeleteAssistantConversation(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	convID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid conversation ID")
+	}
+
+	deleted, err := repository.DeleteAssistantConversation(c.Context(), convID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to delete conversation")
+	}
+	if !deleted {
+		return httputil.NotFound(c, "conversation")
+	}
+
+	return httputil.NoContent(c)
+}
@@ -0,0 +1,603 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
+)
+
+// assistantTool is a tool the assistant may call on the user's behalf
+type assistantTool struct {
+	def llm.Tool
+	// confirm marks tools that change existing data: they only run after
+	// the user approves the call
+	confirm bool
+	// check validates a call and describes it for the confirmation prompt;
+	// only needed when confirm is set
+	check func(ctx context.Context, env toolEnv, args json.RawMessage) (string, error)
+	run   func(ctx context.Context, env toolEnv, args json.RawMessage) (interface{}, error)
+}
+
+// toolEnv is what tools know about the caller
+type toolEnv struct {
+	userID uuid.UUID
+	loc    *time.Location
+}
+
+// toolError is an error the model should see and can act on (bad arguments,
+// unknown task); other errors are reported as a generic failure
+type toolError string
+
+func (e toolError) Error() string { return string(e) }
+
+// assistantTools is the assistant's tool set, by name
+var assistantTools = map[string]*assistantTool{}
+
+// assistantToolDefs lists the tool definitions in a stable order
+var assistantToolDefs []llm.Tool
+
+func registerTool(t *assistantTool) {
+	assistantTools[t.def.Name] = t
+	assistantToolDefs = append(assistantToolDefs, t.def)
+}
+
+func init() {
+	registerTool(&assistantTool{
+		def: llm.Tool{
+			Name:        "search_tasks",
+			Description: "Search the user's tasks. Returns up to `limit` tasks, soonest due first.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"query": {"type": "string", "description": "Text to match in the title or description"},
+					"status": {"type": "string", "enum": ["open", "completed", "all"], "description": "Default open"},
+					"tag": {"type": "string"},
+					"due_before": {"type": "string", "description": "ISO 8601 date or datetime"},
+					"limit": {"type": "integer", "description": "1-50, default 20"}
+				}
+			}`),
+		},
+		run: searchTasksTool,
+	})
+	registerTool(&assistantTool{
+		def: llm.Tool{
+			Name:        "create_task",
+			Description: "Create a new task for the user.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"title": {"type": "string"},
+					"description": {"type": "string"},
+					"due_at": {"type": "string", "description": "ISO 8601 date (YYYY-MM-DD) or datetime with offset"},
+					"priority": {"type": "integer", "description": "0 none, 1 low, 2 medium, 3 high, 4 urgent"},
+					"tags": {"type": "array", "items": {"type": "string"}}
+				},
+				"required": ["title"]
+			}`),
+		},
+		run: createTaskTool,
+	})
+	registerTool(&assistantTool{
+		def: llm.Tool{
+			Name:        "update_task",
+			Description: "Change a task's title, description, due date, priority or tags. Only the given fields change. The user must confirm.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"task_id": {"type": "string"},
+					"title": {"type": "string"},
+					"description": {"type": "string"},
+					"due_at": {"type": "string", "description": "ISO 8601 date or datetime; empty string clears it"},
+					"priority": {"type": "integer", "description": "0-4"},
+					"tags": {"type": "array", "items": {"type": "string"}, "description": "Replaces all tags"}
+				},
+				"required": ["task_id"]
+			}`),
+		},
+		confirm: true,
+		check:   checkUpdateTask,
+		run:     updateTaskTool,
+	})
+	registerTool(&assistantTool{
+		def: llm.Tool{
+			Name:        "complete_task",
+			Description: "Mark a task as completed. The user must confirm.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {"task_id": {"type": "string"}},
+				"required": ["task_id"]
+			}`),
+		},
+		confirm: true,
+		check:   checkCompleteTask,
+		run:     completeTaskTool,
+	})
+	registerTool(&assistantTool{
+		def: llm.Tool{
+			Name:        "list_projects",
+			Description: "List the projects the user is a member of, with progress.",
+			Parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+		},
+		run: listProjectsTool,
+	})
+	registerTool(&assistantTool{
+		def: llm.Tool{
+			Name:        "add_wbs_node",
+			Description: "Add a work item to a project's work breakdown structure, at the top level or under parent_id.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"project_id": {"type": "string"},
+					"parent_id": {"type": "string", "description": "Existing node to nest under"},
+					"title": {"type": "string"},
+					"description": {"type": "string"}
+				},
+				"required": ["project_id", "title"]
+			}`),
+		},
+		run: addWBSNodeTool,
+	})
+}
+
+// decodeArgs reads a call's arguments into v
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return toolError("invalid arguments: " + err.Error())
+	}
+	return nil
+}
+
+func parseToolID(s, field string) (uuid.UUID, error) {
+	id, err := uuid.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return uuid.Nil, toolError(field + " must be an ID returned by another tool")
+	}
+	return id, nil
+}
+
+// parseToolDue reads a date (due that day, no time) or a datetime
+func parseToolDue(s string, loc *time.Location) (*time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, true, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", strings.TrimSuffix(s, ":00"), loc); err == nil {
+		return &t, true, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return &t, false, nil
+	}
+	return nil, false, toolError("due date must be YYYY-MM-DD or an ISO 8601 datetime")
+}
+
+// taskSummary is how tools show a task to the model
+type taskSummary struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Status   string   `json:"status"`
+	Priority int      `json:"priority"`
+	DueAt    *string  `json:"due_at,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	ParentID *string  `json:"parent_id,omitempty"`
+}
+
+func summarizeTask(t *repository.Task, loc *time.Location) taskSummary {
+	s := taskSummary{
+		ID:       t.ID.String(),
+		Title:    t.GetDisplayTitle(),
+		Status:   t.Status,
+		Priority: t.Priority,
+		Tags:     t.Tags,
+	}
+	if t.DueAt != nil {
+		due := t.DueAt.In(loc).Format("2006-01-02")
+		if t.HasDueTime {
+			due = t.DueAt.In(loc).Format(time.RFC3339)
+		}
+		s.DueAt = &due
+	}
+	if t.ParentID != nil {
+		p := t.ParentID.String()
+		s.ParentID = &p
+	}
+	return s
+}
+
+// ownTask loads a task the user owns, as a tool error if there is none
+func ownTask(ctx context.Context, env toolEnv, taskID string) (*repository.Task, error) {
+	id, err := parseToolID(taskID, "task_id")
+	if err != nil {
+		return nil, err
+	}
+	task, _, err := repository.GetTaskByID(ctx, id, env.userID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, toolError("task not found")
+	}
+	return task, nil
+}
+
+func searchTasksTool(ctx context.Context, env toolEnv, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		Query     string `json:"query"`
+		Status    string `json:"status"`
+		Tag       string `json:"tag"`
+		DueBefore string `json:"due_before"`
+		Limit     int    `json:"limit"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+
+	filter := repository.TaskFilter{
+		Query:  strings.TrimSpace(in.Query),
+		Status: in.Status,
+		Tag:    strings.TrimPrefix(strings.TrimSpace(in.Tag), "#"),
+		Limit:  min(max(in.Limit, 1), 50),
+	}
+	if in.Limit == 0 {
+		filter.Limit = 20
+	}
+	if in.DueBefore != "" {
+		due, hasTime, err := parseToolDue(in.DueBefore, env.loc)
+		if err != nil {
+			return nil, err
+		}
+		if !hasTime {
+			end := due.AddDate(0, 0, 1) // The whole day
+			due = &end
+		}
+		filter.DueBy = due
+	}
+
+	tasks, err := repository.SearchTasks(ctx, env.userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]taskSummary, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, summarizeTask(t, env.loc))
+	}
+	return map[string]interface{}{"tasks": out}, nil
+}
+
+func createTaskTool(ctx context.Context, env toolEnv, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		Title       string   `json:"title"`
+		Description *string  `json:"description"`
+		DueAt       string   `json:"due_at"`
+		Priority    int      `json:"priority"`
+		Tags        []string `json:"tags"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return nil, toolError("title is required")
+	}
+	if in.Priority < 0 || in.Priority > 4 {
+		return nil, toolError("priority must be 0-4")
+	}
+
+	var dueAt *time.Time
+	var hasDueTime bool
+	if in.DueAt != "" {
+		var err error
+		if dueAt, hasDueTime, err = parseToolDue(in.DueAt, env.loc); err != nil {
+			return nil, err
+		}
+	}
+
+	taskID, err := repository.CreateTask(ctx, env.userID, in.Title, in.Description, dueAt, hasDueTime, in.Priority, cleanTags(in.Tags))
+	if err != nil {
+		return nil, err
+	}
+
+	// Auto-processing runs on the tasks service's job workers, as for tasks
+	// created there
+	if err := repository.EnqueueAIJob(ctx, repository.TasksDB(), env.userID, taskID, repository.AIJobSourceAssistant); err != nil {
+		fmt.Printf("[Assistant] Failed to queue AI processing of task %s: %v\n", taskID, err)
+	}
+	task := taskWritten(ctx, env, taskID, "created", nil, webhook.EventTaskCreated)
+	if task == nil {
+		return map[string]interface{}{"task": map[string]string{"id": taskID.String(), "title": in.Title}}, nil
+	}
+	return map[string]interface{}{"task": summarizeTask(task, env.loc)}, nil
+}
+
+// taskWritten does what the tasks service does after a change to a task:
+// records the activity (kept on shared tasks only) and publishes the webhook
+// events. Returns the task as it is now, or nil if it can't be loaded.
+func taskWritten(ctx context.Context, env toolEnv, taskID uuid.UUID, action string, changes []string, events ...string) *repository.Task {
+	if err := repository.RecordTaskActivity(ctx, repository.TasksDB(), taskID, env.userID, action, changes); err != nil {
+		fmt.Printf("[Assistant] Failed to record %s activity for task %s: %v\n", action, taskID, err)
+	}
+
+	task, childCount, err := repository.GetTaskByID(ctx, taskID, env.userID)
+	if err != nil || task == nil {
+		return nil
+	}
+	resp := toTaskResponse(task, childCount)
+	for _, event := range events {
+		publishTaskEvent(env.userID, event, resp)
+	}
+	return task
+}
+
+// updateTaskArgs are update_task's arguments; nil fields are left alone
+type updateTaskArgs struct {
+	TaskID      string    `json:"task_id"`
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	DueAt       *string   `json:"due_at"`
+	Priority    *int      `json:"priority"`
+	Tags        *[]string `json:"tags"`
+}
+
+// changed lists the fields the call changes, named as in task activity
+func (in updateTaskArgs) changed() []string {
+	var fields []string
+	if in.Title != nil {
+		fields = append(fields, "title")
+	}
+	if in.Description != nil {
+		fields = append(fields, "description")
+	}
+	if in.DueAt != nil {
+		fields = append(fields, "due_at")
+	}
+	if in.Priority != nil {
+		fields = append(fields, "priority")
+	}
+	if in.Tags != nil {
+		fields = append(fields, "tags")
+	}
+	return fields
+}
+
+// updates validates the arguments and returns the column changes
+func (in updateTaskArgs) updates(loc *time.Location) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if in.Title != nil {
+		title := strings.TrimSpace(*in.Title)
+		if title == "" {
+			return nil, toolError("title can't be empty")
+		}
+		updates["title"] = title
+		updates["ai_cleaned_title"] = nil // The new title replaces any cleaned one
+	}
+	if in.Description != nil {
+		updates["description"] = *in.Description
+		updates["ai_cleaned_description"] = nil
+	}
+	if in.DueAt != nil {
+		if *in.DueAt == "" {
+			updates["due_at"] = nil
+			updates["has_due_time"] = false
+		} else {
+			due, hasTime, err := parseToolDue(*in.DueAt, loc)
+			if err != nil {
+				return nil, err
+			}
+			updates["due_at"] = *due
+			updates["has_due_time"] = hasTime
+		}
+	}
+	if in.Priority != nil {
+		if *in.Priority < 0 || *in.Priority > 4 {
+			return nil, toolError("priority must be 0-4")
+		}
+		updates["priority"] = *in.Priority
+	}
+	if in.Tags != nil {
+		updates["tags"] = cleanTags(*in.Tags)
+	}
+	if len(updates) == 0 {
+		return nil, toolError("nothing to change")
+	}
+	return updates, nil
+}
+
+func checkUpdateTask(ctx context.Context, env toolEnv, args json.RawMessage) (string, error) {
+	var in updateTaskArgs
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	task, err := ownTask(ctx, env, in.TaskID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := in.updates(env.loc); err != nil {
+		return "", err
+	}
+
+	var changes []string
+	if in.Title != nil {
+		changes = append(changes, fmt.Sprintf("title to %q", strings.TrimSpace(*in.Title)))
+	}
+	if in.Description != nil {
+		changes = append(changes, "description")
+	}
+	if in.DueAt != nil {
+		if *in.DueAt == "" {
+			changes = append(changes, "remove due date")
+		} else {
+			changes = append(changes, "due date to "+*in.DueAt)
+		}
+	}
+	if in.Priority != nil {
+		changes = append(changes, fmt.Sprintf("priority to %d", *in.Priority))
+	}
+	if in.Tags != nil {
+		changes = append(changes, "tags to "+strings.Join(cleanTags(*in.Tags), ", "))
+	}
+	return fmt.Sprintf("Update %q: %s", task.GetDisplayTitle(), strings.Join(changes, "; ")), nil
+}
+
+func updateTaskTool(ctx context.Context, env toolEnv, args json.RawMessage) (interface{}, error) {
+	var in updateTaskArgs
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	task, err := ownTask(ctx, env, in.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := in.updates(env.loc)
+	if err != nil {
+		return nil, err
+	}
+
+	updates["last_modified_by"] = env.userID
+
+	// Retagging can take the task out of a shared list
+	var grants []repository.AccessGrant
+	db := repository.TasksDB()
+	if in.Tags != nil && db != nil {
+		if grants, err = repository.TaskShareGrants(ctx, db, task.ID); err != nil {
+			fmt.Printf("[Assistant] Failed to load access of task %s: %v\n", task.ID, err)
+		}
+	}
+
+	if err := repository.UpdateTaskAIFields(ctx, task.ID, env.userID, updates); err != nil {
+		return nil, err
+	}
+	if err := repository.RecordLostAccess(ctx, db, grants); err != nil {
+		fmt.Printf("[Assistant] Failed to record lost access to task %s: %v\n", task.ID, err)
+	}
+	task = taskWritten(ctx, env, task.ID, "updated", in.changed(), webhook.EventTaskUpdated)
+	if task == nil {
+		return map[string]bool{"updated": true}, nil
+	}
+	return map[string]interface{}{"task": summarizeTask(task, env.loc)}, nil
+}
+
+func checkCompleteTask(ctx context.Context, env toolEnv, args json.RawMessage) (string, error) {
+	var in struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	task, err := ownTask(ctx, env, in.TaskID)
+	if err != nil {
+		return "", err
+	}
+	if task.Status == "completed" {
+		return "", toolError("task is already completed")
+	}
+	return fmt.Sprintf("Complete %q", task.GetDisplayTitle()), nil
+}
+
+func completeTaskTool(ctx context.Context, env toolEnv, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	task, err := ownTask(ctx, env, in.TaskID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := repository.CompleteTask(ctx, task.ID, env.userID)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		taskWritten(ctx, env, task.ID, "completed", nil, webhook.EventTaskCompleted)
+	}
+	return map[string]interface{}{"task_id": task.ID.String(), "completed": true, "already_completed": !changed}, nil
+}
+
+func listProjectsTool(ctx context.Context, env toolEnv, _ json.RawMessage) (interface{}, error) {
+	projects, err := repository.ListUserProjects(ctx, env.userID, 50)
+	if err == repository.ErrProjectsDBNotInitialized {
+		return nil, toolError("projects are not available right now")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type projectSummary struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Role     string `json:"role"`
+		Progress int    `json:"progress"` // Percent of work items completed
+	}
+	out := make([]projectSummary, 0, len(projects))
+	for _, p := range projects {
+		progress := 0
+		if p.TotalNodes > 0 {
+			progress = p.CompletedNodes * 100 / p.TotalNodes
+		}
+		out = append(out, projectSummary{ID: p.ID.String(), Name: p.Name, Status: p.Status, Role: p.Role, Progress: progress})
+	}
+	return map[string]interface{}{"projects": out}, nil
+}
+
+func addWBSNodeTool(ctx context.Context, env toolEnv, args json.RawMessage) (interface{}, error) {
+	var in struct {
+		ProjectID   string  `json:"project_id"`
+		ParentID    string  `json:"parent_id"`
+		Title       string  `json:"title"`
+		Description *string `json:"description"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return nil, err
+	}
+	projectID, err := parseToolID(in.ProjectID, "project_id")
+	if err != nil {
+		return nil, err
+	}
+	var parentID *uuid.UUID
+	if in.ParentID != "" {
+		id, err := parseToolID(in.ParentID, "parent_id")
+		if err != nil {
+			return nil, err
+		}
+		parentID = &id
+	}
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return nil, toolError("title is required")
+	}
+
+	node, err := repository.CreateWBSNode(ctx, env.userID, projectID, parentID, in.Title, in.Description)
+	if err == repository.ErrProjectsDBNotInitialized {
+		return nil, toolError("projects are not available right now")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, toolError("project or parent node not found, or the user can't edit this project")
+	}
+	publishProjectEvent(projectID, webhook.EventWBSNodeUpdated, toWBSNodeResponse(node))
+	return map[string]interface{}{"node": map[string]interface{}{
+		"id": node.ID.String(), "project_id": node.ProjectID.String(), "title": node.Title, "path": node.Path,
+	}}, nil
+}
+
+// cleanTags trims tags and drops empty ones and leading #
+func cleanTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.TrimPrefix(strings.TrimSpace(tag), "#"); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
@@ -0,0 +1,324 @@
+package ai
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/pkg/email"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Draft delivery limits
+const (
+	maxDraftSendsPerHour   = 20 // Per user, emails and invites combined
+	maxDraftRecipients     = 20
+	defaultInviteDuration  = 30 * time.Minute
+	svixTimestampTolerance = 5 * time.Minute
+)
+
+// DraftSender delivers approved email drafts and calendar invites through
+// the email client, and records bounces reported by the provider
+type DraftSender struct {
+	email         *email.Client
+	redis         *redis.Client
+	webhookSecret string
+}
+
+// NewDraftSender creates a draft sender; sending is disabled without RESEND_API_KEY
+func NewDraftSender(cfg *config.Config, redisClient *redis.Client) *DraftSender {
+	var emailClient *email.Client
+	if cfg.Email.ResendAPIKey != "" {
+		emailClient = email.NewClient(cfg.Email.ResendAPIKey, cfg.Email.From)
+	}
+	return &DraftSender{
+		email:         emailClient,
+		redis:         redisClient,
+		webhookSecret: cfg.Email.ResendWebhookSecret,
+	}
+}
+
+// Enabled reports whether drafts can be sent
+func (s *DraftSender) Enabled() bool {
+	return s != nil && s.email != nil
+}
+
+// Allow counts a send against the user's hourly limit
+func (s *DraftSender) Allow(ctx context.Context, userID uuid.UUID) bool {
+	if s.redis == nil {
+		return true
+	}
+
+	key := fmt.Sprintf("draft_send_rate:%s", userID)
+	count, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return true // Don't block sending when Redis is down
+	}
+	if count == 1 {
+		s.redis.Expire(ctx, key, time.Hour)
+	}
+	return count <= maxDraftSendsPerHour
+}
+
+// Prepare builds the message for a draft. The user is the Reply-To (and the
+// invite organizer). Returns validation errors by field when the draft can't
+// be sent as is, e.g. a recipient without a known email address.
+func (s *DraftSender) Prepare(ctx context.Context, userID uuid.UUID, draft *repository.AIDraft) (*email.Email, map[string]string, error) {
+	var content DraftContent
+	if err := json.Unmarshal(draft.Content, &content); err != nil {
+		return nil, nil, fmt.Errorf("invalid draft content: %w", err)
+	}
+
+	user, err := repository.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		return nil, nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	fields := make(map[string]string)
+
+	switch draft.Type {
+	case "email":
+		to, unresolved := resolveRecipients(ctx, userID, splitRecipients(content.To))
+		if len(unresolved) > 0 {
+			fields["to"] = "no email address for: " + strings.Join(unresolved, ", ")
+		} else if len(to) == 0 {
+			fields["to"] = "at least one recipient is required"
+		} else if len(to) > maxDraftRecipients {
+			fields["to"] = fmt.Sprintf("max %d recipients", maxDraftRecipients)
+		}
+		if strings.TrimSpace(content.Subject) == "" {
+			fields["subject"] = "subject is required"
+		}
+		if strings.TrimSpace(content.Body) == "" {
+			fields["body"] = "body is required"
+		}
+		if len(fields) > 0 {
+			return nil, fields, nil
+		}
+
+		return &email.Email{
+			To:      to,
+			Subject: strings.TrimSpace(content.Subject),
+			Text:    content.Body,
+			HTML:    textToHTML(content.Body),
+			ReplyTo: user.Email,
+		}, nil, nil
+
+	case "calendar":
+		to, unresolved := resolveRecipients(ctx, userID, content.Attendees)
+		if len(unresolved) > 0 {
+			fields["attendees"] = "no email address for: " + strings.Join(unresolved, ", ")
+		} else if len(to) == 0 {
+			fields["attendees"] = "at least one attendee is required"
+		} else if len(to) > maxDraftRecipients {
+			fields["attendees"] = fmt.Sprintf("max %d attendees", maxDraftRecipients)
+		}
+		if strings.TrimSpace(content.Title) == "" {
+			fields["title"] = "title is required"
+		}
+		start, floating, err := parseDraftTime(content.StartTime)
+		if err != nil {
+			fields["start_time"] = "start time must be an ISO 8601 datetime"
+		}
+		end := start.Add(defaultInviteDuration)
+		if content.EndTime != "" {
+			if parsed, _, err := parseDraftTime(content.EndTime); err != nil {
+				fields["end_time"] = "end time must be an ISO 8601 datetime"
+			} else {
+				end = parsed
+			}
+		}
+		if _, ok := fields["start_time"]; !ok && !end.After(start) {
+			fields["end_time"] = "end time must be after the start time"
+		}
+		if len(fields) > 0 {
+			return nil, fields, nil
+		}
+
+		organizerName := ""
+		if user.Name != nil {
+			organizerName = *user.Name
+		}
+		invite := email.Invite{
+			UID:            draft.ID.String() + "@flowtasks.ai",
+			Summary:        strings.TrimSpace(content.Title),
+			Description:    content.Body,
+			Start:          start,
+			End:            end,
+			Floating:       floating,
+			OrganizerName:  organizerName,
+			OrganizerEmail: user.Email,
+			Attendees:      to,
+		}
+
+		when := start.Format("Mon Jan 2, 2006 15:04")
+		if !floating {
+			when = start.UTC().Format("Mon Jan 2, 2006 15:04") + " UTC"
+		}
+		text := fmt.Sprintf("%s\n%s\n", invite.Summary, when)
+		if content.Body != "" {
+			text += "\n" + content.Body + "\n"
+		}
+
+		return &email.Email{
+			To:      to,
+			Subject: "Invitation: " + invite.Summary + " @ " + when,
+			Text:    text,
+			HTML:    textToHTML(text),
+			ReplyTo: user.Email,
+			Attachments: []email.Attachment{{
+				Filename:    "invite.ics",
+				ContentType: email.ICSContentType,
+				Content:     invite.ICS(),
+			}},
+		}, nil, nil
+	}
+
+	return nil, map[string]string{"type": "only email and calendar drafts can be sent"}, nil
+}
+
+// Deliver sends a prepared message and returns the provider message ID
+func (s *DraftSender) Deliver(ctx context.Context, msg *email.Email) (string, error) {
+	return s.email.Send(ctx, *msg)
+}
+
+// EmailEvents records delivery events from Resend (signed with Svix);
+// a bounce marks the matching sent draft as bounced
+// POST /webhooks/email-events
+func (s *DraftSender) EmailEvents(c *fiber.Ctx) error {
+	if s == nil || s.webhookSecret == "" {
+		return httputil.NotFound(c, "webhook")
+	}
+
+	if !verifySvixSignature(s.webhookSecret, c.Get("svix-id"), c.Get("svix-timestamp"), c.Get("svix-signature"), c.Body()) {
+		return httputil.Unauthorized(c, "invalid signature")
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			EmailID string `json:"email_id"`
+			Bounce  struct {
+				Message string `json:"message"`
+				Type    string `json:"type"`
+			} `json:"bounce"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(c.Body(), &event); err != nil {
+		return httputil.BadRequest(c, "invalid event")
+	}
+
+	if event.Type == "email.bounced" && event.Data.EmailID != "" {
+		reason := event.Data.Bounce.Message
+		if reason == "" {
+			reason = "bounced"
+		}
+		if _, err := repository.MarkAIDraftBounced(c.Context(), event.Data.EmailID, reason); err != nil {
+			return httputil.InternalError(c, "database error")
+		}
+	}
+
+	return httputil.Success(c, map[string]bool{"received": true})
+}
+
+// resolveRecipients turns email addresses, or names of directory entities
+// with a saved email, into addresses. Returns the values it couldn't resolve.
+func resolveRecipients(ctx context.Context, userID uuid.UUID, values []string) (emails, unresolved []string) {
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		address := ""
+		if addr, err := mail.ParseAddress(value); err == nil {
+			address = addr.Address
+		} else if saved, err := repository.GetEntityEmail(ctx, userID, value); err == nil && saved != "" {
+			address = saved
+		}
+		if address == "" {
+			unresolved = append(unresolved, value)
+			continue
+		}
+
+		if !seen[strings.ToLower(address)] {
+			seen[strings.ToLower(address)] = true
+			emails = append(emails, address)
+		}
+	}
+	return emails, unresolved
+}
+
+// splitRecipients splits a "to" field holding one or more recipients
+func splitRecipients(to string) []string {
+	if addrs, err := mail.ParseAddressList(to); err == nil {
+		values := make([]string, len(addrs))
+		for i, a := range addrs {
+			values[i] = a.Address
+		}
+		return values
+	}
+	return strings.FieldsFunc(to, func(r rune) bool { return r == ',' || r == ';' })
+}
+
+// parseDraftTime parses the AI's ISO 8601 times; without a zone the time is
+// floating (the attendee's local time)
+func parseDraftTime(s string) (time.Time, bool, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid time %q", s)
+}
+
+func textToHTML(text string) string {
+	return "<p>" + strings.ReplaceAll(html.EscapeString(text), "\n", "<br>") + "</p>"
+}
+
+// verifySvixSignature checks a Svix webhook signature: base64 HMAC-SHA256 of
+// "id.timestamp.body" keyed with the whsec_ secret, one of several "v1,<sig>"
+func verifySvixSignature(secret, id, timestamp, signatures string, body []byte) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || id == "" {
+		return false
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > svixTimestampTolerance || age < -svixTimestampTolerance {
+		return false
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	for _, sig := range strings.Fields(signatures) {
+		version, value, ok := strings.Cut(sig, ",")
+		if ok && version == "v1" && hmac.Equal([]byte(value), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
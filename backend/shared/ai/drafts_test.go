@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func svixSign(key []byte, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySvixSignature(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	secret := "whsec_" + base64.StdEncoding.EncodeToString(key)
+	body := []byte(`{"type":"email.delivered"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	at := func(d time.Duration) string { return strconv.FormatInt(time.Now().Add(d).Unix(), 10) }
+	valid := svixSign(key, "msg_1", now, body)
+
+	tests := []struct {
+		name       string
+		secret     string
+		id         string
+		timestamp  string
+		signatures string
+		body       []byte
+		want       bool
+	}{
+		{"valid", secret, "msg_1", now, valid, body, true},
+		{"secret without prefix", strings.TrimPrefix(secret, "whsec_"), "msg_1", now, valid, body, true},
+		{"one of several signatures", secret, "msg_1", now, "v1,bm9wZQ== " + valid, body, true},
+		{"within tolerance", secret, "msg_1", at(-4 * time.Minute), svixSign(key, "msg_1", at(-4*time.Minute), body), body, true},
+		{"too old", secret, "msg_1", at(-6 * time.Minute), svixSign(key, "msg_1", at(-6*time.Minute), body), body, false},
+		{"too far ahead", secret, "msg_1", at(6 * time.Minute), svixSign(key, "msg_1", at(6*time.Minute), body), body, false},
+		{"tampered body", secret, "msg_1", now, valid, []byte(`{"type":"email.bounced"}`), false},
+		{"other message id", secret, "msg_2", now, valid, body, false},
+		{"wrong secret", "whsec_" + base64.StdEncoding.EncodeToString([]byte("another key")), "msg_1", now, valid, body, false},
+		{"wrong version", secret, "msg_1", now, "v2," + strings.TrimPrefix(valid, "v1,"), body, false},
+		{"missing id", secret, "", now, svixSign(key, "", now, body), body, false},
+		{"bad timestamp", secret, "msg_1", "yesterday", valid, body, false},
+		{"secret not base64", "whsec_!!!", "msg_1", now, valid, body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifySvixSignature(tt.secret, tt.id, tt.timestamp, tt.signatures, tt.body); got != tt.want {
+				t.Errorf("verifySvixSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRecipients(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"lan@example.com", []string{"lan@example.com"}},
+		{"Lan <lan@example.com>, nam@example.com", []string{"lan@example.com", "nam@example.com"}},
+		{`"Tran, Nam" <nam@example.com>`, []string{"nam@example.com"}},
+		{"Lan, Nam", []string{"Lan", "Nam"}},
+		{"lan@example.com; nam@example.com", []string{"lan@example.com", "nam@example.com"}},
+		{"Lan,,Nam;", []string{"Lan", "Nam"}},
+	}
+	for _, tt := range tests {
+		// resolveRecipients trims each value
+		var got []string
+		for _, v := range splitRecipients(tt.in) {
+			got = append(got, strings.TrimSpace(v))
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("splitRecipients(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDraftTime(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     time.Time
+		floating bool
+		wantErr  bool
+	}{
+		{"2026-03-10T09:00:00+07:00", time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC), false, false},
+		{"2026-03-10T02:00:00Z", time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC), false, false},
+		{"2026-03-10T09:00:00", time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), true, false},
+		{"2026-03-10T09:00", time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), true, false},
+		{" 2026-03-10 09:30 ", time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC), true, false},
+		{"2026-03-10", time.Time{}, false, true},
+		{"tomorrow at 9", time.Time{}, false, true},
+	}
+	for _, tt := range tests {
+		got, floating, err := parseDraftTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDraftTime(%q) err = %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) || floating != tt.floating {
+			t.Errorf("parseDraftTime(%q) = %v floating %v, want %v floating %v", tt.in, got, floating, tt.want, tt.floating)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
+)
+
+// WBSNodeResponse is a WBS node in webhook events, shaped like the projects
+// service's node responses
+type WBSNodeResponse struct {
+	ID          string  `json:"id"`
+	ProjectID   string  `json:"project_id"`
+	ParentID    *string `json:"parent_id,omitempty"`
+	Title       string  `json:"title"`
+	Description *string `json:"description,omitempty"`
+	Status      string  `json:"status"`
+	Priority    int     `json:"priority"`
+	Progress    float64 `json:"progress"`
+	Depth       int     `json:"depth"`
+	Path        string  `json:"path"`
+	Position    int     `json:"position"`
+	IsCritical  bool    `json:"is_critical"`
+	HasChildren bool    `json:"has_children"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+// toWBSNodeResponse describes a node just created (pending, no children)
+func toWBSNodeResponse(n *repository.WBSNode) WBSNodeResponse {
+	resp := WBSNodeResponse{
+		ID:          n.ID.String(),
+		ProjectID:   n.ProjectID.String(),
+		Title:       n.Title,
+		Description: n.Description,
+		Status:      "pending",
+		Depth:       n.Depth,
+		Path:        n.Path,
+		Position:    n.Position,
+		CreatedAt:   n.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   n.CreatedAt.Format(time.RFC3339),
+	}
+	if n.ParentID != nil {
+		p := n.ParentID.String()
+		resp.ParentID = &p
+	}
+	return resp
+}
+
+// publishTaskEvent queues an outgoing webhook event without delaying the response
+func publishTaskEvent(userID uuid.UUID, eventType string, task TaskResponse) {
+	go webhook.Publish(context.Background(), userID, eventType, task)
+}
+
+// publishProjectEvent queues an outgoing webhook event for every active member
+// of the project. Runs in the background so it never delays the response.
+func publishProjectEvent(projectID uuid.UUID, eventType string, data interface{}) {
+	db := repository.ProjectsDB()
+	if db == nil {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+
+		memberIDs, err := repository.ProjectMemberIDs(ctx, db, projectID)
+		if err != nil {
+			fmt.Printf("[Webhook] Failed to load members of project %s for %s: %v\n", projectID, eventType, err)
+			return
+		}
+
+		webhook.PublishAll(ctx, memberIDs, eventType, data)
+	}()
+}
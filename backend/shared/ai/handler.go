@@ -4,26 +4,35 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/csaptu/flow/common/errors"
 	"github.com/csaptu/flow/pkg/httputil"
 	"github.com/csaptu/flow/pkg/llm"
 	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/embeddings"
+	"github.com/csaptu/flow/shared/llmschema"
 	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
 )
 
 // Handler handles AI endpoints
 type Handler struct {
-	service *Service
+	service  *Service
+	drafts   *DraftSender
+	embedder *embeddings.Index
 }
 
 // NewHandler creates a new AI handler
-func NewHandler(llmClient *llm.MultiClient) *Handler {
+func NewHandler(llmClient *llm.MultiClient, drafts *DraftSender) *Handler {
 	return &Handler{
-		service: NewService(llmClient),
+		service:  NewService(llmClient),
+		drafts:   drafts,
+		embedder: embeddings.New(repository.TasksDB(), llmClient),
 	}
 }
 
@@ -110,60 +119,33 @@ func toTaskResponse(t *repository.Task, childCount int) TaskResponse {
 
 // AIDecompose breaks down a task into subtasks
 func (h *Handler) AIDecompose(c *fiber.Ctx) error {
-	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
-	}
-
-	userID, err := middleware.GetUserID(c)
-	if err != nil {
-		return httputil.Unauthorized(c, "")
-	}
-
-	taskID, err := uuid.Parse(c.Params("id"))
-	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
-	}
-
-	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
-	if err != nil {
-		return httputil.InternalError(c, "database error")
-	}
-	if task == nil {
-		return httputil.NotFound(c, "task")
-	}
-
-	if task.Depth > 0 {
-		return httputil.BadRequest(c, "subtasks cannot be further decomposed")
-	}
+	return h.runAI(c, h.decomposeCall)
+}
 
-	// Check feature access
-	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureDecompose)
-	if !canUse {
-		return httputil.PaymentRequired(c, "Upgrade to Light tier for task decomposition")
-	}
+// AIDecomposeStream is AIDecompose as server-sent events; each new subtask
+// title arrives as an item before the subtasks are created
+func (h *Handler) AIDecomposeStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.decomposeCall)
+}
 
-	// Get existing subtasks to include in prompt
-	existingSubtasks, err := repository.GetSubtasks(c.Context(), taskID, userID)
-	if err != nil {
-		existingSubtasks = nil // Continue without existing subtasks if error
+// decomposeRequest asks for 2-5 subtasks of a task, or for more besides the
+// existing ones. The answer is a JSON array of titles.
+func decomposeRequest(userID uuid.UUID, title, description string, existing []string) llm.CompletionRequest {
+	descPart := ""
+	if description != "" {
+		descPart = "Description: " + description
 	}
 
-	// Build prompt with existing subtasks context
 	var promptBuilder strings.Builder
-	if len(existingSubtasks) > 0 {
+	if len(existing) > 0 {
 		promptBuilder.WriteString(fmt.Sprintf(`Add 2-5 more actionable subtasks to this task.
 Task: %s
 %s
 
 Existing subtasks:
-`, task.Title, func() string {
-			if task.Description != nil {
-				return "Description: " + *task.Description
-			}
-			return ""
-		}()))
-		for _, st := range existingSubtasks {
-			promptBuilder.WriteString(fmt.Sprintf("- %s\n", st.Title))
+`, title, descPart))
+		for _, st := range existing {
+			promptBuilder.WriteString(fmt.Sprintf("- %s\n", st))
 		}
 		promptBuilder.WriteString(`
 Return ONLY a JSON array of NEW subtask titles (do not include existing ones), like:
@@ -184,86 +166,149 @@ Return ONLY a JSON array of subtask titles, like:
 Each subtask should be:
 - A single, concrete action
 - In logical order
-- Starting with an action verb`, task.Title, func() string {
-			if task.Description != nil {
-				return "Description: " + *task.Description
-			}
-			return ""
-		}()))
+- Starting with an action verb`, title, descPart))
 	}
 
-	resp, err := h.service.LLM().Complete(c.Context(), llm.CompletionRequest{
+	return llm.CompletionRequest{
 		Messages: []llm.Message{
 			{Role: "user", Content: promptBuilder.String()},
 		},
 		MaxTokens:   500,
 		Temperature: 0.3,
-	})
+		Feature:     string(FeatureDecompose),
+		UserID:      userID,
+		Schema:      llmschema.Subtasks(),
+	}
+}
+
+// SuggestSubtasks makes the decompose call without creating the subtasks
+func (s *Service) SuggestSubtasks(ctx context.Context, userID uuid.UUID, title, description string, existing []string) ([]string, *llm.CompletionResponse, error) {
+	resp, err := s.llm.Complete(ctx, decomposeRequest(userID, title, description, existing))
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return nil, nil, err
 	}
+	var titles []string
+	if err := json.Unmarshal([]byte(resp.Content), &titles); err != nil {
+		return nil, resp, fmt.Errorf("failed to parse AI response: %w", err)
+	}
+	return titles, resp, nil
+}
 
-	var subtaskTitles []string
-	content := strings.TrimSpace(resp.Content)
-	if strings.HasPrefix(content, "```") {
-		lines := strings.Split(content, "\n")
-		var jsonLines []string
-		inBlock := false
-		for _, line := range lines {
-			if strings.HasPrefix(line, "```") {
-				inBlock = !inBlock
-				continue
-			}
-			if inBlock {
-				jsonLines = append(jsonLines, line)
-			}
-		}
-		content = strings.Join(jsonLines, "\n")
+func (h *Handler) decomposeCall(c *fiber.Ctx) (*aiCall, error) {
+	if !h.service.IsAvailable() {
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
-	if err := json.Unmarshal([]byte(content), &subtaskTitles); err != nil {
-		return httputil.InternalError(c, "failed to parse AI response")
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return nil, httputil.Unauthorized(c, "")
 	}
 
-	// Create subtasks and collect the created ones
-	createdSubtasks := make([]TaskResponse, 0) // Initialize as empty slice, not nil
-	startOrder := len(existingSubtasks)        // Start ordering after existing subtasks
-	for i, title := range subtaskTitles {
-		title = strings.TrimSpace(title)
-		if title == "" {
-			continue
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, httputil.BadRequest(c, "invalid task ID")
+	}
+
+	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
+	if err != nil {
+		return nil, httputil.InternalError(c, "database error")
+	}
+	if task == nil {
+		return nil, httputil.NotFound(c, "task")
+	}
+
+	if task.Depth > 0 {
+		return nil, httputil.BadRequest(c, "subtasks cannot be further decomposed")
+	}
+
+	// Check feature access
+	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureDecompose)
+	if !canUse {
+		return nil, httputil.PaymentRequired(c, "Upgrade to Light tier for task decomposition")
+	}
+
+	// Get existing subtasks to include in prompt
+	existingSubtasks, err := repository.GetSubtasks(c.Context(), taskID, userID)
+	if err != nil {
+		existingSubtasks = nil // Continue without existing subtasks if error
+	}
+
+	titles := make([]string, len(existingSubtasks))
+	for i, st := range existingSubtasks {
+		titles[i] = st.Title
+	}
+	description := ""
+	if task.Description != nil {
+		description = *task.Description
+	}
+
+	call := &aiCall{request: decomposeRequest(userID, task.Title, description, titles)}
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
+		var subtaskTitles []string
+		if err := json.Unmarshal([]byte(content), &subtaskTitles); err != nil {
+			return nil, errors.Internal("failed to parse AI response")
 		}
-		subtaskID, err := repository.CreateSubtask(c.Context(), userID, taskID, title, startOrder+i)
-		if err == nil {
-			// Get the created subtask to return it
-			subtask, _, _ := repository.GetTaskByID(c.Context(), subtaskID, userID)
-			if subtask != nil {
-				createdSubtasks = append(createdSubtasks, toTaskResponse(subtask, 0))
+
+		// Create subtasks and collect the created ones
+		createdSubtasks := make([]TaskResponse, 0) // Initialize as empty slice, not nil
+		startOrder := len(existingSubtasks)        // Start ordering after existing subtasks
+		for i, title := range subtaskTitles {
+			title = strings.TrimSpace(title)
+			if title == "" {
+				continue
+			}
+			subtaskID, err := repository.CreateSubtask(ctx, userID, taskID, title, startOrder+i)
+			if err == nil {
+				// Get the created subtask to return it
+				subtask, _, _ := repository.GetTaskByID(ctx, subtaskID, userID)
+				if subtask != nil {
+					resp := toTaskResponse(subtask, 0)
+					createdSubtasks = append(createdSubtasks, resp)
+					publishTaskEvent(userID, webhook.EventTaskCreated, resp)
+				}
 			}
 		}
+
+		return map[string]interface{}{
+			"task":     toTaskResponse(task, childCount+len(createdSubtasks)),
+			"subtasks": createdSubtasks,
+		}, nil
 	}
+	return call, nil
+}
 
-	return httputil.Success(c, map[string]interface{}{
-		"task":     toTaskResponse(task, childCount+len(createdSubtasks)),
-		"subtasks": createdSubtasks,
-	})
+// cleanFeature is the usage feature a clean request counts as
+func cleanFeature(field string) string {
+	if field == "description" {
+		return string(FeatureCleanDescription)
+	}
+	return string(FeatureCleanTitle)
 }
 
 // AIClean cleans up a task title and/or description
 // Query param: field=title|description|both (default: both)
 func (h *Handler) AIClean(c *fiber.Ctx) error {
+	return h.runAI(c, h.cleanCall)
+}
+
+// AICleanStream is AIClean as server-sent events
+func (h *Handler) AICleanStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.cleanCall)
+}
+
+func (h *Handler) cleanCall(c *fiber.Ctx) (*aiCall, error) {
 	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return httputil.Unauthorized(c, "")
+		return nil, httputil.Unauthorized(c, "")
 	}
 
 	taskID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
+		return nil, httputil.BadRequest(c, "invalid task ID")
 	}
 
 	// Get which field to clean (title, description, or both)
@@ -271,10 +316,10 @@ func (h *Handler) AIClean(c *fiber.Ctx) error {
 
 	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "database error")
+		return nil, httputil.InternalError(c, "database error")
 	}
 	if task == nil {
-		return httputil.NotFound(c, "task")
+		return nil, httputil.NotFound(c, "task")
 	}
 
 	// Build prompt based on which field to clean
@@ -303,7 +348,7 @@ Set title_changed to false if no changes needed.`,
 
 	case "description":
 		if !hasDescription {
-			return httputil.BadRequest(c, "task has no description to clean")
+			return nil, httputil.BadRequest(c, "task has no description to clean")
 		}
 		prompt = fmt.Sprintf(`Fix spelling and grammar in this task description. Use simple words (a 10 year old should understand).
 
@@ -366,107 +411,94 @@ Set title_changed to false if no changes needed.`,
 		}
 	}
 
-	resp, err := h.service.LLM().Complete(c.Context(), llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
+	call := &aiCall{
+		request: llm.CompletionRequest{
+			Messages: []llm.Message{
+				{Role: "user", Content: prompt},
+			},
+			MaxTokens:   500,
+			Temperature: 0.1, // Lower temperature for more consistent output
+			Feature:     cleanFeature(field),
+			UserID:      userID,
+			Schema:      llmschema.Clean(),
 		},
-		MaxTokens:   500,
-		Temperature: 0.1, // Lower temperature for more consistent output
-	})
-	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
 	}
-
-	// Try to parse JSON, handle potential formatting issues
-	content := strings.TrimSpace(resp.Content)
-	// Remove markdown code blocks if present
-	if strings.HasPrefix(content, "```") {
-		lines := strings.Split(content, "\n")
-		var jsonLines []string
-		inBlock := false
-		for _, line := range lines {
-			if strings.HasPrefix(line, "```") {
-				inBlock = !inBlock
-				continue
-			}
-			if inBlock {
-				jsonLines = append(jsonLines, line)
-			}
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
+		var cleaned struct {
+			Title              string `json:"title"`
+			TitleChanged       bool   `json:"title_changed"`
+			Description        string `json:"description"`
+			DescriptionChanged bool   `json:"description_changed"`
+			Changed            bool   `json:"changed"` // Legacy field for backwards compatibility
+		}
+		if err := json.Unmarshal([]byte(content), &cleaned); err != nil {
+			// If JSON parsing fails, just keep the original
+			return toTaskResponse(task, childCount), nil
 		}
-		content = strings.Join(jsonLines, "\n")
-	}
-
-	var cleaned struct {
-		Title              string `json:"title"`
-		TitleChanged       bool   `json:"title_changed"`
-		Description        string `json:"description"`
-		DescriptionChanged bool   `json:"description_changed"`
-		Changed            bool   `json:"changed"` // Legacy field for backwards compatibility
-	}
-	if err := json.Unmarshal([]byte(content), &cleaned); err != nil {
-		// If JSON parsing fails, just keep the original
-		return httputil.Success(c, toTaskResponse(task, childCount))
-	}
-
-	// Handle legacy "changed" field (for backwards compatibility with title-only clean)
-	if cleaned.Changed && !cleaned.TitleChanged {
-		cleaned.TitleChanged = cleaned.Changed
-	}
 
-	// Only update if AI actually changed something meaningful
-	updates := map[string]interface{}{}
+		// Handle legacy "changed" field (for backwards compatibility with title-only clean)
+		if cleaned.Changed && !cleaned.TitleChanged {
+			cleaned.TitleChanged = cleaned.Changed
+		}
 
-	// Validate title change - reject if too different (AI might be hallucinating)
-	// Store AI cleaned version in ai_cleaned_title, don't modify original title
-	if cleaned.TitleChanged && cleaned.Title != "" && cleaned.Title != task.Title {
-		// Post-process: remove trailing period (not suitable for todo list titles)
-		cleanedTitle := strings.TrimSuffix(cleaned.Title, ".")
+		// Only update if AI actually changed something meaningful
+		updates := map[string]interface{}{}
 
-		// Basic sanity check: new title shouldn't be wildly different in length
-		lenDiff := len(cleanedTitle) - len(task.Title)
-		if lenDiff < 0 {
-			lenDiff = -lenDiff
-		}
-		// Allow change if length difference is reasonable (not more than 2x or adding 50+ chars)
-		if lenDiff < len(task.Title) && lenDiff < 50 {
-			// Store cleaned version in ai_cleaned_title (original title remains unchanged)
-			updates["ai_cleaned_title"] = cleanedTitle
-		}
-	}
+		// Validate title change - reject if too different (AI might be hallucinating)
+		// Store AI cleaned version in ai_cleaned_title, don't modify original title
+		if cleaned.TitleChanged && cleaned.Title != "" && cleaned.Title != task.Title {
+			// Post-process: remove trailing period (not suitable for todo list titles)
+			cleanedTitle := strings.TrimSuffix(cleaned.Title, ".")
 
-	// Validate description change
-	// Store AI cleaned version in ai_cleaned_description, don't modify original description
-	if cleaned.DescriptionChanged && cleaned.Description != "" {
-		currentDesc := ""
-		if task.Description != nil {
-			currentDesc = *task.Description
-		}
-		if cleaned.Description != currentDesc {
-			// Basic sanity check for description too
-			lenDiff := len(cleaned.Description) - len(currentDesc)
+			// Basic sanity check: new title shouldn't be wildly different in length
+			lenDiff := len(cleanedTitle) - len(task.Title)
 			if lenDiff < 0 {
 				lenDiff = -lenDiff
 			}
-			// Allow change if length difference is reasonable
-			if lenDiff < len(currentDesc)+50 && lenDiff < 200 {
-				// Store cleaned version in ai_cleaned_description (original description remains unchanged)
-				updates["ai_cleaned_description"] = cleaned.Description
+			// Allow change if length difference is reasonable (not more than 2x or adding 50+ chars)
+			if lenDiff < len(task.Title) && lenDiff < 50 {
+				// Store cleaned version in ai_cleaned_title (original title remains unchanged)
+				updates["ai_cleaned_title"] = cleanedTitle
 			}
 		}
-	}
 
-	// Only update DB if there are changes
-	if len(updates) == 0 {
-		return httputil.Success(c, toTaskResponse(task, childCount))
-	}
+		// Validate description change
+		// Store AI cleaned version in ai_cleaned_description, don't modify original description
+		if cleaned.DescriptionChanged && cleaned.Description != "" {
+			currentDesc := ""
+			if task.Description != nil {
+				currentDesc = *task.Description
+			}
+			if cleaned.Description != currentDesc {
+				// Basic sanity check for description too
+				lenDiff := len(cleaned.Description) - len(currentDesc)
+				if lenDiff < 0 {
+					lenDiff = -lenDiff
+				}
+				// Allow change if length difference is reasonable
+				if lenDiff < len(currentDesc)+50 && lenDiff < 200 {
+					// Store cleaned version in ai_cleaned_description (original description remains unchanged)
+					updates["ai_cleaned_description"] = cleaned.Description
+				}
+			}
+		}
 
-	if err := repository.UpdateTaskAIFields(c.Context(), taskID, userID, updates); err != nil {
-		return httputil.InternalError(c, "failed to update task")
-	}
+		// Only update DB if there are changes
+		if len(updates) == 0 {
+			return toTaskResponse(task, childCount), nil
+		}
 
-	// Refresh task data
-	task, childCount, _ = repository.GetTaskByID(c.Context(), taskID, userID)
-	return httputil.Success(c, toTaskResponse(task, childCount))
+		if err := repository.UpdateTaskAIFields(ctx, taskID, userID, updates); err != nil {
+			return nil, errors.Internal("failed to update task")
+		}
+
+		// Refresh task data
+		task, childCount, _ = repository.GetTaskByID(ctx, taskID, userID)
+		resp := toTaskResponse(task, childCount)
+		publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+		return resp, nil
+	}
+	return call, nil
 }
 
 // AIRevert reverts AI-cleaned title and/or description back to the original human-written version
@@ -517,38 +549,56 @@ func (h *Handler) AIRevert(c *fiber.Ctx) error {
 		return httputil.InternalError(c, "failed to revert task")
 	}
 
+	// Count the revert against the prompt version that made the changes
+	if version, err := repository.GetTaskAIPromptVersion(c.Context(), taskID, userID); err == nil && version != nil {
+		if err := repository.RecordAIPromptOutcome(c.Context(), *version, userID, repository.PromptOutcomeReverted); err != nil {
+			fmt.Printf("[AI] Failed to record revert outcome: %v\n", err)
+		}
+	}
+
 	// Refresh task data
 	task, childCount, _ = repository.GetTaskByID(c.Context(), taskID, userID)
-	return httputil.Success(c, toTaskResponse(task, childCount))
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+	return httputil.Success(c, resp)
 }
 
 // AIRate rates the complexity of a task
 func (h *Handler) AIRate(c *fiber.Ctx) error {
+	return h.runAI(c, h.rateCall)
+}
+
+// AIRateStream is AIRate as server-sent events
+func (h *Handler) AIRateStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.rateCall)
+}
+
+func (h *Handler) rateCall(c *fiber.Ctx) (*aiCall, error) {
 	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return httputil.Unauthorized(c, "")
+		return nil, httputil.Unauthorized(c, "")
 	}
 
 	taskID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
+		return nil, httputil.BadRequest(c, "invalid task ID")
 	}
 
 	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "database error")
+		return nil, httputil.InternalError(c, "database error")
 	}
 	if task == nil {
-		return httputil.NotFound(c, "task")
+		return nil, httputil.NotFound(c, "task")
 	}
 
 	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureComplexity)
 	if !canUse {
-		return httputil.PaymentRequired(c, "Upgrade to Light tier for complexity rating")
+		return nil, httputil.PaymentRequired(c, "Upgrade to Light tier for complexity rating")
 	}
 
 	prompt := fmt.Sprintf(`Rate the complexity of this task on a scale of 1-10.
@@ -572,67 +622,86 @@ Return ONLY a JSON object:
 			return ""
 		}())
 
-	resp, err := h.service.LLM().Complete(c.Context(), llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
+	call := &aiCall{
+		request: llm.CompletionRequest{
+			Messages: []llm.Message{
+				{Role: "user", Content: prompt},
+			},
+			MaxTokens:   100,
+			Temperature: 0.3,
+			Feature:     string(FeatureComplexity),
+			UserID:      userID,
+			Schema:      llmschema.Rating(),
 		},
-		MaxTokens:   100,
-		Temperature: 0.3,
-	})
-	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		userID:  userID,
+		metered: FeatureComplexity,
 	}
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
 
-	var rated struct {
-		Complexity int    `json:"complexity"`
-		Reason     string `json:"reason"`
-	}
-	if err := json.Unmarshal([]byte(resp.Content), &rated); err != nil {
-		return httputil.InternalError(c, "failed to parse AI response")
-	}
+		var rated struct {
+			Complexity int    `json:"complexity"`
+			Reason     string `json:"reason"`
+		}
+		if err := json.Unmarshal([]byte(content), &rated); err != nil {
+			return nil, errors.Internal("failed to parse AI response")
+		}
 
-	updates := map[string]interface{}{
-		"complexity": rated.Complexity,
-	}
-	if err := repository.UpdateTaskAIFields(c.Context(), taskID, userID, updates); err != nil {
-		return httputil.InternalError(c, "failed to update task")
-	}
+		updates := map[string]interface{}{
+			"complexity": rated.Complexity,
+		}
+		if err := repository.UpdateTaskAIFields(ctx, taskID, userID, updates); err != nil {
+			return nil, errors.Internal("failed to update task")
+		}
 
-	task, childCount, _ = repository.GetTaskByID(c.Context(), taskID, userID)
-	return httputil.Success(c, map[string]interface{}{
-		"task":       toTaskResponse(task, childCount),
-		"complexity": rated.Complexity,
-		"reason":     rated.Reason,
-	})
+		task, childCount, _ = repository.GetTaskByID(ctx, taskID, userID)
+		resp := toTaskResponse(task, childCount)
+		publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+		return map[string]interface{}{
+			"task":       resp,
+			"complexity": rated.Complexity,
+			"reason":     rated.Reason,
+		}, nil
+	}
+	return call, nil
 }
 
 // AIExtract extracts entities from a task
 func (h *Handler) AIExtract(c *fiber.Ctx) error {
+	return h.runAI(c, h.extractCall)
+}
+
+// AIExtractStream is AIExtract as server-sent events; each entity arrives as an
+// item under the "entities" key
+func (h *Handler) AIExtractStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.extractCall)
+}
+
+func (h *Handler) extractCall(c *fiber.Ctx) (*aiCall, error) {
 	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return httputil.Unauthorized(c, "")
+		return nil, httputil.Unauthorized(c, "")
 	}
 
 	taskID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
+		return nil, httputil.BadRequest(c, "invalid task ID")
 	}
 
 	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "database error")
+		return nil, httputil.InternalError(c, "database error")
 	}
 	if task == nil {
-		return httputil.NotFound(c, "task")
+		return nil, httputil.NotFound(c, "task")
 	}
 
 	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureEntityExtraction)
 	if !canUse {
-		return httputil.PaymentRequired(c, "Upgrade to Light tier for entity extraction")
+		return nil, httputil.PaymentRequired(c, "Upgrade to Light tier for entity extraction")
 	}
 
 	prompt := fmt.Sprintf(`Extract key entities from this task.
@@ -660,88 +729,77 @@ Only include entities that are actually present. Leave array empty if none found
 			return ""
 		}())
 
-	// Create a context with longer timeout for AI operations
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	resp, err := h.service.LLM().Complete(ctx, llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
+	call := &aiCall{
+		request: llm.CompletionRequest{
+			Messages: []llm.Message{
+				{Role: "user", Content: prompt},
+			},
+			MaxTokens:   300,
+			Temperature: 0.2,
+			Feature:     string(FeatureEntityExtraction),
+			UserID:      userID,
+			Schema:      llmschema.Entities(),
 		},
-		MaxTokens:   300,
-		Temperature: 0.2,
-	})
-	if err != nil {
+		userID:  userID,
+		metered: FeatureEntityExtraction,
+		// Longer timeout for AI operations, independent of the request
+		timeout: 30 * time.Second,
 		// Return empty entities on AI error instead of failing
-		return httputil.Success(c, map[string]interface{}{
-			"task":     toTaskResponse(task, childCount),
-			"entities": []Entity{},
-			"error":    "AI service temporarily unavailable",
-		})
-	}
-
-	var extracted struct {
-		Entities []Entity `json:"entities"`
-	}
-
-	// Try to parse JSON, handle potential formatting issues
-	content := strings.TrimSpace(resp.Content)
-	// Remove markdown code blocks if present
-	if strings.HasPrefix(content, "```") {
-		lines := strings.Split(content, "\n")
-		var jsonLines []string
-		inBlock := false
-		for _, line := range lines {
-			if strings.HasPrefix(line, "```") {
-				inBlock = !inBlock
-				continue
+		fallback: func() interface{} {
+			return map[string]interface{}{
+				"task":     toTaskResponse(task, childCount),
+				"entities": []Entity{},
+				"error":    "AI service temporarily unavailable",
 			}
-			if inBlock {
-				jsonLines = append(jsonLines, line)
-			}
-		}
-		content = strings.Join(jsonLines, "\n")
+		},
 	}
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
+		var extracted struct {
+			Entities []Entity `json:"entities"`
+		}
+		if err := json.Unmarshal([]byte(content), &extracted); err != nil {
+			// Return empty entities on parse error instead of failing
+			return map[string]interface{}{
+				"task":     toTaskResponse(task, childCount),
+				"entities": []Entity{},
+			}, nil
+		}
 
-	if err := json.Unmarshal([]byte(content), &extracted); err != nil {
-		// Return empty entities on parse error instead of failing
-		return httputil.Success(c, map[string]interface{}{
-			"task":     toTaskResponse(task, childCount),
-			"entities": []Entity{},
-		})
-	}
+		// If no entities found, return success with empty array
+		if len(extracted.Entities) == 0 {
+			return map[string]interface{}{
+				"task":     toTaskResponse(task, childCount),
+				"entities": []Entity{},
+			}, nil
+		}
 
-	// If no entities found, return success with empty array
-	if len(extracted.Entities) == 0 {
-		return httputil.Success(c, map[string]interface{}{
-			"task":     toTaskResponse(task, childCount),
-			"entities": []Entity{},
-		})
-	}
+		// Normalize entities: check if similar entities already exist for this user
+		// Use a separate context with timeout for normalization
+		normCtx, normCancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer normCancel()
+		normalizedEntities := h.normalizeEntities(normCtx, userID, extracted.Entities)
 
-	// Normalize entities: check if similar entities already exist for this user
-	// Use a separate context with timeout for normalization
-	normCtx, normCancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer normCancel()
-	normalizedEntities := h.normalizeEntities(normCtx, userID, extracted.Entities)
+		entitiesJSON, _ := json.Marshal(normalizedEntities)
+		updates := map[string]interface{}{
+			"ai_entities": entitiesJSON,
+		}
+		if err := repository.UpdateTaskAIFields(ctx, taskID, userID, updates); err != nil {
+			// Still return the entities even if DB update fails
+			return map[string]interface{}{
+				"task":     toTaskResponse(task, childCount),
+				"entities": normalizedEntities,
+			}, nil
+		}
 
-	entitiesJSON, _ := json.Marshal(normalizedEntities)
-	updates := map[string]interface{}{
-		"ai_entities": entitiesJSON,
-	}
-	if err := repository.UpdateTaskAIFields(c.Context(), taskID, userID, updates); err != nil {
-		// Still return the entities even if DB update fails
-		return httputil.Success(c, map[string]interface{}{
-			"task":     toTaskResponse(task, childCount),
+		task, childCount, _ = repository.GetTaskByID(ctx, taskID, userID)
+		resp := toTaskResponse(task, childCount)
+		publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+		return map[string]interface{}{
+			"task":     resp,
 			"entities": normalizedEntities,
-		})
+		}, nil
 	}
-
-	task, childCount, _ = repository.GetTaskByID(c.Context(), taskID, userID)
-	return httputil.Success(c, map[string]interface{}{
-		"task":     toTaskResponse(task, childCount),
-		"entities": normalizedEntities,
-	})
+	return call, nil
 }
 
 // normalizeEntities checks each entity against existing entities and uses canonical names
@@ -773,7 +831,7 @@ func (h *Handler) normalizeEntities(ctx context.Context, userID uuid.UUID, entit
 		}
 
 		// Check if this entity matches any existing one
-		match := h.findMatchingEntity(ctx, entity.Value, existing)
+		match := h.findMatchingEntity(ctx, userID, entity.Value, existing)
 		if match != "" {
 			entity.Value = match // Use canonical name
 		}
@@ -784,7 +842,7 @@ func (h *Handler) normalizeEntities(ctx context.Context, userID uuid.UUID, entit
 }
 
 // findMatchingEntity uses LLM to check if a new entity value matches any existing values
-func (h *Handler) findMatchingEntity(ctx context.Context, newValue string, existingValues []string) string {
+func (h *Handler) findMatchingEntity(ctx context.Context, userID uuid.UUID, newValue string, existingValues []string) string {
 	// Quick check: exact match (case insensitive)
 	for _, existing := range existingValues {
 		if strings.EqualFold(newValue, existing) {
@@ -792,10 +850,10 @@ func (h *Handler) findMatchingEntity(ctx context.Context, newValue string, exist
 		}
 	}
 
-	// If only a few existing values, ask LLM to check for similar names
-	// Limit to 20 existing values to keep prompt reasonable
-	if len(existingValues) > 20 {
-		existingValues = existingValues[:20]
+	// Limit to 20 existing values to keep prompt reasonable: the 20 nearest
+	// by embedding when they can be had, otherwise the first 20
+	if len(existingValues) > entityMatchCandidates {
+		existingValues = h.nearestValues(ctx, userID, newValue, existingValues)
 	}
 
 	prompt := fmt.Sprintf(`Is "%s" the same as any of these? %v
@@ -811,6 +869,8 @@ Examples: "hanoi" = "Ha Noi", "hcmc" = "Ho Chi Minh City", "NYC" = "New York Cit
 		},
 		MaxTokens:   50,
 		Temperature: 0.1,
+		Feature:     "entity_match",
+		UserID:      userID,
 	})
 	if err != nil {
 		return "" // On error, don't normalize
@@ -833,11 +893,36 @@ Examples: "hanoi" = "Ha Noi", "hcmc" = "Ho Chi Minh City", "NYC" = "New York Cit
 	return ""
 }
 
-// GetAggregatedEntities returns all extracted entities grouped by type with task counts.
-// Used for the Smart Lists sidebar feature.
-func (h *Handler) GetAggregatedEntities(c *fiber.Ctx) error {
-	userID, err := middleware.GetUserID(c)
-	if err != nil {
+// entityMatchCandidates is how many existing values the entity matcher
+// shows the LLM
+const entityMatchCandidates = 20
+
+// nearestValues returns the entityMatchCandidates values closest in meaning
+// to value, or the first ones if embeddings aren't available
+func (h *Handler) nearestValues(ctx context.Context, userID uuid.UUID, value string, values []string) []string {
+	if !h.embedder.Available() {
+		return values[:entityMatchCandidates]
+	}
+	vectors, err := h.embedder.Embed(ctx, userID, "entity_match", append([]string{value}, values...))
+	if err != nil {
+		return values[:entityMatchCandidates]
+	}
+
+	ranked := make([]string, len(values))
+	copy(ranked, values)
+	scores := make(map[string]float64, len(values))
+	for i, v := range values {
+		scores[v] = llm.Cosine(vectors[0], vectors[i+1])
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i]] > scores[ranked[j]] })
+	return ranked[:entityMatchCandidates]
+}
+
+// GetAggregatedEntities returns all extracted entities grouped by type with task counts.
+// Used for the Smart Lists sidebar feature.
+func (h *Handler) GetAggregatedEntities(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
 		return httputil.Unauthorized(c, "")
 	}
 
@@ -863,31 +948,40 @@ func (h *Handler) GetAggregatedEntities(c *fiber.Ctx) error {
 
 // AIRemind suggests a reminder time for a task
 func (h *Handler) AIRemind(c *fiber.Ctx) error {
+	return h.runAI(c, h.remindCall)
+}
+
+// AIRemindStream is AIRemind as server-sent events
+func (h *Handler) AIRemindStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.remindCall)
+}
+
+func (h *Handler) remindCall(c *fiber.Ctx) (*aiCall, error) {
 	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return httputil.Unauthorized(c, "")
+		return nil, httputil.Unauthorized(c, "")
 	}
 
 	taskID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
+		return nil, httputil.BadRequest(c, "invalid task ID")
 	}
 
 	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "database error")
+		return nil, httputil.InternalError(c, "database error")
 	}
 	if task == nil {
-		return httputil.NotFound(c, "task")
+		return nil, httputil.NotFound(c, "task")
 	}
 
 	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureReminder)
 	if !canUse {
-		return httputil.PaymentRequired(c, "Upgrade to Premium tier for smart reminders")
+		return nil, httputil.PaymentRequired(c, "Upgrade to Premium tier for smart reminders")
 	}
 
 	now := time.Now()
@@ -918,75 +1012,88 @@ Guidelines:
 			return ""
 		}(), dueInfo, now.Format(time.RFC3339))
 
-	resp, err := h.service.LLM().Complete(c.Context(), llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
+	call := &aiCall{
+		request: llm.CompletionRequest{
+			Messages: []llm.Message{
+				{Role: "user", Content: prompt},
+			},
+			MaxTokens:   150,
+			Temperature: 0.3,
+			Feature:     string(FeatureReminder),
+			UserID:      userID,
+			Schema:      llmschema.Reminder(),
 		},
-		MaxTokens:   150,
-		Temperature: 0.3,
-	})
-	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
 	}
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
 
-	var suggested struct {
-		ReminderTime string `json:"reminder_time"`
-		Reason       string `json:"reason"`
-	}
-	if err := json.Unmarshal([]byte(resp.Content), &suggested); err != nil {
-		return httputil.InternalError(c, "failed to parse AI response")
-	}
+		var suggested struct {
+			ReminderTime string `json:"reminder_time"`
+			Reason       string `json:"reason"`
+		}
+		if err := json.Unmarshal([]byte(content), &suggested); err != nil {
+			return nil, errors.Internal("failed to parse AI response")
+		}
 
-	reminderTime, err := time.Parse(time.RFC3339, suggested.ReminderTime)
-	if err != nil {
-		reminderTime, err = time.Parse("2006-01-02T15:04:05", suggested.ReminderTime)
+		reminderTime, err := llm.ParseDateTime(suggested.ReminderTime)
 		if err != nil {
-			return httputil.InternalError(c, "invalid reminder time from AI")
+			return nil, errors.Internal("invalid reminder time from AI")
 		}
-	}
 
-	updates := map[string]interface{}{
-		"reminder_at": reminderTime,
-	}
-	if err := repository.UpdateTaskAIFields(c.Context(), taskID, userID, updates); err != nil {
-		return httputil.InternalError(c, "failed to update task")
-	}
+		updates := map[string]interface{}{
+			"reminder_at": reminderTime,
+		}
+		if err := repository.UpdateTaskAIFields(ctx, taskID, userID, updates); err != nil {
+			return nil, errors.Internal("failed to update task")
+		}
 
-	task, childCount, _ = repository.GetTaskByID(c.Context(), taskID, userID)
-	return httputil.Success(c, map[string]interface{}{
-		"task":          toTaskResponse(task, childCount),
-		"reminder_time": reminderTime,
-		"reason":        suggested.Reason,
-	})
+		task, childCount, _ = repository.GetTaskByID(ctx, taskID, userID)
+		resp := toTaskResponse(task, childCount)
+		publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+		return map[string]interface{}{
+			"task":          resp,
+			"reminder_time": reminderTime,
+			"reason":        suggested.Reason,
+		}, nil
+	}
+	return call, nil
 }
 
 // AIEmail drafts an email based on the task
 func (h *Handler) AIEmail(c *fiber.Ctx) error {
+	return h.runAI(c, h.emailCall)
+}
+
+// AIEmailStream is AIEmail as server-sent events
+func (h *Handler) AIEmailStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.emailCall)
+}
+
+func (h *Handler) emailCall(c *fiber.Ctx) (*aiCall, error) {
 	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return httputil.Unauthorized(c, "")
+		return nil, httputil.Unauthorized(c, "")
 	}
 
 	taskID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
+		return nil, httputil.BadRequest(c, "invalid task ID")
 	}
 
 	task, _, err := repository.GetTaskByID(c.Context(), taskID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "database error")
+		return nil, httputil.InternalError(c, "database error")
 	}
 	if task == nil {
-		return httputil.NotFound(c, "task")
+		return nil, httputil.NotFound(c, "task")
 	}
 
 	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureDraftEmail)
 	if !canUse {
-		return httputil.PaymentRequired(c, "Upgrade to Premium tier for email drafts")
+		return nil, httputil.PaymentRequired(c, "Upgrade to Premium tier for email drafts")
 	}
 
 	prompt := fmt.Sprintf(`Draft a professional email based on this task.
@@ -1007,58 +1114,72 @@ Return ONLY a JSON object:
 			return ""
 		}())
 
-	resp, err := h.service.LLM().Complete(c.Context(), llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
+	call := &aiCall{
+		request: llm.CompletionRequest{
+			Messages: []llm.Message{
+				{Role: "user", Content: prompt},
+			},
+			MaxTokens:   500,
+			Temperature: 0.4,
+			Feature:     string(FeatureDraftEmail),
+			UserID:      userID,
+			Schema:      llmschema.Email(),
 		},
-		MaxTokens:   500,
-		Temperature: 0.4,
-	})
-	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
 	}
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
 
-	var draft DraftContent
-	if err := json.Unmarshal([]byte(resp.Content), &draft); err != nil {
-		return httputil.InternalError(c, "failed to parse AI response")
-	}
-	draft.Type = "email"
+		var draft DraftContent
+		if err := json.Unmarshal([]byte(content), &draft); err != nil {
+			return nil, errors.Internal("failed to parse AI response")
+		}
+		draft.Type = "email"
 
-	draftID, _ := h.service.SaveDraft(c.Context(), userID, taskID, &draft)
+		draftID, _ := h.service.SaveDraft(ctx, userID, taskID, &draft)
 
-	return httputil.Success(c, map[string]interface{}{
-		"draft_id": draftID,
-		"draft":    draft,
-	})
+		return map[string]interface{}{
+			"draft_id": draftID,
+			"draft":    draft,
+		}, nil
+	}
+	return call, nil
 }
 
 // AIInvite drafts a calendar invite based on the task
 func (h *Handler) AIInvite(c *fiber.Ctx) error {
+	return h.runAI(c, h.inviteCall)
+}
+
+// AIInviteStream is AIInvite as server-sent events
+func (h *Handler) AIInviteStream(c *fiber.Ctx) error {
+	return h.streamAI(c, h.inviteCall)
+}
+
+func (h *Handler) inviteCall(c *fiber.Ctx) (*aiCall, error) {
 	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return nil, httputil.ServiceUnavailable(c, "AI service not available")
 	}
 
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return httputil.Unauthorized(c, "")
+		return nil, httputil.Unauthorized(c, "")
 	}
 
 	taskID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
+		return nil, httputil.BadRequest(c, "invalid task ID")
 	}
 
 	task, _, err := repository.GetTaskByID(c.Context(), taskID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "database error")
+		return nil, httputil.InternalError(c, "database error")
 	}
 	if task == nil {
-		return httputil.NotFound(c, "task")
+		return nil, httputil.NotFound(c, "task")
 	}
 
 	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureDraftCalendar)
 	if !canUse {
-		return httputil.PaymentRequired(c, "Upgrade to Premium tier for calendar invites")
+		return nil, httputil.PaymentRequired(c, "Upgrade to Premium tier for calendar invites")
 	}
 
 	now := time.Now()
@@ -1093,99 +1214,130 @@ Guidelines:
 			return ""
 		}(), dueInfo, now.Format(time.RFC3339))
 
-	resp, err := h.service.LLM().Complete(c.Context(), llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
+	call := &aiCall{
+		request: llm.CompletionRequest{
+			Messages: []llm.Message{
+				{Role: "user", Content: prompt},
+			},
+			MaxTokens:   400,
+			Temperature: 0.4,
+			Feature:     string(FeatureDraftCalendar),
+			UserID:      userID,
+			Schema:      llmschema.Invite(),
 		},
-		MaxTokens:   400,
-		Temperature: 0.4,
-	})
-	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
-	}
-
-	var draft DraftContent
-	if err := json.Unmarshal([]byte(resp.Content), &draft); err != nil {
-		return httputil.InternalError(c, "failed to parse AI response")
 	}
-	draft.Type = "calendar"
+	call.finish = func(ctx context.Context, content string) (interface{}, error) {
 
-	draftID, _ := h.service.SaveDraft(c.Context(), userID, taskID, &draft)
+		var draft DraftContent
+		if err := json.Unmarshal([]byte(content), &draft); err != nil {
+			return nil, errors.Internal("failed to parse AI response")
+		}
+		draft.Type = "calendar"
 
-	return httputil.Success(c, map[string]interface{}{
-		"draft_id": draftID,
-		"draft":    draft,
-	})
-}
+		draftID, _ := h.service.SaveDraft(ctx, userID, taskID, &draft)
 
-// AICheckDuplicates checks for duplicate/similar tasks
-func (h *Handler) AICheckDuplicates(c *fiber.Ctx) error {
-	if !h.service.IsAvailable() {
-		return httputil.ServiceUnavailable(c, "AI service not available")
+		return map[string]interface{}{
+			"draft_id": draftID,
+			"draft":    draft,
+		}, nil
 	}
+	return call, nil
+}
 
-	userID, err := middleware.GetUserID(c)
-	if err != nil {
-		return httputil.Unauthorized(c, "")
-	}
+// Duplicate check tuning
+const (
+	duplicateCandidateLimit  = 15   // Top candidates sent to the LLM
+	duplicateAutoThreshold   = 0.85 // Candidates scoring this high are duplicates without asking the LLM
+	duplicateSemanticMinimum = 0.7  // Embedding similarity a nearest neighbour needs to become a candidate
+	duplicateSemanticWeight  = 0.8  // Keeps neighbours found only by embedding below the auto threshold
+)
 
-	taskID, err := uuid.Parse(c.Params("id"))
-	if err != nil {
-		return httputil.BadRequest(c, "invalid task ID")
-	}
+// DuplicateMatch is a duplicate task with its local similarity score
+type DuplicateMatch struct {
+	TaskResponse
+	Similarity float64 `json:"similarity"` // Combined local score, 0-1
+	Reason     string  `json:"duplicate_reason,omitempty"`
+}
 
-	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
-	if err != nil {
-		return httputil.InternalError(c, "database error")
+// addSemanticCandidates adds the task's nearest neighbours by embedding,
+// which catch duplicates worded differently enough to slip past the
+// trigram pre-filter. Without embeddings the candidates are returned as is.
+func (h *Handler) addSemanticCandidates(ctx context.Context, task *repository.Task, candidates []repository.DuplicateCandidate) []repository.DuplicateCandidate {
+	if !h.embedder.Available() {
+		return candidates
 	}
-	if task == nil {
-		return httputil.NotFound(c, "task")
+	text := task.Title
+	if task.Description != nil {
+		text += "\n" + *task.Description
 	}
-
-	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureDuplicateCheck)
-	if !canUse {
-		return httputil.PaymentRequired(c, "Daily limit reached for duplicate check")
-	}
-
-	// Get user's other tasks for comparison
-	otherTasks, err := repository.GetUserTasks(c.Context(), userID, 100)
+	matches, err := h.embedder.Related(ctx, task.UserID, task.ID, text, duplicateCandidateLimit)
 	if err != nil {
-		return httputil.InternalError(c, "failed to fetch tasks")
+		fmt.Printf("[AI] Nearest-neighbour duplicate search failed: %v\n", err)
+		return candidates
 	}
 
-	// Build list of other task titles (excluding current task and its subtasks)
-	// Use AI-cleaned versions if available for better comparison
-	var taskList strings.Builder
-	for i, t := range otherTasks {
-		if t.ID == taskID {
-			continue
+	seen := make(map[uuid.UUID]int, len(candidates))
+	for i, cand := range candidates {
+		seen[cand.Task.ID] = i
+	}
+	for _, m := range matches {
+		if m.Score < duplicateSemanticMinimum {
+			break // Ranked best first
 		}
-		// Skip subtasks of the current task - they're not duplicates, they're children
-		if t.ParentID != nil && *t.ParentID == taskID {
+		if i, ok := seen[m.TaskID]; ok {
+			candidates[i].Semantic = m.Score
 			continue
 		}
-		// Skip if current task is a subtask and this is its parent
-		if task.ParentID != nil && t.ID == *task.ParentID {
+		other, _, err := repository.GetTaskByID(ctx, m.TaskID, task.UserID)
+		if err != nil || other == nil || other.Status == "cancelled" || isParentOrChild(task, other) {
 			continue
 		}
-		// Use display title (AI-cleaned if available, otherwise original)
-		displayTitle := t.Title
-		if t.AICleanedTitle != nil && *t.AICleanedTitle != "" {
-			displayTitle = *t.AICleanedTitle
-		}
-		taskList.WriteString(fmt.Sprintf("%d. [%s] %s\n", i+1, t.ID.String(), displayTitle))
+		candidates = append(candidates, repository.DuplicateCandidate{
+			Task:     other,
+			Score:    m.Score * duplicateSemanticWeight,
+			Semantic: m.Score,
+		})
 	}
 
-	// Use AI-cleaned versions for current task if available
-	currentTitle := task.Title
-	if task.AICleanedTitle != nil && *task.AICleanedTitle != "" {
-		currentTitle = *task.AICleanedTitle
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	if len(candidates) > duplicateCandidateLimit {
+		candidates = candidates[:duplicateCandidateLimit]
+	}
+	return candidates
+}
+
+func isParentOrChild(a, b *repository.Task) bool {
+	return (a.ParentID != nil && *a.ParentID == b.ID) || (b.ParentID != nil && *b.ParentID == a.ID)
+}
+
+// DuplicateVerdict is the model's judgement of which candidates are the
+// same task
+type DuplicateVerdict struct {
+	Duplicates []DuplicateReason `json:"duplicates"`
+	Reason     string            `json:"reason"`
+}
+
+// DuplicateReason is one candidate judged a duplicate
+type DuplicateReason struct {
+	ID     uuid.UUID `json:"id"`
+	Reason string    `json:"reason"`
+}
+
+// JudgeDuplicates asks the model which candidates are the same task as the
+// title and description, by their display titles. IDs that weren't offered
+// are dropped. An answer that can't be read is an error returned with its
+// response; a nil response means the call itself failed.
+func (s *Service) JudgeDuplicates(ctx context.Context, userID uuid.UUID, title, description string, candidates []*repository.Task) (*DuplicateVerdict, *llm.CompletionResponse, error) {
+	offered := make(map[uuid.UUID]bool, len(candidates))
+	var taskList strings.Builder
+	for i, t := range candidates {
+		offered[t.ID] = true
+		taskList.WriteString(fmt.Sprintf("%d. [%s] %s\n", i+1, t.ID.String(), t.GetDisplayTitle()))
 	}
+
 	currentDesc := ""
-	if task.AICleanedDescription != nil && *task.AICleanedDescription != "" {
-		currentDesc = "Description: " + *task.AICleanedDescription
-	} else if task.Description != nil && *task.Description != "" {
-		currentDesc = "Description: " + *task.Description
+	if description != "" {
+		currentDesc = "Description: " + description
 	}
 
 	prompt := fmt.Sprintf(`Find tasks that are TRUE DUPLICATES of this task (same task written differently).
@@ -1214,24 +1366,19 @@ STRICT RULES:
 - "Cook beef" and "Tell Alice about onboarding" = NOT DUPLICATE (completely different)
 - Return EMPTY duplicates array [] if no true duplicates exist
 - Copy the UUID exactly from the [brackets] - do not make up UUIDs`,
-		currentTitle, currentDesc, taskList.String())
+		title, currentDesc, taskList.String())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	resp, err := h.service.LLM().Complete(ctx, llm.CompletionRequest{
+	resp, err := s.llm.Complete(ctx, llm.CompletionRequest{
 		Messages: []llm.Message{
 			{Role: "user", Content: prompt},
 		},
 		MaxTokens:   500,
 		Temperature: 0.2,
+		Feature:     string(FeatureDuplicateCheck),
+		UserID:      userID,
 	})
 	if err != nil {
-		return httputil.Success(c, map[string]interface{}{
-			"task":       toTaskResponse(task, childCount),
-			"duplicates": []interface{}{},
-			"reason":     "AI service temporarily unavailable",
-		})
+		return nil, nil, err
 	}
 
 	var result struct {
@@ -1260,65 +1407,179 @@ STRICT RULES:
 	}
 
 	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		return httputil.Success(c, map[string]interface{}{
-			"task":       toTaskResponse(task, childCount),
-			"duplicates": []interface{}{},
-			"reason":     "No duplicates found",
-		})
+		return nil, resp, fmt.Errorf("failed to parse AI response: %w", err)
 	}
 
-	// Convert duplicate IDs to full task objects and collect valid IDs
-	var duplicateTasks []TaskResponse
-	var validDuplicateIDs []string
+	// Only accept IDs that were actually offered as candidates
+	verdict := &DuplicateVerdict{Duplicates: []DuplicateReason{}, Reason: result.Reason}
 	for _, dup := range result.Duplicates {
 		dupID, err := uuid.Parse(dup.ID)
-		if err != nil {
+		if err != nil || !offered[dupID] {
 			continue
 		}
-		// Skip if AI returned the current task as a duplicate of itself
-		if dupID == taskID {
-			continue
+		verdict.Duplicates = append(verdict.Duplicates, DuplicateReason{ID: dupID, Reason: dup.Reason})
+	}
+	return verdict, resp, nil
+}
+
+// AICheckDuplicates checks for duplicate/similar tasks.
+// Candidates come from a local pre-filter over the whole task history
+// (trigram title similarity, normalized tokens, alias-aware entities) and,
+// when embeddings are set up, the task's nearest neighbours; only the top
+// candidates reach the LLM, and near-identical ones skip it.
+func (h *Handler) AICheckDuplicates(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+
+	task, childCount, err := repository.GetTaskByID(c.Context(), taskID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	if task == nil {
+		return httputil.NotFound(c, "task")
+	}
+
+	candidates, err := repository.FindDuplicateCandidates(c.Context(), task, duplicateCandidateLimit)
+	if err != nil {
+		return httputil.InternalError(c, "failed to fetch tasks")
+	}
+	candidates = h.addSemanticCandidates(c.Context(), task, candidates)
+	if len(candidates) == 0 {
+		return httputil.Success(c, map[string]interface{}{
+			"task":       toTaskResponse(task, childCount),
+			"duplicates": []DuplicateMatch{},
+			"reason":     "No similar tasks found",
+			"method":     "local",
+		})
+	}
+
+	// Near-identical tasks don't need the LLM
+	var confident []DuplicateMatch
+	for _, cand := range candidates {
+		if cand.Score >= duplicateAutoThreshold {
+			confident = append(confident, DuplicateMatch{
+				TaskResponse: toTaskResponse(cand.Task, 0),
+				Similarity:   cand.Score,
+				Reason:       "Nearly identical task",
+			})
 		}
-		dupTask, dupChildCount, err := repository.GetTaskByID(c.Context(), dupID, userID)
+	}
+	if len(confident) > 0 {
+		h.saveDuplicates(c.Context(), task, childCount, confident)
+		return httputil.Success(c, map[string]interface{}{
+			"task":       toTaskResponse(task, childCount),
+			"duplicates": confident,
+			"reason":     "Found nearly identical tasks",
+			"method":     "local",
+		})
+	}
+
+	if !h.service.IsAvailable() {
+		return httputil.ServiceUnavailable(c, "AI service not available")
+	}
+
+	canUse, _ := h.service.CheckAndIncrementUsage(c.Context(), userID, FeatureDuplicateCheck)
+	if !canUse {
+		return httputil.PaymentRequired(c, "Daily limit reached for duplicate check")
+	}
+
+	// Only the top candidates are sent, with display (AI-cleaned) titles
+	scores := make(map[uuid.UUID]float64, len(candidates))
+	offered := make([]*repository.Task, len(candidates))
+	for i, cand := range candidates {
+		scores[cand.Task.ID] = cand.Score
+		offered[i] = cand.Task
+	}
+
+	// Use AI-cleaned versions for current task if available
+	currentTitle := task.Title
+	if task.AICleanedTitle != nil && *task.AICleanedTitle != "" {
+		currentTitle = *task.AICleanedTitle
+	}
+	currentDesc := ""
+	if task.AICleanedDescription != nil && *task.AICleanedDescription != "" {
+		currentDesc = *task.AICleanedDescription
+	} else if task.Description != nil {
+		currentDesc = *task.Description
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	verdict, resp, err := h.service.JudgeDuplicates(ctx, userID, currentTitle, currentDesc, offered)
+	if resp == nil {
+		return httputil.Success(c, map[string]interface{}{
+			"task":       toTaskResponse(task, childCount),
+			"duplicates": []DuplicateMatch{},
+			"reason":     "AI service temporarily unavailable",
+			"method":     "ai",
+		})
+	}
+	h.service.RefundIfCached(ctx, userID, FeatureDuplicateCheck, resp)
+	if err != nil {
+		return httputil.Success(c, map[string]interface{}{
+			"task":       toTaskResponse(task, childCount),
+			"duplicates": []DuplicateMatch{},
+			"reason":     "No duplicates found",
+			"method":     "ai",
+		})
+	}
+
+	duplicates := make([]DuplicateMatch, 0)
+	for _, dup := range verdict.Duplicates {
+		dupTask, dupChildCount, err := repository.GetTaskByID(c.Context(), dup.ID, userID)
 		if err != nil || dupTask == nil {
 			continue
 		}
-		// Skip cancelled tasks - they shouldn't be shown as duplicates
-		if dupTask.Status == "cancelled" {
-			continue
-		}
-		// Skip subtasks of the current task - they're children, not duplicates
-		if dupTask.ParentID != nil && *dupTask.ParentID == taskID {
-			continue
-		}
-		// Skip if current task is a subtask and this is its parent
-		if task.ParentID != nil && dupID == *task.ParentID {
-			continue
-		}
-		duplicateTasks = append(duplicateTasks, toTaskResponse(dupTask, dupChildCount))
-		validDuplicateIDs = append(validDuplicateIDs, dup.ID)
-	}
-
-	// Save duplicate IDs to the task if any were found
-	if len(validDuplicateIDs) > 0 {
-		duplicateJSON, _ := json.Marshal(validDuplicateIDs)
-		_ = repository.UpdateTaskAIFields(c.Context(), taskID, userID, map[string]interface{}{
-			"duplicate_of":       duplicateJSON,
-			"duplicate_resolved": false,
+		duplicates = append(duplicates, DuplicateMatch{
+			TaskResponse: toTaskResponse(dupTask, dupChildCount),
+			Similarity:   scores[dup.ID],
+			Reason:       dup.Reason,
 		})
-		// Update task object for response
-		task.DuplicateOf = validDuplicateIDs
-		task.DuplicateResolved = false
 	}
 
+	h.saveDuplicates(c.Context(), task, childCount, duplicates)
+
 	return httputil.Success(c, map[string]interface{}{
 		"task":       toTaskResponse(task, childCount),
-		"duplicates": duplicateTasks,
-		"reason":     result.Reason,
+		"duplicates": duplicates,
+		"reason":     verdict.Reason,
+		"method":     "ai",
+	})
+}
+
+// saveDuplicates stores the found duplicate IDs on the task (and the response copy)
+func (h *Handler) saveDuplicates(ctx context.Context, task *repository.Task, childCount int, duplicates []DuplicateMatch) {
+	if len(duplicates) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(duplicates))
+	for _, dup := range duplicates {
+		ids = append(ids, dup.ID)
+	}
+
+	duplicateJSON, _ := json.Marshal(ids)
+	err := repository.UpdateTaskAIFields(ctx, task.ID, task.UserID, map[string]interface{}{
+		"duplicate_of":       duplicateJSON,
+		"duplicate_resolved": false,
 	})
+	task.DuplicateOf = ids
+	task.DuplicateResolved = false
+	if err == nil {
+		publishTaskEvent(task.UserID, webhook.EventTaskUpdated, toTaskResponse(task, childCount))
+	}
 }
 
-// AIResolveDuplicate marks a duplicate as resolved/dismissed
+// AIResolveDuplicate marks a duplicate as resolved/dismissed.
+// Merging confirmed duplicates is done by the tasks service (POST /tasks/:id/merge).
 func (h *Handler) AIResolveDuplicate(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -1349,7 +1610,9 @@ func (h *Handler) AIResolveDuplicate(c *fiber.Ctx) error {
 	// Update task object for response
 	task.DuplicateResolved = true
 
-	return httputil.Success(c, toTaskResponse(task, childCount))
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+	return httputil.Success(c, resp)
 }
 
 // GetAIUsage returns AI usage stats for the current user
@@ -1397,7 +1660,10 @@ func (h *Handler) GetAIDrafts(c *fiber.Ctx) error {
 	return httputil.Success(c, drafts)
 }
 
-// ApproveDraft marks a draft as approved
+// ApproveDraft approves a draft and sends it: the email is sent (or the
+// invite delivered as an .ics attachment) with the user as Reply-To. With
+// {"send": false} the draft is only marked approved. Failed sends can be
+// retried by approving again.
 func (h *Handler) ApproveDraft(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -1410,24 +1676,114 @@ func (h *Handler) ApproveDraft(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Send bool `json:"send"`
+		Send *bool `json:"send"`
 	}
 	_ = c.BodyParser(&req)
 
-	status := "approved"
-	if req.Send {
-		status = "sent"
+	if req.Send != nil && !*req.Send {
+		rowsAffected, err := repository.UpdateAIDraftStatus(c.Context(), draftID, userID, "approved")
+		if err != nil {
+			return httputil.InternalError(c, "failed to approve draft")
+		}
+		if rowsAffected == 0 {
+			return httputil.NotFound(c, "draft")
+		}
+		return httputil.Success(c, map[string]string{"status": "approved"})
 	}
 
-	rowsAffected, err := repository.UpdateAIDraftStatus(c.Context(), draftID, userID, status)
+	draft, err := repository.GetAIDraft(c.Context(), draftID, userID)
 	if err != nil {
-		return httputil.InternalError(c, "failed to approve draft")
+		return httputil.InternalError(c, "failed to load draft")
 	}
-	if rowsAffected == 0 {
+	if draft == nil || draft.Status == "cancelled" {
+		return httputil.NotFound(c, "draft")
+	}
+	if draft.Status == "sent" || draft.Status == "bounced" {
+		return httputil.Conflict(c, "draft was already sent")
+	}
+	if !h.drafts.Enabled() {
+		return httputil.ServiceUnavailable(c, "email sending is not configured")
+	}
+
+	msg, fields, err := h.drafts.Prepare(c.Context(), userID, draft)
+	if err != nil {
+		return httputil.InternalError(c, "failed to prepare draft")
+	}
+	if fields != nil {
+		return httputil.ValidationError(c, "draft can't be sent", fields)
+	}
+
+	claimed, err := repository.ClaimAIDraftForSending(c.Context(), draftID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to send draft")
+	}
+	if !claimed {
+		return httputil.Conflict(c, "draft is already being sent")
+	}
+
+	// Only sends that actually go out count against the limit
+	if !h.drafts.Allow(c.Context(), userID) {
+		if err := repository.ReleaseAIDraftClaim(context.Background(), draftID, userID); err != nil {
+			fmt.Printf("[Drafts] Failed to release draft %s: %v\n", draftID, err)
+		}
+		return httputil.TooManyRequests(c, "too many drafts sent, please try again later")
+	}
+
+	messageID, err := h.drafts.Deliver(c.Context(), msg)
+	if err != nil {
+		fmt.Printf("[Drafts] Failed to send draft %s: %v\n", draftID, err)
+		if markErr := repository.MarkAIDraftFailed(context.Background(), draftID, userID, err.Error()); markErr != nil {
+			fmt.Printf("[Drafts] Failed to record failure of draft %s: %v\n", draftID, markErr)
+		}
+		return httputil.Error(c, errors.NewWithDetails(err, "failed to send draft", fiber.StatusServiceUnavailable, map[string]interface{}{
+			"status": "failed",
+			"error":  err.Error(),
+		}))
+	}
+
+	if err := repository.MarkAIDraftSent(context.Background(), draftID, userID, messageID, msg.To); err != nil {
+		// The email went out; report it as sent so the client doesn't retry
+		fmt.Printf("[Drafts] Sent draft %s but failed to record it: %v\n", draftID, err)
+	}
+
+	return httputil.Success(c, map[string]interface{}{
+		"status":     "sent",
+		"message_id": messageID,
+		"recipients": msg.To,
+	})
+}
+
+// GetDraft returns a draft with its delivery status
+func (h *Handler) GetDraft(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	draftID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid draft ID")
+	}
+
+	draft, err := repository.GetAIDraft(c.Context(), draftID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load draft")
+	}
+	if draft == nil {
 		return httputil.NotFound(c, "draft")
 	}
 
-	return httputil.Success(c, map[string]string{"status": "approved"})
+	return httputil.Success(c, map[string]interface{}{
+		"id":         draft.ID,
+		"task_id":    draft.TaskID,
+		"type":       draft.Type,
+		"content":    json.RawMessage(draft.Content),
+		"status":     draft.Status,
+		"recipients": draft.Recipients,
+		"error":      draft.Error,
+		"created_at": draft.CreatedAt,
+		"sent_at":    draft.SentAt,
+	})
 }
 
 // DeleteDraft cancels a draft
@@ -1507,7 +1863,9 @@ func (h *Handler) RemoveEntityFromTask(c *fiber.Ctx) error {
 
 	// Get updated task
 	task, childCount, _ = repository.GetTaskByID(c.Context(), taskID, userID)
-	return httputil.Success(c, toTaskResponse(task, childCount))
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(userID, webhook.EventTaskUpdated, resp)
+	return httputil.Success(c, resp)
 }
 
 // Service returns the underlying AI service (for use by other handlers)
@@ -0,0 +1,184 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+func TestSuggestSubtasks(t *testing.T) {
+	userID := uuid.New()
+
+	t.Run("new breakdown", func(t *testing.T) {
+		fake, client := scriptedLLM(t, `["Buy flour", "Preheat the oven", "Bake the cake"]`)
+		s := NewService(client)
+
+		titles, resp, err := s.SuggestSubtasks(context.Background(), userID, "Bake a cake", "For Sunday", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp == nil {
+			t.Fatal("response missing")
+		}
+		if fmt.Sprint(titles) != "[Buy flour Preheat the oven Bake the cake]" {
+			t.Errorf("titles = %q", titles)
+		}
+
+		req := fake.Requests()[0]
+		prompt := req.Messages[0].Content
+		if !strings.Contains(prompt, "Break down this task") || !strings.Contains(prompt, "Description: For Sunday") {
+			t.Errorf("prompt = %q", prompt)
+		}
+		if req.Feature != string(FeatureDecompose) || req.UserID != userID || req.Schema == nil {
+			t.Errorf("request feature %q, user %v, schema %v", req.Feature, req.UserID, req.Schema)
+		}
+	})
+
+	t.Run("more besides existing", func(t *testing.T) {
+		fake, client := scriptedLLM(t, `["Decorate the cake"]`)
+		s := NewService(client)
+
+		titles, _, err := s.SuggestSubtasks(context.Background(), userID, "Bake a cake", "", []string{"Buy flour", "Bake the cake"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(titles) != 1 || titles[0] != "Decorate the cake" {
+			t.Errorf("titles = %q", titles)
+		}
+
+		prompt := fake.Requests()[0].Messages[0].Content
+		if !strings.Contains(prompt, "Add 2-5 more") || !strings.Contains(prompt, "- Buy flour\n- Bake the cake\n") {
+			t.Errorf("prompt = %q", prompt)
+		}
+		if strings.Contains(prompt, "Description:") {
+			t.Error("prompt has an empty description line")
+		}
+	})
+
+	t.Run("too many subtasks are repaired", func(t *testing.T) {
+		fake, client := scriptedLLM(t, `["a", "b", "c", "d", "e", "f"]`, `["a", "b", "c"]`)
+		s := NewService(client)
+
+		titles, _, err := s.SuggestSubtasks(context.Background(), userID, "Plan trip", "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(titles) != 3 || len(fake.Requests()) != 2 {
+			t.Errorf("titles = %q after %d calls", titles, len(fake.Requests()))
+		}
+	})
+
+	t.Run("unrepairable answer", func(t *testing.T) {
+		_, client := scriptedLLM(t, `{"subtasks": ["a"]}`, `{"subtasks": ["a"]}`)
+		s := NewService(client)
+
+		titles, resp, err := s.SuggestSubtasks(context.Background(), userID, "Plan trip", "", nil)
+		if err == nil || titles != nil || resp != nil {
+			t.Errorf("got %q, %v, %v; want only an error", titles, resp, err)
+		}
+	})
+}
+
+func TestJudgeDuplicates(t *testing.T) {
+	userID := uuid.New()
+	cleaned := "Email Jane about project IPP"
+	candidates := []*repository.Task{
+		{ID: uuid.MustParse("11111111-1111-4111-8111-111111111111"), Title: "mail jane re ipp", AICleanedTitle: &cleaned},
+		{ID: uuid.MustParse("22222222-2222-4222-8222-222222222222"), Title: "Text Jane about project Prep"},
+	}
+
+	tests := []struct {
+		name       string
+		answer     string
+		duplicates []string
+		reason     string
+		wantError  bool
+	}{
+		{
+			name:       "offered duplicate",
+			answer:     `{"duplicates":[{"id":"11111111-1111-4111-8111-111111111111","reason":"same email"}],"reason":"One match"}`,
+			duplicates: []string{"11111111-1111-4111-8111-111111111111: same email"},
+			reason:     "One match",
+		},
+		{
+			name: "made-up and malformed IDs are dropped",
+			answer: "```json\n" + `{"duplicates":[` +
+				`{"id":"33333333-3333-4333-8333-333333333333","reason":"invented"},` +
+				`{"id":"task 2","reason":"not an ID"},` +
+				`{"id":"22222222-2222-4222-8222-222222222222","reason":"same person"}` +
+				`],"reason":"Checked"}` + "\n```",
+			duplicates: []string{"22222222-2222-4222-8222-222222222222: same person"},
+			reason:     "Checked",
+		},
+		{
+			name:       "no duplicates",
+			answer:     `{"duplicates":[],"reason":"Different projects"}`,
+			duplicates: []string{},
+			reason:     "Different projects",
+		},
+		{
+			name:      "unreadable answer",
+			answer:    "They look different to me.",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client := scriptedLLM(t, tt.answer)
+			s := NewService(client)
+
+			verdict, resp, err := s.JudgeDuplicates(context.Background(), userID, "Email Jane about IPP", "Send the draft", candidates)
+			if resp == nil {
+				t.Fatal("response missing for a completed call")
+			}
+			if tt.wantError {
+				if err == nil || verdict != nil {
+					t.Errorf("got %+v, %v; want an error", verdict, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := make([]string, len(verdict.Duplicates))
+			for i, d := range verdict.Duplicates {
+				got[i] = d.ID.String() + ": " + d.Reason
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.duplicates) {
+				t.Errorf("duplicates = %q, want %q", got, tt.duplicates)
+			}
+			if verdict.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", verdict.Reason, tt.reason)
+			}
+
+			// Candidates are offered by ID with their display titles
+			prompt := fake.Requests()[0].Messages[0].Content
+			for _, want := range []string{
+				`CURRENT TASK: "Email Jane about IPP"`,
+				"Description: Send the draft",
+				"1. [11111111-1111-4111-8111-111111111111] Email Jane about project IPP",
+				"2. [22222222-2222-4222-8222-222222222222] Text Jane about project Prep",
+			} {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("prompt is missing %q", want)
+				}
+			}
+		})
+	}
+
+	t.Run("call failure", func(t *testing.T) {
+		_, client := scriptedLLM(t)
+		s := NewService(client)
+
+		verdict, resp, err := s.JudgeDuplicates(context.Background(), userID, "Email Jane", "", candidates)
+		if err == nil || verdict != nil || resp != nil {
+			t.Errorf("got %+v, %v, %v; want only an error", verdict, resp, err)
+		}
+	})
+}
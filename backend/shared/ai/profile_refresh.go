@@ -21,6 +21,12 @@ const (
 	TriggerTaskMilestone ProfileRefreshTrigger = "task_milestone"
 )
 
+// maxProfilePeople caps the directory people included in the analysis prompt
+const maxProfilePeople = 15
+
+// maxProfileRejections caps the rejected AI suggestions included in the prompt
+const maxProfileRejections = 20
+
 // ProfileRefreshConfig holds configuration for profile refresh
 type ProfileRefreshConfig struct {
 	TaskDaysToAnalyze    int // How many days of tasks to analyze
@@ -96,38 +102,57 @@ func (pr *ProfileRefresher) RefreshUserProfile(ctx context.Context, userID uuid.
 	// Get existing profile (for context, if any)
 	existingProfile, _ := repository.GetUserAIProfile(ctx, userID)
 
+	// People from the entity directory ground the social graph in real names
+	people, _ := repository.GetTopEntities(ctx, userID, "person", maxProfilePeople)
+
+	// Suggestions the user rejected in review mode show what not to change
+	rejections, _ := repository.GetRecentAIRejections(ctx, userID, pr.config.TaskDaysToAnalyze, maxProfileRejections)
+
 	// Build analysis prompt
-	prompt := pr.buildAnalysisPrompt(tasks, existingProfile)
+	prompt := pr.buildAnalysisPrompt(tasks, existingProfile, people, rejections)
+
+	result, err := pr.analyze(ctx, userID, prompt)
+	if err != nil {
+		return err
+	}
+
+	// Save to database
+	profile := pr.resultToProfile(userID, result, trigger)
+	if profile.SocialGraph == nil && len(people) > 0 {
+		graph := directorySocialGraph(people)
+		profile.SocialGraph = &graph
+	}
+	if err := repository.UpsertUserAIProfile(ctx, profile); err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+
+	return nil
+}
 
-	// Call LLM
+// analyze sends the analysis prompt and parses the profile fields
+func (pr *ProfileRefresher) analyze(ctx context.Context, userID uuid.UUID, prompt string) (*ProfileAnalysisResult, error) {
 	resp, err := pr.llm.Complete(ctx, llm.CompletionRequest{
 		Messages: []llm.Message{
 			{Role: "user", Content: prompt},
 		},
 		MaxTokens:   2000,
 		Temperature: 0.3,
+		Feature:     "profile_refresh",
+		UserID:      userID,
 	})
 	if err != nil {
-		return fmt.Errorf("LLM completion failed: %w", err)
+		return nil, fmt.Errorf("LLM completion failed: %w", err)
 	}
 
-	// Parse response
 	result, err := pr.parseAnalysisResponse(resp.Content)
 	if err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
-
-	// Save to database
-	profile := pr.resultToProfile(userID, result, trigger)
-	if err := repository.UpsertUserAIProfile(ctx, profile); err != nil {
-		return fmt.Errorf("failed to save profile: %w", err)
-	}
-
-	return nil
+	return result, nil
 }
 
 // buildAnalysisPrompt creates the prompt for profile analysis
-func (pr *ProfileRefresher) buildAnalysisPrompt(tasks []repository.TaskSummary, existingProfile *repository.UserAIProfile) string {
+func (pr *ProfileRefresher) buildAnalysisPrompt(tasks []repository.TaskSummary, existingProfile *repository.UserAIProfile, people []repository.EntitySummary, rejections []repository.AIRejection) string {
 	var sb strings.Builder
 
 	sb.WriteString("Analyze these tasks to build a user profile for personalized assistance.\n\n")
@@ -146,11 +171,7 @@ func (pr *ProfileRefresher) buildAnalysisPrompt(tasks []repository.TaskSummary,
 
 		line := fmt.Sprintf("- [%s] %s", status, t.Title)
 		if t.Description != nil && *t.Description != "" {
-			desc := *t.Description
-			if len(desc) > 100 {
-				desc = desc[:100] + "..."
-			}
-			line += fmt.Sprintf(" | %s", desc)
+			line += fmt.Sprintf(" | %s", truncateRunes(*t.Description, 100))
 		}
 		if len(t.Tags) > 0 {
 			line += fmt.Sprintf(" #%s", strings.Join(t.Tags, " #"))
@@ -161,6 +182,33 @@ func (pr *ProfileRefresher) buildAnalysisPrompt(tasks []repository.TaskSummary,
 		sb.WriteString(line + "\n")
 	}
 
+	if len(people) > 0 {
+		sb.WriteString("\nKNOWN PEOPLE (from the user's contacts; use these names in social_graph):\n")
+		for _, p := range people {
+			line := fmt.Sprintf("- %s", p.Name)
+			if len(p.Aliases) > 0 {
+				line += fmt.Sprintf(" (also: %s)", strings.Join(p.Aliases, ", "))
+			}
+			line += fmt.Sprintf(" - %d open, %d completed tasks", p.OpenTasks, p.CompletedTasks)
+			if p.Notes != nil && *p.Notes != "" {
+				line += fmt.Sprintf(" | %s", truncateRunes(*p.Notes, 100))
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+
+	if len(rejections) > 0 {
+		sb.WriteString("\nREJECTED AI SUGGESTIONS (the user turned these changes down; reflect what they imply in task_style_preferences):\n")
+		for _, r := range rejections {
+			line := fmt.Sprintf("- %s of %q: kept %s, rejected %s", r.Field, truncateRunes(r.TaskTitle, 60),
+				suggestionValueText(r.PreviousValue), suggestionValueText(r.Value))
+			if r.Feedback != nil && *r.Feedback != "" {
+				line += fmt.Sprintf(" | reason: %s", truncateRunes(*r.Feedback, 100))
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+
 	// Include existing profile as context (if available)
 	if existingProfile != nil && existingProfile.IdentitySummary != nil && *existingProfile.IdentitySummary != "" {
 		sb.WriteString("\nEXISTING PROFILE (update if new info available):\n")
@@ -252,6 +300,49 @@ func (pr *ProfileRefresher) resultToProfile(userID uuid.UUID, result *ProfileAna
 	return profile
 }
 
+// suggestionValueText renders a suggestion's JSON value for the prompt
+func suggestionValueText(raw []byte) string {
+	var value interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &value) != nil || value == nil {
+		return "(none)"
+	}
+
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", truncateRunes(v, 80))
+	case map[string]interface{}:
+		if due, ok := v["due_at"].(string); ok {
+			return due
+		}
+		return "(none)"
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if e, ok := item.(map[string]interface{}); ok {
+				values = append(values, fmt.Sprintf("%v", e["value"]))
+			}
+		}
+		return "[" + truncateRunes(strings.Join(values, ", "), 80) + "]"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// directorySocialGraph summarizes the most mentioned people when the LLM
+// couldn't describe the user's social graph
+func directorySocialGraph(people []repository.EntitySummary) string {
+	var parts []string
+	length := 0
+	for _, p := range people {
+		part := fmt.Sprintf("%s (%d tasks)", p.Name, p.OpenTasks+p.CompletedTasks)
+		if length+len(part) > 200 {
+			break
+		}
+		parts = append(parts, part)
+		length += len(part) + 2
+	}
+	return strings.Join(parts, ", ")
+}
+
 // ShouldRefresh checks if a user's profile should be refreshed
 func (pr *ProfileRefresher) ShouldRefresh(ctx context.Context, userID uuid.UUID) (bool, ProfileRefreshTrigger) {
 	profile, err := repository.GetUserAIProfile(ctx, userID)
@@ -307,3 +398,12 @@ func (pr *ProfileRefresher) BatchRefreshProfiles(ctx context.Context, userIDs []
 
 	return successCount, errors
 }
+
+// truncateRunes shortens s to max characters without splitting a rune
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
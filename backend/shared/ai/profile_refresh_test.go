@@ -0,0 +1,129 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+func TestProfileRefresherAnalyze(t *testing.T) {
+	userID := uuid.New()
+
+	t.Run("fenced answer", func(t *testing.T) {
+		fake, client := scriptedLLM(t, "Here is the profile:\n```json\n"+
+			`{"identity_summary":"Product manager at Acme","work_context":"  Ships the mobile app  ",`+
+			`"personal_context":"Unknown","social_graph":"","current_focus":"Q2 launch"}`+
+			"\n```")
+		pr := NewProfileRefresher(client)
+
+		result, err := pr.analyze(context.Background(), userID, "Analyze these tasks")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		req := fake.Requests()[0]
+		if req.Feature != "profile_refresh" || req.UserID != userID || req.Messages[0].Content != "Analyze these tasks" {
+			t.Errorf("request = %+v", req)
+		}
+
+		profile := pr.resultToProfile(userID, result, TriggerManual)
+		if profile.IdentitySummary == nil || *profile.IdentitySummary != "Product manager at Acme" {
+			t.Errorf("identity = %v", profile.IdentitySummary)
+		}
+		if profile.WorkContext == nil || *profile.WorkContext != "Ships the mobile app" {
+			t.Errorf("work context = %v", profile.WorkContext)
+		}
+		if profile.PersonalContext != nil || profile.SocialGraph != nil || profile.RoutinePatterns != nil {
+			t.Error("unknown and empty fields should be left unset")
+		}
+		if profile.RefreshTrigger == nil || *profile.RefreshTrigger != string(TriggerManual) {
+			t.Errorf("trigger = %v", profile.RefreshTrigger)
+		}
+	})
+
+	t.Run("unreadable answer", func(t *testing.T) {
+		_, client := scriptedLLM(t, "I can't build a profile from this.")
+		pr := NewProfileRefresher(client)
+
+		if _, err := pr.analyze(context.Background(), userID, "Analyze these tasks"); err == nil || !strings.Contains(err.Error(), "failed to parse response") {
+			t.Errorf("err = %v, want a parse error", err)
+		}
+	})
+
+	t.Run("call failure", func(t *testing.T) {
+		_, client := scriptedLLM(t)
+		pr := NewProfileRefresher(client)
+
+		if _, err := pr.analyze(context.Background(), userID, "Analyze these tasks"); err == nil || !strings.Contains(err.Error(), "LLM completion failed") {
+			t.Errorf("err = %v, want a completion error", err)
+		}
+	})
+}
+
+func TestBuildAnalysisPrompt(t *testing.T) {
+	pr := NewProfileRefresher(nil)
+
+	longDesc := strings.Repeat("é", 150)
+	due := "2026-03-12"
+	tasks := []repository.TaskSummary{
+		{Title: "Call the bank", Status: "pending", Description: &longDesc, Tags: []string{"finance"}, DueAt: &due},
+	}
+	for i := 0; i < 55; i++ {
+		tasks = append(tasks, repository.TaskSummary{Title: fmt.Sprintf("Task %d", i), Status: "pending"})
+	}
+
+	notes := strings.Repeat("ờ", 120)
+	people := []repository.EntitySummary{
+		{Name: "Nam Tran", Aliases: []string{"Nam"}, Notes: &notes, OpenTasks: 3, CompletedTasks: 2},
+	}
+
+	feedback := "I like my own wording"
+	rejections := []repository.AIRejection{
+		{Field: "title", TaskTitle: "call bank", Value: []byte(`"Call the bank"`), PreviousValue: []byte(`"call bank"`), Feedback: &feedback},
+	}
+
+	prompt := pr.buildAnalysisPrompt(tasks, nil, people, rejections)
+
+	if !utf8.ValidString(prompt) {
+		t.Fatal("prompt is not valid UTF-8")
+	}
+	for _, want := range []string{
+		"- [pending] Call the bank | " + strings.Repeat("é", 100) + "... #finance (due: 2026-03-12)",
+		"... and 6 more tasks",
+		"- Nam Tran (also: Nam) - 3 open, 2 completed tasks | " + strings.Repeat("ờ", 100) + "...",
+		`- title of "call bank": kept "call bank", rejected "Call the bank" | reason: I like my own wording`,
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q", want)
+		}
+	}
+	if strings.Contains(prompt, "Task 49\n") {
+		t.Error("prompt lists more than 50 tasks")
+	}
+	if strings.Contains(prompt, "EXISTING PROFILE") {
+		t.Error("prompt has an existing profile section without one")
+	}
+}
+
+func TestDirectorySocialGraph(t *testing.T) {
+	people := []repository.EntitySummary{
+		{Name: "Alice", OpenTasks: 2, CompletedTasks: 1},
+		{Name: "Bob", OpenTasks: 1},
+	}
+	if got := directorySocialGraph(people); got != "Alice (3 tasks), Bob (1 tasks)" {
+		t.Errorf("social graph = %q", got)
+	}
+
+	// Stops before going over 200 characters
+	var many []repository.EntitySummary
+	for i := 0; i < 30; i++ {
+		many = append(many, repository.EntitySummary{Name: fmt.Sprintf("Person %02d", i)})
+	}
+	if got := directorySocialGraph(many); len(got) > 200 {
+		t.Errorf("social graph is %d characters", len(got))
+	}
+}
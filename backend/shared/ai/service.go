@@ -5,12 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/llmschema"
+	"github.com/csaptu/flow/shared/prompts"
 	"github.com/csaptu/flow/shared/repository"
 )
 
@@ -39,6 +40,7 @@ const (
 	FeatureDraftEmail         AIFeature = "draft_email"
 	FeatureDraftCalendar      AIFeature = "draft_calendar"
 	FeatureDuplicateCheck     AIFeature = "duplicate_check"
+	FeatureAssistant          AIFeature = "assistant"
 )
 
 // FeatureLimits defines daily limits by tier
@@ -63,6 +65,7 @@ var FeatureLimits = map[UserTier]map[AIFeature]int{
 		FeatureDraftEmail:         10,
 		FeatureDraftCalendar:      10,
 		FeatureDuplicateCheck:     -1,
+		FeatureAssistant:          30,
 	},
 	TierPremium: {
 		FeatureCleanTitle:         -1,
@@ -77,6 +80,7 @@ var FeatureLimits = map[UserTier]map[AIFeature]int{
 		FeatureDraftEmail:         -1,
 		FeatureDraftCalendar:      -1,
 		FeatureDuplicateCheck:     -1,
+		FeatureAssistant:          -1,
 	},
 }
 
@@ -113,56 +117,21 @@ type AIProcessResult struct {
 	RecurrenceRule *string       `json:"recurrence_rule,omitempty"`
 	SuggestedGroup *string       `json:"suggested_group,omitempty"`
 	Draft          *DraftContent `json:"draft,omitempty"`
+	PromptVersion  uuid.UUID     `json:"-"` // Nil for built-in prompts
 }
 
 // Service handles all AI operations
 type Service struct {
-	llm     *llm.MultiClient
-	configs map[string]string
+	llm *llm.MultiClient
 }
 
-// NewService creates a new AI service
+// NewService creates a new AI service; prompt configs come from the prompts registry
 func NewService(llmClient *llm.MultiClient) *Service {
-	s := &Service{llm: llmClient, configs: make(map[string]string)}
-	s.loadPromptConfigs()
-	return s
+	return &Service{llm: llmClient}
 }
 
-// loadPromptConfigs loads AI prompt configurations
-func (s *Service) loadPromptConfigs() {
-	configs, err := repository.GetAIPromptConfigsAsMap(context.Background())
-	if err != nil {
-		s.configs = map[string]string{
-			"clean_title_instruction":     "Concise, action-oriented title (max 10 words)",
-			"summary_instruction":         "Brief summary if description is long (max 20 words)",
-			"complexity_instruction":      "1-10 scale (1=trivial like 'buy milk', 10=complex multi-step project)",
-			"due_date_instruction":        "ISO 8601 date if mentioned",
-			"reminder_instruction":        "ISO 8601 datetime if 'remind me' or similar phrase found",
-			"entities_instruction":        "person|place|organization",
-			"recurrence_instruction":      "RRULE string if recurring pattern detected",
-			"suggested_group_instruction": "Category suggestion based on content",
-			"decompose_step_count":        "2-5",
-			"decompose_rules":             "Each step should be a single, concrete action\nSteps should be in logical order\nUse action verbs\nKeep each step under 10 words",
-		}
-		return
-	}
-	s.configs = configs
-}
-
-// ReloadConfigs reloads AI prompt configurations
-func (s *Service) ReloadConfigs() {
-	s.loadPromptConfigs()
-}
-
-func (s *Service) getConfig(key, defaultValue string) string {
-	if val, ok := s.configs[key]; ok && val != "" {
-		return val
-	}
-	return defaultValue
-}
-
-func (s *Service) getConfigEscaped(key, defaultValue string) string {
-	val := s.getConfig(key, defaultValue)
+// escapeForJSONPrompt escapes a config value embedded in a JSON example in a prompt
+func escapeForJSONPrompt(val string) string {
 	val = strings.ReplaceAll(val, `\`, `\\`)
 	val = strings.ReplaceAll(val, `"`, `\"`)
 	return val
@@ -213,6 +182,15 @@ func (s *Service) CheckAndIncrementUsage(ctx context.Context, userID uuid.UUID,
 	return true, nil
 }
 
+// RefundIfCached gives back a use of feature when resp came from the LLM
+// cache and cache hits are configured to be free
+func (s *Service) RefundIfCached(ctx context.Context, userID uuid.UUID, feature AIFeature, resp *llm.CompletionResponse) {
+	if resp == nil || !resp.Cached || !s.llm.FreeCacheHits() {
+		return
+	}
+	_ = repository.DecrementAIUsage(ctx, userID, string(feature))
+}
+
 // GetUsageStats returns current usage stats for a user
 func (s *Service) GetUsageStats(ctx context.Context, userID uuid.UUID) (map[string]interface{}, error) {
 	tier, _ := s.GetUserTier(ctx, userID)
@@ -254,47 +232,45 @@ func (s *Service) GetPendingDrafts(ctx context.Context, userID uuid.UUID) ([]map
 	return drafts, nil
 }
 
-// ProcessTaskOnSave runs auto-triggered AI features on task save
-func (s *Service) ProcessTaskOnSave(ctx context.Context, userID uuid.UUID, taskID uuid.UUID, title, description string) (*AIProcessResult, error) {
-	if s.llm == nil {
-		return nil, fmt.Errorf("AI service not available")
-	}
-
-	tier, _ := s.GetUserTier(ctx, userID)
-	result := &AIProcessResult{}
-
-	prompt := s.buildAutoProcessPrompt(tier, title, description)
+// AutoProcess makes the combined auto-process call with a given prompt
+// version, with relative dates read against now. The tasks service's AI
+// queue runs it on task saves and the eval harness scores it; it counts
+// no usage, which is left to the caller.
+func (s *Service) AutoProcess(ctx context.Context, userID uuid.UUID, tier UserTier, version *prompts.Version, feature string, now time.Time, title, description string) (*AIProcessResult, *llm.CompletionResponse, error) {
+	prompt := s.buildAutoProcessPrompt(version, tier, now, title, description)
 
 	resp, err := s.llm.Complete(ctx, llm.CompletionRequest{
 		Messages: []llm.Message{
 			{Role: "user", Content: prompt},
 		},
-		MaxTokens:   1000,
-		Temperature: 0.2,
+		MaxTokens:     1000,
+		Temperature:   0.2,
+		Feature:       feature,
+		UserID:        userID,
+		PromptVersion: version.VersionID(),
+		Schema:        llmschema.AutoProcess(),
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("AI processing failed: %w", err)
+		return nil, nil, fmt.Errorf("AI processing failed: %w", err)
 	}
 
+	result := &AIProcessResult{PromptVersion: version.VersionID()}
 	if err := s.parseAutoProcessResponse(resp.Content, result); err != nil {
-		return nil, err
+		return nil, resp, err
 	}
-
-	s.trackAutoProcessUsage(ctx, userID, tier, result)
-
-	return result, nil
+	return result, resp, nil
 }
 
-func (s *Service) buildAutoProcessPrompt(tier UserTier, title, description string) string {
-	today := time.Now().Format("2006-01-02")
-	dayOfWeek := time.Now().Weekday().String()
+func (s *Service) buildAutoProcessPrompt(version *prompts.Version, tier UserTier, now time.Time, title, description string) string {
+	today := now.Format("2006-01-02")
+	dayOfWeek := now.Weekday().String()
 
-	cleanTitleInstr := s.getConfigEscaped("clean_title_instruction", "Concise, action-oriented title (max 10 words)")
-	summaryInstr := s.getConfigEscaped("summary_instruction", "Brief summary if description is long (max 20 words)")
-	dueDateInstr := s.getConfigEscaped("due_date_instruction", "ISO 8601 date if mentioned")
-	reminderInstr := s.getConfigEscaped("reminder_instruction", "ISO 8601 datetime if 'remind me' or similar phrase found")
-	complexityInstr := s.getConfigEscaped("complexity_instruction", "1-10 scale (1=trivial, 10=complex)")
+	cleanTitleInstr := escapeForJSONPrompt(version.Get("clean_title_instruction", "Concise, action-oriented title (max 10 words)"))
+	summaryInstr := escapeForJSONPrompt(version.Get("summary_instruction", "Brief summary if description is long (max 20 words)"))
+	dueDateInstr := escapeForJSONPrompt(version.Get("due_date_instruction", "ISO 8601 date if mentioned (e.g., 'tomorrow' = next day, 'next week' = next Monday)"))
+	reminderInstr := escapeForJSONPrompt(version.Get("reminder_instruction", "ISO 8601 datetime if 'remind me' or similar phrase found"))
+	complexityInstr := escapeForJSONPrompt(version.Get("complexity_instruction", "1-10 scale (1=trivial like 'buy milk', 10=complex multi-step project)"))
 
 	basePrompt := fmt.Sprintf(`Analyze this task and extract information. Today is %s (%s).
 
@@ -311,9 +287,9 @@ Return a JSON object with these fields (omit fields if not applicable):
   "complexity": %s`, today, dayOfWeek, title, description, cleanTitleInstr, summaryInstr, dueDateInstr, reminderInstr, complexityInstr)
 
 	if tier == TierLight || tier == TierPremium {
-		entitiesInstr := s.getConfigEscaped("entities_instruction", "person|place|organization")
-		recurrenceInstr := s.getConfigEscaped("recurrence_instruction", "RRULE string if recurring pattern detected")
-		suggestedGroupInstr := s.getConfigEscaped("suggested_group_instruction", "Category suggestion based on content")
+		entitiesInstr := escapeForJSONPrompt(version.Get("entities_instruction", "person|place|organization"))
+		recurrenceInstr := escapeForJSONPrompt(version.Get("recurrence_instruction", "RRULE string if recurring pattern detected (e.g., 'every Monday')"))
+		suggestedGroupInstr := escapeForJSONPrompt(version.Get("suggested_group_instruction", "Category suggestion based on content (e.g., 'Work', 'Shopping', 'Health')"))
 
 		basePrompt += fmt.Sprintf(`,
   "entities": [{"type": "%s", "value": "extracted value"}],
@@ -358,16 +334,9 @@ func (s *Service) containsDraftTrigger(text string) bool {
 	return false
 }
 
+// parseAutoProcessResponse reads an answer that already matched
+// llmschema.AutoProcess
 func (s *Service) parseAutoProcessResponse(content string, result *AIProcessResult) error {
-	content = strings.TrimSpace(content)
-	if strings.HasPrefix(content, "```") {
-		re := regexp.MustCompile("```(?:json)?\\s*([\\s\\S]*?)\\s*```")
-		matches := re.FindStringSubmatch(content)
-		if len(matches) > 1 {
-			content = matches[1]
-		}
-	}
-
 	var parsed struct {
 		CleanedTitle   string        `json:"cleaned_title"`
 		Summary        string        `json:"summary"`
@@ -385,24 +354,25 @@ func (s *Service) parseAutoProcessResponse(content string, result *AIProcessResu
 	}
 
 	if parsed.CleanedTitle != "" {
-		result.CleanedTitle = &parsed.CleanedTitle
+		// Post-process: remove trailing period (not suitable for todo list titles)
+		cleanedTitle := strings.TrimSuffix(parsed.CleanedTitle, ".")
+		result.CleanedTitle = &cleanedTitle
 	}
 	if parsed.Summary != "" {
 		result.Summary = &parsed.Summary
 	}
 	if parsed.DueDate != "" {
-		if t, err := time.Parse(time.RFC3339, parsed.DueDate); err == nil {
-			result.DueAt = &t
-			// RFC3339 format includes time, so HasDueTime = true
-			result.HasDueTime = true
-		} else if t, err := time.Parse("2006-01-02", parsed.DueDate); err == nil {
+		if t, err := time.Parse("2006-01-02", parsed.DueDate); err == nil {
 			result.DueAt = &t
 			// Date-only format, so HasDueTime = false
 			result.HasDueTime = false
+		} else if t, err := llm.ParseDateTime(parsed.DueDate); err == nil {
+			result.DueAt = &t
+			result.HasDueTime = true
 		}
 	}
 	if parsed.ReminderTime != "" {
-		if t, err := time.Parse(time.RFC3339, parsed.ReminderTime); err == nil {
+		if t, err := llm.ParseDateTime(parsed.ReminderTime); err == nil {
 			result.ReminderTime = &t
 		}
 	}
@@ -425,42 +395,6 @@ func (s *Service) parseAutoProcessResponse(content string, result *AIProcessResu
 	return nil
 }
 
-func (s *Service) trackAutoProcessUsage(ctx context.Context, userID uuid.UUID, tier UserTier, result *AIProcessResult) {
-	if result.CleanedTitle != nil {
-		_ = repository.IncrementAIUsage(ctx, userID, string(FeatureCleanTitle))
-	}
-	if result.Summary != nil {
-		_ = repository.IncrementAIUsage(ctx, userID, string(FeatureCleanDescription))
-	}
-	if result.DueAt != nil {
-		_ = repository.IncrementAIUsage(ctx, userID, string(FeatureSmartDueDate))
-	}
-	if result.ReminderTime != nil {
-		_ = repository.IncrementAIUsage(ctx, userID, string(FeatureReminder))
-	}
-	if tier != TierFree {
-		if result.Complexity != nil {
-			_ = repository.IncrementAIUsage(ctx, userID, string(FeatureComplexity))
-		}
-		if len(result.Entities) > 0 {
-			_ = repository.IncrementAIUsage(ctx, userID, string(FeatureEntityExtraction))
-		}
-		if result.RecurrenceRule != nil {
-			_ = repository.IncrementAIUsage(ctx, userID, string(FeatureRecurringDetection))
-		}
-		if result.SuggestedGroup != nil {
-			_ = repository.IncrementAIUsage(ctx, userID, string(FeatureAutoGroup))
-		}
-		if result.Draft != nil {
-			if result.Draft.Type == "email" {
-				_ = repository.IncrementAIUsage(ctx, userID, string(FeatureDraftEmail))
-			} else {
-				_ = repository.IncrementAIUsage(ctx, userID, string(FeatureDraftCalendar))
-			}
-		}
-	}
-}
-
 // IsAvailable returns whether the AI service is available
 func (s *Service) IsAvailable() bool {
 	return s.llm != nil
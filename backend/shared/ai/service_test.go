@@ -0,0 +1,169 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/llm"
+)
+
+// scriptedLLM returns a fake LLM that gives the answers in order
+func scriptedLLM(t *testing.T, answers ...string) (*llm.FakeClient, *llm.MultiClient) {
+	t.Helper()
+	fake, err := llm.NewFakeClient(llm.FakeReplay, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, answer := range answers {
+		fake.Script(llm.CompletionResponse{Content: answer})
+	}
+	return fake, llm.NewFakeMultiClient(fake)
+}
+
+func TestParseAutoProcessResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		check   func(t *testing.T, r *AIProcessResult)
+	}{
+		{
+			name:    "date only",
+			content: `{"cleaned_title":"Pay rent.","due_date":"2026-03-12","complexity":2}`,
+			check: func(t *testing.T, r *AIProcessResult) {
+				if r.CleanedTitle == nil || *r.CleanedTitle != "Pay rent" {
+					t.Errorf("cleaned title = %v", r.CleanedTitle)
+				}
+				if r.DueAt == nil || !r.DueAt.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)) || r.HasDueTime {
+					t.Errorf("due = %v, has time %v", r.DueAt, r.HasDueTime)
+				}
+				if r.Complexity == nil || *r.Complexity != 2 {
+					t.Errorf("complexity = %v", r.Complexity)
+				}
+			},
+		},
+		{
+			name:    "date and time",
+			content: `{"due_date":"2026-03-12T15:00:00+07:00","reminder_time":"2026-03-12T14:30"}`,
+			check: func(t *testing.T, r *AIProcessResult) {
+				if r.DueAt == nil || !r.DueAt.Equal(time.Date(2026, 3, 12, 8, 0, 0, 0, time.UTC)) || !r.HasDueTime {
+					t.Errorf("due = %v, has time %v", r.DueAt, r.HasDueTime)
+				}
+				if r.ReminderTime == nil || !r.ReminderTime.Equal(time.Date(2026, 3, 12, 14, 30, 0, 0, time.UTC)) {
+					t.Errorf("reminder = %v", r.ReminderTime)
+				}
+			},
+		},
+		{
+			name:    "empty and unreadable values are left out",
+			content: `{"cleaned_title":"","summary":"","due_date":"next friday","reminder_time":"soon","complexity":0,"entities":[]}`,
+			check: func(t *testing.T, r *AIProcessResult) {
+				if r.CleanedTitle != nil || r.Summary != nil || r.DueAt != nil || r.ReminderTime != nil || r.Complexity != nil || r.Entities != nil {
+					t.Errorf("result = %+v, want nothing set", r)
+				}
+			},
+		},
+		{
+			name: "entities, recurrence, group and draft",
+			content: `{"entities":[{"type":"person","value":"Alice"}],"recurrence_rule":"FREQ=WEEKLY;BYDAY=MO",` +
+				`"suggested_group":"Work","draft":{"type":"email","to":"Alice","subject":"Report"}}`,
+			check: func(t *testing.T, r *AIProcessResult) {
+				if len(r.Entities) != 1 || r.Entities[0].Type != "person" || r.Entities[0].Value != "Alice" {
+					t.Errorf("entities = %+v", r.Entities)
+				}
+				if r.RecurrenceRule == nil || *r.RecurrenceRule != "FREQ=WEEKLY;BYDAY=MO" {
+					t.Errorf("recurrence = %v", r.RecurrenceRule)
+				}
+				if r.SuggestedGroup == nil || *r.SuggestedGroup != "Work" {
+					t.Errorf("group = %v", r.SuggestedGroup)
+				}
+				if r.Draft == nil || r.Draft.Type != "email" || r.Draft.To != "Alice" || r.Draft.Subject != "Report" {
+					t.Errorf("draft = %+v", r.Draft)
+				}
+			},
+		},
+	}
+
+	s := NewService(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &AIProcessResult{}
+			if err := s.parseAutoProcessResponse(tt.content, result); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, result)
+		})
+	}
+
+	if err := s.parseAutoProcessResponse(`{"cleaned_title":`, &AIProcessResult{}); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestAutoProcess(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	t.Run("repairs an answer outside the schema", func(t *testing.T) {
+		fake, client := scriptedLLM(t,
+			`{"cleaned_title":"Email Alice the report","complexity":12}`,
+			"```json\n{\"cleaned_title\":\"Email Alice the report\",\"complexity\":3,\"due_date\":\"2026-03-13\"}\n```",
+		)
+		s := NewService(client)
+
+		result, resp, err := s.AutoProcess(context.Background(), uuid.New(), TierPremium, nil, "auto_process", now, "email alice report by friday", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp == nil {
+			t.Fatal("response missing")
+		}
+		if result.CleanedTitle == nil || *result.CleanedTitle != "Email Alice the report" {
+			t.Errorf("cleaned title = %v", result.CleanedTitle)
+		}
+		if result.Complexity == nil || *result.Complexity != 3 {
+			t.Errorf("complexity = %v", result.Complexity)
+		}
+		if result.PromptVersion != uuid.Nil {
+			t.Errorf("prompt version = %v, want nil for the built-in prompt", result.PromptVersion)
+		}
+
+		requests := fake.Requests()
+		if len(requests) != 2 {
+			t.Fatalf("LLM called %d times, want 2", len(requests))
+		}
+		prompt := requests[0].Messages[0].Content
+		for _, want := range []string{"Today is 2026-03-10 (Tuesday)", "Task Title: email alice report by friday", "'tomorrow' = next day", `"entities"`, `"draft"`} {
+			if !strings.Contains(prompt, want) {
+				t.Errorf("prompt is missing %q", want)
+			}
+		}
+		if requests[0].Feature != "auto_process" || requests[0].Schema == nil {
+			t.Errorf("request feature %q, schema %v", requests[0].Feature, requests[0].Schema)
+		}
+	})
+
+	t.Run("free tier prompt", func(t *testing.T) {
+		fake, client := scriptedLLM(t, `{"cleaned_title":"Email Alice"}`)
+		s := NewService(client)
+
+		if _, _, err := s.AutoProcess(context.Background(), uuid.New(), TierFree, nil, "auto_process", now, "email alice", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		prompt := fake.Requests()[0].Messages[0].Content
+		if strings.Contains(prompt, `"entities"`) || strings.Contains(prompt, `"draft"`) {
+			t.Error("free tier prompt asks for paid fields")
+		}
+	})
+
+	t.Run("call failure", func(t *testing.T) {
+		_, client := scriptedLLM(t)
+		s := NewService(client)
+
+		result, resp, err := s.AutoProcess(context.Background(), uuid.New(), TierFree, nil, "auto_process", now, "email alice", "")
+		if err == nil || result != nil || resp != nil {
+			t.Errorf("got %v, %v, %v; want only an error", result, resp, err)
+		}
+	})
+}
@@ -0,0 +1,376 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/common/errors"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/llm"
+)
+
+const (
+	aiStreamTimeout   = 2 * time.Minute  // Upper bound for one streamed AI call
+	aiStreamHeartbeat = 15 * time.Second // Keeps proxies from closing an idle stream
+)
+
+// aiCall is a prepared AI request: the prompt, and what to do with the
+// model's answer. Preparing validates the request and meters usage while the
+// fiber.Ctx is still valid; finish runs without it, so the same call serves
+// both the plain JSON endpoint and its server-sent events variant.
+type aiCall struct {
+	request llm.CompletionRequest
+	timeout time.Duration // Detaches the call from the request context when set
+
+	// finish turns the completed content into the endpoint's result
+	finish func(ctx context.Context, content string) (interface{}, error)
+	// fallback, when set, is the result to return if the LLM call fails
+	fallback func() interface{}
+
+	// metered is the feature prepare charged userID for, refunded when the
+	// answer comes from the cache and cache hits are free
+	userID  uuid.UUID
+	metered AIFeature
+}
+
+// aiPrepare builds the call for one endpoint. It returns a nil call when it
+// has already written an error response.
+type aiPrepare func(c *fiber.Ctx) (*aiCall, error)
+
+// runAI runs a prepared call and responds with JSON
+func (h *Handler) runAI(c *fiber.Ctx, prepare aiPrepare) error {
+	call, err := prepare(c)
+	if call == nil {
+		return err
+	}
+
+	ctx := context.Context(c.Context())
+	if call.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), call.timeout)
+		defer cancel()
+	}
+
+	resp, err := h.service.LLM().Complete(ctx, call.request)
+	if err != nil {
+		if call.fallback != nil {
+			return httputil.Success(c, call.fallback())
+		}
+		return httputil.Error(c, llmFailure(err))
+	}
+	if call.metered != "" {
+		h.service.RefundIfCached(ctx, call.userID, call.metered, resp)
+	}
+
+	result, err := call.finish(ctx, resp.Content)
+	if err != nil {
+		return httputil.Error(c, err)
+	}
+	return httputil.Success(c, result)
+}
+
+// streamAI runs a prepared call and streams it as server-sent events:
+//
+//	token   {"text"}                     each piece of the completion
+//	item    {"key"?, "index"?, "value"}  each structured item once it is complete
+//	result  the same data the JSON endpoint returns
+//	error   {"status", "message"}
+//
+// Validation and metering errors happen before the stream starts and are
+// ordinary JSON error responses.
+func (h *Handler) streamAI(c *fiber.Ctx, prepare aiPrepare) error {
+	call, err := prepare(c)
+	if call == nil {
+		return err
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The request context is gone once the handler returns, so the
+		// stream has its own; a failed write means the client went away and
+		// cancelling stops the provider stream too
+		timeout := call.timeout
+		if timeout <= 0 {
+			timeout = aiStreamTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		out := &sseWriter{w: w, cancel: cancel}
+		h.streamCall(ctx, call, out)
+	})
+	return nil
+}
+
+func (h *Handler) streamCall(ctx context.Context, call *aiCall, out *sseWriter) {
+	chunks, err := h.service.LLM().Stream(ctx, call.request)
+	if err != nil {
+		h.streamFailed(call, out, err)
+		return
+	}
+
+	heartbeat := time.NewTicker(aiStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	var content strings.Builder
+	var items itemScanner
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok || chunk.Done {
+				if !ok && ctx.Err() != nil {
+					h.streamFailed(call, out, ctx.Err())
+					return
+				}
+				if chunk.Err != nil {
+					h.streamFailed(call, out, chunk.Err)
+					return
+				}
+				// A repaired answer replaces what was streamed
+				answer := content.String()
+				if chunk.Replace != "" {
+					answer = chunk.Replace
+				} else if call.request.Schema != nil {
+					answer = llm.ExtractJSON(answer)
+				}
+				result, err := call.finish(ctx, answer)
+				if err != nil {
+					out.error(err)
+					return
+				}
+				out.send("result", result)
+				return
+			}
+
+			content.WriteString(chunk.Content)
+			if !out.send("token", map[string]string{"text": chunk.Content}) {
+				return
+			}
+			for _, item := range items.feed(chunk.Content) {
+				if !out.send("item", item) {
+					return
+				}
+			}
+		case <-heartbeat.C:
+			if !out.comment("keep-alive") {
+				return
+			}
+		}
+	}
+}
+
+// streamFailed reports a failed LLM call, or the call's fallback result
+func (h *Handler) streamFailed(call *aiCall, out *sseWriter, err error) {
+	if call.fallback != nil {
+		out.send("result", call.fallback())
+		return
+	}
+	out.error(llmFailure(err))
+}
+
+// llmFailure turns a failed LLM call into the error shown to the client.
+// Spend caps and content the providers refuse won't pass on a retry, so
+// they are reported as such rather than as an outage; an answer that failed
+// its schema may well pass the next time.
+func llmFailure(err error) *errors.AppError {
+	switch {
+	case errors.Is(err, llm.ErrSpendCap):
+		return errors.New(errors.ErrAIRateLimit, "daily AI budget reached, please try again tomorrow", http.StatusPaymentRequired)
+	case errors.Is(err, llm.ErrPrivacyMode):
+		return errors.New(errors.ErrAIServiceUnavailable, "privacy mode is on and the local AI model is not available", http.StatusServiceUnavailable)
+	case errors.Is(err, llm.ErrSafety):
+		return errors.New(errors.ErrAIContentBlocked, "the AI provider declined to process this content", http.StatusUnprocessableEntity)
+	case errors.Is(err, llm.ErrInvalidOutput):
+		return errors.New(errors.ErrAIServiceUnavailable, "AI returned an unusable answer, please try again", http.StatusServiceUnavailable)
+	case errors.Is(err, llm.ErrRateLimited), errors.Is(err, llm.ErrQuota):
+		return errors.New(errors.ErrAIServiceUnavailable, "AI service is busy, please try again shortly", http.StatusServiceUnavailable)
+	default:
+		return errors.New(errors.ErrAIServiceUnavailable, "AI service error", http.StatusServiceUnavailable)
+	}
+}
+
+// sseWriter writes server-sent events, cancelling the stream on the first
+// failed write
+type sseWriter struct {
+	w      *bufio.Writer
+	cancel context.CancelFunc
+	closed bool
+}
+
+func (s *sseWriter) send(event string, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return !s.closed
+	}
+	return s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+}
+
+func (s *sseWriter) comment(text string) bool {
+	return s.write(": " + text + "\n\n")
+}
+
+func (s *sseWriter) error(err error) bool {
+	message := err.Error()
+	var appErr *errors.AppError
+	if errors.IsAppError(err, &appErr) {
+		message = appErr.Message
+	}
+	return s.send("error", map[string]interface{}{
+		"status":  errors.HTTPStatusCode(err),
+		"message": message,
+	})
+}
+
+func (s *sseWriter) write(text string) bool {
+	if s.closed {
+		return false
+	}
+	if _, err := s.w.WriteString(text); err == nil {
+		err = s.w.Flush()
+		if err == nil {
+			return true
+		}
+	}
+	s.closed = true
+	s.cancel()
+	return false
+}
+
+// streamItem is one complete value from a streamed JSON answer
+type streamItem struct {
+	Key   string          `json:"key,omitempty"`
+	Index *int            `json:"index,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// itemScanner picks complete items out of a JSON answer while it is still
+// being written: the elements of a top-level array, the members of a
+// top-level object, and the elements of arrays held by those members (so
+// {"entities": [...]} yields each entity). Text before the first bracket,
+// such as a code fence, is skipped.
+type itemScanner struct {
+	buf      []byte
+	pos      int
+	stack    []byte // Open brackets
+	inString bool
+	escaped  bool
+	done     bool
+	seg      int    // Start of the current top-level element or member
+	key      string // Member whose array is being split, if any
+	elem     int    // Start of the current element in that array
+	index    int
+}
+
+// feed adds text and returns the items it completed
+func (s *itemScanner) feed(text string) []streamItem {
+	s.buf = append(s.buf, text...)
+
+	var items []streamItem
+	for ; s.pos < len(s.buf); s.pos++ {
+		ch := s.buf[s.pos]
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case ch == '\\':
+				s.escaped = true
+			case ch == '"':
+				s.inString = false
+			}
+			continue
+		}
+		if len(s.stack) == 0 {
+			if !s.done && (ch == '[' || ch == '{') {
+				s.stack = append(s.stack, ch)
+				s.seg = s.pos + 1
+			}
+			continue
+		}
+
+		depth := len(s.stack)
+		switch ch {
+		case '"':
+			s.inString = true
+		case '[', '{':
+			if depth == 1 && s.stack[0] == '{' && ch == '[' {
+				// A member holding an array: emit its elements instead
+				s.key = memberKey(s.buf[s.seg:s.pos])
+				s.elem = s.pos + 1
+				s.index = 0
+			}
+			s.stack = append(s.stack, ch)
+		case ',':
+			items = s.boundary(items, depth)
+		case ']', '}':
+			items = s.boundary(items, depth)
+			s.stack = s.stack[:depth-1]
+			s.done = len(s.stack) == 0
+		}
+	}
+	return items
+}
+
+// boundary handles a comma or closing bracket at the given depth
+func (s *itemScanner) boundary(items []streamItem, depth int) []streamItem {
+	switch {
+	case depth == 1 && s.stack[0] == '[':
+		if value := trimValue(s.buf[s.seg:s.pos]); value != nil {
+			index := s.index
+			items = append(items, streamItem{Index: &index, Value: value})
+			s.index++
+		}
+		s.seg = s.pos + 1
+
+	case depth == 1:
+		if s.key != "" {
+			s.key = "" // Its elements were already emitted
+		} else {
+			var member map[string]json.RawMessage
+			if json.Unmarshal(append(append([]byte{'{'}, s.buf[s.seg:s.pos]...), '}'), &member) == nil {
+				for key, value := range member {
+					items = append(items, streamItem{Key: key, Value: value})
+				}
+			}
+		}
+		s.seg = s.pos + 1
+
+	case depth == 2 && s.key != "":
+		if value := trimValue(s.buf[s.elem:s.pos]); value != nil {
+			index := s.index
+			items = append(items, streamItem{Key: s.key, Index: &index, Value: value})
+			s.index++
+		}
+		s.elem = s.pos + 1
+	}
+	return items
+}
+
+// trimValue returns the JSON value in b, or nil if it isn't one
+func trimValue(b []byte) json.RawMessage {
+	value := strings.TrimSpace(string(b))
+	if value == "" || !json.Valid([]byte(value)) {
+		return nil
+	}
+	return json.RawMessage(value)
+}
+
+// memberKey reads the name from an object member prefix like `"entities":`
+func memberKey(b []byte) string {
+	prefix := strings.TrimSuffix(strings.TrimSpace(string(b)), ":")
+	var key string
+	if json.Unmarshal([]byte(strings.TrimSpace(prefix)), &key) != nil {
+		return ""
+	}
+	return key
+}
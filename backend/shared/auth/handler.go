@@ -19,6 +19,7 @@ import (
 	"github.com/csaptu/flow/pkg/httputil"
 	"github.com/csaptu/flow/pkg/middleware"
 	"github.com/csaptu/flow/pkg/oauth"
+	"github.com/csaptu/flow/shared/privacy"
 	"github.com/csaptu/flow/shared/repository"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -394,9 +395,9 @@ func (h *Handler) UpdateAIPreferences(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "ai_preferences is required")
 	}
 
-	// Validate preference values (must be "auto" or "ask")
+	// Validate preference values (must be "auto", "review" or "ask")
 	// Note: "off" was removed - use "ask" (manual) instead
-	validValues := map[string]bool{"auto": true, "ask": true}
+	validValues := map[string]bool{"auto": true, "review": true, "ask": true}
 	validKeys := map[string]bool{
 		"clean_title":       true,
 		"clean_description": true,
@@ -412,7 +413,10 @@ func (h *Handler) UpdateAIPreferences(c *fiber.Ctx) error {
 			return httputil.BadRequest(c, "invalid preference key: "+key)
 		}
 		if !validValues[value] {
-			return httputil.BadRequest(c, "invalid preference value: "+value+" (must be auto or ask)")
+			return httputil.BadRequest(c, "invalid preference value: "+value+" (must be auto, review or ask)")
+		}
+		if value == "review" && !repository.IsReviewableAIFeature(key) {
+			return httputil.BadRequest(c, "review is not available for "+key)
 		}
 	}
 
@@ -476,6 +480,51 @@ func (h *Handler) GetAIPreferences(c *fiber.Ctx) error {
 	return httputil.Success(c, fiber.Map{"ai_preferences": prefs})
 }
 
+// UpdateAIPrivacyRequest turns AI privacy mode on or off
+type UpdateAIPrivacyRequest struct {
+	PrivacyMode *bool `json:"privacy_mode"`
+}
+
+// GetAIPrivacy returns whether the current user's AI calls stay on the local model
+func (h *Handler) GetAIPrivacy(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Error(c, err)
+	}
+
+	private, err := repository.GetUserAIPrivacyMode(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to get privacy mode")
+	}
+
+	return httputil.Success(c, fiber.Map{"privacy_mode": private})
+}
+
+// UpdateAIPrivacy turns the current user's AI privacy mode on or off. In
+// privacy mode every AI feature runs on the local model only, and features
+// fail while it is unavailable rather than fall back to an external provider.
+func (h *Handler) UpdateAIPrivacy(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Error(c, err)
+	}
+
+	var req UpdateAIPrivacyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if req.PrivacyMode == nil {
+		return httputil.BadRequest(c, "privacy_mode is required")
+	}
+
+	if err := repository.SetUserAIPrivacyMode(c.Context(), userID, *req.PrivacyMode); err != nil {
+		return httputil.InternalError(c, "failed to update privacy mode")
+	}
+	privacy.Forget(userID)
+
+	return httputil.Success(c, fiber.Map{"privacy_mode": *req.PrivacyMode})
+}
+
 // GoogleOAuth handles Google OAuth login/registration
 func (h *Handler) GoogleOAuth(c *fiber.Ctx) error {
 	var req OAuthRequest
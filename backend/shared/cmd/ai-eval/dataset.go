@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Case is one line of a golden dataset: a task as the user typed it and
+// what the AI features should make of it. Only the expected fields that are
+// present are scored.
+type Case struct {
+	ID          string      `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	Now         string      `json:"now,omitempty"`               // Date or RFC 3339 time relative dates are read against
+	Existing    []string    `json:"existing_subtasks,omitempty"` // For subtasks
+	Candidates  []Candidate `json:"candidates,omitempty"`        // For duplicates
+	Expected    Expected    `json:"expected"`
+
+	now time.Time
+}
+
+// Candidate is another task of the user the duplicate check compares with
+type Candidate struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Expected holds the golden answers. An empty due_date or an empty list
+// expects the feature to find nothing.
+type Expected struct {
+	CleanedTitle *string          `json:"cleaned_title,omitempty"`
+	DueDate      *string          `json:"due_date,omitempty"` // YYYY-MM-DD
+	Entities     []ExpectedEntity `json:"entities,omitempty"`
+	Subtasks     []string         `json:"subtasks,omitempty"`
+	Duplicates   []string         `json:"duplicates,omitempty"` // Candidate IDs
+}
+
+// ExpectedEntity is an entity the task mentions
+type ExpectedEntity struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// autoProcess reports whether the case needs the auto-process call
+func (c *Case) autoProcess() bool {
+	return c.Expected.CleanedTitle != nil || c.Expected.DueDate != nil || c.Expected.Entities != nil
+}
+
+// loadDataset reads a JSONL dataset; blank lines and lines starting with #
+// are skipped
+func loadDataset(path string, defaultNow time.Time) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []Case
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("line-%d", line)
+		}
+		if ids[c.ID] {
+			return nil, fmt.Errorf("line %d: duplicate case ID %q", line, c.ID)
+		}
+		ids[c.ID] = true
+		if c.Title == "" {
+			return nil, fmt.Errorf("line %d: case %s has no title", line, c.ID)
+		}
+		if c.Expected.Duplicates != nil && len(c.Candidates) == 0 {
+			return nil, fmt.Errorf("line %d: case %s expects duplicates but has no candidates", line, c.ID)
+		}
+
+		c.now = defaultNow
+		if c.Now != "" {
+			if c.now, err = parseNow(c.Now); err != nil {
+				return nil, fmt.Errorf("line %d: invalid now: %w", line, err)
+			}
+		}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("%s has no cases", path)
+	}
+	return cases, nil
+}
+
+func parseNow(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Add(9 * time.Hour), nil // Morning, so "today" and "tonight" read naturally
+	}
+	return time.Parse(time.RFC3339, s)
+}
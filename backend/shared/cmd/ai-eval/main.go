@@ -0,0 +1,366 @@
+// Command ai-eval scores the AI features against golden datasets, so a
+// prompt or model change can be checked before it ships. Cases go through
+// the same shared/ai calls and parsing as the endpoints, on any configured
+// provider or the replay provider (LLM_DEFAULT_PROVIDER=fake,
+// LLM_FAKE_MODE=replay). Two sides can be compared, each with its own
+// provider, model and prompt version:
+//
+//	ai-eval -dataset golden.jsonl -a prompt=published -b prompt=draft.json -out report
+//
+// It exits non-zero when a -gate threshold is missed or the second side
+// drops more than -max-drop below the first on any metric.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/ai"
+	"github.com/csaptu/flow/shared/prompts"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// callTimeout bounds each model call
+const callTimeout = 60 * time.Second
+
+func main() {
+	zerolog.TimeFieldFormat = time.RFC3339
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	dataset := flag.String("dataset", "", "golden dataset (JSONL)")
+	sideA := flag.String("a", "", "first side: comma-separated name=, provider=, model=, prompt= (builtin, published, a version ID or a JSON file of configs)")
+	sideB := flag.String("b", "", "second side to compare with the first, same format")
+	nowFlag := flag.String("now", "", "date relative dates are read against for cases without one (default today)")
+	only := flag.String("features", "", "comma-separated features to score (default all)")
+	fuzzy := flag.Float64("fuzzy", 0.8, "similarity that counts as a fuzzy match, 0-1")
+	tolerance := flag.Int("tolerance", 1, "days a due date may be off")
+	out := flag.String("out", "", "write the report to OUT.md and OUT.json instead of printing Markdown")
+	gate := flag.String("gate", "", "minimum metrics of the last side, e.g. cleaned_title.fuzzy=0.8,due_date.exact=0.9")
+	maxDrop := flag.Float64("max-drop", 0.05, "largest drop of any metric from the first side to the second")
+	concurrency := flag.Int("concurrency", 4, "cases run at once per side")
+	flag.Parse()
+
+	if *dataset == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	if *nowFlag != "" {
+		t, err := parseNow(*nowFlag)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid -now")
+		}
+		now = t
+	}
+	cases, err := loadDataset(*dataset, now)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load dataset")
+	}
+	enabled, err := parseFeatures(*only)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid -features")
+	}
+	thresholds, err := parseGate(*gate)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid -gate")
+	}
+
+	cfg, err := config.LoadForService("shared")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+
+	specs := []string{*sideA}
+	if *sideB != "" {
+		specs = append(specs, *sideB)
+	}
+	ctx := context.Background()
+	var sides []*side
+	for i, spec := range specs {
+		s, err := newSide(ctx, cfg, spec, string(rune('A'+i)))
+		if err != nil {
+			log.Fatal().Err(err).Str("side", spec).Msg("Failed to set up side")
+		}
+		sides = append(sides, s)
+	}
+
+	sc := scoring{fuzzy: *fuzzy, tolerance: *tolerance}
+	report := Report{
+		Dataset:     *dataset,
+		Cases:       len(cases),
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Settings:    Settings{Fuzzy: sc.fuzzy, ToleranceDays: sc.tolerance, MaxDrop: *maxDrop, Gate: thresholds},
+	}
+	for _, s := range sides {
+		log.Info().Str("side", s.Name).Str("provider", s.Provider).Str("model", s.Model).Str("prompt", s.Prompt).Int("cases", len(cases)).Msg("Running")
+		outputs := s.run(ctx, cases, enabled, *concurrency)
+		report.Sides = append(report.Sides, score(s, cases, outputs, enabled, sc))
+	}
+	report.Gate = checkGate(report.Sides, thresholds, *maxDrop)
+
+	if *out == "" {
+		fmt.Print(report.Markdown())
+	} else {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*out+".json", data, 0o644); err != nil {
+			log.Fatal().Err(err).Msg("Failed to write report")
+		}
+		if err := os.WriteFile(*out+".md", []byte(report.Markdown()), 0o644); err != nil {
+			log.Fatal().Err(err).Msg("Failed to write report")
+		}
+		log.Info().Str("report", *out+".md").Msg("Report written")
+	}
+
+	if !report.Gate.Passed {
+		log.Error().Strs("failures", report.Gate.Failures).Msg("Gate failed")
+		os.Exit(1)
+	}
+}
+
+// side is one configuration the dataset is run with
+type side struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Prompt   string `json:"prompt"`
+
+	service *ai.Service
+	version *prompts.Version
+}
+
+// fixedRoute sends every call of a side to one provider and model
+type fixedRoute llm.Route
+
+func (r fixedRoute) Routes(ctx context.Context, feature string, userID uuid.UUID) ([]llm.Route, error) {
+	return []llm.Route{llm.Route(r)}, nil
+}
+
+// newSide parses a side and builds its client. Each side has its own client
+// so its route applies to its calls only; none caches or records usage.
+func newSide(ctx context.Context, cfg *config.Config, spec, name string) (*side, error) {
+	s := &side{Name: name, Prompt: "builtin"}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", field)
+		}
+		switch key {
+		case "name":
+			s.Name = value
+		case "provider":
+			s.Provider = value
+		case "model":
+			s.Model = value
+		case "prompt":
+			s.Prompt = value
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+
+	client, err := llm.NewMultiClient(llm.Config{
+		DefaultProvider: llm.Provider(cfg.LLM.DefaultProvider),
+		AnthropicAPIKey: cfg.LLM.AnthropicAPIKey,
+		GoogleAPIKey:    cfg.LLM.GoogleAPIKey,
+		GoogleProjectID: cfg.LLM.GoogleProjectID,
+		OpenAIAPIKey:    cfg.LLM.OpenAIAPIKey,
+		OpenAIProjectID: cfg.LLM.OpenAIProjectID,
+		OllamaHost:      cfg.LLM.OllamaHost,
+		OllamaModel:     cfg.LLM.OllamaModel,
+		FakeMode:        llm.FakeMode(cfg.LLM.FakeMode),
+		CassetteDir:     cfg.LLM.CassetteDir,
+		FakeUpstream:    llm.Provider(cfg.LLM.FakeUpstream),
+		Fallbacks:       "anthropic:;openai:;google:;ollama:", // A side measures one provider
+		Retry:           llm.RetryPolicy{MaxAttempts: cfg.LLM.RetryAttempts},
+		Endpoints:       cfg.LLM.Endpoints,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM client: %w", err)
+	}
+
+	if s.Provider == "" && s.Model != "" {
+		s.Provider = cfg.LLM.DefaultProvider
+	}
+	if s.Provider != "" {
+		if !client.IsProviderAvailable(llm.Provider(s.Provider)) {
+			return nil, fmt.Errorf("provider %s is not configured", s.Provider)
+		}
+		client.EnableRouting(fixedRoute{Provider: llm.Provider(s.Provider), Model: s.Model})
+	}
+	s.service = ai.NewService(client)
+
+	if s.version, err = loadVersion(ctx, cfg, s.Prompt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadVersion finds the auto-process prompt a side runs with. The built-in
+// prompt needs no database; a JSON file of configs tries a change that
+// isn't saved yet.
+func loadVersion(ctx context.Context, cfg *config.Config, prompt string) (*prompts.Version, error) {
+	if prompt == "builtin" {
+		return nil, nil
+	}
+	if strings.HasSuffix(prompt, ".json") {
+		data, err := os.ReadFile(prompt)
+		if err != nil {
+			return nil, err
+		}
+		v := &prompts.Version{Feature: prompts.AutoProcess}
+		if err := json.Unmarshal(data, &v.Configs); err != nil {
+			return nil, fmt.Errorf("invalid configs in %s: %w", prompt, err)
+		}
+		return v, nil
+	}
+
+	if err := repository.Init(cfg); err != nil {
+		return nil, fmt.Errorf("prompt %s needs the shared database: %w", prompt, err)
+	}
+	var stored *repository.AIPromptVersion
+	var err error
+	if prompt == "published" {
+		stored, err = repository.GetPublishedAIPromptVersion(ctx, prompts.AutoProcess)
+	} else {
+		id, parseErr := uuid.Parse(prompt)
+		if parseErr != nil {
+			return nil, fmt.Errorf("prompt must be builtin, published, a version ID or a .json file")
+		}
+		stored, err = repository.GetAIPromptVersion(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt version: %w", err)
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("prompt version %s not found", prompt)
+	}
+	if stored.Feature != prompts.AutoProcess {
+		return nil, fmt.Errorf("prompt version %s is for %s, not %s", prompt, stored.Feature, prompts.AutoProcess)
+	}
+	return &prompts.Version{ID: stored.ID, Feature: stored.Feature, Number: stored.Version, Configs: stored.Configs}, nil
+}
+
+// output is what a side's calls returned for one case
+type output struct {
+	auto       *ai.AIProcessResult
+	autoErr    error
+	subtasks   []string
+	subErr     error
+	duplicates []string // Candidate IDs
+	dupErr     error
+	usage      llm.Usage
+}
+
+// run makes each case's calls, concurrency cases at a time
+func (s *side) run(ctx context.Context, cases []Case, enabled map[string]bool, concurrency int) []output {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	outputs := make([]output, len(cases))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				outputs[i] = s.runCase(ctx, &cases[i], enabled)
+			}
+		}()
+	}
+	for i := range cases {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return outputs
+}
+
+func (s *side) runCase(ctx context.Context, c *Case, enabled map[string]bool) output {
+	var out output
+	add := func(resp *llm.CompletionResponse) {
+		if resp != nil {
+			out.usage.PromptTokens += resp.Usage.PromptTokens
+			out.usage.CompletionTokens += resp.Usage.CompletionTokens
+			out.usage.TotalTokens += resp.Usage.TotalTokens
+		}
+	}
+
+	if c.autoProcess() && (enabled[featureTitle] || enabled[featureDueDate] || enabled[featureEntities]) {
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		var resp *llm.CompletionResponse
+		out.auto, resp, out.autoErr = s.service.AutoProcess(callCtx, uuid.Nil, ai.TierPremium, s.version, "auto_process", c.now, c.Title, c.Description)
+		cancel()
+		add(resp)
+	}
+
+	if c.Expected.Subtasks != nil && enabled[featureSubtasks] {
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		var resp *llm.CompletionResponse
+		out.subtasks, resp, out.subErr = s.service.SuggestSubtasks(callCtx, uuid.Nil, c.Title, c.Description, c.Existing)
+		cancel()
+		add(resp)
+	}
+
+	if c.Expected.Duplicates != nil && enabled[featureDuplicates] {
+		// IDs derive from the case, so prompts stay the same between runs
+		byID := make(map[uuid.UUID]string, len(c.Candidates))
+		candidates := make([]*repository.Task, len(c.Candidates))
+		for i, cand := range c.Candidates {
+			id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(c.ID+"/"+cand.ID))
+			byID[id] = cand.ID
+			candidates[i] = &repository.Task{ID: id, Title: cand.Title}
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+		verdict, resp, err := s.service.JudgeDuplicates(callCtx, uuid.Nil, c.Title, c.Description, candidates)
+		cancel()
+		add(resp)
+		out.dupErr = err
+		if verdict != nil {
+			out.duplicates = []string{}
+			for _, d := range verdict.Duplicates {
+				out.duplicates = append(out.duplicates, byID[d.ID])
+			}
+		}
+	}
+	return out
+}
+
+func parseFeatures(spec string) (map[string]bool, error) {
+	enabled := make(map[string]bool)
+	if spec == "" {
+		for _, f := range features {
+			enabled[f] = true
+		}
+		return enabled, nil
+	}
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		known := false
+		for _, k := range features {
+			known = known || k == f
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown feature %q, expected one of %s", f, strings.Join(features, ", "))
+		}
+		enabled[f] = true
+	}
+	return enabled, nil
+}
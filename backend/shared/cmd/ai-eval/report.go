@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/csaptu/flow/pkg/llm"
+)
+
+// maxListedFailures caps the failed checks listed per side in Markdown; the
+// JSON report has them all
+const maxListedFailures = 25
+
+// Report is the result of a run
+type Report struct {
+	Dataset     string       `json:"dataset"`
+	Cases       int          `json:"cases"`
+	GeneratedAt string       `json:"generated_at"`
+	Settings    Settings     `json:"settings"`
+	Sides       []SideReport `json:"sides"`
+	Gate        GateResult   `json:"gate"`
+}
+
+// Settings are the thresholds the run was scored with
+type Settings struct {
+	Fuzzy         float64            `json:"fuzzy"`
+	ToleranceDays int                `json:"tolerance_days"`
+	MaxDrop       float64            `json:"max_drop"`
+	Gate          map[string]float64 `json:"gate,omitempty"`
+}
+
+// SideReport is one side's scores
+type SideReport struct {
+	Name     string                  `json:"name"`
+	Provider string                  `json:"provider,omitempty"`
+	Model    string                  `json:"model,omitempty"`
+	Prompt   string                  `json:"prompt"`
+	Features map[string]FeatureScore `json:"features"`
+	Usage    llm.Usage               `json:"usage"`
+	Cases    []CaseResult            `json:"cases"`
+}
+
+// CaseResult is how one case fared
+type CaseResult struct {
+	ID     string  `json:"id"`
+	Checks []Check `json:"checks"`
+}
+
+// Check is one feature of one case
+type Check struct {
+	Feature  string `json:"feature"`
+	Pass     bool   `json:"pass"`
+	Expected string `json:"expected"`
+	Got      string `json:"got"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GateResult says whether the run may ship
+type GateResult struct {
+	Passed   bool     `json:"passed"`
+	Failures []string `json:"failures"`
+}
+
+// score compares a side's outputs with the golden answers
+func score(s *side, cases []Case, outputs []output, enabled map[string]bool, sc scoring) SideReport {
+	tallies := make(map[string]*tally, len(features))
+	for _, f := range features {
+		tallies[f] = &tally{}
+	}
+	report := SideReport{Name: s.Name, Provider: s.Provider, Model: s.Model, Prompt: s.Prompt, Features: map[string]FeatureScore{}}
+
+	for i := range cases {
+		c, out := &cases[i], outputs[i]
+		result := CaseResult{ID: c.ID}
+		// items is the number of expected items of itemized features, or -1
+		check := func(feature string, err error, expected string, items int, run func() (bool, string)) {
+			if !enabled[feature] {
+				return
+			}
+			ch := Check{Feature: feature, Expected: expected}
+			if err != nil {
+				tallies[feature].fail(items)
+				ch.Error = err.Error()
+			} else {
+				ch.Pass, ch.Got = run()
+			}
+			result.Checks = append(result.Checks, ch)
+		}
+
+		auto := out.auto
+		if e := c.Expected.CleanedTitle; e != nil {
+			check(featureTitle, out.autoErr, *e, -1, func() (bool, string) {
+				return sc.scoreTitle(tallies[featureTitle], *e, auto.CleanedTitle)
+			})
+		}
+		if e := c.Expected.DueDate; e != nil {
+			check(featureDueDate, out.autoErr, orNone(*e), -1, func() (bool, string) {
+				return sc.scoreDueDate(tallies[featureDueDate], *e, auto.DueAt)
+			})
+		}
+		if e := c.Expected.Entities; e != nil {
+			check(featureEntities, out.autoErr, entityList(e), len(e), func() (bool, string) {
+				want, got := make([]string, len(e)), make([]string, len(auto.Entities))
+				for i, ent := range e {
+					want[i] = ent.Value
+				}
+				for i, ent := range auto.Entities {
+					got[i] = ent.Value
+				}
+				same := func(i, j int) bool { return entityType(e[i].Type) == entityType(auto.Entities[j].Type) }
+				ok := scoreItems(tallies[featureEntities], want, got, sc.fuzzy, same)
+				gotEntities := make([]ExpectedEntity, len(auto.Entities))
+				for i, ent := range auto.Entities {
+					gotEntities[i] = ExpectedEntity{Type: ent.Type, Value: ent.Value}
+				}
+				return ok, entityList(gotEntities)
+			})
+		}
+		if e := c.Expected.Subtasks; e != nil {
+			check(featureSubtasks, out.subErr, strings.Join(e, "; "), len(e), func() (bool, string) {
+				return scoreItems(tallies[featureSubtasks], e, out.subtasks, subtaskMatch, nil), orNone(strings.Join(out.subtasks, "; "))
+			})
+		}
+		if e := c.Expected.Duplicates; e != nil {
+			check(featureDuplicates, out.dupErr, orNone(strings.Join(e, ", ")), len(e), func() (bool, string) {
+				return scoreItems(tallies[featureDuplicates], e, out.duplicates, 1, nil), orNone(strings.Join(out.duplicates, ", "))
+			})
+		}
+
+		report.Usage.PromptTokens += out.usage.PromptTokens
+		report.Usage.CompletionTokens += out.usage.CompletionTokens
+		report.Usage.TotalTokens += out.usage.TotalTokens
+		report.Cases = append(report.Cases, result)
+	}
+
+	for _, f := range features {
+		if tallies[f].cases > 0 {
+			report.Features[f] = tallies[f].score(f)
+		}
+	}
+	return report
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func entityList(entities []ExpectedEntity) string {
+	parts := make([]string, len(entities))
+	for i, e := range entities {
+		parts[i] = e.Type + ":" + e.Value
+	}
+	return orNone(strings.Join(parts, ", "))
+}
+
+// parseGate reads minimums written as feature.metric=value
+func parseGate(spec string) (map[string]float64, error) {
+	thresholds := make(map[string]float64)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.Contains(key, ".") {
+			return nil, fmt.Errorf("expected feature.metric=value, got %q", entry)
+		}
+		minimum, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in %q", entry)
+		}
+		thresholds[key] = minimum
+	}
+	return thresholds, nil
+}
+
+// checkGate holds the last side to the thresholds and, with two sides, the
+// second to the first within maxDrop
+func checkGate(sides []SideReport, thresholds map[string]float64, maxDrop float64) GateResult {
+	gate := GateResult{Failures: []string{}}
+	last := sides[len(sides)-1]
+
+	keys := make([]string, 0, len(thresholds))
+	for k := range thresholds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		feature, metric, _ := strings.Cut(key, ".")
+		got, ok := last.Features[feature].Metrics[metric]
+		if !ok {
+			gate.Failures = append(gate.Failures, fmt.Sprintf("%s: not measured on side %s", key, last.Name))
+			continue
+		}
+		if got < thresholds[key] {
+			gate.Failures = append(gate.Failures, fmt.Sprintf("%s: %.3f on side %s, below %.3f", key, got, last.Name, thresholds[key]))
+		}
+	}
+
+	if len(sides) == 2 {
+		base := sides[0]
+		for _, feature := range features {
+			for _, metric := range metricNames(base.Features[feature]) {
+				was, now := base.Features[feature].Metrics[metric], last.Features[feature].Metrics[metric]
+				if was-now > maxDrop+1e-9 {
+					gate.Failures = append(gate.Failures, fmt.Sprintf("%s.%s: dropped from %.3f to %.3f", feature, metric, was, now))
+				}
+			}
+		}
+	}
+
+	gate.Passed = len(gate.Failures) == 0
+	return gate
+}
+
+func metricNames(s FeatureScore) []string {
+	names := make([]string, 0, len(s.Metrics))
+	for name := range s.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Markdown renders the report for a pull request or CI summary
+func (r Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# AI eval: %s\n\n", r.Dataset)
+	fmt.Fprintf(&b, "%d cases, %s. Fuzzy match at %.2f similarity, due dates within %d day(s).\n\n",
+		r.Cases, r.GeneratedAt, r.Settings.Fuzzy, r.Settings.ToleranceDays)
+
+	b.WriteString("| Side | Provider | Model | Prompt | Tokens in / out |\n|------|----------|-------|--------|-----------------|\n")
+	for _, s := range r.Sides {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d / %d |\n", s.Name, orDefault(s.Provider), orDefault(s.Model), s.Prompt,
+			s.Usage.PromptTokens, s.Usage.CompletionTokens)
+	}
+
+	b.WriteString("\n## Scores\n\n| Feature | Metric |")
+	for _, s := range r.Sides {
+		fmt.Fprintf(&b, " %s |", s.Name)
+	}
+	if len(r.Sides) == 2 {
+		b.WriteString(" Change |")
+	}
+	b.WriteString("\n|---------|--------|")
+	for range r.Sides {
+		b.WriteString("---|")
+	}
+	if len(r.Sides) == 2 {
+		b.WriteString("---|")
+	}
+	b.WriteString("\n")
+
+	first := r.Sides[0]
+	for _, feature := range features {
+		score, ok := first.Features[feature]
+		if !ok {
+			continue
+		}
+		errors := make([]string, len(r.Sides))
+		for i, s := range r.Sides {
+			errors[i] = strconv.Itoa(s.Features[feature].Errors)
+		}
+		fmt.Fprintf(&b, "| %s (%d cases) | errors | %s |", feature, score.Cases, strings.Join(errors, " | "))
+		if len(r.Sides) == 2 {
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+
+		for _, metric := range metricNames(score) {
+			fmt.Fprintf(&b, "| | %s |", metric)
+			for _, s := range r.Sides {
+				fmt.Fprintf(&b, " %.3f |", s.Features[feature].Metrics[metric])
+			}
+			if len(r.Sides) == 2 {
+				fmt.Fprintf(&b, " %+.3f |", r.Sides[1].Features[feature].Metrics[metric]-score.Metrics[metric])
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\n## Gate\n\n")
+	if r.Gate.Passed {
+		b.WriteString("**Passed**\n")
+	} else {
+		b.WriteString("**Failed**\n\n")
+		for _, f := range r.Gate.Failures {
+			fmt.Fprintf(&b, "- %s\n", f)
+		}
+	}
+
+	for _, s := range r.Sides {
+		var failed []string
+		for _, c := range s.Cases {
+			for _, ch := range c.Checks {
+				if ch.Pass {
+					continue
+				}
+				got := ch.Got
+				if ch.Error != "" {
+					got = "error: " + ch.Error
+				}
+				failed = append(failed, fmt.Sprintf("| %s | %s | %s | %s |", c.ID, ch.Feature, cell(ch.Expected), cell(got)))
+			}
+		}
+		if len(failed) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## Failed checks, side %s (%d)\n\n| Case | Feature | Expected | Got |\n|------|---------|----------|-----|\n", s.Name, len(failed))
+		if len(failed) > maxListedFailures {
+			failed = append(failed[:maxListedFailures], fmt.Sprintf("| … | %d more in the JSON report | | |", len(failed)-maxListedFailures))
+		}
+		b.WriteString(strings.Join(failed, "\n"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func orDefault(s string) string {
+	if s == "" {
+		return "default"
+	}
+	return s
+}
+
+// cell keeps a value from breaking the table
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\n", " ")
+	if r := []rune(s); len(r) > 120 {
+		s = string(r[:120]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Features scored, in report order
+const (
+	featureTitle      = "cleaned_title"
+	featureDueDate    = "due_date"
+	featureEntities   = "entities"
+	featureSubtasks   = "subtasks"
+	featureDuplicates = "duplicates"
+)
+
+var features = []string{featureTitle, featureDueDate, featureEntities, featureSubtasks, featureDuplicates}
+
+// subtaskMatch is the similarity a produced subtask needs to count as an
+// expected one. Steps are worded more freely than titles.
+const subtaskMatch = 0.5
+
+// scoring holds the thresholds set by flags
+type scoring struct {
+	fuzzy     float64 // Similarity that counts as a fuzzy match
+	tolerance int     // Days a due date may be off
+}
+
+// tally accumulates one feature's results over the cases of a side
+type tally struct {
+	cases, errors int
+	exact, fuzzy  int     // Cases matching exactly, or within the fuzzy threshold or date tolerance
+	similarity    float64 // Sum over cases, for titles
+	tp, fp, fn    int     // Items, for entities, subtasks and duplicates
+	itemized      bool
+}
+
+// fail counts a case whose call failed as wrong on every metric. items is
+// the number of expected items of itemized features, or -1.
+func (t *tally) fail(items int) {
+	t.cases++
+	t.errors++
+	if items >= 0 {
+		t.itemized = true
+		t.fn += items
+	}
+}
+
+// FeatureScore is a feature's metrics for one side. Rates are 0-1.
+type FeatureScore struct {
+	Cases   int                `json:"cases"`
+	Errors  int                `json:"errors"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+func (t *tally) score(feature string) FeatureScore {
+	s := FeatureScore{Cases: t.cases, Errors: t.errors, Metrics: map[string]float64{}}
+	if t.cases == 0 {
+		return s
+	}
+	n := float64(t.cases)
+	s.Metrics["exact"] = float64(t.exact) / n
+	switch feature {
+	case featureTitle:
+		s.Metrics["fuzzy"] = float64(t.fuzzy) / n
+		s.Metrics["similarity"] = t.similarity / n
+	case featureDueDate:
+		s.Metrics["within_tolerance"] = float64(t.fuzzy) / n
+	}
+	if t.itemized {
+		precision, recall := ratio(t.tp, t.tp+t.fp), ratio(t.tp, t.tp+t.fn)
+		s.Metrics["precision"] = precision
+		s.Metrics["recall"] = recall
+		s.Metrics["f1"] = 0
+		if precision+recall > 0 {
+			s.Metrics["f1"] = 2 * precision * recall / (precision + recall)
+		}
+	}
+	for k, v := range s.Metrics {
+		s.Metrics[k] = math.Round(v*1000) / 1000
+	}
+	return s
+}
+
+// ratio is a/b, or 1 when there was nothing to find
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 1
+	}
+	return float64(a) / float64(b)
+}
+
+// scoreTitle compares a cleaned title with the golden one
+func (sc scoring) scoreTitle(t *tally, expected string, got *string) (bool, string) {
+	t.cases++
+	if got == nil {
+		return false, "(none)"
+	}
+	sim := similarity(*got, expected)
+	t.similarity += sim
+	if normalize(*got) == normalize(expected) {
+		t.exact++
+	}
+	if sim >= sc.fuzzy {
+		t.fuzzy++
+		return true, *got
+	}
+	return false, *got
+}
+
+// scoreDueDate compares calendar dates; an empty expected date expects none
+func (sc scoring) scoreDueDate(t *tally, expected string, got *time.Time) (bool, string) {
+	t.cases++
+	gotText := "(none)"
+	if got != nil {
+		gotText = got.Format("2006-01-02")
+	}
+	if expected == "" {
+		if got == nil {
+			t.exact++
+			t.fuzzy++
+			return true, gotText
+		}
+		return false, gotText
+	}
+	want, err := time.Parse("2006-01-02", expected)
+	if err != nil || got == nil {
+		return false, gotText
+	}
+
+	gotDay, _ := time.Parse("2006-01-02", gotText)
+	days := int(math.Abs(gotDay.Sub(want).Hours() / 24))
+	if days == 0 {
+		t.exact++
+	}
+	if days <= sc.tolerance {
+		t.fuzzy++
+		return true, gotText
+	}
+	return false, gotText
+}
+
+// scoreItems matches produced items to expected ones, each used once,
+// best pairs first
+func scoreItems(t *tally, expected, got []string, threshold float64, same func(e, g int) bool) bool {
+	t.cases++
+	t.itemized = true
+
+	type pair struct {
+		e, g int
+		sim  float64
+	}
+	var pairs []pair
+	for i := range expected {
+		for j := range got {
+			if same != nil && !same(i, j) {
+				continue
+			}
+			if sim := similarity(expected[i], got[j]); sim >= threshold {
+				pairs = append(pairs, pair{i, j, sim})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].sim > pairs[b].sim })
+
+	usedE, usedG := make(map[int]bool), make(map[int]bool)
+	matched := 0
+	for _, p := range pairs {
+		if usedE[p.e] || usedG[p.g] {
+			continue
+		}
+		usedE[p.e], usedG[p.g] = true, true
+		matched++
+	}
+
+	t.tp += matched
+	t.fp += len(got) - matched
+	t.fn += len(expected) - matched
+	ok := matched == len(expected) && matched == len(got)
+	if ok {
+		t.exact++
+	}
+	return ok
+}
+
+// entityType folds the type names the prompts use for the same thing
+func entityType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if t == "location" {
+		return "place"
+	}
+	return t
+}
+
+// normalize lowercases, drops punctuation at the ends and collapses spaces
+func normalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimFunc(s, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) })
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// similarity is the higher of the edit-distance ratio and the word overlap
+// (Dice) of two normalized strings, 0-1
+func similarity(a, b string) float64 {
+	a, b = normalize(a), normalize(b)
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	edit := 1 - float64(levenshtein(ra, rb))/float64(longest)
+
+	wa, wb := wordSet(a), wordSet(b)
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	dice := 0.0
+	if len(wa)+len(wb) > 0 {
+		dice = 2 * float64(common) / float64(len(wa)+len(wb))
+	}
+	return math.Max(edit, dice)
+}
+
+func wordSet(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		words[w] = true
+	}
+	return words
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
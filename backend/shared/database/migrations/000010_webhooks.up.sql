@@ -0,0 +1,41 @@
+-- Outgoing webhooks: user-registered endpoints and their delivery log
+CREATE TABLE webhook_endpoints (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    description VARCHAR(255),
+    secret VARCHAR(128) NOT NULL,            -- HMAC-SHA256 signing secret
+    events TEXT[] NOT NULL DEFAULT '{}',     -- e.g. {task.created, wbs.node.updated}
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- Failure tracking for auto-disable
+    failing_since TIMESTAMPTZ,               -- first failure of the current failure streak
+    disabled_at TIMESTAMPTZ,
+    disabled_reason VARCHAR(255),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_endpoints_user ON webhook_endpoints(user_id);
+CREATE INDEX idx_webhook_endpoints_events ON webhook_endpoints USING GIN(events) WHERE active;
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    endpoint_id UUID NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,                  -- same for every delivery (and replay) of one event
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, succeeded, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_status_code INTEGER,
+    last_error TEXT,
+    last_response TEXT,                      -- truncated response body
+    replay_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, created_at DESC);
@@ -0,0 +1,22 @@
+-- One row per LLM call, from every service, for cost reports and daily spend
+-- caps. tier is the user's subscription tier when the call was made.
+CREATE TABLE llm_calls (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID,                           -- NULL for system calls
+    tier VARCHAR(20),
+    feature VARCHAR(50) NOT NULL DEFAULT '',
+    provider VARCHAR(20) NOT NULL,
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0,
+    latency_ms INT NOT NULL DEFAULT 0,
+    cached BOOLEAN NOT NULL DEFAULT FALSE,
+    streamed BOOLEAN NOT NULL DEFAULT FALSE,
+    degraded BOOLEAN NOT NULL DEFAULT FALSE, -- moved to a local model by a spend cap
+    error VARCHAR(30),                       -- error kind, NULL on success
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_llm_calls_created ON llm_calls(created_at);
+CREATE INDEX idx_llm_calls_user ON llm_calls(user_id, created_at) WHERE user_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE llm_calls DROP COLUMN IF EXISTS schema_status;
@@ -0,0 +1,4 @@
+-- Outcome of checking a structured answer against its response schema:
+-- valid, repaired (passed after one repair round-trip) or invalid.
+-- NULL for calls without a schema and for cache hits.
+ALTER TABLE llm_calls ADD COLUMN schema_status VARCHAR(10);
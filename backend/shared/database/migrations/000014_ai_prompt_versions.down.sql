@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_llm_calls_prompt_version;
+ALTER TABLE llm_calls DROP COLUMN IF EXISTS prompt_version_id;
+DROP TABLE IF EXISTS ai_prompt_outcomes;
+DROP TABLE IF EXISTS ai_prompt_experiments;
+DROP TABLE IF EXISTS ai_prompt_versions;
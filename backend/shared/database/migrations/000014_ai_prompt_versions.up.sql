@@ -0,0 +1,67 @@
+-- Versioned prompt configs. A version holds every config key of one
+-- feature's prompt and never changes once created; edits make a new draft.
+-- status: draft, published (at most one per feature), archived (replaced
+-- or discarded; published_at is kept, so a rollback can find it)
+CREATE TABLE ai_prompt_versions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    feature VARCHAR(50) NOT NULL,
+    version INT NOT NULL,
+    configs JSONB NOT NULL, -- config key -> value
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    notes TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_by VARCHAR(255),
+    published_at TIMESTAMPTZ,
+    UNIQUE (feature, version)
+);
+
+CREATE UNIQUE INDEX idx_ai_prompt_versions_published ON ai_prompt_versions(feature) WHERE status = 'published';
+
+-- Traffic splits between the published version (control) and another
+-- version of the same feature. Users are assigned by a hash of their ID, so
+-- each keeps the same side for the whole experiment.
+CREATE TABLE ai_prompt_experiments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    feature VARCHAR(50) NOT NULL,
+    control_id UUID NOT NULL REFERENCES ai_prompt_versions(id),
+    variant_id UUID NOT NULL REFERENCES ai_prompt_versions(id),
+    variant_percent INT NOT NULL CHECK (variant_percent BETWEEN 1 AND 99),
+    status VARCHAR(20) NOT NULL DEFAULT 'running', -- running, stopped
+    created_by VARCHAR(255),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    stopped_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_ai_prompt_experiments_running ON ai_prompt_experiments(feature) WHERE status = 'running';
+
+-- What users did with AI output, by the prompt version that produced it.
+-- outcome: applied (written to a task), accepted, rejected (review
+-- suggestions), reverted (AI changes undone by the user)
+CREATE TABLE ai_prompt_outcomes (
+    id BIGSERIAL PRIMARY KEY,
+    version_id UUID NOT NULL REFERENCES ai_prompt_versions(id) ON DELETE CASCADE,
+    user_id UUID,
+    outcome VARCHAR(20) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_ai_prompt_outcomes_version ON ai_prompt_outcomes(version_id, created_at);
+
+ALTER TABLE llm_calls ADD COLUMN prompt_version_id UUID;
+CREATE INDEX idx_llm_calls_prompt_version ON llm_calls(prompt_version_id, created_at) WHERE prompt_version_id IS NOT NULL;
+
+-- The current configs become version 1 of each feature
+INSERT INTO ai_prompt_versions (feature, version, configs, status, notes, created_by, published_by, published_at)
+SELECT feature, 1, jsonb_object_agg(key, value), 'published', 'Imported from ai_prompt_configs', 'migration', 'migration', NOW()
+FROM (
+    SELECT key, value,
+        CASE
+            WHEN key IN ('decompose_step_count', 'decompose_rules') THEN 'decompose'
+            WHEN key = 'email_cleanup_instruction' THEN 'email_cleanup'
+            WHEN key = 'system_first_context' THEN 'first_context'
+            ELSE 'auto_process'
+        END AS feature
+    FROM ai_prompt_configs
+) c
+GROUP BY feature;
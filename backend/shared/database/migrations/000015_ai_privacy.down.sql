@@ -0,0 +1,4 @@
+ALTER TABLE llm_calls DROP COLUMN IF EXISTS private;
+ALTER TABLE llm_calls DROP COLUMN IF EXISTS redactions;
+DROP INDEX IF EXISTS idx_users_ai_privacy_mode;
+ALTER TABLE users DROP COLUMN IF EXISTS ai_privacy_mode;
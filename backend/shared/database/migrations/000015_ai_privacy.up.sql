@@ -0,0 +1,8 @@
+-- Privacy mode keeps all of a user's AI calls on the local model
+ALTER TABLE users ADD COLUMN ai_privacy_mode BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX idx_users_ai_privacy_mode ON users(id) WHERE ai_privacy_mode;
+
+-- Values replaced by placeholders before a call went to an external
+-- provider, and calls kept on the local model by privacy mode
+ALTER TABLE llm_calls ADD COLUMN redactions INT NOT NULL DEFAULT 0;
+ALTER TABLE llm_calls ADD COLUMN private BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,12 @@
+-- Which providers and models serve each AI feature, by subscription tier.
+-- feature and tier take '*' for any; the most specific row wins. steps is
+-- the ordered list tried until one answers:
+-- [{"provider": "anthropic", "model": "...", "max_tokens": 1024, "temperature": 0.3}]
+CREATE TABLE ai_model_routes (
+    feature VARCHAR(50) NOT NULL,
+    tier VARCHAR(20) NOT NULL DEFAULT '*',
+    steps JSONB NOT NULL,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (feature, tier)
+);
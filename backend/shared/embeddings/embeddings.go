@@ -0,0 +1,286 @@
+// Package embeddings keeps an embedding of every task's title and
+// description and answers nearest-neighbour queries over them: semantic
+// search, related tasks, and candidates for the duplicate detector. Ranking
+// runs in the database with pgvector when it is installed, and in process
+// otherwise.
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// ErrUnavailable is returned when no embedding provider or database is set up
+var ErrUnavailable = errors.New("semantic search is not available")
+
+// Match is a task near a query; Score is the cosine similarity (-1 to 1)
+type Match = repository.TaskEmbeddingMatch
+
+const (
+	maxTextRunes   = 4000            // Longer texts are cut before embedding
+	maxBatch       = 100             // Inputs per provider call; Google's batch limit
+	cacheTTL       = 2 * time.Minute // How long a user's vectors are kept for in-process ranking
+	shortTextRunes = 200             // Texts up to this long (queries, names) are cached
+	maxShortTexts  = 5000
+)
+
+// Index answers similarity queries over the tasks database
+type Index struct {
+	db  repository.DBTX
+	llm *llm.MultiClient
+
+	mu       sync.Mutex
+	checked  bool // Whether pgvector was looked for
+	pgvector bool
+	cache    map[uuid.UUID]cachedVectors
+	short    map[string][]float32 // Embeddings of short texts, cleared when full
+}
+
+type cachedVectors struct {
+	vectors []repository.TaskEmbeddingVector
+	loaded  time.Time
+}
+
+// New creates an index. db is the tasks database; either argument may be
+// nil, which leaves the index unavailable.
+func New(db repository.DBTX, client *llm.MultiClient) *Index {
+	return &Index{db: db, llm: client, cache: make(map[uuid.UUID]cachedVectors), short: make(map[string][]float32)}
+}
+
+// Available reports whether the index can answer queries
+func (ix *Index) Available() bool {
+	return ix != nil && ix.db != nil && ix.llm.EmbeddingModel() != ""
+}
+
+// Embed returns normalized embeddings of texts, for callers comparing
+// things other than tasks. Short texts are answered from memory when they
+// were embedded before, and the rest sent in batches.
+func (ix *Index) Embed(ctx context.Context, userID uuid.UUID, feature string, texts []string) ([][]float32, error) {
+	if !ix.Available() {
+		return nil, ErrUnavailable
+	}
+
+	vectors := make([][]float32, len(texts))
+	var missing []int
+	ix.mu.Lock()
+	for i, text := range texts {
+		if v, ok := ix.short[text]; ok {
+			vectors[i] = v
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	ix.mu.Unlock()
+
+	for start := 0; start < len(missing); start += maxBatch {
+		chunk := missing[start:min(start+maxBatch, len(missing))]
+		input := make([]string, len(chunk))
+		for j, i := range chunk {
+			input[j] = truncate(texts[i])
+		}
+		resp, err := ix.llm.Embed(ctx, llm.EmbeddingRequest{Input: input, Feature: feature, UserID: userID})
+		if err != nil {
+			return nil, err
+		}
+
+		ix.mu.Lock()
+		if len(ix.short)+len(chunk) > maxShortTexts {
+			ix.short = make(map[string][]float32)
+		}
+		for j, i := range chunk {
+			vectors[i] = llm.Normalize(resp.Vectors[j])
+			if len([]rune(texts[i])) <= shortTextRunes {
+				ix.short[texts[i]] = vectors[i]
+			}
+		}
+		ix.mu.Unlock()
+	}
+	return vectors, nil
+}
+
+// Search ranks a user's tasks by similarity to a free-text query
+func (ix *Index) Search(ctx context.Context, userID uuid.UUID, query string, limit int) ([]Match, error) {
+	vectors, err := ix.Embed(ctx, userID, "semantic_search", []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return ix.Nearest(ctx, userID, vectors[0], nil, limit)
+}
+
+// Related ranks a user's other tasks by similarity to one task. text is the
+// task's title and description, embedded on the spot if the refresher
+// hasn't stored the task's embedding yet.
+func (ix *Index) Related(ctx context.Context, userID, taskID uuid.UUID, text string, limit int) ([]Match, error) {
+	vector, err := ix.taskVector(ctx, userID, taskID, text)
+	if err != nil {
+		return nil, err
+	}
+	return ix.Nearest(ctx, userID, vector, []uuid.UUID{taskID}, limit)
+}
+
+func (ix *Index) taskVector(ctx context.Context, userID, taskID uuid.UUID, text string) ([]float32, error) {
+	if !ix.Available() {
+		return nil, ErrUnavailable
+	}
+	vector, err := repository.GetTaskEmbedding(ctx, ix.db, userID, taskID, ix.llm.EmbeddingModel())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task embedding: %w", err)
+	}
+	if vector != nil {
+		return vector, nil
+	}
+	vectors, err := ix.Embed(ctx, userID, "related_tasks", []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// Nearest ranks a user's tasks, except those in exclude, by similarity to a
+// vector and returns the best limit
+func (ix *Index) Nearest(ctx context.Context, userID uuid.UUID, vector []float32, exclude []uuid.UUID, limit int) ([]Match, error) {
+	if !ix.Available() {
+		return nil, ErrUnavailable
+	}
+	model := ix.llm.EmbeddingModel()
+	if ix.hasPgvector(ctx) {
+		return repository.NearestTaskEmbeddings(ctx, ix.db, userID, model, vector, exclude, limit)
+	}
+
+	vectors, err := ix.userVectors(ctx, userID, model)
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[uuid.UUID]bool, len(exclude))
+	for _, id := range exclude {
+		skip[id] = true
+	}
+	matches := make([]Match, 0, len(vectors))
+	for _, v := range vectors {
+		if !skip[v.TaskID] {
+			matches = append(matches, Match{TaskID: v.TaskID, Score: llm.Cosine(vector, v.Vector)})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// hasPgvector looks for the extension once
+func (ix *Index) hasPgvector(ctx context.Context) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.checked {
+		ok, err := repository.HasPgvector(ctx, ix.db)
+		if err != nil {
+			return false // Try again next time
+		}
+		ix.checked, ix.pgvector = true, ok
+		if !ok {
+			fmt.Printf("[Embeddings] pgvector not installed, ranking in process\n")
+		}
+	}
+	return ix.pgvector
+}
+
+// userVectors returns a user's stored vectors, cached briefly so a burst of
+// queries reads them once
+func (ix *Index) userVectors(ctx context.Context, userID uuid.UUID, model string) ([]repository.TaskEmbeddingVector, error) {
+	ix.mu.Lock()
+	cached, ok := ix.cache[userID]
+	ix.mu.Unlock()
+	if ok && time.Since(cached.loaded) < cacheTTL {
+		return cached.vectors, nil
+	}
+
+	vectors, err := repository.ListTaskEmbeddings(ctx, ix.db, userID, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task embeddings: %w", err)
+	}
+	ix.mu.Lock()
+	for id, c := range ix.cache {
+		if time.Since(c.loaded) >= cacheTTL {
+			delete(ix.cache, id)
+		}
+	}
+	ix.cache[userID] = cachedVectors{vectors: vectors, loaded: time.Now()}
+	ix.mu.Unlock()
+	return vectors, nil
+}
+
+// Refresh embeds up to batch tasks that are new or whose title or
+// description changed, and returns how many it stored. db is the index's
+// database or a transaction on it, so the caller can hold a lock that keeps
+// other replicas from embedding the same tasks. Tasks of users in privacy
+// mode are only embedded by a local model.
+func (ix *Index) Refresh(ctx context.Context, db repository.DBTX, batch int) (int, error) {
+	if !ix.Available() {
+		return 0, ErrUnavailable
+	}
+	model := ix.llm.EmbeddingModel()
+	var private []uuid.UUID
+	if !strings.HasPrefix(model, string(llm.ProviderOllama)+"/") {
+		var err error
+		if private, err = repository.ListAIPrivacyModeUserIDs(ctx); err != nil {
+			return 0, fmt.Errorf("failed to list users in privacy mode: %w", err)
+		}
+	}
+	stale, err := repository.GetStaleTaskEmbeddings(ctx, db, model, private, batch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stale embeddings: %w", err)
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	// Each user's tasks are embedded as theirs, under their privacy mode
+	byUser := make(map[uuid.UUID][]repository.StaleTaskEmbedding)
+	for _, s := range stale {
+		byUser[s.UserID] = append(byUser[s.UserID], s)
+	}
+
+	stored := 0
+	for userID, tasks := range byUser {
+		texts := make([]string, len(tasks))
+		for i, s := range tasks {
+			texts[i] = s.Text
+		}
+		vectors, err := ix.Embed(ctx, userID, "task_embedding", texts)
+		if errors.Is(err, llm.ErrPrivacyMode) {
+			continue // Turned on since the list was read
+		}
+		if err != nil {
+			return stored, err
+		}
+
+		for i, s := range tasks {
+			if err := repository.UpsertTaskEmbedding(ctx, db, s, model, vectors[i]); err != nil {
+				return stored, fmt.Errorf("failed to store embedding: %w", err)
+			}
+			stored++
+		}
+		ix.mu.Lock()
+		delete(ix.cache, userID)
+		ix.mu.Unlock()
+	}
+	return stored, nil
+}
+
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) > maxTextRunes {
+		return string(runes[:maxTextRunes])
+	}
+	return text
+}
@@ -0,0 +1,93 @@
+// Package llmcache stores cached LLM responses in Redis and holds the cache
+// rules shared by the services.
+package llmcache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/pkg/llm"
+)
+
+// RedisStore is an llm.CacheStore backed by Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store on an existing Redis client
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Get implements llm.CacheStore
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Set implements llm.CacheStore
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Rules are the cache rules by CompletionRequest.Feature. Only features whose
+// answer depends on nothing but the prompt are cached; their temperatures are
+// low enough that a repeat answer is as good as a new one.
+var Rules = map[string]llm.CacheRule{
+	"auto_process":      {TTL: 24 * time.Hour, AnyTemperature: true},
+	"clean_title":       {TTL: 7 * 24 * time.Hour, AnyTemperature: true},
+	"clean_description": {TTL: 7 * 24 * time.Hour, AnyTemperature: true},
+	"complexity":        {TTL: 7 * 24 * time.Hour, AnyTemperature: true},
+	"entity_extraction": {TTL: 24 * time.Hour, AnyTemperature: true},
+	"entity_match":      {TTL: 7 * 24 * time.Hour, AnyTemperature: true},
+	"duplicate_check":   {TTL: time.Hour, AnyTemperature: true},
+}
+
+// Enable turns on response caching for a client when configured
+func Enable(mc *llm.MultiClient, client *redis.Client, cfg config.LLMConfig) {
+	if mc == nil || client == nil || !cfg.CacheEnabled {
+		return
+	}
+	mc.EnableCache(NewRedisStore(client), llm.CacheConfig{
+		Features: Rules,
+		FreeHits: cfg.CacheFreeHits,
+	})
+}
+
+// Report is the cache's hit and miss counts for the admin API. Counts are per
+// process and reset on restart.
+type Report struct {
+	Enabled  bool                      `json:"enabled"`
+	FreeHits bool                      `json:"free_hits"`
+	Total    llm.CacheStats            `json:"total"`
+	HitRate  float64                   `json:"hit_rate"` // Hits over hits + misses
+	Features map[string]llm.CacheStats `json:"features"`
+}
+
+// Stats builds the report for a client
+func Stats(mc *llm.MultiClient) Report {
+	if mc == nil {
+		return Report{Features: map[string]llm.CacheStats{}}
+	}
+
+	report := Report{
+		Enabled:  mc.CacheEnabled(),
+		FreeHits: mc.FreeCacheHits(),
+		Features: mc.CacheStats(),
+	}
+	for _, s := range report.Features {
+		report.Total.Hits += s.Hits
+		report.Total.Misses += s.Misses
+		report.Total.Bypassed += s.Bypassed
+		report.Total.Errors += s.Errors
+	}
+	if lookups := report.Total.Hits + report.Total.Misses; lookups > 0 {
+		report.HitRate = float64(report.Total.Hits) / float64(lookups)
+	}
+	return report
+}
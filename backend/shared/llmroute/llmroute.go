@@ -0,0 +1,202 @@
+// Package llmroute serves the AI model routing table to the LLM client:
+// which providers and models answer each feature for each subscription
+// tier. Admin edits reach every replica through Redis pub/sub.
+package llmroute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Any matches every feature or tier
+const Any = "*"
+
+// Channel is where routing table changes are announced
+const Channel = "ai:routes:changed"
+
+const (
+	// retryAfter limits how often a failed load is retried
+	retryAfter = time.Minute
+	// tierTTL bounds how long a changed subscription keeps its old routes
+	tierTTL = time.Minute
+)
+
+type key struct{ feature, tier string }
+
+var (
+	mu       sync.RWMutex
+	table    map[key][]llm.Route
+	loadedAt time.Time
+	failedAt time.Time
+)
+
+var tiers = struct {
+	sync.Mutex
+	byUser map[uuid.UUID]cachedTier
+}{byUser: make(map[uuid.UUID]cachedTier)}
+
+type cachedTier struct {
+	tier   string
+	loaded time.Time
+}
+
+// Decode parses the steps of a table entry
+func Decode(steps []byte) ([]llm.Route, error) {
+	var routes []llm.Route
+	if err := json.Unmarshal(steps, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// Load reads the routing table
+func Load(ctx context.Context) error {
+	rows, err := repository.ListAIModelRoutes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load model routes: %w", err)
+	}
+
+	newTable := make(map[key][]llm.Route, len(rows))
+	for _, r := range rows {
+		routes, err := Decode(r.Steps)
+		if err != nil {
+			fmt.Printf("[Routes] Skipping %s/%s: %v\n", r.Feature, r.Tier, err)
+			continue
+		}
+		newTable[key{r.Feature, r.Tier}] = routes
+	}
+
+	mu.Lock()
+	table, loadedAt = newTable, time.Now()
+	mu.Unlock()
+	return nil
+}
+
+// ensureLoaded loads on first use, retrying a failed load at most once a minute
+func ensureLoaded(ctx context.Context) {
+	mu.RLock()
+	ok := !loadedAt.IsZero() || time.Since(failedAt) < retryAfter
+	mu.RUnlock()
+	if ok {
+		return
+	}
+	if err := Load(ctx); err != nil {
+		fmt.Printf("[Routes] %v, using the default provider\n", err)
+		mu.Lock()
+		failedAt = time.Now()
+		mu.Unlock()
+	}
+}
+
+// Source is an llm.RouteSource over the routing table
+type Source struct{}
+
+// Routes implements llm.RouteSource. The most specific entry wins: the
+// feature and the user's tier, the feature for any tier, any feature for
+// the tier, then any feature for any tier. Calls without a user only match
+// entries for any tier.
+func (Source) Routes(ctx context.Context, feature string, userID uuid.UUID) ([]llm.Route, error) {
+	ensureLoaded(ctx)
+
+	mu.RLock()
+	empty := len(table) == 0
+	mu.RUnlock()
+	if empty {
+		return nil, nil
+	}
+
+	tier := Any
+	if userID != uuid.Nil {
+		var err error
+		if tier, err = userTier(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, k := range []key{{feature, tier}, {feature, Any}, {Any, tier}, {Any, Any}} {
+		if routes, ok := table[k]; ok {
+			return routes, nil
+		}
+	}
+	return nil, nil
+}
+
+func userTier(ctx context.Context, userID uuid.UUID) (string, error) {
+	tiers.Lock()
+	cached, ok := tiers.byUser[userID]
+	tiers.Unlock()
+	if ok && time.Since(cached.loaded) < tierTTL {
+		return cached.tier, nil
+	}
+
+	tier, err := repository.GetUserTier(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tier: %w", err)
+	}
+
+	tiers.Lock()
+	for id, c := range tiers.byUser {
+		if time.Since(c.loaded) >= tierTTL {
+			delete(tiers.byUser, id)
+		}
+	}
+	tiers.byUser[userID] = cachedTier{tier: tier, loaded: time.Now()}
+	tiers.Unlock()
+	return tier, nil
+}
+
+// Enable routes the client's calls through the routing table
+func Enable(mc *llm.MultiClient) {
+	if mc == nil {
+		return
+	}
+	mc.EnableRouting(Source{})
+}
+
+// Listen reloads whenever another replica announces a change, until ctx is
+// done
+func Listen(ctx context.Context, client *redis.Client) {
+	if client == nil {
+		return
+	}
+	sub := client.Subscribe(ctx, Channel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := Load(ctx); err != nil {
+				fmt.Printf("[Routes] Reload failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// Notify reloads this replica and tells the others to reload
+func Notify(ctx context.Context, client *redis.Client) {
+	if err := Load(ctx); err != nil {
+		fmt.Printf("[Routes] Reload failed: %v\n", err)
+	}
+	if client == nil {
+		return
+	}
+	if err := client.Publish(ctx, Channel, time.Now().Unix()).Err(); err != nil {
+		fmt.Printf("[Routes] Failed to announce change: %v\n", err)
+	}
+}
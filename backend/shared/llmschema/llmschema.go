@@ -0,0 +1,180 @@
+// Package llmschema holds the response schemas of the AI features, shared
+// by the services so each feature's answer is checked the same way
+// wherever it is asked for.
+package llmschema
+
+import (
+	"github.com/csaptu/flow/pkg/llm"
+)
+
+// EntityTypes are the kinds of entity the models may extract. Auto-process
+// prompts say "place" where the extract prompts say "location"; both are
+// accepted.
+var EntityTypes = []string{"person", "place", "location", "organization", "date", "email", "phone"}
+
+func str(description string) *llm.Schema {
+	return &llm.Schema{Type: "string", Description: description}
+}
+
+func dateTime(description string) *llm.Schema {
+	return &llm.Schema{Type: "string", Format: "date-time", Description: description}
+}
+
+func complexity() *llm.Schema {
+	return &llm.Schema{Type: "integer", Minimum: llm.Bound(1.0), Maximum: llm.Bound(10.0), Description: "1 = trivial, 10 = very complex"}
+}
+
+func entities() *llm.Schema {
+	return &llm.Schema{
+		Type: "array",
+		Items: &llm.Schema{
+			Type: "object",
+			Properties: map[string]*llm.Schema{
+				"type":  {Type: "string", Enum: EntityTypes},
+				"value": {Type: "string"},
+			},
+			Required: []string{"type", "value"},
+		},
+	}
+}
+
+// draft is an email or calendar draft; which fields apply depends on type
+func draft() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"type":       {Type: "string", Enum: []string{"email", "calendar"}},
+			"to":         str("Recipient, if mentioned"),
+			"subject":    str("Email subject"),
+			"body":       str("Email body or event description"),
+			"title":      str("Calendar event title"),
+			"start_time": dateTime("Event start"),
+			"end_time":   dateTime("Event end"),
+			"attendees":  {Type: "array", Items: &llm.Schema{Type: "string"}},
+		},
+		Required: []string{"type"},
+	}
+}
+
+// AutoProcess is the combined answer of auto-processing on save. Every
+// field is optional since the prompt asks to leave out what doesn't apply.
+func AutoProcess() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"cleaned_title":   str("Concise, action-oriented title"),
+			"summary":         str("Brief summary of a long description"),
+			"due_date":        {Type: "string", Format: "date-or-time", Description: "ISO 8601 date, or datetime if a time is given"},
+			"reminder_time":   dateTime("When to remind"),
+			"complexity":      complexity(),
+			"entities":        entities(),
+			"recurrence_rule": str("RRULE string"),
+			"suggested_group": str("Category suggestion"),
+			"draft":           draft(),
+		},
+	}
+}
+
+// Subtasks is a list of new subtask titles
+func Subtasks() *llm.Schema {
+	return &llm.Schema{
+		Type:     "array",
+		Items:    &llm.Schema{Type: "string", MaxLength: llm.Bound(200)},
+		MinItems: llm.Bound(1),
+		MaxItems: llm.Bound(5),
+	}
+}
+
+// Steps is a numbered breakdown of a task into at most 5 steps
+func Steps() *llm.Schema {
+	return &llm.Schema{
+		Type: "array",
+		Items: &llm.Schema{
+			Type: "object",
+			Properties: map[string]*llm.Schema{
+				"step":   {Type: "integer", Minimum: llm.Bound(1.0)},
+				"action": {Type: "string"},
+				"done":   {Type: "boolean"},
+			},
+			Required: []string{"step", "action"},
+		},
+		MinItems: llm.Bound(1),
+		MaxItems: llm.Bound(5),
+	}
+}
+
+// Clean is a cleaned title and/or description with change flags. The
+// tasks service's variant answers with a title and summary instead.
+func Clean() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"title":               {Type: "string"},
+			"title_changed":       {Type: "boolean"},
+			"description":         {Type: "string"},
+			"description_changed": {Type: "boolean"},
+			"summary":             {Type: "string"},
+		},
+	}
+}
+
+// Rating is a complexity rating with its reason
+func Rating() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"complexity": complexity(),
+			"reason":     {Type: "string", MaxLength: llm.Bound(200)},
+		},
+		Required: []string{"complexity"},
+	}
+}
+
+// Entities is the entities found in a task
+func Entities() *llm.Schema {
+	return &llm.Schema{
+		Type:       "object",
+		Properties: map[string]*llm.Schema{"entities": entities()},
+		Required:   []string{"entities"},
+	}
+}
+
+// Reminder is a suggested reminder time with its reason
+func Reminder() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"reminder_time": dateTime("ISO 8601 datetime"),
+			"reason":        {Type: "string", MaxLength: llm.Bound(200)},
+		},
+		Required: []string{"reminder_time"},
+	}
+}
+
+// Email is an email draft
+func Email() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"to":      str("Recipient if mentioned, otherwise empty"),
+			"subject": str("Clear, concise subject"),
+			"body":    str("Email body with greeting and sign-off placeholder"),
+		},
+		Required: []string{"subject", "body"},
+	}
+}
+
+// Invite is a calendar event draft
+func Invite() *llm.Schema {
+	return &llm.Schema{
+		Type: "object",
+		Properties: map[string]*llm.Schema{
+			"title":      str("Event title"),
+			"start_time": dateTime("ISO 8601 datetime"),
+			"end_time":   dateTime("ISO 8601 datetime"),
+			"attendees":  {Type: "array", Items: &llm.Schema{Type: "string"}},
+			"body":       str("Event description or agenda"),
+		},
+		Required: []string{"title", "start_time", "end_time"},
+	}
+}
@@ -0,0 +1,141 @@
+// Package llmusage records LLM calls and their cost in the shared database
+// and builds the admin usage reports.
+package llmusage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Store is an llm.UsageStore on the llm_calls table
+type Store struct{}
+
+// RecordCall implements llm.UsageStore
+func (Store) RecordCall(ctx context.Context, rec llm.CallRecord) error {
+	call := &repository.LLMCall{
+		Feature:          rec.Feature,
+		Provider:         string(rec.Provider),
+		Model:            rec.Model,
+		PromptTokens:     rec.Usage.PromptTokens,
+		CompletionTokens: rec.Usage.CompletionTokens,
+		CostUSD:          rec.CostUSD,
+		LatencyMs:        int(rec.Latency.Milliseconds()),
+		Cached:           rec.Cached,
+		Streamed:         rec.Streamed,
+		Degraded:         rec.Degraded,
+
+		Redactions: rec.Redactions,
+		Private:    rec.Private,
+	}
+	if rec.Schema != "" {
+		call.SchemaStatus = &rec.Schema
+	}
+	if rec.UserID != uuid.Nil {
+		call.UserID = &rec.UserID
+	}
+	if rec.PromptVersion != uuid.Nil {
+		call.PromptVersionID = &rec.PromptVersion
+	}
+	if rec.Err != nil {
+		kind := llm.ErrorKind(rec.Err)
+		call.Error = &kind
+	}
+	return repository.CreateLLMCall(ctx, call)
+}
+
+// DailySpend implements llm.UsageStore
+func (Store) DailySpend(ctx context.Context, userID uuid.UUID) (float64, float64, error) {
+	return repository.GetDailyLLMSpend(ctx, userID)
+}
+
+// Enable records the client's calls and applies the configured spend caps
+func Enable(mc *llm.MultiClient, cfg config.LLMConfig) {
+	if mc == nil {
+		return
+	}
+	prices, err := llm.ParsePrices(cfg.Prices)
+	if err != nil {
+		fmt.Printf("Warning: %v, using default prices\n", err)
+	}
+	mc.EnableUsage(Store{}, llm.UsageConfig{
+		Prices: prices,
+		Caps: llm.SpendCaps{
+			PerUser: cfg.UserDailySpendCap,
+			Global:  cfg.GlobalDailySpendCap,
+		},
+	})
+}
+
+// Report is LLM usage over the last days, broken down for the admin API
+type Report struct {
+	Since      time.Time                `json:"since"`
+	Caps       Caps                     `json:"caps"`
+	Total      repository.LLMUsageRow   `json:"total"`
+	ByDay      []repository.LLMUsageRow `json:"by_day"`
+	ByTier     []repository.LLMUsageRow `json:"by_tier"`
+	ByFeature  []repository.LLMUsageRow `json:"by_feature"`
+	ByProvider []repository.LLMUsageRow `json:"by_provider"`
+}
+
+// Caps are the configured daily spend caps in USD; 0 is no cap
+type Caps struct {
+	PerUser float64 `json:"per_user"`
+	Global  float64 `json:"global"`
+}
+
+// BuildReport sums usage since midnight days-1 days ago
+func BuildReport(ctx context.Context, days int, cfg config.LLMConfig) (*Report, error) {
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1-days)
+	report := &Report{
+		Since: since,
+		Caps:  Caps{PerUser: cfg.UserDailySpendCap, Global: cfg.GlobalDailySpendCap},
+		Total: repository.LLMUsageRow{Key: "total"},
+	}
+
+	groups := []struct {
+		name string
+		rows *[]repository.LLMUsageRow
+	}{
+		{"day", &report.ByDay},
+		{"tier", &report.ByTier},
+		{"feature", &report.ByFeature},
+		{"provider", &report.ByProvider},
+	}
+	for _, g := range groups {
+		rows, err := repository.GetLLMUsageReport(ctx, since, g.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to report usage by %s: %w", g.name, err)
+		}
+		*g.rows = rows
+	}
+
+	// Every call falls in exactly one day, so the days add up to the total
+	var latency float64
+	for _, r := range report.ByDay {
+		report.Total.Calls += r.Calls
+		report.Total.PromptTokens += r.PromptTokens
+		report.Total.CompletionTokens += r.CompletionTokens
+		report.Total.CostUSD += r.CostUSD
+		report.Total.CacheHits += r.CacheHits
+		report.Total.Degraded += r.Degraded
+		report.Total.Errors += r.Errors
+		report.Total.SchemaChecked += r.SchemaChecked
+		report.Total.SchemaRepaired += r.SchemaRepaired
+		report.Total.SchemaInvalid += r.SchemaInvalid
+		report.Total.Redactions += r.Redactions
+		report.Total.Private += r.Private
+		latency += r.AvgLatencyMs * float64(r.Calls-r.CacheHits)
+	}
+	report.Total.SetSchemaFailureRate()
+	if uncached := report.Total.Calls - report.Total.CacheHits; uncached > 0 {
+		report.Total.AvgLatencyMs = latency / float64(uncached)
+	}
+	return report, nil
+}
@@ -0,0 +1,149 @@
+// Package privacy decides what a user's AI calls may send to external
+// providers: the names to redact, from the user's entity directory, and
+// whether privacy mode keeps every call on the local model.
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+const (
+	// modeTTL bounds how long another service keeps using a privacy mode
+	// the user has just changed
+	modeTTL  = 30 * time.Second
+	namesTTL = 5 * time.Minute
+)
+
+// keepNames are the features whose prompts compare names, which
+// placeholders would make meaningless
+var keepNames = map[string]bool{
+	"entity_match": true,
+}
+
+// Lookups are cached per process and shared by every policy, so Forget
+// reaches the one the handlers' client uses
+var cache = struct {
+	sync.Mutex
+	modes map[uuid.UUID]cachedMode
+	names map[uuid.UUID]cachedNames
+}{modes: make(map[uuid.UUID]cachedMode), names: make(map[uuid.UUID]cachedNames)}
+
+type cachedMode struct {
+	private bool
+	loaded  time.Time
+}
+
+type cachedNames struct {
+	names  []llm.PrivateName
+	loaded time.Time
+}
+
+// Policy is an llm.PrivacyPolicy over the shared and tasks databases
+type Policy struct {
+	db repository.DBTX // Tasks database, for entity names; nil redacts patterns only
+}
+
+// PrivacyMode implements llm.PrivacyPolicy
+func (p Policy) PrivacyMode(ctx context.Context, userID uuid.UUID) (bool, error) {
+	cache.Lock()
+	cached, ok := cache.modes[userID]
+	cache.Unlock()
+	if ok && time.Since(cached.loaded) < modeTTL {
+		return cached.private, nil
+	}
+
+	private, err := repository.GetUserAIPrivacyMode(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read privacy mode: %w", err)
+	}
+	cache.Lock()
+	cache.modes[userID] = cachedMode{private: private, loaded: time.Now()}
+	cache.Unlock()
+	return private, nil
+}
+
+// KnownNames implements llm.PrivacyPolicy
+func (p Policy) KnownNames(ctx context.Context, userID uuid.UUID) ([]llm.PrivateName, error) {
+	if p.db == nil {
+		return nil, nil
+	}
+	cache.Lock()
+	cached, ok := cache.names[userID]
+	cache.Unlock()
+	if ok && time.Since(cached.loaded) < namesTTL {
+		return cached.names, nil
+	}
+
+	entities, err := repository.ListEntityNames(ctx, p.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entity names: %w", err)
+	}
+	names := make([]llm.PrivateName, len(entities))
+	for i, e := range entities {
+		names[i] = llm.PrivateName{Value: e.Name, Type: e.Type}
+	}
+
+	cache.Lock()
+	for id, c := range cache.names {
+		if time.Since(c.loaded) >= namesTTL {
+			delete(cache.names, id)
+		}
+	}
+	cache.names[userID] = cachedNames{names: names, loaded: time.Now()}
+	cache.Unlock()
+	return names, nil
+}
+
+// Forget drops a user's cached privacy mode after it changed
+func Forget(userID uuid.UUID) {
+	cache.Lock()
+	delete(cache.modes, userID)
+	cache.Unlock()
+}
+
+// Enable redacts the client's calls to external providers and applies
+// privacy mode. db is the tasks database, or nil where it isn't connected.
+func Enable(mc *llm.MultiClient, db repository.DBTX) {
+	if mc == nil {
+		return
+	}
+	mc.EnableRedaction(Policy{db: db}, llm.RedactionConfig{KeepNames: keepNames})
+}
+
+// Report is the redaction counts for the admin API. Counts are per process
+// and reset on restart.
+type Report struct {
+	Enabled  bool                          `json:"enabled"`
+	Total    llm.RedactionStats            `json:"total"`
+	Features map[string]llm.RedactionStats `json:"features"`
+}
+
+// Stats builds the report for a client
+func Stats(mc *llm.MultiClient) Report {
+	if mc == nil {
+		return Report{Features: map[string]llm.RedactionStats{}}
+	}
+
+	report := Report{Enabled: mc.RedactionEnabled(), Features: mc.RedactionStats()}
+	for _, s := range report.Features {
+		report.Total.Checked += s.Checked
+		report.Total.Redacted += s.Redacted
+		report.Total.Emails += s.Emails
+		report.Total.Phones += s.Phones
+		report.Total.Cards += s.Cards
+		report.Total.Addresses += s.Addresses
+		report.Total.Names += s.Names
+		report.Total.Restored += s.Restored
+		report.Total.LocalOnly += s.LocalOnly
+		report.Total.Refused += s.Refused
+		report.Total.Errors += s.Errors
+	}
+	return report
+}
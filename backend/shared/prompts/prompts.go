@@ -0,0 +1,212 @@
+// Package prompts serves the published prompt version of each AI feature,
+// assigns users to the sides of running experiments, and keeps every
+// replica on the same versions through Redis pub/sub.
+package prompts
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Features that have versioned prompts
+const (
+	AutoProcess  = "auto_process"
+	Decompose    = "decompose"
+	EmailCleanup = "email_cleanup"
+	FirstContext = "first_context"
+)
+
+// Features maps each feature to the config keys its versions hold
+var Features = map[string][]string{
+	AutoProcess: {
+		"clean_title_instruction", "summary_instruction", "complexity_instruction",
+		"due_date_instruction", "reminder_instruction", "entities_instruction",
+		"recurrence_instruction", "suggested_group_instruction",
+	},
+	Decompose:    {"decompose_step_count", "decompose_rules"},
+	EmailCleanup: {"email_cleanup_instruction"},
+	FirstContext: {"system_first_context"},
+}
+
+// FeatureOf returns the feature a config key belongs to. Keys not listed in
+// Features are auto-process instructions, as in the migration that imported
+// them.
+func FeatureOf(key string) string {
+	for feature, keys := range Features {
+		for _, k := range keys {
+			if k == key {
+				return feature
+			}
+		}
+	}
+	return AutoProcess
+}
+
+// Channel is where publishes and experiment changes are announced
+const Channel = "ai:prompts:changed"
+
+// retryAfter limits how often a failed load is retried by For
+const retryAfter = time.Minute
+
+// Version is the prompt configs a request is built from
+type Version struct {
+	ID      uuid.UUID
+	Feature string
+	Number  int
+	Configs map[string]string
+}
+
+// Get returns a config value, or def if the version doesn't set it. A nil
+// Version returns def, so callers work before any version is loaded.
+func (v *Version) Get(key, def string) string {
+	if v == nil {
+		return def
+	}
+	if val, ok := v.Configs[key]; ok && val != "" {
+		return val
+	}
+	return def
+}
+
+// VersionID is the version's ID, or uuid.Nil for a nil Version
+func (v *Version) VersionID() uuid.UUID {
+	if v == nil {
+		return uuid.Nil
+	}
+	return v.ID
+}
+
+type experiment struct {
+	id      uuid.UUID
+	variant *Version
+	percent int
+}
+
+var (
+	mu          sync.RWMutex
+	published   map[string]*Version
+	experiments map[string]experiment
+	loadedAt    time.Time
+	failedAt    time.Time
+)
+
+func newVersion(v *repository.AIPromptVersion) *Version {
+	return &Version{ID: v.ID, Feature: v.Feature, Number: v.Version, Configs: v.Configs}
+}
+
+// Load reads the published versions and running experiments
+func Load(ctx context.Context) error {
+	versions, err := repository.GetPublishedAIPromptVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt versions: %w", err)
+	}
+	running, err := repository.GetRunningAIPromptExperiments(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt experiments: %w", err)
+	}
+
+	newPublished := make(map[string]*Version, len(versions))
+	for i := range versions {
+		newPublished[versions[i].Feature] = newVersion(&versions[i])
+	}
+	newExperiments := make(map[string]experiment, len(running))
+	for _, e := range running {
+		variant, err := repository.GetAIPromptVersion(ctx, e.VariantID)
+		if err != nil {
+			return fmt.Errorf("failed to load experiment variant: %w", err)
+		}
+		if variant == nil {
+			continue
+		}
+		newExperiments[e.Feature] = experiment{id: e.ID, variant: newVersion(variant), percent: e.VariantPercent}
+	}
+
+	mu.Lock()
+	published, experiments, loadedAt = newPublished, newExperiments, time.Now()
+	mu.Unlock()
+	return nil
+}
+
+// ensureLoaded loads on first use, retrying a failed load at most once a minute
+func ensureLoaded(ctx context.Context) {
+	mu.RLock()
+	ok := !loadedAt.IsZero() || time.Since(failedAt) < retryAfter
+	mu.RUnlock()
+	if ok {
+		return
+	}
+	if err := Load(ctx); err != nil {
+		fmt.Printf("[Prompts] %v, using built-in prompts\n", err)
+		mu.Lock()
+		failedAt = time.Now()
+		mu.Unlock()
+	}
+}
+
+// For returns the version of a feature's prompt to use for a user: the
+// variant if the feature has a running experiment and the user falls in its
+// share, otherwise the published version. Returns nil if there is none.
+func For(ctx context.Context, feature string, userID uuid.UUID) *Version {
+	ensureLoaded(ctx)
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if e, ok := experiments[feature]; ok && userID != uuid.Nil && bucket(e.id, userID) < e.percent {
+		return e.variant
+	}
+	return published[feature]
+}
+
+// bucket places a user in 0-99 for an experiment. Hashing the experiment ID
+// in keeps the same users from landing in the variant of every experiment.
+func bucket(experimentID, userID uuid.UUID) int {
+	h := fnv.New32a()
+	h.Write(experimentID[:])
+	h.Write(userID[:])
+	return int(h.Sum32() % 100)
+}
+
+// Listen reloads whenever another replica announces a change, until ctx is
+// done
+func Listen(ctx context.Context, client *redis.Client) {
+	if client == nil {
+		return
+	}
+	sub := client.Subscribe(ctx, Channel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := Load(ctx); err != nil {
+				fmt.Printf("[Prompts] Reload failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// Notify reloads this replica and tells the others to reload
+func Notify(ctx context.Context, client *redis.Client) {
+	if err := Load(ctx); err != nil {
+		fmt.Printf("[Prompts] Reload failed: %v\n", err)
+	}
+	if client == nil {
+		return
+	}
+	if err := client.Publish(ctx, Channel, time.Now().Unix()).Err(); err != nil {
+		fmt.Printf("[Prompts] Failed to announce change: %v\n", err)
+	}
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AIModelRoute is the routing table entry of a feature and tier. Either may
+// be "*" for any.
+type AIModelRoute struct {
+	Feature   string
+	Tier      string
+	Steps     json.RawMessage // Ordered llm.Route list
+	UpdatedBy *string
+	UpdatedAt time.Time
+}
+
+// ListAIModelRoutes returns the whole routing table
+func ListAIModelRoutes(ctx context.Context) ([]AIModelRoute, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, `
+		SELECT feature, tier, steps, updated_by, updated_at
+		FROM ai_model_routes
+		ORDER BY feature, tier
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := []AIModelRoute{}
+	for rows.Next() {
+		var r AIModelRoute
+		if err := rows.Scan(&r.Feature, &r.Tier, &r.Steps, &r.UpdatedBy, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+// UpsertAIModelRoute sets the steps of a feature and tier
+func UpsertAIModelRoute(ctx context.Context, feature, tier string, steps json.RawMessage, updatedBy string) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO ai_model_routes (feature, tier, steps, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (feature, tier) DO UPDATE
+		SET steps = EXCLUDED.steps, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, feature, tier, steps, updatedBy)
+	return err
+}
+
+// DeleteAIModelRoute removes the entry of a feature and tier, reporting
+// whether there was one
+func DeleteAIModelRoute(ctx context.Context, feature, tier string) (bool, error) {
+	db := getPool()
+
+	tag, err := db.Exec(ctx, `
+		DELETE FROM ai_model_routes WHERE feature = $1 AND tier = $2
+	`, feature, tier)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
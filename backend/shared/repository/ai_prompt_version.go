@@ -0,0 +1,410 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Prompt version statuses
+const (
+	PromptDraft     = "draft"
+	PromptPublished = "published"
+	PromptArchived  = "archived"
+)
+
+// Prompt outcomes, what users did with AI output
+const (
+	PromptOutcomeApplied  = "applied"
+	PromptOutcomeAccepted = "accepted"
+	PromptOutcomeRejected = "rejected"
+	PromptOutcomeReverted = "reverted"
+)
+
+var (
+	// ErrPromptVersionState is returned when a version can't make the requested change
+	ErrPromptVersionState = errors.New("prompt version can't be changed that way")
+	// ErrPromptExperimentRunning is returned when a feature already has a running experiment
+	ErrPromptExperimentRunning = errors.New("feature already has a running experiment")
+)
+
+// AIPromptVersion is one immutable set of prompt configs for a feature
+type AIPromptVersion struct {
+	ID          uuid.UUID
+	Feature     string
+	Version     int
+	Configs     map[string]string
+	Status      string
+	Notes       *string
+	CreatedBy   *string
+	CreatedAt   time.Time
+	PublishedBy *string
+	PublishedAt *time.Time // Kept after the version is archived
+}
+
+// AIPromptExperiment splits a feature's traffic between two versions
+type AIPromptExperiment struct {
+	ID             uuid.UUID
+	Feature        string
+	ControlID      uuid.UUID
+	VariantID      uuid.UUID
+	VariantPercent int
+	Status         string
+	CreatedBy      *string
+	StartedAt      time.Time
+	StoppedAt      *time.Time
+}
+
+const promptVersionColumns = `id, feature, version, configs, status, notes, created_by, created_at, published_by, published_at`
+
+func scanPromptVersion(row pgx.Row) (*AIPromptVersion, error) {
+	var v AIPromptVersion
+	var configs []byte
+	if err := row.Scan(&v.ID, &v.Feature, &v.Version, &configs, &v.Status, &v.Notes,
+		&v.CreatedBy, &v.CreatedAt, &v.PublishedBy, &v.PublishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(configs, &v.Configs); err != nil {
+		return nil, fmt.Errorf("invalid configs in prompt version %s: %w", v.ID, err)
+	}
+	return &v, nil
+}
+
+func queryPromptVersions(ctx context.Context, query string, args ...interface{}) ([]AIPromptVersion, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []AIPromptVersion{}
+	for rows.Next() {
+		v, err := scanPromptVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// GetAIPromptVersion returns a version, or nil if there is none with that ID
+func GetAIPromptVersion(ctx context.Context, id uuid.UUID) (*AIPromptVersion, error) {
+	db := getPool()
+
+	v, err := scanPromptVersion(db.QueryRow(ctx,
+		`SELECT `+promptVersionColumns+` FROM ai_prompt_versions WHERE id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// GetPublishedAIPromptVersions returns the published version of every feature
+func GetPublishedAIPromptVersions(ctx context.Context) ([]AIPromptVersion, error) {
+	return queryPromptVersions(ctx,
+		`SELECT `+promptVersionColumns+` FROM ai_prompt_versions WHERE status = 'published' ORDER BY feature`)
+}
+
+// GetPublishedAIPromptVersion returns a feature's published version, or nil if it has none
+func GetPublishedAIPromptVersion(ctx context.Context, feature string) (*AIPromptVersion, error) {
+	db := getPool()
+
+	v, err := scanPromptVersion(db.QueryRow(ctx,
+		`SELECT `+promptVersionColumns+` FROM ai_prompt_versions WHERE feature = $1 AND status = 'published'`, feature))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// ListAIPromptVersions returns a feature's versions, newest first
+func ListAIPromptVersions(ctx context.Context, feature string) ([]AIPromptVersion, error) {
+	return queryPromptVersions(ctx,
+		`SELECT `+promptVersionColumns+` FROM ai_prompt_versions WHERE feature = $1 ORDER BY version DESC`, feature)
+}
+
+// GetPreviousAIPromptVersion returns the version published before the
+// current one, or nil if there never was one
+func GetPreviousAIPromptVersion(ctx context.Context, feature string) (*AIPromptVersion, error) {
+	db := getPool()
+
+	v, err := scanPromptVersion(db.QueryRow(ctx, `
+		SELECT `+promptVersionColumns+` FROM ai_prompt_versions
+		WHERE feature = $1 AND status = 'archived' AND published_at IS NOT NULL
+		ORDER BY published_at DESC
+		LIMIT 1
+	`, feature))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// CreateAIPromptVersion stores a new draft with the next version number
+func CreateAIPromptVersion(ctx context.Context, feature string, configs map[string]string, notes *string, createdBy string) (*AIPromptVersion, error) {
+	db := getPool()
+
+	data, err := json.Marshal(configs)
+	if err != nil {
+		return nil, err
+	}
+	return scanPromptVersion(db.QueryRow(ctx, `
+		INSERT INTO ai_prompt_versions (feature, version, configs, status, notes, created_by)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, 'draft', $3, $4
+		FROM ai_prompt_versions WHERE feature = $1
+		RETURNING `+promptVersionColumns,
+		feature, data, notes, createdBy))
+}
+
+// PublishAIPromptVersion makes a draft or archived version the published one
+// for its feature. The old published version is archived, running
+// experiments on the feature stop, and ai_prompt_configs is updated to the
+// new values.
+func PublishAIPromptVersion(ctx context.Context, id uuid.UUID, publishedBy string) (*AIPromptVersion, error) {
+	db := getPool()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	v, err := scanPromptVersion(tx.QueryRow(ctx,
+		`SELECT `+promptVersionColumns+` FROM ai_prompt_versions WHERE id = $1 FOR UPDATE`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.Status == PromptPublished {
+		return nil, ErrPromptVersionState
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE ai_prompt_versions SET status = 'archived'
+		WHERE feature = $1 AND status = 'published'
+	`, v.Feature); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE ai_prompt_experiments SET status = 'stopped', stopped_at = NOW()
+		WHERE feature = $1 AND status = 'running'
+	`, v.Feature); err != nil {
+		return nil, err
+	}
+	v, err = scanPromptVersion(tx.QueryRow(ctx, `
+		UPDATE ai_prompt_versions SET status = 'published', published_by = $2, published_at = NOW()
+		WHERE id = $1
+		RETURNING `+promptVersionColumns, id, publishedBy))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range v.Configs {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ai_prompt_configs (key, value, updated_at, updated_by)
+			VALUES ($1, $2, NOW(), $3)
+			ON CONFLICT (key) DO UPDATE SET value = $2, updated_at = NOW(), updated_by = $3
+		`, key, value, publishedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, tx.Commit(ctx)
+}
+
+const promptExperimentColumns = `id, feature, control_id, variant_id, variant_percent, status, created_by, started_at, stopped_at`
+
+func scanPromptExperiment(row pgx.Row) (*AIPromptExperiment, error) {
+	var e AIPromptExperiment
+	if err := row.Scan(&e.ID, &e.Feature, &e.ControlID, &e.VariantID, &e.VariantPercent,
+		&e.Status, &e.CreatedBy, &e.StartedAt, &e.StoppedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetRunningAIPromptExperiments returns the running experiment of every feature that has one
+func GetRunningAIPromptExperiments(ctx context.Context) ([]AIPromptExperiment, error) {
+	return queryPromptExperiments(ctx,
+		`SELECT `+promptExperimentColumns+` FROM ai_prompt_experiments WHERE status = 'running'`)
+}
+
+// ListAIPromptExperiments returns a feature's experiments, newest first
+func ListAIPromptExperiments(ctx context.Context, feature string) ([]AIPromptExperiment, error) {
+	return queryPromptExperiments(ctx,
+		`SELECT `+promptExperimentColumns+` FROM ai_prompt_experiments WHERE feature = $1 ORDER BY started_at DESC`, feature)
+}
+
+func queryPromptExperiments(ctx context.Context, query string, args ...interface{}) ([]AIPromptExperiment, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	experiments := []AIPromptExperiment{}
+	for rows.Next() {
+		e, err := scanPromptExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, *e)
+	}
+	return experiments, rows.Err()
+}
+
+// CreateAIPromptExperiment starts splitting traffic between the feature's
+// published version and variant. The variant must be another version of the
+// same feature.
+func CreateAIPromptExperiment(ctx context.Context, variant *AIPromptVersion, percent int, createdBy string) (*AIPromptExperiment, error) {
+	db := getPool()
+
+	if variant.Status == PromptPublished {
+		return nil, ErrPromptVersionState
+	}
+
+	e, err := scanPromptExperiment(db.QueryRow(ctx, `
+		INSERT INTO ai_prompt_experiments (feature, control_id, variant_id, variant_percent, created_by)
+		SELECT feature, id, $2, $3, $4
+		FROM ai_prompt_versions
+		WHERE feature = $1 AND status = 'published'
+		  AND NOT EXISTS (SELECT 1 FROM ai_prompt_experiments WHERE feature = $1 AND status = 'running')
+		RETURNING `+promptExperimentColumns,
+		variant.Feature, variant.ID, percent, createdBy))
+	if err == pgx.ErrNoRows {
+		// No published control, or an experiment is already running
+		var running bool
+		_ = db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM ai_prompt_experiments WHERE feature = $1 AND status = 'running')`,
+			variant.Feature).Scan(&running)
+		if running {
+			return nil, ErrPromptExperimentRunning
+		}
+		return nil, ErrPromptVersionState
+	}
+	return e, err
+}
+
+// StopAIPromptExperiment stops a running experiment; false if there was none
+func StopAIPromptExperiment(ctx context.Context, id uuid.UUID) (bool, error) {
+	db := getPool()
+
+	tag, err := db.Exec(ctx, `
+		UPDATE ai_prompt_experiments SET status = 'stopped', stopped_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RecordAIPromptOutcome stores what a user did with output of a prompt version
+func RecordAIPromptOutcome(ctx context.Context, versionID, userID uuid.UUID, outcome string) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO ai_prompt_outcomes (version_id, user_id, outcome) VALUES ($1, $2, $3)
+	`, versionID, userID, outcome)
+	return err
+}
+
+// AIPromptVersionMetrics is how one version did since a time
+type AIPromptVersionMetrics struct {
+	VersionID         uuid.UUID `json:"version_id"`
+	Version           int       `json:"version"`
+	Status            string    `json:"status"`
+	Calls             int64     `json:"calls"`
+	PromptTokens      int64     `json:"prompt_tokens"`
+	CompletionTokens  int64     `json:"completion_tokens"`
+	AvgTokens         float64   `json:"avg_tokens"` // Per uncached call
+	Errors            int64     `json:"errors"`
+	SchemaChecked     int64     `json:"schema_checked"`
+	SchemaFailureRate float64   `json:"schema_failure_rate"` // First answers that failed their schema
+	Applied           int64     `json:"applied"`
+	Accepted          int64     `json:"accepted"`
+	Rejected          int64     `json:"rejected"`
+	Reverted          int64     `json:"reverted"`
+	AcceptanceRate    float64   `json:"acceptance_rate"` // Accepted over reviewed suggestions
+	RevertRate        float64   `json:"revert_rate"`     // Reverted over applied
+}
+
+// GetAIPromptMetrics sums the calls and outcomes of each version of a
+// feature since a time. Versions with neither are left out.
+func GetAIPromptMetrics(ctx context.Context, feature string, since time.Time) ([]AIPromptVersionMetrics, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, `
+		WITH calls AS (
+			SELECT prompt_version_id AS version_id,
+				COUNT(*) AS calls,
+				COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+				COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+				COALESCE(AVG(prompt_tokens + completion_tokens) FILTER (WHERE NOT cached), 0)::float8 AS avg_tokens,
+				COUNT(*) FILTER (WHERE error IS NOT NULL) AS errors,
+				COUNT(schema_status) AS schema_checked,
+				COUNT(*) FILTER (WHERE schema_status IN ('repaired', 'invalid')) AS schema_failed
+			FROM llm_calls
+			WHERE created_at >= $2 AND prompt_version_id IS NOT NULL
+			GROUP BY 1
+		), outcomes AS (
+			SELECT version_id,
+				COUNT(*) FILTER (WHERE outcome = 'applied') AS applied,
+				COUNT(*) FILTER (WHERE outcome = 'accepted') AS accepted,
+				COUNT(*) FILTER (WHERE outcome = 'rejected') AS rejected,
+				COUNT(*) FILTER (WHERE outcome = 'reverted') AS reverted
+			FROM ai_prompt_outcomes
+			WHERE created_at >= $2
+			GROUP BY 1
+		)
+		SELECT v.id, v.version, v.status,
+			COALESCE(c.calls, 0), COALESCE(c.prompt_tokens, 0), COALESCE(c.completion_tokens, 0),
+			COALESCE(c.avg_tokens, 0), COALESCE(c.errors, 0),
+			COALESCE(c.schema_checked, 0), COALESCE(c.schema_failed, 0),
+			COALESCE(o.applied, 0), COALESCE(o.accepted, 0), COALESCE(o.rejected, 0), COALESCE(o.reverted, 0)
+		FROM ai_prompt_versions v
+		LEFT JOIN calls c ON c.version_id = v.id
+		LEFT JOIN outcomes o ON o.version_id = v.id
+		WHERE v.feature = $1 AND (c.version_id IS NOT NULL OR o.version_id IS NOT NULL)
+		ORDER BY v.version DESC
+	`, feature, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []AIPromptVersionMetrics{}
+	for rows.Next() {
+		var m AIPromptVersionMetrics
+		var schemaFailed int64
+		if err := rows.Scan(&m.VersionID, &m.Version, &m.Status,
+			&m.Calls, &m.PromptTokens, &m.CompletionTokens, &m.AvgTokens, &m.Errors,
+			&m.SchemaChecked, &schemaFailed,
+			&m.Applied, &m.Accepted, &m.Rejected, &m.Reverted,
+		); err != nil {
+			return nil, err
+		}
+		if m.SchemaChecked > 0 {
+			m.SchemaFailureRate = float64(schemaFailed) / float64(m.SchemaChecked)
+		}
+		if reviewed := m.Accepted + m.Rejected; reviewed > 0 {
+			m.AcceptanceRate = float64(m.Accepted) / float64(reviewed)
+		}
+		if m.Applied > 0 {
+			m.RevertRate = float64(m.Reverted) / float64(m.Applied)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// AssistantConversation is one conversation with the AI assistant
+type AssistantConversation struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Title         string
+	PendingAction []byte // JSON of the tool call awaiting confirmation, if any
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// AssistantMessage is one stored turn: a user message, an assistant reply
+// (possibly calling tools) or a tool result
+type AssistantMessage struct {
+	ID             int64
+	ConversationID uuid.UUID
+	Role           string
+	Content        string
+	ToolCalls      []byte // JSON array, assistant messages only
+	ToolCallID     *string
+	ToolName       *string
+	CreatedAt      time.Time
+}
+
+// CreateAssistantConversation starts a conversation for the user.
+func CreateAssistantConversation(ctx context.Context, userID uuid.UUID, title string) (*AssistantConversation, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	conv := AssistantConversation{UserID: userID, Title: title}
+	err := db.QueryRow(ctx, `
+		INSERT INTO assistant_conversations (user_id, title)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`, userID, title).Scan(&conv.ID, &conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// GetAssistantConversation returns one of the user's conversations, or nil
+// if it doesn't exist.
+func GetAssistantConversation(ctx context.Context, conversationID, userID uuid.UUID) (*AssistantConversation, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	var conv AssistantConversation
+	err := db.QueryRow(ctx, `
+		SELECT id, user_id, title, pending_action, created_at, updated_at
+		FROM assistant_conversations
+		WHERE id = $1 AND user_id = $2
+	`, conversationID, userID).Scan(
+		&conv.ID, &conv.UserID, &conv.Title, &conv.PendingAction, &conv.CreatedAt, &conv.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// ListAssistantConversations returns the user's conversations, most recent first.
+func ListAssistantConversations(ctx context.Context, userID uuid.UUID, limit, offset int) ([]AssistantConversation, int64, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, 0, ErrTasksDBNotInitialized
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, user_id, title, pending_action, created_at, updated_at
+		FROM assistant_conversations
+		WHERE user_id = $1
+		ORDER BY updated_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	convs := []AssistantConversation{}
+	for rows.Next() {
+		var conv AssistantConversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.PendingAction, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		convs = append(convs, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	_ = db.QueryRow(ctx, "SELECT COUNT(*) FROM assistant_conversations WHERE user_id = $1", userID).Scan(&total)
+	return convs, total, nil
+}
+
+// DeleteAssistantConversation deletes a conversation and its messages.
+// Reports whether it existed.
+func DeleteAssistantConversation(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
+	db := getTasksPool()
+	if db == nil {
+		return false, ErrTasksDBNotInitialized
+	}
+
+	tag, err := db.Exec(ctx, "DELETE FROM assistant_conversations WHERE id = $1 AND user_id = $2", conversationID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetAssistantMessages returns the last limit messages of a conversation in
+// order (all of them if limit <= 0).
+func GetAssistantMessages(ctx context.Context, conversationID uuid.UUID, limit int) ([]AssistantMessage, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 1 << 30
+	}
+	rows, err := db.Query(ctx, `
+		SELECT id, conversation_id, role, content, tool_calls, tool_call_id, tool_name, created_at
+		FROM (
+			SELECT * FROM assistant_messages
+			WHERE conversation_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		) m
+		ORDER BY id ASC
+	`, conversationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []AssistantMessage
+	for rows.Next() {
+		var m AssistantMessage
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.ToolCalls,
+			&m.ToolCallID, &m.ToolName, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// AddAssistantMessage appends a message to a conversation.
+func AddAssistantMessage(ctx context.Context, m *AssistantMessage) error {
+	db := getTasksPool()
+	if db == nil {
+		return ErrTasksDBNotInitialized
+	}
+
+	err := db.QueryRow(ctx, `
+		INSERT INTO assistant_messages (conversation_id, role, content, tool_calls, tool_call_id, tool_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, m.ConversationID, m.Role, m.Content, m.ToolCalls, m.ToolCallID, m.ToolName).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "UPDATE assistant_conversations SET updated_at = NOW() WHERE id = $1", m.ConversationID)
+	return err
+}
+
+// SetAssistantPendingAction stores the action awaiting confirmation.
+func SetAssistantPendingAction(ctx context.Context, conversationID uuid.UUID, action []byte) error {
+	db := getTasksPool()
+	if db == nil {
+		return ErrTasksDBNotInitialized
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE assistant_conversations SET pending_action = $2, updated_at = NOW() WHERE id = $1
+	`, conversationID, action)
+	return err
+}
+
+// TakeAssistantPendingAction clears and returns the action awaiting
+// confirmation, or nil if there is none. Only one caller gets a given
+// action, so it can't run twice.
+func TakeAssistantPendingAction(ctx context.Context, conversationID, userID uuid.UUID) ([]byte, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	var action []byte
+	err := db.QueryRow(ctx, `
+		WITH old AS (
+			SELECT id, pending_action FROM assistant_conversations
+			WHERE id = $1 AND user_id = $2 AND pending_action IS NOT NULL
+			FOR UPDATE
+		)
+		UPDATE assistant_conversations c SET pending_action = NULL
+		FROM old WHERE c.id = old.id
+		RETURNING old.pending_action
+	`, conversationID, userID).Scan(&action)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return action, err
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// AIDraft is an email or calendar draft generated for a task
+type AIDraft struct {
+	ID                uuid.UUID
+	UserID            uuid.UUID
+	TaskID            uuid.UUID
+	Type              string // email or calendar
+	Content           []byte // DraftContent JSON
+	Status            string // draft, approved, sending, sent, failed, bounced, cancelled
+	ProviderMessageID *string
+	Recipients        []string
+	Error             *string
+	CreatedAt         time.Time
+	SentAt            *time.Time
+}
+
+// draftSendTimeout is how long a draft may stay in "sending" before another
+// attempt can claim it (the previous one crashed mid-send)
+const draftSendTimeout = 10 * time.Minute
+
+// GetAIDraft returns one of the user's drafts, or nil if it doesn't exist.
+func GetAIDraft(ctx context.Context, draftID, userID uuid.UUID) (*AIDraft, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	var d AIDraft
+	err := db.QueryRow(ctx, `
+		SELECT id, user_id, task_id, draft_type, content, status, provider_message_id,
+		       COALESCE(recipients, '{}'), error, COALESCE(created_at, NOW()), sent_at
+		FROM ai_drafts
+		WHERE id = $1 AND user_id = $2
+	`, draftID, userID).Scan(
+		&d.ID, &d.UserID, &d.TaskID, &d.Type, &d.Content, &d.Status, &d.ProviderMessageID,
+		&d.Recipients, &d.Error, &d.CreatedAt, &d.SentAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// ClaimAIDraftForSending moves a draft to "sending" so concurrent approvals
+// can't send it twice. Drafts that failed may be retried. Reports whether
+// the claim succeeded.
+func ClaimAIDraftForSending(ctx context.Context, draftID, userID uuid.UUID) (bool, error) {
+	db := getTasksPool()
+	if db == nil {
+		return false, ErrTasksDBNotInitialized
+	}
+
+	result, err := db.Exec(ctx, `
+		UPDATE ai_drafts SET status = 'sending', error = NULL, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		  AND (status IN ('draft', 'approved', 'failed')
+		       OR (status = 'sending' AND updated_at < $3))
+	`, draftID, userID, time.Now().Add(-draftSendTimeout))
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// ReleaseAIDraftClaim returns a claimed draft to "approved" without sending,
+// e.g. when the user hit the send limit.
+func ReleaseAIDraftClaim(ctx context.Context, draftID, userID uuid.UUID) error {
+	db := getTasksPool()
+	if db == nil {
+		return ErrTasksDBNotInitialized
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE ai_drafts SET status = 'approved', updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = 'sending'
+	`, draftID, userID)
+
+	return err
+}
+
+// MarkAIDraftSent records a successful send of a claimed draft.
+func MarkAIDraftSent(ctx context.Context, draftID, userID uuid.UUID, messageID string, recipients []string) error {
+	db := getTasksPool()
+	if db == nil {
+		return ErrTasksDBNotInitialized
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE ai_drafts
+		SET status = 'sent', provider_message_id = NULLIF($3, ''), recipients = $4,
+		    sent_at = NOW(), error = NULL, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = 'sending'
+	`, draftID, userID, messageID, recipients)
+
+	return err
+}
+
+// MarkAIDraftFailed records a failed send of a claimed draft; the draft can
+// be approved again.
+func MarkAIDraftFailed(ctx context.Context, draftID, userID uuid.UUID, reason string) error {
+	db := getTasksPool()
+	if db == nil {
+		return ErrTasksDBNotInitialized
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE ai_drafts SET status = 'failed', error = $3, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = 'sending'
+	`, draftID, userID, reason)
+
+	return err
+}
+
+// MarkAIDraftBounced marks the sent draft with this provider message ID as
+// bounced. Returns the number of drafts updated.
+func MarkAIDraftBounced(ctx context.Context, messageID, reason string) (int64, error) {
+	db := getTasksPool()
+	if db == nil {
+		return 0, ErrTasksDBNotInitialized
+	}
+
+	result, err := db.Exec(ctx, `
+		UPDATE ai_drafts SET status = 'bounced', error = $2, updated_at = NOW()
+		WHERE provider_message_id = $1 AND status = 'sent'
+	`, messageID, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Duplicate candidate retrieval tuning
+const (
+	duplicateSQLLimit     = 60   // Rows fetched from the trigram/entity pre-filter before local scoring
+	duplicateTrgmMinimum  = 0.2  // Minimum trigram (word) similarity for the SQL pre-filter
+	duplicateScoreMinimum = 0.25 // Candidates below this combined score are dropped
+)
+
+// DuplicateCandidate is a task that may duplicate another, with its similarity scores (0-1)
+type DuplicateCandidate struct {
+	Task          *Task
+	Score         float64 // Combined score used for ranking
+	TitleSim      float64 // pg_trgm similarity of the display titles
+	TokenOverlap  float64 // Jaccard overlap of normalized title tokens
+	EntityOverlap float64 // Overlap of extracted entities, aliases resolved
+	Semantic      float64 // Embedding similarity, when found by nearest-neighbour search
+}
+
+// FindDuplicateCandidates searches the user's whole task history (excluding
+// cancelled tasks and the task's own parent/children) for likely duplicates,
+// using trigram similarity on the display title plus shared directory
+// entities, and returns the best `limit` candidates ranked by combined score.
+func FindDuplicateCandidates(ctx context.Context, task *Task, limit int) ([]DuplicateCandidate, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	aliases := getEntityAliasMap(ctx, task.UserID)
+	taskEntities := canonicalEntities(task.Entities, aliases)
+
+	// Names of the task's canonical entities. task_entities links every
+	// mention to its entity, so a task mentioning "Nam" is found through
+	// "Nam Tran" too.
+	var entityNames []string
+	for key := range taskEntities {
+		entityNames = append(entityNames, key[strings.IndexByte(key, ':')+1:])
+	}
+
+	var parentID uuid.UUID
+	if task.ParentID != nil {
+		parentID = *task.ParentID
+	}
+
+	// The word-similarity cut-off is a setting, not a parameter, so <% can
+	// use idx_tasks_display_title_trgm; is_local keeps it to this transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)",
+		strconv.FormatFloat(duplicateTrgmMinimum, 'f', -1, 64)); err != nil {
+		return nil, err
+	}
+
+	// Candidates come from two indexed lookups: similar display titles
+	// (idx_tasks_display_title_trgm, spelled out to match it) and tasks
+	// linked to the same directory entities (idx_task_entities_entity)
+	title := strings.ToLower(task.GetDisplayTitle())
+	rows, err := tx.Query(ctx, `
+		WITH matches AS (
+		  SELECT t.id FROM tasks t
+		  WHERE t.user_id = $1 AND t.deleted_at IS NULL
+		    AND (LOWER(COALESCE(NULLIF(t.ai_cleaned_title, ''), t.title)) % $3
+		      OR $3 <% LOWER(COALESCE(NULLIF(t.ai_cleaned_title, ''), t.title)))
+		  UNION
+		  SELECT te.task_id FROM task_entities te
+		  JOIN entities en ON en.id = te.entity_id
+		  WHERE en.user_id = $1 AND LOWER(en.name) = ANY($5)
+		)
+		SELECT t.id, t.user_id, t.title, t.description, t.status, t.priority,
+		       t.due_at, t.has_due_time, t.completed_at, t.tags, t.parent_id, t.depth, COALESCE(t.complexity, 0),
+		       t.ai_cleaned_title, t.ai_cleaned_description,
+		       COALESCE(t.ai_extracted_due, false), COALESCE(t.skip_auto_cleanup, false),
+		       t.ai_entities, t.version, t.created_at, t.updated_at,
+		       GREATEST(similarity(d.title, $3), word_similarity($3, d.title)) AS title_sim
+		FROM matches m
+		JOIN tasks t ON t.id = m.id
+		CROSS JOIN LATERAL (SELECT LOWER(COALESCE(NULLIF(t.ai_cleaned_title, ''), t.title)) AS title) d
+		WHERE t.user_id = $1
+		  AND t.deleted_at IS NULL
+		  AND t.status != 'cancelled'
+		  AND t.id != $2
+		  AND t.id != $4
+		  AND t.parent_id IS DISTINCT FROM $2
+		ORDER BY title_sim DESC
+		LIMIT $6
+	`, task.UserID, task.ID, title, parentID, entityNames, duplicateSQLLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titleTokens := normalizedTokens(task.GetDisplayTitle())
+
+	var candidates []DuplicateCandidate
+	for rows.Next() {
+		var t Task
+		var entitiesJSON []byte
+		var titleSim float64
+		if err := rows.Scan(
+			&t.ID, &t.UserID, &t.Title, &t.Description,
+			&t.Status, &t.Priority, &t.DueAt, &t.HasDueTime, &t.CompletedAt, &t.Tags,
+			&t.ParentID, &t.Depth, &t.Complexity,
+			&t.AICleanedTitle, &t.AICleanedDescription, &t.AIExtractedDue,
+			&t.SkipAutoCleanup,
+			&entitiesJSON, &t.Version, &t.CreatedAt, &t.UpdatedAt,
+			&titleSim,
+		); err != nil {
+			continue
+		}
+		if len(entitiesJSON) > 0 {
+			_ = json.Unmarshal(entitiesJSON, &t.Entities)
+		}
+
+		c := DuplicateCandidate{
+			Task:          &t,
+			TitleSim:      titleSim,
+			TokenOverlap:  jaccard(titleTokens, normalizedTokens(t.GetDisplayTitle())),
+			EntityOverlap: entityOverlap(taskEntities, canonicalEntities(t.Entities, aliases)),
+		}
+		if len(taskEntities) > 0 {
+			c.Score = 0.45*c.TitleSim + 0.3*c.TokenOverlap + 0.25*c.EntityOverlap
+		} else {
+			c.Score = 0.6*c.TitleSim + 0.4*c.TokenOverlap
+		}
+		if c.Score >= duplicateScoreMinimum {
+			candidates = append(candidates, c)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	return candidates, nil
+}
+
+// getEntityAliasMap returns type -> lowercased alias -> lowercased canonical value
+func getEntityAliasMap(ctx context.Context, userID uuid.UUID) map[string]map[string]string {
+	aliases := make(map[string]map[string]string)
+
+	db := getTasksPool()
+	if db == nil {
+		return aliases
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT entity_type, alias_value, canonical_value
+		FROM entity_aliases
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return aliases
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entityType, aliasValue, canonicalValue string
+		if err := rows.Scan(&entityType, &aliasValue, &canonicalValue); err != nil {
+			continue
+		}
+		if aliases[entityType] == nil {
+			aliases[entityType] = make(map[string]string)
+		}
+		aliases[entityType][strings.ToLower(aliasValue)] = strings.ToLower(canonicalValue)
+	}
+
+	return aliases
+}
+
+// canonicalEntities returns the set of "type:value" keys with aliases resolved
+func canonicalEntities(entities []TaskEntity, aliases map[string]map[string]string) map[string]bool {
+	set := make(map[string]bool, len(entities))
+	for _, e := range entities {
+		value := strings.ToLower(strings.TrimSpace(e.Value))
+		if value == "" {
+			continue
+		}
+		if canonical, ok := aliases[e.Type][value]; ok {
+			value = canonical
+		}
+		set[e.Type+":"+value] = true
+	}
+	return set
+}
+
+// entityOverlap is the share of the smaller entity set found in the other
+func entityOverlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for key := range a {
+		if b[key] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(min(len(a), len(b)))
+}
+
+// duplicateStopWords are dropped before comparing title tokens
+var duplicateStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "to": true, "for": true, "of": true, "and": true,
+	"or": true, "in": true, "on": true, "at": true, "with": true, "about": true, "my": true,
+	"is": true, "be": true, "it": true, "this": true, "that": true, "from": true, "by": true,
+}
+
+// normalizedTokens lowercases, strips punctuation and stop words, and trims
+// a plural "s" so "Call dentists" and "call the dentist" compare equal
+func normalizedTokens(s string) map[string]bool {
+	tokens := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, w := range words {
+		if duplicateStopWords[w] {
+			continue
+		}
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		tokens[w] = true
+	}
+	return tokens
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
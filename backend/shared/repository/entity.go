@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DBTX is satisfied by *pgxpool.Pool and pgx.Tx, so entity links can be
+// written inside the caller's transaction
+type DBTX interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// directoryTypes are the entity types with directory records; dates, emails
+// and phone numbers stay plain mentions in ai_entities
+var directoryTypes = map[string]bool{
+	"person":       true,
+	"location":     true,
+	"organization": true,
+}
+
+// IsDirectoryType reports whether entities of this type are kept in the directory
+func IsDirectoryType(entityType string) bool {
+	return directoryTypes[entityType]
+}
+
+// EntitySummary is an entity from the directory with its task counts
+type EntitySummary struct {
+	ID             uuid.UUID
+	Type           string
+	Name           string
+	Aliases        []string
+	Notes          *string
+	OpenTasks      int
+	CompletedTasks int
+}
+
+// SyncTaskEntities links a task's ai_entities to entity records. Each
+// mention resolves through entity_aliases or by name, creating the entity if
+// it doesn't exist yet. Call it whenever ai_entities is written.
+func SyncTaskEntities(ctx context.Context, db DBTX, userID, taskID uuid.UUID, entities []TaskEntity) error {
+	if _, err := db.Exec(ctx, "DELETE FROM task_entities WHERE task_id = $1", taskID); err != nil {
+		return err
+	}
+
+	for _, e := range entities {
+		value := strings.TrimSpace(e.Value)
+		if !directoryTypes[e.Type] || value == "" {
+			continue
+		}
+
+		entityID, err := ResolveEntity(ctx, db, userID, e.Type, value)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(ctx,
+			`INSERT INTO task_entities (task_id, entity_id, value) VALUES ($1, $2, $3)
+			 ON CONFLICT DO NOTHING`,
+			taskID, entityID, value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResolveEntity returns the entity a mention refers to (through an alias or
+// by name, case-insensitive), creating it when there is none
+func ResolveEntity(ctx context.Context, db DBTX, userID uuid.UUID, entityType, value string) (uuid.UUID, error) {
+	var entityID uuid.UUID
+	err := db.QueryRow(ctx,
+		`SELECT entity_id FROM entity_aliases
+		 WHERE user_id = $1 AND entity_type = $2 AND LOWER(TRIM(alias_value)) = LOWER($3) AND entity_id IS NOT NULL
+		 LIMIT 1`,
+		userID, entityType, value,
+	).Scan(&entityID)
+	if err == nil {
+		return entityID, nil
+	}
+	if err != pgx.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	// The no-op update makes RETURNING yield the existing row on conflict
+	err = db.QueryRow(ctx,
+		`INSERT INTO entities (user_id, entity_type, name) VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id, entity_type, LOWER(name)) DO UPDATE SET name = entities.name
+		 RETURNING id`,
+		userID, entityType, value,
+	).Scan(&entityID)
+	return entityID, err
+}
+
+// GetTopEntities returns the user's most mentioned entities of a type,
+// counting only their own tasks (not tasks shared with them).
+func GetTopEntities(ctx context.Context, userID uuid.UUID, entityType string, limit int) ([]EntitySummary, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT en.id, en.entity_type, en.name, en.notes,
+		       COALESCE(ARRAY(SELECT a.alias_value FROM entity_aliases a WHERE a.entity_id = en.id ORDER BY a.alias_value), '{}'),
+		       COUNT(DISTINCT t.id) FILTER (WHERE t.status != 'completed'),
+		       COUNT(DISTINCT t.id) FILTER (WHERE t.status = 'completed')
+		FROM entities en
+		JOIN task_entities te ON te.entity_id = en.id
+		JOIN tasks t ON t.id = te.task_id AND t.deleted_at IS NULL AND t.status != 'cancelled'
+		WHERE en.user_id = $1 AND en.entity_type = $2
+		  AND (t.created_by IS NULL OR t.created_by = t.user_id)
+		GROUP BY en.id
+		ORDER BY COUNT(DISTINCT t.id) DESC, en.name
+		LIMIT $3
+	`, userID, entityType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []EntitySummary
+	for rows.Next() {
+		var e EntitySummary
+		if err := rows.Scan(&e.ID, &e.Type, &e.Name, &e.Notes, &e.Aliases, &e.OpenTasks, &e.CompletedTasks); err != nil {
+			continue
+		}
+		entities = append(entities, e)
+	}
+
+	return entities, nil
+}
+
+// GetEntityEmail returns the email saved for the directory entity named (or
+// aliased) value, so drafts addressed to "Nam" reach Nam's address.
+func GetEntityEmail(ctx context.Context, userID uuid.UUID, value string) (string, error) {
+	db := getTasksPool()
+	if db == nil {
+		return "", ErrTasksDBNotInitialized
+	}
+
+	var email string
+	err := db.QueryRow(ctx, `
+		SELECT en.email FROM entities en
+		WHERE en.user_id = $1 AND en.email IS NOT NULL
+		  AND (LOWER(en.name) = LOWER($2) OR EXISTS (
+		    SELECT 1 FROM entity_aliases a WHERE a.entity_id = en.id AND LOWER(a.alias_value) = LOWER($2)
+		  ))
+		ORDER BY en.entity_type = 'person' DESC, en.updated_at DESC
+		LIMIT 1
+	`, userID, value).Scan(&email)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return email, err
+}
+
+// EntityName is a name or alias of a directory entity
+type EntityName struct {
+	Type string
+	Name string
+}
+
+// ListEntityNames returns every name a user's directory entities go by:
+// canonical names, aliases and the mentions linked to them
+func ListEntityNames(ctx context.Context, db DBTX, userID uuid.UUID) ([]EntityName, error) {
+	rows, err := db.Query(ctx, `
+		SELECT entity_type, name FROM entities WHERE user_id = $1
+		UNION
+		SELECT entity_type, alias_value FROM entity_aliases WHERE user_id = $1
+		UNION
+		SELECT en.entity_type, te.value FROM task_entities te
+		JOIN entities en ON en.id = te.entity_id
+		WHERE en.user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []EntityName
+	for rows.Next() {
+		var n EntityName
+		if err := rows.Scan(&n.Type, &n.Name); err != nil {
+			return nil, err
+		}
+		if IsDirectoryType(n.Type) {
+			names = append(names, n)
+		}
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LLMCall is one recorded LLM call
+type LLMCall struct {
+	UserID           *uuid.UUID
+	Feature          string
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	LatencyMs        int
+	Cached           bool
+	Streamed         bool
+	Degraded         bool
+	SchemaStatus     *string // valid, repaired or invalid for structured answers
+	PromptVersionID  *uuid.UUID
+	Redactions       int     // Values replaced by placeholders before the call
+	Private          bool    // Kept on the local model by privacy mode
+	Error            *string // Error kind
+}
+
+// CreateLLMCall stores a call, stamping it with the user's current tier.
+func CreateLLMCall(ctx context.Context, call *LLMCall) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO llm_calls (
+			user_id, tier, feature, provider, model, prompt_tokens, completion_tokens,
+			cost_usd, latency_ms, cached, streamed, degraded, schema_status, error,
+			prompt_version_id, redactions, private
+		)
+		SELECT $1::uuid,
+			CASE WHEN $1::uuid IS NULL THEN NULL
+			ELSE COALESCE((SELECT tier FROM subscriptions WHERE user_id = $1::uuid), 'free') END,
+			$2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
+	`, call.UserID, call.Feature, call.Provider, call.Model, call.PromptTokens, call.CompletionTokens,
+		call.CostUSD, call.LatencyMs, call.Cached, call.Streamed, call.Degraded, call.SchemaStatus, call.Error,
+		call.PromptVersionID, call.Redactions, call.Private)
+
+	return err
+}
+
+// GetDailyLLMSpend returns today's LLM spend in USD for a user and in total.
+func GetDailyLLMSpend(ctx context.Context, userID uuid.UUID) (user, global float64, err error) {
+	db := getPool()
+
+	err = db.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(cost_usd) FILTER (WHERE user_id = $1), 0)::float8,
+			COALESCE(SUM(cost_usd), 0)::float8
+		FROM llm_calls
+		WHERE created_at >= CURRENT_DATE
+	`, userID).Scan(&user, &global)
+
+	return user, global, err
+}
+
+// LLMUsageRow is the usage of one group in an LLM usage report
+type LLMUsageRow struct {
+	Key              string  `json:"key"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	CacheHits        int64   `json:"cache_hits"`
+	Degraded         int64   `json:"degraded"`
+	Errors           int64   `json:"errors"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+
+	// Structured answers checked against a schema, and how many of them
+	// failed it on the first try (repaired) or for good (invalid)
+	SchemaChecked     int64   `json:"schema_checked"`
+	SchemaRepaired    int64   `json:"schema_repaired"`
+	SchemaInvalid     int64   `json:"schema_invalid"`
+	SchemaFailureRate float64 `json:"schema_failure_rate"` // First-try failures over checked
+
+	Redactions int64 `json:"redactions"` // Values replaced by placeholders
+	Private    int64 `json:"private"`    // Calls kept on the local model by privacy mode
+}
+
+// SetSchemaFailureRate derives the failure rate from the schema counts
+func (r *LLMUsageRow) SetSchemaFailureRate() {
+	r.SchemaFailureRate = 0
+	if r.SchemaChecked > 0 {
+		r.SchemaFailureRate = float64(r.SchemaRepaired+r.SchemaInvalid) / float64(r.SchemaChecked)
+	}
+}
+
+// llmUsageGroups are the columns an LLM usage report can be grouped by
+var llmUsageGroups = map[string]string{
+	"day":      "to_char(created_at, 'YYYY-MM-DD')",
+	"tier":     "COALESCE(tier, 'system')",
+	"feature":  "NULLIF(feature, '')",
+	"provider": "provider",
+	"model":    "NULLIF(model, '')",
+}
+
+// GetLLMUsageReport sums LLM calls since a time, grouped by day, tier,
+// feature, provider or model.
+func GetLLMUsageReport(ctx context.Context, since time.Time, groupBy string) ([]LLMUsageRow, error) {
+	db := getPool()
+
+	column, ok := llmUsageGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage grouping %q", groupBy)
+	}
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT COALESCE(%s, 'other') AS key,
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(cost_usd), 0)::float8,
+			COUNT(*) FILTER (WHERE cached),
+			COUNT(*) FILTER (WHERE degraded),
+			COUNT(*) FILTER (WHERE error IS NOT NULL),
+			COALESCE(AVG(latency_ms) FILTER (WHERE NOT cached), 0)::float8,
+			COUNT(schema_status),
+			COUNT(*) FILTER (WHERE schema_status = 'repaired'),
+			COUNT(*) FILTER (WHERE schema_status = 'invalid'),
+			COALESCE(SUM(redactions), 0),
+			COUNT(*) FILTER (WHERE private)
+		FROM llm_calls
+		WHERE created_at >= $1
+		GROUP BY 1
+		ORDER BY 1
+	`, column), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []LLMUsageRow{}
+	for rows.Next() {
+		var r LLMUsageRow
+		if err := rows.Scan(
+			&r.Key, &r.Calls, &r.PromptTokens, &r.CompletionTokens, &r.CostUSD,
+			&r.CacheHits, &r.Degraded, &r.Errors, &r.AvgLatencyMs,
+			&r.SchemaChecked, &r.SchemaRepaired, &r.SchemaInvalid,
+			&r.Redactions, &r.Private,
+		); err != nil {
+			return nil, err
+		}
+		r.SetSchemaFailureRate()
+		report = append(report, r)
+	}
+
+	return report, rows.Err()
+}
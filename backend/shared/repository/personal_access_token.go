@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// PersonalAccessToken represents a stored (hashed) personal access token
+type PersonalAccessToken struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Name        string
+	TokenPrefix string
+	Scopes      []string
+	ExpiresAt   *time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+// CreatePersonalAccessToken stores a new token by its hash.
+func CreatePersonalAccessToken(ctx context.Context, t *PersonalAccessToken, tokenHash string) error {
+	db := getPool()
+
+	return db.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, t.UserID, t.Name, tokenHash, t.TokenPrefix, t.Scopes, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+}
+
+// ListPersonalAccessTokens returns all tokens of a user, including revoked ones.
+func ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]*PersonalAccessToken, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, `
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*PersonalAccessToken
+	for rows.Next() {
+		var t PersonalAccessToken
+		if err := rows.Scan(
+			&t.ID, &t.UserID, &t.Name, &t.TokenPrefix, &t.Scopes,
+			&t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt,
+		); err != nil {
+			continue
+		}
+		tokens = append(tokens, &t)
+	}
+
+	return tokens, nil
+}
+
+// RevokePersonalAccessToken revokes a token owned by the user.
+func RevokePersonalAccessToken(ctx context.Context, tokenID, userID uuid.UUID) (int64, error) {
+	db := getPool()
+
+	result, err := db.Exec(ctx, `
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetActivePersonalAccessToken looks up a usable token by its hash.
+// Returns nil if the token is unknown, revoked, expired, or its owner is deleted.
+func GetActivePersonalAccessToken(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	db := getPool()
+
+	var t PersonalAccessToken
+	err := db.QueryRow(ctx, `
+		SELECT pat.id, pat.user_id, pat.name, pat.token_prefix, pat.scopes,
+		       pat.expires_at, pat.last_used_at, pat.revoked_at, pat.created_at
+		FROM personal_access_tokens pat
+		JOIN users u ON u.id = pat.user_id
+		WHERE pat.token_hash = $1
+		  AND pat.revoked_at IS NULL
+		  AND (pat.expires_at IS NULL OR pat.expires_at > NOW())
+		  AND u.deleted_at IS NULL
+	`, tokenHash).Scan(
+		&t.ID, &t.UserID, &t.Name, &t.TokenPrefix, &t.Scopes,
+		&t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// TouchPersonalAccessToken records token usage. Writes are throttled to once
+// per minute per token to keep hot tokens from hammering the table.
+func TouchPersonalAccessToken(ctx context.Context, tokenID uuid.UUID) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, tokenID)
+
+	return err
+}
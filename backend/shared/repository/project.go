@@ -0,0 +1,254 @@
+// Package repository provides internal APIs for accessing domain data.
+// This file provides access to the projects database for the AI assistant.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/csaptu/flow/pkg/config"
+)
+
+var (
+	projectsPool     *pgxpool.Pool
+	projectsPoolOnce sync.Once
+	projectsPoolErr  error
+)
+
+// InitProjectsDB initializes the projects database connection pool.
+func InitProjectsDB(cfg *config.Config) error {
+	projectsPoolOnce.Do(func() {
+		poolConfig, err := pgxpool.ParseConfig(cfg.Databases.Projects.DSN())
+		if err != nil {
+			projectsPoolErr = fmt.Errorf("failed to parse projects db config: %w", err)
+			return
+		}
+
+		poolConfig.MaxConns = 5
+		poolConfig.MinConns = 1
+		poolConfig.MaxConnLifetime = cfg.Databases.Projects.MaxLifetime
+
+		projectsPool, projectsPoolErr = pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if projectsPoolErr != nil {
+			projectsPoolErr = fmt.Errorf("failed to connect to projects db: %w", projectsPoolErr)
+			return
+		}
+
+		if err := projectsPool.Ping(context.Background()); err != nil {
+			projectsPoolErr = fmt.Errorf("failed to ping projects db: %w", err)
+			return
+		}
+	})
+
+	return projectsPoolErr
+}
+
+// CloseProjectsDB closes the projects database connection pool.
+func CloseProjectsDB() {
+	if projectsPool != nil {
+		projectsPool.Close()
+	}
+}
+
+// ErrProjectsDBNotInitialized is returned when the projects database is not initialized.
+var ErrProjectsDBNotInitialized = fmt.Errorf("projects database not initialized")
+
+// Project is a project the user is a member of.
+type Project struct {
+	ID             uuid.UUID
+	Name           string
+	Description    *string
+	Status         string
+	Role           string // The user's role in the project
+	TotalNodes     int
+	CompletedNodes int
+	TargetDate     *time.Time
+}
+
+// ListUserProjects returns the projects the user is a member of, most
+// recently updated first.
+func ListUserProjects(ctx context.Context, userID uuid.UUID, limit int) ([]Project, error) {
+	db := projectsPool
+	if db == nil {
+		return nil, ErrProjectsDBNotInitialized
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT p.id, p.name, p.description, p.status::text, pm.role::text, p.target_date,
+		       (SELECT COUNT(*) FROM wbs_nodes WHERE project_id = p.id AND deleted_at IS NULL),
+		       (SELECT COUNT(*) FROM wbs_nodes WHERE project_id = p.id AND status = 'completed' AND deleted_at IS NULL)
+		FROM projects p
+		JOIN project_members pm ON p.id = pm.project_id
+		WHERE pm.user_id = $1 AND pm.left_at IS NULL AND p.deleted_at IS NULL
+		ORDER BY p.updated_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []Project
+	for rows.Next() {
+		var p Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Status, &p.Role, &p.TargetDate,
+			&p.TotalNodes, &p.CompletedNodes); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// WBSNode is a work breakdown structure node created through the assistant.
+type WBSNode struct {
+	ID          uuid.UUID
+	ProjectID   uuid.UUID
+	ParentID    *uuid.UUID
+	Title       string
+	Description *string
+	Path        string
+	Depth       int
+	Position    int
+	CreatedAt   time.Time
+}
+
+// CreateWBSNode adds a node under parentID (or at the root) of a project the
+// user can edit. Returns nil if the project or parent doesn't exist or the
+// user isn't an editing member.
+func CreateWBSNode(ctx context.Context, userID, projectID uuid.UUID, parentID *uuid.UUID, title string, description *string) (*WBSNode, error) {
+	db := projectsPool
+	if db == nil {
+		return nil, ErrProjectsDBNotInitialized
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var canEdit bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM project_members pm JOIN projects p ON p.id = pm.project_id
+			WHERE pm.project_id = $1 AND pm.user_id = $2 AND pm.left_at IS NULL
+			  AND pm.role != 'viewer' AND p.deleted_at IS NULL
+		)
+	`, projectID, userID).Scan(&canEdit)
+	if err != nil {
+		return nil, err
+	}
+	if !canEdit {
+		return nil, nil
+	}
+
+	place, err := PlaceWBSNode(ctx, tx, projectID, parentID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	node := &WBSNode{
+		ID: uuid.New(), ProjectID: projectID, ParentID: parentID, Title: title, Description: description,
+		Path: place.Path, Depth: place.Depth, Position: place.Position, CreatedAt: time.Now(),
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO wbs_nodes (id, project_id, parent_id, user_id, title, description, status,
+		 priority, progress, depth, path, position, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 'pending', 0, 0, $7, $8, $9, 1, $10, $10)
+	`, node.ID, projectID, parentID, userID, title, description, node.Depth, node.Path, node.Position, node.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return node, tx.Commit(ctx)
+}
+
+// WBSPlacement is where a new node goes in a project's tree
+type WBSPlacement struct {
+	Depth    int
+	Path     string // Dotted positions from the root, e.g. "2.3"
+	Position int    // 1-based among its siblings
+}
+
+// PlaceWBSNode places a new node last under parentID, or last among the root
+// nodes when parentID is nil. Returns pgx.ErrNoRows if the parent isn't a
+// node of the project. Inside a transaction the parent row stays locked, so
+// concurrent creates under it don't share a position.
+func PlaceWBSNode(ctx context.Context, db DBTX, projectID uuid.UUID, parentID *uuid.UUID) (WBSPlacement, error) {
+	var place WBSPlacement
+	var maxPosition int
+	if parentID == nil {
+		err := db.QueryRow(ctx,
+			"SELECT COALESCE(MAX(position), 0) FROM wbs_nodes WHERE project_id = $1 AND parent_id IS NULL AND deleted_at IS NULL",
+			projectID,
+		).Scan(&maxPosition)
+		if err != nil {
+			return place, err
+		}
+		place.Position = maxPosition + 1
+		place.Path = strconv.Itoa(place.Position)
+		return place, nil
+	}
+
+	var parentPath string
+	var parentDepth int
+	err := db.QueryRow(ctx,
+		"SELECT path, depth FROM wbs_nodes WHERE id = $1 AND project_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		*parentID, projectID,
+	).Scan(&parentPath, &parentDepth)
+	if err != nil {
+		return place, err
+	}
+	err = db.QueryRow(ctx,
+		"SELECT COALESCE(MAX(position), 0) FROM wbs_nodes WHERE parent_id = $1 AND deleted_at IS NULL",
+		*parentID,
+	).Scan(&maxPosition)
+	if err != nil {
+		return place, err
+	}
+	place.Depth = parentDepth + 1
+	place.Position = maxPosition + 1
+	place.Path = parentPath + "." + strconv.Itoa(place.Position)
+	return place, nil
+}
+
+// ProjectMemberIDs returns the active members of a project
+func ProjectMemberIDs(ctx context.Context, db DBTX, projectID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := db.Query(ctx,
+		"SELECT user_id FROM project_members WHERE project_id = $1 AND left_at IS NULL",
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		memberIDs = append(memberIDs, id)
+	}
+	return memberIDs, rows.Err()
+}
+
+// ProjectsDB returns the projects database pool for functions that take a
+// DBTX, or nil if it is not initialized.
+func ProjectsDB() DBTX {
+	if projectsPool == nil {
+		return nil
+	}
+	return projectsPool
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AIRejection is an AI suggestion the user turned down in review mode
+type AIRejection struct {
+	Field         string // title, description, due_at, complexity, entities
+	TaskTitle     string
+	Value         []byte  // Suggested value (JSON)
+	PreviousValue []byte  // The task's value at the time (JSON)
+	Feedback      *string // The user's reason, if given
+	RejectedAt    time.Time
+}
+
+// GetRecentAIRejections returns the user's latest rejected AI suggestions,
+// so profile analysis can learn what the user doesn't want changed
+func GetRecentAIRejections(ctx context.Context, userID uuid.UUID, days, limit int) ([]AIRejection, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT s.field, t.title, s.value, s.previous_value, s.feedback, s.resolved_at
+		FROM ai_suggestions s
+		JOIN tasks t ON t.id = s.task_id
+		WHERE s.user_id = $1 AND s.status = 'rejected'
+		  AND s.resolved_at > NOW() - make_interval(days => $2)
+		ORDER BY s.resolved_at DESC
+		LIMIT $3
+	`, userID, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rejections []AIRejection
+	for rows.Next() {
+		var r AIRejection
+		if err := rows.Scan(&r.Field, &r.TaskTitle, &r.Value, &r.PreviousValue, &r.Feedback, &r.RejectedAt); err != nil {
+			continue
+		}
+		rejections = append(rejections, r)
+	}
+
+	return rejections, nil
+}
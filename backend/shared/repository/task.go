@@ -71,6 +71,15 @@ func getTasksPool() *pgxpool.Pool {
 	return tasksPool
 }
 
+// TasksDB returns the tasks database pool for functions that take a DBTX,
+// or nil if it is not initialized.
+func TasksDB() DBTX {
+	if tasksPool == nil {
+		return nil
+	}
+	return tasksPool
+}
+
 // ErrTasksDBNotInitialized is returned when the tasks database is not initialized.
 var ErrTasksDBNotInitialized = fmt.Errorf("tasks database not initialized")
 
@@ -291,6 +300,9 @@ func UpdateTaskAIFields(ctx context.Context, taskID, userID uuid.UUID, updates m
 		"ai_extracted_due":       "ai_extracted_due",
 		"duplicate_of":           "duplicate_of",
 		"duplicate_resolved":     "duplicate_resolved",
+		"priority":               "priority",
+		"tags":                   "tags",
+		"last_modified_by":       "last_modified_by",
 	}
 
 	for key, dbField := range fieldMap {
@@ -321,8 +333,41 @@ func UpdateTaskAIFields(ctx context.Context, taskID, userID uuid.UUID, updates m
 		argNum+1,
 	)
 
-	_, err := db.Exec(ctx, query, args...)
-	return err
+	tag, err := db.Exec(ctx, query, args...)
+	if err != nil || tag.RowsAffected() == 0 {
+		return err
+	}
+
+	if raw, ok := updates["ai_entities"]; ok {
+		var entities []TaskEntity
+		switch v := raw.(type) {
+		case []byte:
+			_ = json.Unmarshal(v, &entities)
+		case []TaskEntity:
+			entities = v
+		}
+		return SyncTaskEntities(ctx, db, userID, taskID, entities)
+	}
+	return nil
+}
+
+// GetTaskAIPromptVersion returns the prompt version behind a task's AI
+// changes, or nil if they didn't come from a versioned prompt
+func GetTaskAIPromptVersion(ctx context.Context, taskID, userID uuid.UUID) (*uuid.UUID, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	var version *uuid.UUID
+	err := db.QueryRow(ctx,
+		`SELECT ai_prompt_version FROM tasks WHERE id = $1 AND user_id = $2`,
+		taskID, userID,
+	).Scan(&version)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return version, err
 }
 
 // CreateSubtask creates a subtask under a parent task.
@@ -347,6 +392,231 @@ func CreateSubtask(ctx context.Context, userID, parentID uuid.UUID, title string
 	return subtaskID, nil
 }
 
+// TaskFilter narrows SearchTasks.
+type TaskFilter struct {
+	Query  string // Matched against title and description
+	Status string // open (default), completed or all
+	Tag    string
+	DueBy  *time.Time
+	Limit  int
+}
+
+// SearchTasks returns the user's tasks matching the filter, soonest due first.
+func SearchTasks(ctx context.Context, userID uuid.UUID, f TaskFilter) ([]*Task, error) {
+	db := getTasksPool()
+	if db == nil {
+		return nil, ErrTasksDBNotInitialized
+	}
+
+	where := []string{"user_id = $1", "deleted_at IS NULL"}
+	args := []interface{}{userID}
+	switch f.Status {
+	case "completed":
+		where = append(where, "status = 'completed'")
+	case "all":
+	default:
+		where = append(where, "status NOT IN ('completed', 'cancelled', 'archived')")
+	}
+	if f.Query != "" {
+		args = append(args, "%"+f.Query+"%")
+		where = append(where, fmt.Sprintf("(title ILIKE $%d OR ai_cleaned_title ILIKE $%[1]d OR description ILIKE $%[1]d)", len(args)))
+	}
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		where = append(where, fmt.Sprintf("$%d = ANY(tags)", len(args)))
+	}
+	if f.DueBy != nil {
+		args = append(args, *f.DueBy)
+		where = append(where, fmt.Sprintf("due_at <= $%d", len(args)))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 20
+	}
+	args = append(args, f.Limit)
+
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT id, user_id, title, description, status, priority,
+		       due_at, has_due_time, completed_at, tags, parent_id, depth, COALESCE(complexity, 0),
+		       ai_cleaned_title, ai_cleaned_description,
+		       COALESCE(ai_extracted_due, false), COALESCE(skip_auto_cleanup, false),
+		       version, created_at, updated_at
+		FROM tasks
+		WHERE %s
+		ORDER BY due_at ASC NULLS LAST, priority DESC, created_at DESC
+		LIMIT $%d
+	`, joinStrings(where, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*Task
+	for rows.Next() {
+		var t Task
+		if err := rows.Scan(
+			&t.ID, &t.UserID, &t.Title, &t.Description,
+			&t.Status, &t.Priority, &t.DueAt, &t.HasDueTime, &t.CompletedAt, &t.Tags,
+			&t.ParentID, &t.Depth, &t.Complexity,
+			&t.AICleanedTitle, &t.AICleanedDescription, &t.AIExtractedDue,
+			&t.SkipAutoCleanup,
+			&t.Version, &t.CreatedAt, &t.UpdatedAt,
+		); err != nil {
+			continue
+		}
+		tasks = append(tasks, &t)
+	}
+
+	return tasks, nil
+}
+
+// CreateTask creates a top-level task for the user.
+func CreateTask(ctx context.Context, userID uuid.UUID, title string, description *string, dueAt *time.Time, hasDueTime bool, priority int, tags []string) (uuid.UUID, error) {
+	db := getTasksPool()
+	if db == nil {
+		return uuid.Nil, ErrTasksDBNotInitialized
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+
+	taskID := uuid.New()
+	_, err := db.Exec(ctx, `
+		INSERT INTO tasks (id, user_id, title, description, status, priority, due_at, has_due_time, tags,
+		 depth, ai_entities, version, created_at, updated_at, created_by, last_modified_by)
+		VALUES ($1, $2, $3, $4, 'pending', $5, $6, $7, $8, 0, '[]', 1, NOW(), NOW(), $2, $2)
+	`, taskID, userID, title, description, priority, dueAt, hasDueTime, tags)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return taskID, nil
+}
+
+// CompleteTask marks one of the user's tasks completed. Reports whether a
+// task changed; completing a completed task is a no-op.
+func CompleteTask(ctx context.Context, taskID, userID uuid.UUID) (bool, error) {
+	db := getTasksPool()
+	if db == nil {
+		return false, ErrTasksDBNotInitialized
+	}
+
+	tag, err := db.Exec(ctx, `
+		UPDATE tasks SET status = 'completed', completed_at = NOW(), version = version + 1,
+		       updated_at = NOW(), last_modified_by = $2
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND status != 'completed'
+	`, taskID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AIJobSourceAssistant marks AI jobs queued for tasks the assistant created
+const AIJobSourceAssistant = "assistant"
+
+// aiJobMaxAttempts is how many times a queued AI job runs before it is dead
+const aiJobMaxAttempts = 5
+
+// EnqueueAIJob schedules AI auto-processing of a task on the tasks service's
+// job workers. If a job for the task is already waiting, that job covers
+// this request too.
+func EnqueueAIJob(ctx context.Context, db DBTX, userID, taskID uuid.UUID, source string) error {
+	// Features are decided when the job runs, from the task as it is then
+	_, err := db.Exec(ctx,
+		`INSERT INTO ai_processing_queue (user_id, task_id, features, source, max_attempts)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (task_id) WHERE status = 'pending' DO NOTHING`,
+		userID, taskID, []string{"auto"}, source, aiJobMaxAttempts,
+	)
+	return err
+}
+
+// RecordTaskActivity attributes a change to the user. Only shared tasks keep
+// a history - private tasks have a single author by definition.
+func RecordTaskActivity(ctx context.Context, db DBTX, taskID, userID uuid.UUID, action string, changes []string) error {
+	if changes == nil {
+		changes = []string{}
+	}
+	changesJSON, _ := json.Marshal(changes)
+
+	_, err := db.Exec(ctx,
+		`INSERT INTO task_activity (task_id, user_id, action, changes)
+		 SELECT $1, $2, $3, $4
+		 WHERE EXISTS (SELECT 1 FROM shared_task_access WHERE task_id = $1)`,
+		taskID, userID, action, changesJSON,
+	)
+	return err
+}
+
+// AccessGrant is a participant's access to a task through a share
+type AccessGrant struct {
+	TaskID uuid.UUID
+	UserID uuid.UUID
+}
+
+// TaskShareGrants returns who sees a task or its subtasks through a share.
+// Take it before changing tags or parent, then pass it to RecordLostAccess.
+func TaskShareGrants(ctx context.Context, db DBTX, taskID uuid.UUID) ([]AccessGrant, error) {
+	return queryAccessGrants(ctx, db,
+		`SELECT DISTINCT a.task_id, a.user_id FROM shared_task_access a
+		 WHERE a.task_id = $1 OR a.task_id IN (SELECT id FROM tasks WHERE parent_id = $1)`,
+		taskID,
+	)
+}
+
+// ShareGrants returns the access a share gives, to one member when memberID
+// is set or else to all of them
+func ShareGrants(ctx context.Context, db DBTX, shareID uuid.UUID, memberID *uuid.UUID) ([]AccessGrant, error) {
+	return queryAccessGrants(ctx, db,
+		`SELECT DISTINCT a.task_id, a.user_id FROM shared_task_access a
+		 WHERE a.share_id = $1
+		 AND ($2::uuid IS NULL OR a.user_id = (SELECT user_id FROM task_share_members WHERE id = $2))`,
+		shareID, memberID,
+	)
+}
+
+func queryAccessGrants(ctx context.Context, db DBTX, query string, args ...interface{}) ([]AccessGrant, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []AccessGrant
+	for rows.Next() {
+		var g AccessGrant
+		if err := rows.Scan(&g.TaskID, &g.UserID); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// RecordLostAccess keeps a tombstone for every grant no share gives any more,
+// so the participant's next sync deletes the task
+func RecordLostAccess(ctx context.Context, db DBTX, grants []AccessGrant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]uuid.UUID, len(grants))
+	userIDs := make([]uuid.UUID, len(grants))
+	for i, g := range grants {
+		taskIDs[i] = g.TaskID
+		userIDs[i] = g.UserID
+	}
+
+	_, err := db.Exec(ctx,
+		`INSERT INTO task_access_revocations (task_id, user_id)
+		 SELECT g.task_id, g.user_id FROM UNNEST($1::uuid[], $2::uuid[]) AS g(task_id, user_id)
+		 WHERE NOT EXISTS (SELECT 1 FROM shared_task_access a WHERE a.task_id = g.task_id AND a.user_id = g.user_id)
+		 ON CONFLICT (task_id, user_id) DO UPDATE SET revoked_at = NOW()`,
+		taskIDs, userIDs,
+	)
+	return err
+}
+
 // GetAIUsage returns AI usage for a user for today.
 func GetAIUsage(ctx context.Context, userID uuid.UUID) (map[string]int, error) {
 	db := getTasksPool()
@@ -393,6 +663,21 @@ func IncrementAIUsage(ctx context.Context, userID uuid.UUID, feature string) err
 	return err
 }
 
+// DecrementAIUsage takes back one use of a feature counted today.
+func DecrementAIUsage(ctx context.Context, userID uuid.UUID, feature string) error {
+	db := getTasksPool()
+	if db == nil {
+		return ErrTasksDBNotInitialized
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE ai_usage SET count = count - 1
+		WHERE user_id = $1 AND feature = $2 AND used_at = CURRENT_DATE AND count > 0
+	`, userID, feature)
+
+	return err
+}
+
 // SaveAIDraft saves an AI-generated draft.
 func SaveAIDraft(ctx context.Context, userID, taskID uuid.UUID, draftType string, content []byte) (uuid.UUID, error) {
 	db := getTasksPool()
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// taskEmbeddingText is the SQL for the text a task is embedded from; its md5
+// is the stored content_hash
+const taskEmbeddingText = `t.title || E'\n' || COALESCE(t.description, '')`
+
+// StaleTaskEmbedding is a task whose embedding is missing or out of date
+type StaleTaskEmbedding struct {
+	TaskID    uuid.UUID
+	UserID    uuid.UUID
+	Text      string
+	Hash      string
+	UpdatedAt time.Time
+}
+
+// TaskEmbeddingMatch is a task near a query vector; Score is the cosine
+// similarity
+type TaskEmbeddingMatch struct {
+	TaskID uuid.UUID
+	Score  float64
+}
+
+// TaskEmbeddingVector is one stored embedding
+type TaskEmbeddingVector struct {
+	TaskID uuid.UUID
+	Vector []float32
+}
+
+// HasPgvector reports whether the vector extension is installed in the
+// tasks database
+func HasPgvector(ctx context.Context, db DBTX) (bool, error) {
+	var ok bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector')`).Scan(&ok)
+	return ok, err
+}
+
+// GetStaleTaskEmbeddings returns up to limit tasks with no embedding from
+// model, or whose title or description changed since theirs was made,
+// most recently edited first. Tasks of the users in skipUsers are left out.
+func GetStaleTaskEmbeddings(ctx context.Context, db DBTX, model string, skipUsers []uuid.UUID, limit int) ([]StaleTaskEmbedding, error) {
+	if skipUsers == nil {
+		skipUsers = []uuid.UUID{}
+	}
+
+	// Edits that left the text alone only move task_updated_at forward, so
+	// those tasks aren't hashed again on every pass
+	_, err := db.Exec(ctx, `
+		UPDATE task_embeddings e SET task_updated_at = t.updated_at
+		FROM tasks t
+		WHERE t.id = e.task_id
+		  AND t.updated_at > e.task_updated_at
+		  AND e.model = $1
+		  AND e.content_hash = md5(`+taskEmbeddingText+`)
+	`, model)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT t.id, t.user_id, `+taskEmbeddingText+`, md5(`+taskEmbeddingText+`), t.updated_at
+		FROM tasks t
+		LEFT JOIN task_embeddings e ON e.task_id = t.id
+		WHERE t.deleted_at IS NULL
+		  AND NOT (t.user_id = ANY($3))
+		  AND (e.task_id IS NULL OR e.model != $1 OR
+		       (t.updated_at > e.task_updated_at AND e.content_hash != md5(`+taskEmbeddingText+`)))
+		ORDER BY t.updated_at DESC
+		LIMIT $2
+	`, model, limit, skipUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stale []StaleTaskEmbedding
+	for rows.Next() {
+		var s StaleTaskEmbedding
+		if err := rows.Scan(&s.TaskID, &s.UserID, &s.Text, &s.Hash, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		stale = append(stale, s)
+	}
+	return stale, rows.Err()
+}
+
+// UpsertTaskEmbedding stores a task's embedding, made from the text with
+// the given hash as of the task's updated_at
+func UpsertTaskEmbedding(ctx context.Context, db DBTX, task StaleTaskEmbedding, model string, vector []float32) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO task_embeddings (task_id, user_id, model, content_hash, embedding, task_updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (task_id) DO UPDATE SET
+			model = EXCLUDED.model,
+			content_hash = EXCLUDED.content_hash,
+			embedding = EXCLUDED.embedding,
+			task_updated_at = EXCLUDED.task_updated_at,
+			updated_at = NOW()
+	`, task.TaskID, task.UserID, model, task.Hash, vector, task.UpdatedAt)
+	return err
+}
+
+// GetTaskEmbedding returns a task's embedding from model, or nil if it has
+// none yet
+func GetTaskEmbedding(ctx context.Context, db DBTX, userID, taskID uuid.UUID, model string) ([]float32, error) {
+	var vector []float32
+	err := db.QueryRow(ctx, `
+		SELECT embedding FROM task_embeddings
+		WHERE task_id = $1 AND user_id = $2 AND model = $3
+	`, taskID, userID, model).Scan(&vector)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return vector, err
+}
+
+// NearestTaskEmbeddings ranks a user's live tasks by cosine similarity to
+// vector using pgvector, leaving out the tasks in exclude
+func NearestTaskEmbeddings(ctx context.Context, db DBTX, userID uuid.UUID, model string, vector []float32, exclude []uuid.UUID, limit int) ([]TaskEmbeddingMatch, error) {
+	if exclude == nil {
+		exclude = []uuid.UUID{} // NULL would make the ANY filter drop every row
+	}
+	rows, err := db.Query(ctx, `
+		SELECT e.task_id, 1 - (e.embedding::vector <=> $3::real[]::vector) AS score
+		FROM task_embeddings e
+		JOIN tasks t ON t.id = e.task_id
+		WHERE e.user_id = $1
+		  AND e.model = $2
+		  AND t.deleted_at IS NULL
+		  AND NOT (e.task_id = ANY($4))
+		ORDER BY e.embedding::vector <=> $3::real[]::vector
+		LIMIT $5
+	`, userID, model, vector, exclude, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []TaskEmbeddingMatch
+	for rows.Next() {
+		var m TaskEmbeddingMatch
+		if err := rows.Scan(&m.TaskID, &m.Score); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// ListTaskEmbeddings returns the embeddings of a user's live tasks from
+// model, for ranking in process when pgvector is missing
+func ListTaskEmbeddings(ctx context.Context, db DBTX, userID uuid.UUID, model string) ([]TaskEmbeddingVector, error) {
+	rows, err := db.Query(ctx, `
+		SELECT e.task_id, e.embedding
+		FROM task_embeddings e
+		JOIN tasks t ON t.id = e.task_id
+		WHERE e.user_id = $1 AND e.model = $2 AND t.deleted_at IS NULL
+	`, userID, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vectors []TaskEmbeddingVector
+	for rows.Next() {
+		var v TaskEmbeddingVector
+		if err := rows.Scan(&v.TaskID, &v.Vector); err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, rows.Err()
+}
@@ -150,7 +150,9 @@ func ListUsersWithSubscriptions(ctx context.Context, tier string, limit, offset
 }
 
 // AIPreferences represents user's AI feature preferences
-// Each feature can be "auto" (automatic) or "ask" (manual)
+// Each feature can be "auto" (automatic) or "ask" (manual). Features that
+// write a task field can also be "review": they run automatically but the
+// result waits as a suggestion until the user accepts it.
 type AIPreferences struct {
 	CleanTitle       string `json:"clean_title"`
 	CleanDescription string `json:"clean_description"`
@@ -161,6 +163,20 @@ type AIPreferences struct {
 	SmartDueDate     string `json:"smart_due_date"`
 }
 
+// reviewableAIFeatures are the features whose output can be held for review
+var reviewableAIFeatures = map[string]bool{
+	"clean_title":       true,
+	"clean_description": true,
+	"entity_extraction": true,
+	"complexity":        true,
+	"smart_due_date":    true,
+}
+
+// IsReviewableAIFeature reports whether a feature accepts the "review" preference
+func IsReviewableAIFeature(feature string) bool {
+	return reviewableAIFeatures[feature]
+}
+
 // DefaultAIPreferences returns the default AI preferences
 func DefaultAIPreferences() AIPreferences {
 	return AIPreferences{
@@ -240,3 +256,70 @@ func GetUserAIPreferencesMap(ctx context.Context, userID uuid.UUID) (map[string]
 		"smart_due_date":    prefs.SmartDueDate,
 	}, nil
 }
+
+// GetUserAIPrivacyMode reports whether a user keeps their AI calls on the
+// local model
+func GetUserAIPrivacyMode(ctx context.Context, userID uuid.UUID) (bool, error) {
+	db := getPool()
+
+	var private bool
+	err := db.QueryRow(ctx, `
+		SELECT ai_privacy_mode FROM users WHERE id = $1
+	`, userID).Scan(&private)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return private, err
+}
+
+// SetUserAIPrivacyMode turns a user's AI privacy mode on or off
+func SetUserAIPrivacyMode(ctx context.Context, userID uuid.UUID, private bool) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		UPDATE users
+		SET ai_privacy_mode = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`, private, userID)
+
+	return err
+}
+
+// ListAIPrivacyModeUserIDs returns the users in AI privacy mode
+func ListAIPrivacyModeUserIDs(ctx context.Context) ([]uuid.UUID, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, `SELECT id FROM users WHERE ai_privacy_mode`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetUserTimezone returns the IANA time zone from the user's settings, or ""
+// if none is set
+func GetUserTimezone(ctx context.Context, userID uuid.UUID) (string, error) {
+	db := getPool()
+
+	var tz string
+	err := db.QueryRow(ctx, `
+		SELECT COALESCE(settings->>'timezone', '')
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&tz)
+
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return tz, err
+}
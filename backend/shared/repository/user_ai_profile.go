@@ -268,6 +268,7 @@ func GetRecentTasksForProfile(ctx context.Context, userID uuid.UUID, daysToAnaly
 		       to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"') as created_at
 		FROM tasks
 		WHERE user_id = $1
+		  AND (created_by IS NULL OR created_by = user_id) -- skip tasks others added to shared lists
 		  AND deleted_at IS NULL
 		  AND created_at > NOW() - make_interval(days => $2)
 		ORDER BY created_at DESC
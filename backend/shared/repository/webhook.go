@@ -0,0 +1,384 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// WebhookEndpoint represents a user-registered webhook target
+type WebhookEndpoint struct {
+	ID             uuid.UUID
+	UserID         uuid.UUID
+	URL            string
+	Description    *string
+	Secret         string
+	Events         []string
+	Active         bool
+	FailingSince   *time.Time
+	DisabledAt     *time.Time
+	DisabledReason *string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// WebhookDelivery represents one delivery of an event to an endpoint
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode *int
+	LastError      *string
+	LastResponse   *string
+	ReplayOf       *uuid.UUID
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// ClaimedWebhookDelivery is a due delivery together with its endpoint target
+type ClaimedWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+const webhookEndpointColumns = `id, user_id, url, description, secret, events, active,
+	failing_since, disabled_at, disabled_reason, created_at, updated_at`
+
+const webhookDeliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_status_code, last_error, last_response, replay_of, created_at, delivered_at`
+
+func scanWebhookEndpoint(row pgx.Row) (*WebhookEndpoint, error) {
+	var e WebhookEndpoint
+	err := row.Scan(
+		&e.ID, &e.UserID, &e.URL, &e.Description, &e.Secret, &e.Events, &e.Active,
+		&e.FailingSince, &e.DisabledAt, &e.DisabledReason, &e.CreatedAt, &e.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func scanWebhookDelivery(row pgx.Row) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(
+		&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.LastResponse, &d.ReplayOf,
+		&d.CreatedAt, &d.DeliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CreateWebhookEndpoint registers a new webhook endpoint for a user.
+func CreateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) error {
+	db := getPool()
+
+	return db.QueryRow(ctx, `
+		INSERT INTO webhook_endpoints (user_id, url, description, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5, TRUE)
+		RETURNING `+webhookEndpointColumns,
+		e.UserID, e.URL, e.Description, e.Secret, e.Events,
+	).Scan(
+		&e.ID, &e.UserID, &e.URL, &e.Description, &e.Secret, &e.Events, &e.Active,
+		&e.FailingSince, &e.DisabledAt, &e.DisabledReason, &e.CreatedAt, &e.UpdatedAt,
+	)
+}
+
+// ListWebhookEndpoints returns all webhook endpoints owned by a user.
+func ListWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]*WebhookEndpoint, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, `
+		SELECT `+webhookEndpointColumns+`
+		FROM webhook_endpoints
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []*WebhookEndpoint
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			continue
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint returns a webhook endpoint by ID and owner.
+// Returns nil if not found.
+func GetWebhookEndpoint(ctx context.Context, endpointID, userID uuid.UUID) (*WebhookEndpoint, error) {
+	db := getPool()
+
+	e, err := scanWebhookEndpoint(db.QueryRow(ctx, `
+		SELECT `+webhookEndpointColumns+`
+		FROM webhook_endpoints
+		WHERE id = $1 AND user_id = $2
+	`, endpointID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// UpdateWebhookEndpoint updates the editable fields of an endpoint.
+// Re-activating an endpoint clears its failure streak.
+func UpdateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		UPDATE webhook_endpoints SET
+			url = $3,
+			description = $4,
+			events = $5,
+			active = $6,
+			failing_since = CASE WHEN $6 AND NOT active THEN NULL ELSE failing_since END,
+			disabled_at = CASE WHEN $6 THEN NULL ELSE disabled_at END,
+			disabled_reason = CASE WHEN $6 THEN NULL ELSE disabled_reason END,
+			updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+	`, e.ID, e.UserID, e.URL, e.Description, e.Events, e.Active)
+
+	return err
+}
+
+// RotateWebhookSecret replaces the signing secret of an endpoint.
+func RotateWebhookSecret(ctx context.Context, endpointID, userID uuid.UUID, secret string) (int64, error) {
+	db := getPool()
+
+	result, err := db.Exec(ctx, `
+		UPDATE webhook_endpoints SET secret = $3, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+	`, endpointID, userID, secret)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// DeleteWebhookEndpoint removes an endpoint and its delivery log.
+func DeleteWebhookEndpoint(ctx context.Context, endpointID, userID uuid.UUID) (int64, error) {
+	db := getPool()
+
+	result, err := db.Exec(ctx, `
+		DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2
+	`, endpointID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// EnqueueWebhookEvent creates one pending delivery for every active endpoint
+// of the user that subscribes to the event type. Returns the number queued.
+func EnqueueWebhookEvent(ctx context.Context, userID, eventID uuid.UUID, eventType string, payload []byte) (int64, error) {
+	db := getPool()
+
+	result, err := db.Exec(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $4
+		FROM webhook_endpoints
+		WHERE user_id = $1 AND active AND $3 = ANY(events)
+	`, userID, eventID, eventType, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// ClaimDueWebhookDeliveries leases up to limit pending deliveries whose next
+// attempt is due. The lease is implemented by pushing next_attempt_at forward,
+// so a crashed worker's deliveries become due again once the lease expires.
+func ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*ClaimedWebhookDelivery, error) {
+	db := getPool()
+
+	rows, err := db.Query(ctx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM webhook_endpoints e
+		WHERE e.id = d.endpoint_id
+		  AND d.id IN (
+			SELECT d2.id
+			FROM webhook_deliveries d2
+			JOIN webhook_endpoints e2 ON e2.id = d2.endpoint_id
+			WHERE d2.status = 'pending' AND d2.next_attempt_at <= NOW() AND e2.active
+			ORDER BY d2.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d2 SKIP LOCKED
+		  )
+		RETURNING d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		          d.next_attempt_at, d.last_status_code, d.last_error, d.last_response, d.replay_of,
+		          d.created_at, d.delivered_at, e.url, e.secret
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []*ClaimedWebhookDelivery
+	for rows.Next() {
+		var c ClaimedWebhookDelivery
+		if err := rows.Scan(
+			&c.ID, &c.EndpointID, &c.EventID, &c.EventType, &c.Payload, &c.Status, &c.Attempts,
+			&c.NextAttemptAt, &c.LastStatusCode, &c.LastError, &c.LastResponse, &c.ReplayOf,
+			&c.CreatedAt, &c.DeliveredAt, &c.URL, &c.Secret,
+		); err != nil {
+			continue
+		}
+		claimed = append(claimed, &c)
+	}
+
+	return claimed, rows.Err()
+}
+
+// MarkWebhookDeliverySucceeded records a successful attempt and resets the
+// endpoint's failure streak.
+func MarkWebhookDeliverySucceeded(ctx context.Context, deliveryID, endpointID uuid.UUID, statusCode int, response string) error {
+	db := getPool()
+
+	_, err := db.Exec(ctx, `
+		UPDATE webhook_deliveries SET
+			status = 'succeeded', attempts = attempts + 1,
+			last_status_code = $2, last_error = NULL, last_response = $3,
+			delivered_at = NOW()
+		WHERE id = $1
+	`, deliveryID, statusCode, response)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `
+		UPDATE webhook_endpoints SET failing_since = NULL WHERE id = $1 AND failing_since IS NOT NULL
+	`, endpointID)
+	return err
+}
+
+// MarkWebhookDeliveryFailed records a failed attempt. If nextAttempt is nil the
+// delivery is given up on; otherwise it is rescheduled. The endpoint's failure
+// streak is started if it is not already running.
+func MarkWebhookDeliveryFailed(ctx context.Context, deliveryID, endpointID uuid.UUID, statusCode *int, errMsg, response string, nextAttempt *time.Time) error {
+	db := getPool()
+
+	status := "pending"
+	if nextAttempt == nil {
+		status = "failed"
+	}
+
+	_, err := db.Exec(ctx, `
+		UPDATE webhook_deliveries SET
+			status = $2, attempts = attempts + 1,
+			last_status_code = $3, last_error = $4, last_response = $5,
+			next_attempt_at = COALESCE($6, next_attempt_at)
+		WHERE id = $1
+	`, deliveryID, status, statusCode, errMsg, response, nextAttempt)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `
+		UPDATE webhook_endpoints SET failing_since = NOW() WHERE id = $1 AND failing_since IS NULL
+	`, endpointID)
+	return err
+}
+
+// DisableFailingWebhookEndpoints deactivates endpoints whose failure streak is
+// older than the given duration. Returns the number of endpoints disabled.
+func DisableFailingWebhookEndpoints(ctx context.Context, failingFor time.Duration, reason string) (int64, error) {
+	db := getPool()
+
+	result, err := db.Exec(ctx, `
+		UPDATE webhook_endpoints SET
+			active = FALSE, disabled_at = NOW(), disabled_reason = $2, updated_at = NOW()
+		WHERE active AND failing_since IS NOT NULL
+		  AND failing_since < NOW() - make_interval(secs => $1)
+	`, failingFor.Seconds(), reason)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// ListWebhookDeliveries returns the delivery log of an endpoint, newest first.
+func ListWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, limit, offset int) ([]*WebhookDelivery, int, error) {
+	db := getPool()
+
+	var total int
+	if err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM webhook_deliveries WHERE endpoint_id = $1
+	`, endpointID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, endpointID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, total, nil
+}
+
+// GetWebhookDelivery returns a delivery belonging to the given endpoint.
+// Returns nil if not found.
+func GetWebhookDelivery(ctx context.Context, deliveryID, endpointID uuid.UUID) (*WebhookDelivery, error) {
+	db := getPool()
+
+	d, err := scanWebhookDelivery(db.QueryRow(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE id = $1 AND endpoint_id = $2
+	`, deliveryID, endpointID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// ReplayWebhookDelivery queues a fresh delivery with the same event and
+// payload as an earlier one. The original log entry is left untouched.
+func ReplayWebhookDelivery(ctx context.Context, original *WebhookDelivery) (*WebhookDelivery, error) {
+	db := getPool()
+
+	return scanWebhookDelivery(db.QueryRow(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, replay_of)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+webhookDeliveryColumns,
+		original.EndpointID, original.EventID, original.EventType, original.Payload, original.ID,
+	))
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
@@ -17,20 +16,28 @@ import (
 	"github.com/csaptu/flow/pkg/config"
 	"github.com/csaptu/flow/pkg/llm"
 	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/accesstoken"
 	"github.com/csaptu/flow/shared/ai"
 	"github.com/csaptu/flow/shared/auth"
+	"github.com/csaptu/flow/shared/llmcache"
+	"github.com/csaptu/flow/shared/llmroute"
+	"github.com/csaptu/flow/shared/llmusage"
+	"github.com/csaptu/flow/shared/privacy"
+	"github.com/csaptu/flow/shared/prompts"
 	"github.com/csaptu/flow/shared/repository"
 	"github.com/csaptu/flow/shared/subscription"
 	"github.com/csaptu/flow/shared/user"
+	"github.com/csaptu/flow/shared/webhook"
 )
 
 // Server represents the shared service server
 type Server struct {
-	app    *fiber.App
-	config *config.Config
-	db     *pgxpool.Pool
-	redis  *redis.Client
-	llm    *llm.MultiClient
+	app        *fiber.App
+	config     *config.Config
+	db         *pgxpool.Pool
+	redis      *redis.Client
+	llm        *llm.MultiClient
+	dispatcher *webhook.Dispatcher
 }
 
 // NewServer creates a new shared service server
@@ -54,6 +61,11 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		fmt.Printf("[Shared] Tasks DB connection successful\n")
 	}
 
+	// Initialize projects database connection (for the AI assistant's project tools)
+	if err := repository.InitProjectsDB(cfg); err != nil {
+		fmt.Printf("Warning: Projects DB initialization failed (assistant project tools disabled): %v\n", err)
+	}
+
 	// Initialize Redis client
 	redisClient, err := initRedis(cfg.Redis)
 	if err != nil {
@@ -70,19 +82,39 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		OpenAIProjectID: cfg.LLM.OpenAIProjectID,
 		OllamaHost:      cfg.LLM.OllamaHost,
 		OllamaModel:     cfg.LLM.OllamaModel,
+		FakeMode:        llm.FakeMode(cfg.LLM.FakeMode),
+		CassetteDir:     cfg.LLM.CassetteDir,
+		FakeUpstream:    llm.Provider(cfg.LLM.FakeUpstream),
+		Fallbacks:       cfg.LLM.Fallbacks,
+		Retry:           llm.RetryPolicy{MaxAttempts: cfg.LLM.RetryAttempts},
+		Breaker:         llm.BreakerPolicy{Failures: cfg.LLM.BreakerFailures, CoolDown: cfg.LLM.BreakerCoolDown},
+
+		EmbeddingProvider: llm.Provider(cfg.LLM.EmbeddingProvider),
+		EmbeddingModel:    cfg.LLM.EmbeddingModel,
+		Endpoints:         cfg.LLM.Endpoints,
 	})
 	if err != nil {
 		// LLM client is optional, log warning but continue
 		fmt.Printf("Warning: LLM client initialization failed: %v\n", err)
 	}
+	llmcache.Enable(llmClient, redisClient, cfg.LLM)
+	llmusage.Enable(llmClient, cfg.LLM)
+	privacy.Enable(llmClient, repository.TasksDB())
+	llmroute.Enable(llmClient)
+	go prompts.Listen(context.Background(), redisClient)
+	go llmroute.Listen(context.Background(), redisClient)
 
 	server := &Server{
-		config: cfg,
-		db:     db,
-		redis:  redisClient,
-		llm:    llmClient,
+		config:     cfg,
+		db:         db,
+		redis:      redisClient,
+		llm:        llmClient,
+		dispatcher: webhook.NewDispatcher(5 * time.Second),
 	}
 
+	// Start outgoing webhook delivery (events are queued by all services)
+	server.dispatcher.Start()
+
 	// Create Fiber app
 	server.app = server.createApp()
 
@@ -148,6 +180,10 @@ func (s *Server) registerRoutes() {
 	subHandler := subscription.NewHandler(s.db)
 	v1.Get("/subscriptions/plans", subHandler.ListPlans)
 
+	// Email delivery events for sent AI drafts (public, signature verified)
+	draftSender := ai.NewDraftSender(s.config, s.redis)
+	v1.Post("/webhooks/email-events", draftSender.EmailEvents)
+
 	// Auth routes (public)
 	authHandler := auth.NewHandler(s.db, s.redis, s.config)
 	authRoutes := v1.Group("/auth")
@@ -168,7 +204,8 @@ func (s *Server) registerRoutes() {
 	// Protected routes
 	protected := v1.Group("")
 	protected.Use(middleware.Auth(middleware.AuthConfig{
-		JWTSecret: s.config.Auth.JWTSecret,
+		JWTSecret:      s.config.Auth.JWTSecret,
+		TokenValidator: accesstoken.Validate,
 		SkipPaths: []string{
 			"/api/v1/auth/login",
 			"/api/v1/auth/dev-login",
@@ -186,49 +223,93 @@ func (s *Server) registerRoutes() {
 		},
 	}))
 
+	// Personal access token management (session only - tokens cannot mint tokens)
+	tokenHandler := accesstoken.NewHandler()
+	tokens := protected.Group("/auth/tokens", middleware.RequireSession())
+	tokens.Get("/scopes", tokenHandler.ListScopes)
+	tokens.Post("", tokenHandler.Create)
+	tokens.Get("", tokenHandler.List)
+	tokens.Delete("/:id", tokenHandler.Revoke)
+
 	// User routes
 	userHandler := user.NewHandler(s.db)
-	protected.Get("/auth/me", authHandler.Me)
-	protected.Put("/auth/me", authHandler.UpdateProfile)
-	protected.Get("/users/:id", userHandler.GetByID)
-	protected.Put("/users/:id", userHandler.Update)
-	protected.Delete("/users/:id", userHandler.Delete)
+	accountScope := middleware.ScopeByMethod(middleware.ScopeAccountRead, middleware.ScopeAccountWrite)
+	protected.Get("/auth/me", accountScope, authHandler.Me)
+	protected.Put("/auth/me", accountScope, authHandler.UpdateProfile)
+	protected.Get("/auth/me/ai-privacy", accountScope, authHandler.GetAIPrivacy)
+	protected.Put("/auth/me/ai-privacy", accountScope, authHandler.UpdateAIPrivacy)
+	protected.Get("/users/:id", accountScope, userHandler.GetByID)
+	protected.Put("/users/:id", accountScope, userHandler.Update)
+	protected.Delete("/users/:id", accountScope, userHandler.Delete)
 
 	// Subscription routes (protected)
-	protected.Get("/subscriptions/:user_id", subHandler.GetUserSubscription)
-	protected.Get("/plans/:plan_id", subHandler.GetPlan)
+	protected.Get("/subscriptions/:user_id", accountScope, subHandler.GetUserSubscription)
+	protected.Get("/plans/:plan_id", accountScope, subHandler.GetPlan)
 
 	// AI routes (protected)
-	aiHandler := ai.NewHandler(s.llm)
+	aiHandler := ai.NewHandler(s.llm, draftSender)
+	aiScope := middleware.RequireScope(middleware.ScopeAI)
 
 	// Task AI features
-	tasks := protected.Group("/tasks")
-	tasks.Post("/:id/ai/decompose", aiHandler.AIDecompose)
-	tasks.Post("/:id/ai/clean", aiHandler.AIClean)
-	tasks.Post("/:id/ai/revert", aiHandler.AIRevert)
-	tasks.Post("/:id/ai/rate", aiHandler.AIRate)
-	tasks.Post("/:id/ai/extract", aiHandler.AIExtract)
-	tasks.Post("/:id/ai/remind", aiHandler.AIRemind)
-	tasks.Post("/:id/ai/email", aiHandler.AIEmail)
-	tasks.Post("/:id/ai/invite", aiHandler.AIInvite)
-	tasks.Post("/:id/ai/check-duplicates", aiHandler.AICheckDuplicates)
-	tasks.Post("/:id/ai/resolve-duplicate", aiHandler.AIResolveDuplicate)
+	tasks := protected.Group("/tasks", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
+	tasks.Post("/:id/ai/decompose", aiScope, aiHandler.AIDecompose)
+	tasks.Post("/:id/ai/clean", aiScope, aiHandler.AIClean)
+	tasks.Post("/:id/ai/revert", aiScope, aiHandler.AIRevert)
+	tasks.Post("/:id/ai/rate", aiScope, aiHandler.AIRate)
+	tasks.Post("/:id/ai/extract", aiScope, aiHandler.AIExtract)
+	tasks.Post("/:id/ai/remind", aiScope, aiHandler.AIRemind)
+	tasks.Post("/:id/ai/email", aiScope, aiHandler.AIEmail)
+	tasks.Post("/:id/ai/invite", aiScope, aiHandler.AIInvite)
+	// Server-sent events variants: tokens, then parsed items, then the result
+	tasks.Post("/:id/ai/decompose/stream", aiScope, aiHandler.AIDecomposeStream)
+	tasks.Post("/:id/ai/clean/stream", aiScope, aiHandler.AICleanStream)
+	tasks.Post("/:id/ai/rate/stream", aiScope, aiHandler.AIRateStream)
+	tasks.Post("/:id/ai/extract/stream", aiScope, aiHandler.AIExtractStream)
+	tasks.Post("/:id/ai/remind/stream", aiScope, aiHandler.AIRemindStream)
+	tasks.Post("/:id/ai/email/stream", aiScope, aiHandler.AIEmailStream)
+	tasks.Post("/:id/ai/invite/stream", aiScope, aiHandler.AIInviteStream)
+	tasks.Post("/:id/ai/check-duplicates", aiScope, aiHandler.AICheckDuplicates)
+	tasks.Post("/:id/ai/resolve-duplicate", aiScope, aiHandler.AIResolveDuplicate)
 	tasks.Get("/entities", aiHandler.GetAggregatedEntities)           // Smart Lists - aggregated entities
 	tasks.Delete("/:id/entities/:type/:value", aiHandler.RemoveEntityFromTask) // Remove entity from single task
 
 	// AI management routes
-	aiRoutes := protected.Group("/ai")
+	aiRoutes := protected.Group("/ai", aiScope)
 	aiRoutes.Get("/usage", aiHandler.GetAIUsage)
 	aiRoutes.Get("/tier", aiHandler.GetUserTier)
 	aiRoutes.Get("/drafts", aiHandler.GetAIDrafts)
+	aiRoutes.Get("/drafts/:id", aiHandler.GetDraft)
 	aiRoutes.Post("/drafts/:id/approve", aiHandler.ApproveDraft)
 	aiRoutes.Delete("/drafts/:id", aiHandler.DeleteDraft)
 
+	// Assistant: tool-calling chat over the user's tasks and projects
+	aiRoutes.Post("/assistant/messages", aiHandler.SendAssistantMessage)
+	aiRoutes.Get("/assistant/conversations", aiHandler.ListAssistantConversations)
+	aiRoutes.Get("/assistant/conversations/:id", aiHandler.GetAssistantConversation)
+	aiRoutes.Delete("/assistant/conversations/:id", aiHandler.DeleteAssistantConversation)
+	aiRoutes.Post("/assistant/conversations/:id/confirm", aiHandler.ConfirmAssistantAction)
+
+	// Outgoing webhook routes
+	webhookHandler := webhook.NewHandler(s.config.IsDevelopment())
+	webhooks := protected.Group("/webhooks", middleware.ScopeByMethod(middleware.ScopeWebhooksRead, middleware.ScopeWebhooksWrite))
+	webhooks.Get("/events", webhookHandler.ListEventTypes)
+	webhooks.Post("", webhookHandler.Create)
+	webhooks.Get("", webhookHandler.List)
+	webhooks.Get("/:id", webhookHandler.GetByID)
+	webhooks.Put("/:id", webhookHandler.Update)
+	webhooks.Delete("/:id", webhookHandler.Delete)
+	webhooks.Post("/:id/rotate-secret", webhookHandler.RotateSecret)
+	webhooks.Get("/:id/deliveries", webhookHandler.ListDeliveries)
+	webhooks.Post("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayDelivery)
+
 	// Admin content routes
-	admin := protected.Group("/admin")
+	admin := protected.Group("/admin", middleware.RequireSession())
 	admin.Use(s.adminOnly)
 	admin.Get("/pages", s.listPageContents)
 	admin.Put("/pages/:key", s.updatePageContent)
+	admin.Get("/ai-cache/stats", s.aiCacheStats)
+	admin.Get("/ai-redaction/stats", s.aiRedactionStats)
+	admin.Get("/ai-usage", s.aiUsageReport)
 
 	// Internal routes (for service-to-service calls)
 	// Note: For monorepo internal calls, use shared/repository directly instead of HTTP
@@ -282,6 +363,11 @@ func (s *Server) Listen(addr string) error {
 
 // ShutdownWithContext gracefully shuts down the server
 func (s *Server) ShutdownWithContext(ctx context.Context) error {
+	// Stop webhook delivery before closing the pools it uses
+	if s.dispatcher != nil {
+		s.dispatcher.Stop()
+	}
+
 	// Close database connection
 	if s.db != nil {
 		s.db.Close()
@@ -289,6 +375,7 @@ func (s *Server) ShutdownWithContext(ctx context.Context) error {
 
 	// Close tasks database connection
 	repository.CloseTasksDB()
+	repository.CloseProjectsDB()
 
 	// Close Redis connection
 	if s.redis != nil {
@@ -385,8 +472,7 @@ func errorCodeFromStatus(status int) string {
 
 // adminOnly middleware checks if user is admin
 func (s *Server) adminOnly(c *fiber.Ctx) error {
-	userIDStr := c.Locals("user_id").(string)
-	userID, err := uuid.Parse(userIDStr)
+	userID, err := middleware.GetUserID(c)
 	if err != nil {
 		return c.Status(fiber.StatusForbidden).JSON(dto.Error("FORBIDDEN", "invalid user id"))
 	}
@@ -444,6 +530,32 @@ func (s *Server) listPageContents(c *fiber.Ctx) error {
 	return c.JSON(dto.Success(result))
 }
 
+// aiCacheStats reports LLM response cache hits and misses for this process
+func (s *Server) aiCacheStats(c *fiber.Ctx) error {
+	return c.JSON(dto.Success(llmcache.Stats(s.llm)))
+}
+
+// aiRedactionStats reports what was redacted from AI calls and which calls
+// privacy mode kept local, for this process
+func (s *Server) aiRedactionStats(c *fiber.Ctx) error {
+	return c.JSON(dto.Success(privacy.Stats(s.llm)))
+}
+
+// aiUsageReport reports LLM calls, tokens and cost over the last ?days=
+// (default 30) by day, tier, feature and provider
+func (s *Server) aiUsageReport(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days < 1 || days > 366 {
+		return c.Status(fiber.StatusBadRequest).JSON(dto.Error("BAD_REQUEST", "days must be between 1 and 366"))
+	}
+
+	report, err := llmusage.BuildReport(c.Context(), days, s.config.LLM)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(dto.Error("INTERNAL_ERROR", "failed to build usage report"))
+	}
+	return c.JSON(dto.Success(report))
+}
+
 // updatePageContent updates page content (admin only)
 func (s *Server) updatePageContent(c *fiber.Ctx) error {
 	key := c.Params("key")
@@ -458,8 +570,7 @@ func (s *Server) updatePageContent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(dto.Error("BAD_REQUEST", "invalid request body"))
 	}
 
-	userIDStr := c.Locals("user_id").(string)
-	userID, _ := uuid.Parse(userIDStr)
+	userID, _ := middleware.GetUserID(c)
 	user, _ := repository.GetUserByID(c.Context(), userID)
 	updatedBy := "admin"
 	if user != nil {
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Retry and auto-disable policy
+const (
+	MaxAttempts      = 10               // ~4h of retries with the backoff below
+	BaseBackoff      = 30 * time.Second // delay after the first failure, doubled per attempt
+	MaxBackoff       = 2 * time.Hour
+	DisableAfter     = 72 * time.Hour // endpoints failing continuously this long are disabled
+	deliveryTimeout  = 10 * time.Second
+	claimLease       = time.Minute
+	claimBatchSize   = 20
+	maxResponseBytes = 1024
+)
+
+// Dispatcher polls the delivery queue and sends due deliveries.
+// Claims use SKIP LOCKED, so several instances can run side by side.
+type Dispatcher struct {
+	client   *http.Client
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher that polls at the given interval
+func NewDispatcher(interval time.Duration) *Dispatcher {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	// Every connection is checked at dial time, which also covers redirects
+	// and DNS answers that changed since the endpoint was validated.
+	transport := &http.Transport{
+		DialContext:         safeDialer(deliveryTimeout).DialContext,
+		TLSHandshakeTimeout: deliveryTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &Dispatcher{
+		client:   &http.Client{Timeout: deliveryTimeout, Transport: transport},
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the dispatch loop in the background until Stop is called
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.runOnce(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops the dispatch loop and waits for in-flight deliveries
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// runOnce delivers one batch of due deliveries and disables endpoints that
+// have been failing for too long.
+func (d *Dispatcher) runOnce(ctx context.Context) {
+	if n, err := repository.DisableFailingWebhookEndpoints(ctx, DisableAfter, "failing for more than 72 hours"); err != nil {
+		fmt.Printf("[Webhook] Failed to disable failing endpoints: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("[Webhook] Disabled %d failing endpoint(s)\n", n)
+	}
+
+	deliveries, err := repository.ClaimDueWebhookDeliveries(ctx, claimBatchSize, claimLease)
+	if err != nil {
+		fmt.Printf("[Webhook] Failed to claim deliveries: %v\n", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(del *repository.ClaimedWebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, del)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// deliver sends a single delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, del *repository.ClaimedWebhookDelivery) {
+	statusCode, response, err := d.send(ctx, del)
+	if err == nil && statusCode >= 200 && statusCode < 300 {
+		if err := repository.MarkWebhookDeliverySucceeded(ctx, del.ID, del.EndpointID, statusCode, response); err != nil {
+			fmt.Printf("[Webhook] Failed to record delivery %s: %v\n", del.ID, err)
+		}
+		return
+	}
+
+	errMsg := ""
+	var code *int
+	if err != nil {
+		errMsg = err.Error()
+	} else {
+		code = &statusCode
+		errMsg = fmt.Sprintf("endpoint returned HTTP %d", statusCode)
+	}
+
+	var nextAttempt *time.Time
+	if attempt := del.Attempts + 1; attempt < MaxAttempts {
+		next := time.Now().Add(backoff(attempt))
+		nextAttempt = &next
+	}
+
+	if err := repository.MarkWebhookDeliveryFailed(ctx, del.ID, del.EndpointID, code, errMsg, response, nextAttempt); err != nil {
+		fmt.Printf("[Webhook] Failed to record delivery %s: %v\n", del.ID, err)
+	}
+}
+
+// send posts the signed payload and returns the status code and a truncated body
+func (d *Dispatcher) send(ctx context.Context, del *repository.ClaimedWebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Flow-Webhooks/1.0")
+	req.Header.Set(HeaderSignature, Sign(del.Payload, del.Secret))
+	req.Header.Set(HeaderEvent, del.EventType)
+	req.Header.Set(HeaderEventID, del.EventID.String())
+	req.Header.Set(HeaderDelivery, del.ID.String())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	return resp.StatusCode, strings.ToValidUTF8(string(body), ""), nil
+}
+
+// backoff returns the delay before the given retry attempt (1-based)
+func backoff(attempt int) time.Duration {
+	delay := BaseBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,387 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Handler handles webhook endpoint management
+type Handler struct {
+	allowHTTP bool
+}
+
+// NewHandler creates a new webhook handler. Plain http targets are only
+// accepted when allowHTTP is set (development).
+func NewHandler(allowHTTP bool) *Handler {
+	return &Handler{allowHTTP: allowHTTP}
+}
+
+// EndpointRequest is the body for creating or updating an endpoint
+type EndpointRequest struct {
+	URL         *string  `json:"url,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+// EndpointResponse represents an endpoint in API responses.
+// The secret is only included when it was just generated.
+type EndpointResponse struct {
+	ID             string   `json:"id"`
+	URL            string   `json:"url"`
+	Description    *string  `json:"description,omitempty"`
+	Events         []string `json:"events"`
+	Active         bool     `json:"active"`
+	Secret         string   `json:"secret,omitempty"`
+	FailingSince   *string  `json:"failing_since,omitempty"`
+	DisabledAt     *string  `json:"disabled_at,omitempty"`
+	DisabledReason *string  `json:"disabled_reason,omitempty"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+}
+
+// DeliveryResponse represents a delivery log entry in API responses
+type DeliveryResponse struct {
+	ID             string          `json:"id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *string         `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	LastResponse   *string         `json:"last_response,omitempty"`
+	ReplayOf       *string         `json:"replay_of,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at,omitempty"`
+}
+
+// ListEventTypes returns the event types endpoints can subscribe to
+// GET /webhooks/events
+func (h *Handler) ListEventTypes(c *fiber.Ctx) error {
+	return httputil.Success(c, EventTypes)
+}
+
+// Create registers a new webhook endpoint
+// POST /webhooks
+func (h *Handler) Create(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req EndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	if req.URL == nil {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"url": "required",
+		})
+	}
+	if errs := h.validateEndpoint(c.Context(), *req.URL, req.Events); len(errs) > 0 {
+		return httputil.ValidationError(c, "validation failed", errs)
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return httputil.InternalError(c, "failed to generate secret")
+	}
+
+	endpoint := &repository.WebhookEndpoint{
+		UserID:      userID,
+		URL:         *req.URL,
+		Description: req.Description,
+		Secret:      secret,
+		Events:      req.Events,
+	}
+	if err := repository.CreateWebhookEndpoint(c.Context(), endpoint); err != nil {
+		return httputil.InternalError(c, "failed to create webhook")
+	}
+
+	return httputil.Created(c, toEndpointResponse(endpoint, true))
+}
+
+// List lists the user's webhook endpoints
+// GET /webhooks
+func (h *Handler) List(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	endpoints, err := repository.ListWebhookEndpoints(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list webhooks")
+	}
+
+	items := make([]EndpointResponse, 0, len(endpoints))
+	for _, e := range endpoints {
+		items = append(items, toEndpointResponse(e, false))
+	}
+
+	return httputil.Success(c, items)
+}
+
+// GetByID returns a single webhook endpoint
+// GET /webhooks/:id
+func (h *Handler) GetByID(c *fiber.Ctx) error {
+	endpoint, err := h.loadEndpoint(c)
+	if err != nil || endpoint == nil {
+		return err
+	}
+
+	return httputil.Success(c, toEndpointResponse(endpoint, false))
+}
+
+// Update updates an endpoint's URL, description, events or active flag.
+// Setting active=true re-enables an automatically disabled endpoint.
+// PUT /webhooks/:id
+func (h *Handler) Update(c *fiber.Ctx) error {
+	endpoint, err := h.loadEndpoint(c)
+	if err != nil || endpoint == nil {
+		return err
+	}
+
+	var req EndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	if req.URL != nil {
+		endpoint.URL = *req.URL
+	}
+	if req.Description != nil {
+		endpoint.Description = req.Description
+	}
+	if req.Events != nil {
+		endpoint.Events = req.Events
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+
+	if errs := h.validateEndpoint(c.Context(), endpoint.URL, endpoint.Events); len(errs) > 0 {
+		return httputil.ValidationError(c, "validation failed", errs)
+	}
+
+	if err := repository.UpdateWebhookEndpoint(c.Context(), endpoint); err != nil {
+		return httputil.InternalError(c, "failed to update webhook")
+	}
+
+	updated, err := repository.GetWebhookEndpoint(c.Context(), endpoint.ID, endpoint.UserID)
+	if err != nil || updated == nil {
+		return httputil.InternalError(c, "failed to load webhook")
+	}
+
+	return httputil.Success(c, toEndpointResponse(updated, false))
+}
+
+// Delete removes an endpoint and its delivery log
+// DELETE /webhooks/:id
+func (h *Handler) Delete(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	endpointID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid webhook ID")
+	}
+
+	affected, err := repository.DeleteWebhookEndpoint(c.Context(), endpointID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to delete webhook")
+	}
+	if affected == 0 {
+		return httputil.NotFound(c, "webhook")
+	}
+
+	return httputil.NoContent(c)
+}
+
+// RotateSecret generates a new signing secret and returns it once
+// POST /webhooks/:id/rotate-secret
+func (h *Handler) RotateSecret(c *fiber.Ctx) error {
+	endpoint, err := h.loadEndpoint(c)
+	if err != nil || endpoint == nil {
+		return err
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return httputil.InternalError(c, "failed to generate secret")
+	}
+
+	if _, err := repository.RotateWebhookSecret(c.Context(), endpoint.ID, endpoint.UserID, secret); err != nil {
+		return httputil.InternalError(c, "failed to rotate secret")
+	}
+
+	endpoint.Secret = secret
+	return httputil.Success(c, toEndpointResponse(endpoint, true))
+}
+
+// ListDeliveries returns the delivery log of an endpoint
+// GET /webhooks/:id/deliveries
+func (h *Handler) ListDeliveries(c *fiber.Ctx) error {
+	endpoint, err := h.loadEndpoint(c)
+	if err != nil || endpoint == nil {
+		return err
+	}
+
+	params := httputil.ParsePagination(c)
+	deliveries, total, err := repository.ListWebhookDeliveries(c.Context(), endpoint.ID, params.PageSize, (params.Page-1)*params.PageSize)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list deliveries")
+	}
+
+	items := make([]DeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		items = append(items, toDeliveryResponse(d))
+	}
+
+	return httputil.SuccessWithMeta(c, items, httputil.BuildMeta(params.Page, params.PageSize, int64(total)))
+}
+
+// ReplayDelivery queues a new delivery of a logged event
+// POST /webhooks/:id/deliveries/:delivery_id/replay
+func (h *Handler) ReplayDelivery(c *fiber.Ctx) error {
+	endpoint, err := h.loadEndpoint(c)
+	if err != nil || endpoint == nil {
+		return err
+	}
+
+	if !endpoint.Active {
+		return httputil.Conflict(c, "webhook is disabled; re-enable it before replaying")
+	}
+
+	deliveryID, err := uuid.Parse(c.Params("delivery_id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid delivery ID")
+	}
+
+	original, err := repository.GetWebhookDelivery(c.Context(), deliveryID, endpoint.ID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	if original == nil {
+		return httputil.NotFound(c, "delivery")
+	}
+
+	replay, err := repository.ReplayWebhookDelivery(c.Context(), original)
+	if err != nil {
+		return httputil.InternalError(c, "failed to replay delivery")
+	}
+
+	return httputil.Created(c, toDeliveryResponse(replay))
+}
+
+// loadEndpoint resolves :id to an endpoint owned by the current user.
+// On failure it writes the error response and returns a nil endpoint.
+func (h *Handler) loadEndpoint(c *fiber.Ctx) (*repository.WebhookEndpoint, error) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return nil, httputil.Unauthorized(c, "")
+	}
+
+	endpointID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, httputil.BadRequest(c, "invalid webhook ID")
+	}
+
+	endpoint, err := repository.GetWebhookEndpoint(c.Context(), endpointID, userID)
+	if err != nil {
+		return nil, httputil.InternalError(c, "database error")
+	}
+	if endpoint == nil {
+		return nil, httputil.NotFound(c, "webhook")
+	}
+
+	return endpoint, nil
+}
+
+// validateEndpoint checks the target URL and subscribed event types.
+// The host is resolved so endpoints cannot point at internal addresses.
+func (h *Handler) validateEndpoint(ctx context.Context, rawURL string, events []string) map[string]string {
+	errs := make(map[string]string)
+
+	if err := checkTarget(ctx, rawURL, h.allowHTTP); err != nil {
+		errs["url"] = err.Error()
+	}
+
+	if len(events) == 0 {
+		errs["events"] = "at least one event type is required"
+	}
+	for _, e := range events {
+		if !IsValidEvent(e) {
+			errs["events"] = "unknown event type: " + e
+			break
+		}
+	}
+
+	return errs
+}
+
+func toEndpointResponse(e *repository.WebhookEndpoint, includeSecret bool) EndpointResponse {
+	resp := EndpointResponse{
+		ID:             e.ID.String(),
+		URL:            e.URL,
+		Description:    e.Description,
+		Events:         e.Events,
+		Active:         e.Active,
+		FailingSince:   formatTime(e.FailingSince),
+		DisabledAt:     formatTime(e.DisabledAt),
+		DisabledReason: e.DisabledReason,
+		CreatedAt:      e.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      e.UpdatedAt.Format(time.RFC3339),
+	}
+	if resp.Events == nil {
+		resp.Events = []string{}
+	}
+	if includeSecret {
+		resp.Secret = e.Secret
+	}
+	return resp
+}
+
+func toDeliveryResponse(d *repository.WebhookDelivery) DeliveryResponse {
+	resp := DeliveryResponse{
+		ID:             d.ID.String(),
+		EventID:        d.EventID.String(),
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		LastResponse:   d.LastResponse,
+		Payload:        d.Payload,
+		CreatedAt:      d.CreatedAt.Format(time.RFC3339),
+		DeliveredAt:    formatTime(d.DeliveredAt),
+	}
+	if d.Status == "pending" {
+		resp.NextAttemptAt = formatTime(&d.NextAttemptAt)
+	}
+	if d.ReplayOf != nil {
+		s := d.ReplayOf.String()
+		resp.ReplayOf = &s
+	}
+	return resp
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
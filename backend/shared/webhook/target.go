@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a webhook target resolves to an address
+// that must not be reached from the server (loopback, private networks,
+// link-local metadata services and the like).
+var ErrBlockedAddress = errors.New("webhook target resolves to a non-public address")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which some
+// cloud providers use for their metadata services.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isBlockedIP reports whether ip must not be used as a webhook target
+func isBlockedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// checkTarget parses the URL and resolves its host, rejecting non-http(s)
+// schemes (plain http unless allowHTTP) and hosts with any blocked address.
+func checkTarget(ctx context.Context, rawURL string, allowHTTP bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Hostname() == "" {
+		return errors.New("must be an absolute https URL")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !allowHTTP {
+			return errors.New("must use https")
+		}
+	default:
+		return errors.New("must be an absolute https URL")
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("host %q could not be resolved", u.Hostname())
+	}
+	for _, ip := range ips {
+		if isBlockedIP(ip) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// safeDialer returns a dialer that re-checks the connected address, so a
+// host that passed validation cannot later be rebound to an internal address.
+func safeDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,116 @@
+// Package webhook delivers task and project events to user-registered HTTP endpoints.
+// Services publish events with Publish; the shared service runs the Dispatcher
+// that signs, sends and retries the queued deliveries.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/google/uuid"
+)
+
+// Event types that endpoints can subscribe to
+const (
+	EventTaskCreated        = "task.created"
+	EventTaskUpdated        = "task.updated"
+	EventTaskCompleted      = "task.completed"
+	EventTaskDeleted        = "task.deleted"
+	EventWBSNodeUpdated     = "wbs.node.updated"
+	EventProjectMemberAdded = "project.member.added"
+)
+
+// EventTypes lists every event type in a stable order
+var EventTypes = []string{
+	EventTaskCreated,
+	EventTaskUpdated,
+	EventTaskCompleted,
+	EventTaskDeleted,
+	EventWBSNodeUpdated,
+	EventProjectMemberAdded,
+}
+
+// IsValidEvent reports whether the event type can be subscribed to
+func IsValidEvent(eventType string) bool {
+	for _, e := range EventTypes {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers sent with every delivery
+const (
+	HeaderSignature = "X-Flow-Signature"
+	HeaderEvent     = "X-Flow-Event"
+	HeaderEventID   = "X-Flow-Event-Id"
+	HeaderDelivery  = "X-Flow-Delivery"
+)
+
+// Envelope is the JSON body posted to endpoints
+type Envelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt string      `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Publish queues an event for every endpoint of the user subscribed to it.
+// Failures are logged and never surface to the caller - webhooks must not
+// break the request that triggered them.
+func Publish(ctx context.Context, userID uuid.UUID, eventType string, data interface{}) {
+	eventID := uuid.New()
+	payload, err := json.Marshal(Envelope{
+		ID:        eventID.String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		fmt.Printf("[Webhook] Failed to marshal %s event: %v\n", eventType, err)
+		return
+	}
+
+	if _, err := repository.EnqueueWebhookEvent(ctx, userID, eventID, eventType, payload); err != nil {
+		fmt.Printf("[Webhook] Failed to enqueue %s event for user %s: %v\n", eventType, userID, err)
+	}
+}
+
+// PublishAll queues the same event for several users (e.g. all project members).
+func PublishAll(ctx context.Context, userIDs []uuid.UUID, eventType string, data interface{}) {
+	for _, userID := range userIDs {
+		Publish(ctx, userID, eventType, data)
+	}
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the payload. Receivers verify a
+// delivery by computing the same value over the raw request body and comparing
+// it to the X-Flow-Signature header in constant time.
+func Sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign
+func Verify(payload []byte, signature, secret string) bool {
+	expected := Sign(payload, secret)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// GenerateSecret creates a new random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
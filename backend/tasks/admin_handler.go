@@ -1,24 +1,33 @@
 package tasks
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"github.com/csaptu/flow/pkg/httputil"
 	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/prompts"
 	"github.com/csaptu/flow/shared/repository"
 )
 
 // AdminHandler handles admin endpoints
 type AdminHandler struct {
-	db *pgxpool.Pool
+	db    *pgxpool.Pool
+	redis *redis.Client // Announces prompt changes to other replicas
+	ai    *AIService    // Runs prompt test-runs
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(db *pgxpool.Pool) *AdminHandler {
-	return &AdminHandler{db: db}
+func NewAdminHandler(db *pgxpool.Pool, redisClient *redis.Client, aiService *AIService) *AdminHandler {
+	return &AdminHandler{db: db, redis: redisClient, ai: aiService}
 }
 
 // AdminOnly middleware checks if user is an admin using the shared repository
@@ -466,7 +475,9 @@ func (h *AdminHandler) ListAIConfigs(c *fiber.Ctx) error {
 	return httputil.Success(c, result)
 }
 
-// UpdateAIConfig updates a single AI prompt configuration
+// UpdateAIConfig changes a single AI prompt configuration. The change is
+// made as a new version of the key's feature and published right away, so
+// it keeps the history and can be rolled back.
 func (h *AdminHandler) UpdateAIConfig(c *fiber.Ctx) error {
 	key := c.Params("key")
 	if key == "" {
@@ -484,14 +495,225 @@ func (h *AdminHandler) UpdateAIConfig(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "value cannot be empty")
 	}
 
+	current, err := repository.GetAIPromptConfig(c.Context(), key)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update AI config")
+	}
+	if current == "" {
+		return httputil.NotFound(c, "AI config")
+	}
+
 	// Get admin email for audit trail
 	email := middleware.GetEmail(c)
 
-	err := repository.UpdateAIPromptConfig(c.Context(), key, req.Value, email)
+	notes := "Updated " + key
+	v, err := h.createPromptVersion(c.Context(), prompts.FeatureOf(key), map[string]string{key: req.Value}, &notes, email)
 	if err != nil {
+		return httputil.Error(c, err)
+	}
+	if _, err := repository.PublishAIPromptVersion(c.Context(), v.ID, email); err != nil {
 		return httputil.InternalError(c, "failed to update AI config")
 	}
+	prompts.Notify(c.Context(), h.redis)
+
+	return httputil.Success(c, map[string]string{"message": "config updated", "version_id": v.ID.String()})
+}
+
+// =====================================================
+// AI Job Queue
+// =====================================================
+
+// aiJobStatuses are the statuses accepted by the job list filter
+var aiJobStatuses = map[string]bool{
+	AIJobPending:    true,
+	AIJobProcessing: true,
+	AIJobCompleted:  true,
+	AIJobDead:       true,
+}
+
+// AIJobStatsResponse summarizes the AI job queue
+type AIJobStatsResponse struct {
+	Counts        map[string]int `json:"counts"`
+	Due           int            `json:"due"` // Pending jobs whose run_after has passed
+	OldestDueSecs *int           `json:"oldest_due_seconds,omitempty"`
+}
+
+// ListAIJobs returns AI jobs, newest first, filtered by status, user or task
+func (h *AdminHandler) ListAIJobs(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("page_size", 50)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+	if status := c.Query("status"); status != "" {
+		if !aiJobStatuses[status] {
+			return httputil.BadRequest(c, "invalid status")
+		}
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	for _, param := range []string{"user_id", "task_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return httputil.BadRequest(c, "invalid "+param)
+			}
+			args = append(args, id)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", param, len(args)))
+		}
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int64
+	if err := h.db.QueryRow(c.Context(), "SELECT COUNT(*) FROM ai_processing_queue WHERE "+where, args...).Scan(&total); err != nil {
+		return httputil.InternalError(c, "failed to list AI jobs")
+	}
+
+	args = append(args, pageSize, (page-1)*pageSize)
+	rows, err := h.db.Query(c.Context(),
+		fmt.Sprintf("SELECT %s FROM ai_processing_queue WHERE %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d",
+			aiJobColumns, where, len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list AI jobs")
+	}
+	defer rows.Close()
+
+	jobs := make([]*AIJob, 0)
+	for rows.Next() {
+		job, err := scanAIJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	return httputil.SuccessWithMeta(c, jobs, httputil.BuildMeta(page, pageSize, total))
+}
+
+// AIJobStats returns job counts by status and how far behind the queue is
+func (h *AdminHandler) AIJobStats(c *fiber.Ctx) error {
+	stats := AIJobStatsResponse{Counts: make(map[string]int)}
+	for status := range aiJobStatuses {
+		stats.Counts[status] = 0
+	}
 
-	return httputil.Success(c, map[string]string{"message": "config updated"})
+	rows, err := h.db.Query(c.Context(), "SELECT status, COUNT(*) FROM ai_processing_queue GROUP BY status")
+	if err != nil {
+		return httputil.InternalError(c, "failed to load AI job stats")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err == nil {
+			stats.Counts[status] = count
+		}
+	}
+
+	err = h.db.QueryRow(c.Context(),
+		`SELECT COUNT(*), EXTRACT(EPOCH FROM NOW() - MIN(run_after))::int
+		 FROM ai_processing_queue WHERE status = 'pending' AND run_after <= NOW()`,
+	).Scan(&stats.Due, &stats.OldestDueSecs)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load AI job stats")
+	}
+
+	return httputil.Success(c, stats)
 }
 
+// GetAIJob returns a single AI job
+func (h *AdminHandler) GetAIJob(c *fiber.Ctx) error {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid job ID")
+	}
+
+	job, err := scanAIJob(h.db.QueryRow(c.Context(),
+		"SELECT "+aiJobColumns+" FROM ai_processing_queue WHERE id = $1", jobID))
+	if err == pgx.ErrNoRows {
+		return httputil.NotFound(c, "AI job")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "failed to get AI job")
+	}
+
+	return httputil.Success(c, job)
+}
+
+// ReplayAIJob puts a dead or completed job back in the queue with a fresh
+// set of attempts
+func (h *AdminHandler) ReplayAIJob(c *fiber.Ctx) error {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid job ID")
+	}
+
+	job, err := scanAIJob(h.db.QueryRow(c.Context(),
+		"SELECT "+aiJobColumns+" FROM ai_processing_queue WHERE id = $1", jobID))
+	if err == pgx.ErrNoRows {
+		return httputil.NotFound(c, "AI job")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "failed to get AI job")
+	}
+	if job.Status != AIJobDead && job.Status != AIJobCompleted {
+		return httputil.Conflict(c, "job is already "+job.Status)
+	}
+
+	job, err = scanAIJob(h.db.QueryRow(c.Context(),
+		`UPDATE ai_processing_queue q
+		 SET status = 'pending', attempts = 0, run_after = NOW(), error = NULL, result = NULL,
+		     processed_at = NULL, updated_at = NOW()
+		 WHERE id = $1 AND status IN ('dead', 'completed')
+		   AND NOT EXISTS (SELECT 1 FROM ai_processing_queue w WHERE w.task_id = q.task_id AND w.status = 'pending')
+		 RETURNING `+aiJobColumns,
+		jobID,
+	))
+	// A job enqueued after the NOT EXISTS check trips the unique index instead
+	if err == pgx.ErrNoRows || pendingJobConflict(err) {
+		return httputil.Conflict(c, "another job for this task is already pending")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "failed to replay AI job")
+	}
+
+	return httputil.Success(c, job)
+}
+
+// ReplayDeadAIJobs requeues the latest dead job of every task that has no
+// pending job, e.g. after a provider outage
+func (h *AdminHandler) ReplayDeadAIJobs(c *fiber.Ctx) error {
+	tag, err := h.db.Exec(c.Context(), `
+		UPDATE ai_processing_queue
+		SET status = 'pending', attempts = 0, run_after = NOW(), error = NULL, updated_at = NOW()
+		WHERE id IN (
+			SELECT DISTINCT ON (d.task_id) d.id FROM ai_processing_queue d
+			WHERE d.status = 'dead'
+			  AND NOT EXISTS (SELECT 1 FROM ai_processing_queue w WHERE w.task_id = d.task_id AND w.status = 'pending')
+			ORDER BY d.task_id, d.created_at DESC
+		)
+	`)
+	if pendingJobConflict(err) {
+		return httputil.Conflict(c, "a job was queued while replaying; try again")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "failed to replay AI jobs")
+	}
+
+	return httputil.Success(c, map[string]int64{"replayed": tag.RowsAffected()})
+}
+
+// pendingJobConflict reports whether err is a second pending job for a task
+// (idx_ai_queue_task_pending)
+func pendingJobConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_ai_queue_task_pending"
+}
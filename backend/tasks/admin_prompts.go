@@ -0,0 +1,489 @@
+package tasks
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/common/errors"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/prompts"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// =====================================================
+// AI Prompt Versions and Experiments
+// =====================================================
+
+// maxPromptTestSamples caps the sample tasks of one test-run
+const maxPromptTestSamples = 10
+
+// PromptVersionResponse is a prompt version in admin responses
+type PromptVersionResponse struct {
+	ID          string            `json:"id"`
+	Feature     string            `json:"feature"`
+	Version     int               `json:"version"`
+	Configs     map[string]string `json:"configs"`
+	Status      string            `json:"status"`
+	Notes       *string           `json:"notes,omitempty"`
+	CreatedBy   *string           `json:"created_by,omitempty"`
+	CreatedAt   string            `json:"created_at"`
+	PublishedBy *string           `json:"published_by,omitempty"`
+	PublishedAt *string           `json:"published_at,omitempty"`
+}
+
+// PromptExperimentResponse is a prompt experiment in admin responses
+type PromptExperimentResponse struct {
+	ID             string  `json:"id"`
+	Feature        string  `json:"feature"`
+	ControlID      string  `json:"control_id"`
+	VariantID      string  `json:"variant_id"`
+	VariantPercent int     `json:"variant_percent"`
+	Status         string  `json:"status"`
+	CreatedBy      *string `json:"created_by,omitempty"`
+	StartedAt      string  `json:"started_at"`
+	StoppedAt      *string `json:"stopped_at,omitempty"`
+}
+
+// PromptFeatureResponse is a feature with its published version and running experiment
+type PromptFeatureResponse struct {
+	Feature    string                    `json:"feature"`
+	Keys       []string                  `json:"keys"`
+	Published  *PromptVersionResponse    `json:"published,omitempty"`
+	Experiment *PromptExperimentResponse `json:"experiment,omitempty"`
+}
+
+// CreatePromptVersionRequest creates a draft. Configs are merged over the
+// published version's, so a draft only needs the keys it changes.
+type CreatePromptVersionRequest struct {
+	Configs map[string]string `json:"configs"`
+	Notes   *string           `json:"notes,omitempty"`
+}
+
+// PromptTestSample is a task a test-run is tried on. For email_cleanup the
+// title is the email subject and the description its body.
+type PromptTestSample struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// PromptTestRequest test-runs a version against sample tasks
+type PromptTestRequest struct {
+	Samples []PromptTestSample `json:"samples"`
+	Compare bool               `json:"compare"` // Also run the published version
+}
+
+// PromptTestResult is the output of one sample
+type PromptTestResult struct {
+	Sample    PromptTestSample `json:"sample"`
+	Output    interface{}      `json:"output,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Published interface{}      `json:"published,omitempty"` // With compare
+}
+
+// CreatePromptExperimentRequest starts an experiment against the published version
+type CreatePromptExperimentRequest struct {
+	VariantID      string `json:"variant_id"`
+	VariantPercent int    `json:"variant_percent"` // 1-99
+}
+
+func toPromptVersionResponse(v *repository.AIPromptVersion) PromptVersionResponse {
+	resp := PromptVersionResponse{
+		ID:          v.ID.String(),
+		Feature:     v.Feature,
+		Version:     v.Version,
+		Configs:     v.Configs,
+		Status:      v.Status,
+		Notes:       v.Notes,
+		CreatedBy:   v.CreatedBy,
+		CreatedAt:   v.CreatedAt.Format(time.RFC3339),
+		PublishedBy: v.PublishedBy,
+	}
+	if v.PublishedAt != nil {
+		s := v.PublishedAt.Format(time.RFC3339)
+		resp.PublishedAt = &s
+	}
+	return resp
+}
+
+func toPromptExperimentResponse(e *repository.AIPromptExperiment) PromptExperimentResponse {
+	resp := PromptExperimentResponse{
+		ID:             e.ID.String(),
+		Feature:        e.Feature,
+		ControlID:      e.ControlID.String(),
+		VariantID:      e.VariantID.String(),
+		VariantPercent: e.VariantPercent,
+		Status:         e.Status,
+		CreatedBy:      e.CreatedBy,
+		StartedAt:      e.StartedAt.Format(time.RFC3339),
+	}
+	if e.StoppedAt != nil {
+		s := e.StoppedAt.Format(time.RFC3339)
+		resp.StoppedAt = &s
+	}
+	return resp
+}
+
+// promptFeature returns the :feature param if it names a versioned feature
+func promptFeature(c *fiber.Ctx) (string, bool) {
+	feature := c.Params("feature")
+	_, ok := prompts.Features[feature]
+	return feature, ok
+}
+
+// promptVersionParam loads the version named by the :id param
+func promptVersionParam(c *fiber.Ctx) (*repository.AIPromptVersion, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, httputil.BadRequest(c, "invalid version ID")
+	}
+	v, err := repository.GetAIPromptVersion(c.Context(), id)
+	if err != nil {
+		return nil, httputil.InternalError(c, "failed to get prompt version")
+	}
+	if v == nil {
+		return nil, httputil.NotFound(c, "prompt version")
+	}
+	return v, nil
+}
+
+// ListPromptFeatures returns the versioned features with their published
+// version and running experiment
+func (h *AdminHandler) ListPromptFeatures(c *fiber.Ctx) error {
+	published, err := repository.GetPublishedAIPromptVersions(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "failed to list prompt versions")
+	}
+	running, err := repository.GetRunningAIPromptExperiments(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "failed to list prompt experiments")
+	}
+
+	result := make([]PromptFeatureResponse, 0, len(prompts.Features))
+	for _, feature := range []string{prompts.AutoProcess, prompts.Decompose, prompts.EmailCleanup, prompts.FirstContext} {
+		resp := PromptFeatureResponse{Feature: feature, Keys: prompts.Features[feature]}
+		for i := range published {
+			if published[i].Feature == feature {
+				v := toPromptVersionResponse(&published[i])
+				resp.Published = &v
+			}
+		}
+		for i := range running {
+			if running[i].Feature == feature {
+				e := toPromptExperimentResponse(&running[i])
+				resp.Experiment = &e
+			}
+		}
+		result = append(result, resp)
+	}
+
+	return httputil.Success(c, result)
+}
+
+// ListPromptVersions returns a feature's versions, newest first
+func (h *AdminHandler) ListPromptVersions(c *fiber.Ctx) error {
+	feature, ok := promptFeature(c)
+	if !ok {
+		return httputil.NotFound(c, "prompt feature")
+	}
+
+	versions, err := repository.ListAIPromptVersions(c.Context(), feature)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list prompt versions")
+	}
+
+	result := make([]PromptVersionResponse, 0, len(versions))
+	for i := range versions {
+		result = append(result, toPromptVersionResponse(&versions[i]))
+	}
+	return httputil.Success(c, result)
+}
+
+// CreatePromptVersion stores a draft of a feature's prompt
+func (h *AdminHandler) CreatePromptVersion(c *fiber.Ctx) error {
+	feature, ok := promptFeature(c)
+	if !ok {
+		return httputil.NotFound(c, "prompt feature")
+	}
+
+	var req CreatePromptVersionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if len(req.Configs) == 0 {
+		return httputil.BadRequest(c, "configs are required")
+	}
+
+	v, err := h.createPromptVersion(c.Context(), feature, req.Configs, req.Notes, middleware.GetEmail(c))
+	if err != nil {
+		return httputil.Error(c, err)
+	}
+	return httputil.Created(c, toPromptVersionResponse(v))
+}
+
+// createPromptVersion merges configs over the published version's and stores
+// the result as a draft
+func (h *AdminHandler) createPromptVersion(ctx context.Context, feature string, changes map[string]string, notes *string, createdBy string) (*repository.AIPromptVersion, error) {
+	published, err := repository.GetPublishedAIPromptVersion(ctx, feature)
+	if err != nil {
+		return nil, errors.Internal("failed to get published version")
+	}
+
+	configs := make(map[string]string)
+	if published != nil {
+		for key, value := range published.Configs {
+			configs[key] = value
+		}
+	}
+	for key, value := range changes {
+		if value == "" {
+			return nil, errors.BadRequest("config values cannot be empty")
+		}
+		if _, ok := configs[key]; !ok && prompts.FeatureOf(key) != feature {
+			return nil, errors.BadRequest("config " + key + " doesn't belong to " + feature)
+		}
+		configs[key] = value
+	}
+
+	v, err := repository.CreateAIPromptVersion(ctx, feature, configs, notes, createdBy)
+	if err != nil {
+		return nil, errors.Internal("failed to create prompt version")
+	}
+	return v, nil
+}
+
+// GetPromptVersion returns one version
+func (h *AdminHandler) GetPromptVersion(c *fiber.Ctx) error {
+	v, err := promptVersionParam(c)
+	if v == nil {
+		return err
+	}
+	return httputil.Success(c, toPromptVersionResponse(v))
+}
+
+// TestPromptVersion runs a version's prompt on sample tasks without saving
+// anything, so a draft can be checked before it is published. The calls are
+// recorded under the prompt_test feature and count towards no version.
+func (h *AdminHandler) TestPromptVersion(c *fiber.Ctx) error {
+	v, err := promptVersionParam(c)
+	if v == nil {
+		return err
+	}
+	if v.Feature == prompts.FirstContext {
+		return httputil.BadRequest(c, "first_context versions can't be test-run")
+	}
+	if h.ai == nil || h.ai.llm == nil {
+		return httputil.ServiceUnavailable(c, "AI service not available")
+	}
+
+	var req PromptTestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if len(req.Samples) == 0 {
+		return httputil.BadRequest(c, "at least one sample is required")
+	}
+	if len(req.Samples) > maxPromptTestSamples {
+		return httputil.BadRequest(c, "at most "+strconv.Itoa(maxPromptTestSamples)+" samples allowed")
+	}
+
+	var published *prompts.Version
+	if req.Compare {
+		p, err := repository.GetPublishedAIPromptVersion(c.Context(), v.Feature)
+		if err != nil {
+			return httputil.InternalError(c, "failed to get published version")
+		}
+		if p != nil {
+			published = &prompts.Version{ID: p.ID, Feature: p.Feature, Number: p.Version, Configs: p.Configs}
+		}
+	}
+
+	version := &prompts.Version{ID: v.ID, Feature: v.Feature, Number: v.Version, Configs: v.Configs}
+	results := make([]PromptTestResult, 0, len(req.Samples))
+	for _, sample := range req.Samples {
+		result := PromptTestResult{Sample: sample}
+		output, err := h.runPrompt(c.Context(), version, sample)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Output = output
+		}
+		if published != nil {
+			result.Published, _ = h.runPrompt(c.Context(), published, sample)
+		}
+		results = append(results, result)
+	}
+
+	return httputil.Success(c, results)
+}
+
+// runPrompt runs one feature's call with a given version for a test-run
+func (h *AdminHandler) runPrompt(ctx context.Context, version *prompts.Version, sample PromptTestSample) (interface{}, error) {
+	switch version.Feature {
+	case prompts.AutoProcess:
+		result, _, err := h.ai.autoProcess(ctx, uuid.Nil, TierPremium, version, "prompt_test", sample.Title, sample.Description)
+		return result, err
+	case prompts.Decompose:
+		return h.ai.decompose(ctx, uuid.Nil, version, "prompt_test", sample.Title, sample.Description)
+	case prompts.EmailCleanup:
+		return h.ai.cleanEmailBody(ctx, uuid.Nil, version, "prompt_test", sample.Title, sample.Description)
+	}
+	return nil, nil
+}
+
+// PublishPromptVersion makes a draft the published version of its feature.
+// Publishing an archived version rolls back to it. Running experiments on
+// the feature stop, and every replica picks up the change.
+func (h *AdminHandler) PublishPromptVersion(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid version ID")
+	}
+	return h.publishPromptVersion(c, id)
+}
+
+// RollbackPrompt publishes the version that was published before the current one
+func (h *AdminHandler) RollbackPrompt(c *fiber.Ctx) error {
+	feature, ok := promptFeature(c)
+	if !ok {
+		return httputil.NotFound(c, "prompt feature")
+	}
+
+	previous, err := repository.GetPreviousAIPromptVersion(c.Context(), feature)
+	if err != nil {
+		return httputil.InternalError(c, "failed to get previous version")
+	}
+	if previous == nil {
+		return httputil.BadRequest(c, "no earlier published version to roll back to")
+	}
+	return h.publishPromptVersion(c, previous.ID)
+}
+
+func (h *AdminHandler) publishPromptVersion(c *fiber.Ctx, id uuid.UUID) error {
+	v, err := repository.PublishAIPromptVersion(c.Context(), id, middleware.GetEmail(c))
+	if err == repository.ErrPromptVersionState {
+		return httputil.BadRequest(c, "version is already published")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "failed to publish prompt version")
+	}
+	if v == nil {
+		return httputil.NotFound(c, "prompt version")
+	}
+
+	prompts.Notify(c.Context(), h.redis)
+	return httputil.Success(c, toPromptVersionResponse(v))
+}
+
+// ListPromptExperiments returns a feature's experiments, newest first
+func (h *AdminHandler) ListPromptExperiments(c *fiber.Ctx) error {
+	feature, ok := promptFeature(c)
+	if !ok {
+		return httputil.NotFound(c, "prompt feature")
+	}
+
+	experiments, err := repository.ListAIPromptExperiments(c.Context(), feature)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list prompt experiments")
+	}
+
+	result := make([]PromptExperimentResponse, 0, len(experiments))
+	for i := range experiments {
+		result = append(result, toPromptExperimentResponse(&experiments[i]))
+	}
+	return httputil.Success(c, result)
+}
+
+// CreatePromptExperiment splits a feature's traffic between its published
+// version and a variant. Users are assigned by ID, so each sees the same
+// side for the whole experiment.
+func (h *AdminHandler) CreatePromptExperiment(c *fiber.Ctx) error {
+	feature, ok := promptFeature(c)
+	if !ok {
+		return httputil.NotFound(c, "prompt feature")
+	}
+	if feature == prompts.FirstContext {
+		return httputil.BadRequest(c, "first_context can't be experimented on")
+	}
+
+	var req CreatePromptExperimentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if req.VariantPercent < 1 || req.VariantPercent > 99 {
+		return httputil.BadRequest(c, "variant_percent must be between 1 and 99")
+	}
+	variantID, err := uuid.Parse(req.VariantID)
+	if err != nil {
+		return httputil.BadRequest(c, "invalid variant_id")
+	}
+
+	variant, err := repository.GetAIPromptVersion(c.Context(), variantID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to get prompt version")
+	}
+	if variant == nil || variant.Feature != feature {
+		return httputil.NotFound(c, "prompt version")
+	}
+
+	experiment, err := repository.CreateAIPromptExperiment(c.Context(), variant, req.VariantPercent, middleware.GetEmail(c))
+	switch err {
+	case nil:
+	case repository.ErrPromptExperimentRunning:
+		return httputil.Conflict(c, "feature already has a running experiment")
+	case repository.ErrPromptVersionState:
+		return httputil.BadRequest(c, "variant must differ from a published control version")
+	default:
+		return httputil.InternalError(c, "failed to start experiment")
+	}
+
+	prompts.Notify(c.Context(), h.redis)
+	return httputil.Created(c, toPromptExperimentResponse(experiment))
+}
+
+// StopPromptExperiment ends an experiment; everyone gets the published version again
+func (h *AdminHandler) StopPromptExperiment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid experiment ID")
+	}
+
+	stopped, err := repository.StopAIPromptExperiment(c.Context(), id)
+	if err != nil {
+		return httputil.InternalError(c, "failed to stop experiment")
+	}
+	if !stopped {
+		return httputil.NotFound(c, "running experiment")
+	}
+
+	prompts.Notify(c.Context(), h.redis)
+	return httputil.Success(c, map[string]string{"message": "experiment stopped"})
+}
+
+// PromptMetrics compares a feature's versions over the last days (default 14,
+// at most 90): tokens, schema failures, and what users did with the output
+func (h *AdminHandler) PromptMetrics(c *fiber.Ctx) error {
+	feature, ok := promptFeature(c)
+	if !ok {
+		return httputil.NotFound(c, "prompt feature")
+	}
+
+	days := c.QueryInt("days", 14)
+	if days < 1 || days > 90 {
+		return httputil.BadRequest(c, "days must be between 1 and 90")
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	metrics, err := repository.GetAIPromptMetrics(c.Context(), feature, since)
+	if err != nil {
+		return httputil.InternalError(c, "failed to get prompt metrics")
+	}
+	return httputil.Success(c, fiber.Map{
+		"feature":  feature,
+		"since":    since.Format(time.RFC3339),
+		"versions": metrics,
+	})
+}
@@ -0,0 +1,217 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/llmroute"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// =====================================================
+// AI Model Routing
+// =====================================================
+
+// maxRouteSteps caps the steps of one routing table entry
+const maxRouteSteps = 5
+
+var routeFeaturePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ModelRouteResponse is a routing table entry in admin responses
+type ModelRouteResponse struct {
+	Feature   string      `json:"feature"`
+	Tier      string      `json:"tier"`
+	Steps     []llm.Route `json:"steps"`
+	UpdatedBy *string     `json:"updated_by,omitempty"`
+	UpdatedAt string      `json:"updated_at"`
+}
+
+// ModelRoutesResponse is the routing table with the providers it can use
+type ModelRoutesResponse struct {
+	Routes    []ModelRouteResponse `json:"routes"`
+	Providers []llm.Provider       `json:"providers"` // Configured in this process
+}
+
+// UpdateModelRouteRequest replaces the steps of an entry
+type UpdateModelRouteRequest struct {
+	Steps []llm.Route `json:"steps"`
+}
+
+// ModelRouteDryRunRequest names the call to route. Without a user only
+// entries for any tier match, as for calls made outside a request.
+type ModelRouteDryRunRequest struct {
+	Feature string `json:"feature"`
+	UserID  string `json:"user_id,omitempty"`
+}
+
+// ModelRouteDryRunResponse is where the call would go
+type ModelRouteDryRunResponse struct {
+	Feature string `json:"feature"`
+	Tier    string `json:"tier"`
+	llm.RoutePlan
+}
+
+// modelRouteKey returns the :feature and :tier params if they are valid
+func modelRouteKey(c *fiber.Ctx) (feature, tier string, err error) {
+	feature, tier = c.Params("feature"), c.Params("tier")
+	if feature != llmroute.Any && !routeFeaturePattern.MatchString(feature) {
+		return "", "", httputil.BadRequest(c, "feature must be a feature name or *")
+	}
+	switch UserTier(tier) {
+	case TierFree, TierLight, TierPremium, llmroute.Any:
+	default:
+		return "", "", httputil.BadRequest(c, "tier must be free, light, premium or *")
+	}
+	return feature, tier, nil
+}
+
+// validateRouteSteps checks the steps of an entry, returning a message for
+// the admin if they are invalid
+func (h *AdminHandler) validateRouteSteps(steps []llm.Route) string {
+	if len(steps) == 0 {
+		return "at least one step is required"
+	}
+	if len(steps) > maxRouteSteps {
+		return fmt.Sprintf("at most %d steps allowed", maxRouteSteps)
+	}
+
+	configured := make(map[llm.Provider]bool)
+	if h.ai != nil && h.ai.llm != nil {
+		for _, p := range h.ai.llm.Providers() {
+			configured[p] = true
+		}
+	}
+	for i, step := range steps {
+		switch {
+		case step.Provider == "":
+			return fmt.Sprintf("step %d has no provider", i+1)
+		case len(configured) > 0 && !configured[step.Provider]:
+			return fmt.Sprintf("step %d: provider %s is not configured", i+1, step.Provider)
+		case step.MaxTokens < 0:
+			return fmt.Sprintf("step %d: max_tokens can't be negative", i+1)
+		case step.Temperature != nil && (*step.Temperature < 0 || *step.Temperature > 2):
+			return fmt.Sprintf("step %d: temperature must be between 0 and 2", i+1)
+		}
+	}
+	return ""
+}
+
+// ListModelRoutes returns the routing table
+func (h *AdminHandler) ListModelRoutes(c *fiber.Ctx) error {
+	rows, err := repository.ListAIModelRoutes(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "failed to list model routes")
+	}
+
+	result := ModelRoutesResponse{Routes: make([]ModelRouteResponse, 0, len(rows)), Providers: []llm.Provider{}}
+	for _, r := range rows {
+		steps, err := llmroute.Decode(r.Steps)
+		if err != nil {
+			continue
+		}
+		result.Routes = append(result.Routes, ModelRouteResponse{
+			Feature:   r.Feature,
+			Tier:      r.Tier,
+			Steps:     steps,
+			UpdatedBy: r.UpdatedBy,
+			UpdatedAt: r.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	if h.ai != nil && h.ai.llm != nil {
+		result.Providers = h.ai.llm.Providers()
+	}
+
+	return httputil.Success(c, result)
+}
+
+// UpdateModelRoute sets the steps of a feature and tier. Every replica
+// switches to them without a restart.
+func (h *AdminHandler) UpdateModelRoute(c *fiber.Ctx) error {
+	feature, tier, err := modelRouteKey(c)
+	if feature == "" {
+		return err
+	}
+
+	var req UpdateModelRouteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if msg := h.validateRouteSteps(req.Steps); msg != "" {
+		return httputil.BadRequest(c, msg)
+	}
+
+	steps, err := json.Marshal(req.Steps)
+	if err != nil {
+		return httputil.BadRequest(c, "invalid steps")
+	}
+	if err := repository.UpsertAIModelRoute(c.Context(), feature, tier, steps, middleware.GetEmail(c)); err != nil {
+		return httputil.InternalError(c, "failed to update model route")
+	}
+	llmroute.Notify(c.Context(), h.redis)
+
+	return httputil.Success(c, ModelRouteResponse{
+		Feature:   feature,
+		Tier:      tier,
+		Steps:     req.Steps,
+		UpdatedAt: time.Now().Format(time.RFC3339),
+	})
+}
+
+// DeleteModelRoute removes an entry; its calls fall to a less specific
+// entry or the default provider
+func (h *AdminHandler) DeleteModelRoute(c *fiber.Ctx) error {
+	feature, tier, err := modelRouteKey(c)
+	if feature == "" {
+		return err
+	}
+
+	deleted, err := repository.DeleteAIModelRoute(c.Context(), feature, tier)
+	if err != nil {
+		return httputil.InternalError(c, "failed to delete model route")
+	}
+	if !deleted {
+		return httputil.NotFound(c, "model route")
+	}
+	llmroute.Notify(c.Context(), h.redis)
+
+	return httputil.NoContent(c)
+}
+
+// DryRunModelRoute shows which provider and model a call would use, after
+// the routing table, privacy mode, spend caps and open circuits. Nothing is
+// sent.
+func (h *AdminHandler) DryRunModelRoute(c *fiber.Ctx) error {
+	if h.ai == nil || h.ai.llm == nil {
+		return httputil.ServiceUnavailable(c, "AI service not available")
+	}
+
+	var req ModelRouteDryRunRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if !routeFeaturePattern.MatchString(req.Feature) {
+		return httputil.BadRequest(c, "feature is required")
+	}
+
+	userID, tier := uuid.Nil, llmroute.Any
+	if req.UserID != "" {
+		id, err := uuid.Parse(req.UserID)
+		if err != nil {
+			return httputil.BadRequest(c, "invalid user ID")
+		}
+		if tier, err = repository.GetUserTier(c.Context(), id); err != nil {
+			return httputil.InternalError(c, "failed to get user tier")
+		}
+		userID = id
+	}
+
+	plan := h.ai.llm.Explain(c.Context(), llm.CompletionRequest{Feature: req.Feature, UserID: userID})
+	return httputil.Success(c, ModelRouteDryRunResponse{Feature: req.Feature, Tier: tier, RoutePlan: plan})
+}
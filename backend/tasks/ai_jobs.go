@@ -0,0 +1,409 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// AI job statuses in ai_processing_queue
+const (
+	AIJobPending    = "pending" // Waiting to run, or scheduled for a retry
+	AIJobProcessing = "processing"
+	AIJobCompleted  = "completed"
+	AIJobDead       = "dead" // Out of attempts; an admin can replay it
+)
+
+// AI job sources (what enqueued the job)
+const (
+	AIJobSourceCreate         = "create"
+	AIJobSourceInboundEmail   = "inbound_email"
+	AIJobSourceContentChanged = "content_changed"
+	AIJobSourceAssistant      = repository.AIJobSourceAssistant
+)
+
+// AI job queue settings
+const (
+	aiJobTimeout         = 60 * time.Second // Per attempt
+	aiJobLease           = 3 * aiJobTimeout // Outlives any attempt, so only a dead worker loses it
+	aiJobBaseBackoff     = 30 * time.Second
+	aiJobMaxBackoff      = 30 * time.Minute
+	aiJobPollInterval    = 2 * time.Second
+	aiJobReapInterval    = 30 * time.Second
+	aiJobUserConcurrency = 2 // Jobs running at once for one user, across all workers
+	embedRefreshInterval = 15 * time.Second
+	embedRefreshBatch    = 50 // Tasks embedded per provider call
+)
+
+// AIJob is a row of ai_processing_queue
+type AIJob struct {
+	ID          uuid.UUID       `json:"id"`
+	UserID      uuid.UUID       `json:"user_id"`
+	TaskID      uuid.UUID       `json:"task_id"`
+	Features    []string        `json:"features"`
+	Source      string          `json:"source"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAfter    time.Time       `json:"run_after"`
+	LeaseOwner  *string         `json:"lease_owner,omitempty"`
+	LeasedUntil *time.Time      `json:"leased_until,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       *string         `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+}
+
+const aiJobColumns = `id, user_id, task_id, features, source, status, attempts, max_attempts, run_after,
+	lease_owner, leased_until, result, error, COALESCE(created_at, NOW()), COALESCE(updated_at, NOW()), processed_at`
+
+func scanAIJob(row pgx.Row) (*AIJob, error) {
+	var job AIJob
+	var result []byte
+	err := row.Scan(
+		&job.ID, &job.UserID, &job.TaskID, &job.Features, &job.Source, &job.Status,
+		&job.Attempts, &job.MaxAttempts, &job.RunAfter, &job.LeaseOwner, &job.LeasedUntil,
+		&result, &job.Error, &job.CreatedAt, &job.UpdatedAt, &job.ProcessedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > 0 {
+		job.Result = result
+	}
+	return &job, nil
+}
+
+// Enqueue schedules AI processing for a task. If a job for the task is
+// already waiting, that job covers this request too.
+func (p *AIProcessor) Enqueue(ctx context.Context, userID, taskID uuid.UUID, source string) error {
+	return repository.EnqueueAIJob(ctx, p.db, userID, taskID, source)
+}
+
+// claimJob leases the next due job, skipping users already at their
+// concurrency cap. Returns nil when there is nothing to run.
+func (p *AIProcessor) claimJob(ctx context.Context, owner string) (*AIJob, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var jobID, userID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		SELECT q.id, q.user_id FROM ai_processing_queue q
+		WHERE q.status = 'pending' AND q.run_after <= NOW()
+		  AND (SELECT COUNT(*) FROM ai_processing_queue r
+		       WHERE r.user_id = q.user_id AND r.status = 'processing' AND r.leased_until > NOW()) < $1
+		ORDER BY q.run_after
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, aiJobUserConcurrency).Scan(&jobID, &userID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The count above can miss claims committed by other workers meanwhile;
+	// recount under a per-user lock so the cap holds across workers
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('ai_queue:' || $1::text))", userID); err != nil {
+		return nil, err
+	}
+	var running int
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM ai_processing_queue
+		 WHERE user_id = $1 AND status = 'processing' AND leased_until > NOW()`,
+		userID,
+	).Scan(&running)
+	if err != nil {
+		return nil, err
+	}
+	if running >= aiJobUserConcurrency {
+		return nil, nil
+	}
+
+	job, err := scanAIJob(tx.QueryRow(ctx, `
+		UPDATE ai_processing_queue
+		SET status = 'processing', attempts = attempts + 1, lease_owner = $2,
+		    leased_until = NOW() + make_interval(secs => $3), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+aiJobColumns,
+		jobID, owner, aiJobLease.Seconds(),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return job, tx.Commit(ctx)
+}
+
+// runJob processes a claimed job and records the outcome
+func (p *AIProcessor) runJob(job *AIJob, owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), aiJobTimeout)
+	defer cancel()
+
+	features, err := p.ProcessTaskAI(ctx, job.UserID, job.TaskID)
+
+	// Record the outcome even if the attempt ran out of time
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+
+	if err != nil {
+		fmt.Printf("[AI Queue] Job %s (task %s) attempt %d/%d failed: %v\n", job.ID, job.TaskID, job.Attempts, job.MaxAttempts, err)
+		if err := p.retryOrBury(saveCtx, job, owner, err.Error()); err != nil {
+			fmt.Printf("[AI Queue] Failed to reschedule job %s: %v\n", job.ID, err)
+		}
+		return
+	}
+
+	result, _ := json.Marshal(map[string]interface{}{"features": features})
+	_, err = p.db.Exec(saveCtx,
+		`UPDATE ai_processing_queue
+		 SET status = 'completed', result = $3, error = NULL, processed_at = NOW(),
+		     lease_owner = NULL, leased_until = NULL, updated_at = NOW()
+		 WHERE id = $1 AND status = 'processing' AND lease_owner = $2`,
+		job.ID, owner, result,
+	)
+	if err != nil {
+		fmt.Printf("[AI Queue] Failed to complete job %s: %v\n", job.ID, err)
+	}
+}
+
+// retryOrBury schedules another attempt with exponential backoff, or parks
+// the job as dead once it is out of attempts
+func (p *AIProcessor) retryOrBury(ctx context.Context, job *AIJob, owner, reason string) error {
+	if job.Attempts >= job.MaxAttempts {
+		_, err := p.db.Exec(ctx,
+			`UPDATE ai_processing_queue
+			 SET status = 'dead', error = $3, lease_owner = NULL, leased_until = NULL, updated_at = NOW()
+			 WHERE id = $1 AND status = 'processing' AND lease_owner = $2`,
+			job.ID, owner, reason,
+		)
+		return err
+	}
+
+	tag, err := p.db.Exec(ctx,
+		`UPDATE ai_processing_queue q
+		 SET status = 'pending', error = $3, run_after = NOW() + make_interval(secs => $4),
+		     lease_owner = NULL, leased_until = NULL, updated_at = NOW()
+		 WHERE id = $1 AND status = 'processing' AND lease_owner = $2
+		   AND NOT EXISTS (SELECT 1 FROM ai_processing_queue w WHERE w.task_id = q.task_id AND w.status = 'pending')`,
+		job.ID, owner, reason, aiJobBackoff(job.Attempts).Seconds(),
+	)
+	if err != nil || tag.RowsAffected() > 0 {
+		return err
+	}
+
+	// A newer job for the task is already waiting and will redo the work
+	_, err = p.db.Exec(ctx,
+		`UPDATE ai_processing_queue
+		 SET status = 'completed', error = $3, processed_at = NOW(),
+		     lease_owner = NULL, leased_until = NULL, updated_at = NOW()
+		 WHERE id = $1 AND status = 'processing' AND lease_owner = $2`,
+		job.ID, owner, "superseded by a newer job after: "+reason,
+	)
+	return err
+}
+
+// reapExpiredLeases hands back jobs whose worker died mid-run
+func (p *AIProcessor) reapExpiredLeases(ctx context.Context) error {
+	rows, err := p.db.Query(ctx,
+		`SELECT `+aiJobColumns+` FROM ai_processing_queue
+		 WHERE status = 'processing' AND leased_until < NOW()
+		 LIMIT 100`,
+	)
+	if err != nil {
+		return err
+	}
+	var expired []*AIJob
+	for rows.Next() {
+		job, err := scanAIJob(rows)
+		if err != nil {
+			continue
+		}
+		expired = append(expired, job)
+	}
+	rows.Close()
+
+	for _, job := range expired {
+		if job.LeaseOwner == nil {
+			continue
+		}
+		fmt.Printf("[AI Queue] Lease expired for job %s (worker %s)\n", job.ID, *job.LeaseOwner)
+		if err := p.retryOrBury(ctx, job, *job.LeaseOwner, "lease expired"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aiJobBackoff is the delay before retrying after the given attempt:
+// doubling from aiJobBaseBackoff up to aiJobMaxBackoff, with jitter
+func aiJobBackoff(attempt int) time.Duration {
+	delay := aiJobBaseBackoff
+	for i := 1; i < attempt && delay < aiJobMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > aiJobMaxBackoff {
+		delay = aiJobMaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/5)+1))
+}
+
+// =====================================================
+// Worker Pool
+// =====================================================
+
+// AIWorkerPool runs queued AI jobs. Any number of pools (inside the API
+// servers or the standalone ai-worker) can share the queue: jobs are claimed
+// with FOR UPDATE SKIP LOCKED and held by a lease that lapses if a worker dies.
+type AIWorkerPool struct {
+	processor *AIProcessor
+	workers   int
+	owner     string
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewAIWorkerPool creates a pool of the given number of workers
+func NewAIWorkerPool(processor *AIProcessor, workers int) *AIWorkerPool {
+	host, _ := os.Hostname()
+	return &AIWorkerPool{
+		processor: processor,
+		workers:   workers,
+		owner:     fmt.Sprintf("%s:%d:%s", host, os.Getpid(), uuid.NewString()[:8]),
+	}
+}
+
+// Start launches the workers, the lease reaper and the embedding refresher
+func (w *AIWorkerPool) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	w.wg.Add(2)
+	go w.reap(ctx)
+	go w.embed(ctx)
+	for i := 0; i < w.workers; i++ {
+		w.wg.Add(1)
+		go w.work(ctx)
+	}
+	fmt.Printf("[AI Queue] Started %d workers as %s\n", w.workers, w.owner)
+}
+
+// Stop stops claiming jobs and waits for running ones to finish. Jobs still
+// running when ctx is done are picked up again once their lease expires.
+func (w *AIWorkerPool) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *AIWorkerPool) work(ctx context.Context) {
+	defer w.wg.Done()
+	for ctx.Err() == nil {
+		job, err := w.processor.claimJob(ctx, w.owner)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("[AI Queue] Failed to claim job: %v\n", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(aiJobPollInterval):
+			}
+			continue
+		}
+		w.processor.runJob(job, w.owner)
+	}
+}
+
+func (w *AIWorkerPool) reap(ctx context.Context) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(aiJobReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.processor.reapExpiredLeases(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("[AI Queue] Failed to reap expired leases: %v\n", err)
+			}
+		}
+	}
+}
+
+// embed keeps task embeddings in step with titles and descriptions. Every
+// pool runs it, but only the one holding the lock embeds on a given pass;
+// a full batch means there is a backlog, so the next one starts at once.
+func (w *AIWorkerPool) embed(ctx context.Context) {
+	defer w.wg.Done()
+	if !w.processor.embedder.Available() {
+		return
+	}
+	ticker := time.NewTicker(embedRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				n, err := w.processor.refreshEmbeddings(ctx)
+				if err != nil && ctx.Err() == nil {
+					fmt.Printf("[AI Queue] Failed to refresh task embeddings: %v\n", err)
+				}
+				if err != nil || n < embedRefreshBatch {
+					break
+				}
+			}
+		}
+	}
+}
+
+// refreshEmbeddings embeds one batch of changed tasks under a transaction
+// lock, and returns 0 without doing anything if another pool holds it
+func (p *AIProcessor) refreshEmbeddings(ctx context.Context) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(hashtext('task_embeddings'))").Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+	n, err := p.embedder.Refresh(ctx, tx, embedRefreshBatch)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit(ctx)
+}
@@ -8,10 +8,12 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/csaptu/flow/pkg/llm"
 	ws "github.com/csaptu/flow/pkg/websocket"
+	"github.com/csaptu/flow/shared/embeddings"
 	"github.com/csaptu/flow/shared/repository"
 	"github.com/csaptu/flow/tasks/models"
 )
@@ -30,7 +32,7 @@ const (
 )
 
 // TaskSnapshot holds the state of a task at the time AI processing was triggered
-// This is kept in-memory during the goroutine's lifetime (typically 2-5 seconds)
+// This is kept in-memory for the duration of a job attempt (typically 2-5 seconds)
 type TaskSnapshot struct {
 	TaskID               uuid.UUID
 	UserID               uuid.UUID
@@ -52,6 +54,7 @@ type AIQueueResult struct {
 	Duplicates     []string
 	Subtasks       []TaskStep
 	ProcessedFeatures []AIFeatureType
+	PromptVersion  uuid.UUID // Prompt version the results came from; Nil for built-in prompts
 }
 
 // AIProcessor handles queue-based AI processing with conflict detection
@@ -60,6 +63,7 @@ type AIProcessor struct {
 	redis     *redis.Client
 	llm       *llm.MultiClient
 	aiService *AIService
+	embedder  *embeddings.Index
 	mu        sync.Mutex
 }
 
@@ -70,31 +74,27 @@ func NewAIProcessor(db *pgxpool.Pool, redis *redis.Client, llmClient *llm.MultiC
 		redis:     redis,
 		llm:       llmClient,
 		aiService: NewAIService(db, llmClient),
+		embedder:  embeddings.New(db, llmClient),
 	}
 }
 
-// ProcessTaskAI runs AI processing with conflict detection
-// This is called asynchronously after task creation/update
-func (p *AIProcessor) ProcessTaskAI(ctx context.Context, userID, taskID uuid.UUID) {
+// ProcessTaskAI runs AI processing with conflict detection and returns the
+// features whose results were written. Called by the job queue workers; an
+// error means the attempt should be retried.
+func (p *AIProcessor) ProcessTaskAI(ctx context.Context, userID, taskID uuid.UUID) ([]AIFeatureType, error) {
 	fmt.Printf("[AI Queue] ProcessTaskAI called for task %s, user %s\n", taskID, userID)
 
-	if p.llm == nil {
-		fmt.Printf("[AI Queue] LLM client is nil, skipping AI processing\n")
-		return
-	}
-	if p.aiService == nil {
-		fmt.Printf("[AI Queue] AI service is nil, skipping AI processing\n")
-		return
+	if p.llm == nil || p.aiService == nil {
+		return nil, fmt.Errorf("AI service not available")
 	}
 
-	// Use a fresh context with timeout since the original may be cancelled
-	bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
 	// 1. Get current task and create snapshot
-	task, err := p.getTask(bgCtx, taskID, userID)
-	if err != nil || task == nil {
-		return
+	task, err := p.getTask(ctx, taskID, userID)
+	if err == pgx.ErrNoRows {
+		return nil, nil // Task deleted since it was queued
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task: %w", err)
 	}
 
 	snapshot := TaskSnapshot{
@@ -108,11 +108,11 @@ func (p *AIProcessor) ProcessTaskAI(ctx context.Context, userID, taskID uuid.UUI
 	}
 
 	// 2. Get user's tier (for feature access)
-	tier, _ := p.aiService.GetUserTier(bgCtx, userID)
+	tier, _ := p.aiService.GetUserTier(ctx, userID)
 
 	// 3. Get user's AI preferences
 	prefs := AIPreferences{}
-	if userPrefs, err := repository.GetUserAIPreferencesMap(bgCtx, userID); err == nil && userPrefs != nil {
+	if userPrefs, err := repository.GetUserAIPreferencesMap(ctx, userID); err == nil && userPrefs != nil {
 		prefs = userPrefs
 	}
 	fmt.Printf("[AI Queue] User preferences: %v\n", prefs)
@@ -122,7 +122,7 @@ func (p *AIProcessor) ProcessTaskAI(ctx context.Context, userID, taskID uuid.UUI
 	fmt.Printf("[AI Queue] Features to run: %v\n", featuresToRun)
 	if len(featuresToRun) == 0 {
 		fmt.Printf("[AI Queue] No features to run, skipping\n")
-		return
+		return nil, nil
 	}
 
 	// 4. Run AI processing (all features in one call for efficiency)
@@ -131,17 +131,24 @@ func (p *AIProcessor) ProcessTaskAI(ctx context.Context, userID, taskID uuid.UUI
 		description = *task.Description
 	}
 
-	result, err := p.aiService.ProcessTaskOnSave(bgCtx, userID, taskID, task.Title, description)
+	result, err := p.aiService.ProcessTaskOnSave(ctx, userID, taskID, task.Title, description)
 	if err != nil {
-		fmt.Printf("[AI Queue] Processing failed for task %s: %v\n", taskID, err)
-		return
+		return nil, err
 	}
 
 	// 5. Convert result to queue result
 	queueResult := p.convertToQueueResult(result, featuresToRun)
 
 	// 6. Check for conflicts and write results
-	p.writeResultsWithConflictCheck(bgCtx, taskID, userID, snapshot, queueResult)
+	if err := p.writeResultsWithConflictCheck(ctx, taskID, userID, snapshot, prefs, queueResult); err != nil {
+		return nil, err
+	}
+
+	if result.Draft != nil {
+		p.aiService.SaveDraft(ctx, userID, taskID, result.Draft)
+	}
+
+	return queueResult.ProcessedFeatures, nil
 }
 
 // getTask retrieves a task from the database
@@ -195,10 +202,11 @@ type AIPreferences map[string]string
 func (p *AIProcessor) determineFeatures(tier UserTier, task *models.Task, prefs AIPreferences) []AIFeatureType {
 	features := []AIFeatureType{}
 
-	// Helper to check if feature is set to "auto"
+	// Helper to check if feature is set to "auto" ("review" runs too; its
+	// output is held as a suggestion instead of written to the task)
 	isAuto := func(key string) bool {
 		val, ok := prefs[key]
-		return !ok || val == "auto" // Default to auto if not set
+		return !ok || val == "auto" || val == "review" // Default to auto if not set
 	}
 
 	// Title cleaning - only if preference is "auto" and AI cleaned title is nil
@@ -236,6 +244,7 @@ func (p *AIProcessor) determineFeatures(tier UserTier, task *models.Task, prefs
 func (p *AIProcessor) convertToQueueResult(result *AIProcessResult, features []AIFeatureType) *AIQueueResult {
 	queueResult := &AIQueueResult{
 		ProcessedFeatures: features,
+		PromptVersion:     result.PromptVersion,
 	}
 
 	if result.CleanedTitle != nil {
@@ -263,12 +272,16 @@ func (p *AIProcessor) convertToQueueResult(result *AIProcessResult, features []A
 
 // writeResultsWithConflictCheck checks for conflicts and writes AI results
 func (p *AIProcessor) writeResultsWithConflictCheck(ctx context.Context, taskID, userID uuid.UUID,
-	snapshot TaskSnapshot, results *AIQueueResult) {
+	snapshot TaskSnapshot, prefs AIPreferences, results *AIQueueResult) error {
 
 	// Get current state from DB
 	current, err := p.getTask(ctx, taskID, userID)
-	if err != nil || current == nil {
-		return
+	if err == pgx.ErrNoRows {
+		results.ProcessedFeatures = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reload task: %w", err)
 	}
 
 	// Check what changed since snapshot
@@ -304,28 +317,38 @@ func (p *AIProcessor) writeResultsWithConflictCheck(ctx context.Context, taskID,
 		results.ProcessedFeatures = removeFeature(results.ProcessedFeatures, AIFeatureEntityExtraction)
 		results.ProcessedFeatures = removeFeature(results.ProcessedFeatures, AIFeatureComplexity)
 
-		// Re-run AI processing with new content (recursive call with new snapshot)
+		// Queue another run with the new content
 		// Only if there are features that need re-running (use empty prefs to check task state only)
 		featuresNeeded := p.determineFeatures(TierPremium, current, AIPreferences{})
 		if len(featuresNeeded) > 0 {
-			fmt.Printf("[AI Queue] Content changed during processing for task %s, restarting\n", taskID)
-			go p.ProcessTaskAI(ctx, userID, taskID)
+			fmt.Printf("[AI Queue] Content changed during processing for task %s, requeueing\n", taskID)
+			if err := p.Enqueue(ctx, userID, taskID, AIJobSourceContentChanged); err != nil {
+				fmt.Printf("[AI Queue] Failed to requeue task %s: %v\n", taskID, err)
+			}
+		}
+	}
+
+	// Fields the user reviews become suggestions instead of task changes
+	if review := splitForReview(results, prefs); hasResults(review) {
+		if err := p.saveSuggestions(ctx, current, review); err != nil {
+			return fmt.Errorf("failed to save AI suggestions: %w", err)
 		}
 	}
 
 	// Check if there are any results to write
 	if !hasResults(results) {
-		return
+		return nil
 	}
 
 	// Write remaining results to DB
-	if err := p.applyAIResults(ctx, taskID, userID, results); err != nil {
-		fmt.Printf("[AI Queue] Failed to apply AI results for task %s: %v\n", taskID, err)
-		return
+	if err := p.applyAIResults(ctx, p.db, taskID, userID, results); err != nil {
+		return fmt.Errorf("failed to apply AI results: %w", err)
 	}
+	recordPromptOutcome(ctx, results.PromptVersion, userID, repository.PromptOutcomeApplied)
 
 	// Publish WebSocket event via Redis
 	p.publishTaskUpdate(ctx, userID, taskID, results)
+	return nil
 }
 
 // removeFeature removes a feature from the list
@@ -348,8 +371,8 @@ func hasResults(results *AIQueueResult) bool {
 		results.DueAt != nil
 }
 
-// applyAIResults writes AI results to the database
-func (p *AIProcessor) applyAIResults(ctx context.Context, taskID, userID uuid.UUID, results *AIQueueResult) error {
+// applyAIResults writes AI results to the database (db may be a transaction)
+func (p *AIProcessor) applyAIResults(ctx context.Context, db repository.DBTX, taskID, userID uuid.UUID, results *AIQueueResult) error {
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
@@ -383,8 +406,9 @@ func (p *AIProcessor) applyAIResults(ctx context.Context, taskID, userID uuid.UU
 		argNum++
 	}
 
+	var entitiesJSON []byte
 	if len(results.Entities) > 0 {
-		entitiesJSON, _ := json.Marshal(results.Entities)
+		entitiesJSON, _ = json.Marshal(results.Entities)
 		updates = append(updates, fmt.Sprintf("ai_entities = $%d", argNum))
 		args = append(args, entitiesJSON)
 		argNum++
@@ -394,6 +418,13 @@ func (p *AIProcessor) applyAIResults(ctx context.Context, taskID, userID uuid.UU
 		return nil
 	}
 
+	// Remember which prompt version made the changes, so a revert counts against it
+	if results.PromptVersion != uuid.Nil {
+		updates = append(updates, fmt.Sprintf("ai_prompt_version = $%d", argNum))
+		args = append(args, results.PromptVersion)
+		argNum++
+	}
+
 	// Add timestamp and version update
 	updates = append(updates, fmt.Sprintf("updated_at = $%d", argNum))
 	args = append(args, time.Now())
@@ -411,8 +442,22 @@ func (p *AIProcessor) applyAIResults(ctx context.Context, taskID, userID uuid.UU
 		argNum+1,
 	)
 
-	_, err := p.db.Exec(ctx, query, args...)
-	return err
+	tag, err := db.Exec(ctx, query, args...)
+	if err != nil || tag.RowsAffected() == 0 || entitiesJSON == nil {
+		return err
+	}
+	return syncTaskEntities(ctx, db, userID, taskID, entitiesJSON)
+}
+
+// recordPromptOutcome attributes an outcome to the prompt version behind AI
+// results; results from built-in prompts have no version to attribute to
+func recordPromptOutcome(ctx context.Context, version, userID uuid.UUID, outcome string) {
+	if version == uuid.Nil {
+		return
+	}
+	if err := repository.RecordAIPromptOutcome(ctx, version, userID, outcome); err != nil {
+		fmt.Printf("[AI Queue] Failed to record %s outcome: %v\n", outcome, err)
+	}
 }
 
 // joinStrings joins strings with a separator (simple helper to avoid importing strings)
@@ -4,13 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/shared/ai"
+	"github.com/csaptu/flow/shared/llmschema"
+	"github.com/csaptu/flow/shared/prompts"
 	"github.com/csaptu/flow/shared/repository"
 )
 
@@ -38,6 +40,7 @@ const (
 	FeatureAutoGroup         AIFeature = "auto_group"
 	FeatureDraftEmail        AIFeature = "draft_email"
 	FeatureDraftCalendar     AIFeature = "draft_calendar"
+	FeatureDayPlan           AIFeature = "day_plan"
 )
 
 // Daily limits by tier
@@ -60,6 +63,7 @@ var featureLimits = map[UserTier]map[AIFeature]int{
 		FeatureAutoGroup:         10,
 		FeatureDraftEmail:        10,
 		FeatureDraftCalendar:     10,
+		FeatureDayPlan:           10,
 	},
 	TierPremium: {
 		// All unlimited for premium
@@ -74,71 +78,22 @@ var featureLimits = map[UserTier]map[AIFeature]int{
 		FeatureAutoGroup:         -1,
 		FeatureDraftEmail:        -1,
 		FeatureDraftCalendar:     -1,
+		FeatureDayPlan:           -1,
 	},
 }
 
 // AIService handles all AI operations
 type AIService struct {
-	db      *pgxpool.Pool
-	llm     *llm.MultiClient
-	configs map[string]string
+	db   *pgxpool.Pool
+	llm  *llm.MultiClient
+	auto *ai.Service // Auto-processing prompt and parsing
 }
 
-// NewAIService creates a new AI service
+// NewAIService creates a new AI service. Prompt configs come from the
+// prompts registry, which serves each user the published version of a
+// feature's prompt or the side of an experiment they are assigned to.
 func NewAIService(db *pgxpool.Pool, llmClient *llm.MultiClient) *AIService {
-	s := &AIService{db: db, llm: llmClient, configs: make(map[string]string)}
-	s.loadPromptConfigs()
-	return s
-}
-
-// loadPromptConfigs loads AI prompt configurations from the shared repository
-func (s *AIService) loadPromptConfigs() {
-	configs, err := repository.GetAIPromptConfigsAsMap(context.Background())
-	if err != nil {
-		// Use defaults if loading fails
-		s.configs = map[string]string{
-			"clean_title_instruction":     "Concise, action-oriented title (max 10 words)",
-			"summary_instruction":         "Brief summary if description is long (max 20 words)",
-			"complexity_instruction":      "1-10 scale (1=trivial like 'buy milk', 10=complex multi-step project)",
-			"due_date_instruction":        "ISO 8601 date if mentioned (e.g., 'tomorrow' = next day, 'next week' = next Monday)",
-			"reminder_instruction":        "ISO 8601 datetime if 'remind me' or similar phrase found",
-			"entities_instruction":        "person|place|organization",
-			"recurrence_instruction":      "RRULE string if recurring pattern detected (e.g., 'every Monday')",
-			"suggested_group_instruction": "Category suggestion based on content (e.g., 'Work', 'Shopping', 'Health')",
-			"decompose_step_count":        "2-5",
-			"decompose_rules":             "Each step should be a single, concrete action\nSteps should be in logical order\nUse action verbs (Call, Send, Research, Write, etc.)\nKeep each step under 10 words",
-		}
-		return
-	}
-	s.configs = configs
-}
-
-// ReloadConfigs reloads the AI prompt configurations from the database
-func (s *AIService) ReloadConfigs() {
-	s.loadPromptConfigs()
-}
-
-// getConfig returns a config value with a fallback default
-func (s *AIService) getConfig(key, defaultValue string) string {
-	if val, ok := s.configs[key]; ok && val != "" {
-		return val
-	}
-	return defaultValue
-}
-
-// getConfigEscaped returns a config value with JSON-unsafe characters escaped
-// Use this when embedding config values inside JSON examples in prompts
-func (s *AIService) getConfigEscaped(key, defaultValue string) string {
-	val := s.getConfig(key, defaultValue)
-	return escapeForJSONPrompt(val)
-}
-
-// escapeForJSONPrompt escapes characters that could break JSON structure in prompts
-func escapeForJSONPrompt(s string) string {
-	// Escape backslashes first, then quotes
-	s = strings.ReplaceAll(s, `\`, `\\`)
-	s = strings.ReplaceAll(s, `"`, `\"`)
-	return s
+	return &AIService{db: db, llm: llmClient, auto: ai.NewService(llmClient)}
 }
 
 // AIProcessResult contains all AI processing results
@@ -155,6 +110,7 @@ type AIProcessResult struct {
 	SuggestedGroup *string       `json:"suggested_group,omitempty"`
 	Steps          []TaskStep    `json:"steps,omitempty"`
 	Draft          *DraftContent `json:"draft,omitempty"`
+	PromptVersion  uuid.UUID     `json:"-"` // Prompt version the result came from; Nil for built-in prompts
 }
 
 // Entity represents an extracted entity
@@ -250,6 +206,19 @@ func (s *AIService) incrementUsage(ctx context.Context, userID uuid.UUID, featur
 	)
 }
 
+// RefundIfCached gives back a use of feature when resp came from the LLM
+// cache and cache hits are configured to be free
+func (s *AIService) RefundIfCached(ctx context.Context, userID uuid.UUID, feature AIFeature, resp *llm.CompletionResponse) {
+	if resp == nil || !resp.Cached || !s.llm.FreeCacheHits() {
+		return
+	}
+	_, _ = s.db.Exec(ctx,
+		`UPDATE ai_usage SET count = count - 1
+		 WHERE user_id = $1 AND feature = $2 AND used_at = CURRENT_DATE AND count > 0`,
+		userID, feature,
+	)
+}
+
 // ProcessTaskOnSave runs all auto-triggered AI features on task save
 func (s *AIService) ProcessTaskOnSave(ctx context.Context, userID uuid.UUID, taskID uuid.UUID, title, description string) (*AIProcessResult, error) {
 	if s.llm == nil {
@@ -257,183 +226,96 @@ func (s *AIService) ProcessTaskOnSave(ctx context.Context, userID uuid.UUID, tas
 	}
 
 	tier, _ := s.GetUserTier(ctx, userID)
-	result := &AIProcessResult{}
-
-	// Build combined prompt for efficiency (one API call for multiple features)
-	prompt := s.buildAutoProcessPrompt(tier, title, description)
-
-	resp, err := s.llm.Complete(ctx, llm.CompletionRequest{
-		Messages: []llm.Message{
-			{Role: "user", Content: prompt},
-		},
-		MaxTokens:   1000,
-		Temperature: 0.2,
-	})
+	version := prompts.For(ctx, prompts.AutoProcess, userID)
 
+	result, resp, err := s.autoProcess(ctx, userID, tier, version, "auto_process", title, description)
 	if err != nil {
-		return nil, fmt.Errorf("AI processing failed: %w", err)
-	}
-
-	// Parse response
-	if err := s.parseAutoProcessResponse(resp.Content, result); err != nil {
 		return nil, err
 	}
 
 	// Track usage for each feature processed
-	s.trackAutoProcessUsage(ctx, userID, tier, result)
+	if !resp.Cached || !s.llm.FreeCacheHits() {
+		s.trackAutoProcessUsage(ctx, userID, tier, result)
+	}
 
 	return result, nil
 }
 
-func (s *AIService) buildAutoProcessPrompt(tier UserTier, title, description string) string {
-	today := time.Now().Format("2006-01-02")
-	dayOfWeek := time.Now().Weekday().String()
-
-	// Get configurable instructions (escaped for safe JSON embedding)
-	cleanTitleInstr := s.getConfigEscaped("clean_title_instruction", "Concise, action-oriented title (max 10 words)")
-	summaryInstr := s.getConfigEscaped("summary_instruction", "Brief summary if description is long (max 20 words)")
-	dueDateInstr := s.getConfigEscaped("due_date_instruction", "ISO 8601 date if mentioned (e.g., 'tomorrow' = next day, 'next week' = next Monday)")
-	reminderInstr := s.getConfigEscaped("reminder_instruction", "ISO 8601 datetime if 'remind me' or similar phrase found")
-	complexityInstr := s.getConfigEscaped("complexity_instruction", "1-10 scale (1=trivial like 'buy milk', 10=complex multi-step project)")
-
-	basePrompt := fmt.Sprintf(`Analyze this task and extract information. Today is %s (%s).
-
-Task Title: %s
-Description: %s
-
-Return a JSON object with these fields (omit fields if not applicable):
-
-{
-  "cleaned_title": "%s",
-  "summary": "%s",
-  "due_date": "%s",
-  "reminder_time": "%s",
-  "complexity": %s`, today, dayOfWeek, title, description, cleanTitleInstr, summaryInstr, dueDateInstr, reminderInstr, complexityInstr)
-
-	// Add tier-specific features
-	if tier == TierLight || tier == TierPremium {
-		entitiesInstr := s.getConfigEscaped("entities_instruction", "person|place|organization")
-		recurrenceInstr := s.getConfigEscaped("recurrence_instruction", "RRULE string if recurring pattern detected (e.g., 'every Monday')")
-		suggestedGroupInstr := s.getConfigEscaped("suggested_group_instruction", "Category suggestion based on content (e.g., 'Work', 'Shopping', 'Health')")
-
-		basePrompt += fmt.Sprintf(`,
-  "entities": [{"type": "%s", "value": "extracted value"}],
-  "recurrence_rule": "%s",
-  "suggested_group": "%s"`, entitiesInstr, recurrenceInstr, suggestedGroupInstr)
-	}
-
-	// Check for draft triggers
-	if tier == TierLight || tier == TierPremium {
-		if s.containsDraftTrigger(title + " " + description) {
-			basePrompt += `,
-  "draft": {
-    "type": "email or calendar based on context",
-    "to": "recipient if mentioned",
-    "subject": "email subject",
-    "body": "professional email body",
-    "title": "calendar event title",
-    "start_time": "suggested start time ISO 8601",
-    "end_time": "suggested end time ISO 8601",
-    "attendees": ["list of attendees"]
-  }`
-		}
+// autoProcess makes the combined auto-process call with a given prompt
+// version. The prompt and parsing are shared/ai's, the same the eval
+// harness scores.
+func (s *AIService) autoProcess(ctx context.Context, userID uuid.UUID, tier UserTier, version *prompts.Version, feature, title, description string) (*AIProcessResult, *llm.CompletionResponse, error) {
+	shared, resp, err := s.auto.AutoProcess(ctx, userID, ai.UserTier(tier), version, feature, time.Now(), title, description)
+	if err != nil {
+		return nil, resp, err
 	}
 
-	basePrompt += `
-}
-
-IMPORTANT:
-- Only include fields that apply to this task
-- Dates should be ISO 8601 format
-- Be concise and practical
-- Return ONLY valid JSON, no markdown or explanation`
-
-	return basePrompt
-}
-
-func (s *AIService) containsDraftTrigger(text string) bool {
-	text = strings.ToLower(text)
-	triggers := []string{
-		"email", "tell ", "message ", "contact ",
-		"meet with", "meeting", "schedule ", "call with",
+	result := &AIProcessResult{
+		CleanedTitle:   shared.CleanedTitle,
+		CleanedDesc:    shared.CleanedDesc,
+		Summary:        shared.Summary,
+		DueAt:          shared.DueAt,
+		HasDueTime:     shared.HasDueTime,
+		ReminderTime:   shared.ReminderTime,
+		Complexity:     shared.Complexity,
+		RecurrenceRule: shared.RecurrenceRule,
+		SuggestedGroup: shared.SuggestedGroup,
+		PromptVersion:  shared.PromptVersion,
 	}
-	for _, trigger := range triggers {
-		if strings.Contains(text, trigger) {
-			return true
-		}
+	for _, e := range shared.Entities {
+		result.Entities = append(result.Entities, Entity(e))
 	}
-	return false
+	if shared.Draft != nil {
+		draft := DraftContent(*shared.Draft)
+		result.Draft = &draft
+	}
+	return result, resp, nil
 }
 
-func (s *AIService) parseAutoProcessResponse(content string, result *AIProcessResult) error {
-	// Extract JSON from response (handle markdown code blocks)
-	content = strings.TrimSpace(content)
-	if strings.HasPrefix(content, "```") {
-		// Remove markdown code block
-		re := regexp.MustCompile("```(?:json)?\\s*([\\s\\S]*?)\\s*```")
-		matches := re.FindStringSubmatch(content)
-		if len(matches) > 1 {
-			content = matches[1]
-		}
+// CleanEmailBody rewrites a forwarded email body into a concise task
+// description. Counts against the clean_description allowance.
+func (s *AIService) CleanEmailBody(ctx context.Context, userID uuid.UUID, subject, body string) (string, error) {
+	if s.llm == nil {
+		return "", fmt.Errorf("AI service not available")
 	}
 
-	var parsed struct {
-		CleanedTitle   string   `json:"cleaned_title"`
-		Summary        string   `json:"summary"`
-		DueDate        string   `json:"due_date"`
-		ReminderTime   string   `json:"reminder_time"`
-		Complexity     int      `json:"complexity"`
-		Entities       []Entity `json:"entities"`
-		RecurrenceRule string   `json:"recurrence_rule"`
-		SuggestedGroup string   `json:"suggested_group"`
-		Draft          *DraftContent `json:"draft"`
+	canUse, _ := s.CheckAndIncrementUsage(ctx, userID, FeatureCleanDescription)
+	if !canUse {
+		return "", fmt.Errorf("daily limit reached for %s", FeatureCleanDescription)
 	}
 
-	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
-		return fmt.Errorf("failed to parse AI response: %w", err)
-	}
+	return s.cleanEmailBody(ctx, userID, prompts.For(ctx, prompts.EmailCleanup, userID), "email_cleanup", subject, body)
+}
 
-	if parsed.CleanedTitle != "" {
-		// Post-process: remove trailing period (not suitable for todo list titles)
-		cleanedTitle := strings.TrimSuffix(parsed.CleanedTitle, ".")
-		result.CleanedTitle = &cleanedTitle
-	}
-	if parsed.Summary != "" {
-		result.Summary = &parsed.Summary
-	}
-	if parsed.DueDate != "" {
-		if t, err := time.Parse(time.RFC3339, parsed.DueDate); err == nil {
-			result.DueAt = &t
-			// RFC3339 format includes time, so HasDueTime = true
-			result.HasDueTime = true
-		} else if t, err := time.Parse("2006-01-02", parsed.DueDate); err == nil {
-			result.DueAt = &t
-			// Date-only format, so HasDueTime = false
-			result.HasDueTime = false
-		}
-	}
-	if parsed.ReminderTime != "" {
-		if t, err := time.Parse(time.RFC3339, parsed.ReminderTime); err == nil {
-			result.ReminderTime = &t
-		}
-	}
-	if parsed.Complexity > 0 {
-		result.Complexity = &parsed.Complexity
-	}
-	if len(parsed.Entities) > 0 {
-		result.Entities = parsed.Entities
-	}
-	if parsed.RecurrenceRule != "" {
-		result.RecurrenceRule = &parsed.RecurrenceRule
-	}
-	if parsed.SuggestedGroup != "" {
-		result.SuggestedGroup = &parsed.SuggestedGroup
-	}
-	if parsed.Draft != nil {
-		result.Draft = parsed.Draft
+func (s *AIService) cleanEmailBody(ctx context.Context, userID uuid.UUID, version *prompts.Version, feature, subject, body string) (string, error) {
+	instruction := version.Get("email_cleanup_instruction",
+		"Rewrite this email as a concise task description. Keep every actionable detail (what, who, when, where, links, numbers). "+
+			"Remove greetings, signatures, legal disclaimers, tracking text and quoted history.")
+
+	prompt := fmt.Sprintf(`%s
+
+Subject: %s
+
+Email:
+%s
+
+Return ONLY the description text, no preamble or markdown.`, instruction, subject, body)
+
+	resp, err := s.llm.Complete(ctx, llm.CompletionRequest{
+		Messages: []llm.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:     600,
+		Temperature:   0.2,
+		Feature:       feature,
+		UserID:        userID,
+		PromptVersion: version.VersionID(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("AI email cleanup failed: %w", err)
 	}
 
-	return nil
+	return strings.TrimSpace(resp.Content), nil
 }
 
 func (s *AIService) trackAutoProcessUsage(ctx context.Context, userID uuid.UUID, tier UserTier, result *AIProcessResult) {
@@ -487,9 +369,13 @@ func (s *AIService) Decompose(ctx context.Context, userID uuid.UUID, title, desc
 		return nil, fmt.Errorf("daily limit reached for decompose feature")
 	}
 
+	return s.decompose(ctx, userID, prompts.For(ctx, prompts.Decompose, userID), string(FeatureDecompose), title, description)
+}
+
+func (s *AIService) decompose(ctx context.Context, userID uuid.UUID, version *prompts.Version, feature, title, description string) ([]TaskStep, error) {
 	// Get configurable decompose settings
-	stepCount := s.getConfig("decompose_step_count", "3-5")
-	decomposeRules := s.getConfig("decompose_rules", `Each step should be a single, concrete action
+	stepCount := version.Get("decompose_step_count", "3-5")
+	decomposeRules := version.Get("decompose_rules", `Each step should be a single, concrete action
 Steps should be in logical order
 Use action verbs (Call, Send, Research, Write, etc.)
 Keep each step under 10 words`)
@@ -510,14 +396,14 @@ Keep each step under 10 words`)
 	}
 
 	// First attempt
-	steps, err := s.decomposeWithPrompt(ctx, title, descPart, stepCount, formattedRules, false)
+	steps, err := s.decomposeWithPrompt(ctx, userID, version, feature, title, descPart, stepCount, formattedRules, false)
 	if err != nil {
 		return nil, err
 	}
 
 	// Post-process: if more than 5 steps, retry with strict MAX = 5
 	if len(steps) > 5 {
-		steps, err = s.decomposeWithPrompt(ctx, title, descPart, "exactly 5", formattedRules, true)
+		steps, err = s.decomposeWithPrompt(ctx, userID, version, feature, title, descPart, "exactly 5", formattedRules, true)
 		if err != nil {
 			return nil, err
 		}
@@ -531,7 +417,7 @@ Keep each step under 10 words`)
 }
 
 // decomposeWithPrompt is a helper that calls the LLM with the decompose prompt
-func (s *AIService) decomposeWithPrompt(ctx context.Context, title, descPart, stepCount, formattedRules string, strict bool) ([]TaskStep, error) {
+func (s *AIService) decomposeWithPrompt(ctx context.Context, userID uuid.UUID, version *prompts.Version, feature, title, descPart, stepCount, formattedRules string, strict bool) ([]TaskStep, error) {
 	strictNote := ""
 	if strict {
 		strictNote = "\n\nIMPORTANT: You MUST return MAXIMUM 5 steps. No more than 5. Combine steps if needed."
@@ -555,26 +441,20 @@ Rules:
 		Messages: []llm.Message{
 			{Role: "user", Content: prompt},
 		},
-		MaxTokens:   500,
-		Temperature: 0.3,
+		MaxTokens:     500,
+		Temperature:   0.3,
+		Feature:       feature,
+		UserID:        userID,
+		PromptVersion: version.VersionID(),
+		Schema:        llmschema.Steps(),
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("AI decompose failed: %w", err)
 	}
 
-	// Parse response
-	content := strings.TrimSpace(resp.Content)
-	if strings.HasPrefix(content, "```") {
-		re := regexp.MustCompile("```(?:json)?\\s*([\\s\\S]*?)\\s*```")
-		matches := re.FindStringSubmatch(content)
-		if len(matches) > 1 {
-			content = matches[1]
-		}
-	}
-
 	var steps []TaskStep
-	if err := json.Unmarshal([]byte(content), &steps); err != nil {
+	if err := json.Unmarshal([]byte(resp.Content), &steps); err != nil {
 		return nil, fmt.Errorf("failed to parse steps: %w", err)
 	}
 
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/tasks"
+)
+
+func main() {
+	// Setup logging
+	zerolog.TimeFieldFormat = time.RFC3339
+	if os.Getenv("ENVIRONMENT") != "production" {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
+
+	workers := flag.Int("workers", 0, "number of workers (default AI_QUEUE_WORKERS, or 4)")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadForService("tasks")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+
+	// The API usually runs with AI_QUEUE_WORKERS=0 when this process is
+	// deployed, so fall back to a sensible pool size rather than none
+	if *workers == 0 {
+		*workers = cfg.LLM.QueueWorkers
+	}
+	if *workers == 0 {
+		*workers = 4
+	}
+
+	log.Info().
+		Str("environment", cfg.Server.Environment).
+		Int("workers", *workers).
+		Msg("Starting ai-worker")
+
+	worker, err := tasks.NewWorker(cfg, *workers)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create worker")
+	}
+	worker.Start()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info().Msg("Shutting down ai-worker...")
+
+	// Let running jobs finish; unfinished ones are retried after their lease
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := worker.ShutdownWithContext(ctx); err != nil {
+		log.Error().Err(err).Msg("Worker shutdown error")
+	}
+
+	log.Info().Msg("Worker stopped")
+}
@@ -0,0 +1,8 @@
+DROP VIEW IF EXISTS shared_task_access;
+DROP TABLE IF EXISTS task_activity;
+DROP INDEX IF EXISTS idx_tasks_assignee;
+ALTER TABLE tasks DROP COLUMN IF EXISTS assignee_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS last_modified_by;
+ALTER TABLE tasks DROP COLUMN IF EXISTS created_by;
+DROP TABLE IF EXISTS task_share_members;
+DROP TABLE IF EXISTS task_shares;
@@ -0,0 +1,73 @@
+-- Sharing a hashtag list or a single parent task with other users
+
+-- A share belongs to the owner of the tasks it exposes
+CREATE TABLE task_shares (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    owner_id UUID NOT NULL,
+    share_type VARCHAR(10) NOT NULL CHECK (share_type IN ('list', 'task')),
+    list_tag VARCHAR(255),                -- e.g. "#Groceries" (also covers "#Groceries/...")
+    task_id UUID REFERENCES tasks(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT valid_share_target CHECK (
+        (share_type = 'list' AND list_tag IS NOT NULL AND task_id IS NULL) OR
+        (share_type = 'task' AND task_id IS NOT NULL AND list_tag IS NULL)
+    )
+);
+
+-- One share per list / task, members are added to it
+CREATE UNIQUE INDEX idx_task_shares_list ON task_shares(owner_id, LOWER(list_tag)) WHERE share_type = 'list';
+CREATE UNIQUE INDEX idx_task_shares_task ON task_shares(task_id) WHERE share_type = 'task';
+
+-- Invited participants. user_id stays NULL until the invitee has an account.
+CREATE TABLE task_share_members (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    share_id UUID NOT NULL REFERENCES task_shares(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    user_id UUID,
+    role VARCHAR(10) NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'editor')),
+    invited_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE(share_id, email)
+);
+
+CREATE INDEX idx_task_share_members_user ON task_share_members(user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX idx_task_share_members_pending ON task_share_members(LOWER(email)) WHERE user_id IS NULL;
+
+-- Attribution and assignment on tasks
+ALTER TABLE tasks ADD COLUMN created_by UUID;
+ALTER TABLE tasks ADD COLUMN last_modified_by UUID;
+ALTER TABLE tasks ADD COLUMN assignee_id UUID;
+
+CREATE INDEX idx_tasks_assignee ON tasks(assignee_id) WHERE assignee_id IS NOT NULL AND deleted_at IS NULL;
+
+-- Change history of shared tasks (who did what)
+CREATE TABLE task_activity (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    action VARCHAR(20) NOT NULL,          -- created, updated, completed, uncompleted, deleted
+    changes JSONB NOT NULL DEFAULT '[]',  -- names of the fields that changed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_task_activity_task ON task_activity(task_id, created_at DESC);
+
+-- Every (task, member) pair reachable through a share, with the member's role.
+-- A task share covers the parent and its subtasks; a list share covers root
+-- tasks tagged with the list (or one of its sublists) and their subtasks.
+-- Deleted tasks are kept so sync can report their deletion to members.
+CREATE VIEW shared_task_access AS
+SELECT t.id AS task_id, m.user_id, m.role, s.id AS share_id, s.owner_id
+FROM task_shares s
+JOIN task_share_members m ON m.share_id = s.id AND m.user_id IS NOT NULL
+JOIN tasks t ON t.user_id = s.owner_id
+WHERE (s.share_type = 'task' AND (t.id = s.task_id OR t.parent_id = s.task_id))
+   OR (s.share_type = 'list' AND EXISTS (
+        SELECT 1
+        FROM tasks root, UNNEST(root.tags) AS tag
+        WHERE root.id = COALESCE(t.parent_id, t.id)
+          AND (LOWER(tag) = LOWER(s.list_tag) OR LOWER(tag) LIKE LOWER(s.list_tag) || '/%')
+   ));
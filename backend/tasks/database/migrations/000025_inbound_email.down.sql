@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS inbound_email_messages;
+DROP TABLE IF EXISTS inbound_email_addresses;
@@ -0,0 +1,29 @@
+-- Inbound email-to-task gateway
+
+-- One forwarding address per user: <token>@<INBOUND_EMAIL_DOMAIN>
+CREATE TABLE inbound_email_addresses (
+    user_id UUID PRIMARY KEY,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    allowed_senders TEXT[] NOT NULL DEFAULT '{}', -- addresses or "@domain"; the account email is always allowed
+    ai_cleanup BOOLEAN NOT NULL DEFAULT false,     -- run the email body through AI cleanup
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Log of received messages, also used to deduplicate by Message-ID
+CREATE TABLE inbound_email_messages (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    message_id TEXT NOT NULL,
+    sender VARCHAR(255) NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL CHECK (status IN ('created', 'rejected')),
+    reason TEXT,
+    task_id UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A Message-ID only ever creates one task per user; rejections don't count
+CREATE UNIQUE INDEX idx_inbound_messages_dedupe ON inbound_email_messages(user_id, message_id) WHERE status = 'created';
+CREATE INDEX idx_inbound_messages_user ON inbound_email_messages(user_id, received_at DESC);
@@ -0,0 +1,20 @@
+-- Task templates: reusable checklists with {{variables}} and relative due dates
+
+CREATE TABLE task_templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    priority INTEGER NOT NULL DEFAULT 0,
+    due_offset_days INTEGER,                     -- days after the anchor date; NULL = no due date
+    due_time VARCHAR(5),                         -- 'HH:MM'; NULL = all-day
+    subtasks JSONB NOT NULL DEFAULT '[]',        -- ordered [{title, description, priority, due_offset_days, due_time}]
+    share_token VARCHAR(64) UNIQUE,              -- set while the template is shared by link
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_task_templates_user ON task_templates(user_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tasks_display_title_trgm;
+-- pg_trgm is left installed; other objects may depend on it
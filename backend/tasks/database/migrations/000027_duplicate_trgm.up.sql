@@ -0,0 +1,6 @@
+-- Local candidate retrieval for duplicate detection (trigram similarity on the display title)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_display_title_trgm ON tasks
+    USING GIN (LOWER(COALESCE(NULLIF(ai_cleaned_title, ''), title)) gin_trgm_ops)
+    WHERE deleted_at IS NULL;
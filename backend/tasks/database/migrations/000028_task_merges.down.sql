@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_merges;
+ALTER TABLE tasks DROP COLUMN IF EXISTS merged_into;
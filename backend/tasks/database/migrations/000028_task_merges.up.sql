@@ -0,0 +1,18 @@
+-- Merging duplicate tasks: the merged-away task is soft-deleted and points to
+-- the task it was merged into; task_merges keeps what is needed to undo it
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS merged_into UUID;
+
+CREATE TABLE task_merges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,                 -- owner of both tasks
+    canonical_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    merged_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    merged_title TEXT NOT NULL,            -- shown in the canonical task's history
+    merged_by UUID NOT NULL,
+    snapshot JSONB NOT NULL,               -- previous state of everything the merge changed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    undone_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_task_merges_canonical ON task_merges(canonical_id, created_at DESC);
@@ -0,0 +1,5 @@
+-- ai_entities was never modified, so dropping the directory loses no mentions
+DROP TABLE IF EXISTS task_entities;
+DROP INDEX IF EXISTS idx_entity_aliases_entity;
+ALTER TABLE entity_aliases DROP COLUMN IF EXISTS entity_id;
+DROP TABLE IF EXISTS entities;
@@ -0,0 +1,89 @@
+-- Entity directory: people, places and organizations as records per user.
+-- Other extracted types (dates, emails, phones) stay plain mentions.
+-- tasks.ai_entities stays as written by the AI; task_entities links each
+-- mention to its canonical entity, keeping the value exactly as mentioned.
+
+CREATE TABLE entities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,   -- 'person', 'location', 'organization', ...
+    name TEXT NOT NULL,                 -- canonical name
+    notes TEXT,
+    email VARCHAR(255),
+    phone VARCHAR(50),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_entities_name ON entities(user_id, entity_type, LOWER(name));
+
+-- Aliases now point at an entity; canonical_value mirrors the entity name
+ALTER TABLE entity_aliases ADD COLUMN entity_id UUID REFERENCES entities(id) ON DELETE CASCADE;
+CREATE INDEX idx_entity_aliases_entity ON entity_aliases(entity_id);
+
+CREATE TABLE task_entities (
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    entity_id UUID NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    value TEXT NOT NULL,                -- the mention as it appears in ai_entities
+    PRIMARY KEY (task_id, entity_id, value)
+);
+
+CREATE INDEX idx_task_entities_entity ON task_entities(entity_id);
+
+-- =====================================================
+-- Backfill from ai_entities and entity_aliases
+-- =====================================================
+
+-- 1. Alias targets become entities (even if no task mentions them directly)
+INSERT INTO entities (user_id, entity_type, name, created_at)
+SELECT DISTINCT ON (user_id, entity_type, LOWER(TRIM(canonical_value)))
+       user_id, entity_type, TRIM(canonical_value), COALESCE(created_at, NOW())
+FROM entity_aliases
+WHERE TRIM(canonical_value) != ''
+  AND entity_type IN ('person', 'location', 'organization')
+ORDER BY user_id, entity_type, LOWER(TRIM(canonical_value)), created_at
+ON CONFLICT DO NOTHING;
+
+-- 2. Every other distinct mention becomes an entity (earliest spelling wins)
+INSERT INTO entities (user_id, entity_type, name, created_at)
+SELECT DISTINCT ON (t.user_id, e->>'type', LOWER(TRIM(e->>'value')))
+       t.user_id, e->>'type', TRIM(e->>'value'), t.created_at
+FROM tasks t
+CROSS JOIN LATERAL jsonb_array_elements(
+    CASE WHEN jsonb_typeof(t.ai_entities) = 'array' THEN t.ai_entities ELSE '[]'::jsonb END
+) e
+WHERE e->>'type' IN ('person', 'location', 'organization')
+  AND COALESCE(TRIM(e->>'value'), '') != ''
+  AND NOT EXISTS (
+    SELECT 1 FROM entity_aliases a
+    WHERE a.user_id = t.user_id AND a.entity_type = e->>'type'
+      AND LOWER(TRIM(a.alias_value)) = LOWER(TRIM(e->>'value'))
+  )
+ORDER BY t.user_id, e->>'type', LOWER(TRIM(e->>'value')), t.created_at
+ON CONFLICT DO NOTHING;
+
+-- 3. Link aliases to their entity
+UPDATE entity_aliases a
+SET entity_id = en.id
+FROM entities en
+WHERE en.user_id = a.user_id
+  AND en.entity_type = a.entity_type
+  AND LOWER(en.name) = LOWER(TRIM(a.canonical_value));
+
+-- 4. Link every mention (including deleted tasks) to its entity
+INSERT INTO task_entities (task_id, entity_id, value)
+SELECT t.id, COALESCE(a.entity_id, en.id), TRIM(e->>'value')
+FROM tasks t
+CROSS JOIN LATERAL jsonb_array_elements(
+    CASE WHEN jsonb_typeof(t.ai_entities) = 'array' THEN t.ai_entities ELSE '[]'::jsonb END
+) e
+LEFT JOIN entity_aliases a
+    ON a.user_id = t.user_id AND a.entity_type = e->>'type'
+   AND LOWER(TRIM(a.alias_value)) = LOWER(TRIM(e->>'value'))
+LEFT JOIN entities en
+    ON en.user_id = t.user_id AND en.entity_type = e->>'type'
+   AND LOWER(en.name) = LOWER(TRIM(e->>'value'))
+WHERE e->>'type' IN ('person', 'location', 'organization')
+  AND COALESCE(TRIM(e->>'value'), '') != ''
+  AND COALESCE(a.entity_id, en.id) IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_ai_drafts_message;
+ALTER TABLE ai_drafts DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE ai_drafts DROP COLUMN IF EXISTS error;
+ALTER TABLE ai_drafts DROP COLUMN IF EXISTS recipients;
+ALTER TABLE ai_drafts DROP COLUMN IF EXISTS provider_message_id;
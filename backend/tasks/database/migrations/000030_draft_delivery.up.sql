@@ -0,0 +1,9 @@
+-- Delivery tracking for approved AI drafts.
+-- status: draft, approved, sending, sent, failed, bounced, cancelled
+ALTER TABLE ai_drafts ADD COLUMN provider_message_id VARCHAR(100);
+ALTER TABLE ai_drafts ADD COLUMN recipients TEXT[];
+ALTER TABLE ai_drafts ADD COLUMN error TEXT;
+ALTER TABLE ai_drafts ADD COLUMN updated_at TIMESTAMPTZ DEFAULT NOW();
+
+-- Bounce events from the email provider are matched by message ID
+CREATE UNIQUE INDEX idx_ai_drafts_message ON ai_drafts(provider_message_id) WHERE provider_message_id IS NOT NULL;
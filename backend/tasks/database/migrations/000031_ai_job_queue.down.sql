@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_ai_queue_task_pending;
+DROP INDEX IF EXISTS idx_ai_queue_status;
+DROP INDEX IF EXISTS idx_ai_queue_leases;
+DROP INDEX IF EXISTS idx_ai_queue_pending;
+CREATE INDEX idx_ai_queue_status ON ai_processing_queue(status) WHERE status = 'pending';
+
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS leased_until;
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS lease_owner;
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS run_after;
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS max_attempts;
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS attempts;
+ALTER TABLE ai_processing_queue DROP COLUMN IF EXISTS source;
+
+UPDATE ai_processing_queue SET status = 'failed' WHERE status = 'dead';
@@ -0,0 +1,20 @@
+-- Turn ai_processing_queue into a durable job queue for AI auto-processing.
+-- status: pending (waiting or scheduled for retry), processing (leased by a
+-- worker), completed, dead (out of attempts; replayable by an admin)
+UPDATE ai_processing_queue SET status = 'dead' WHERE status = 'failed';
+
+ALTER TABLE ai_processing_queue ADD COLUMN source VARCHAR(30) NOT NULL DEFAULT 'create';
+ALTER TABLE ai_processing_queue ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE ai_processing_queue ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 5;
+ALTER TABLE ai_processing_queue ADD COLUMN run_after TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE ai_processing_queue ADD COLUMN lease_owner VARCHAR(100);
+ALTER TABLE ai_processing_queue ADD COLUMN leased_until TIMESTAMPTZ;
+ALTER TABLE ai_processing_queue ADD COLUMN updated_at TIMESTAMPTZ DEFAULT NOW();
+
+DROP INDEX IF EXISTS idx_ai_queue_status;
+CREATE INDEX idx_ai_queue_pending ON ai_processing_queue(run_after) WHERE status = 'pending';
+CREATE INDEX idx_ai_queue_leases ON ai_processing_queue(user_id, leased_until) WHERE status = 'processing';
+CREATE INDEX idx_ai_queue_status ON ai_processing_queue(status, created_at DESC);
+
+-- One waiting job per task; enqueueing again while one waits is a no-op
+CREATE UNIQUE INDEX idx_ai_queue_task_pending ON ai_processing_queue(task_id) WHERE status = 'pending';
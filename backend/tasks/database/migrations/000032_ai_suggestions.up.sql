@@ -0,0 +1,18 @@
+-- AI output held for review instead of being written onto the task
+-- (fields whose AI preference is "review"), one row per task field.
+CREATE TABLE ai_suggestions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    field VARCHAR(20) NOT NULL, -- title, description, due_at, complexity, entities
+    value JSONB NOT NULL, -- Suggested value
+    previous_value JSONB, -- The task's value when suggested (context for rejections)
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, accepted, rejected, superseded
+    feedback TEXT, -- Optional reason given with a rejection
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_ai_suggestions_pending ON ai_suggestions(task_id, field) WHERE status = 'pending';
+CREATE INDEX idx_ai_suggestions_user ON ai_suggestions(user_id, created_at DESC) WHERE status = 'pending';
+CREATE INDEX idx_ai_suggestions_rejected ON ai_suggestions(user_id, resolved_at DESC) WHERE status = 'rejected';
@@ -0,0 +1,7 @@
+-- Per-user overrides of the /tasks/next scoring weights, merged onto the
+-- defaults (factor name -> weight, e.g. {"due_soon": 6}).
+CREATE TABLE task_ranking_weights (
+    user_id UUID PRIMARY KEY,
+    weights JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
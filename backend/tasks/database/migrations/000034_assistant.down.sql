@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS assistant_messages;
+DROP TABLE IF EXISTS assistant_conversations;
+-- ai_feature values can't be dropped; the extra ones are harmless
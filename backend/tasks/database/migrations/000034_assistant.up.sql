@@ -0,0 +1,31 @@
+-- Conversations with the AI task assistant. History is replayed to the model
+-- on each turn; a tool call that needs the user's confirmation waits in
+-- pending_action until it is approved or declined.
+CREATE TABLE assistant_conversations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    title VARCHAR(200) NOT NULL DEFAULT '',
+    pending_action JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_assistant_conversations_user ON assistant_conversations(user_id, updated_at DESC);
+
+CREATE TABLE assistant_messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES assistant_conversations(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL,   -- user, assistant, tool
+    content TEXT NOT NULL DEFAULT '',
+    tool_calls JSONB,            -- assistant: the tools it called
+    tool_call_id VARCHAR(100),   -- tool: the call this result answers
+    tool_name VARCHAR(100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_assistant_messages_conversation ON assistant_messages(conversation_id, id);
+
+-- Features metered since ai_feature was created
+ALTER TYPE ai_feature ADD VALUE IF NOT EXISTS 'duplicate_check';
+ALTER TYPE ai_feature ADD VALUE IF NOT EXISTS 'day_plan';
+ALTER TYPE ai_feature ADD VALUE IF NOT EXISTS 'assistant';
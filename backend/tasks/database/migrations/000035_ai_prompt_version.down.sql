@@ -0,0 +1,2 @@
+ALTER TABLE ai_suggestions DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE tasks DROP COLUMN IF EXISTS ai_prompt_version;
@@ -0,0 +1,4 @@
+-- The prompt version (shared ai_prompt_versions) behind a task's applied AI
+-- changes and behind each suggestion, so user reactions can be attributed
+ALTER TABLE tasks ADD COLUMN ai_prompt_version UUID;
+ALTER TABLE ai_suggestions ADD COLUMN prompt_version UUID;
@@ -0,0 +1,2 @@
+-- The vector extension is left installed; other objects may use it
+DROP TABLE IF EXISTS task_embeddings;
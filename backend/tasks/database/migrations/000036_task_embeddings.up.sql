@@ -0,0 +1,30 @@
+-- pgvector, where the server has it, lets nearest-neighbour search run in
+-- the database; without it the API ranks vectors in process. Managed
+-- databases may refuse CREATE EXTENSION to the app role, which is fine.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+        CREATE EXTENSION IF NOT EXISTS vector;
+    END IF;
+EXCEPTION WHEN insufficient_privilege THEN
+    RAISE NOTICE 'pgvector not enabled: %', SQLERRM;
+END
+$$;
+
+-- One embedding per task of its title and description. Stored as REAL[]
+-- so the table works with or without pgvector (which casts it to vector);
+-- model is "provider/model", since vectors of different models can't be
+-- compared. content_hash and task_updated_at tell the refresher which
+-- tasks changed since they were embedded.
+CREATE TABLE task_embeddings (
+    task_id UUID PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    content_hash VARCHAR(32) NOT NULL, -- md5 of title, newline, description
+    embedding REAL[] NOT NULL,
+    task_updated_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_task_embeddings_user_model ON task_embeddings(user_id, model);
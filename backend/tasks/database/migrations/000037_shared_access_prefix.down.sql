@@ -0,0 +1,12 @@
+CREATE OR REPLACE VIEW shared_task_access AS
+SELECT t.id AS task_id, m.user_id, m.role, s.id AS share_id, s.owner_id
+FROM task_shares s
+JOIN task_share_members m ON m.share_id = s.id AND m.user_id IS NOT NULL
+JOIN tasks t ON t.user_id = s.owner_id
+WHERE (s.share_type = 'task' AND (t.id = s.task_id OR t.parent_id = s.task_id))
+   OR (s.share_type = 'list' AND EXISTS (
+        SELECT 1
+        FROM tasks root, UNNEST(root.tags) AS tag
+        WHERE root.id = COALESCE(t.parent_id, t.id)
+          AND (LOWER(tag) = LOWER(s.list_tag) OR LOWER(tag) LIKE LOWER(s.list_tag) || '/%')
+   ));
@@ -0,0 +1,11 @@
+-- Tasks a participant could see through a share and no longer can (member
+-- or share removed, list hashtag dropped). Sync returns them as deletes so
+-- the participant's devices drop their copies.
+CREATE TABLE task_access_revocations (
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (task_id, user_id)
+);
+
+CREATE INDEX idx_task_access_revocations_user ON task_access_revocations(user_id, revoked_at);
@@ -0,0 +1,881 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// EntityHandler handles the entity directory: canonical people, places and
+// organizations that tasks are linked to through their extracted entities
+type EntityHandler struct {
+	db *pgxpool.Pool
+}
+
+// NewEntityHandler creates a new entity handler
+func NewEntityHandler(db *pgxpool.Pool) *EntityHandler {
+	return &EntityHandler{db: db}
+}
+
+// EntityRequest creates or updates a directory entity. On update, omitted
+// fields are left unchanged and an empty string clears notes, email or phone.
+type EntityRequest struct {
+	Type    string   `json:"type,omitempty"` // person, location or organization (create only)
+	Name    *string  `json:"name,omitempty"`
+	Notes   *string  `json:"notes,omitempty"`
+	Email   *string  `json:"email,omitempty"`
+	Phone   *string  `json:"phone,omitempty"`
+	Aliases []string `json:"aliases,omitempty"` // create only; use the alias endpoints afterwards
+}
+
+// EntityResponse represents an entity in API responses
+type EntityResponse struct {
+	models.Entity
+	OpenCount      int `json:"open_count"`
+	CompletedCount int `json:"completed_count"`
+}
+
+// EntityDetailResponse is an entity with the tasks linked to it
+type EntityDetailResponse struct {
+	EntityResponse
+	OpenTasks      []TaskResponse `json:"open_tasks"`
+	CompletedTasks []TaskResponse `json:"completed_tasks"`
+}
+
+// entityColumns is the select list scanned by scanEntity; en is the entities
+// alias and the counts only cover the owner's non-deleted tasks
+const entityColumns = `en.id, en.user_id, en.entity_type, en.name, en.notes, en.email, en.phone,
+	en.created_at, en.updated_at,
+	COALESCE(ARRAY(SELECT a.alias_value FROM entity_aliases a WHERE a.entity_id = en.id ORDER BY a.alias_value), '{}'),
+	(SELECT COUNT(DISTINCT t.id) FROM task_entities te JOIN tasks t ON t.id = te.task_id
+	 WHERE te.entity_id = en.id AND t.deleted_at IS NULL AND t.status NOT IN ('completed', 'cancelled')),
+	(SELECT COUNT(DISTINCT t.id) FROM task_entities te JOIN tasks t ON t.id = te.task_id
+	 WHERE te.entity_id = en.id AND t.deleted_at IS NULL AND t.status = 'completed')`
+
+func scanEntity(row pgx.Row) (*EntityResponse, error) {
+	var e EntityResponse
+	err := row.Scan(
+		&e.ID, &e.UserID, &e.Type, &e.Name, &e.Notes, &e.Email, &e.Phone,
+		&e.CreatedAt, &e.UpdatedAt, &e.Aliases, &e.OpenCount, &e.CompletedCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the user's entities, most linked first
+// GET /entities?type=person&q=nam
+func (h *EntityHandler) List(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	query := `SELECT ` + entityColumns + ` FROM entities en WHERE en.user_id = $1`
+	args := []any{userID}
+	if entityType := c.Query("type"); entityType != "" {
+		args = append(args, entityType)
+		query += ` AND en.entity_type = $2`
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		args = append(args, q)
+		n := "$" + strconv.Itoa(len(args))
+		query += ` AND (en.name ILIKE '%' || ` + n + ` || '%' OR EXISTS (
+			SELECT 1 FROM entity_aliases a WHERE a.entity_id = en.id AND a.alias_value ILIKE '%' || ` + n + ` || '%'))`
+	}
+	query += ` ORDER BY (SELECT COUNT(*) FROM task_entities te WHERE te.entity_id = en.id) DESC, en.name`
+
+	rows, err := h.db.Query(c.Context(), query, args...)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	entities := make([]EntityResponse, 0)
+	for rows.Next() {
+		e, err := scanEntity(rows)
+		if err != nil {
+			continue
+		}
+		entities = append(entities, *e)
+	}
+
+	return httputil.Success(c, entities)
+}
+
+// Get returns an entity with its open and completed tasks
+// GET /entities/:id
+func (h *EntityHandler) Get(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	entity, err := h.ownEntity(c)
+	if err != nil {
+		return err
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
+		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
+		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
+		 FROM tasks t
+		 WHERE t.user_id = $1 AND t.deleted_at IS NULL AND t.status != 'cancelled'
+		   AND EXISTS (SELECT 1 FROM task_entities te WHERE te.task_id = t.id AND te.entity_id = $2)
+		 ORDER BY t.completed_at DESC NULLS FIRST, t.due_at ASC NULLS LAST, t.created_at DESC`,
+		userID, entity.ID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	detail := EntityDetailResponse{
+		EntityResponse: *entity,
+		OpenTasks:      make([]TaskResponse, 0),
+		CompletedTasks: make([]TaskResponse, 0),
+	}
+	for rows.Next() {
+		task, childCount, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		if task.Status == "completed" {
+			detail.CompletedTasks = append(detail.CompletedTasks, toTaskResponse(task, childCount))
+		} else {
+			detail.OpenTasks = append(detail.OpenTasks, toTaskResponse(task, childCount))
+		}
+	}
+
+	return httputil.Success(c, detail)
+}
+
+// Create adds an entity to the directory, optionally with aliases.
+// Tasks already mentioning the name or an alias are linked to it.
+// POST /entities
+func (h *EntityHandler) Create(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req EntityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	fields := req.validate(true)
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+	name := strings.TrimSpace(*req.Name)
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	if taken, err := h.nameTaken(c.Context(), tx, userID, req.Type, name, uuid.Nil); err != nil {
+		return httputil.InternalError(c, "database error")
+	} else if taken {
+		return httputil.Conflict(c, "an entity with this name or alias already exists")
+	}
+
+	var entityID uuid.UUID
+	err = tx.QueryRow(c.Context(),
+		`INSERT INTO entities (user_id, entity_type, name, notes, email, phone)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id`,
+		userID, req.Type, name, emptyToNil(req.Notes), emptyToNil(req.Email), emptyToNil(req.Phone),
+	).Scan(&entityID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to create entity")
+	}
+
+	values := []string{name}
+	for _, alias := range req.Aliases {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || strings.EqualFold(alias, name) {
+			continue
+		}
+		if conflict, err := addAlias(c.Context(), tx, userID, req.Type, alias, name, entityID); err != nil {
+			return httputil.InternalError(c, "failed to add alias")
+		} else if conflict {
+			return httputil.Conflict(c, "'"+alias+"' is already an alias of another entity")
+		}
+		values = append(values, alias)
+	}
+
+	if err := relinkMentions(c.Context(), tx, userID, req.Type, values); err != nil {
+		return httputil.InternalError(c, "failed to link tasks")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to create entity")
+	}
+
+	entity, err := scanEntity(h.db.QueryRow(c.Context(),
+		`SELECT `+entityColumns+` FROM entities en WHERE en.id = $1`, entityID))
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	return httputil.Created(c, entity)
+}
+
+// Update edits an entity. Renaming keeps the old name as an alias, so tasks
+// that mention it stay linked.
+// PUT /entities/:id
+func (h *EntityHandler) Update(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	entity, err := h.ownEntity(c)
+	if err != nil {
+		return err
+	}
+
+	var req EntityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	fields := req.validate(false)
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) != entity.Name {
+		name := strings.TrimSpace(*req.Name)
+		if taken, err := h.nameTaken(c.Context(), tx, userID, entity.Type, name, entity.ID); err != nil {
+			return httputil.InternalError(c, "database error")
+		} else if taken {
+			return httputil.Conflict(c, "another entity already uses this name; merge the entities instead")
+		}
+
+		// The new name may have been one of this entity's aliases
+		_, err = tx.Exec(c.Context(),
+			`DELETE FROM entity_aliases WHERE entity_id = $1 AND LOWER(alias_value) = LOWER($2)`,
+			entity.ID, name,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to rename entity")
+		}
+		_, err = tx.Exec(c.Context(),
+			"UPDATE entity_aliases SET canonical_value = $1 WHERE entity_id = $2",
+			name, entity.ID,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to rename entity")
+		}
+		if !strings.EqualFold(name, entity.Name) {
+			if err := upsertAlias(c.Context(), tx, userID, entity.Type, entity.Name, name, entity.ID); err != nil {
+				return httputil.InternalError(c, "failed to rename entity")
+			}
+		}
+		entity.Name = name
+	}
+	if req.Notes != nil {
+		entity.Notes = emptyToNil(req.Notes)
+	}
+	if req.Email != nil {
+		entity.Email = emptyToNil(req.Email)
+	}
+	if req.Phone != nil {
+		entity.Phone = emptyToNil(req.Phone)
+	}
+
+	_, err = tx.Exec(c.Context(),
+		`UPDATE entities SET name = $1, notes = $2, email = $3, phone = $4, updated_at = NOW()
+		 WHERE id = $5 AND user_id = $6`,
+		entity.Name, entity.Notes, entity.Email, entity.Phone, entity.ID, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update entity")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to update entity")
+	}
+
+	updated, err := scanEntity(h.db.QueryRow(c.Context(),
+		`SELECT `+entityColumns+` FROM entities en WHERE en.id = $1`, entity.ID))
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	return httputil.Success(c, updated)
+}
+
+// Delete removes an entity and strips its mentions (name and aliases) from
+// the extracted entities of every task linked to it
+// DELETE /entities/:id
+func (h *EntityHandler) Delete(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	entity, err := h.ownEntity(c)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	values := map[string]bool{strings.ToLower(entity.Name): true}
+	for _, alias := range entity.Aliases {
+		values[strings.ToLower(alias)] = true
+	}
+	rows, err := tx.Query(c.Context(),
+		"SELECT task_id, value FROM task_entities WHERE entity_id = $1", entity.ID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	var taskIDs []uuid.UUID
+	for rows.Next() {
+		var taskID uuid.UUID
+		var value string
+		if err := rows.Scan(&taskID, &value); err != nil {
+			continue
+		}
+		taskIDs = append(taskIDs, taskID)
+		values[strings.ToLower(value)] = true
+	}
+	rows.Close()
+
+	// The entity (and its aliases and links) go first so the stripped tasks
+	// can't be relinked to it
+	_, err = tx.Exec(c.Context(), "DELETE FROM entities WHERE id = $1 AND user_id = $2", entity.ID, userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to delete entity")
+	}
+
+	updatedCount := 0
+	for _, taskID := range taskIDs {
+		changed, err := stripMentions(c.Context(), tx, userID, taskID, entity.Type, values)
+		if err != nil {
+			return httputil.InternalError(c, "failed to update tasks")
+		}
+		if changed {
+			updatedCount++
+		}
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to delete entity")
+	}
+
+	return httputil.Success(c, map[string]interface{}{
+		"deleted":       entity.ID,
+		"updated_count": updatedCount,
+	})
+}
+
+// AddAlias makes another spelling resolve to this entity. An entity already
+// named that way (e.g. created from a task mention) is merged into this one.
+// POST /entities/:id/aliases
+func (h *EntityHandler) AddAlias(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	entity, err := h.ownEntity(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	value := strings.TrimSpace(req.Value)
+	if value == "" || len(value) > models.MaxEntityNameLength {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"value": "alias is required (max 255 characters)",
+		})
+	}
+	if strings.EqualFold(value, entity.Name) {
+		return httputil.BadRequest(c, "alias is the entity's name")
+	}
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	if conflict, err := addAlias(c.Context(), tx, userID, entity.Type, value, entity.Name, entity.ID); err != nil {
+		return httputil.InternalError(c, "failed to add alias")
+	} else if conflict {
+		return httputil.Conflict(c, "'"+value+"' is already an alias of another entity")
+	}
+	if err := relinkMentions(c.Context(), tx, userID, entity.Type, []string{value}); err != nil {
+		return httputil.InternalError(c, "failed to link tasks")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to add alias")
+	}
+
+	return h.Get(c)
+}
+
+// RemoveAlias stops an alias resolving to this entity; tasks mentioning it
+// are relinked to an entity of that name
+// DELETE /entities/:id/aliases/:alias
+func (h *EntityHandler) RemoveAlias(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	entity, err := h.ownEntity(c)
+	if err != nil {
+		return err
+	}
+
+	alias := c.Params("alias")
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	result, err := tx.Exec(c.Context(),
+		"DELETE FROM entity_aliases WHERE entity_id = $1 AND LOWER(alias_value) = LOWER($2)",
+		entity.ID, alias,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to remove alias")
+	}
+	if result.RowsAffected() == 0 {
+		return httputil.NotFound(c, "alias")
+	}
+
+	if err := relinkMentions(c.Context(), tx, userID, entity.Type, []string{alias}); err != nil {
+		return httputil.InternalError(c, "failed to link tasks")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to remove alias")
+	}
+
+	return h.Get(c)
+}
+
+// Merge folds another entity into this one: its name becomes an alias and
+// its aliases and task links move over
+// POST /entities/:id/merge
+func (h *EntityHandler) Merge(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	target, err := h.ownEntity(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		SourceID string `json:"source_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	sourceID, err := uuid.Parse(req.SourceID)
+	if err != nil {
+		return httputil.BadRequest(c, "invalid source ID")
+	}
+	if sourceID == target.ID {
+		return httputil.BadRequest(c, "cannot merge entity with itself")
+	}
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	var sourceType string
+	err = tx.QueryRow(c.Context(),
+		"SELECT entity_type FROM entities WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		sourceID, userID,
+	).Scan(&sourceType)
+	if err == pgx.ErrNoRows {
+		return httputil.NotFound(c, "entity")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	if sourceType != target.Type {
+		return httputil.BadRequest(c, "entities must be of the same type")
+	}
+
+	if err := mergeEntityInto(c.Context(), tx, userID, sourceID, target.ID); err != nil {
+		return httputil.InternalError(c, "failed to merge entities")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to merge entities")
+	}
+
+	return h.Get(c)
+}
+
+// ownEntity loads the entity in :id, which must belong to the current user
+func (h *EntityHandler) ownEntity(c *fiber.Ctx) (*EntityResponse, error) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "unauthorized")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid entity ID")
+	}
+
+	entity, err := scanEntity(h.db.QueryRow(c.Context(),
+		`SELECT `+entityColumns+` FROM entities en WHERE en.id = $1 AND en.user_id = $2`,
+		id, userID,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusNotFound, "entity not found")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "database error")
+	}
+	return entity, nil
+}
+
+// nameTaken reports whether a name is already used by another entity of the
+// type, either as its name or as one of its aliases
+func (h *EntityHandler) nameTaken(ctx context.Context, tx pgx.Tx, userID uuid.UUID, entityType, name string, except uuid.UUID) (bool, error) {
+	var taken bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM entities WHERE user_id = $1 AND entity_type = $2 AND LOWER(name) = LOWER($3) AND id != $4
+		 ) OR EXISTS (
+		   SELECT 1 FROM entity_aliases WHERE user_id = $1 AND entity_type = $2 AND LOWER(alias_value) = LOWER($3)
+		     AND entity_id IS NOT NULL AND entity_id != $4
+		 )`,
+		userID, entityType, name, except,
+	).Scan(&taken)
+	return taken, err
+}
+
+func (r *EntityRequest) validate(create bool) map[string]string {
+	fields := make(map[string]string)
+
+	if create {
+		if !repository.IsDirectoryType(r.Type) {
+			fields["type"] = "must be person, location or organization"
+		}
+		if r.Name == nil {
+			fields["name"] = "name is required"
+		}
+	}
+	if r.Name != nil {
+		name := strings.TrimSpace(*r.Name)
+		if name == "" || len(name) > models.MaxEntityNameLength {
+			fields["name"] = "name is required (max 255 characters)"
+		}
+	}
+	if r.Email != nil && *r.Email != "" {
+		if addr, err := mail.ParseAddress(*r.Email); err != nil || addr.Address != *r.Email {
+			fields["email"] = "invalid email address"
+		}
+	}
+	if r.Phone != nil && len(*r.Phone) > 50 {
+		fields["phone"] = "max 50 characters"
+	}
+	for _, alias := range r.Aliases {
+		if len(strings.TrimSpace(alias)) > models.MaxEntityNameLength {
+			fields["aliases"] = "aliases are max 255 characters"
+		}
+	}
+
+	return fields
+}
+
+// emptyToNil trims s and returns nil when nothing is left
+func emptyToNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// =====================================================
+// Entity links
+// =====================================================
+
+// syncTaskEntities relinks a task to the directory after its ai_entities
+// changed; ownerID is the task's owner, whose directory the entities live in
+func syncTaskEntities(ctx context.Context, db repository.DBTX, ownerID, taskID uuid.UUID, entitiesJSON []byte) error {
+	var entities []repository.TaskEntity
+	if len(entitiesJSON) > 0 {
+		if err := json.Unmarshal(entitiesJSON, &entities); err != nil {
+			return err
+		}
+	}
+	return repository.SyncTaskEntities(ctx, db, ownerID, taskID, entities)
+}
+
+// mergeDirectoryEntities makes from an alias of the entity to resolves to,
+// folding in any entity named from
+func (h *TaskHandler) mergeDirectoryEntities(ctx context.Context, ownerID uuid.UUID, entityType, from, to string) error {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	targetID, err := repository.ResolveEntity(ctx, tx, ownerID, entityType, strings.TrimSpace(to))
+	if err != nil {
+		return err
+	}
+	var targetName string
+	if err := tx.QueryRow(ctx, "SELECT name FROM entities WHERE id = $1", targetID).Scan(&targetName); err != nil {
+		return err
+	}
+
+	var sourceID uuid.UUID
+	err = tx.QueryRow(ctx,
+		"SELECT id FROM entities WHERE user_id = $1 AND entity_type = $2 AND LOWER(name) = LOWER($3)",
+		ownerID, entityType, strings.TrimSpace(from),
+	).Scan(&sourceID)
+	switch {
+	case err == nil && sourceID != targetID:
+		if err := mergeEntityInto(ctx, tx, ownerID, sourceID, targetID); err != nil {
+			return err
+		}
+	case err != nil && err != pgx.ErrNoRows:
+		return err
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(from), targetName) {
+		if err := upsertAlias(ctx, tx, ownerID, entityType, from, targetName, targetID); err != nil {
+			return err
+		}
+	}
+	if err := relinkMentions(ctx, tx, ownerID, entityType, []string{from}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// relinkMentions resyncs the owner's tasks that mention any of the values,
+// after aliases changed what those values resolve to
+func relinkMentions(ctx context.Context, db repository.DBTX, ownerID uuid.UUID, entityType string, values []string) error {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+
+	// Matched against ai_entities rather than task_entities, so mentions
+	// that were never linked (or linked elsewhere) are picked up too
+	rows, err := db.Query(ctx,
+		`SELECT t.id, t.ai_entities FROM tasks t
+		 WHERE t.user_id = $1 AND EXISTS (
+		   SELECT 1 FROM jsonb_array_elements(COALESCE(t.ai_entities, '[]'::jsonb)) e
+		   WHERE e->>'type' = $2 AND LOWER(TRIM(e->>'value')) = ANY($3)
+		 )`,
+		ownerID, entityType, lowered,
+	)
+	if err != nil {
+		return err
+	}
+
+	type mention struct {
+		taskID   uuid.UUID
+		entities []byte
+	}
+	var tasks []mention
+	for rows.Next() {
+		var m mention
+		if err := rows.Scan(&m.taskID, &m.entities); err != nil {
+			continue
+		}
+		tasks = append(tasks, m)
+	}
+	rows.Close()
+
+	for _, m := range tasks {
+		if err := syncTaskEntities(ctx, db, ownerID, m.taskID, m.entities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripMentions removes the entity values (lowercased) of the given type from
+// a task's ai_entities and relinks it. Reports whether the task changed.
+func stripMentions(ctx context.Context, db repository.DBTX, ownerID, taskID uuid.UUID, entityType string, values map[string]bool) (bool, error) {
+	var entitiesJSON []byte
+	err := db.QueryRow(ctx,
+		"SELECT COALESCE(ai_entities, '[]') FROM tasks WHERE id = $1 AND user_id = $2",
+		taskID, ownerID,
+	).Scan(&entitiesJSON)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var entities []models.TaskEntity
+	if err := json.Unmarshal(entitiesJSON, &entities); err != nil {
+		return false, nil
+	}
+
+	kept := make([]models.TaskEntity, 0, len(entities))
+	for _, e := range entities {
+		if e.Type == entityType && values[strings.ToLower(strings.TrimSpace(e.Value))] {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(kept) == len(entities) {
+		return false, nil
+	}
+
+	keptJSON, _ := json.Marshal(kept)
+	_, err = db.Exec(ctx,
+		`UPDATE tasks SET ai_entities = $1, version = version + 1, updated_at = NOW()
+		 WHERE id = $2 AND user_id = $3`,
+		keptJSON, taskID, ownerID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return true, syncTaskEntities(ctx, db, ownerID, taskID, keptJSON)
+}
+
+// addAlias points alias at the entity. Another entity with that name is
+// merged in; reports a conflict when the alias belongs to another entity.
+func addAlias(ctx context.Context, tx pgx.Tx, ownerID uuid.UUID, entityType, alias, canonical string, entityID uuid.UUID) (bool, error) {
+	var otherID uuid.UUID
+	err := tx.QueryRow(ctx,
+		`SELECT id FROM entities
+		 WHERE user_id = $1 AND entity_type = $2 AND LOWER(name) = LOWER($3) AND id != $4`,
+		ownerID, entityType, alias, entityID,
+	).Scan(&otherID)
+	if err == nil {
+		return false, mergeEntityInto(ctx, tx, ownerID, otherID, entityID)
+	}
+	if err != pgx.ErrNoRows {
+		return false, err
+	}
+
+	var taken bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM entity_aliases
+		   WHERE user_id = $1 AND entity_type = $2 AND LOWER(alias_value) = LOWER($3)
+		     AND entity_id IS NOT NULL AND entity_id != $4
+		 )`,
+		ownerID, entityType, alias, entityID,
+	).Scan(&taken)
+	if err != nil || taken {
+		return taken, err
+	}
+
+	return false, upsertAlias(ctx, tx, ownerID, entityType, alias, canonical, entityID)
+}
+
+// upsertAlias points an alias at an entity
+func upsertAlias(ctx context.Context, db repository.DBTX, ownerID uuid.UUID, entityType, alias, canonical string, entityID uuid.UUID) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO entity_aliases (user_id, entity_type, alias_value, canonical_value, entity_id)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (user_id, entity_type, alias_value)
+		 DO UPDATE SET canonical_value = EXCLUDED.canonical_value, entity_id = EXCLUDED.entity_id`,
+		ownerID, entityType, alias, canonical, entityID,
+	)
+	return err
+}
+
+// mergeEntityInto folds source into target (same owner and type): the
+// source name becomes an alias, its aliases, task links and any contact
+// fields the target lacks move over, and the source record is deleted
+func mergeEntityInto(ctx context.Context, db repository.DBTX, ownerID, sourceID, targetID uuid.UUID) error {
+	var entityType, targetName, sourceName string
+	err := db.QueryRow(ctx,
+		`UPDATE entities t
+		 SET notes = COALESCE(t.notes, s.notes), email = COALESCE(t.email, s.email),
+		     phone = COALESCE(t.phone, s.phone), updated_at = NOW()
+		 FROM entities s
+		 WHERE t.id = $1 AND s.id = $2 AND t.user_id = $3 AND s.user_id = $3
+		 RETURNING t.entity_type, t.name, s.name`,
+		targetID, sourceID, ownerID,
+	).Scan(&entityType, &targetName, &sourceName)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx,
+		"UPDATE entity_aliases SET entity_id = $1, canonical_value = $2 WHERE entity_id = $3",
+		targetID, targetName, sourceID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx,
+		`INSERT INTO task_entities (task_id, entity_id, value)
+		 SELECT task_id, $1, value FROM task_entities WHERE entity_id = $2
+		 ON CONFLICT DO NOTHING`,
+		targetID, sourceID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(ctx, "DELETE FROM entities WHERE id = $1", sourceID); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(sourceName, targetName) {
+		return nil
+	}
+	return upsertAlias(ctx, db, ownerID, entityType, sourceName, targetName, targetID)
+}
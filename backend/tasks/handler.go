@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -17,22 +18,30 @@ import (
 	"github.com/csaptu/flow/pkg/httputil"
 	"github.com/csaptu/flow/pkg/llm"
 	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/embeddings"
+	"github.com/csaptu/flow/shared/llmschema"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
 	"github.com/csaptu/flow/tasks/models"
 )
 
 // TaskHandler handles task endpoints
 type TaskHandler struct {
-	db        *pgxpool.Pool
-	llm       *llm.MultiClient
-	aiService *AIService
+	db          *pgxpool.Pool
+	llm         *llm.MultiClient
+	aiService   *AIService
+	aiProcessor *AIProcessor
+	embedder    *embeddings.Index
 }
 
 // NewTaskHandler creates a new task handler
-func NewTaskHandler(db *pgxpool.Pool, llmClient *llm.MultiClient) *TaskHandler {
+func NewTaskHandler(db *pgxpool.Pool, llmClient *llm.MultiClient, aiProcessor *AIProcessor) *TaskHandler {
 	return &TaskHandler{
-		db:        db,
-		llm:       llmClient,
-		aiService: NewAIService(db, llmClient),
+		db:          db,
+		llm:         llmClient,
+		aiService:   NewAIService(db, llmClient),
+		aiProcessor: aiProcessor,
+		embedder:    aiProcessor.embedder,
 	}
 }
 
@@ -58,7 +67,8 @@ type UpdateRequest struct {
 	Priority    *int     `json:"priority,omitempty"`
 	Status      *string  `json:"status,omitempty"`
 	Tags        []string `json:"tags,omitempty"`
-	ParentID    *string  `json:"parent_id,omitempty"` // Set to empty string to remove parent
+	ParentID    *string  `json:"parent_id,omitempty"`   // Set to empty string to remove parent
+	AssigneeID  *string  `json:"assignee_id,omitempty"` // Set to empty string to unassign
 }
 
 // TaskResponse represents a task in API responses
@@ -72,8 +82,9 @@ type TaskResponse struct {
 	DisplayDescription *string             `json:"display_description,omitempty"`    // Computed: ai_cleaned_description ?? description
 	Status             string              `json:"status"`
 	Priority           int                 `json:"priority"`
-	DueAt              *string             `json:"due_at,omitempty"` // Full timestamp: RFC3339 format
-	HasDueTime         bool                `json:"has_due_time"`     // true = specific time matters
+	StartDate          *string             `json:"start_date,omitempty"` // Planned start (plan-my-day)
+	DueAt              *string             `json:"due_at,omitempty"`     // Full timestamp: RFC3339 format
+	HasDueTime         bool                `json:"has_due_time"`         // true = specific time matters
 	CompletedAt        *string             `json:"completed_at,omitempty"`
 	Tags               []string            `json:"tags"`
 	ParentID           *string             `json:"parent_id,omitempty"`
@@ -85,6 +96,10 @@ type TaskResponse struct {
 	Entities           []models.TaskEntity `json:"entities"`
 	DuplicateOf        []string            `json:"duplicate_of"`
 	DuplicateResolved  bool                `json:"duplicate_resolved"`
+	OwnerID            string              `json:"owner_id"`              // Differs from the caller on shared tasks
+	AssigneeID         *string             `json:"assignee_id,omitempty"` // Participant responsible for a shared task
+	CreatedBy          *string             `json:"created_by,omitempty"`  // Null for tasks created before sharing existed
+	LastModifiedBy     *string             `json:"last_modified_by,omitempty"`
 	CreatedAt          string              `json:"created_at"`
 	UpdatedAt          string              `json:"updated_at"`
 }
@@ -147,11 +162,18 @@ func (h *TaskHandler) Create(c *fiber.Ctx) error {
 			return httputil.BadRequest(c, "invalid parent_id")
 		}
 
+		// Subtasks of a shared task belong to the parent's owner
+		ownerID, _, err := h.editableTask(c.Context(), parentID, userID)
+		if err != nil {
+			return err
+		}
+		task.UserID = ownerID
+
 		// Get parent task to check depth
 		var parentDepth int
 		err = h.db.QueryRow(c.Context(),
 			"SELECT depth FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL",
-			parentID, userID,
+			parentID, ownerID,
 		).Scan(&parentDepth)
 		if err == pgx.ErrNoRows {
 			return httputil.NotFound(c, "parent task")
@@ -163,27 +185,41 @@ func (h *TaskHandler) Create(c *fiber.Ctx) error {
 		if err := task.SetParent(parentID, parentDepth); err != nil {
 			return httputil.BadRequest(c, err.Error())
 		}
+	} else if ownerID, ok := h.sharedListOwner(c.Context(), userID, task.Tags); ok {
+		// Adding to a list shared with us as editor
+		task.UserID = ownerID
 	}
 
+	task.CreatedBy = &userID
+	task.LastModifiedBy = &userID
+
 	// Insert task
 	entitiesJSON, _ := json.Marshal(task.Entities)
 
 	_, err = h.db.Exec(c.Context(),
 		`INSERT INTO tasks (id, user_id, title, description, status, priority, due_at, has_due_time, tags,
-		 parent_id, depth, ai_entities, version, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		 parent_id, depth, ai_entities, version, created_at, updated_at, created_by, last_modified_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
 		task.ID, task.UserID, task.Title, task.Description, task.Status, task.Priority,
 		task.DueAt, task.HasDueTime, task.Tags, task.ParentID, task.Depth, entitiesJSON,
-		task.Version, task.CreatedAt, task.UpdatedAt,
+		task.Version, task.CreatedAt, task.UpdatedAt, task.CreatedBy, task.LastModifiedBy,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to create task")
 	}
 
-	// Auto-process with AI (async, don't block response)
-	go h.autoProcessTaskWithAI(c.Context(), userID, task)
+	// Queue AI auto-processing (runs on the job workers). Tasks created in
+	// someone else's shared list are skipped: AI context is built from the
+	// creator's profile and must not mix with the owner's data.
+	if task.UserID == userID {
+		h.queueAIProcessing(c.Context(), userID, task.ID, AIJobSourceCreate)
+	}
+	h.recordActivity(c.Context(), task.ID, userID, "created", nil)
+
+	resp := toTaskResponse(task, 0)
+	publishTaskEvent(task.UserID, webhook.EventTaskCreated, resp)
 
-	return httputil.Created(c, toTaskResponse(task, 0))
+	return httputil.Created(c, resp)
 }
 
 // GetByID handles getting a task by ID
@@ -221,10 +257,10 @@ func (h *TaskHandler) List(c *fiber.Ctx) error {
 		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
 		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.created_at, t.updated_at,
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
 		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
 		 FROM tasks t
-		 WHERE t.user_id = $1 AND t.deleted_at IS NULL
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
 		 ORDER BY t.created_at DESC
 		 LIMIT $2 OFFSET $3`,
 		userID, pagination.PageSize, pagination.Offset(),
@@ -246,7 +282,7 @@ func (h *TaskHandler) List(c *fiber.Ctx) error {
 	// Get total count (all tasks including subtasks)
 	var totalCount int64
 	_ = h.db.QueryRow(c.Context(),
-		"SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND deleted_at IS NULL",
+		"SELECT COUNT(*) FROM tasks t WHERE "+visibleTo("$1")+" AND t.deleted_at IS NULL",
 		userID,
 	).Scan(&totalCount)
 
@@ -267,10 +303,10 @@ func (h *TaskHandler) Today(c *fiber.Ctx) error {
 		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
 		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.created_at, t.updated_at,
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
 		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
 		 FROM tasks t
-		 WHERE t.user_id = $1 AND t.deleted_at IS NULL
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
 		 AND t.due_at >= $2 AND t.due_at < $3
 		 AND t.status != 'completed'
 		 ORDER BY t.priority DESC, t.due_at ASC`,
@@ -304,10 +340,10 @@ func (h *TaskHandler) Inbox(c *fiber.Ctx) error {
 		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
 		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.created_at, t.updated_at,
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
 		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
 		 FROM tasks t
-		 WHERE t.user_id = $1 AND t.deleted_at IS NULL
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
 		 AND t.due_at IS NULL AND t.status != 'completed'
 		 ORDER BY t.created_at DESC`,
 		userID,
@@ -342,10 +378,10 @@ func (h *TaskHandler) Upcoming(c *fiber.Ctx) error {
 		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
 		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.created_at, t.updated_at,
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
 		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
 		 FROM tasks t
-		 WHERE t.user_id = $1 AND t.deleted_at IS NULL
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
 		 AND t.due_at >= $2 AND t.status != 'completed'
 		 ORDER BY t.due_at ASC
 		 LIMIT 100`,
@@ -381,10 +417,10 @@ func (h *TaskHandler) Completed(c *fiber.Ctx) error {
 		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
 		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.created_at, t.updated_at,
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
 		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
 		 FROM tasks t
-		 WHERE t.user_id = $1 AND t.deleted_at IS NULL AND t.status = 'completed'
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL AND t.status = 'completed'
 		 ORDER BY t.completed_at DESC
 		 LIMIT $2 OFFSET $3`,
 		userID, pagination.PageSize, pagination.Offset(),
@@ -406,6 +442,95 @@ func (h *TaskHandler) Completed(c *fiber.Ctx) error {
 	return httputil.Success(c, tasks)
 }
 
+// Assigned handles listing open tasks assigned to the user (own and shared)
+func (h *TaskHandler) Assigned(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
+		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
+		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
+		 FROM tasks t
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
+		 AND t.assignee_id = $1 AND t.status != 'completed'
+		 ORDER BY t.due_at ASC NULLS LAST, t.priority DESC`,
+		userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	tasks := make([]TaskResponse, 0)
+	for rows.Next() {
+		task, childCount, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, toTaskResponse(task, childCount))
+	}
+
+	return httputil.Success(c, tasks)
+}
+
+// Search finds tasks by text across the user's own and shared tasks
+// GET /tasks/search?q=
+func (h *TaskHandler) Search(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"q": "required",
+		})
+	}
+
+	pagination := httputil.ParsePagination(c)
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
+		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
+		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
+		 FROM tasks t
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
+		 AND (t.title ILIKE $2 OR t.description ILIKE $2
+		      OR t.ai_cleaned_title ILIKE $2 OR t.ai_cleaned_description ILIKE $2
+		      OR array_to_string(t.tags, ' ') ILIKE $2)
+		 ORDER BY (t.status = 'completed') ASC, t.updated_at DESC
+		 LIMIT $3 OFFSET $4`,
+		userID, pattern, pagination.PageSize, pagination.Offset(),
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	tasks := make([]TaskResponse, 0)
+	for rows.Next() {
+		task, childCount, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, toTaskResponse(task, childCount))
+	}
+
+	return httputil.Success(c, tasks)
+}
+
+// likeEscaper escapes LIKE wildcards in user-provided search text
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // Update handles updating a task
 func (h *TaskHandler) Update(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
@@ -423,11 +548,18 @@ func (h *TaskHandler) Update(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid request body")
 	}
 
+	ownerID, _, err := h.editableTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+
 	// Get existing task
 	task, childCount, err := h.getTask(c.Context(), taskID, userID)
 	if err != nil {
 		return err
 	}
+	wasCompleted := task.Status == commonModels.StatusCompleted
+	changes := updatedFields(&req)
 
 	// Apply updates with smart AI field preservation:
 	// Only clear AI-cleaned fields if the user actually changed to something new
@@ -511,11 +643,11 @@ func (h *TaskHandler) Update(c *fiber.Ctx) error {
 				return httputil.BadRequest(c, "task cannot be its own parent")
 			}
 
-			// Get parent task to check depth
+			// Get parent task to check depth (it must belong to the same owner)
 			var parentDepth int
 			err = h.db.QueryRow(c.Context(),
 				"SELECT depth FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL",
-				parentID, userID,
+				parentID, ownerID,
 			).Scan(&parentDepth)
 			if err == pgx.ErrNoRows {
 				return httputil.NotFound(c, "parent task")
@@ -539,28 +671,61 @@ func (h *TaskHandler) Update(c *fiber.Ctx) error {
 		}
 	}
 
+	if req.AssigneeID != nil {
+		if *req.AssigneeID == "" {
+			task.AssigneeID = nil
+		} else {
+			assigneeID, err := uuid.Parse(*req.AssigneeID)
+			if err != nil {
+				return httputil.BadRequest(c, "invalid assignee_id")
+			}
+			if !h.canBeAssigned(c.Context(), taskID, assigneeID) {
+				return httputil.ValidationError(c, "validation failed", map[string]string{
+					"assignee_id": "must be the owner or a participant of this task",
+				})
+			}
+			task.AssigneeID = &assigneeID
+		}
+	}
+
+	task.LastModifiedBy = &userID
 	task.IncrementVersion()
 
+	// Tags and parent decide which shares cover the task and its subtasks
+	var grants []repository.AccessGrant
+	if req.Tags != nil || req.ParentID != nil {
+		grants = h.grantsBefore(c.Context(), taskID)
+	}
+
 	// Update task
 	_, err = h.db.Exec(c.Context(),
 		`UPDATE tasks SET title = $1, description = $2, due_at = $3, has_due_time = $4, priority = $5,
 		 status = $6, completed_at = $7, tags = $8, parent_id = $9, depth = $10,
-		 ai_cleaned_title = $11, ai_cleaned_description = $12, version = $13, updated_at = $14
-		 WHERE id = $15 AND user_id = $16`,
+		 ai_cleaned_title = $11, ai_cleaned_description = $12, version = $13, updated_at = $14,
+		 assignee_id = $15, last_modified_by = $16
+		 WHERE id = $17 AND user_id = $18`,
 		task.Title, task.Description, task.DueAt, task.HasDueTime, task.Priority, task.Status,
 		task.CompletedAt, task.Tags, task.ParentID, task.Depth, task.AICleanedTitle, task.AICleanedDescription,
-		task.Version, task.UpdatedAt,
-		taskID, userID,
+		task.Version, task.UpdatedAt, task.AssigneeID, task.LastModifiedBy,
+		taskID, ownerID,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to update task")
 	}
+	recordLostAccess(c.Context(), h.db, grants)
+	h.recordActivity(c.Context(), taskID, userID, "updated", changes)
 
 	// Note: Don't auto-process with AI on updates - only on create.
 	// User edits should not trigger auto-cleanup. AI features are manual-only
 	// after initial task creation (clean button, extract button, etc.)
 
-	return httputil.Success(c, toTaskResponse(task, childCount))
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(ownerID, webhook.EventTaskUpdated, resp)
+	if !wasCompleted && task.Status == commonModels.StatusCompleted {
+		publishTaskEvent(ownerID, webhook.EventTaskCompleted, resp)
+	}
+
+	return httputil.Success(c, resp)
 }
 
 // Delete handles deleting a task
@@ -575,16 +740,41 @@ func (h *TaskHandler) Delete(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid task ID")
 	}
 
+	ownerID, role, err := h.editableTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Editors can delete tasks inside a shared task, but not the shared task itself
+	if role != RoleOwner {
+		var isShareRoot bool
+		_ = h.db.QueryRow(c.Context(),
+			"SELECT EXISTS(SELECT 1 FROM task_shares WHERE task_id = $1)",
+			taskID,
+		).Scan(&isShareRoot)
+		if isShareRoot {
+			return httputil.Forbidden(c, "only the owner can delete a shared task")
+		}
+	}
+
 	// Soft delete task and children
 	now := time.Now()
-	_, err = h.db.Exec(c.Context(),
-		`UPDATE tasks SET deleted_at = $1 WHERE (id = $2 OR parent_id = $2) AND user_id = $3`,
-		now, taskID, userID,
+	result, err := h.db.Exec(c.Context(),
+		`UPDATE tasks SET deleted_at = $1, last_modified_by = $4 WHERE (id = $2 OR parent_id = $2) AND user_id = $3`,
+		now, taskID, ownerID, userID,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to delete task")
 	}
 
+	if result.RowsAffected() > 0 {
+		h.recordActivity(c.Context(), taskID, userID, "deleted", nil)
+		go webhook.Publish(context.Background(), ownerID, webhook.EventTaskDeleted, map[string]string{
+			"id":         taskID.String(),
+			"deleted_at": now.Format(time.RFC3339),
+		})
+	}
+
 	return httputil.NoContent(c)
 }
 
@@ -600,11 +790,17 @@ func (h *TaskHandler) Complete(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid task ID")
 	}
 
+	ownerID, _, err := h.editableTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now()
 	result, err := h.db.Exec(c.Context(),
-		`UPDATE tasks SET status = 'completed', completed_at = $1, version = version + 1, updated_at = $1
+		`UPDATE tasks SET status = 'completed', completed_at = $1, version = version + 1, updated_at = $1,
+		 last_modified_by = $4
 		 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`,
-		now, taskID, userID,
+		now, taskID, ownerID, userID,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to complete task")
@@ -613,9 +809,13 @@ func (h *TaskHandler) Complete(c *fiber.Ctx) error {
 	if result.RowsAffected() == 0 {
 		return httputil.NotFound(c, "task")
 	}
+	h.recordActivity(c.Context(), taskID, userID, "completed", nil)
 
 	task, childCount, _ := h.getTask(c.Context(), taskID, userID)
-	return httputil.Success(c, toTaskResponse(task, childCount))
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(ownerID, webhook.EventTaskCompleted, resp)
+
+	return httputil.Success(c, resp)
 }
 
 // Uncomplete marks a task as pending
@@ -630,11 +830,17 @@ func (h *TaskHandler) Uncomplete(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid task ID")
 	}
 
+	ownerID, _, err := h.editableTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now()
 	result, err := h.db.Exec(c.Context(),
-		`UPDATE tasks SET status = 'pending', completed_at = NULL, version = version + 1, updated_at = $1
+		`UPDATE tasks SET status = 'pending', completed_at = NULL, version = version + 1, updated_at = $1,
+		 last_modified_by = $4
 		 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`,
-		now, taskID, userID,
+		now, taskID, ownerID, userID,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to uncomplete task")
@@ -643,9 +849,13 @@ func (h *TaskHandler) Uncomplete(c *fiber.Ctx) error {
 	if result.RowsAffected() == 0 {
 		return httputil.NotFound(c, "task")
 	}
+	h.recordActivity(c.Context(), taskID, userID, "uncompleted", nil)
 
 	task, childCount, _ := h.getTask(c.Context(), taskID, userID)
-	return httputil.Success(c, toTaskResponse(task, childCount))
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(ownerID, webhook.EventTaskUpdated, resp)
+
+	return httputil.Success(c, resp)
 }
 
 // CreateChild creates a child task
@@ -665,11 +875,17 @@ func (h *TaskHandler) CreateChild(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid request body")
 	}
 
+	// Subtasks of a shared task belong to the parent's owner
+	ownerID, _, err := h.editableTask(c.Context(), parentID, userID)
+	if err != nil {
+		return err
+	}
+
 	// Get parent task
 	var parentDepth int
 	err = h.db.QueryRow(c.Context(),
 		"SELECT depth FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL",
-		parentID, userID,
+		parentID, ownerID,
 	).Scan(&parentDepth)
 	if err == pgx.ErrNoRows {
 		return httputil.NotFound(c, "parent task")
@@ -687,13 +903,15 @@ func (h *TaskHandler) CreateChild(c *fiber.Ctx) error {
 	var maxSortOrder int
 	err = h.db.QueryRow(c.Context(),
 		`SELECT COALESCE(MAX(sort_order), -1) FROM tasks WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL`,
-		parentID, userID,
+		parentID, ownerID,
 	).Scan(&maxSortOrder)
 	if err != nil {
 		maxSortOrder = -1
 	}
 
-	task := models.NewTask(userID, req.Title)
+	task := models.NewTask(ownerID, req.Title)
+	task.CreatedBy = &userID
+	task.LastModifiedBy = &userID
 	task.Description = req.Description
 	task.ParentID = &parentID
 	task.Depth = parentDepth + 1
@@ -707,17 +925,21 @@ func (h *TaskHandler) CreateChild(c *fiber.Ctx) error {
 
 	_, err = h.db.Exec(c.Context(),
 		`INSERT INTO tasks (id, user_id, title, description, status, priority, due_at, has_due_time, tags,
-		 parent_id, depth, sort_order, ai_entities, version, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		 parent_id, depth, sort_order, ai_entities, version, created_at, updated_at, created_by, last_modified_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
 		task.ID, task.UserID, task.Title, task.Description, task.Status, task.Priority,
 		task.DueAt, task.HasDueTime, task.Tags, task.ParentID, task.Depth, task.SortOrder, entitiesJSON,
-		task.Version, task.CreatedAt, task.UpdatedAt,
+		task.Version, task.CreatedAt, task.UpdatedAt, task.CreatedBy, task.LastModifiedBy,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to create task")
 	}
+	h.recordActivity(c.Context(), task.ID, userID, "created", nil)
 
-	return httputil.Created(c, toTaskResponse(task, 0))
+	resp := toTaskResponse(task, 0)
+	publishTaskEvent(ownerID, webhook.EventTaskCreated, resp)
+
+	return httputil.Created(c, resp)
 }
 
 // GetChildren gets child tasks
@@ -736,10 +958,10 @@ func (h *TaskHandler) GetChildren(c *fiber.Ctx) error {
 		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
 		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.created_at, t.updated_at,
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
 		 0 as children_count
 		 FROM tasks t
-		 WHERE t.user_id = $1 AND t.parent_id = $2 AND t.deleted_at IS NULL
+		 WHERE `+visibleTo("$1")+` AND t.parent_id = $2 AND t.deleted_at IS NULL
 		 ORDER BY t.sort_order ASC, t.created_at ASC`,
 		userID, parentID,
 	)
@@ -786,14 +1008,10 @@ func (h *TaskHandler) ReorderChildren(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "task_ids is required")
 	}
 
-	// Verify parent task exists and belongs to user
-	var exists bool
-	err = h.db.QueryRow(c.Context(),
-		`SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`,
-		parentID, userID,
-	).Scan(&exists)
-	if err != nil || !exists {
-		return httputil.NotFound(c, "parent task")
+	// Verify parent task exists and the user may edit it
+	ownerID, _, err := h.editableTask(c.Context(), parentID, userID)
+	if err != nil {
+		return err
 	}
 
 	// Update sort_order for each task in the new order
@@ -806,7 +1024,7 @@ func (h *TaskHandler) ReorderChildren(c *fiber.Ctx) error {
 		_, err = h.db.Exec(c.Context(),
 			`UPDATE tasks SET sort_order = $1, updated_at = NOW()
 			 WHERE id = $2 AND parent_id = $3 AND user_id = $4 AND deleted_at IS NULL`,
-			i, taskID, parentID, userID,
+			i, taskID, parentID, ownerID,
 		)
 		if err != nil {
 			// Log but continue with other updates
@@ -817,6 +1035,87 @@ func (h *TaskHandler) ReorderChildren(c *fiber.Ctx) error {
 	return httputil.Success(c, map[string]string{"status": "ok"})
 }
 
+// ActivityResponse represents one attributed change of a shared task
+type ActivityResponse struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"user_id"`
+	Action    string   `json:"action"`
+	Changes   []string `json:"changes"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// Activity returns who changed a shared task and how (most recent first)
+// GET /tasks/:id/activity
+func (h *TaskHandler) Activity(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+
+	if _, _, err := h.taskAccess(c.Context(), taskID, userID); err != nil {
+		return err
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT id, user_id, action, changes, created_at
+		 FROM task_activity
+		 WHERE task_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT 100`,
+		taskID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	items := make([]ActivityResponse, 0)
+	for rows.Next() {
+		var id, actorID uuid.UUID
+		var action string
+		var changesJSON []byte
+		var createdAt time.Time
+		if err := rows.Scan(&id, &actorID, &action, &changesJSON, &createdAt); err != nil {
+			continue
+		}
+
+		changes := []string{}
+		_ = json.Unmarshal(changesJSON, &changes)
+
+		items = append(items, ActivityResponse{
+			ID:        id.String(),
+			UserID:    actorID.String(),
+			Action:    action,
+			Changes:   changes,
+			CreatedAt: createdAt.Format(time.RFC3339),
+		})
+	}
+
+	return httputil.Success(c, items)
+}
+
+// aiFailed responds to a failed LLM call. Spend caps and safety blocks are
+// told apart from outages, since retrying won't help with either.
+func aiFailed(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, llm.ErrSpendCap):
+		return httputil.PaymentRequired(c, "daily AI budget reached, please try again tomorrow")
+	case errors.Is(err, llm.ErrPrivacyMode):
+		return httputil.ServiceUnavailable(c, "privacy mode is on and the local AI model is not available")
+	case errors.Is(err, llm.ErrSafety):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(dto.Error("UNPROCESSABLE_ENTITY", "the AI provider declined to process this content"))
+	case errors.Is(err, llm.ErrInvalidOutput):
+		return httputil.ServiceUnavailable(c, "AI returned an unusable answer, please try again")
+	default:
+		return httputil.ServiceUnavailable(c, "AI service error")
+	}
+}
+
 // AIDecompose uses AI to break down a task into subtasks
 func (h *TaskHandler) AIDecompose(c *fiber.Ctx) error {
 	if h.llm == nil {
@@ -837,6 +1136,9 @@ func (h *TaskHandler) AIDecompose(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Check if task can have children (only root tasks can)
 	if task.Depth > 0 {
@@ -867,32 +1169,16 @@ Each subtask should be:
 		},
 		MaxTokens:   500,
 		Temperature: 0.3,
+		Feature:     string(FeatureDecompose),
+		UserID:      userID,
+		Schema:      llmschema.Subtasks(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
 	}
 
-	// Parse AI response - expecting array of strings
 	var subtaskTitles []string
-	content := strings.TrimSpace(resp.Content)
-	// Handle markdown code blocks
-	if strings.HasPrefix(content, "```") {
-		lines := strings.Split(content, "\n")
-		var jsonLines []string
-		inBlock := false
-		for _, line := range lines {
-			if strings.HasPrefix(line, "```") {
-				inBlock = !inBlock
-				continue
-			}
-			if inBlock {
-				jsonLines = append(jsonLines, line)
-			}
-		}
-		content = strings.Join(jsonLines, "\n")
-	}
-
-	if err := json.Unmarshal([]byte(content), &subtaskTitles); err != nil {
+	if err := json.Unmarshal([]byte(resp.Content), &subtaskTitles); err != nil {
 		return httputil.InternalError(c, "failed to parse AI response")
 	}
 
@@ -948,6 +1234,9 @@ func (h *TaskHandler) AIClean(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Call LLM to clean up task
 	prompt := fmt.Sprintf(`Clean up this task to be clearer and more concise.
@@ -969,9 +1258,12 @@ Return ONLY a JSON object:
 		},
 		MaxTokens:   200,
 		Temperature: 0.3,
+		Feature:     string(FeatureCleanTitle),
+		UserID:      userID,
+		Schema:      llmschema.Clean(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
 	}
 
 	// Parse AI response
@@ -1020,6 +1312,9 @@ func (h *TaskHandler) AIRate(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Check feature access
 	if h.aiService != nil {
@@ -1056,9 +1351,15 @@ Return ONLY a JSON object:
 		},
 		MaxTokens:   100,
 		Temperature: 0.3,
+		Feature:     string(FeatureComplexity),
+		UserID:      userID,
+		Schema:      llmschema.Rating(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
+	}
+	if h.aiService != nil {
+		h.aiService.RefundIfCached(c.Context(), userID, FeatureComplexity, resp)
 	}
 
 	var rated struct {
@@ -1109,6 +1410,9 @@ func (h *TaskHandler) AIExtract(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Check feature access
 	if h.aiService != nil {
@@ -1149,9 +1453,15 @@ Only include entities that are actually present. Leave array empty if none found
 		},
 		MaxTokens:   300,
 		Temperature: 0.2,
+		Feature:     string(FeatureEntityExtraction),
+		UserID:      userID,
+		Schema:      llmschema.Entities(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
+	}
+	if h.aiService != nil {
+		h.aiService.RefundIfCached(c.Context(), userID, FeatureEntityExtraction, resp)
 	}
 
 	var extracted struct {
@@ -1173,6 +1483,9 @@ Only include entities that are actually present. Leave array empty if none found
 	if err != nil {
 		return httputil.InternalError(c, "failed to update task")
 	}
+	if err := syncTaskEntities(c.Context(), h.db, userID, taskID, entitiesJSON); err != nil {
+		fmt.Printf("[Entities] Failed to link entities for task %s: %v\n", taskID, err)
+	}
 
 	return httputil.Success(c, map[string]interface{}{
 		"task":     toTaskResponse(task, childCount),
@@ -1200,6 +1513,9 @@ func (h *TaskHandler) AIRemind(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Check feature access
 	if h.aiService != nil {
@@ -1243,9 +1559,12 @@ Guidelines:
 		},
 		MaxTokens:   150,
 		Temperature: 0.3,
+		Feature:     string(FeatureReminder),
+		UserID:      userID,
+		Schema:      llmschema.Reminder(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
 	}
 
 	var suggested struct {
@@ -1256,14 +1575,9 @@ Guidelines:
 		return httputil.InternalError(c, "failed to parse AI response")
 	}
 
-	// Parse and validate reminder time
-	reminderTime, err := time.Parse(time.RFC3339, suggested.ReminderTime)
+	reminderTime, err := llm.ParseDateTime(suggested.ReminderTime)
 	if err != nil {
-		// Try alternate format
-		reminderTime, err = time.Parse("2006-01-02T15:04:05", suggested.ReminderTime)
-		if err != nil {
-			return httputil.InternalError(c, "invalid reminder time from AI")
-		}
+		return httputil.InternalError(c, "invalid reminder time from AI")
 	}
 
 	// Update task with reminder
@@ -1306,6 +1620,9 @@ func (h *TaskHandler) AIEmail(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Check feature access
 	if h.aiService != nil {
@@ -1339,9 +1656,12 @@ Return ONLY a JSON object:
 		},
 		MaxTokens:   500,
 		Temperature: 0.4,
+		Feature:     string(FeatureDraftEmail),
+		UserID:      userID,
+		Schema:      llmschema.Email(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
 	}
 
 	var draft DraftContent
@@ -1382,6 +1702,9 @@ func (h *TaskHandler) AIInvite(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if task.UserID != userID {
+		return httputil.Forbidden(c, "AI features are only available on your own tasks")
+	}
 
 	// Check feature access
 	if h.aiService != nil {
@@ -1429,9 +1752,12 @@ Guidelines:
 		},
 		MaxTokens:   400,
 		Temperature: 0.4,
+		Feature:     string(FeatureDraftCalendar),
+		UserID:      userID,
+		Schema:      llmschema.Invite(),
 	})
 	if err != nil {
-		return httputil.ServiceUnavailable(c, "AI service error")
+		return aiFailed(c, err)
 	}
 
 	var draft DraftContent
@@ -1452,17 +1778,137 @@ Guidelines:
 	})
 }
 
-// Sync handles task synchronization
+// Sync handles task synchronization.
+// Returns every task the user can see - own and shared - that changed since
+// last_synced_at, plus deletions.
 func (h *TaskHandler) Sync(c *fiber.Ctx) error {
-	// TODO: Implement proper sync with conflict resolution
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req dto.SyncRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	// Sync is pull-only: clients push their changes through the task endpoints,
+	// so req.Changes is ignored
+	serverTimestamp := time.Now()
+	changes := make([]dto.SyncOperation, 0)
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
+		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
+		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
+		 FROM tasks t
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
+		 AND (t.updated_at > $2 OR t.id IN (
+		   SELECT a.task_id FROM shared_task_access a
+		   JOIN task_share_members m ON m.share_id = a.share_id AND m.user_id = a.user_id
+		   WHERE a.user_id = $1 AND m.updated_at > $2
+		 ))
+		 ORDER BY t.updated_at ASC`,
+		userID, req.LastSyncedAt,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, childCount, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		data, _ := json.Marshal(toTaskResponse(task, childCount))
+		var fields map[string]interface{}
+		_ = json.Unmarshal(data, &fields)
+
+		changes = append(changes, dto.SyncOperation{
+			Operation:       "update",
+			TableName:       "tasks",
+			RecordID:        task.ID.String(),
+			Data:            fields,
+			ClientTimestamp: task.UpdatedAt,
+		})
+	}
+
+	// Deleted tasks, and tasks the user could see through a share and no
+	// longer can, both leave the user's devices
+	deleted, err := h.db.Query(c.Context(),
+		`SELECT t.id, t.deleted_at FROM tasks t
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at > $2
+		 UNION ALL
+		 SELECT t.id, r.revoked_at FROM task_access_revocations r
+		 JOIN tasks t ON t.id = r.task_id
+		 WHERE r.user_id = $1 AND r.revoked_at > $2 AND NOT `+visibleTo("$1"),
+		userID, req.LastSyncedAt,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer deleted.Close()
+
+	for deleted.Next() {
+		var id uuid.UUID
+		var deletedAt time.Time
+		if err := deleted.Scan(&id, &deletedAt); err != nil {
+			continue
+		}
+		changes = append(changes, dto.SyncOperation{
+			Operation:       "delete",
+			TableName:       "tasks",
+			RecordID:        id.String(),
+			ClientTimestamp: deletedAt,
+		})
+	}
+
 	return httputil.Success(c, dto.SyncResponse{
-		ServerTimestamp: time.Now(),
-		Changes:         []dto.SyncOperation{},
+		ServerTimestamp: serverTimestamp,
+		Changes:         changes,
 	})
 }
 
 // Helper functions
 
+// updatedFields lists the fields an update request touches, for change attribution
+func updatedFields(req *UpdateRequest) []string {
+	fields := []string{}
+	if req.Title != nil {
+		fields = append(fields, "title")
+	}
+	if req.Description != nil {
+		fields = append(fields, "description")
+	}
+	if req.DueAt != nil || req.HasDueTime != nil || (req.ClearDueAt != nil && *req.ClearDueAt) {
+		fields = append(fields, "due_at")
+	}
+	if req.Priority != nil {
+		fields = append(fields, "priority")
+	}
+	if req.Status != nil {
+		fields = append(fields, "status")
+	}
+	if req.Tags != nil {
+		fields = append(fields, "tags")
+	}
+	if req.ParentID != nil {
+		fields = append(fields, "parent_id")
+	}
+	if req.AssigneeID != nil {
+		fields = append(fields, "assignee_id")
+	}
+	return fields
+}
+
+// publishTaskEvent queues an outgoing webhook event without delaying the response
+func publishTaskEvent(userID uuid.UUID, eventType string, task TaskResponse) {
+	go webhook.Publish(context.Background(), userID, eventType, task)
+}
+
 func (h *TaskHandler) getTask(ctx context.Context, taskID, userID uuid.UUID) (*models.Task, int, error) {
 	var task models.Task
 	var childCount int
@@ -1471,20 +1917,21 @@ func (h *TaskHandler) getTask(ctx context.Context, taskID, userID uuid.UUID) (*m
 
 	err := h.db.QueryRow(ctx,
 		`SELECT t.id, t.user_id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
-		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.status, t.priority, t.start_date, t.due_at, t.has_due_time, t.completed_at, t.tags,
 		 t.parent_id, t.depth, COALESCE(t.complexity, 0), COALESCE(t.ai_extracted_due, false),
 		 COALESCE(t.skip_auto_cleanup, false), t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
-		 t.version, t.created_at, t.updated_at,
+		 t.version, t.created_at, t.updated_at, t.assignee_id, t.created_by, t.last_modified_by,
 		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
 		 FROM tasks t
-		 WHERE t.id = $1 AND t.user_id = $2 AND t.deleted_at IS NULL`,
+		 WHERE t.id = $1 AND `+visibleTo("$2")+` AND t.deleted_at IS NULL`,
 		taskID, userID,
 	).Scan(
 		&task.ID, &task.UserID, &task.Title, &task.Description, &task.AICleanedTitle, &task.AICleanedDescription,
-		&task.Status, &task.Priority, &task.DueAt, &task.HasDueTime, &task.CompletedAt, &task.Tags,
+		&task.Status, &task.Priority, &task.StartDate, &task.DueAt, &task.HasDueTime, &task.CompletedAt, &task.Tags,
 		&task.ParentID, &task.Depth, &task.Complexity, &task.AIExtractedDue,
 		&task.SkipAutoCleanup, &entitiesJSON, &duplicateOfJSON, &task.DuplicateResolved,
-		&task.Version, &task.CreatedAt, &task.UpdatedAt, &childCount,
+		&task.Version, &task.CreatedAt, &task.UpdatedAt, &task.AssigneeID, &task.CreatedBy, &task.LastModifiedBy,
+		&childCount,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -1524,7 +1971,8 @@ func scanTask(rows pgx.Rows) (*models.Task, int, error) {
 		&task.Status, &task.Priority, &task.DueAt, &task.HasDueTime, &task.CompletedAt, &task.Tags,
 		&task.ParentID, &task.Depth, &task.SortOrder, &task.Complexity,
 		&entitiesJSON, &duplicateOfJSON, &task.DuplicateResolved,
-		&task.CreatedAt, &task.UpdatedAt, &childCount,
+		&task.CreatedAt, &task.UpdatedAt, &task.UserID, &task.AssigneeID, &task.CreatedBy, &task.LastModifiedBy,
+		&childCount,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -1586,10 +2034,18 @@ func toTaskResponse(t *models.Task, childCount int) TaskResponse {
 		Entities:           entities,
 		DuplicateOf:        duplicateOf,
 		DuplicateResolved:  t.DuplicateResolved,
+		OwnerID:            t.UserID.String(),
+		AssigneeID:         uuidString(t.AssigneeID),
+		CreatedBy:          uuidString(t.CreatedBy),
+		LastModifiedBy:     uuidString(t.LastModifiedBy),
 		CreatedAt:          t.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:          t.UpdatedAt.Format(time.RFC3339),
 	}
 
+	if t.StartDate != nil {
+		d := t.StartDate.Format(time.RFC3339)
+		resp.StartDate = &d
+	}
 	if t.DueAt != nil {
 		d := t.DueAt.Format(time.RFC3339)
 		resp.DueAt = &d
@@ -1606,6 +2062,14 @@ func toTaskResponse(t *models.Task, childCount int) TaskResponse {
 	return resp
 }
 
+func uuidString(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
+
 // =====================================================
 // Attachment Endpoints
 // =====================================================
@@ -1642,14 +2106,9 @@ func (h *TaskHandler) CreateAttachment(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid task ID")
 	}
 
-	// Verify task exists and belongs to user
-	var exists bool
-	err = h.db.QueryRow(c.Context(),
-		"SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)",
-		taskID, userID,
-	).Scan(&exists)
-	if err != nil || !exists {
-		return httputil.NotFound(c, "task")
+	// Verify task exists and the user may edit it
+	if _, _, err := h.editableTask(c.Context(), taskID, userID); err != nil {
+		return err
 	}
 
 	// Check if it's a link attachment (JSON) or file upload (multipart)
@@ -1762,9 +2221,10 @@ func (h *TaskHandler) DownloadAttachment(c *fiber.Ctx) error {
 	var attachment models.Attachment
 
 	err = h.db.QueryRow(c.Context(),
-		`SELECT id, name, mime_type, data
-		 FROM task_attachments
-		 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		`SELECT a.id, a.name, a.mime_type, a.data
+		 FROM task_attachments a
+		 JOIN tasks t ON t.id = a.task_id
+		 WHERE a.id = $1 AND `+visibleTo("$2")+` AND a.deleted_at IS NULL`,
 		attachmentID, userID,
 	).Scan(&attachment.ID, &attachment.Name, &attachment.MimeType, &attachment.Data)
 
@@ -1800,12 +2260,17 @@ func (h *TaskHandler) GetAttachments(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid task ID")
 	}
 
+	if _, _, err := h.taskAccess(c.Context(), taskID, userID); err != nil {
+		return err
+	}
+
+	// Attachments of shared tasks may come from any participant
 	rows, err := h.db.Query(c.Context(),
 		`SELECT id, task_id, user_id, type, name, url, mime_type, size_bytes, thumbnail_url, metadata, created_at, data
 		 FROM task_attachments
-		 WHERE task_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		 WHERE task_id = $1 AND deleted_at IS NULL
 		 ORDER BY created_at DESC`,
-		taskID, userID,
+		taskID,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "database error")
@@ -1860,9 +2325,14 @@ func (h *TaskHandler) DeleteAttachment(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid attachment ID")
 	}
 
+	// The uploader can always delete; otherwise editing rights on the task are required
 	result, err := h.db.Exec(c.Context(),
-		`UPDATE task_attachments SET deleted_at = $1
-		 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`,
+		`UPDATE task_attachments a SET deleted_at = $1
+		 FROM tasks t
+		 WHERE a.id = $2 AND a.deleted_at IS NULL AND t.id = a.task_id
+		 AND (a.user_id = $3 OR t.user_id = $3 OR EXISTS(
+		   SELECT 1 FROM shared_task_access s WHERE s.task_id = t.id AND s.user_id = $3 AND s.role = 'editor'
+		 ))`,
 		time.Now(), attachmentID, userID,
 	)
 	if err != nil {
@@ -1897,14 +2367,9 @@ func (h *TaskHandler) GetPresignedUploadURL(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid request body")
 	}
 
-	// Verify task exists and belongs to user
-	var exists bool
-	err = h.db.QueryRow(c.Context(),
-		"SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)",
-		taskID, userID,
-	).Scan(&exists)
-	if err != nil || !exists {
-		return httputil.NotFound(c, "task")
+	// Verify task exists and the user may edit it
+	if _, _, err := h.editableTask(c.Context(), taskID, userID); err != nil {
+		return err
 	}
 
 	// In a full implementation, this would:
@@ -1941,104 +2406,13 @@ func toAttachmentResponse(a *models.Attachment) AttachmentResponse {
 // Auto AI Processing
 // =====================================================
 
-// autoProcessTaskWithAI processes a task with AI in the background
-func (h *TaskHandler) autoProcessTaskWithAI(ctx context.Context, userID uuid.UUID, task *models.Task) {
-	if h.aiService == nil || h.llm == nil {
+// queueAIProcessing schedules AI auto-processing of a task on the job queue
+func (h *TaskHandler) queueAIProcessing(ctx context.Context, userID, taskID uuid.UUID, source string) {
+	if h.aiProcessor == nil {
 		return
 	}
-
-	// Use a fresh context since the original may be cancelled
-	bgCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	description := ""
-	if task.Description != nil {
-		description = *task.Description
-	}
-
-	result, err := h.aiService.ProcessTaskOnSave(bgCtx, userID, task.ID, task.Title, description)
-	if err != nil {
-		// Log error but don't fail
-		return
-	}
-
-	// Update task with AI results
-	h.applyAIResultsToTask(bgCtx, userID, task.ID, result)
-}
-
-// applyAIResultsToTask updates the task with AI processing results
-func (h *TaskHandler) applyAIResultsToTask(ctx context.Context, userID, taskID uuid.UUID, result *AIProcessResult) {
-	if result == nil {
-		return
-	}
-
-	// Build dynamic update query
-	updates := []string{}
-	args := []interface{}{}
-	argNum := 1
-
-	// Store cleaned title in ai_cleaned_title (don't modify original title)
-	if result.CleanedTitle != nil {
-		updates = append(updates, fmt.Sprintf("ai_cleaned_title = $%d", argNum))
-		args = append(args, *result.CleanedTitle)
-		argNum++
-	}
-
-	if result.DueAt != nil {
-		updates = append(updates, fmt.Sprintf("due_at = $%d", argNum))
-		args = append(args, *result.DueAt)
-		argNum++
-		// AI extraction sets has_due_time based on whether time was extracted
-		updates = append(updates, fmt.Sprintf("has_due_time = $%d", argNum))
-		args = append(args, result.HasDueTime)
-		argNum++
-		updates = append(updates, "ai_extracted_due = true")
-	}
-
-	if result.Complexity != nil {
-		updates = append(updates, fmt.Sprintf("complexity = $%d", argNum))
-		args = append(args, *result.Complexity)
-		argNum++
-	}
-
-	if len(result.Entities) > 0 {
-		entitiesJSON, _ := json.Marshal(result.Entities)
-		updates = append(updates, fmt.Sprintf("ai_entities = $%d", argNum))
-		args = append(args, entitiesJSON)
-		argNum++
-	}
-
-	if len(updates) == 0 {
-		// Only save draft if generated
-		if result.Draft != nil {
-			h.aiService.SaveDraft(ctx, userID, taskID, result.Draft)
-		}
-		return
-	}
-
-	// Add timestamp update
-	updates = append(updates, fmt.Sprintf("updated_at = $%d", argNum))
-	args = append(args, time.Now())
-	argNum++
-
-	// Add version increment
-	updates = append(updates, "version = version + 1")
-
-	// Add WHERE clause args
-	args = append(args, taskID, userID)
-
-	query := fmt.Sprintf(
-		"UPDATE tasks SET %s WHERE id = $%d AND user_id = $%d",
-		strings.Join(updates, ", "),
-		argNum,
-		argNum+1,
-	)
-
-	_, _ = h.db.Exec(ctx, query, args...)
-
-	// Save draft if generated
-	if result.Draft != nil {
-		h.aiService.SaveDraft(ctx, userID, taskID, result.Draft)
+	if err := h.aiProcessor.Enqueue(ctx, userID, taskID, source); err != nil {
+		fmt.Printf("[AI Queue] Failed to queue task %s: %v\n", taskID, err)
 	}
 }
 
@@ -2084,7 +2458,9 @@ func (h *TaskHandler) GetAIDrafts(c *fiber.Ctx) error {
 	return httputil.Success(c, drafts)
 }
 
-// ApproveDraft marks a draft as approved and optionally sends it
+// ApproveDraft marks a draft as approved. Sending happens in the shared
+// service (POST /ai/drafts/:id/approve), which owns the
+// email client, the per-user send limit and bounce tracking.
 func (h *TaskHandler) ApproveDraft(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -2096,24 +2472,17 @@ func (h *TaskHandler) ApproveDraft(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "invalid draft ID")
 	}
 
-	var req struct {
-		Send bool `json:"send"` // Whether to actually send (email/calendar)
-	}
-	_ = c.BodyParser(&req)
-
-	// Mark draft as approved
-	_, err = h.db.Exec(c.Context(),
-		`UPDATE ai_drafts SET status = $1
-		 WHERE id = $2 AND user_id = $3 AND status = 'draft'`,
-		func() string { if req.Send { return "sent" }; return "approved" }(),
+	result, err := h.db.Exec(c.Context(),
+		`UPDATE ai_drafts SET status = 'approved', updated_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND status = 'draft'`,
 		draftID, userID,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "failed to approve draft")
 	}
-
-	// TODO: Implement actual send functionality for email/calendar
-	// This would integrate with SMTP for email or Google Calendar API
+	if result.RowsAffected() == 0 {
+		return httputil.NotFound(c, "draft")
+	}
 
 	return httputil.Success(c, map[string]string{"status": "approved"})
 }
@@ -2171,7 +2540,8 @@ func (h *TaskHandler) GetUserTier(c *fiber.Ctx) error {
 
 // MergeEntities creates an alias relationship between two entities
 // The source entity becomes an alias of the target (canonical) entity
-// Tasks are NOT modified - the alias is resolved when aggregating entities
+// Tasks are NOT modified - the alias is resolved when aggregating entities,
+// and in the entity directory the source record is folded into the target
 func (h *TaskHandler) MergeEntities(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -2195,15 +2565,19 @@ func (h *TaskHandler) MergeEntities(c *fiber.Ctx) error {
 		return httputil.BadRequest(c, "cannot merge entity with itself")
 	}
 
-	// Insert alias (upsert - update if exists)
-	_, err = h.db.Exec(c.Context(),
-		`INSERT INTO entity_aliases (user_id, entity_type, alias_value, canonical_value)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (user_id, entity_type, alias_value)
-		 DO UPDATE SET canonical_value = $4`,
-		userID, req.Type, req.FromValue, req.ToValue,
-	)
-	if err != nil {
+	if !repository.IsDirectoryType(req.Type) {
+		// Insert alias (upsert - update if exists)
+		_, err = h.db.Exec(c.Context(),
+			`INSERT INTO entity_aliases (user_id, entity_type, alias_value, canonical_value)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (user_id, entity_type, alias_value)
+			 DO UPDATE SET canonical_value = $4`,
+			userID, req.Type, req.FromValue, req.ToValue,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to create entity alias")
+		}
+	} else if err := h.mergeDirectoryEntities(c.Context(), userID, req.Type, req.FromValue, req.ToValue); err != nil {
 		return httputil.InternalError(c, "failed to create entity alias")
 	}
 
@@ -2228,11 +2602,12 @@ func (h *TaskHandler) RemoveEntityFromAllTasks(c *fiber.Ctx) error {
 	}
 
 	// Find all tasks that have this entity
+	filter, _ := json.Marshal([]models.TaskEntity{{Type: entityType, Value: entityValue}})
 	rows, err := h.db.Query(c.Context(),
 		`SELECT id, ai_entities FROM tasks
 		 WHERE user_id = $1 AND deleted_at IS NULL
 		 AND ai_entities @> $2::jsonb`,
-		userID, fmt.Sprintf(`[{"type":"%s","value":"%s"}]`, entityType, entityValue),
+		userID, filter,
 	)
 	if err != nil {
 		return httputil.InternalError(c, "database error")
@@ -2269,15 +2644,30 @@ func (h *TaskHandler) RemoveEntityFromAllTasks(c *fiber.Ctx) error {
 		)
 		if err == nil {
 			updatedCount++
+			if err := syncTaskEntities(c.Context(), h.db, userID, taskID, newEntitiesJSON); err != nil {
+				fmt.Printf("[Entities] Failed to link entities for task %s: %v\n", taskID, err)
+			}
 		}
 	}
+	rows.Close()
 
 	// Also remove any aliases where this entity is the canonical value
-	_, _ = h.db.Exec(c.Context(),
+	var aliasValues []string
+	aliasRows, err := h.db.Query(c.Context(),
 		`DELETE FROM entity_aliases
-		 WHERE user_id = $1 AND entity_type = $2 AND canonical_value = $3`,
+		 WHERE user_id = $1 AND entity_type = $2 AND canonical_value = $3
+		 RETURNING alias_value`,
 		userID, entityType, entityValue,
 	)
+	if err == nil {
+		for aliasRows.Next() {
+			var alias string
+			if aliasRows.Scan(&alias) == nil {
+				aliasValues = append(aliasValues, alias)
+			}
+		}
+		aliasRows.Close()
+	}
 
 	// Also remove alias if this entity was an alias
 	_, _ = h.db.Exec(c.Context(),
@@ -2286,6 +2676,22 @@ func (h *TaskHandler) RemoveEntityFromAllTasks(c *fiber.Ctx) error {
 		userID, entityType, entityValue,
 	)
 
+	// Drop the directory record too; tasks that reached it through one of the
+	// deleted aliases are relinked to entities of their own
+	if repository.IsDirectoryType(entityType) {
+		var entityID uuid.UUID
+		err = h.db.QueryRow(c.Context(),
+			`DELETE FROM entities WHERE user_id = $1 AND entity_type = $2 AND LOWER(name) = LOWER($3)
+			 RETURNING id`,
+			userID, entityType, entityValue,
+		).Scan(&entityID)
+		if err == nil {
+			if err := relinkMentions(c.Context(), h.db, userID, entityType, aliasValues); err != nil {
+				fmt.Printf("[Entities] Failed to relink aliases of %s: %v\n", entityID, err)
+			}
+		}
+	}
+
 	return httputil.Success(c, map[string]interface{}{
 		"message":       fmt.Sprintf("Removed '%s' from %d tasks", entityValue, updatedCount),
 		"updated_count": updatedCount,
@@ -0,0 +1,244 @@
+// Package inbound turns raw RFC 822 / MIME email messages into the pieces
+// needed to create a task, and provides a minimal SMTP listener that accepts
+// them. It has no database access; the tasks service decides what to do with
+// a parsed Message.
+package inbound
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Parsing limits
+const (
+	MaxMessageBytes    = 25 * 1024 * 1024 // Reject anything larger before parsing
+	MaxAttachmentBytes = 10 * 1024 * 1024 // Same cap as uploaded task attachments
+	maxAttachments     = 20
+	maxMIMEDepth       = 10
+)
+
+// ErrTooLarge is returned for messages above MaxMessageBytes
+var ErrTooLarge = errors.New("message too large")
+
+// Message is a parsed inbound email
+type Message struct {
+	MessageID   string   // Message-ID header, or a content hash when missing
+	From        string   // Bare sender address, lowercased
+	Recipients  []string // Bare addresses from To, Cc, Delivered-To and X-Original-To
+	Subject     string
+	Date        time.Time
+	Text        string // First text/plain body part
+	HTML        string // First text/html body part
+	Attachments []Attachment
+}
+
+// Attachment is a file carried by the message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// header is satisfied by both mail.Header and textproto.MIMEHeader
+type header interface {
+	Get(key string) string
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Parse parses a raw RFC 822 message
+func Parse(raw []byte) (*Message, error) {
+	if len(raw) > MaxMessageBytes {
+		return nil, ErrTooLarge
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	msg := &Message{
+		MessageID: strings.Trim(strings.TrimSpace(m.Header.Get("Message-ID")), "<>"),
+		Subject:   decodeHeader(m.Header.Get("Subject")),
+	}
+	if msg.MessageID == "" {
+		// No Message-ID: dedupe on content instead
+		sum := sha256.Sum256(raw)
+		msg.MessageID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	if from, err := mail.ParseAddress(decodeHeader(m.Header.Get("From"))); err == nil {
+		msg.From = strings.ToLower(from.Address)
+	}
+	if date, err := m.Header.Date(); err == nil {
+		msg.Date = date
+	}
+
+	for _, key := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		value := m.Header.Get(key)
+		if value == "" {
+			continue
+		}
+		addrs, err := mail.ParseAddressList(value)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			msg.Recipients = append(msg.Recipients, strings.ToLower(a.Address))
+		}
+	}
+
+	if err := msg.walk(m.Header, m.Body, 0); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// walk collects body parts and attachments from a (possibly multipart) entity
+func (msg *Message) walk(h header, body io.Reader, depth int) error {
+	if depth > maxMIMEDepth {
+		return errors.New("MIME nesting too deep")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		boundary := params["boundary"]
+		if boundary == "" {
+			return errors.New("multipart message without boundary")
+		}
+		mr := multipart.NewReader(body, boundary)
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid multipart body: %w", err)
+			}
+			if err := msg.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(decodeTransfer(h.Get("Content-Transfer-Encoding"), body), MaxMessageBytes))
+	if err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	isBody := disposition != "attachment" && filename == "" &&
+		(mediaType == "text/plain" || mediaType == "text/html")
+	if isBody {
+		text := toUTF8(data, params["charset"])
+		if mediaType == "text/plain" && msg.Text == "" {
+			msg.Text = text
+		} else if mediaType == "text/html" && msg.HTML == "" {
+			msg.HTML = text
+		}
+		return nil
+	}
+
+	// Everything else with content is an attachment (including forwarded
+	// message/rfc822 parts, which are kept whole)
+	if len(data) == 0 || len(data) > MaxAttachmentBytes || len(msg.Attachments) >= maxAttachments {
+		return nil
+	}
+	if filename == "" {
+		filename = "attachment"
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	msg.Attachments = append(msg.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		Data:        data,
+	})
+
+	return nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &whitespaceStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// whitespaceStripper drops spaces and tabs that some mailers leave in base64 bodies
+// (the decoder already ignores line breaks)
+type whitespaceStripper struct {
+	r io.Reader
+}
+
+func (w *whitespaceStripper) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:n] {
+		if b != ' ' && b != '\t' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// charsetReader handles the common single-byte charsets; anything else is
+// passed through and cleaned up by toUTF8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(toUTF8(data, charset)), nil
+}
+
+func toUTF8(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		if utf8.Valid(data) {
+			return string(data)
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return strings.ToValidUTF8(string(data), "�")
+	}
+}
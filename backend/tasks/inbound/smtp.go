@@ -0,0 +1,261 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTP session limits
+const (
+	smtpCommandTimeout = 5 * time.Minute
+	smtpMaxRecipients  = 50
+	smtpDeliverTimeout = 2 * time.Minute
+)
+
+// ErrRejected marks a permanent delivery failure (unknown address, sender
+// not allowed, ...). The SMTP listener answers it with a 5xx code so the
+// sending server gives up instead of retrying.
+var ErrRejected = errors.New("message rejected")
+
+// DeliverFunc receives an accepted message with its envelope
+type DeliverFunc func(ctx context.Context, from string, recipients []string, raw []byte) error
+
+// SMTPServer is a minimal receive-only SMTP listener. It is meant to sit
+// behind an MX or relay that handles TLS and spam filtering, and only speaks
+// the subset of RFC 5321 needed to accept mail.
+type SMTPServer struct {
+	addr       string
+	domain     string
+	deliver    DeliverFunc
+	acceptRcpt func(address string) bool
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	closed   bool
+}
+
+// NewSMTPServer creates a listener for addr. acceptRcpt decides during RCPT TO
+// whether an address exists; deliver is called once per message after DATA.
+func NewSMTPServer(addr, domain string, acceptRcpt func(string) bool, deliver DeliverFunc) *SMTPServer {
+	return &SMTPServer{
+		addr:       addr,
+		domain:     domain,
+		deliver:    deliver,
+		acceptRcpt: acceptRcpt,
+	}
+}
+
+// Start binds the listener and serves connections in the background
+func (s *SMTPServer) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				s.mu.Lock()
+				closed := s.closed
+				s.mu.Unlock()
+				if closed {
+					return
+				}
+				fmt.Printf("[InboundSMTP] Accept failed: %v\n", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes the listener and waits for open sessions to finish
+func (s *SMTPServer) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	s.wg.Wait()
+}
+
+// session holds the envelope of the transaction in progress
+type session struct {
+	from       string
+	recipients []string
+	hasFrom    bool
+}
+
+func (s *SMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) bool {
+		return tp.PrintfLine("%d %s", code, msg) == nil
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(smtpCommandTimeout))
+	if !reply(220, s.domain+" ESMTP Flow") {
+		return
+	}
+
+	var sess session
+	for {
+		_ = conn.SetDeadline(time.Now().Add(smtpCommandTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply(250, s.domain)
+		case "EHLO":
+			_ = tp.PrintfLine("250-%s", s.domain)
+			_ = tp.PrintfLine("250-SIZE %d", MaxMessageBytes)
+			_ = tp.PrintfLine("250-8BITMIME")
+			reply(250, "PIPELINING")
+		case "MAIL":
+			addr, ok := pathArg(arg, "FROM:")
+			if !ok {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			sess = session{from: addr, hasFrom: true}
+			reply(250, "OK")
+		case "RCPT":
+			if !sess.hasFrom {
+				reply(503, "Need MAIL before RCPT")
+				continue
+			}
+			addr, ok := pathArg(arg, "TO:")
+			if !ok || addr == "" {
+				reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+			if len(sess.recipients) >= smtpMaxRecipients {
+				reply(452, "Too many recipients")
+				continue
+			}
+			if !s.acceptRcpt(addr) {
+				reply(550, "No such user")
+				continue
+			}
+			sess.recipients = append(sess.recipients, addr)
+			reply(250, "OK")
+		case "DATA":
+			if len(sess.recipients) == 0 {
+				reply(503, "Need RCPT before DATA")
+				continue
+			}
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			raw, err := readData(tp.R)
+			if err == ErrTooLarge {
+				reply(552, "Message exceeds maximum size")
+				sess = session{}
+				continue
+			}
+			if err != nil {
+				return
+			}
+			reply(s.handleData(sess, raw))
+			sess = session{}
+		case "RSET":
+			sess = session{}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "VRFY":
+			reply(252, "Cannot verify user")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *SMTPServer) handleData(sess session, raw []byte) (int, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), smtpDeliverTimeout)
+	defer cancel()
+
+	err := s.deliver(ctx, sess.from, sess.recipients, raw)
+	switch {
+	case err == nil:
+		return 250, "OK: queued"
+	case errors.Is(err, ErrRejected):
+		return 550, err.Error()
+	default:
+		fmt.Printf("[InboundSMTP] Delivery failed: %v\n", err)
+		return 451, "Temporary failure, try again later"
+	}
+}
+
+// readData reads a dot-terminated DATA section, enforcing MaxMessageBytes.
+// The rest of an oversized message is drained so the session stays usable.
+func readData(r *bufio.Reader) ([]byte, error) {
+	dot := textproto.NewReader(r).DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dot, MaxMessageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > MaxMessageBytes {
+		_, _ = io.Copy(io.Discard, dot)
+		return nil, ErrTooLarge
+	}
+	return raw, nil
+}
+
+// pathArg parses "FROM:<addr> [params]" / "TO:<addr> [params]".
+// The null reverse-path "<>" yields an empty address.
+func pathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if i := strings.IndexByte(path, ' '); i > 0 {
+		path = path[:i] // drop ESMTP parameters such as SIZE=
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "<"), ">")
+	if path == "" {
+		return "", true
+	}
+
+	addr, err := mail.ParseAddress(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
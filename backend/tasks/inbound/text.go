@@ -0,0 +1,96 @@
+package inbound
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// maxDescriptionLen caps the description built from an email body
+const maxDescriptionLen = 10000
+
+var (
+	subjectPrefixRe = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|wg|tr)\s*(\[\d+\])?\s*:\s*)+`)
+	hashtagRe       = regexp.MustCompile(`(?:^|\s)(#[\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+	spacesRe        = regexp.MustCompile(`[ \t\x{00a0}]+`)
+	blankLinesRe    = regexp.MustCompile(`\n{3,}`)
+
+	htmlDropRe  = regexp.MustCompile(`(?is)<(script|style|head|title)[^>]*>.*?</(script|style|head|title)>`)
+	htmlBreakRe = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/tr|/h[1-6]|/blockquote)\s*/?\s*>`)
+	htmlItemRe  = regexp.MustCompile(`(?i)<\s*li[^>]*>`)
+	htmlTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+
+	// "On Mon, 1 Jan 2024 at 10:00, Sam <sam@example.com> wrote:"
+	replyHeaderRe = regexp.MustCompile(`(?i)^on .+ wrote:$`)
+)
+
+// ParseSubject strips reply/forward prefixes and pulls hashtags out of the
+// subject. "Fwd: Buy milk #Groceries" -> ("Buy milk", ["#Groceries"]).
+func ParseSubject(subject string) (string, []string) {
+	subject = subjectPrefixRe.ReplaceAllString(strings.TrimSpace(subject), "")
+
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, match := range hashtagRe.FindAllStringSubmatch(subject, -1) {
+		tag := strings.TrimRight(match[1], "/-")
+		if key := strings.ToLower(tag); !seen[key] {
+			seen[key] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	title := hashtagRe.ReplaceAllString(subject, " ")
+	title = strings.TrimSpace(spacesRe.ReplaceAllString(title, " "))
+	if title == "" {
+		title = "(no subject)"
+	}
+
+	return title, tags
+}
+
+// HTMLToText converts an HTML body into readable plain text
+func HTMLToText(body string) string {
+	body = htmlDropRe.ReplaceAllString(body, "")
+	body = htmlItemRe.ReplaceAllString(body, "\n- ")
+	body = htmlBreakRe.ReplaceAllString(body, "\n")
+	body = htmlTagRe.ReplaceAllString(body, "")
+	return html.UnescapeString(body)
+}
+
+// Description builds a task description from the message: the plain-text
+// body when present, otherwise the HTML body converted to text, with quoted
+// replies and signatures removed.
+func (msg *Message) Description() string {
+	body := msg.Text
+	if strings.TrimSpace(body) == "" && msg.HTML != "" {
+		body = HTMLToText(msg.HTML)
+	}
+	return CleanBody(body)
+}
+
+// CleanBody normalizes whitespace and cuts quoted replies and signatures
+func CleanBody(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		// Everything after a signature delimiter or a reply header is history
+		if line == "-- " || line == "--" || replyHeaderRe.MatchString(trimmed) {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+
+		lines = append(lines, strings.TrimRight(spacesRe.ReplaceAllString(line, " "), " "))
+	}
+
+	cleaned := strings.TrimSpace(blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	if len(cleaned) > maxDescriptionLen {
+		cleaned = strings.ToValidUTF8(cleaned[:maxDescriptionLen], "") + "…"
+	}
+
+	return cleaned
+}
@@ -0,0 +1,662 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
+	"github.com/csaptu/flow/tasks/inbound"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// Inbound delivery outcomes
+const (
+	InboundStatusCreated   = "created"
+	InboundStatusDuplicate = "duplicate"
+	InboundStatusRejected  = "rejected"
+)
+
+// maxAllowedSenders caps the allow-list size per user
+const maxAllowedSenders = 50
+
+// InboundEmailHandler turns emails sent to a user's forwarding address into
+// tasks. Messages arrive through the inbound-parse webhook or the optional
+// SMTP listener; both end up in Deliver.
+type InboundEmailHandler struct {
+	db     *pgxpool.Pool
+	tasks  *TaskHandler
+	domain string
+	secret string
+}
+
+// NewInboundEmailHandler creates a new inbound email handler
+func NewInboundEmailHandler(db *pgxpool.Pool, taskHandler *TaskHandler, cfg config.EmailConfig) *InboundEmailHandler {
+	return &InboundEmailHandler{
+		db:     db,
+		tasks:  taskHandler,
+		domain: strings.ToLower(cfg.InboundDomain),
+		secret: cfg.InboundSecret,
+	}
+}
+
+// inboundAddress is a user's forwarding address and its settings
+type inboundAddress struct {
+	UserID         uuid.UUID
+	Token          string
+	AllowedSenders []string
+	AICleanup      bool
+	Enabled        bool
+}
+
+// InboundSettingsResponse represents the user's forwarding address
+type InboundSettingsResponse struct {
+	Address        string   `json:"address"`
+	AllowedSenders []string `json:"allowed_senders"` // the account email is always allowed
+	AICleanup      bool     `json:"ai_cleanup"`
+	Enabled        bool     `json:"enabled"`
+}
+
+// UpdateInboundSettingsRequest updates the forwarding settings
+type UpdateInboundSettingsRequest struct {
+	AllowedSenders []string `json:"allowed_senders,omitempty"` // addresses or "@domain.com"
+	AICleanup      *bool    `json:"ai_cleanup,omitempty"`
+	Enabled        *bool    `json:"enabled,omitempty"`
+}
+
+// InboundMessageResponse represents a received message in the log
+type InboundMessageResponse struct {
+	ID         string  `json:"id"`
+	MessageID  string  `json:"message_id"`
+	Sender     string  `json:"sender"`
+	Subject    string  `json:"subject"`
+	Status     string  `json:"status"`
+	Reason     *string `json:"reason,omitempty"`
+	TaskID     *string `json:"task_id,omitempty"`
+	ReceivedAt string  `json:"received_at"`
+}
+
+// InboundDeliveryResult is the outcome of a message for one recipient
+type InboundDeliveryResult struct {
+	Recipient string  `json:"recipient"`
+	Status    string  `json:"status"`
+	TaskID    *string `json:"task_id,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// =====================================================
+// Settings Endpoints
+// =====================================================
+
+// GetSettings returns the user's forwarding address, creating it on first use
+// GET /inbound-email
+func (h *InboundEmailHandler) GetSettings(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	addr, err := h.ensureAddress(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load inbound address")
+	}
+
+	return httputil.Success(c, h.toSettingsResponse(addr))
+}
+
+// UpdateSettings updates the allow-list, AI cleanup and enabled flags
+// PUT /inbound-email
+func (h *InboundEmailHandler) UpdateSettings(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req UpdateInboundSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	addr, err := h.ensureAddress(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load inbound address")
+	}
+
+	if req.AllowedSenders != nil {
+		senders, invalid := normalizeSenders(req.AllowedSenders)
+		if invalid != "" {
+			return httputil.ValidationError(c, "validation failed", map[string]string{
+				"allowed_senders": "invalid address: " + invalid,
+			})
+		}
+		if len(senders) > maxAllowedSenders {
+			return httputil.ValidationError(c, "validation failed", map[string]string{
+				"allowed_senders": fmt.Sprintf("at most %d entries", maxAllowedSenders),
+			})
+		}
+		addr.AllowedSenders = senders
+	}
+	if req.AICleanup != nil {
+		addr.AICleanup = *req.AICleanup
+	}
+	if req.Enabled != nil {
+		addr.Enabled = *req.Enabled
+	}
+
+	_, err = h.db.Exec(c.Context(),
+		`UPDATE inbound_email_addresses
+		 SET allowed_senders = $1, ai_cleanup = $2, enabled = $3, updated_at = NOW()
+		 WHERE user_id = $4`,
+		addr.AllowedSenders, addr.AICleanup, addr.Enabled, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update inbound settings")
+	}
+
+	return httputil.Success(c, h.toSettingsResponse(addr))
+}
+
+// RotateAddress replaces the forwarding address; the old one stops working
+// POST /inbound-email/rotate
+func (h *InboundEmailHandler) RotateAddress(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	addr, err := h.ensureAddress(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to load inbound address")
+	}
+
+	token, err := generateInboundToken()
+	if err != nil {
+		return httputil.InternalError(c, "failed to generate address")
+	}
+
+	_, err = h.db.Exec(c.Context(),
+		"UPDATE inbound_email_addresses SET token = $1, updated_at = NOW() WHERE user_id = $2",
+		token, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to rotate address")
+	}
+	addr.Token = token
+
+	return httputil.Success(c, h.toSettingsResponse(addr))
+}
+
+// ListMessages returns the most recent received messages
+// GET /inbound-email/messages
+func (h *InboundEmailHandler) ListMessages(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT id, message_id, sender, subject, status, reason, task_id, received_at
+		 FROM inbound_email_messages
+		 WHERE user_id = $1
+		 ORDER BY received_at DESC
+		 LIMIT 50`,
+		userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	items := make([]InboundMessageResponse, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		var taskID *uuid.UUID
+		var receivedAt time.Time
+		var m InboundMessageResponse
+		if err := rows.Scan(&id, &m.MessageID, &m.Sender, &m.Subject, &m.Status, &m.Reason, &taskID, &receivedAt); err != nil {
+			continue
+		}
+		m.ID = id.String()
+		m.TaskID = uuidString(taskID)
+		m.ReceivedAt = receivedAt.Format(time.RFC3339)
+		items = append(items, m)
+	}
+
+	return httputil.Success(c, items)
+}
+
+// =====================================================
+// Delivery
+// =====================================================
+
+// Webhook accepts messages from an inbound-parse provider.
+// The body is either the raw message (message/rfc822), or a multipart form
+// with the raw message in "email" and optional "to" / "envelope" fields.
+// Authenticated with INBOUND_EMAIL_SECRET in the X-Inbound-Secret header;
+// it is never read from the query string, where it would end up in logs.
+// POST /webhooks/inbound-email
+func (h *InboundEmailHandler) Webhook(c *fiber.Ctx) error {
+	if h.secret == "" {
+		return httputil.ServiceUnavailable(c, "inbound email is not configured")
+	}
+
+	provided := c.Get("X-Inbound-Secret")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(h.secret)) != 1 {
+		return httputil.Unauthorized(c, "invalid inbound secret")
+	}
+
+	var raw []byte
+	var from string
+	var recipients []string
+	if form, err := c.MultipartForm(); err == nil {
+		raw = []byte(firstValue(form.Value["email"]))
+		if envelope := firstValue(form.Value["envelope"]); envelope != "" {
+			var env struct {
+				From string   `json:"from"`
+				To   []string `json:"to"`
+			}
+			if json.Unmarshal([]byte(envelope), &env) == nil {
+				from, recipients = env.From, env.To
+			}
+		}
+		if len(recipients) == 0 {
+			if addrs, err := mail.ParseAddressList(firstValue(form.Value["to"])); err == nil {
+				for _, a := range addrs {
+					recipients = append(recipients, a.Address)
+				}
+			}
+		}
+	} else {
+		raw = c.Body()
+	}
+
+	if len(raw) == 0 {
+		return httputil.BadRequest(c, "empty message")
+	}
+
+	results, err := h.Deliver(c.Context(), from, recipients, raw)
+	if err != nil && !errors.Is(err, inbound.ErrRejected) {
+		// Non-2xx makes the provider retry; Message-ID dedupe keeps retries safe
+		return httputil.InternalError(c, "failed to process message")
+	}
+	if err != nil && len(results) == 0 {
+		// Rejections are acknowledged so the provider doesn't retry them
+		results = []InboundDeliveryResult{{Status: InboundStatusRejected, Reason: err.Error()}}
+	}
+
+	return httputil.Success(c, results)
+}
+
+// AcceptRecipient reports whether an address belongs to an enabled user.
+// Used by the SMTP listener during RCPT TO.
+func (h *InboundEmailHandler) AcceptRecipient(address string) bool {
+	token, ok := h.tokenFromAddress(address)
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr, err := h.addressByToken(ctx, token)
+	return err == nil && addr != nil && addr.Enabled
+}
+
+// DeliverSMTP adapts Deliver to the SMTP listener
+func (h *InboundEmailHandler) DeliverSMTP(ctx context.Context, from string, recipients []string, raw []byte) error {
+	_, err := h.Deliver(ctx, from, recipients, raw)
+	return err
+}
+
+// Deliver parses a raw message and creates a task for every recipient that is
+// a forwarding address. Recipients default to the message's own headers when
+// the transport didn't provide an envelope. Returns an error wrapping
+// inbound.ErrRejected when nothing could be delivered for permanent reasons.
+func (h *InboundEmailHandler) Deliver(ctx context.Context, from string, recipients []string, raw []byte) ([]InboundDeliveryResult, error) {
+	msg, err := inbound.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", inbound.ErrRejected, err)
+	}
+	if len(recipients) == 0 {
+		recipients = msg.Recipients
+	}
+
+	results := make([]InboundDeliveryResult, 0)
+	seen := make(map[string]bool)
+	var deliverErr error
+
+	for _, recipient := range recipients {
+		token, ok := h.tokenFromAddress(recipient)
+		if !ok || seen[token] {
+			continue
+		}
+		seen[token] = true
+
+		addr, err := h.addressByToken(ctx, token)
+		if err != nil {
+			deliverErr = err
+			continue
+		}
+		if addr == nil {
+			continue
+		}
+
+		result, err := h.deliverTo(ctx, addr, msg, strings.ToLower(from))
+		if err != nil {
+			fmt.Printf("[InboundEmail] Failed to deliver %s to user %s: %v\n", msg.MessageID, addr.UserID, err)
+			deliverErr = err
+			continue
+		}
+		result.Recipient = strings.ToLower(recipient)
+		results = append(results, result)
+	}
+
+	if deliverErr != nil {
+		return results, deliverErr
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: no such recipient", inbound.ErrRejected)
+	}
+	for _, r := range results {
+		if r.Status != InboundStatusRejected {
+			return results, nil
+		}
+	}
+	return results, fmt.Errorf("%w: %s", inbound.ErrRejected, results[0].Reason)
+}
+
+// deliverTo creates the task for one user. The log entry, the task and its
+// attachments are written in one transaction so a retried message never
+// produces a partial or second task.
+func (h *InboundEmailHandler) deliverTo(ctx context.Context, addr *inboundAddress, msg *inbound.Message, envelopeFrom string) (InboundDeliveryResult, error) {
+	sender := msg.From
+	if sender == "" {
+		sender = envelopeFrom
+	}
+
+	if !addr.Enabled {
+		return h.reject(ctx, addr.UserID, msg, sender, "forwarding address is disabled")
+	}
+	if !h.senderAllowed(ctx, addr, msg.From, envelopeFrom) {
+		return h.reject(ctx, addr.UserID, msg, sender, "sender is not on the allow-list")
+	}
+
+	title, tags := inbound.ParseSubject(msg.Subject)
+	description := msg.Description()
+
+	// Hashtags of a list shared with the user as editor file the task there
+	ownerID := addr.UserID
+	if listOwner, ok := h.tasks.sharedListOwner(ctx, addr.UserID, tags); ok {
+		ownerID = listOwner
+	}
+
+	task := models.NewTask(ownerID, title)
+	task.Tags = tags
+	task.CreatedBy = &addr.UserID
+	task.LastModifiedBy = &addr.UserID
+	if description != "" {
+		task.Description = &description
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return InboundDeliveryResult{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var logID uuid.UUID
+	err = tx.QueryRow(ctx,
+		`INSERT INTO inbound_email_messages (user_id, message_id, sender, subject, status)
+		 VALUES ($1, $2, $3, $4, 'created')
+		 ON CONFLICT (user_id, message_id) WHERE status = 'created' DO NOTHING
+		 RETURNING id`,
+		addr.UserID, msg.MessageID, sender, msg.Subject,
+	).Scan(&logID)
+	if err == pgx.ErrNoRows {
+		return InboundDeliveryResult{Status: InboundStatusDuplicate}, nil
+	}
+	if err != nil {
+		return InboundDeliveryResult{}, err
+	}
+
+	entitiesJSON, _ := json.Marshal(task.Entities)
+	_, err = tx.Exec(ctx,
+		`INSERT INTO tasks (id, user_id, title, description, status, priority, due_at, has_due_time, tags,
+		 parent_id, depth, ai_entities, version, created_at, updated_at, created_by, last_modified_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		task.ID, task.UserID, task.Title, task.Description, task.Status, task.Priority,
+		task.DueAt, task.HasDueTime, task.Tags, task.ParentID, task.Depth, entitiesJSON,
+		task.Version, task.CreatedAt, task.UpdatedAt, task.CreatedBy, task.LastModifiedBy,
+	)
+	if err != nil {
+		return InboundDeliveryResult{}, err
+	}
+
+	for _, a := range msg.Attachments {
+		attachment := models.NewFileAttachmentWithData(task.ID, addr.UserID, a.Filename, a.ContentType, a.Data)
+		metadataJSON, _ := json.Marshal(map[string]any{"source": "email"})
+		_, err = tx.Exec(ctx,
+			`INSERT INTO task_attachments (id, task_id, user_id, type, name, url, mime_type, size_bytes, data, metadata, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			attachment.ID, attachment.TaskID, attachment.UserID, attachment.Type,
+			attachment.Name, "", attachment.MimeType, attachment.SizeBytes, attachment.Data, metadataJSON, attachment.CreatedAt,
+		)
+		if err != nil {
+			return InboundDeliveryResult{}, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE inbound_email_messages SET task_id = $1 WHERE id = $2", task.ID, logID)
+	if err != nil {
+		return InboundDeliveryResult{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return InboundDeliveryResult{}, err
+	}
+
+	h.tasks.recordActivity(ctx, task.ID, addr.UserID, "created", nil)
+	publishTaskEvent(ownerID, webhook.EventTaskCreated, toTaskResponse(task, 0))
+
+	// AI runs only on the user's own tasks, as with tasks created in the app
+	if ownerID == addr.UserID {
+		go h.processWithAI(addr, task, msg.Subject, description)
+	}
+
+	taskID := task.ID.String()
+	return InboundDeliveryResult{Status: InboundStatusCreated, TaskID: &taskID}, nil
+}
+
+// processWithAI runs the optional email cleanup pass, then queues the
+// regular auto-processing every new task gets
+func (h *InboundEmailHandler) processWithAI(addr *inboundAddress, task *models.Task, subject, description string) {
+	if addr.AICleanup && description != "" && h.tasks.aiService != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		cleaned, err := h.tasks.aiService.CleanEmailBody(ctx, addr.UserID, subject, description)
+		if err != nil {
+			fmt.Printf("[InboundEmail] AI cleanup skipped for task %s: %v\n", task.ID, err)
+		} else if cleaned != "" {
+			_, err = h.db.Exec(ctx,
+				`UPDATE tasks SET ai_cleaned_description = $1, version = version + 1, updated_at = NOW()
+				 WHERE id = $2 AND user_id = $3`,
+				cleaned, task.ID, addr.UserID,
+			)
+			if err != nil {
+				fmt.Printf("[InboundEmail] Failed to save AI cleanup for task %s: %v\n", task.ID, err)
+			}
+		}
+		cancel()
+	}
+
+	h.tasks.queueAIProcessing(context.Background(), addr.UserID, task.ID, AIJobSourceInboundEmail)
+}
+
+// reject records a refused message and returns its result
+func (h *InboundEmailHandler) reject(ctx context.Context, userID uuid.UUID, msg *inbound.Message, sender, reason string) (InboundDeliveryResult, error) {
+	_, err := h.db.Exec(ctx,
+		`INSERT INTO inbound_email_messages (user_id, message_id, sender, subject, status, reason)
+		 VALUES ($1, $2, $3, $4, 'rejected', $5)`,
+		userID, msg.MessageID, sender, msg.Subject, reason,
+	)
+	if err != nil {
+		fmt.Printf("[InboundEmail] Failed to log rejected message %s: %v\n", msg.MessageID, err)
+	}
+
+	return InboundDeliveryResult{Status: InboundStatusRejected, Reason: reason}, nil
+}
+
+// senderAllowed checks the sender (From header or envelope) against the
+// account email and the user's allow-list
+func (h *InboundEmailHandler) senderAllowed(ctx context.Context, addr *inboundAddress, senders ...string) bool {
+	allowed := append([]string{}, addr.AllowedSenders...)
+	if user, err := repository.GetUserByID(ctx, addr.UserID); err == nil && user != nil {
+		allowed = append(allowed, strings.ToLower(user.Email))
+	}
+
+	for _, sender := range senders {
+		if sender == "" {
+			continue
+		}
+		for _, entry := range allowed {
+			if sender == entry || (strings.HasPrefix(entry, "@") && strings.HasSuffix(sender, entry)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// =====================================================
+// Helpers
+// =====================================================
+
+// ensureAddress returns the user's address, creating one on first use
+func (h *InboundEmailHandler) ensureAddress(ctx context.Context, userID uuid.UUID) (*inboundAddress, error) {
+	token, err := generateInboundToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = h.db.Exec(ctx,
+		`INSERT INTO inbound_email_addresses (user_id, token)
+		 VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO NOTHING`,
+		userID, token,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var addr inboundAddress
+	err = h.db.QueryRow(ctx,
+		`SELECT user_id, token, allowed_senders, ai_cleanup, enabled
+		 FROM inbound_email_addresses WHERE user_id = $1`,
+		userID,
+	).Scan(&addr.UserID, &addr.Token, &addr.AllowedSenders, &addr.AICleanup, &addr.Enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	return &addr, nil
+}
+
+// addressByToken looks up an address; returns nil if the token is unknown
+func (h *InboundEmailHandler) addressByToken(ctx context.Context, token string) (*inboundAddress, error) {
+	var addr inboundAddress
+	err := h.db.QueryRow(ctx,
+		`SELECT user_id, token, allowed_senders, ai_cleanup, enabled
+		 FROM inbound_email_addresses WHERE token = $1`,
+		token,
+	).Scan(&addr.UserID, &addr.Token, &addr.AllowedSenders, &addr.AICleanup, &addr.Enabled)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &addr, nil
+}
+
+// tokenFromAddress extracts the token from "<token>@<domain>"
+func (h *InboundEmailHandler) tokenFromAddress(address string) (string, bool) {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+
+	at := strings.LastIndexByte(address, '@')
+	if at <= 0 || !strings.EqualFold(address[at+1:], h.domain) {
+		return "", false
+	}
+	return strings.ToLower(address[:at]), true
+}
+
+func (h *InboundEmailHandler) toSettingsResponse(addr *inboundAddress) InboundSettingsResponse {
+	senders := addr.AllowedSenders
+	if senders == nil {
+		senders = []string{}
+	}
+	return InboundSettingsResponse{
+		Address:        addr.Token + "@" + h.domain,
+		AllowedSenders: senders,
+		AICleanup:      addr.AICleanup,
+		Enabled:        addr.Enabled,
+	}
+}
+
+// normalizeSenders lowercases and dedupes allow-list entries. Returns the
+// first invalid entry, if any.
+func normalizeSenders(entries []string) ([]string, string) {
+	senders := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" || seen[entry] {
+			continue
+		}
+
+		if strings.HasPrefix(entry, "@") {
+			if len(entry) < 4 || !strings.Contains(entry, ".") {
+				return nil, entry
+			}
+		} else if parsed, err := mail.ParseAddress(entry); err != nil || parsed.Address != entry {
+			return nil, entry
+		}
+
+		seen[entry] = true
+		senders = append(senders, entry)
+	}
+	return senders, ""
+}
+
+// generateInboundToken creates the random local part of a forwarding address
+func generateInboundToken() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,628 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/webhook"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// Due date choices when merging
+const (
+	MergeDueEarliest  = "earliest"  // Earliest of the two (default)
+	MergeDueCanonical = "canonical" // Keep the kept task's due date
+	MergeDueSource    = "source"    // Take the merged-away task's due date
+)
+
+// MergeRequest merges source_id into the task in the URL
+type MergeRequest struct {
+	SourceID string  `json:"source_id"`     // Task merged away
+	Due      *string `json:"due,omitempty"` // earliest (default), canonical or source
+}
+
+// MergeResponse is the kept task after a merge
+type MergeResponse struct {
+	MergeID      string       `json:"merge_id"` // Pass to /tasks/merges/:id/undo
+	MergedTaskID string       `json:"merged_task_id"`
+	Task         TaskResponse `json:"task"`
+}
+
+// MergeHistoryItem is a task that was merged into another
+type MergeHistoryItem struct {
+	ID           string  `json:"id"`
+	MergedTaskID string  `json:"merged_task_id"`
+	MergedTitle  string  `json:"merged_title"`
+	MergedBy     string  `json:"merged_by"`
+	CreatedAt    string  `json:"created_at"`
+	UndoneAt     *string `json:"undone_at,omitempty"`
+}
+
+// mergeSnapshot is the state a merge changed, stored so it can be undone
+type mergeSnapshot struct {
+	Description   *string            `json:"description"`
+	Tags          []string           `json:"tags"`
+	Entities      json.RawMessage    `json:"entities"`
+	DueAt         *time.Time         `json:"due_at"`
+	HasDueTime    bool               `json:"has_due_time"`
+	Children      []mergeChildState  `json:"children"`    // Subtasks moved from the merged task
+	Attachments   []uuid.UUID        `json:"attachments"` // Attachments moved from the merged task
+	DuplicateRefs []mergeDuplicateOf `json:"duplicate_refs"`
+}
+
+type mergeChildState struct {
+	ID        uuid.UUID `json:"id"`
+	SortOrder int       `json:"sort_order"`
+}
+
+// mergeDuplicateOf is a task whose duplicate_of pointed at the merged task
+type mergeDuplicateOf struct {
+	TaskID            uuid.UUID `json:"task_id"`
+	DuplicateOf       []string  `json:"duplicate_of"`
+	DuplicateResolved bool      `json:"duplicate_resolved"`
+}
+
+// mergeTask is the part of a task a merge reads
+type mergeTask struct {
+	ID          uuid.UUID
+	Title       string
+	Description *string
+	Tags        []string
+	Entities    []byte
+	DueAt       *time.Time
+	HasDueTime  bool
+	ParentID    *uuid.UUID
+	Depth       int
+}
+
+// Merge folds a duplicate task into this one: subtasks and attachments move
+// over, tags and entities are combined, the due date is chosen, other tasks'
+// duplicate_of references are repointed and the duplicate is soft-deleted.
+// POST /tasks/:id/merge
+func (h *TaskHandler) Merge(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	canonicalID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+
+	var req MergeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	sourceID, err := uuid.Parse(req.SourceID)
+	if err != nil {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"source_id": "must be a task ID",
+		})
+	}
+	if sourceID == canonicalID {
+		return httputil.BadRequest(c, "a task can't be merged into itself")
+	}
+	due := MergeDueEarliest
+	if req.Due != nil && *req.Due != "" {
+		due = *req.Due
+	}
+	if due != MergeDueEarliest && due != MergeDueCanonical && due != MergeDueSource {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"due": "must be earliest, canonical or source",
+		})
+	}
+
+	ownerID, _, err := h.editableTask(c.Context(), canonicalID, userID)
+	if err != nil {
+		return err
+	}
+	sourceOwnerID, sourceRole, err := h.editableTask(c.Context(), sourceID, userID)
+	if err != nil {
+		return err
+	}
+	if sourceOwnerID != ownerID {
+		return httputil.BadRequest(c, "only tasks in the same list can be merged")
+	}
+	if sourceRole != RoleOwner {
+		// Merging deletes the source, so the same rule as Delete applies
+		var isShareRoot bool
+		_ = h.db.QueryRow(c.Context(),
+			"SELECT EXISTS(SELECT 1 FROM task_shares WHERE task_id = $1)",
+			sourceID,
+		).Scan(&isShareRoot)
+		if isShareRoot {
+			return httputil.Forbidden(c, "only the owner can merge away a shared task")
+		}
+	}
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	canonical, err := lockMergeTask(c.Context(), tx, canonicalID, ownerID)
+	if err != nil {
+		return err
+	}
+	source, err := lockMergeTask(c.Context(), tx, sourceID, ownerID)
+	if err != nil {
+		return err
+	}
+	if (source.ParentID != nil && *source.ParentID == canonicalID) ||
+		(canonical.ParentID != nil && *canonical.ParentID == sourceID) {
+		return httputil.BadRequest(c, "a task can't be merged with its own parent or subtask")
+	}
+
+	snapshot := mergeSnapshot{
+		Description:   canonical.Description,
+		Tags:          canonical.Tags,
+		Entities:      canonical.Entities,
+		DueAt:         canonical.DueAt,
+		HasDueTime:    canonical.HasDueTime,
+		Children:      []mergeChildState{},
+		Attachments:   []uuid.UUID{},
+		DuplicateRefs: []mergeDuplicateOf{},
+	}
+
+	// Subtasks: appended after the kept task's own, in their previous order
+	rows, err := tx.Query(c.Context(),
+		`SELECT id, sort_order FROM tasks
+		 WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		 ORDER BY sort_order ASC, created_at ASC`,
+		sourceID, ownerID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	for rows.Next() {
+		var child mergeChildState
+		if err := rows.Scan(&child.ID, &child.SortOrder); err == nil {
+			snapshot.Children = append(snapshot.Children, child)
+		}
+	}
+	rows.Close()
+
+	if len(snapshot.Children) > 0 {
+		if canonical.Depth > 0 {
+			return httputil.BadRequest(c, "maximum task depth exceeded: merge a task with subtasks into a top-level task")
+		}
+
+		var maxSortOrder int
+		err = tx.QueryRow(c.Context(),
+			"SELECT COALESCE(MAX(sort_order), -1) FROM tasks WHERE parent_id = $1 AND deleted_at IS NULL",
+			canonicalID,
+		).Scan(&maxSortOrder)
+		if err != nil {
+			return httputil.InternalError(c, "database error")
+		}
+		for i, child := range snapshot.Children {
+			_, err = tx.Exec(c.Context(),
+				`UPDATE tasks SET parent_id = $1, depth = 1, sort_order = $2, version = version + 1,
+				 updated_at = NOW(), last_modified_by = $3
+				 WHERE id = $4`,
+				canonicalID, maxSortOrder+1+i, userID, child.ID,
+			)
+			if err != nil {
+				return httputil.InternalError(c, "failed to move subtasks")
+			}
+		}
+	}
+
+	// Attachments
+	rows, err = tx.Query(c.Context(),
+		"UPDATE task_attachments SET task_id = $1 WHERE task_id = $2 RETURNING id",
+		canonicalID, sourceID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to move attachments")
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err == nil {
+			snapshot.Attachments = append(snapshot.Attachments, id)
+		}
+	}
+	rows.Close()
+
+	// Repoint duplicate_of references (including the kept task's own)
+	refs, err := h.repointDuplicateRefs(c.Context(), tx, ownerID, sourceID, canonicalID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update duplicate references")
+	}
+	snapshot.DuplicateRefs = refs
+
+	// Combined fields for the kept task
+	description := canonical.Description
+	if (description == nil || strings.TrimSpace(*description) == "") && source.Description != nil {
+		description = source.Description
+	}
+	dueAt, hasDueTime := chooseMergeDue(due, canonical, source)
+	entitiesJSON, _ := json.Marshal(mergeEntities(canonical.Entities, source.Entities))
+
+	_, err = tx.Exec(c.Context(),
+		`UPDATE tasks SET description = $1, tags = $2, ai_entities = $3, due_at = $4, has_due_time = $5,
+		 version = version + 1, updated_at = NOW(), last_modified_by = $6
+		 WHERE id = $7`,
+		description, mergeTags(canonical.Tags, source.Tags), entitiesJSON, dueAt, hasDueTime, userID, canonicalID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update task")
+	}
+	if err := syncTaskEntities(c.Context(), tx, ownerID, canonicalID, entitiesJSON); err != nil {
+		return httputil.InternalError(c, "failed to link entities")
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(c.Context(),
+		`UPDATE tasks SET deleted_at = $1, merged_into = $2, version = version + 1, last_modified_by = $3
+		 WHERE id = $4`,
+		now, canonicalID, userID, sourceID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to remove merged task")
+	}
+
+	snapshotJSON, _ := json.Marshal(snapshot)
+	var mergeID uuid.UUID
+	err = tx.QueryRow(c.Context(),
+		`INSERT INTO task_merges (user_id, canonical_id, merged_id, merged_title, merged_by, snapshot)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id`,
+		ownerID, canonicalID, sourceID, source.Title, userID, snapshotJSON,
+	).Scan(&mergeID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to record merge")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to merge tasks")
+	}
+
+	h.recordActivity(c.Context(), canonicalID, userID, "merged", []string{sourceID.String()})
+	go webhook.Publish(context.Background(), ownerID, webhook.EventTaskDeleted, map[string]string{
+		"id":          sourceID.String(),
+		"deleted_at":  now.Format(time.RFC3339),
+		"merged_into": canonicalID.String(),
+	})
+
+	task, childCount, err := h.getTask(c.Context(), canonicalID, userID)
+	if err != nil {
+		return err
+	}
+	resp := toTaskResponse(task, childCount)
+	publishTaskEvent(ownerID, webhook.EventTaskUpdated, resp)
+
+	return httputil.Success(c, MergeResponse{
+		MergeID:      mergeID.String(),
+		MergedTaskID: sourceID.String(),
+		Task:         resp,
+	})
+}
+
+// UndoMerge restores a merged-away task and reverts the kept task
+// POST /tasks/merges/:mergeId/undo
+func (h *TaskHandler) UndoMerge(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	mergeID, err := uuid.Parse(c.Params("mergeId"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid merge ID")
+	}
+
+	var ownerID, canonicalID, sourceID uuid.UUID
+	var snapshotJSON []byte
+	var undoneAt *time.Time
+	err = h.db.QueryRow(c.Context(),
+		`SELECT user_id, canonical_id, merged_id, snapshot, undone_at FROM task_merges WHERE id = $1`,
+		mergeID,
+	).Scan(&ownerID, &canonicalID, &sourceID, &snapshotJSON, &undoneAt)
+	if err == pgx.ErrNoRows {
+		return httputil.NotFound(c, "merge")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	// Editing rights on the kept task are enough to undo
+	if owner, _, err := h.editableTask(c.Context(), canonicalID, userID); err != nil {
+		return err
+	} else if owner != ownerID {
+		return httputil.NotFound(c, "merge")
+	}
+	if undoneAt != nil {
+		return httputil.Conflict(c, "merge was already undone")
+	}
+
+	var snapshot mergeSnapshot
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return httputil.InternalError(c, "invalid merge record")
+	}
+
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	result, err := tx.Exec(c.Context(),
+		`UPDATE tasks SET deleted_at = NULL, merged_into = NULL, version = version + 1, updated_at = NOW(),
+		 last_modified_by = $1
+		 WHERE id = $2 AND merged_into = $3 AND deleted_at IS NOT NULL`,
+		userID, sourceID, canonicalID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to restore task")
+	}
+	if result.RowsAffected() == 0 {
+		return httputil.Conflict(c, "the merged task can no longer be restored")
+	}
+
+	// Subtasks and attachments that are still on the kept task go back
+	for _, child := range snapshot.Children {
+		_, err = tx.Exec(c.Context(),
+			`UPDATE tasks SET parent_id = $1, sort_order = $2, version = version + 1, updated_at = NOW(),
+			 last_modified_by = $3
+			 WHERE id = $4 AND parent_id = $5`,
+			sourceID, child.SortOrder, userID, child.ID, canonicalID,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to restore subtasks")
+		}
+	}
+	if len(snapshot.Attachments) > 0 {
+		_, err = tx.Exec(c.Context(),
+			"UPDATE task_attachments SET task_id = $1 WHERE task_id = $2 AND id = ANY($3)",
+			sourceID, canonicalID, snapshot.Attachments,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to restore attachments")
+		}
+	}
+
+	for _, ref := range snapshot.DuplicateRefs {
+		refJSON, _ := json.Marshal(ref.DuplicateOf)
+		_, err = tx.Exec(c.Context(),
+			"UPDATE tasks SET duplicate_of = $1, duplicate_resolved = $2 WHERE id = $3 AND user_id = $4",
+			refJSON, ref.DuplicateResolved, ref.TaskID, ownerID,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to restore duplicate references")
+		}
+	}
+
+	entities := snapshot.Entities
+	if len(entities) == 0 {
+		entities = json.RawMessage("[]")
+	}
+	_, err = tx.Exec(c.Context(),
+		`UPDATE tasks SET description = $1, tags = $2, ai_entities = $3, due_at = $4, has_due_time = $5,
+		 version = version + 1, updated_at = NOW(), last_modified_by = $6
+		 WHERE id = $7`,
+		snapshot.Description, snapshot.Tags, []byte(entities), snapshot.DueAt, snapshot.HasDueTime, userID, canonicalID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to revert task")
+	}
+	if err := syncTaskEntities(c.Context(), tx, ownerID, canonicalID, entities); err != nil {
+		return httputil.InternalError(c, "failed to link entities")
+	}
+
+	_, err = tx.Exec(c.Context(), "UPDATE task_merges SET undone_at = NOW() WHERE id = $1", mergeID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to undo merge")
+	}
+
+	h.recordActivity(c.Context(), canonicalID, userID, "unmerged", []string{sourceID.String()})
+
+	canonical, childCount, err := h.getTask(c.Context(), canonicalID, userID)
+	if err != nil {
+		return err
+	}
+	canonicalResp := toTaskResponse(canonical, childCount)
+	publishTaskEvent(ownerID, webhook.EventTaskUpdated, canonicalResp)
+
+	restored, restoredChildCount, err := h.getTask(c.Context(), sourceID, userID)
+	if err != nil {
+		return err
+	}
+	restoredResp := toTaskResponse(restored, restoredChildCount)
+	publishTaskEvent(ownerID, webhook.EventTaskCreated, restoredResp)
+
+	return httputil.Success(c, map[string]interface{}{
+		"task":          canonicalResp,
+		"restored_task": restoredResp,
+	})
+}
+
+// Merges lists the tasks merged into this one
+// GET /tasks/:id/merges
+func (h *TaskHandler) Merges(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+
+	if _, _, err := h.taskAccess(c.Context(), taskID, userID); err != nil {
+		return err
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT id, merged_id, merged_title, merged_by, created_at, undone_at
+		 FROM task_merges
+		 WHERE canonical_id = $1
+		 ORDER BY created_at DESC`,
+		taskID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	items := make([]MergeHistoryItem, 0)
+	for rows.Next() {
+		var id, mergedID, mergedBy uuid.UUID
+		var item MergeHistoryItem
+		var createdAt time.Time
+		var undoneAt *time.Time
+		if err := rows.Scan(&id, &mergedID, &item.MergedTitle, &mergedBy, &createdAt, &undoneAt); err != nil {
+			continue
+		}
+		item.ID = id.String()
+		item.MergedTaskID = mergedID.String()
+		item.MergedBy = mergedBy.String()
+		item.CreatedAt = createdAt.Format(time.RFC3339)
+		if undoneAt != nil {
+			s := undoneAt.Format(time.RFC3339)
+			item.UndoneAt = &s
+		}
+		items = append(items, item)
+	}
+
+	return httputil.Success(c, items)
+}
+
+// lockMergeTask loads a task for a merge and locks its row
+func lockMergeTask(ctx context.Context, tx pgx.Tx, taskID, ownerID uuid.UUID) (*mergeTask, error) {
+	var t mergeTask
+	err := tx.QueryRow(ctx,
+		`SELECT id, title, description, tags, COALESCE(ai_entities, '[]'), due_at, has_due_time, parent_id, depth
+		 FROM tasks
+		 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		 FOR UPDATE`,
+		taskID, ownerID,
+	).Scan(&t.ID, &t.Title, &t.Description, &t.Tags, &t.Entities, &t.DueAt, &t.HasDueTime, &t.ParentID, &t.Depth)
+	if err == pgx.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusNotFound, "task not found")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "database error")
+	}
+	return &t, nil
+}
+
+// repointDuplicateRefs replaces the merged task with the kept one in every
+// duplicate_of list and returns the previous values. A task never lists
+// itself; an emptied list counts as resolved.
+func (h *TaskHandler) repointDuplicateRefs(ctx context.Context, tx pgx.Tx, ownerID, sourceID, canonicalID uuid.UUID) ([]mergeDuplicateOf, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT id, COALESCE(duplicate_of, '[]'), COALESCE(duplicate_resolved, false)
+		 FROM tasks
+		 WHERE user_id = $1 AND id != $2 AND COALESCE(duplicate_of, '[]') @> jsonb_build_array($2::text)
+		 FOR UPDATE`,
+		ownerID, sourceID.String(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []mergeDuplicateOf
+	for rows.Next() {
+		var ref mergeDuplicateOf
+		var listJSON []byte
+		if err := rows.Scan(&ref.TaskID, &listJSON, &ref.DuplicateResolved); err != nil {
+			continue
+		}
+		_ = json.Unmarshal(listJSON, &ref.DuplicateOf)
+		refs = append(refs, ref)
+	}
+	rows.Close()
+
+	for _, ref := range refs {
+		updated := make([]string, 0, len(ref.DuplicateOf))
+		seen := make(map[string]bool)
+		for _, id := range ref.DuplicateOf {
+			if id == sourceID.String() {
+				id = canonicalID.String()
+			}
+			if id == ref.TaskID.String() || seen[id] {
+				continue
+			}
+			seen[id] = true
+			updated = append(updated, id)
+		}
+
+		updatedJSON, _ := json.Marshal(updated)
+		_, err := tx.Exec(ctx,
+			"UPDATE tasks SET duplicate_of = $1, duplicate_resolved = $2 WHERE id = $3",
+			updatedJSON, ref.DuplicateResolved || len(updated) == 0, ref.TaskID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if refs == nil {
+		refs = []mergeDuplicateOf{}
+	}
+	return refs, nil
+}
+
+// chooseMergeDue picks the kept task's due date
+func chooseMergeDue(choice string, canonical, source *mergeTask) (*time.Time, bool) {
+	switch choice {
+	case MergeDueCanonical:
+		return canonical.DueAt, canonical.HasDueTime
+	case MergeDueSource:
+		return source.DueAt, source.HasDueTime
+	}
+
+	if canonical.DueAt == nil || (source.DueAt != nil && source.DueAt.Before(*canonical.DueAt)) {
+		return source.DueAt, source.HasDueTime
+	}
+	return canonical.DueAt, canonical.HasDueTime
+}
+
+// mergeTags combines tags, keeping the first spelling of each (case-insensitive)
+func mergeTags(a, b []string) []string {
+	tags := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]bool)
+	for _, tag := range append(append([]string{}, a...), b...) {
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// mergeEntities combines two ai_entities lists, deduped by type and value
+func mergeEntities(a, b []byte) []models.TaskEntity {
+	var first, second []models.TaskEntity
+	_ = json.Unmarshal(a, &first)
+	_ = json.Unmarshal(b, &second)
+
+	entities := make([]models.TaskEntity, 0, len(first)+len(second))
+	seen := make(map[string]bool)
+	for _, e := range append(first, second...) {
+		key := e.Type + ":" + strings.ToLower(strings.TrimSpace(e.Value))
+		if e.Value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		entities = append(entities, e)
+	}
+	return entities
+}
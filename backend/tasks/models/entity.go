@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxEntityNameLength matches the entity_aliases columns the name is copied into
+const MaxEntityNameLength = 255
+
+// Entity is a canonical person, place or organization. Tasks mention it by
+// its name or any of its aliases and are linked to it by ID.
+type Entity struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Type      string    `json:"type" db:"entity_type"`
+	Name      string    `json:"name" db:"name"`
+	Aliases   []string  `json:"aliases" db:"-"`
+	Notes     *string   `json:"notes,omitempty" db:"notes"`
+	Email     *string   `json:"email,omitempty" db:"email"`
+	Phone     *string   `json:"phone,omitempty" db:"phone"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
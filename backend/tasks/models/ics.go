@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icsDuration matches RFC 5545 durations like PT1H30M, P1D or -PT15M
+var icsDuration = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseBusyICS reads the busy times from an iCalendar file: each VEVENT's
+// DTSTART to DTEND (or DURATION). Floating times are in loc; all-day events
+// cover whole days. Cancelled and transparent (free) events are skipped.
+// Recurring events are not expanded, only their first occurrence counts.
+func ParseBusyICS(data string, loc *time.Location) ([]Interval, error) {
+	// Unfold continuation lines (RFC 5545 section 3.1)
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	var busy []Interval
+	var inEvent, skip bool
+	var start, end time.Time
+	var allDay bool
+	var duration time.Duration
+
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		name = strings.ToUpper(name)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent, skip, allDay = true, false, false
+			start, end, duration = time.Time{}, time.Time{}, 0
+		case !inEvent:
+			continue
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			inEvent = false
+			if skip || start.IsZero() {
+				continue
+			}
+			switch {
+			case !end.IsZero():
+			case duration > 0:
+				end = start.Add(duration)
+			case allDay:
+				end = start.AddDate(0, 0, 1)
+			default:
+				end = start // RFC 5545: no end and no duration takes no time
+			}
+			if end.After(start) {
+				busy = append(busy, Interval{Start: start, End: end})
+			}
+		case name == "DTSTART":
+			t, dateOnly, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			start, allDay = t, dateOnly
+		case name == "DTEND":
+			t, _, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			end = t
+		case name == "DURATION":
+			d, err := parseICSDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			duration = d
+		case name == "STATUS" && strings.EqualFold(value, "CANCELLED"):
+			skip = true
+		case name == "TRANSP" && strings.EqualFold(value, "TRANSPARENT"):
+			skip = true
+		}
+	}
+
+	return busy, nil
+}
+
+// parseICSTime parses a DATE or DATE-TIME value; dateOnly is true for a DATE
+func parseICSTime(value, params string, loc *time.Location) (time.Time, bool, error) {
+	for _, p := range strings.Split(params, ";") {
+		key, v, _ := strings.Cut(p, "=")
+		if strings.EqualFold(key, "TZID") {
+			if tz, err := time.LoadLocation(strings.Trim(v, `"`)); err == nil {
+				loc = tz
+			}
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	case len(value) == 8:
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+func parseICSDuration(value string) (time.Duration, error) {
+	m := icsDuration.FindStringSubmatch(strings.ToUpper(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
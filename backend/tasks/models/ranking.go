@@ -0,0 +1,299 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/csaptu/flow/common/models"
+)
+
+// Ranking factor names, also the JSON keys of RankWeights
+const (
+	RankPriority   = "priority"
+	RankDueSoon    = "due_soon"
+	RankOverdue    = "overdue"
+	RankComplexity = "complexity"
+	RankProgress   = "progress"
+	RankAge        = "age"
+	RankFit        = "fit"
+)
+
+// Ranking limits
+const (
+	MaxRankWeight      = 10.0
+	rankOverdueDays    = 14 // Overdue score saturates after two weeks
+	rankAgeDays        = 30 // Age score saturates after a month
+	rankUnknownMinutes = 30 // Estimate for tasks without a complexity rating
+)
+
+// RankWeights multiply each factor's 0-1 score. Negative weights invert a
+// factor (e.g. prefer complex tasks over quick wins).
+type RankWeights struct {
+	Priority   float64 `json:"priority"`
+	DueSoon    float64 `json:"due_soon"`
+	Overdue    float64 `json:"overdue"`
+	Complexity float64 `json:"complexity"` // Rewards simple tasks
+	Progress   float64 `json:"progress"`   // Rewards tasks with subtasks partly done
+	Age        float64 `json:"age"`        // Rewards tasks that have waited long
+	Fit        float64 `json:"fit"`        // Rewards tasks that fit the available minutes
+}
+
+// DefaultRankWeights returns the weights used until a user changes them
+func DefaultRankWeights() RankWeights {
+	return RankWeights{
+		Priority:   3,
+		DueSoon:    4,
+		Overdue:    3,
+		Complexity: 1,
+		Progress:   1,
+		Age:        1,
+		Fit:        2,
+	}
+}
+
+// Set changes one weight by factor name; false if the name is unknown
+func (w *RankWeights) Set(factor string, value float64) bool {
+	switch factor {
+	case RankPriority:
+		w.Priority = value
+	case RankDueSoon:
+		w.DueSoon = value
+	case RankOverdue:
+		w.Overdue = value
+	case RankComplexity:
+		w.Complexity = value
+	case RankProgress:
+		w.Progress = value
+	case RankAge:
+		w.Age = value
+	case RankFit:
+		w.Fit = value
+	default:
+		return false
+	}
+	return true
+}
+
+// RankCandidate is an open task with its subtask counts
+type RankCandidate struct {
+	Task         *Task
+	Subtasks     int
+	SubtasksDone int
+}
+
+// RankFactor is one factor's contribution to a score
+type RankFactor struct {
+	Factor string  `json:"factor"`
+	Score  float64 `json:"score"`  // 0-1
+	Points float64 `json:"points"` // Score x weight
+	Detail string  `json:"detail"`
+}
+
+// RankedTask is a candidate with its score and the reasons for it
+type RankedTask struct {
+	RankCandidate
+	Score       float64      `json:"score"`
+	Factors     []RankFactor `json:"factors"`
+	Explanation string       `json:"explanation"`
+}
+
+// RankTasks scores and orders candidates, highest first. now's location is
+// the user's time zone (it decides which day is "today"). availableMinutes
+// <= 0 leaves out the fit factor. The result depends only on the arguments;
+// ties are broken by due date, priority, creation time and ID.
+func RankTasks(candidates []RankCandidate, now time.Time, availableMinutes int, w RankWeights) []RankedTask {
+	ranked := make([]RankedTask, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, scoreTask(c, now, availableMinutes, w))
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		ad, bd := a.Task.DueAt, b.Task.DueAt
+		if (ad == nil) != (bd == nil) {
+			return ad != nil
+		}
+		if ad != nil && !ad.Equal(*bd) {
+			return ad.Before(*bd)
+		}
+		if a.Task.Priority != b.Task.Priority {
+			return a.Task.Priority > b.Task.Priority
+		}
+		if !a.Task.CreatedAt.Equal(b.Task.CreatedAt) {
+			return a.Task.CreatedAt.Before(b.Task.CreatedAt)
+		}
+		return a.Task.ID.String() < b.Task.ID.String()
+	})
+
+	return ranked
+}
+
+func scoreTask(c RankCandidate, now time.Time, availableMinutes int, w RankWeights) RankedTask {
+	t := c.Task
+	r := RankedTask{RankCandidate: c}
+	add := func(factor string, score, weight float64, detail string) {
+		points := round2(score * weight)
+		r.Factors = append(r.Factors, RankFactor{Factor: factor, Score: round2(score), Points: points, Detail: detail})
+		r.Score += points
+	}
+
+	// Priority
+	add(RankPriority, float64(t.Priority)/float64(models.PriorityUrgent), w.Priority, priorityLabel(t.Priority))
+
+	// Due date: proximity for upcoming tasks, age for overdue ones
+	if t.DueAt != nil {
+		days := calendarDays(now, *t.DueAt, now.Location())
+		overdue := days < 0 || (t.HasDueTime && t.DueAt.Before(now))
+		switch {
+		case overdue:
+			late := -days
+			label := overdueLabel(late, now.Sub(*t.DueAt))
+			add(RankDueSoon, 1, w.DueSoon, label)
+			add(RankOverdue, math.Min(float64(late), rankOverdueDays)/rankOverdueDays, w.Overdue, label)
+		default:
+			add(RankDueSoon, 1/float64(1+days), w.DueSoon, dueLabel(days))
+		}
+	}
+
+	// Complexity: quick wins first (unrated tasks count as average)
+	if t.Complexity > 0 {
+		add(RankComplexity, float64(10-min(t.Complexity, 10))/9, w.Complexity, fmt.Sprintf("complexity %d/10", t.Complexity))
+	} else {
+		add(RankComplexity, 0.5, w.Complexity, "complexity not rated")
+	}
+
+	// Subtask progress: finish what's started
+	if c.Subtasks > 0 {
+		add(RankProgress, float64(c.SubtasksDone)/float64(c.Subtasks), w.Progress,
+			fmt.Sprintf("%d of %d subtasks done", c.SubtasksDone, c.Subtasks))
+	}
+
+	// Age
+	ageDays := calendarDays(t.CreatedAt, now, now.Location())
+	add(RankAge, math.Min(float64(max(ageDays, 0)), rankAgeDays)/rankAgeDays, w.Age, ageLabel(ageDays))
+
+	// Fit with the time the user has
+	if availableMinutes > 0 {
+		estimate := EstimatedMinutes(t.Complexity)
+		score := 1.0
+		detail := fmt.Sprintf("~%d min fits in %d min", estimate, availableMinutes)
+		if estimate > availableMinutes {
+			score = float64(availableMinutes) / float64(estimate)
+			detail = fmt.Sprintf("~%d min, more than the %d min available", estimate, availableMinutes)
+		}
+		add(RankFit, score, w.Fit, detail)
+	}
+
+	r.Score = round2(r.Score)
+	r.Explanation = explain(r.Factors)
+	return r
+}
+
+// EstimatedMinutes maps a 1-10 complexity rating to a rough duration
+func EstimatedMinutes(complexity int) int {
+	switch {
+	case complexity <= 0:
+		return rankUnknownMinutes
+	case complexity <= 2:
+		return 15
+	case complexity <= 4:
+		return 30
+	case complexity <= 6:
+		return 60
+	case complexity <= 8:
+		return 120
+	}
+	return 240
+}
+
+// explain lists the factors that added the most, strongest first
+func explain(factors []RankFactor) string {
+	top := make([]RankFactor, 0, len(factors))
+	for _, f := range factors {
+		if f.Points > 0 {
+			top = append(top, f)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Points > top[j].Points })
+
+	// Due and overdue share a detail; mention it once
+	parts := make([]string, 0, 3)
+	seen := make(map[string]bool)
+	for _, f := range top {
+		if len(parts) == 3 {
+			break
+		}
+		if !seen[f.Detail] {
+			seen[f.Detail] = true
+			parts = append(parts, f.Detail)
+		}
+	}
+	if len(parts) == 0 {
+		return "Nothing stands out; ranked by due date and age"
+	}
+	s := strings.Join(parts, ", ")
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// calendarDays counts the calendar days from a to b in loc (negative if b is earlier)
+func calendarDays(a, b time.Time, loc *time.Location) int {
+	ay, am, ad := a.In(loc).Date()
+	by, bm, bd := b.In(loc).Date()
+	from := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	to := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+func priorityLabel(p models.Priority) string {
+	switch p {
+	case models.PriorityUrgent:
+		return "urgent priority"
+	case models.PriorityHigh:
+		return "high priority"
+	case models.PriorityMedium:
+		return "medium priority"
+	case models.PriorityLow:
+		return "low priority"
+	}
+	return "no priority"
+}
+
+func dueLabel(days int) string {
+	switch days {
+	case 0:
+		return "due today"
+	case 1:
+		return "due tomorrow"
+	}
+	return fmt.Sprintf("due in %d days", days)
+}
+
+func overdueLabel(days int, late time.Duration) string {
+	switch {
+	case days <= 0:
+		return fmt.Sprintf("overdue by %dh", max(int(late.Hours()), 1))
+	case days == 1:
+		return "overdue since yesterday"
+	}
+	return fmt.Sprintf("overdue by %d days", days)
+}
+
+func ageLabel(days int) string {
+	switch {
+	case days <= 0:
+		return "created today"
+	case days == 1:
+		return "waiting since yesterday"
+	}
+	return fmt.Sprintf("waiting %d days", days)
+}
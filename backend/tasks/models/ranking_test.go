@@ -0,0 +1,213 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/common/models"
+)
+
+var rankNow = time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+
+// testTask builds a task with a fixed ID; created is the age in days at rankNow
+func testTask(id byte, priority models.Priority, complexity int, due *time.Time, hasTime bool, created int) *Task {
+	t := &Task{Complexity: complexity}
+	t.ID = uuid.UUID{15: id}
+	t.Title = "task " + string('a'+rune(id))
+	t.Priority = priority
+	t.DueAt = due
+	t.HasDueTime = hasTime
+	t.CreatedAt = rankNow.AddDate(0, 0, -created)
+	return t
+}
+
+func at(year int, month time.Month, day, hour, minute int) *time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	return &t
+}
+
+func rankedIDs(ranked []RankedTask) []byte {
+	ids := make([]byte, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.Task.ID[15]
+	}
+	return ids
+}
+
+func factor(r RankedTask, name string) (RankFactor, bool) {
+	for _, f := range r.Factors {
+		if f.Factor == name {
+			return f, true
+		}
+	}
+	return RankFactor{}, false
+}
+
+func TestRankTasksDueInTimeZone(t *testing.T) {
+	due := at(2026, 3, 10, 23, 30) // 06:30 on the 11th at UTC+7
+	tests := []struct {
+		name   string
+		loc    *time.Location
+		score  float64
+		detail string
+	}{
+		{"utc", time.UTC, 1, "due today"},
+		{"utc+7", time.FixedZone("ICT", 7*3600), 0.5, "due tomorrow"},
+		{"utc-10", time.FixedZone("HST", -10*3600), 1, "due today"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := testTask(1, models.PriorityNone, 0, due, true, 0)
+			ranked := RankTasks([]RankCandidate{{Task: task}}, rankNow.In(tt.loc), 0, RankWeights{DueSoon: 1})
+
+			f, ok := factor(ranked[0], RankDueSoon)
+			if !ok {
+				t.Fatal("due_soon factor missing")
+			}
+			if f.Score != tt.score || f.Detail != tt.detail {
+				t.Errorf("due_soon = %v %q, want %v %q", f.Score, f.Detail, tt.score, tt.detail)
+			}
+			if ranked[0].Score != tt.score {
+				t.Errorf("score = %v, want %v", ranked[0].Score, tt.score)
+			}
+		})
+	}
+}
+
+func TestRankTasksOverdue(t *testing.T) {
+	tests := []struct {
+		name    string
+		due     *time.Time
+		hasTime bool
+		overdue float64
+		detail  string
+	}{
+		{"earlier today", at(2026, 3, 10, 8, 0), true, 0, "overdue by 2h"},
+		{"yesterday", at(2026, 3, 9, 0, 0), false, 0.07, "overdue since yesterday"},
+		{"five days", at(2026, 3, 5, 0, 0), false, 0.36, "overdue by 5 days"},
+		{"saturates", at(2026, 1, 1, 0, 0), false, 1, "overdue by 68 days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := testTask(1, models.PriorityNone, 0, tt.due, tt.hasTime, 0)
+			ranked := RankTasks([]RankCandidate{{Task: task}}, rankNow, 0, DefaultRankWeights())
+
+			due, _ := factor(ranked[0], RankDueSoon)
+			if due.Score != 1 {
+				t.Errorf("due_soon score = %v, want 1 for an overdue task", due.Score)
+			}
+			f, ok := factor(ranked[0], RankOverdue)
+			if !ok {
+				t.Fatal("overdue factor missing")
+			}
+			if f.Score != tt.overdue || f.Detail != tt.detail {
+				t.Errorf("overdue = %v %q, want %v %q", f.Score, f.Detail, tt.overdue, tt.detail)
+			}
+		})
+	}
+}
+
+func TestRankTasksWeights(t *testing.T) {
+	urgent := testTask(1, models.PriorityUrgent, 9, nil, false, 0)
+	low := testTask(2, models.PriorityLow, 1, nil, false, 0)
+	candidates := []RankCandidate{{Task: low}, {Task: urgent}}
+
+	tests := []struct {
+		name    string
+		weights RankWeights
+		order   []byte
+		scores  []float64
+	}{
+		{"priority", RankWeights{Priority: 3}, []byte{1, 2}, []float64{3, 0.75}},
+		{"quick wins", RankWeights{Complexity: 1}, []byte{2, 1}, []float64{1, 0.11}},
+		{"negative weight prefers complex tasks", RankWeights{Complexity: -1}, []byte{1, 2}, []float64{-0.11, -1}},
+		{"fit", RankWeights{Fit: 2}, []byte{2, 1}, []float64{2, 0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked := RankTasks(candidates, rankNow, 60, tt.weights)
+
+			if got := rankedIDs(ranked); string(got) != string(tt.order) {
+				t.Fatalf("order = %v, want %v", got, tt.order)
+			}
+			for i, r := range ranked {
+				if r.Score != tt.scores[i] {
+					t.Errorf("score[%d] = %v, want %v", i, r.Score, tt.scores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRankTasksFitNeedsAvailableMinutes(t *testing.T) {
+	task := testTask(1, models.PriorityNone, 7, nil, false, 0)
+
+	ranked := RankTasks([]RankCandidate{{Task: task}}, rankNow, 0, DefaultRankWeights())
+	if _, ok := factor(ranked[0], RankFit); ok {
+		t.Error("fit factor present without available minutes")
+	}
+
+	ranked = RankTasks([]RankCandidate{{Task: task}}, rankNow, 30, DefaultRankWeights())
+	f, ok := factor(ranked[0], RankFit)
+	if !ok {
+		t.Fatal("fit factor missing")
+	}
+	if f.Score != 0.25 || f.Detail != "~120 min, more than the 30 min available" {
+		t.Errorf("fit = %v %q", f.Score, f.Detail)
+	}
+}
+
+func TestRankTasksProgressAndAge(t *testing.T) {
+	task := testTask(1, models.PriorityNone, 0, nil, false, 45)
+	ranked := RankTasks([]RankCandidate{{Task: task, Subtasks: 4, SubtasksDone: 1}}, rankNow, 0, RankWeights{Progress: 1, Age: 1})
+
+	progress, _ := factor(ranked[0], RankProgress)
+	if progress.Score != 0.25 || progress.Detail != "1 of 4 subtasks done" {
+		t.Errorf("progress = %v %q", progress.Score, progress.Detail)
+	}
+	age, _ := factor(ranked[0], RankAge)
+	if age.Score != 1 || age.Detail != "waiting 45 days" {
+		t.Errorf("age = %v %q", age.Score, age.Detail)
+	}
+	if ranked[0].Explanation != "Waiting 45 days, 1 of 4 subtasks done" {
+		t.Errorf("explanation = %q", ranked[0].Explanation)
+	}
+}
+
+func TestRankTasksTieBreaks(t *testing.T) {
+	// With every weight at zero all scores tie, so only the tie-breaks order them
+	candidates := []RankCandidate{
+		{Task: testTask(8, models.PriorityNone, 0, nil, false, 1)},
+		{Task: testTask(7, models.PriorityNone, 0, nil, false, 1)},
+		{Task: testTask(6, models.PriorityNone, 0, nil, false, 3)},
+		{Task: testTask(5, models.PriorityHigh, 0, nil, false, 0)},
+		{Task: testTask(4, models.PriorityLow, 0, at(2026, 3, 12, 0, 0), false, 0)},
+		{Task: testTask(3, models.PriorityHigh, 0, at(2026, 3, 12, 0, 0), false, 0)},
+		{Task: testTask(2, models.PriorityNone, 0, at(2026, 3, 11, 0, 0), false, 0)},
+	}
+
+	ranked := RankTasks(candidates, rankNow, 0, RankWeights{})
+
+	want := []byte{
+		2,    // earliest due date
+		3, 4, // same due date: higher priority first
+		5,    // no due date: higher priority first
+		6,    // then older
+		7, 8, // then by ID
+	}
+	if got := rankedIDs(ranked); string(got) != string(want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	for _, r := range ranked {
+		if r.Score != 0 {
+			t.Errorf("task %d score = %v, want 0", r.Task.ID[15], r.Score)
+		}
+		if r.Explanation != "Nothing stands out; ranked by due date and age" {
+			t.Errorf("explanation = %q", r.Explanation)
+		}
+	}
+}
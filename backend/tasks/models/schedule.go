@@ -0,0 +1,246 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scheduling defaults
+const (
+	DefaultMaxBlock = 90 * time.Minute // Longer tasks are split
+	DefaultMinBlock = 15 * time.Minute // Smallest part of a split task
+	scheduleStep    = 5 * time.Minute  // Blocks start on 5-minute marks
+)
+
+// Unscheduled reasons
+const (
+	UnscheduledNoRoom  = "no_room"  // No free slot left that is long enough
+	UnscheduledPartial = "partial"  // Only some parts fit
+	UnscheduledPast    = "past_due" // Fixed time already passed
+)
+
+// Interval is a span of time [Start, End)
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Minutes returns the interval's length in whole minutes
+func (i Interval) Minutes() int {
+	return int(i.End.Sub(i.Start) / time.Minute)
+}
+
+// ScheduleInput describes the day to plan
+type ScheduleInput struct {
+	Work      Interval          // Working hours on the planned day
+	Now       time.Time         // Nothing is placed before now
+	Busy      []Interval        // Meetings and other commitments
+	Tasks     []RankedTask      // Open tasks, most important first
+	Estimates map[uuid.UUID]int // Minutes per task, overriding the complexity estimate
+	MaxBlock  time.Duration
+	MinBlock  time.Duration
+}
+
+// ScheduleBlock is a task (or part of one) placed in the day
+type ScheduleBlock struct {
+	TaskID uuid.UUID `json:"task_id"`
+	Title  string    `json:"title"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Part   int       `json:"part"`  // 1-based
+	Parts  int       `json:"parts"` // > 1 when the task was split
+	Fixed  bool      `json:"fixed"` // Placed at the task's own due time
+}
+
+// UnscheduledTask is a task that didn't (fully) fit
+type UnscheduledTask struct {
+	TaskID  uuid.UUID `json:"task_id"`
+	Title   string    `json:"title"`
+	Minutes int       `json:"minutes"` // Not placed
+	Reason  string    `json:"reason"`
+}
+
+// Schedule is a proposed plan for one day
+type Schedule struct {
+	Blocks           []ScheduleBlock   `json:"blocks"`
+	Unscheduled      []UnscheduledTask `json:"unscheduled"`
+	FreeMinutes      int               `json:"free_minutes"` // Free working time before placing tasks
+	ScheduledMinutes int               `json:"scheduled_minutes"`
+}
+
+// PlanDay places tasks into the free time of a working day. Tasks with a due
+// time on the day are fixed at that time; tasks due on or before the day go
+// first, the rest follow in the given order. Each task takes the first free
+// slot long enough for it; tasks longer than MaxBlock are split into parts of
+// at least MinBlock. The result depends only on the input.
+func PlanDay(in ScheduleInput) Schedule {
+	if in.MaxBlock <= 0 {
+		in.MaxBlock = DefaultMaxBlock
+	}
+	if in.MinBlock <= 0 || in.MinBlock > in.MaxBlock {
+		in.MinBlock = min(DefaultMinBlock, in.MaxBlock)
+	}
+
+	s := Schedule{Blocks: []ScheduleBlock{}, Unscheduled: []UnscheduledTask{}}
+
+	start := in.Work.Start
+	if in.Now.After(start) {
+		start = ceilStep(in.Now)
+	}
+	free := subtractAll([]Interval{{Start: start, End: in.Work.End}}, in.Busy)
+	for _, f := range free {
+		s.FreeMinutes += f.Minutes()
+	}
+
+	loc := in.Work.Start.Location()
+	dayStart := time.Date(in.Work.Start.Year(), in.Work.Start.Month(), in.Work.Start.Day(), 0, 0, 0, 0, loc)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	// Fixed tasks first: they hold their time whether or not it's free
+	var flexible, dueByDay []RankedTask
+	for _, r := range in.Tasks {
+		t := r.Task
+		if t.DueAt == nil || !t.HasDueTime || t.DueAt.Before(dayStart) || !t.DueAt.Before(dayEnd) {
+			if t.DueAt != nil && t.DueAt.Before(dayEnd) {
+				dueByDay = append(dueByDay, r)
+			} else {
+				flexible = append(flexible, r)
+			}
+			continue
+		}
+
+		minutes := in.estimate(t)
+		if t.DueAt.Before(in.Now) {
+			s.Unscheduled = append(s.Unscheduled, UnscheduledTask{TaskID: t.ID, Title: t.GetDisplayTitle(), Minutes: minutes, Reason: UnscheduledPast})
+			continue
+		}
+		block := Interval{Start: *t.DueAt, End: t.DueAt.Add(time.Duration(minutes) * time.Minute)}
+		s.Blocks = append(s.Blocks, ScheduleBlock{
+			TaskID: t.ID, Title: t.GetDisplayTitle(), Start: block.Start, End: block.End, Part: 1, Parts: 1, Fixed: true,
+		})
+		s.ScheduledMinutes += minutes
+		free = subtract(free, block)
+	}
+
+	// Due today (or overdue) before everything else, earliest due first
+	sort.SliceStable(dueByDay, func(i, j int) bool { return dueByDay[i].Task.DueAt.Before(*dueByDay[j].Task.DueAt) })
+
+	for _, r := range append(dueByDay, flexible...) {
+		t := r.Task
+		minutes := in.estimate(t)
+		need := time.Duration(minutes) * time.Minute
+
+		var placed []Interval
+		if need <= in.MaxBlock {
+			if i := firstFit(free, need); i >= 0 {
+				placed = append(placed, Interval{Start: free[i].Start, End: free[i].Start.Add(need)})
+			}
+		} else {
+			// Split: fill slots in order with parts of MinBlock..MaxBlock
+			remaining := need
+			for _, f := range free {
+				for remaining > 0 {
+					part := min(remaining, in.MaxBlock, f.End.Sub(f.Start))
+					if part < in.MinBlock && part < remaining {
+						break
+					}
+					if rest := remaining - part; rest > 0 && rest < in.MinBlock {
+						// Don't leave a sliver: shorten this part so the last is MinBlock
+						part = remaining - in.MinBlock
+						if part < in.MinBlock {
+							break
+						}
+					}
+					placed = append(placed, Interval{Start: f.Start, End: f.Start.Add(part)})
+					f.Start = f.Start.Add(part)
+					remaining -= part
+				}
+				if remaining == 0 {
+					break
+				}
+			}
+		}
+
+		done := 0
+		for i, p := range placed {
+			s.Blocks = append(s.Blocks, ScheduleBlock{
+				TaskID: t.ID, Title: t.GetDisplayTitle(), Start: p.Start, End: p.End, Part: i + 1, Parts: len(placed),
+			})
+			free = subtract(free, p)
+			done += p.Minutes()
+		}
+		s.ScheduledMinutes += done
+
+		switch {
+		case done == 0:
+			s.Unscheduled = append(s.Unscheduled, UnscheduledTask{TaskID: t.ID, Title: t.GetDisplayTitle(), Minutes: minutes, Reason: UnscheduledNoRoom})
+		case done < minutes:
+			s.Unscheduled = append(s.Unscheduled, UnscheduledTask{TaskID: t.ID, Title: t.GetDisplayTitle(), Minutes: minutes - done, Reason: UnscheduledPartial})
+		}
+	}
+
+	sort.SliceStable(s.Blocks, func(i, j int) bool {
+		if !s.Blocks[i].Start.Equal(s.Blocks[j].Start) {
+			return s.Blocks[i].Start.Before(s.Blocks[j].Start)
+		}
+		return s.Blocks[i].TaskID.String() < s.Blocks[j].TaskID.String()
+	})
+	return s
+}
+
+func (in ScheduleInput) estimate(t *Task) int {
+	if m, ok := in.Estimates[t.ID]; ok && m > 0 {
+		return m
+	}
+	return EstimatedMinutes(t.Complexity)
+}
+
+// firstFit returns the index of the first free slot at least d long, or -1
+func firstFit(free []Interval, d time.Duration) int {
+	for i, f := range free {
+		if f.End.Sub(f.Start) >= d {
+			return i
+		}
+	}
+	return -1
+}
+
+// subtractAll removes the busy intervals from the free ones
+func subtractAll(free, busy []Interval) []Interval {
+	for _, b := range busy {
+		free = subtract(free, b)
+	}
+	return free
+}
+
+// subtract removes b from the free intervals, keeping them sorted and
+// aligned to the scheduling step
+func subtract(free []Interval, b Interval) []Interval {
+	out := make([]Interval, 0, len(free)+1)
+	for _, f := range free {
+		if !b.Start.Before(f.End) || !b.End.After(f.Start) {
+			out = append(out, f)
+			continue
+		}
+		if b.Start.After(f.Start) {
+			out = append(out, Interval{Start: f.Start, End: b.Start})
+		}
+		if b.End.Before(f.End) {
+			if rest := (Interval{Start: ceilStep(b.End), End: f.End}); rest.Start.Before(rest.End) {
+				out = append(out, rest)
+			}
+		}
+	}
+	return out
+}
+
+// ceilStep rounds t up to the next scheduling step
+func ceilStep(t time.Time) time.Time {
+	r := t.Truncate(scheduleStep)
+	if r.Before(t) {
+		r = r.Add(scheduleStep)
+	}
+	return r
+}
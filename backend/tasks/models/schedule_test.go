@@ -0,0 +1,220 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/common/models"
+)
+
+// clock returns a time on the planned day, 2026-03-10 UTC
+func clock(hour, minute int) time.Time {
+	return time.Date(2026, 3, 10, hour, minute, 0, 0, time.UTC)
+}
+
+func span(fromHour, fromMinute, toHour, toMinute int) Interval {
+	return Interval{Start: clock(fromHour, fromMinute), End: clock(toHour, toMinute)}
+}
+
+// blockString renders a block as "id hh:mm-hh:mm part/parts", with "!" for fixed blocks
+func blockString(b ScheduleBlock) string {
+	s := fmt.Sprintf("%d %s-%s %d/%d", b.TaskID[15], b.Start.Format("15:04"), b.End.Format("15:04"), b.Part, b.Parts)
+	if b.Fixed {
+		s += "!"
+	}
+	return s
+}
+
+func unscheduledString(u UnscheduledTask) string {
+	return fmt.Sprintf("%d %dm %s", u.TaskID[15], u.Minutes, u.Reason)
+}
+
+func TestPlanDay(t *testing.T) {
+	flexible := func(id byte) RankedTask {
+		return RankedTask{RankCandidate: RankCandidate{Task: testTask(id, models.PriorityNone, 0, nil, false, 0)}}
+	}
+	dueAt := func(id byte, due time.Time, hasTime bool) RankedTask {
+		return RankedTask{RankCandidate: RankCandidate{Task: testTask(id, models.PriorityNone, 0, &due, hasTime, 0)}}
+	}
+
+	tests := []struct {
+		name        string
+		in          ScheduleInput
+		blocks      []string
+		unscheduled []string
+		free        int
+		scheduled   int
+	}{
+		{
+			name: "fills capacity in order",
+			in: ScheduleInput{
+				Work:      span(9, 0, 11, 0),
+				Now:       clock(8, 0),
+				Tasks:     []RankedTask{flexible(1), flexible(2), flexible(3)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 60, {15: 2}: 60, {15: 3}: 30},
+			},
+			blocks:      []string{"1 09:00-10:00 1/1", "2 10:00-11:00 1/1"},
+			unscheduled: []string{"3 30m no_room"},
+			free:        120,
+			scheduled:   120,
+		},
+		{
+			name: "skips busy time",
+			in: ScheduleInput{
+				Work:      span(9, 0, 12, 0),
+				Now:       clock(8, 0),
+				Busy:      []Interval{span(9, 30, 10, 0)},
+				Tasks:     []RankedTask{flexible(1), flexible(2)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 60, {15: 2}: 30},
+			},
+			blocks:      []string{"2 09:00-09:30 1/1", "1 10:00-11:00 1/1"},
+			unscheduled: []string{},
+			free:        150,
+			scheduled:   90,
+		},
+		{
+			name: "starts after now on the next step",
+			in: ScheduleInput{
+				Work:      span(9, 0, 10, 0),
+				Now:       clock(9, 7),
+				Tasks:     []RankedTask{flexible(1)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 30},
+			},
+			blocks:      []string{"1 09:10-09:40 1/1"},
+			unscheduled: []string{},
+			free:        50,
+			scheduled:   30,
+		},
+		{
+			name: "fixed tasks hold their due time",
+			in: ScheduleInput{
+				Work:      span(13, 30, 15, 0),
+				Now:       clock(8, 0),
+				Tasks:     []RankedTask{flexible(1), dueAt(2, clock(14, 0), true), flexible(3)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 30, {15: 2}: 30, {15: 3}: 45},
+			},
+			blocks:      []string{"1 13:30-14:00 1/1", "2 14:00-14:30 1/1!"},
+			unscheduled: []string{"3 45m no_room"},
+			free:        90,
+			scheduled:   60,
+		},
+		{
+			name: "fixed time already passed",
+			in: ScheduleInput{
+				Work:      span(9, 0, 17, 0),
+				Now:       clock(15, 0),
+				Tasks:     []RankedTask{dueAt(1, clock(14, 0), true)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 30},
+			},
+			blocks:      []string{},
+			unscheduled: []string{"1 30m past_due"},
+			free:        120,
+			scheduled:   0,
+		},
+		{
+			name: "tasks due by the day go first",
+			in: ScheduleInput{
+				Work:      span(9, 0, 11, 0),
+				Now:       clock(8, 0),
+				Tasks:     []RankedTask{flexible(1), dueAt(2, clock(0, 0), false), dueAt(3, clock(0, 0).AddDate(0, 0, -2), false)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 60, {15: 2}: 30, {15: 3}: 30},
+			},
+			blocks:      []string{"3 09:00-09:30 1/1", "2 09:30-10:00 1/1", "1 10:00-11:00 1/1"},
+			unscheduled: []string{},
+			free:        120,
+			scheduled:   120,
+		},
+		{
+			name: "splits long tasks around busy time",
+			in: ScheduleInput{
+				Work:      span(9, 0, 12, 0),
+				Now:       clock(8, 0),
+				Busy:      []Interval{span(10, 0, 10, 30)},
+				Tasks:     []RankedTask{flexible(1)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 150},
+				MaxBlock:  time.Hour,
+				MinBlock:  15 * time.Minute,
+			},
+			blocks:      []string{"1 09:00-10:00 1/3", "1 10:30-11:30 2/3", "1 11:30-12:00 3/3"},
+			unscheduled: []string{},
+			free:        150,
+			scheduled:   150,
+		},
+		{
+			name: "overflow is reported as partial",
+			in: ScheduleInput{
+				Work:      span(9, 0, 12, 0),
+				Now:       clock(8, 0),
+				Busy:      []Interval{span(10, 0, 10, 30)},
+				Tasks:     []RankedTask{flexible(1)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 200},
+				MaxBlock:  time.Hour,
+				MinBlock:  15 * time.Minute,
+			},
+			blocks:      []string{"1 09:00-10:00 1/3", "1 10:30-11:30 2/3", "1 11:30-12:00 3/3"},
+			unscheduled: []string{"1 50m partial"},
+			free:        150,
+			scheduled:   150,
+		},
+		{
+			name: "no sliver shorter than the minimum block",
+			in: ScheduleInput{
+				Work:      span(9, 0, 12, 0),
+				Now:       clock(8, 0),
+				Tasks:     []RankedTask{flexible(1)},
+				Estimates: map[uuid.UUID]int{{15: 1}: 70},
+				MaxBlock:  time.Hour,
+				MinBlock:  15 * time.Minute,
+			},
+			blocks:      []string{"1 09:00-09:55 1/2", "1 09:55-10:10 2/2"},
+			unscheduled: []string{},
+			free:        180,
+			scheduled:   70,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := PlanDay(tt.in)
+
+			blocks := make([]string, len(s.Blocks))
+			for i, b := range s.Blocks {
+				blocks[i] = blockString(b)
+			}
+			if fmt.Sprint(blocks) != fmt.Sprint(tt.blocks) {
+				t.Errorf("blocks = %q, want %q", blocks, tt.blocks)
+			}
+
+			unscheduled := make([]string, len(s.Unscheduled))
+			for i, u := range s.Unscheduled {
+				unscheduled[i] = unscheduledString(u)
+			}
+			if fmt.Sprint(unscheduled) != fmt.Sprint(tt.unscheduled) {
+				t.Errorf("unscheduled = %q, want %q", unscheduled, tt.unscheduled)
+			}
+
+			if s.FreeMinutes != tt.free {
+				t.Errorf("free minutes = %d, want %d", s.FreeMinutes, tt.free)
+			}
+			if s.ScheduledMinutes != tt.scheduled {
+				t.Errorf("scheduled minutes = %d, want %d", s.ScheduledMinutes, tt.scheduled)
+			}
+		})
+	}
+}
+
+func TestPlanDayComplexityEstimate(t *testing.T) {
+	// Without an override the complexity rating sets the duration
+	task := testTask(1, models.PriorityNone, 5, nil, false, 0)
+	s := PlanDay(ScheduleInput{
+		Work:  span(9, 0, 17, 0),
+		Now:   clock(8, 0),
+		Tasks: []RankedTask{{RankCandidate: RankCandidate{Task: task}}},
+	})
+
+	if len(s.Blocks) != 1 || s.Blocks[0].End.Sub(s.Blocks[0].Start) != time.Hour {
+		t.Errorf("blocks = %+v, want one 60 min block", s.Blocks)
+	}
+}
@@ -47,6 +47,11 @@ type Task struct {
 	DuplicateOf       []string `json:"duplicate_of,omitempty" db:"duplicate_of"`
 	DuplicateResolved bool     `json:"duplicate_resolved" db:"duplicate_resolved"`
 
+	// Sharing - who created / last changed the task and who it is assigned to
+	CreatedBy      *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	LastModifiedBy *uuid.UUID `json:"last_modified_by,omitempty" db:"last_modified_by"`
+	AssigneeID     *uuid.UUID `json:"assignee_id,omitempty" db:"assignee_id"`
+
 	// Project promotion tracking
 	PromotedToProject *uuid.UUID `json:"promoted_to_project,omitempty" db:"promoted_to_project"`
 
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/common/models"
+)
+
+// MaxTemplateSubtasks caps the subtask list of a template
+const MaxTemplateSubtasks = 50
+
+// templateVarRe matches {{name}} placeholders (whitespace inside the braces is allowed)
+var templateVarRe = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}`)
+
+// TaskTemplate is a reusable parent task with an ordered list of subtasks.
+// Text fields may contain {{variables}}; due dates are stored as offsets
+// from the anchor date chosen when the template is instantiated.
+type TaskTemplate struct {
+	ID            uuid.UUID         `json:"id" db:"id"`
+	UserID        uuid.UUID         `json:"user_id" db:"user_id"`
+	Name          string            `json:"name" db:"name"`
+	Title         string            `json:"title" db:"title"`
+	Description   *string           `json:"description,omitempty" db:"description"`
+	Tags          []string          `json:"tags" db:"tags"`
+	Priority      models.Priority   `json:"priority" db:"priority"`
+	DueOffsetDays *int              `json:"due_offset_days,omitempty" db:"due_offset_days"` // nil = no due date
+	DueTime       *string           `json:"due_time,omitempty" db:"due_time"`               // "HH:MM", nil = all-day
+	Subtasks      []TemplateSubtask `json:"subtasks" db:"subtasks"`
+	ShareToken    *string           `json:"-" db:"share_token"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// TemplateSubtask is one entry of a template's checklist, in order
+type TemplateSubtask struct {
+	Title         string          `json:"title"`
+	Description   *string         `json:"description,omitempty"`
+	Priority      models.Priority `json:"priority"`
+	DueOffsetDays *int            `json:"due_offset_days,omitempty"`
+	DueTime       *string         `json:"due_time,omitempty"`
+}
+
+// Variables returns the distinct placeholder names used anywhere in the template, sorted
+func (t *TaskTemplate) Variables() []string {
+	seen := make(map[string]bool)
+	collect := func(s string) {
+		for _, m := range templateVarRe.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = true
+		}
+	}
+
+	t.eachText(func(s *string) { collect(*s) })
+
+	vars := make([]string, 0, len(seen))
+	for name := range seen {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// Render returns a copy of the template with every placeholder replaced.
+// Returns the names of variables without a value; the copy is nil then.
+func (t *TaskTemplate) Render(values map[string]string) (*TaskTemplate, []string) {
+	var missing []string
+	for _, name := range t.Variables() {
+		if strings.TrimSpace(values[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missing
+	}
+
+	rendered := *t
+	rendered.Tags = append([]string{}, t.Tags...)
+	rendered.Subtasks = make([]TemplateSubtask, len(t.Subtasks))
+	for i, st := range t.Subtasks {
+		rendered.Subtasks[i] = st
+		if st.Description != nil {
+			desc := *st.Description
+			rendered.Subtasks[i].Description = &desc
+		}
+	}
+	if t.Description != nil {
+		desc := *t.Description
+		rendered.Description = &desc
+	}
+
+	rendered.eachText(func(s *string) {
+		*s = templateVarRe.ReplaceAllStringFunc(*s, func(match string) string {
+			name := templateVarRe.FindStringSubmatch(match)[1]
+			return strings.TrimSpace(values[name])
+		})
+	})
+	for i, tag := range rendered.Tags {
+		// Values may contain spaces; hashtags can't
+		rendered.Tags[i] = strings.Join(strings.Fields(tag), "-")
+	}
+
+	return &rendered, nil
+}
+
+// eachText calls fn for every text field that may hold placeholders
+func (t *TaskTemplate) eachText(fn func(s *string)) {
+	fn(&t.Title)
+	if t.Description != nil {
+		fn(t.Description)
+	}
+	for i := range t.Tags {
+		fn(&t.Tags[i])
+	}
+	for i := range t.Subtasks {
+		fn(&t.Subtasks[i].Title)
+		if t.Subtasks[i].Description != nil {
+			fn(t.Subtasks[i].Description)
+		}
+	}
+}
+
+// TemplateDueAt resolves a relative due date against the anchor day.
+// The anchor's location decides which calendar day and wall-clock time apply.
+// Returns nil when the entry has no due offset; hasTime reports a due_time.
+func TemplateDueAt(anchor time.Time, offsetDays *int, dueTime *string) (dueAt *time.Time, hasTime bool) {
+	if offsetDays == nil {
+		return nil, false
+	}
+
+	hour, minute := 0, 0
+	if dueTime != nil {
+		if h, m, ok := ParseTemplateTime(*dueTime); ok {
+			hour, minute, hasTime = h, m, true
+		}
+	}
+
+	y, mo, d := anchor.Date()
+	due := time.Date(y, mo, d+*offsetDays, hour, minute, 0, 0, anchor.Location())
+	return &due, hasTime
+}
+
+// TemplateOffset is the inverse of TemplateDueAt: it expresses due relative
+// to the anchor day, used when turning an existing task into a template
+func TemplateOffset(anchor time.Time, due *time.Time, hasTime bool) (*int, *string) {
+	if due == nil {
+		return nil, nil
+	}
+
+	local := due.In(anchor.Location())
+	ay, am, ad := anchor.Date()
+	dy, dm, dd := local.Date()
+	anchorDay := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	dueDay := time.Date(dy, dm, dd, 0, 0, 0, 0, time.UTC)
+	days := int(dueDay.Sub(anchorDay).Hours() / 24)
+
+	if !hasTime {
+		return &days, nil
+	}
+	clock := fmt.Sprintf("%02d:%02d", local.Hour(), local.Minute())
+	return &days, &clock
+}
+
+// ParseTemplateTime parses an "HH:MM" due time
+func ParseTemplateTime(s string) (hour, minute int, ok bool) {
+	parsed, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, false
+	}
+	return parsed.Hour(), parsed.Minute(), true
+}
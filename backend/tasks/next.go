@@ -0,0 +1,314 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// Next-task limits
+const (
+	defaultNextLimit  = 20
+	maxNextLimit      = 100
+	maxNextMinutes    = 24 * 60
+	maxNextCandidates = 1000 // Open tasks considered, most urgent first
+)
+
+// NextTaskResponse is a task with its ranking score
+type NextTaskResponse struct {
+	Task        TaskResponse        `json:"task"`
+	Rank        int                 `json:"rank"`
+	Score       float64             `json:"score"`
+	Factors     []models.RankFactor `json:"factors"`
+	Explanation string              `json:"explanation"`
+}
+
+// NextResponse is the ranked list returned by GET /tasks/next
+type NextResponse struct {
+	Tasks            []NextTaskResponse `json:"tasks"`
+	Weights          models.RankWeights `json:"weights"`
+	Timezone         string             `json:"timezone"`
+	AvailableMinutes int                `json:"available_minutes,omitempty"`
+	GeneratedAt      string             `json:"generated_at"`
+}
+
+// Next ranks the user's open tasks by what to work on next.
+// ?minutes= favours tasks that fit the available time, ?tz= overrides the
+// time zone from the user's settings and ?at= (RFC3339) fixes "now" so a
+// ranking can be reproduced.
+// GET /tasks/next
+func (h *TaskHandler) Next(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	fields := make(map[string]string)
+	limit := c.QueryInt("limit", defaultNextLimit)
+	if limit < 1 || limit > maxNextLimit {
+		fields["limit"] = fmt.Sprintf("limit must be between 1 and %d", maxNextLimit)
+	}
+	minutes := 0
+	if v := c.Query("minutes"); v != "" {
+		minutes, err = strconv.Atoi(v)
+		if err != nil || minutes < 1 || minutes > maxNextMinutes {
+			fields["minutes"] = fmt.Sprintf("minutes must be between 1 and %d", maxNextMinutes)
+		}
+	}
+	now := time.Now()
+	if v := c.Query("at"); v != "" {
+		if now, err = time.Parse(time.RFC3339, v); err != nil {
+			fields["at"] = "at must be an RFC3339 timestamp"
+		}
+	}
+	loc, tzName, err := h.userLocation(c.Context(), userID, c.Query("tz"))
+	if err != nil {
+		fields["tz"] = "unknown time zone"
+	}
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	weights, err := h.getRankWeights(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	candidates, childCounts, err := h.nextCandidates(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	ranked := models.RankTasks(candidates, now.In(loc), minutes, weights)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	resp := NextResponse{
+		Tasks:            make([]NextTaskResponse, len(ranked)),
+		Weights:          weights,
+		Timezone:         tzName,
+		AvailableMinutes: minutes,
+		GeneratedAt:      now.UTC().Format(time.RFC3339),
+	}
+	for i, r := range ranked {
+		resp.Tasks[i] = NextTaskResponse{
+			Task:        toTaskResponse(r.Task, childCounts[r.Task.ID]),
+			Rank:        i + 1,
+			Score:       r.Score,
+			Factors:     r.Factors,
+			Explanation: r.Explanation,
+		}
+	}
+
+	return httputil.Success(c, resp)
+}
+
+// GetNextWeights returns the user's ranking weights (defaults merged with overrides)
+// GET /tasks/next/weights
+func (h *TaskHandler) GetNextWeights(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	weights, err := h.getRankWeights(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	return httputil.Success(c, weights)
+}
+
+// UpdateNextWeights changes some of the user's ranking weights, e.g. {"due_soon": 6}
+// PUT /tasks/next/weights
+func (h *TaskHandler) UpdateNextWeights(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req map[string]float64
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	fields := make(map[string]string)
+	if len(req) == 0 {
+		fields["weights"] = "at least one weight is required"
+	}
+	probe := models.DefaultRankWeights()
+	for factor, value := range req {
+		if !probe.Set(factor, value) {
+			fields[factor] = "unknown ranking factor"
+		} else if value < -models.MaxRankWeight || value > models.MaxRankWeight {
+			fields[factor] = fmt.Sprintf("weight must be between %g and %g", -models.MaxRankWeight, models.MaxRankWeight)
+		}
+	}
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	overrides, _ := json.Marshal(req)
+	_, err = h.db.Exec(c.Context(),
+		`INSERT INTO task_ranking_weights (user_id, weights, updated_at)
+		 VALUES ($1, $2, NOW())
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET weights = task_ranking_weights.weights || EXCLUDED.weights, updated_at = NOW()`,
+		userID, overrides,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to save weights")
+	}
+
+	weights, err := h.getRankWeights(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+
+	return httputil.Success(c, weights)
+}
+
+// ResetNextWeights restores the default ranking weights
+// DELETE /tasks/next/weights
+func (h *TaskHandler) ResetNextWeights(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	if _, err := h.db.Exec(c.Context(), `DELETE FROM task_ranking_weights WHERE user_id = $1`, userID); err != nil {
+		return httputil.InternalError(c, "failed to reset weights")
+	}
+
+	return httputil.Success(c, models.DefaultRankWeights())
+}
+
+// getRankWeights applies the user's stored overrides to the default weights
+func (h *TaskHandler) getRankWeights(ctx context.Context, userID uuid.UUID) (models.RankWeights, error) {
+	weights := models.DefaultRankWeights()
+
+	var overridesJSON []byte
+	err := h.db.QueryRow(ctx,
+		`SELECT weights FROM task_ranking_weights WHERE user_id = $1`, userID,
+	).Scan(&overridesJSON)
+	if err == pgx.ErrNoRows {
+		return weights, nil
+	}
+	if err != nil {
+		return weights, err
+	}
+
+	var overrides map[string]float64
+	if err := json.Unmarshal(overridesJSON, &overrides); err != nil {
+		return weights, nil // Fall back to defaults
+	}
+	for factor, value := range overrides {
+		weights.Set(factor, value)
+	}
+	return weights, nil
+}
+
+// userLocation resolves the time zone for day boundaries: the requested one,
+// else the user's setting, else UTC
+func (h *TaskHandler) userLocation(ctx context.Context, userID uuid.UUID, requested string) (*time.Location, string, error) {
+	if requested != "" {
+		loc, err := time.LoadLocation(requested)
+		if err != nil {
+			return time.UTC, "", err
+		}
+		return loc, requested, nil
+	}
+
+	if tz, err := repository.GetUserTimezone(ctx, userID); err == nil && tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc, tz, nil
+		}
+	}
+	return time.UTC, "UTC", nil
+}
+
+// nextCandidates loads the user's open tasks with their subtask progress
+func (h *TaskHandler) nextCandidates(ctx context.Context, userID uuid.UUID) ([]models.RankCandidate, map[uuid.UUID]int, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
+		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.parent_id, t.depth, t.sort_order, COALESCE(t.complexity, 0), t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
+		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
+		 FROM tasks t
+		 WHERE `+visibleTo("$1")+` AND t.deleted_at IS NULL
+		 AND t.status NOT IN ('completed', 'cancelled', 'archived')
+		 AND (t.assignee_id IS NULL OR t.assignee_id = $1)
+		 ORDER BY t.due_at ASC NULLS LAST, t.priority DESC, t.created_at ASC
+		 LIMIT $2`,
+		userID, maxNextCandidates,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	candidates := make([]models.RankCandidate, 0)
+	childCounts := make(map[uuid.UUID]int)
+	var parentIDs []uuid.UUID
+	for rows.Next() {
+		task, childCount, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, models.RankCandidate{Task: task})
+		childCounts[task.ID] = childCount
+		if childCount > 0 {
+			parentIDs = append(parentIDs, task.ID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(parentIDs) == 0 {
+		return candidates, childCounts, nil
+	}
+
+	// Subtask progress for tasks that have subtasks
+	progress, err := h.db.Query(ctx,
+		`SELECT parent_id, COUNT(*), COUNT(*) FILTER (WHERE status = 'completed')
+		 FROM tasks
+		 WHERE parent_id = ANY($1) AND deleted_at IS NULL AND status NOT IN ('cancelled', 'archived')
+		 GROUP BY parent_id`,
+		parentIDs,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer progress.Close()
+
+	type counts struct{ total, done int }
+	byParent := make(map[uuid.UUID]counts)
+	for progress.Next() {
+		var parentID uuid.UUID
+		var n counts
+		if err := progress.Scan(&parentID, &n.total, &n.done); err != nil {
+			return nil, nil, err
+		}
+		byParent[parentID] = n
+	}
+	for i := range candidates {
+		if n, ok := byParent[candidates[i].Task.ID]; ok {
+			candidates[i].Subtasks = n.total
+			candidates[i].SubtasksDone = n.done
+		}
+	}
+
+	return candidates, childCounts, progress.Err()
+}
@@ -0,0 +1,398 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/llm"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/webhook"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// Plan-my-day limits
+const (
+	defaultWorkStart   = "09:00"
+	defaultWorkEnd     = "17:00"
+	maxPlanBusy        = 200
+	maxPlanICSBytes    = 512 * 1024
+	maxPlanBlocks      = 200
+	maxEstimateMinutes = 8 * 60
+)
+
+// PlanDayRequest describes the day to plan. Busy time can be given as
+// intervals, an iCalendar file, or both.
+type PlanDayRequest struct {
+	Date            string            `json:"date,omitempty"`       // YYYY-MM-DD, default today
+	Timezone        string            `json:"timezone,omitempty"`   // Default from user settings
+	WorkStart       string            `json:"work_start,omitempty"` // HH:MM, default 09:00
+	WorkEnd         string            `json:"work_end,omitempty"`   // HH:MM, default 17:00
+	Busy            []models.Interval `json:"busy,omitempty"`
+	BusyICS         string            `json:"busy_ics,omitempty"`
+	TaskIDs         []string          `json:"task_ids,omitempty"`  // Only plan these tasks
+	Estimates       map[string]int    `json:"estimates,omitempty"` // Task ID -> minutes
+	MaxBlockMinutes int               `json:"max_block_minutes,omitempty"`
+	At              string            `json:"at,omitempty"` // RFC3339 "now", for reproducible plans
+	Rationale       bool              `json:"rationale,omitempty"`
+}
+
+// PlanDayResponse is a proposed schedule; nothing is saved until it is accepted
+type PlanDayResponse struct {
+	Date     string          `json:"date"`
+	Timezone string          `json:"timezone"`
+	Work     models.Interval `json:"work"`
+	models.Schedule
+	Rationale string `json:"rationale,omitempty"`
+}
+
+// AcceptPlanRequest is the (possibly edited) list of blocks to save
+type AcceptPlanRequest struct {
+	Blocks []struct {
+		TaskID string    `json:"task_id"`
+		Start  time.Time `json:"start"`
+		End    time.Time `json:"end"`
+	} `json:"blocks"`
+}
+
+// PlanDay proposes a time-blocked schedule of open tasks for a day
+// POST /tasks/plan-day
+func (h *TaskHandler) PlanDay(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req PlanDayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	fields := make(map[string]string)
+	loc, tzName, err := h.userLocation(c.Context(), userID, req.Timezone)
+	if err != nil {
+		fields["timezone"] = "unknown time zone"
+	}
+	now := time.Now()
+	if req.At != "" {
+		if now, err = time.Parse(time.RFC3339, req.At); err != nil {
+			fields["at"] = "at must be an RFC3339 timestamp"
+		}
+	}
+	now = now.In(loc)
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if req.Date != "" {
+		if day, err = time.ParseInLocation("2006-01-02", req.Date, loc); err != nil {
+			fields["date"] = "date must be YYYY-MM-DD"
+		}
+	}
+
+	work, workErr := workingHours(day, req.WorkStart, req.WorkEnd)
+	if workErr != "" {
+		fields["work_start"] = workErr
+	}
+
+	busy := req.Busy
+	for _, b := range busy {
+		if !b.End.After(b.Start) {
+			fields["busy"] = "each busy interval must end after it starts"
+			break
+		}
+	}
+	if len(req.BusyICS) > maxPlanICSBytes {
+		fields["busy_ics"] = "calendar file is too large"
+	} else if req.BusyICS != "" {
+		events, err := models.ParseBusyICS(req.BusyICS, loc)
+		if err != nil {
+			fields["busy_ics"] = "invalid calendar: " + err.Error()
+		}
+		busy = append(busy, events...)
+	}
+	if len(busy) > maxPlanBusy {
+		fields["busy"] = fmt.Sprintf("max %d busy intervals", maxPlanBusy)
+	}
+
+	onlyIDs, err := parseUUIDs(req.TaskIDs)
+	if err != nil {
+		fields["task_ids"] = "invalid task ID"
+	}
+	estimates := make(map[uuid.UUID]int, len(req.Estimates))
+	for id, minutes := range req.Estimates {
+		taskID, err := uuid.Parse(id)
+		if err != nil {
+			fields["estimates"] = "invalid task ID"
+			break
+		}
+		if minutes < 1 || minutes > maxEstimateMinutes {
+			fields["estimates"] = fmt.Sprintf("estimates must be between 1 and %d minutes", maxEstimateMinutes)
+			break
+		}
+		estimates[taskID] = minutes
+	}
+	if req.MaxBlockMinutes != 0 && (req.MaxBlockMinutes < 15 || req.MaxBlockMinutes > maxEstimateMinutes) {
+		fields["max_block_minutes"] = fmt.Sprintf("max_block_minutes must be between 15 and %d", maxEstimateMinutes)
+	}
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	// Plan in ranking order so the most important work gets the earliest slots
+	weights, err := h.getRankWeights(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	candidates, _, err := h.nextCandidates(c.Context(), userID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	candidates = planCandidates(candidates, onlyIDs)
+
+	schedule := models.PlanDay(models.ScheduleInput{
+		Work:      work,
+		Now:       now,
+		Busy:      busy,
+		Tasks:     models.RankTasks(candidates, now, 0, weights),
+		Estimates: estimates,
+		MaxBlock:  time.Duration(req.MaxBlockMinutes) * time.Minute,
+	})
+
+	resp := PlanDayResponse{
+		Date:     day.Format("2006-01-02"),
+		Timezone: tzName,
+		Work:     work,
+		Schedule: schedule,
+	}
+	if req.Rationale && len(schedule.Blocks) > 0 {
+		resp.Rationale = h.planRationale(c.Context(), userID, resp)
+	}
+
+	return httputil.Success(c, resp)
+}
+
+// AcceptPlan saves a schedule: each task's start_date becomes its first
+// block's start, and tasks without a due date get their last block's end
+// POST /tasks/plan-day/accept
+func (h *TaskHandler) AcceptPlan(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req AcceptPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	fields := make(map[string]string)
+	if len(req.Blocks) == 0 {
+		fields["blocks"] = "at least one block is required"
+	} else if len(req.Blocks) > maxPlanBlocks {
+		fields["blocks"] = fmt.Sprintf("max %d blocks", maxPlanBlocks)
+	}
+
+	spans := make(map[uuid.UUID]models.Interval)
+	var order []uuid.UUID
+	for _, b := range req.Blocks {
+		taskID, err := uuid.Parse(b.TaskID)
+		if err != nil {
+			fields["blocks"] = "invalid task ID"
+			break
+		}
+		if !b.End.After(b.Start) {
+			fields["blocks"] = "each block must end after it starts"
+			break
+		}
+		span, ok := spans[taskID]
+		if !ok {
+			order = append(order, taskID)
+			span = models.Interval{Start: b.Start, End: b.End}
+		}
+		if b.Start.Before(span.Start) {
+			span.Start = b.Start
+		}
+		if b.End.After(span.End) {
+			span.End = b.End
+		}
+		spans[taskID] = span
+	}
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	// Check access to every task before changing any
+	owners := make(map[uuid.UUID]uuid.UUID, len(order))
+	for _, taskID := range order {
+		ownerID, _, err := h.editableTask(c.Context(), taskID, userID)
+		if err != nil {
+			return err
+		}
+		owners[taskID] = ownerID
+	}
+
+	// The whole plan is saved or none of it
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	setDue := make(map[uuid.UUID]bool, len(order))
+	for _, taskID := range order {
+		span := spans[taskID]
+		var dueWasEmpty bool
+		err := tx.QueryRow(c.Context(),
+			`WITH old AS (SELECT due_at FROM tasks WHERE id = $3)
+			 UPDATE tasks SET start_date = $1, due_at = COALESCE(due_at, $2),
+			 has_due_time = has_due_time OR due_at IS NULL,
+			 version = version + 1, updated_at = NOW(), last_modified_by = $5
+			 WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL
+			 RETURNING (SELECT due_at IS NULL FROM old)`,
+			span.Start, span.End, taskID, owners[taskID], userID,
+		).Scan(&dueWasEmpty)
+		if err == pgx.ErrNoRows {
+			return httputil.NotFound(c, "task")
+		}
+		if err != nil {
+			return httputil.InternalError(c, "failed to save plan")
+		}
+		setDue[taskID] = dueWasEmpty
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to save plan")
+	}
+
+	// Activity and webhook events only once the plan is committed
+	updated := make([]TaskResponse, 0, len(order))
+	for _, taskID := range order {
+		changes := []string{"start_date"}
+		if setDue[taskID] {
+			changes = append(changes, "due_at")
+		}
+		h.recordActivity(c.Context(), taskID, userID, "planned", changes)
+
+		task, childCount, err := h.getTask(c.Context(), taskID, userID)
+		if err != nil {
+			continue
+		}
+		resp := toTaskResponse(task, childCount)
+		publishTaskEvent(owners[taskID], webhook.EventTaskUpdated, resp)
+		updated = append(updated, resp)
+	}
+
+	return httputil.Success(c, updated)
+}
+
+// workingHours turns HH:MM bounds into the working interval on day
+func workingHours(day time.Time, startText, endText string) (models.Interval, string) {
+	if startText == "" {
+		startText = defaultWorkStart
+	}
+	if endText == "" {
+		endText = defaultWorkEnd
+	}
+	start, err1 := time.Parse("15:04", startText)
+	end, err2 := time.Parse("15:04", endText)
+	if err1 != nil || err2 != nil {
+		return models.Interval{}, "working hours must be HH:MM"
+	}
+
+	at := func(t time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location())
+	}
+	work := models.Interval{Start: at(start), End: at(end)}
+	if !work.End.After(work.Start) {
+		return models.Interval{}, "work_end must be after work_start"
+	}
+	return work, ""
+}
+
+// planCandidates drops tasks whose open subtasks get planned instead, and
+// keeps only the requested tasks when some are given
+func planCandidates(candidates []models.RankCandidate, only []uuid.UUID) []models.RankCandidate {
+	wanted := make(map[uuid.UUID]bool, len(only))
+	for _, id := range only {
+		wanted[id] = true
+	}
+
+	out := make([]models.RankCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if len(wanted) > 0 && !wanted[c.Task.ID] {
+			continue
+		}
+		if c.Subtasks > c.SubtasksDone {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// planRationale asks the LLM to explain the schedule in a few sentences.
+// The plan itself never depends on it; on any failure there is no rationale.
+func (h *TaskHandler) planRationale(ctx context.Context, userID uuid.UUID, plan PlanDayResponse) string {
+	if h.llm == nil {
+		return ""
+	}
+	if h.aiService != nil {
+		if canUse, _ := h.aiService.CheckAndIncrementUsage(ctx, userID, FeatureDayPlan); !canUse {
+			return ""
+		}
+	}
+
+	loc := plan.Work.Start.Location()
+	var b strings.Builder
+	for _, block := range plan.Blocks {
+		fmt.Fprintf(&b, "- %s-%s %s", block.Start.In(loc).Format("15:04"), block.End.In(loc).Format("15:04"), block.Title)
+		if block.Parts > 1 {
+			fmt.Fprintf(&b, " (part %d of %d)", block.Part, block.Parts)
+		}
+		if block.Fixed {
+			b.WriteString(" (fixed time)")
+		}
+		b.WriteString("\n")
+	}
+	unscheduled := make([]string, 0, len(plan.Unscheduled))
+	for _, u := range plan.Unscheduled {
+		unscheduled = append(unscheduled, fmt.Sprintf("%s (%d min, %s)", u.Title, u.Minutes, u.Reason))
+	}
+	sort.Strings(unscheduled)
+
+	prompt := fmt.Sprintf(`Explain this day plan to the user in 2-3 short sentences: why the first tasks come first and what to watch out for. Do not propose changes.
+
+Date: %s, working hours %s-%s
+Schedule:
+%s
+Did not fit: %s
+
+Return ONLY the explanation as plain text.`,
+		plan.Date, plan.Work.Start.In(loc).Format("15:04"), plan.Work.End.In(loc).Format("15:04"),
+		b.String(), func() string {
+			if len(unscheduled) == 0 {
+				return "nothing"
+			}
+			return strings.Join(unscheduled, "; ")
+		}())
+
+	resp, err := h.llm.Complete(ctx, llm.CompletionRequest{
+		Messages: []llm.Message{
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:   200,
+		Temperature: 0.3,
+		Feature:     "day_plan",
+		UserID:      userID,
+	})
+	if err != nil {
+		fmt.Printf("[PlanDay] Rationale failed: %v\n", err)
+		return ""
+	}
+	return strings.TrimSpace(resp.Content)
+}
@@ -0,0 +1,146 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/embeddings"
+)
+
+// Semantic search limits
+const (
+	defaultSemanticLimit = 20
+	maxSemanticLimit     = 50
+	defaultRelatedLimit  = 5
+)
+
+// ScoredTaskResponse is a task with its similarity to a query (-1 to 1)
+type ScoredTaskResponse struct {
+	Task  TaskResponse `json:"task"`
+	Score float64      `json:"score"`
+}
+
+// SemanticSearch ranks the user's tasks by meaning rather than wording, so
+// "call the plumber" finds "fix the leaking sink". Tasks are embedded in
+// the background and may take a few seconds to become searchable.
+// GET /tasks/semantic-search?q=&limit=
+func (h *TaskHandler) SemanticSearch(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	fields := make(map[string]string)
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		fields["q"] = "required"
+	}
+	limit := c.QueryInt("limit", defaultSemanticLimit)
+	if limit < 1 || limit > maxSemanticLimit {
+		fields["limit"] = fmt.Sprintf("limit must be between 1 and %d", maxSemanticLimit)
+	}
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+	if !h.embedder.Available() {
+		return httputil.ServiceUnavailable(c, "semantic search not available")
+	}
+
+	matches, err := h.embedder.Search(c.Context(), userID, query, limit)
+	if err != nil {
+		return semanticFailed(c, err)
+	}
+	return h.scoredTasks(c, userID, matches)
+}
+
+// Related returns the user's tasks most similar to a task
+// GET /tasks/:id/related?limit=
+func (h *TaskHandler) Related(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+	limit := c.QueryInt("limit", defaultRelatedLimit)
+	if limit < 1 || limit > maxSemanticLimit {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"limit": fmt.Sprintf("limit must be between 1 and %d", maxSemanticLimit),
+		})
+	}
+	if !h.embedder.Available() {
+		return httputil.ServiceUnavailable(c, "semantic search not available")
+	}
+
+	task, _, err := h.getTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+	text := task.Title
+	if task.Description != nil {
+		text += "\n" + *task.Description
+	}
+
+	matches, err := h.embedder.Related(c.Context(), userID, taskID, text, limit)
+	if err != nil {
+		return semanticFailed(c, err)
+	}
+	return h.scoredTasks(c, userID, matches)
+}
+
+// scoredTasks loads the matched tasks and responds with them in match order
+func (h *TaskHandler) scoredTasks(c *fiber.Ctx, userID uuid.UUID, matches []embeddings.Match) error {
+	ids := make([]uuid.UUID, len(matches))
+	for i, m := range matches {
+		ids[i] = m.TaskID
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT t.id, t.title, t.description, t.ai_cleaned_title, t.ai_cleaned_description,
+		 t.status, t.priority, t.due_at, t.has_due_time, t.completed_at, t.tags,
+		 t.parent_id, t.depth, t.sort_order, t.complexity, t.ai_entities, COALESCE(t.duplicate_of, '[]'), COALESCE(t.duplicate_resolved, false),
+		 t.created_at, t.updated_at, t.user_id, t.assignee_id, t.created_by, t.last_modified_by,
+		 (SELECT COUNT(*) FROM tasks WHERE parent_id = t.id AND deleted_at IS NULL) as children_count
+		 FROM tasks t
+		 WHERE t.user_id = $1 AND t.id = ANY($2) AND t.deleted_at IS NULL`,
+		userID, ids,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	byID := make(map[uuid.UUID]TaskResponse, len(ids))
+	for rows.Next() {
+		task, childCount, err := scanTask(rows)
+		if err != nil {
+			continue
+		}
+		byID[task.ID] = toTaskResponse(task, childCount)
+	}
+
+	results := make([]ScoredTaskResponse, 0, len(matches))
+	for _, m := range matches {
+		if task, ok := byID[m.TaskID]; ok {
+			results = append(results, ScoredTaskResponse{Task: task, Score: m.Score})
+		}
+	}
+	return httputil.Success(c, results)
+}
+
+// semanticFailed responds to a failed embedding or ranking
+func semanticFailed(c *fiber.Ctx, err error) error {
+	if errors.Is(err, embeddings.ErrUnavailable) {
+		return httputil.ServiceUnavailable(c, "semantic search not available")
+	}
+	fmt.Printf("[Semantic] Search failed: %v\n", err)
+	return aiFailed(c, err)
+}
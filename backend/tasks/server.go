@@ -16,7 +16,14 @@ import (
 	"github.com/csaptu/flow/pkg/config"
 	"github.com/csaptu/flow/pkg/llm"
 	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/accesstoken"
+	"github.com/csaptu/flow/shared/llmcache"
+	"github.com/csaptu/flow/shared/llmroute"
+	"github.com/csaptu/flow/shared/llmusage"
+	"github.com/csaptu/flow/shared/privacy"
+	"github.com/csaptu/flow/shared/prompts"
 	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/tasks/inbound"
 )
 
 // Server represents the tasks service server
@@ -26,6 +33,9 @@ type Server struct {
 	db     *pgxpool.Pool
 	redis  *redis.Client
 	llm    *llm.MultiClient
+	smtp   *inbound.SMTPServer
+
+	aiWorkers *AIWorkerPool
 }
 
 // NewServer creates a new tasks service server
@@ -47,27 +57,14 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	// Initialize LLM client
-	fmt.Printf("[Server] Initializing LLM with provider: %s, OpenAI key length: %d, Google key length: %d\n",
-		cfg.LLM.DefaultProvider, len(cfg.LLM.OpenAIAPIKey), len(cfg.LLM.GoogleAPIKey))
-
-	llmClient, err := llm.NewMultiClient(llm.Config{
-		DefaultProvider: llm.Provider(cfg.LLM.DefaultProvider),
-		AnthropicAPIKey: cfg.LLM.AnthropicAPIKey,
-		GoogleAPIKey:    cfg.LLM.GoogleAPIKey,
-		GoogleProjectID: cfg.LLM.GoogleProjectID,
-		OpenAIAPIKey:    cfg.LLM.OpenAIAPIKey,
-		OpenAIProjectID: cfg.LLM.OpenAIProjectID,
-		OllamaHost:      cfg.LLM.OllamaHost,
-		OllamaModel:     cfg.LLM.OllamaModel,
-	})
-	if err != nil {
-		fmt.Printf("Warning: LLM client initialization failed: %v\n", err)
-	} else if llmClient == nil {
-		fmt.Printf("Warning: LLM client is nil after initialization\n")
-	} else {
-		fmt.Printf("[Server] LLM client initialized successfully\n")
-	}
+	// Initialize LLM client, caching repeat prompts in Redis
+	llmClient := initLLM(cfg.LLM)
+	llmcache.Enable(llmClient, redisClient, cfg.LLM)
+	llmusage.Enable(llmClient, cfg.LLM)
+	privacy.Enable(llmClient, db)
+	llmroute.Enable(llmClient)
+	go prompts.Listen(context.Background(), redisClient)
+	go llmroute.Listen(context.Background(), redisClient)
 
 	server := &Server{
 		config: cfg,
@@ -80,7 +77,9 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	server.app = server.createApp()
 
 	// Register routes
-	server.registerRoutes()
+	if err := server.registerRoutes(); err != nil {
+		return nil, err
+	}
 
 	return server, nil
 }
@@ -90,6 +89,7 @@ func (s *Server) createApp() *fiber.App {
 		AppName:               "flow-tasks-service",
 		DisableStartupMessage: true,
 		ErrorHandler:          errorHandler,
+		BodyLimit:             inbound.MaxMessageBytes + 5*1024*1024, // Room for raw emails posted to the inbound webhook
 	})
 
 	// Global middleware
@@ -127,7 +127,7 @@ func (s *Server) createApp() *fiber.App {
 	return app
 }
 
-func (s *Server) registerRoutes() {
+func (s *Server) registerRoutes() error {
 	// Health check
 	s.app.Get("/health", s.healthCheck)
 
@@ -139,21 +139,37 @@ func (s *Server) registerRoutes() {
 
 	// All routes require authentication
 	v1.Use(middleware.Auth(middleware.AuthConfig{
-		JWTSecret: s.config.Auth.JWTSecret,
+		JWTSecret:      s.config.Auth.JWTSecret,
+		TokenValidator: accesstoken.Validate,
 	}))
 
 	// Initialize AI processor with Redis for WebSocket notifications
 	aiProcessor := NewAIProcessor(s.db, s.redis, s.llm)
 
+	// Run AI jobs in this process unless a separate ai-worker handles them
+	if s.config.LLM.QueueWorkers > 0 {
+		s.aiWorkers = NewAIWorkerPool(aiProcessor, s.config.LLM.QueueWorkers)
+		s.aiWorkers.Start()
+	}
+
 	// Task routes
 	taskHandler := NewTaskHandler(s.db, s.llm, aiProcessor)
-	tasks := v1.Group("/tasks")
+	tasks := v1.Group("/tasks", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
 	tasks.Post("", taskHandler.Create)
 	tasks.Get("", taskHandler.List)
 	tasks.Get("/today", taskHandler.Today)
 	tasks.Get("/inbox", taskHandler.Inbox)
 	tasks.Get("/upcoming", taskHandler.Upcoming)
 	tasks.Get("/completed", taskHandler.Completed)
+	tasks.Get("/assigned", taskHandler.Assigned)
+	tasks.Get("/search", taskHandler.Search)
+	tasks.Get("/semantic-search", taskHandler.SemanticSearch)
+	tasks.Get("/next", taskHandler.Next)
+	tasks.Get("/next/weights", taskHandler.GetNextWeights)
+	tasks.Put("/next/weights", taskHandler.UpdateNextWeights)
+	tasks.Delete("/next/weights", taskHandler.ResetNextWeights)
+	tasks.Post("/plan-day", taskHandler.PlanDay)
+	tasks.Post("/plan-day/accept", taskHandler.AcceptPlan)
 	tasks.Get("/:id", taskHandler.GetByID)
 	tasks.Put("/:id", taskHandler.Update)
 	tasks.Delete("/:id", taskHandler.Delete)
@@ -162,12 +178,27 @@ func (s *Server) registerRoutes() {
 	tasks.Post("/:id/children", taskHandler.CreateChild)
 	tasks.Get("/:id/children", taskHandler.GetChildren)
 	tasks.Put("/:id/children/reorder", taskHandler.ReorderChildren)
+	tasks.Get("/:id/activity", taskHandler.Activity)
+	tasks.Get("/:id/related", taskHandler.Related)
+	tasks.Post("/:id/merge", taskHandler.Merge)
+	tasks.Get("/:id/merges", taskHandler.Merges)
+	tasks.Post("/merges/:mergeId/undo", taskHandler.UndoMerge)
+	tasks.Get("/:id/suggestions", taskHandler.TaskSuggestions)
+	tasks.Post("/:id/suggestions/accept", taskHandler.AcceptSuggestions)
+	tasks.Post("/:id/suggestions/reject", taskHandler.RejectSuggestions)
+	tasks.Post("/:id/suggestions/:field/accept", taskHandler.AcceptSuggestions)
+	tasks.Post("/:id/suggestions/:field/reject", taskHandler.RejectSuggestions)
+
+	// AI suggestions waiting for review, across tasks
+	suggestions := v1.Group("/suggestions", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
+	suggestions.Get("", taskHandler.ListSuggestions)
+	suggestions.Post("/review", taskHandler.ReviewSuggestions)
 
 	// Note: AI features have been moved to the shared service
 	// See shared/ai/handler.go for AI endpoints
 
 	// Sync endpoint
-	v1.Post("/sync", taskHandler.Sync)
+	v1.Post("/sync", middleware.RequireScope(middleware.ScopeTasksRead, middleware.ScopeTasksWrite), taskHandler.Sync)
 
 	// Attachment routes
 	tasks.Post("/:id/attachments", taskHandler.CreateAttachment)
@@ -181,9 +212,67 @@ func (s *Server) registerRoutes() {
 	tasks.Delete("/entities/:type/:value", taskHandler.RemoveEntityFromAllTasks) // Remove from all tasks
 	tasks.Get("/entities/:type/:value/aliases", taskHandler.GetEntityAliases)    // Get aliases for an entity
 
+	// Sharing routes (hashtag lists and parent tasks shared by email)
+	shareHandler := NewShareHandler(s.db)
+	shares := v1.Group("/shares", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
+	shares.Get("", shareHandler.List)
+	shares.Post("", shareHandler.Create)
+	shares.Delete("/:id", shareHandler.Delete)
+	shares.Put("/:id/members/:memberId", shareHandler.UpdateMember)
+	shares.Delete("/:id/members/:memberId", shareHandler.RemoveMember)
+
+	// Template routes (reusable checklists with {{variables}})
+	templateHandler := NewTemplateHandler(s.db, taskHandler)
+	templates := v1.Group("/templates", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
+	templates.Get("", templateHandler.List)
+	templates.Post("", templateHandler.Create)
+	templates.Post("/from-task/:taskId", templateHandler.CreateFromTask)
+	templates.Get("/shared/:token", templateHandler.GetShared)
+	templates.Post("/shared/:token/copy", templateHandler.CopyShared)
+	templates.Post("/shared/:token/instantiate", templateHandler.InstantiateShared)
+	templates.Get("/:id", templateHandler.Get)
+	templates.Put("/:id", templateHandler.Update)
+	templates.Delete("/:id", templateHandler.Delete)
+	templates.Post("/:id/instantiate", templateHandler.Instantiate)
+	templates.Post("/:id/share", templateHandler.Share)
+	templates.Delete("/:id/share", templateHandler.Unshare)
+
+	// Entity directory routes (people, places and organizations)
+	entityHandler := NewEntityHandler(s.db)
+	entities := v1.Group("/entities", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
+	entities.Get("", entityHandler.List)
+	entities.Post("", entityHandler.Create)
+	entities.Get("/:id", entityHandler.Get)
+	entities.Put("/:id", entityHandler.Update)
+	entities.Delete("/:id", entityHandler.Delete)
+	entities.Post("/:id/aliases", entityHandler.AddAlias)
+	entities.Delete("/:id/aliases/:alias", entityHandler.RemoveAlias)
+	entities.Post("/:id/merge", entityHandler.Merge)
+
+	// Inbound email-to-task routes
+	inboundHandler := NewInboundEmailHandler(s.db, taskHandler, s.config.Email)
+	inboundEmail := v1.Group("/inbound-email", middleware.ScopeByMethod(middleware.ScopeTasksRead, middleware.ScopeTasksWrite))
+	inboundEmail.Get("", inboundHandler.GetSettings)
+	inboundEmail.Put("", inboundHandler.UpdateSettings)
+	inboundEmail.Post("/rotate", inboundHandler.RotateAddress)
+	inboundEmail.Get("/messages", inboundHandler.ListMessages)
+
+	// Inbound-parse webhook (authenticated with INBOUND_EMAIL_SECRET)
+	s.app.Post("/webhooks/inbound-email", inboundHandler.Webhook)
+
+	// Optional SMTP listener for the same gateway
+	if s.config.Email.InboundSMTPAddr != "" {
+		s.smtp = inbound.NewSMTPServer(s.config.Email.InboundSMTPAddr, s.config.Email.InboundDomain,
+			inboundHandler.AcceptRecipient, inboundHandler.DeliverSMTP)
+		if err := s.smtp.Start(); err != nil {
+			return fmt.Errorf("failed to start inbound SMTP listener: %w", err)
+		}
+		fmt.Printf("[Server] Inbound SMTP listening on %s\n", s.config.Email.InboundSMTPAddr)
+	}
+
 	// Subscription routes (payment flows with Paddle integration)
 	subHandler := NewSubscriptionHandler(s.db)
-	subs := v1.Group("/subscriptions")
+	subs := v1.Group("/subscriptions", middleware.ScopeByMethod(middleware.ScopeAccountRead, middleware.ScopeAccountWrite))
 	subs.Get("/plans", subHandler.GetPlans)
 	subs.Get("/me", subHandler.GetMySubscription)
 	subs.Post("/checkout", subHandler.CreateCheckout)
@@ -193,8 +282,8 @@ func (s *Server) registerRoutes() {
 	s.app.Post("/webhooks/paddle", subHandler.PaddleWebhook)
 
 	// Admin routes (requires admin role)
-	adminHandler := NewAdminHandler(s.db)
-	admin := v1.Group("/admin")
+	adminHandler := NewAdminHandler(s.db, s.redis, taskHandler.aiService)
+	admin := v1.Group("/admin", middleware.RequireSession())
 	admin.Use(adminHandler.AdminOnly())
 	admin.Get("/check", adminHandler.CheckAdmin)
 	admin.Get("/users", adminHandler.ListUsers)
@@ -207,6 +296,41 @@ func (s *Server) registerRoutes() {
 	admin.Put("/plans/:id/pricing", adminHandler.UpdatePlanPricing)
 	admin.Get("/ai-configs", adminHandler.ListAIConfigs)
 	admin.Put("/ai-configs/:key", adminHandler.UpdateAIConfig)
+	admin.Get("/ai-prompts", adminHandler.ListPromptFeatures)
+	admin.Get("/ai-prompts/versions/:id", adminHandler.GetPromptVersion)
+	admin.Post("/ai-prompts/versions/:id/test", adminHandler.TestPromptVersion)
+	admin.Post("/ai-prompts/versions/:id/publish", adminHandler.PublishPromptVersion)
+	admin.Post("/ai-prompts/experiments/:id/stop", adminHandler.StopPromptExperiment)
+	admin.Get("/ai-prompts/:feature/versions", adminHandler.ListPromptVersions)
+	admin.Post("/ai-prompts/:feature/versions", adminHandler.CreatePromptVersion)
+	admin.Post("/ai-prompts/:feature/rollback", adminHandler.RollbackPrompt)
+	admin.Get("/ai-prompts/:feature/experiments", adminHandler.ListPromptExperiments)
+	admin.Post("/ai-prompts/:feature/experiments", adminHandler.CreatePromptExperiment)
+	admin.Get("/ai-prompts/:feature/metrics", adminHandler.PromptMetrics)
+	admin.Get("/ai-routes", adminHandler.ListModelRoutes)
+	admin.Post("/ai-routes/dry-run", adminHandler.DryRunModelRoute)
+	admin.Put("/ai-routes/:feature/:tier", adminHandler.UpdateModelRoute)
+	admin.Delete("/ai-routes/:feature/:tier", adminHandler.DeleteModelRoute)
+	admin.Get("/ai-jobs", adminHandler.ListAIJobs)
+	admin.Get("/ai-jobs/stats", adminHandler.AIJobStats)
+	admin.Post("/ai-jobs/replay-dead", adminHandler.ReplayDeadAIJobs)
+	admin.Get("/ai-jobs/:id", adminHandler.GetAIJob)
+	admin.Post("/ai-jobs/:id/replay", adminHandler.ReplayAIJob)
+	admin.Get("/ai-cache/stats", s.aiCacheStats)
+	admin.Get("/ai-redaction/stats", s.aiRedactionStats)
+
+	return nil
+}
+
+// aiCacheStats reports LLM response cache hits and misses for this process
+func (s *Server) aiCacheStats(c *fiber.Ctx) error {
+	return c.JSON(dto.Success(llmcache.Stats(s.llm)))
+}
+
+// aiRedactionStats reports what was redacted from AI calls and which calls
+// privacy mode kept local, for this process
+func (s *Server) aiRedactionStats(c *fiber.Ctx) error {
+	return c.JSON(dto.Success(privacy.Stats(s.llm)))
 }
 
 func (s *Server) healthCheck(c *fiber.Ctx) error {
@@ -255,6 +379,14 @@ func (s *Server) Listen(addr string) error {
 
 // ShutdownWithContext gracefully shuts down the server
 func (s *Server) ShutdownWithContext(ctx context.Context) error {
+	if s.smtp != nil {
+		s.smtp.Stop()
+	}
+	if s.aiWorkers != nil {
+		if err := s.aiWorkers.Stop(ctx); err != nil {
+			fmt.Printf("[Server] AI workers still running at shutdown: %v\n", err)
+		}
+	}
 	if s.db != nil {
 		s.db.Close()
 	}
@@ -264,6 +396,40 @@ func (s *Server) ShutdownWithContext(ctx context.Context) error {
 	return s.app.ShutdownWithContext(ctx)
 }
 
+func initLLM(cfg config.LLMConfig) *llm.MultiClient {
+	fmt.Printf("[Server] Initializing LLM with provider: %s, OpenAI key length: %d, Google key length: %d\n",
+		cfg.DefaultProvider, len(cfg.OpenAIAPIKey), len(cfg.GoogleAPIKey))
+
+	llmClient, err := llm.NewMultiClient(llm.Config{
+		DefaultProvider: llm.Provider(cfg.DefaultProvider),
+		AnthropicAPIKey: cfg.AnthropicAPIKey,
+		GoogleAPIKey:    cfg.GoogleAPIKey,
+		GoogleProjectID: cfg.GoogleProjectID,
+		OpenAIAPIKey:    cfg.OpenAIAPIKey,
+		OpenAIProjectID: cfg.OpenAIProjectID,
+		OllamaHost:      cfg.OllamaHost,
+		OllamaModel:     cfg.OllamaModel,
+		FakeMode:        llm.FakeMode(cfg.FakeMode),
+		CassetteDir:     cfg.CassetteDir,
+		FakeUpstream:    llm.Provider(cfg.FakeUpstream),
+		Fallbacks:       cfg.Fallbacks,
+		Retry:           llm.RetryPolicy{MaxAttempts: cfg.RetryAttempts},
+		Breaker:         llm.BreakerPolicy{Failures: cfg.BreakerFailures, CoolDown: cfg.BreakerCoolDown},
+
+		EmbeddingProvider: llm.Provider(cfg.EmbeddingProvider),
+		EmbeddingModel:    cfg.EmbeddingModel,
+		Endpoints:         cfg.Endpoints,
+	})
+	if err != nil {
+		fmt.Printf("Warning: LLM client initialization failed: %v\n", err)
+	} else if llmClient == nil {
+		fmt.Printf("Warning: LLM client is nil after initialization\n")
+	} else {
+		fmt.Printf("[Server] LLM client initialized successfully\n")
+	}
+	return llmClient
+}
+
 func initDatabase(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(cfg.DSN())
 	if err != nil {
@@ -0,0 +1,473 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// ShareHandler handles sharing of hashtag lists and parent tasks.
+// Only the owner of a list or task can share it; participants see the shared
+// tasks in their own views with the role they were given.
+type ShareHandler struct {
+	db *pgxpool.Pool
+}
+
+// NewShareHandler creates a new share handler
+func NewShareHandler(db *pgxpool.Pool) *ShareHandler {
+	return &ShareHandler{db: db}
+}
+
+// CreateShareRequest invites a user (by email) to a list or a parent task.
+// Sharing the same list or task again adds a member to the existing share.
+type CreateShareRequest struct {
+	Type    string  `json:"type"`               // list or task
+	ListTag *string `json:"list_tag,omitempty"` // type=list, e.g. "#Groceries"
+	TaskID  *string `json:"task_id,omitempty"`  // type=task, must be a parent task
+	Email   string  `json:"email"`
+	Role    string  `json:"role,omitempty"` // viewer (default) or editor
+}
+
+// UpdateMemberRequest changes a member's role
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// ShareMemberResponse represents a participant of a share
+type ShareMemberResponse struct {
+	ID        string  `json:"id"`
+	Email     string  `json:"email"`
+	UserID    *string `json:"user_id,omitempty"`
+	Role      string  `json:"role"`
+	Pending   bool    `json:"pending"` // invitee has no account yet
+	CreatedAt string  `json:"created_at"`
+}
+
+// ShareResponse represents a share in API responses
+type ShareResponse struct {
+	ID        string                `json:"id"`
+	Type      string                `json:"type"`
+	ListTag   *string               `json:"list_tag,omitempty"`
+	TaskID    *string               `json:"task_id,omitempty"`
+	OwnerID   string                `json:"owner_id"`
+	Role      string                `json:"role"` // caller's role: owner, editor or viewer
+	Members   []ShareMemberResponse `json:"members"`
+	CreatedAt string                `json:"created_at"`
+}
+
+// ListSharesResponse separates what the user shares from what is shared with them
+type ListSharesResponse struct {
+	Owned        []ShareResponse `json:"owned"`
+	SharedWithMe []ShareResponse `json:"shared_with_me"`
+}
+
+// List returns the user's shares and the shares they participate in
+// GET /shares
+func (h *ShareHandler) List(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	h.claimPendingInvites(c.Context(), userID)
+
+	owned, err := h.queryShares(c.Context(), userID,
+		`WHERE s.owner_id = $1`)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list shares")
+	}
+
+	shared, err := h.queryShares(c.Context(), userID,
+		`WHERE s.id IN (SELECT share_id FROM task_share_members WHERE user_id = $1)`)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list shares")
+	}
+
+	return httputil.Success(c, ListSharesResponse{
+		Owned:        owned,
+		SharedWithMe: shared,
+	})
+}
+
+// Create shares a list or parent task with a user by email
+// POST /shares
+func (h *ShareHandler) Create(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req CreateShareRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+
+	errs := make(map[string]string)
+	if email == "" || !strings.Contains(email, "@") {
+		errs["email"] = "a valid email is required"
+	}
+	if req.Role != RoleViewer && req.Role != RoleEditor {
+		errs["role"] = "must be viewer or editor"
+	}
+	switch req.Type {
+	case ShareTypeList:
+		if req.ListTag == nil || len(*req.ListTag) < 2 || !strings.HasPrefix(*req.ListTag, "#") {
+			errs["list_tag"] = "required for list shares, e.g. #Groceries"
+		}
+	case ShareTypeTask:
+		if req.TaskID == nil {
+			errs["task_id"] = "required for task shares"
+		}
+	default:
+		errs["type"] = "must be list or task"
+	}
+	if len(errs) > 0 {
+		return httputil.ValidationError(c, "validation failed", errs)
+	}
+
+	// Sharing with yourself is a no-op at best
+	if owner, err := repository.GetUserByID(c.Context(), userID); err == nil && owner != nil &&
+		strings.EqualFold(owner.Email, email) {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"email": "you can't share with yourself",
+		})
+	}
+
+	var listTag *string
+	var taskID *uuid.UUID
+	if req.Type == ShareTypeList {
+		tag := strings.TrimSpace(*req.ListTag)
+		listTag = &tag
+	} else {
+		id, err := uuid.Parse(*req.TaskID)
+		if err != nil {
+			return httputil.BadRequest(c, "invalid task_id")
+		}
+
+		var depth int
+		err = h.db.QueryRow(c.Context(),
+			"SELECT depth FROM tasks WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL",
+			id, userID,
+		).Scan(&depth)
+		if err == pgx.ErrNoRows {
+			return httputil.NotFound(c, "task")
+		}
+		if err != nil {
+			return httputil.InternalError(c, "database error")
+		}
+		if depth != 0 {
+			return httputil.ValidationError(c, "validation failed", map[string]string{
+				"task_id": "only parent tasks can be shared",
+			})
+		}
+		taskID = &id
+	}
+
+	shareID, err := h.findOrCreateShare(c.Context(), userID, req.Type, listTag, taskID)
+	if err != nil {
+		return httputil.InternalError(c, "failed to create share")
+	}
+
+	// Invitees without an account are linked when they first open their shares
+	var inviteeID *uuid.UUID
+	if invitee, err := repository.GetUserByEmail(c.Context(), email); err == nil && invitee != nil {
+		inviteeID = &invitee.ID
+	}
+
+	_, err = h.db.Exec(c.Context(),
+		`INSERT INTO task_share_members (share_id, email, user_id, role, invited_by)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (share_id, email) DO UPDATE SET role = EXCLUDED.role, updated_at = NOW()`,
+		shareID, email, inviteeID, req.Role, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to add member")
+	}
+
+	shares, err := h.queryShares(c.Context(), userID, `WHERE s.id = $2`, shareID)
+	if err != nil || len(shares) == 0 {
+		return httputil.InternalError(c, "failed to load share")
+	}
+
+	return httputil.Created(c, shares[0])
+}
+
+// UpdateMember changes the role of a member (owner only)
+// PUT /shares/:id/members/:memberId
+func (h *ShareHandler) UpdateMember(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	shareID, memberID, err := parseShareMemberParams(c)
+	if err != nil {
+		return httputil.BadRequest(c, err.Error())
+	}
+
+	var req UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+	if req.Role != RoleViewer && req.Role != RoleEditor {
+		return httputil.ValidationError(c, "validation failed", map[string]string{
+			"role": "must be viewer or editor",
+		})
+	}
+
+	result, err := h.db.Exec(c.Context(),
+		`UPDATE task_share_members m SET role = $1, updated_at = NOW()
+		 FROM task_shares s
+		 WHERE m.id = $2 AND m.share_id = s.id AND s.id = $3 AND s.owner_id = $4`,
+		req.Role, memberID, shareID, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update member")
+	}
+	if result.RowsAffected() == 0 {
+		return httputil.NotFound(c, "share member")
+	}
+
+	return httputil.Success(c, map[string]string{"status": "ok"})
+}
+
+// RemoveMember removes a member. The owner can remove anyone; members can
+// remove themselves to leave a share.
+// DELETE /shares/:id/members/:memberId
+func (h *ShareHandler) RemoveMember(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	shareID, memberID, err := parseShareMemberParams(c)
+	if err != nil {
+		return httputil.BadRequest(c, err.Error())
+	}
+
+	grants := h.grantsBefore(c.Context(), shareID, &memberID)
+
+	var ownerID uuid.UUID
+	err = h.db.QueryRow(c.Context(),
+		`DELETE FROM task_share_members m
+		 USING task_shares s
+		 WHERE m.id = $1 AND m.share_id = s.id AND s.id = $2
+		 AND (s.owner_id = $3 OR m.user_id = $3)
+		 RETURNING s.owner_id`,
+		memberID, shareID, userID,
+	).Scan(&ownerID)
+	if err == pgx.ErrNoRows {
+		return httputil.NotFound(c, "share member")
+	}
+	if err != nil {
+		return httputil.InternalError(c, "failed to remove member")
+	}
+
+	recordLostAccess(c.Context(), h.db, grants)
+	h.releaseStaleAssignments(c.Context(), ownerID)
+
+	return httputil.NoContent(c)
+}
+
+// Delete stops sharing a list or task with everyone (owner only)
+// DELETE /shares/:id
+func (h *ShareHandler) Delete(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	shareID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid share ID")
+	}
+
+	grants := h.grantsBefore(c.Context(), shareID, nil)
+
+	result, err := h.db.Exec(c.Context(),
+		"DELETE FROM task_shares WHERE id = $1 AND owner_id = $2",
+		shareID, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to delete share")
+	}
+	if result.RowsAffected() == 0 {
+		return httputil.NotFound(c, "share")
+	}
+
+	recordLostAccess(c.Context(), h.db, grants)
+	h.releaseStaleAssignments(c.Context(), userID)
+
+	return httputil.NoContent(c)
+}
+
+// Helper functions
+
+func parseShareMemberParams(c *fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	shareID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid share ID")
+	}
+	memberID, err := uuid.Parse(c.Params("memberId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid member ID")
+	}
+	return shareID, memberID, nil
+}
+
+// findOrCreateShare returns the owner's existing share of the list/task or creates one
+func (h *ShareHandler) findOrCreateShare(ctx context.Context, ownerID uuid.UUID, shareType string, listTag *string, taskID *uuid.UUID) (uuid.UUID, error) {
+	var shareID uuid.UUID
+	err := h.db.QueryRow(ctx,
+		`SELECT id FROM task_shares
+		 WHERE owner_id = $1 AND share_type = $2
+		 AND (($2 = 'list' AND LOWER(list_tag) = LOWER($3)) OR ($2 = 'task' AND task_id = $4))`,
+		ownerID, shareType, listTag, taskID,
+	).Scan(&shareID)
+	if err == nil {
+		return shareID, nil
+	}
+	if err != pgx.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	err = h.db.QueryRow(ctx,
+		`INSERT INTO task_shares (owner_id, share_type, list_tag, task_id)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id`,
+		ownerID, shareType, listTag, taskID,
+	).Scan(&shareID)
+	return shareID, err
+}
+
+// claimPendingInvites links invitations sent to the user's email before they had an account
+func (h *ShareHandler) claimPendingInvites(ctx context.Context, userID uuid.UUID) {
+	user, err := repository.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		return
+	}
+
+	_, err = h.db.Exec(ctx,
+		`UPDATE task_share_members SET user_id = $1, updated_at = NOW()
+		 WHERE user_id IS NULL AND LOWER(email) = LOWER($2)`,
+		userID, user.Email,
+	)
+	if err != nil {
+		fmt.Printf("[Sharing] Failed to claim invites for user %s: %v\n", userID, err)
+	}
+}
+
+// releaseStaleAssignments unassigns the owner's tasks from participants who
+// can no longer see them.
+func (h *ShareHandler) releaseStaleAssignments(ctx context.Context, ownerID uuid.UUID) {
+	_, err := h.db.Exec(ctx,
+		`UPDATE tasks t SET assignee_id = NULL, updated_at = NOW()
+		 WHERE t.user_id = $1 AND t.assignee_id IS NOT NULL AND t.assignee_id <> $1
+		 AND NOT EXISTS (SELECT 1 FROM shared_task_access a WHERE a.task_id = t.id AND a.user_id = t.assignee_id)`,
+		ownerID,
+	)
+	if err != nil {
+		fmt.Printf("[Sharing] Failed to release assignments for owner %s: %v\n", ownerID, err)
+	}
+}
+
+// grantsBefore snapshots the access a share gives (to one member when memberID
+// is set) ahead of removing it, for recordLostAccess
+func (h *ShareHandler) grantsBefore(ctx context.Context, shareID uuid.UUID, memberID *uuid.UUID) []repository.AccessGrant {
+	grants, err := repository.ShareGrants(ctx, h.db, shareID, memberID)
+	if err != nil {
+		fmt.Printf("[Sharing] Failed to load access of share %s: %v\n", shareID, err)
+	}
+	return grants
+}
+
+// queryShares loads shares matching the WHERE clause ($1 is always the caller) with their members
+func (h *ShareHandler) queryShares(ctx context.Context, userID uuid.UUID, where string, args ...interface{}) ([]ShareResponse, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT s.id, s.share_type, s.list_tag, s.task_id, s.owner_id, s.created_at,
+		 CASE
+		   WHEN s.owner_id = $1 THEN 'owner'
+		   ELSE COALESCE((SELECT role FROM task_share_members WHERE share_id = s.id AND user_id = $1 LIMIT 1), '')
+		 END
+		 FROM task_shares s
+		 `+where+`
+		 ORDER BY s.created_at DESC`,
+		append([]interface{}{userID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]ShareResponse, 0)
+	for rows.Next() {
+		var id, ownerID uuid.UUID
+		var taskID *uuid.UUID
+		var share ShareResponse
+		var createdAt time.Time
+		if err := rows.Scan(&id, &share.Type, &share.ListTag, &taskID, &ownerID, &createdAt, &share.Role); err != nil {
+			continue
+		}
+		share.ID = id.String()
+		share.OwnerID = ownerID.String()
+		share.TaskID = uuidString(taskID)
+		share.CreatedAt = createdAt.Format(time.RFC3339)
+		shares = append(shares, share)
+	}
+	rows.Close()
+
+	for i := range shares {
+		members, err := h.shareMembers(ctx, shares[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		shares[i].Members = members
+	}
+
+	return shares, nil
+}
+
+func (h *ShareHandler) shareMembers(ctx context.Context, shareID string) ([]ShareMemberResponse, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT id, email, user_id, role, created_at
+		 FROM task_share_members
+		 WHERE share_id = $1
+		 ORDER BY created_at ASC`,
+		shareID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]ShareMemberResponse, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		var memberUserID *uuid.UUID
+		var m ShareMemberResponse
+		var createdAt time.Time
+		if err := rows.Scan(&id, &m.Email, &memberUserID, &m.Role, &createdAt); err != nil {
+			continue
+		}
+		m.ID = id.String()
+		m.UserID = uuidString(memberUserID)
+		m.Pending = memberUserID == nil
+		m.CreatedAt = createdAt.Format(time.RFC3339)
+		members = append(members, m)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,134 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Share types
+const (
+	ShareTypeList = "list" // a hashtag list, including its sublists
+	ShareTypeTask = "task" // a single parent task and its subtasks
+)
+
+// Access roles on a task. The owner role is implicit and never stored.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// visibleTo returns a WHERE fragment matching tasks (aliased t) that the user
+// bound to param owns or can reach through a share.
+func visibleTo(param string) string {
+	return "(t.user_id = " + param + " OR t.id IN (SELECT task_id FROM shared_task_access WHERE user_id = " + param + "))"
+}
+
+// taskAccess resolves the owner of a task and the caller's role on it.
+// Returns a 404 error when the task doesn't exist or isn't visible to the user.
+func (h *TaskHandler) taskAccess(ctx context.Context, taskID, userID uuid.UUID) (uuid.UUID, string, error) {
+	var ownerID uuid.UUID
+	var role string
+	err := h.db.QueryRow(ctx,
+		`SELECT t.user_id,
+		 CASE
+		   WHEN t.user_id = $2 THEN 'owner'
+		   WHEN EXISTS(SELECT 1 FROM shared_task_access a WHERE a.task_id = t.id AND a.user_id = $2 AND a.role = 'editor') THEN 'editor'
+		   WHEN EXISTS(SELECT 1 FROM shared_task_access a WHERE a.task_id = t.id AND a.user_id = $2) THEN 'viewer'
+		   ELSE ''
+		 END
+		 FROM tasks t
+		 WHERE t.id = $1 AND t.deleted_at IS NULL`,
+		taskID, userID,
+	).Scan(&ownerID, &role)
+
+	if err == pgx.ErrNoRows || (err == nil && role == "") {
+		return uuid.Nil, "", fiber.NewError(fiber.StatusNotFound, "task not found")
+	}
+	if err != nil {
+		return uuid.Nil, "", fiber.NewError(fiber.StatusInternalServerError, "database error")
+	}
+
+	return ownerID, role, nil
+}
+
+// editableTask is taskAccess for writes: viewers get a 403.
+func (h *TaskHandler) editableTask(ctx context.Context, taskID, userID uuid.UUID) (uuid.UUID, string, error) {
+	ownerID, role, err := h.taskAccess(ctx, taskID, userID)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if role == RoleViewer {
+		return uuid.Nil, "", fiber.NewError(fiber.StatusForbidden, "you have view-only access to this task")
+	}
+	return ownerID, role, nil
+}
+
+// sharedListOwner returns the owner of a list shared with the user as editor
+// that one of the tags belongs to. New tasks tagged with such a list are
+// created in the owner's list so every participant sees them.
+func (h *TaskHandler) sharedListOwner(ctx context.Context, userID uuid.UUID, tags []string) (uuid.UUID, bool) {
+	if len(tags) == 0 {
+		return uuid.Nil, false
+	}
+
+	var ownerID uuid.UUID
+	err := h.db.QueryRow(ctx,
+		`SELECT s.owner_id
+		 FROM task_shares s
+		 JOIN task_share_members m ON m.share_id = s.id
+		 WHERE m.user_id = $1 AND m.role = 'editor' AND s.share_type = 'list'
+		 AND EXISTS (
+		   SELECT 1 FROM UNNEST($2::text[]) AS tag
+		   WHERE LOWER(tag) = LOWER(s.list_tag) OR starts_with(LOWER(tag), LOWER(s.list_tag) || '/')
+		 )
+		 ORDER BY s.created_at ASC
+		 LIMIT 1`,
+		userID, tags,
+	).Scan(&ownerID)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return ownerID, true
+}
+
+// canBeAssigned reports whether the user owns the task or is a participant of a share covering it
+func (h *TaskHandler) canBeAssigned(ctx context.Context, taskID, userID uuid.UUID) bool {
+	var ok bool
+	err := h.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)
+		     OR EXISTS(SELECT 1 FROM shared_task_access WHERE task_id = $1 AND user_id = $2)`,
+		taskID, userID,
+	).Scan(&ok)
+	return err == nil && ok
+}
+
+// recordActivity attributes a change to the user (see repository.RecordTaskActivity)
+func (h *TaskHandler) recordActivity(ctx context.Context, taskID, userID uuid.UUID, action string, changes []string) {
+	if err := repository.RecordTaskActivity(ctx, h.db, taskID, userID, action, changes); err != nil {
+		fmt.Printf("[Sharing] Failed to record %s activity for task %s: %v\n", action, taskID, err)
+	}
+}
+
+// grantsBefore snapshots who sees the task or its subtasks through a share
+// ahead of a change that may end it, for recordLostAccess
+func (h *TaskHandler) grantsBefore(ctx context.Context, taskID uuid.UUID) []repository.AccessGrant {
+	grants, err := repository.TaskShareGrants(ctx, h.db, taskID)
+	if err != nil {
+		fmt.Printf("[Sharing] Failed to load access of task %s: %v\n", taskID, err)
+	}
+	return grants
+}
+
+// recordLostAccess keeps sync tombstones for grants that are gone (see repository.RecordLostAccess)
+func recordLostAccess(ctx context.Context, db repository.DBTX, grants []repository.AccessGrant) {
+	if err := repository.RecordLostAccess(ctx, db, grants); err != nil {
+		fmt.Printf("[Sharing] Failed to record lost access: %v\n", err)
+	}
+}
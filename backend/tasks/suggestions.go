@@ -0,0 +1,548 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/repository"
+	"github.com/csaptu/flow/shared/webhook"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// Task fields an AI suggestion can change
+const (
+	SuggestionTitle       = "title"
+	SuggestionDescription = "description"
+	SuggestionDueAt       = "due_at"
+	SuggestionComplexity  = "complexity"
+	SuggestionEntities    = "entities"
+)
+
+// suggestionFeatures maps each suggestion field to the AI preference that
+// puts it in review
+var suggestionFeatures = map[string]string{
+	SuggestionTitle:       "clean_title",
+	SuggestionDescription: "clean_description",
+	SuggestionDueAt:       "smart_due_date",
+	SuggestionComplexity:  "complexity",
+	SuggestionEntities:    "entity_extraction",
+}
+
+// maxSuggestionReview caps the suggestions resolved by one bulk review
+const maxSuggestionReview = 200
+
+// suggestedDue is the value of a due_at suggestion
+type suggestedDue struct {
+	DueAt      *time.Time `json:"due_at"`
+	HasDueTime bool       `json:"has_due_time"`
+}
+
+// SuggestionResponse is a pending AI suggestion for one task field
+type SuggestionResponse struct {
+	ID            string          `json:"id"`
+	TaskID        string          `json:"task_id"`
+	TaskTitle     string          `json:"task_title"`
+	Field         string          `json:"field"`
+	Value         json.RawMessage `json:"value"`
+	PreviousValue json.RawMessage `json:"previous_value,omitempty"`
+	CreatedAt     string          `json:"created_at"`
+}
+
+// ResolveSuggestionsRequest is the optional body of accept/reject
+type ResolveSuggestionsRequest struct {
+	Feedback *string `json:"feedback,omitempty"` // Why a suggestion was rejected
+}
+
+// ReviewSuggestionsRequest accepts and rejects suggestions across tasks
+type ReviewSuggestionsRequest struct {
+	Accept   []string `json:"accept"`
+	Reject   []string `json:"reject"`
+	Feedback *string  `json:"feedback,omitempty"` // Applies to the rejected ones
+}
+
+// ReviewSuggestionsResponse lists the tasks changed by a review
+type ReviewSuggestionsResponse struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Tasks    []TaskResponse `json:"tasks"` // Tasks with accepted changes, as updated
+}
+
+// suggestionFilter selects pending suggestions of a user
+type suggestionFilter struct {
+	taskID *uuid.UUID
+	field  string
+	ids    []uuid.UUID
+}
+
+// splitForReview moves the results of features set to "review" out of
+// results and returns them
+func splitForReview(results *AIQueueResult, prefs AIPreferences) *AIQueueResult {
+	review := &AIQueueResult{PromptVersion: results.PromptVersion}
+	inReview := func(field string) bool {
+		return prefs[suggestionFeatures[field]] == "review"
+	}
+
+	if results.CleanedTitle != nil && inReview(SuggestionTitle) {
+		review.CleanedTitle, results.CleanedTitle = results.CleanedTitle, nil
+	}
+	if results.CleanedDesc != nil && inReview(SuggestionDescription) {
+		review.CleanedDesc, results.CleanedDesc = results.CleanedDesc, nil
+	}
+	if results.DueAt != nil && inReview(SuggestionDueAt) {
+		review.DueAt, review.HasDueTime = results.DueAt, results.HasDueTime
+		results.DueAt, results.HasDueTime = nil, false
+	}
+	if results.Complexity != nil && inReview(SuggestionComplexity) {
+		review.Complexity, results.Complexity = results.Complexity, nil
+	}
+	if len(results.Entities) > 0 && inReview(SuggestionEntities) {
+		review.Entities, results.Entities = results.Entities, nil
+	}
+
+	return review
+}
+
+// saveSuggestions stores review results as pending suggestions, replacing
+// older pending ones for the same fields. A value the user already rejected
+// for the task isn't suggested again.
+func (p *AIProcessor) saveSuggestions(ctx context.Context, task *models.Task, review *AIQueueResult) error {
+	type suggestion struct {
+		field           string
+		value, previous interface{}
+	}
+	var suggestions []suggestion
+
+	if review.CleanedTitle != nil {
+		previous := task.Title
+		if task.AICleanedTitle != nil {
+			previous = *task.AICleanedTitle
+		}
+		suggestions = append(suggestions, suggestion{SuggestionTitle, *review.CleanedTitle, previous})
+	}
+	if review.CleanedDesc != nil {
+		previous := task.Description
+		if task.AICleanedDescription != nil {
+			previous = task.AICleanedDescription
+		}
+		suggestions = append(suggestions, suggestion{SuggestionDescription, *review.CleanedDesc, previous})
+	}
+	if review.DueAt != nil {
+		suggestions = append(suggestions, suggestion{SuggestionDueAt,
+			suggestedDue{DueAt: review.DueAt, HasDueTime: review.HasDueTime},
+			suggestedDue{DueAt: task.DueAt, HasDueTime: task.HasDueTime},
+		})
+	}
+	if review.Complexity != nil {
+		suggestions = append(suggestions, suggestion{SuggestionComplexity, *review.Complexity, task.Complexity})
+	}
+	if len(review.Entities) > 0 {
+		suggestions = append(suggestions, suggestion{SuggestionEntities, review.Entities, task.Entities})
+	}
+
+	var version *uuid.UUID
+	if review.PromptVersion != uuid.Nil {
+		version = &review.PromptVersion
+	}
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, s := range suggestions {
+		valueJSON, _ := json.Marshal(s.value)
+		previousJSON, _ := json.Marshal(s.previous)
+
+		_, err := tx.Exec(ctx,
+			`UPDATE ai_suggestions SET status = 'superseded', resolved_at = NOW()
+			 WHERE task_id = $1 AND field = $2 AND status = 'pending'`,
+			task.ID, s.field,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO ai_suggestions (user_id, task_id, field, value, previous_value, prompt_version)
+			 SELECT $1::uuid, $2::uuid, $3::text, $4::jsonb, $5::jsonb, $6::uuid
+			 WHERE NOT EXISTS (
+			   SELECT 1 FROM ai_suggestions
+			   WHERE task_id = $2 AND field = $3 AND status = 'rejected' AND value = $4::jsonb
+			 )`,
+			task.UserID, task.ID, s.field, valueJSON, previousJSON, version,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// applySuggestion sets the suggested value of field on result
+func applySuggestion(result *AIQueueResult, field string, value []byte) error {
+	switch field {
+	case SuggestionTitle:
+		return json.Unmarshal(value, &result.CleanedTitle)
+	case SuggestionDescription:
+		return json.Unmarshal(value, &result.CleanedDesc)
+	case SuggestionComplexity:
+		return json.Unmarshal(value, &result.Complexity)
+	case SuggestionEntities:
+		return json.Unmarshal(value, &result.Entities)
+	case SuggestionDueAt:
+		var due suggestedDue
+		if err := json.Unmarshal(value, &due); err != nil {
+			return err
+		}
+		result.DueAt, result.HasDueTime = due.DueAt, due.HasDueTime
+		return nil
+	}
+	return fmt.Errorf("unknown suggestion field %q", field)
+}
+
+// resolveSuggestions accepts or rejects the user's pending suggestions that
+// match the filter; accepted values are written to their tasks. Returns the
+// fields accepted per task.
+func (h *TaskHandler) resolveSuggestions(ctx context.Context, userID uuid.UUID, filter suggestionFilter, accept bool, feedback *string) (map[uuid.UUID][]string, int, error) {
+	status := "rejected"
+	if accept {
+		status = "accepted"
+		feedback = nil
+	}
+
+	conditions := []string{"user_id = $1", "status = 'pending'"}
+	args := []interface{}{userID, status, feedback}
+	if filter.taskID != nil {
+		args = append(args, *filter.taskID)
+		conditions = append(conditions, fmt.Sprintf("task_id = $%d", len(args)))
+	}
+	if filter.field != "" {
+		args = append(args, filter.field)
+		conditions = append(conditions, fmt.Sprintf("field = $%d", len(args)))
+	}
+	if filter.ids != nil {
+		args = append(args, filter.ids)
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d)", len(args)))
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`UPDATE ai_suggestions SET status = $2, feedback = $3, resolved_at = NOW()
+		 WHERE `+strings.Join(conditions, " AND ")+`
+		 RETURNING task_id, field, value, prompt_version`,
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	accepted := make(map[uuid.UUID][]string)
+	results := make(map[uuid.UUID]*AIQueueResult)
+	var versions []uuid.UUID // Prompt version of each resolved suggestion
+	count := 0
+	for rows.Next() {
+		var taskID uuid.UUID
+		var field string
+		var value []byte
+		var version *uuid.UUID
+		if err := rows.Scan(&taskID, &field, &value, &version); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		count++
+		if version != nil {
+			versions = append(versions, *version)
+		}
+		if !accept {
+			continue
+		}
+		if results[taskID] == nil {
+			results[taskID] = &AIQueueResult{}
+		}
+		if version != nil {
+			results[taskID].PromptVersion = *version
+		}
+		if err := applySuggestion(results[taskID], field, value); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		accepted[taskID] = append(accepted[taskID], field)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for taskID, result := range results {
+		if err := h.aiProcessor.applyAIResults(ctx, tx, taskID, userID, result); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	for _, version := range versions {
+		recordPromptOutcome(ctx, version, userID, status)
+	}
+	for _, result := range results {
+		recordPromptOutcome(ctx, result.PromptVersion, userID, repository.PromptOutcomeApplied)
+	}
+	return accepted, count, nil
+}
+
+// afterAccept records and announces the changes accepted suggestions made
+func (h *TaskHandler) afterAccept(ctx context.Context, userID uuid.UUID, accepted map[uuid.UUID][]string) []TaskResponse {
+	tasks := make([]TaskResponse, 0, len(accepted))
+	for taskID, fields := range accepted {
+		h.recordActivity(ctx, taskID, userID, "ai_accepted", fields)
+
+		task, childCount, err := h.getTask(ctx, taskID, userID)
+		if err != nil {
+			continue
+		}
+		resp := toTaskResponse(task, childCount)
+		publishTaskEvent(task.UserID, webhook.EventTaskUpdated, resp)
+		tasks = append(tasks, resp)
+	}
+	return tasks
+}
+
+// listSuggestions returns pending suggestions of the user, optionally for one task
+func (h *TaskHandler) listSuggestions(ctx context.Context, userID uuid.UUID, taskID *uuid.UUID, field string) ([]SuggestionResponse, error) {
+	args := []interface{}{userID}
+	query := `SELECT s.id, s.task_id, COALESCE(t.ai_cleaned_title, t.title), s.field, s.value, s.previous_value, s.created_at
+		FROM ai_suggestions s
+		JOIN tasks t ON t.id = s.task_id AND t.deleted_at IS NULL
+		WHERE s.user_id = $1 AND s.status = 'pending'`
+	if taskID != nil {
+		args = append(args, *taskID)
+		query += fmt.Sprintf(" AND s.task_id = $%d", len(args))
+	}
+	if field != "" {
+		args = append(args, field)
+		query += fmt.Sprintf(" AND s.field = $%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY s.created_at DESC LIMIT %d", maxSuggestionReview)
+
+	rows, err := h.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := make([]SuggestionResponse, 0)
+	for rows.Next() {
+		var s SuggestionResponse
+		var id, tID uuid.UUID
+		var previous []byte
+		var createdAt time.Time
+		if err := rows.Scan(&id, &tID, &s.TaskTitle, &s.Field, &s.Value, &previous, &createdAt); err != nil {
+			continue
+		}
+		s.ID = id.String()
+		s.TaskID = tID.String()
+		if len(previous) > 0 {
+			s.PreviousValue = previous
+		}
+		s.CreatedAt = createdAt.Format(time.RFC3339)
+		suggestions = append(suggestions, s)
+	}
+
+	return suggestions, nil
+}
+
+// TaskSuggestions returns the pending AI suggestions for a task
+// GET /tasks/:id/suggestions
+func (h *TaskHandler) TaskSuggestions(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+	if _, _, err := h.getTask(c.Context(), taskID, userID); err != nil {
+		return err
+	}
+
+	suggestions, err := h.listSuggestions(c.Context(), userID, &taskID, "")
+	if err != nil {
+		return httputil.InternalError(c, "failed to list suggestions")
+	}
+
+	return httputil.Success(c, suggestions)
+}
+
+// AcceptSuggestions applies a task's pending suggestions, all of them or
+// only the one for :field
+// POST /tasks/:id/suggestions/accept, POST /tasks/:id/suggestions/:field/accept
+func (h *TaskHandler) AcceptSuggestions(c *fiber.Ctx) error {
+	return h.resolveTaskSuggestions(c, true)
+}
+
+// RejectSuggestions discards a task's pending suggestions, all of them or
+// only the one for :field; the optional feedback is kept for the AI profile
+// POST /tasks/:id/suggestions/reject, POST /tasks/:id/suggestions/:field/reject
+func (h *TaskHandler) RejectSuggestions(c *fiber.Ctx) error {
+	return h.resolveTaskSuggestions(c, false)
+}
+
+func (h *TaskHandler) resolveTaskSuggestions(c *fiber.Ctx, accept bool) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+
+	field := c.Params("field")
+	if _, ok := suggestionFeatures[field]; field != "" && !ok {
+		return httputil.BadRequest(c, "invalid suggestion field")
+	}
+
+	var req ResolveSuggestionsRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return httputil.BadRequest(c, "invalid request body")
+		}
+	}
+
+	task, childCount, err := h.getTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+
+	accepted, count, err := h.resolveSuggestions(c.Context(), userID,
+		suggestionFilter{taskID: &taskID, field: field}, accept, trimFeedback(req.Feedback))
+	if err != nil {
+		return httputil.InternalError(c, "failed to resolve suggestions")
+	}
+	if count == 0 {
+		return httputil.NotFound(c, "suggestion")
+	}
+
+	if updated := h.afterAccept(c.Context(), userID, accepted); len(updated) > 0 {
+		return httputil.Success(c, updated[0])
+	}
+	return httputil.Success(c, toTaskResponse(task, childCount))
+}
+
+// ListSuggestions returns pending AI suggestions across all tasks (?field= to filter)
+// GET /suggestions
+func (h *TaskHandler) ListSuggestions(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	field := c.Query("field")
+	if _, ok := suggestionFeatures[field]; field != "" && !ok {
+		return httputil.BadRequest(c, "invalid suggestion field")
+	}
+
+	suggestions, err := h.listSuggestions(c.Context(), userID, nil, field)
+	if err != nil {
+		return httputil.InternalError(c, "failed to list suggestions")
+	}
+
+	return httputil.Success(c, suggestions)
+}
+
+// ReviewSuggestions accepts and rejects suggestions by ID, across tasks
+// POST /suggestions/review
+func (h *TaskHandler) ReviewSuggestions(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req ReviewSuggestionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	fields := make(map[string]string)
+	if len(req.Accept)+len(req.Reject) == 0 {
+		fields["accept"] = "accept or reject at least one suggestion"
+	} else if len(req.Accept)+len(req.Reject) > maxSuggestionReview {
+		fields["accept"] = fmt.Sprintf("max %d suggestions per review", maxSuggestionReview)
+	}
+	acceptIDs, err := parseUUIDs(req.Accept)
+	if err != nil {
+		fields["accept"] = "invalid suggestion ID"
+	}
+	rejectIDs, err := parseUUIDs(req.Reject)
+	if err != nil {
+		fields["reject"] = "invalid suggestion ID"
+	}
+	if len(fields) > 0 {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	resp := ReviewSuggestionsResponse{Tasks: []TaskResponse{}}
+	if len(rejectIDs) > 0 {
+		_, resp.Rejected, err = h.resolveSuggestions(c.Context(), userID,
+			suggestionFilter{ids: rejectIDs}, false, trimFeedback(req.Feedback))
+		if err != nil {
+			return httputil.InternalError(c, "failed to reject suggestions")
+		}
+	}
+	if len(acceptIDs) > 0 {
+		var accepted map[uuid.UUID][]string
+		accepted, resp.Accepted, err = h.resolveSuggestions(c.Context(), userID,
+			suggestionFilter{ids: acceptIDs}, true, nil)
+		if err != nil {
+			return httputil.InternalError(c, "failed to accept suggestions")
+		}
+		resp.Tasks = h.afterAccept(c.Context(), userID, accepted)
+	}
+
+	return httputil.Success(c, resp)
+}
+
+func parseUUIDs(values []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, v := range values {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func trimFeedback(feedback *string) *string {
+	if feedback == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*feedback)
+	if trimmed == "" {
+		return nil
+	}
+	if runes := []rune(trimmed); len(runes) > 500 {
+		trimmed = string(runes[:500])
+	}
+	return &trimmed
+}
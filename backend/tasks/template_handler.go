@@ -0,0 +1,769 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	commonModels "github.com/csaptu/flow/common/models"
+	"github.com/csaptu/flow/pkg/httputil"
+	"github.com/csaptu/flow/pkg/middleware"
+	"github.com/csaptu/flow/shared/webhook"
+	"github.com/csaptu/flow/tasks/models"
+)
+
+// TemplateHandler handles task template endpoints
+type TemplateHandler struct {
+	db    *pgxpool.Pool
+	tasks *TaskHandler
+}
+
+// NewTemplateHandler creates a new template handler
+func NewTemplateHandler(db *pgxpool.Pool, taskHandler *TaskHandler) *TemplateHandler {
+	return &TemplateHandler{
+		db:    db,
+		tasks: taskHandler,
+	}
+}
+
+// TemplateRequest creates or replaces a template
+type TemplateRequest struct {
+	Name          string                   `json:"name"`
+	Title         string                   `json:"title"`
+	Description   *string                  `json:"description,omitempty"`
+	Tags          []string                 `json:"tags,omitempty"`
+	Priority      *int                     `json:"priority,omitempty"`
+	DueOffsetDays *int                     `json:"due_offset_days,omitempty"` // Days after the anchor date
+	DueTime       *string                  `json:"due_time,omitempty"`        // "HH:MM"
+	Subtasks      []models.TemplateSubtask `json:"subtasks,omitempty"`        // In order
+}
+
+// TemplateFromTaskRequest creates a template from an existing task
+type TemplateFromTaskRequest struct {
+	Name string `json:"name,omitempty"` // Defaults to the task title
+}
+
+// InstantiateRequest creates tasks from a template
+type InstantiateRequest struct {
+	Variables  map[string]string `json:"variables,omitempty"`
+	AnchorDate *string           `json:"anchor_date,omitempty"` // "YYYY-MM-DD" or RFC3339; defaults to today (UTC)
+}
+
+// TemplateResponse represents a template in API responses
+type TemplateResponse struct {
+	ID            string                   `json:"id"`
+	Name          string                   `json:"name"`
+	Title         string                   `json:"title"`
+	Description   *string                  `json:"description,omitempty"`
+	Tags          []string                 `json:"tags"`
+	Priority      int                      `json:"priority"`
+	DueOffsetDays *int                     `json:"due_offset_days,omitempty"`
+	DueTime       *string                  `json:"due_time,omitempty"`
+	Subtasks      []models.TemplateSubtask `json:"subtasks"`
+	Variables     []string                 `json:"variables"` // Placeholders that must be filled on instantiate
+	IsOwner       bool                     `json:"is_owner"`
+	ShareToken    *string                  `json:"share_token,omitempty"` // Owner only, set while shared by link
+	CreatedAt     string                   `json:"created_at"`
+	UpdatedAt     string                   `json:"updated_at"`
+}
+
+// InstantiateResponse is the parent task and its subtasks created from a template
+type InstantiateResponse struct {
+	Task     TaskResponse   `json:"task"`
+	Children []TaskResponse `json:"children"`
+}
+
+// =====================================================
+// CRUD
+// =====================================================
+
+// List returns the user's templates
+// GET /templates
+func (h *TemplateHandler) List(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	rows, err := h.db.Query(c.Context(),
+		`SELECT `+templateColumns+`
+		 FROM task_templates
+		 WHERE user_id = $1 AND deleted_at IS NULL
+		 ORDER BY name ASC`,
+		userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer rows.Close()
+
+	items := make([]TemplateResponse, 0)
+	for rows.Next() {
+		tmpl, err := scanTemplate(rows)
+		if err != nil {
+			continue
+		}
+		items = append(items, toTemplateResponse(tmpl, userID))
+	}
+
+	return httputil.Success(c, items)
+}
+
+// Get returns a single template
+// GET /templates/:id
+func (h *TemplateHandler) Get(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tmpl, err := h.ownTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	return httputil.Success(c, toTemplateResponse(tmpl, userID))
+}
+
+// Create creates a template
+// POST /templates
+func (h *TemplateHandler) Create(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req TemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	tmpl, fields := req.toTemplate(userID)
+	if fields != nil {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+
+	if err := h.insertTemplate(c.Context(), tmpl); err != nil {
+		return httputil.InternalError(c, "failed to create template")
+	}
+
+	return httputil.Created(c, toTemplateResponse(tmpl, userID))
+}
+
+// Update replaces a template's content
+// PUT /templates/:id
+func (h *TemplateHandler) Update(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	existing, err := h.ownTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	var req TemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return httputil.BadRequest(c, "invalid request body")
+	}
+
+	tmpl, fields := req.toTemplate(userID)
+	if fields != nil {
+		return httputil.ValidationError(c, "validation failed", fields)
+	}
+	tmpl.ID = existing.ID
+	tmpl.ShareToken = existing.ShareToken
+	tmpl.CreatedAt = existing.CreatedAt
+
+	subtasksJSON, _ := json.Marshal(tmpl.Subtasks)
+	_, err = h.db.Exec(c.Context(),
+		`UPDATE task_templates
+		 SET name = $1, title = $2, description = $3, tags = $4, priority = $5,
+		     due_offset_days = $6, due_time = $7, subtasks = $8, updated_at = $9
+		 WHERE id = $10 AND user_id = $11`,
+		tmpl.Name, tmpl.Title, tmpl.Description, tmpl.Tags, tmpl.Priority,
+		tmpl.DueOffsetDays, tmpl.DueTime, subtasksJSON, tmpl.UpdatedAt,
+		tmpl.ID, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to update template")
+	}
+
+	return httputil.Success(c, toTemplateResponse(tmpl, userID))
+}
+
+// Delete deletes a template (its share link stops working)
+// DELETE /templates/:id
+func (h *TemplateHandler) Delete(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tmpl, err := h.ownTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.Exec(c.Context(),
+		`UPDATE task_templates SET deleted_at = NOW(), share_token = NULL, updated_at = NOW()
+		 WHERE id = $1 AND user_id = $2`,
+		tmpl.ID, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to delete template")
+	}
+
+	return httputil.NoContent(c)
+}
+
+// CreateFromTask turns a task and its subtasks into a template. Due dates
+// become offsets from the parent's due date (or the earliest subtask due date).
+// POST /templates/from-task/:taskId
+func (h *TemplateHandler) CreateFromTask(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	taskID, err := uuid.Parse(c.Params("taskId"))
+	if err != nil {
+		return httputil.BadRequest(c, "invalid task ID")
+	}
+
+	var req TemplateFromTaskRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return httputil.BadRequest(c, "invalid request body")
+		}
+	}
+
+	task, _, err := h.tasks.getTask(c.Context(), taskID, userID)
+	if err != nil {
+		return err
+	}
+
+	children, err := h.childTasks(c.Context(), task.ID)
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	if len(children) > models.MaxTemplateSubtasks {
+		children = children[:models.MaxTemplateSubtasks]
+	}
+
+	// Anchor: the parent's due date, else the earliest subtask due date
+	anchor := task.DueAt
+	if anchor == nil {
+		for _, child := range children {
+			if child.DueAt != nil && (anchor == nil || child.DueAt.Before(*anchor)) {
+				anchor = child.DueAt
+			}
+		}
+	}
+	if anchor == nil {
+		now := time.Now().UTC()
+		anchor = &now
+	}
+
+	tmpl := newTemplate(userID)
+	tmpl.Name = strings.TrimSpace(req.Name)
+	if tmpl.Name == "" {
+		tmpl.Name = task.Title
+	}
+	tmpl.Title = task.Title
+	tmpl.Description = task.Description
+	tmpl.Tags = task.Tags
+	tmpl.Priority = task.Priority
+	tmpl.DueOffsetDays, tmpl.DueTime = models.TemplateOffset(*anchor, task.DueAt, task.HasDueTime)
+	for _, child := range children {
+		st := models.TemplateSubtask{
+			Title:       child.Title,
+			Description: child.Description,
+			Priority:    child.Priority,
+		}
+		st.DueOffsetDays, st.DueTime = models.TemplateOffset(*anchor, child.DueAt, child.HasDueTime)
+		tmpl.Subtasks = append(tmpl.Subtasks, st)
+	}
+	if tmpl.Tags == nil {
+		tmpl.Tags = []string{}
+	}
+
+	if err := h.insertTemplate(c.Context(), tmpl); err != nil {
+		return httputil.InternalError(c, "failed to create template")
+	}
+
+	return httputil.Created(c, toTemplateResponse(tmpl, userID))
+}
+
+// =====================================================
+// Instantiate
+// =====================================================
+
+// Instantiate creates the parent task and its subtasks from a template
+// POST /templates/:id/instantiate
+func (h *TemplateHandler) Instantiate(c *fiber.Ctx) error {
+	tmpl, err := h.ownTemplate(c)
+	if err != nil {
+		return err
+	}
+	return h.instantiate(c, tmpl)
+}
+
+// InstantiateShared creates tasks from a template shared by link
+// POST /templates/shared/:token/instantiate
+func (h *TemplateHandler) InstantiateShared(c *fiber.Ctx) error {
+	tmpl, err := h.sharedTemplate(c)
+	if err != nil {
+		return err
+	}
+	return h.instantiate(c, tmpl)
+}
+
+func (h *TemplateHandler) instantiate(c *fiber.Ctx, tmpl *models.TaskTemplate) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	var req InstantiateRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return httputil.BadRequest(c, "invalid request body")
+		}
+	}
+
+	anchor := time.Now().UTC()
+	if req.AnchorDate != nil && *req.AnchorDate != "" {
+		parsed, ok := parseAnchorDate(*req.AnchorDate)
+		if !ok {
+			return httputil.ValidationError(c, "validation failed", map[string]string{
+				"anchor_date": "expected YYYY-MM-DD or RFC3339 timestamp",
+			})
+		}
+		anchor = parsed
+	}
+
+	rendered, missing := tmpl.Render(req.Variables)
+	if missing != nil {
+		fields := make(map[string]string, len(missing))
+		for _, name := range missing {
+			fields["variables."+name] = "required"
+		}
+		return httputil.ValidationError(c, "missing template variables", fields)
+	}
+
+	// A hashtag of a list shared with us as editor files the tasks there
+	ownerID := userID
+	if listOwner, ok := h.tasks.sharedListOwner(c.Context(), userID, rendered.Tags); ok {
+		ownerID = listOwner
+	}
+
+	parent := models.NewTask(ownerID, rendered.Title)
+	parent.Description = rendered.Description
+	parent.Tags = rendered.Tags
+	parent.Priority = rendered.Priority
+	parent.DueAt, parent.HasDueTime = models.TemplateDueAt(anchor, rendered.DueOffsetDays, rendered.DueTime)
+	parent.CreatedBy = &userID
+	parent.LastModifiedBy = &userID
+
+	children := make([]*models.Task, 0, len(rendered.Subtasks))
+	for i, st := range rendered.Subtasks {
+		child := models.NewTask(ownerID, st.Title)
+		child.Description = st.Description
+		child.Priority = st.Priority
+		child.DueAt, child.HasDueTime = models.TemplateDueAt(anchor, st.DueOffsetDays, st.DueTime)
+		child.SortOrder = i
+		child.CreatedBy = &userID
+		child.LastModifiedBy = &userID
+		if err := child.SetParent(parent.ID, parent.Depth); err != nil {
+			return httputil.BadRequest(c, err.Error())
+		}
+		children = append(children, child)
+	}
+
+	// Parent and subtasks are created together or not at all
+	tx, err := h.db.Begin(c.Context())
+	if err != nil {
+		return httputil.InternalError(c, "database error")
+	}
+	defer tx.Rollback(c.Context())
+
+	for _, task := range append([]*models.Task{parent}, children...) {
+		entitiesJSON, _ := json.Marshal(task.Entities)
+		_, err = tx.Exec(c.Context(),
+			`INSERT INTO tasks (id, user_id, title, description, status, priority, due_at, has_due_time, tags,
+			 parent_id, depth, sort_order, ai_entities, version, created_at, updated_at, created_by, last_modified_by)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+			task.ID, task.UserID, task.Title, task.Description, task.Status, task.Priority,
+			task.DueAt, task.HasDueTime, task.Tags, task.ParentID, task.Depth, task.SortOrder, entitiesJSON,
+			task.Version, task.CreatedAt, task.UpdatedAt, task.CreatedBy, task.LastModifiedBy,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to create tasks")
+		}
+	}
+
+	if err := tx.Commit(c.Context()); err != nil {
+		return httputil.InternalError(c, "failed to create tasks")
+	}
+
+	// Template text is already curated, so auto AI cleanup is skipped here
+	resp := InstantiateResponse{
+		Task:     toTaskResponse(parent, len(children)),
+		Children: make([]TaskResponse, 0, len(children)),
+	}
+	h.tasks.recordActivity(c.Context(), parent.ID, userID, "created", nil)
+	publishTaskEvent(ownerID, webhook.EventTaskCreated, resp.Task)
+	for _, child := range children {
+		childResp := toTaskResponse(child, 0)
+		resp.Children = append(resp.Children, childResp)
+		h.tasks.recordActivity(c.Context(), child.ID, userID, "created", nil)
+		publishTaskEvent(ownerID, webhook.EventTaskCreated, childResp)
+	}
+
+	return httputil.Created(c, resp)
+}
+
+// =====================================================
+// Share by link
+// =====================================================
+
+// Share creates (or returns) the template's share link token
+// POST /templates/:id/share
+func (h *TemplateHandler) Share(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tmpl, err := h.ownTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	if tmpl.ShareToken == nil {
+		token, err := generateTemplateToken()
+		if err != nil {
+			return httputil.InternalError(c, "failed to generate share link")
+		}
+		_, err = h.db.Exec(c.Context(),
+			"UPDATE task_templates SET share_token = $1, updated_at = NOW() WHERE id = $2 AND user_id = $3",
+			token, tmpl.ID, userID,
+		)
+		if err != nil {
+			return httputil.InternalError(c, "failed to share template")
+		}
+		tmpl.ShareToken = &token
+	}
+
+	return httputil.Success(c, toTemplateResponse(tmpl, userID))
+}
+
+// Unshare revokes the template's share link
+// DELETE /templates/:id/share
+func (h *TemplateHandler) Unshare(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tmpl, err := h.ownTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.Exec(c.Context(),
+		"UPDATE task_templates SET share_token = NULL, updated_at = NOW() WHERE id = $1 AND user_id = $2",
+		tmpl.ID, userID,
+	)
+	if err != nil {
+		return httputil.InternalError(c, "failed to unshare template")
+	}
+	tmpl.ShareToken = nil
+
+	return httputil.Success(c, toTemplateResponse(tmpl, userID))
+}
+
+// GetShared returns a template shared by link
+// GET /templates/shared/:token
+func (h *TemplateHandler) GetShared(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	tmpl, err := h.sharedTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	return httputil.Success(c, toTemplateResponse(tmpl, userID))
+}
+
+// CopyShared saves a copy of a shared template to the user's templates
+// POST /templates/shared/:token/copy
+func (h *TemplateHandler) CopyShared(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return httputil.Unauthorized(c, "")
+	}
+
+	shared, err := h.sharedTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	tmpl := newTemplate(userID)
+	tmpl.Name = shared.Name
+	tmpl.Title = shared.Title
+	tmpl.Description = shared.Description
+	tmpl.Tags = shared.Tags
+	tmpl.Priority = shared.Priority
+	tmpl.DueOffsetDays = shared.DueOffsetDays
+	tmpl.DueTime = shared.DueTime
+	tmpl.Subtasks = shared.Subtasks
+
+	if err := h.insertTemplate(c.Context(), tmpl); err != nil {
+		return httputil.InternalError(c, "failed to copy template")
+	}
+
+	return httputil.Created(c, toTemplateResponse(tmpl, userID))
+}
+
+// =====================================================
+// Helpers
+// =====================================================
+
+const templateColumns = `id, user_id, name, title, description, tags, priority,
+	due_offset_days, due_time, subtasks, share_token, created_at, updated_at`
+
+func newTemplate(userID uuid.UUID) *models.TaskTemplate {
+	now := time.Now()
+	return &models.TaskTemplate{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Tags:      []string{},
+		Subtasks:  []models.TemplateSubtask{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// toTemplate validates the request and builds a template from it.
+// Returns the invalid fields, if any.
+func (req *TemplateRequest) toTemplate(userID uuid.UUID) (*models.TaskTemplate, map[string]string) {
+	fields := make(map[string]string)
+
+	tmpl := newTemplate(userID)
+	tmpl.Name = strings.TrimSpace(req.Name)
+	tmpl.Title = strings.TrimSpace(req.Title)
+	tmpl.Description = req.Description
+	tmpl.DueOffsetDays = req.DueOffsetDays
+	tmpl.DueTime = req.DueTime
+	if req.Tags != nil {
+		tmpl.Tags = req.Tags
+	}
+	if tmpl.Name == "" {
+		tmpl.Name = tmpl.Title
+	}
+
+	if tmpl.Title == "" {
+		fields["title"] = "required"
+	}
+	if req.Priority != nil {
+		tmpl.Priority = commonModels.Priority(*req.Priority)
+		if !tmpl.Priority.IsValid() {
+			fields["priority"] = "must be between 0 and 4"
+		}
+	}
+	if !validTemplateDue(req.DueOffsetDays, req.DueTime) {
+		fields["due_time"] = "expected HH:MM, together with due_offset_days"
+	}
+
+	if len(req.Subtasks) > models.MaxTemplateSubtasks {
+		fields["subtasks"] = "too many subtasks"
+	}
+	for i, st := range req.Subtasks {
+		st.Title = strings.TrimSpace(st.Title)
+		key := "subtasks." + strconv.Itoa(i)
+		switch {
+		case st.Title == "":
+			fields[key+".title"] = "required"
+		case !st.Priority.IsValid():
+			fields[key+".priority"] = "must be between 0 and 4"
+		case !validTemplateDue(st.DueOffsetDays, st.DueTime):
+			fields[key+".due_time"] = "expected HH:MM, together with due_offset_days"
+		}
+		tmpl.Subtasks = append(tmpl.Subtasks, st)
+	}
+
+	if len(fields) > 0 {
+		return nil, fields
+	}
+	return tmpl, nil
+}
+
+// validTemplateDue checks that a due time is "HH:MM" and only set with an offset
+func validTemplateDue(offsetDays *int, dueTime *string) bool {
+	if dueTime == nil {
+		return true
+	}
+	_, _, ok := models.ParseTemplateTime(*dueTime)
+	return ok && offsetDays != nil
+}
+
+func (h *TemplateHandler) insertTemplate(ctx context.Context, tmpl *models.TaskTemplate) error {
+	subtasksJSON, _ := json.Marshal(tmpl.Subtasks)
+	_, err := h.db.Exec(ctx,
+		`INSERT INTO task_templates (id, user_id, name, title, description, tags, priority,
+		 due_offset_days, due_time, subtasks, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		tmpl.ID, tmpl.UserID, tmpl.Name, tmpl.Title, tmpl.Description, tmpl.Tags, tmpl.Priority,
+		tmpl.DueOffsetDays, tmpl.DueTime, subtasksJSON, tmpl.CreatedAt, tmpl.UpdatedAt,
+	)
+	return err
+}
+
+// ownTemplate loads the template in :id owned by the caller
+func (h *TemplateHandler) ownTemplate(c *fiber.Ctx) (*models.TaskTemplate, error) {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "unauthorized")
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid template ID")
+	}
+
+	return h.loadTemplate(c.Context(),
+		"id = $1 AND user_id = $2", id, userID)
+}
+
+// sharedTemplate loads the template shared under :token
+func (h *TemplateHandler) sharedTemplate(c *fiber.Ctx) (*models.TaskTemplate, error) {
+	return h.loadTemplate(c.Context(), "share_token = $1", c.Params("token"))
+}
+
+func (h *TemplateHandler) loadTemplate(ctx context.Context, where string, args ...any) (*models.TaskTemplate, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT `+templateColumns+` FROM task_templates WHERE `+where+` AND deleted_at IS NULL`,
+		args...,
+	)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "database error")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fiber.NewError(fiber.StatusNotFound, "template not found")
+	}
+	tmpl, err := scanTemplate(rows)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "database error")
+	}
+
+	return tmpl, nil
+}
+
+func scanTemplate(rows pgx.Rows) (*models.TaskTemplate, error) {
+	var tmpl models.TaskTemplate
+	var subtasksJSON []byte
+	err := rows.Scan(
+		&tmpl.ID, &tmpl.UserID, &tmpl.Name, &tmpl.Title, &tmpl.Description, &tmpl.Tags, &tmpl.Priority,
+		&tmpl.DueOffsetDays, &tmpl.DueTime, &subtasksJSON, &tmpl.ShareToken, &tmpl.CreatedAt, &tmpl.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subtasksJSON) > 0 {
+		_ = json.Unmarshal(subtasksJSON, &tmpl.Subtasks)
+	}
+	if tmpl.Subtasks == nil {
+		tmpl.Subtasks = []models.TemplateSubtask{}
+	}
+	if tmpl.Tags == nil {
+		tmpl.Tags = []string{}
+	}
+
+	return &tmpl, nil
+}
+
+// childTasks returns a task's subtasks in display order
+func (h *TemplateHandler) childTasks(ctx context.Context, parentID uuid.UUID) ([]*models.Task, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT title, description, priority, due_at, has_due_time
+		 FROM tasks
+		 WHERE parent_id = $1 AND deleted_at IS NULL
+		 ORDER BY sort_order ASC, created_at ASC`,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []*models.Task
+	for rows.Next() {
+		var child models.Task
+		if err := rows.Scan(&child.Title, &child.Description, &child.Priority, &child.DueAt, &child.HasDueTime); err != nil {
+			return nil, err
+		}
+		children = append(children, &child)
+	}
+
+	return children, rows.Err()
+}
+
+func toTemplateResponse(t *models.TaskTemplate, userID uuid.UUID) TemplateResponse {
+	resp := TemplateResponse{
+		ID:            t.ID.String(),
+		Name:          t.Name,
+		Title:         t.Title,
+		Description:   t.Description,
+		Tags:          t.Tags,
+		Priority:      int(t.Priority),
+		DueOffsetDays: t.DueOffsetDays,
+		DueTime:       t.DueTime,
+		Subtasks:      t.Subtasks,
+		Variables:     t.Variables(),
+		IsOwner:       t.UserID == userID,
+		CreatedAt:     t.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     t.UpdatedAt.Format(time.RFC3339),
+	}
+	if resp.IsOwner {
+		resp.ShareToken = t.ShareToken
+	}
+	return resp
+}
+
+// parseAnchorDate accepts a calendar date (midnight UTC) or an RFC3339
+// timestamp, whose offset then decides the day and time zone of due dates
+func parseAnchorDate(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// generateTemplateToken creates the token used in a template share link
+func generateTemplateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
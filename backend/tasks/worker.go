@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/csaptu/flow/pkg/config"
+	"github.com/csaptu/flow/shared/llmcache"
+	"github.com/csaptu/flow/shared/llmroute"
+	"github.com/csaptu/flow/shared/llmusage"
+	"github.com/csaptu/flow/shared/privacy"
+	"github.com/csaptu/flow/shared/prompts"
+	"github.com/csaptu/flow/shared/repository"
+)
+
+// Worker runs the AI job queue without the HTTP API (cmd/ai-worker), so AI
+// processing can be scaled and deployed separately from request serving
+type Worker struct {
+	db    *pgxpool.Pool
+	redis *redis.Client
+	pool  *AIWorkerPool
+}
+
+// NewWorker connects to the tasks database, Redis and the LLM providers
+func NewWorker(cfg *config.Config, workers int) (*Worker, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("at least one worker is required")
+	}
+
+	db, err := initDatabase(cfg.Databases.Tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Tier, preferences and drafts are read from the shared database
+	if err := repository.Init(cfg); err != nil {
+		return nil, fmt.Errorf("failed to initialize shared repository: %w", err)
+	}
+
+	redisClient, err := initRedis(cfg.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	llmClient := initLLM(cfg.LLM)
+	if llmClient == nil {
+		return nil, fmt.Errorf("no LLM provider configured")
+	}
+	llmcache.Enable(llmClient, redisClient, cfg.LLM)
+	llmusage.Enable(llmClient, cfg.LLM)
+	privacy.Enable(llmClient, db)
+	llmroute.Enable(llmClient)
+	go prompts.Listen(context.Background(), redisClient)
+	go llmroute.Listen(context.Background(), redisClient)
+
+	processor := NewAIProcessor(db, redisClient, llmClient)
+	return &Worker{
+		db:    db,
+		redis: redisClient,
+		pool:  NewAIWorkerPool(processor, workers),
+	}, nil
+}
+
+// Start starts processing jobs
+func (w *Worker) Start() {
+	w.pool.Start()
+}
+
+// ShutdownWithContext waits for running jobs, then closes connections
+func (w *Worker) ShutdownWithContext(ctx context.Context) error {
+	err := w.pool.Stop(ctx)
+	w.db.Close()
+	_ = w.redis.Close()
+	return err
+}
@@ -637,8 +637,8 @@ class TasksService {
     throw ApiException.fromResponse(response.data);
   }
 
-  /// Approve a draft (and optionally send it)
-  Future<void> approveDraft(String draftId, {bool send = false}) async {
+  /// Approve and send a draft (with [send] false it is only approved)
+  Future<void> approveDraft(String draftId, {bool send = true}) async {
     final response = await _sharedDio.post('/ai/drafts/$draftId/approve', data: {
       'send': send,
     });